@@ -69,66 +69,75 @@ func accessLevel(c context.Context, r *http.Request) AccessLevel {
 	return AccessUser
 }
 
-func checkTextAccess(c context.Context, r *http.Request, tag string, id int64) (*Bug, *Crash, error) {
+func checkTextAccess(c context.Context, r *http.Request, tag string, id int64) (
+	*Bug, *Crash, *db.Key, error) {
 	switch tag {
 	default:
-		return nil, nil, checkAccessLevel(c, r, AccessAdmin)
+		return nil, nil, nil, checkAccessLevel(c, r, AccessAdmin)
 	case textPatch:
-		return nil, nil, checkJobTextAccess(c, r, "Patch", id)
+		return nil, nil, nil, checkJobTextAccess(c, r, "Patch", id)
 	case textLog:
-		return nil, nil, checkJobTextAccess(c, r, "Log", id)
+		return nil, nil, nil, checkJobTextAccess(c, r, "Log", id)
 	case textError:
-		return nil, nil, checkJobTextAccess(c, r, "Error", id)
+		return nil, nil, nil, checkJobTextAccess(c, r, "Error", id)
 	case textKernelConfig:
 		// This is checked based on text namespace.
-		return nil, nil, nil
+		return nil, nil, nil, nil
 	case textCrashLog:
 		// Log and Report can be attached to a Crash or Job.
-		bug, crash, err := checkCrashTextAccess(c, r, "Log", id)
+		bug, crash, crashKey, err := checkCrashTextAccess(c, r, "Log", id)
 		if err == nil || err == ErrAccess {
-			return bug, crash, err
+			return bug, crash, crashKey, err
 		}
-		return nil, nil, checkJobTextAccess(c, r, "CrashLog", id)
+		return nil, nil, nil, checkJobTextAccess(c, r, "CrashLog", id)
 	case textCrashReport:
-		bug, crash, err := checkCrashTextAccess(c, r, "Report", id)
+		bug, crash, crashKey, err := checkCrashTextAccess(c, r, "Report", id)
 		if err == nil || err == ErrAccess {
-			return bug, crash, err
+			return bug, crash, crashKey, err
 		}
-		return nil, nil, checkJobTextAccess(c, r, "CrashReport", id)
-	case textReproSyz:
-		return checkCrashTextAccess(c, r, "ReproSyz", id)
-	case textReproC:
-		return checkCrashTextAccess(c, r, "ReproC", id)
+		return nil, nil, nil, checkJobTextAccess(c, r, "CrashReport", id)
+	case textReproSyz, textReproC:
+		// Reproducers uploaded by developers are not attached to any Crash.
+		field := "ReproSyz"
+		if tag == textReproC {
+			field = "ReproC"
+		}
+		bug, crash, crashKey, err := checkCrashTextAccess(c, r, field, id)
+		if errors.Is(err, ErrClientNotFound) {
+			return checkUploadedReproAccess(c, r, field, id)
+		}
+		return bug, crash, crashKey, err
 	case textMachineInfo:
 		// MachineInfo is deduplicated, so we can't find the exact crash/bug.
 		// But since machine info is usually the same for all bugs and is not secret,
 		// it's fine to check based on the namespace.
-		return nil, nil, nil
+		return nil, nil, nil, nil
 	}
 }
 
-func checkCrashTextAccess(c context.Context, r *http.Request, field string, id int64) (*Bug, *Crash, error) {
+func checkCrashTextAccess(c context.Context, r *http.Request, field string, id int64) (
+	*Bug, *Crash, *db.Key, error) {
 	var crashes []*Crash
 	keys, err := db.NewQuery("Crash").
 		Filter(field+"=", id).
 		GetAll(c, &crashes)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to query crashes: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to query crashes: %v", err)
 	}
 	if len(crashes) != 1 {
 		err := fmt.Errorf("checkCrashTextAccess: found %v crashes for %v=%v", len(crashes), field, id)
 		if len(crashes) == 0 {
 			err = fmt.Errorf("%v: %w", err, ErrClientNotFound)
 		}
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	crash := crashes[0]
 	bug := new(Bug)
 	if err := db.Get(c, keys[0].Parent(), bug); err != nil {
-		return nil, nil, fmt.Errorf("failed to get bug: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to get bug: %v", err)
 	}
-	bugLevel := bug.sanitizeAccess(accessLevel(c, r))
-	return bug, crash, checkAccessLevel(c, r, bugLevel)
+	bugLevel := bug.sanitizeAccess(namespaceAccessLevel(c, r, bug.Namespace))
+	return bug, crash, keys[0], checkNamespaceAccessLevel(c, r, bug.Namespace, bugLevel)
 }
 
 func checkJobTextAccess(c context.Context, r *http.Request, field string, id int64) error {
@@ -151,8 +160,8 @@ func checkJobTextAccess(c context.Context, r *http.Request, field string, id int
 	if err := db.Get(c, keys[0].Parent(), bug); err != nil {
 		return fmt.Errorf("failed to get bug: %v", err)
 	}
-	bugLevel := bug.sanitizeAccess(accessLevel(c, r))
-	return checkAccessLevel(c, r, bugLevel)
+	bugLevel := bug.sanitizeAccess(namespaceAccessLevel(c, r, bug.Namespace))
+	return checkNamespaceAccessLevel(c, r, bug.Namespace, bugLevel)
 }
 
 func (bug *Bug) sanitizeAccess(currentLevel AccessLevel) AccessLevel {
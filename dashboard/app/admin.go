@@ -17,6 +17,7 @@ import (
 // dropNamespace drops all entities related to a single namespace.
 // Use with care. There is no undo.
 // This functionality is intentionally not connected to any handler.
+// Decommissioned namespaces are deleted by the namespace deletion job (see namespace_deletion.go).
 // To use it, first make a backup of the db. Then, specify the target
 // namespace in the ns variable, connect the function to a handler, invoke it
 // and double check the output. Finally, set dryRun to false and invoke again.
@@ -28,9 +29,11 @@ func dropNamespace(c context.Context, w http.ResponseWriter, r *http.Request) er
 	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	fmt.Fprintf(w, "dropping namespace %v\n", ns)
-	if err := dropNamespaceReportingState(c, w, ns, dryRun); err != nil {
+	dropped, err := dropNamespaceReportingState(c, ns, dryRun)
+	if err != nil {
 		return err
 	}
+	fmt.Fprintf(w, "ReportingState: %v\n", dropped)
 	type Entity struct {
 		name  string
 		child string
@@ -40,12 +43,17 @@ func dropNamespace(c context.Context, w http.ResponseWriter, r *http.Request) er
 		{textReproC, ""},
 		{textReproSyz, ""},
 		{textKernelConfig, ""},
+		{textVMConfig, ""},
 		{"Job", ""},
 		{textLog, ""},
 		{textError, ""},
 		{textCrashLog, ""},
 		{textCrashReport, ""},
 		{"Build", ""},
+		{"NamespaceRole", ""},
+		{"CorpusImport", ""},
+		{"ReportingPause", ""},
+		{"BugListing", ""},
 		{"Manager", "ManagerStats"},
 		{"Bug", "Crash"},
 	}
@@ -82,7 +90,10 @@ func dropNamespace(c context.Context, w http.ResponseWriter, r *http.Request) er
 	return nil
 }
 
-func dropNamespaceReportingState(c context.Context, w http.ResponseWriter, ns string, dryRun bool) error {
+// dropNamespaceReportingState removes the reporting quota entries of the namespace
+// and returns the number of the removed entries.
+func dropNamespaceReportingState(c context.Context, ns string, dryRun bool) (int, error) {
+	dropped := 0
 	tx := func(c context.Context) error {
 		state, err := loadReportingState(c)
 		if err != nil {
@@ -99,10 +110,13 @@ func dropNamespaceReportingState(c context.Context, w http.ResponseWriter, ns st
 				return err
 			}
 		}
-		fmt.Fprintf(w, "ReportingState: %v\n", len(state.Entries)-len(newState.Entries))
+		dropped = len(state.Entries) - len(newState.Entries)
 		return nil
 	}
-	return db.RunInTransaction(c, tx, nil)
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return 0, err
+	}
+	return dropped, nil
 }
 
 func dropEntities(c context.Context, keys []*db.Key, dryRun bool) error {
@@ -287,6 +301,102 @@ func setMissingBugFields(c context.Context, w http.ResponseWriter, r *http.Reque
 	return updateBugBatch(c, keys, func(bug *Bug) {})
 }
 
+// moveDiscussions re-attaches discussions of one bug to another one.
+// This can be used after a bug was transferred to another namespace.
+// This functionality is intentionally not connected to any handler.
+func moveDiscussions(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if accessLevel(c, r) != AccessAdmin {
+		return fmt.Errorf("admin only")
+	}
+	from, to := r.FormValue("from"), r.FormValue("to")
+	if from == "" || to == "" {
+		return fmt.Errorf("from and to bug IDs must be specified")
+	}
+	err := moveBugDiscussions(c, db.NewKey(c, "Bug", from, 0, nil), db.NewKey(c, "Bug", to, 0, nil))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Done!\n")
+	return nil
+}
+
+// replaySpilledDiscussions processes discussion updates that were dropped due to source quotas.
+// This functionality is intentionally not connected to any handler.
+func replaySpilledDiscussions(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if accessLevel(c, r) != AccessAdmin {
+		return fmt.Errorf("admin only")
+	}
+	replayed, err := replayDiscussionSpills(c, 100)
+	fmt.Fprintf(w, "replayed %v updates\n", replayed)
+	return err
+}
+
+// backfillCrashMatrices creates crash matrices (see crash_matrix.go) for the bugs
+// that crashed recently, but have no matrix yet.
+// This functionality is intentionally not connected to any handler.
+func backfillCrashMatrices(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if accessLevel(c, r) != AccessAdmin {
+		return fmt.Errorf("admin only")
+	}
+	var bugs []*Bug
+	keys, err := db.NewQuery("Bug").
+		Filter("LastTime>", timeNow(c).Add(-maxManagerStatsDays*24*time.Hour)).
+		GetAll(c, &bugs)
+	if err != nil {
+		return err
+	}
+	updated := 0
+	for i, bug := range bugs {
+		existing, err := db.NewQuery("BugManagerStats").
+			Ancestor(keys[i]).
+			KeysOnly().
+			Limit(1).
+			GetAll(c, nil)
+		if err != nil {
+			return err
+		}
+		if len(existing) != 0 {
+			continue
+		}
+		if err := backfillManagerStats(c, bug, keys[i]); err != nil {
+			return err
+		}
+		updated++
+	}
+	fmt.Fprintf(w, "updated %v bugs\n", updated)
+	return nil
+}
+
+// backfillBugEvents synthesizes the timeline events (see bug_events.go) of the namespace bugs
+// that changed before the timeline was recorded.
+// This functionality is intentionally not connected to any handler.
+func backfillBugEvents(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if accessLevel(c, r) != AccessAdmin {
+		return fmt.Errorf("admin only")
+	}
+	ns := r.FormValue("ns")
+	if config.Namespaces[ns] == nil {
+		return fmt.Errorf("unknown namespace %q", ns)
+	}
+	_, keys, err := loadNamespaceBugs(c, ns)
+	if err != nil {
+		return err
+	}
+	bugs, events := 0, 0
+	for _, key := range keys {
+		added, err := backfillBugTimeline(c, key)
+		if err != nil {
+			return err
+		}
+		if added != 0 {
+			bugs++
+			events += added
+		}
+	}
+	fmt.Fprintf(w, "added %v events to %v bugs\n", events, bugs)
+	return nil
+}
+
 // adminSendEmail can be used to send an arbitrary message from the bot.
 func adminSendEmail(c context.Context, w http.ResponseWriter, r *http.Request) error {
 	if accessLevel(c, r) != AccessAdmin {
@@ -309,13 +419,17 @@ func updateBugBatch(c context.Context, keys []*db.Key, transform func(bug *Bug))
 		batchKeys := keys[:batchSize]
 		keys = keys[batchSize:]
 
+		var namespaces map[string]bool
+		var bugs []*Bug
 		tx := func(c context.Context) error {
-			bugs := make([]*Bug, len(batchKeys))
+			bugs = make([]*Bug, len(batchKeys))
 			if err := db.GetMulti(c, batchKeys, bugs); err != nil {
 				return err
 			}
+			namespaces = make(map[string]bool)
 			for _, bug := range bugs {
 				transform(bug)
+				namespaces[bug.Namespace] = true
 			}
 			_, err := db.PutMulti(c, batchKeys, bugs)
 			return err
@@ -323,6 +437,13 @@ func updateBugBatch(c context.Context, keys []*db.Key, transform func(bug *Bug))
 		if err := db.RunInTransaction(c, tx, &db.TransactionOptions{XG: true}); err != nil {
 			return err
 		}
+		for ns := range namespaces {
+			invalidateBugLists(c, ns)
+		}
+		for _, bug := range bugs {
+			// The transformation may have assigned new reporting IDs.
+			forgetReportingIDs(c, bug)
+		}
 		log.Warningf(c, "updated %v bugs", len(batchKeys))
 	}
 	return nil
@@ -336,4 +457,9 @@ var (
 	_ = restartFailedBisections
 	_ = setMissingBugFields
 	_ = adminSendEmail
+	_ = moveDiscussions
+	_ = replaySpilledDiscussions
+	_ = backfillCrashMatrices
+	_ = backfillReportKeywords
+	_ = backfillBugEvents
 )
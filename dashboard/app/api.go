@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -23,6 +24,7 @@ import (
 	"github.com/google/syzkaller/pkg/auth"
 	"github.com/google/syzkaller/pkg/email"
 	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/report"
 	"github.com/google/syzkaller/pkg/subsystem"
 	"github.com/google/syzkaller/sys/targets"
 	"golang.org/x/net/context"
@@ -51,19 +53,29 @@ var apiHandlers = map[string]APIHandler{
 }
 
 var apiNamespaceHandlers = map[string]APINamespaceHandler{
-	"upload_build":        apiUploadBuild,
-	"builder_poll":        apiBuilderPoll,
-	"report_build_error":  apiReportBuildError,
-	"report_crash":        apiReportCrash,
-	"report_failed_repro": apiReportFailedRepro,
-	"need_repro":          apiNeedRepro,
-	"manager_stats":       apiManagerStats,
-	"commit_poll":         apiCommitPoll,
-	"upload_commits":      apiUploadCommits,
-	"bug_list":            apiBugList,
-	"load_bug":            apiLoadBug,
-	"update_report":       apiUpdateReport,
-	"add_build_assets":    apiAddBuildAssets,
+	"upload_build":                apiUploadBuild,
+	"builder_poll":                apiBuilderPoll,
+	"report_build_error":          apiReportBuildError,
+	"report_crash":                apiReportCrash,
+	"report_failed_repro":         apiReportFailedRepro,
+	"need_repro":                  apiNeedRepro,
+	"manager_stats":               apiManagerStats,
+	"manager_descriptions":        apiManagerDescriptions,
+	"commit_poll":                 apiCommitPoll,
+	"upload_commits":              apiUploadCommits,
+	"bug_list":                    apiBugList,
+	"load_bug":                    apiLoadBug,
+	"update_report":               apiUpdateReport,
+	"add_build_assets":            apiAddBuildAssets,
+	"bulk_update_bugs":            apiBulkUpdateBugs,
+	"load_bisections":             apiLoadBisections,
+	"upload_backports":            apiUploadBackports,
+	"upload_releases":             apiUploadReleases,
+	"upload_watch_results":        apiUploadWatchResults,
+	"report_external_observation": apiReportExternalObservation,
+	"report_corpus":               apiReportCorpus,
+	"corpus_import_done":          apiCorpusImportDone,
+	"report_discussion":           apiReportDiscussion,
 }
 
 type JSONHandler func(c context.Context, r *http.Request) (interface{}, error)
@@ -77,6 +89,8 @@ const (
 	// 1) Improve old repros over time (as we update descriptions / change syntax / repro algorithms).
 	// 2) Constrain the impact of bugs in syzkaller's backward compatibility. Fewer old repros, fewer problems.
 	reproStalePeriod = 100 * 24 * time.Hour
+	// Retry period for bugs where developers explicitly asked for a reproducer.
+	reproRequestedRetryPeriod = 6 * time.Hour
 )
 
 // Overridable for testing.
@@ -97,12 +111,22 @@ func handleJSON(fn JSONHandler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c := appengine.NewContext(r)
 		reply, err := fn(c, r)
+		var rateErr *ErrRateLimited
+		if errors.As(err, &rateErr) {
+			log.Warningf(c, "%v", err)
+			writeTooManyRequests(w, rateErr.RetryAfter)
+			return
+		}
 		if err != nil {
 			// ErrAccess is logged earlier.
 			if err != ErrAccess {
 				log.Errorf(c, "%v", err)
 			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			status := http.StatusInternalServerError
+			if err == ErrReadOnly {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), status)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -141,19 +165,15 @@ func handleAPI(c context.Context, r *http.Request) (reply interface{}, err error
 		}
 		return nil, err
 	}
-	var payload []byte
-	if str := r.PostFormValue("payload"); str != "" {
-		gr, err := gzip.NewReader(strings.NewReader(str))
-		if err != nil {
-			return nil, fmt.Errorf("failed to ungzip payload: %v", err)
-		}
-		payload, err = io.ReadAll(gr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to ungzip payload: %v", err)
-		}
-		if err := gr.Close(); err != nil {
-			return nil, fmt.Errorf("failed to ungzip payload: %v", err)
-		}
+	if err := publicRateLimiter.checkClient(c, client); err != nil {
+		return nil, err
+	}
+	if queued, err := apiReadOnly(c, ns, method, r.PostFormValue("payload")); queued || err != nil {
+		return nil, err
+	}
+	payload, err := ungzipPayload(r.PostFormValue("payload"))
+	if err != nil {
+		return nil, err
 	}
 	handler := apiHandlers[method]
 	if handler != nil {
@@ -169,6 +189,24 @@ func handleAPI(c context.Context, r *http.Request) (reply interface{}, err error
 	return nsHandler(c, ns, r, payload)
 }
 
+func ungzipPayload(str string) ([]byte, error) {
+	if str == "" {
+		return nil, nil
+	}
+	gr, err := gzip.NewReader(strings.NewReader(str))
+	if err != nil {
+		return nil, fmt.Errorf("failed to ungzip payload: %v", err)
+	}
+	payload, err := io.ReadAll(gr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ungzip payload: %v", err)
+	}
+	if err := gr.Close(); err != nil {
+		return nil, fmt.Errorf("failed to ungzip payload: %v", err)
+	}
+	return payload, nil
+}
+
 func apiLogError(c context.Context, r *http.Request, payload []byte) (interface{}, error) {
 	req := new(dashapi.LogEntry)
 	if err := json.Unmarshal(payload, req); err != nil {
@@ -240,8 +278,13 @@ func apiCommitPoll(c context.Context, ns string, r *http.Request, payload []byte
 			Branch: repo.Branch,
 		})
 	}
+	hinted, err := hintedCommitPollRepos(c, ns)
+	if err != nil {
+		return nil, err
+	}
+	resp.HintedRepos = hinted
 	var bugs []*Bug
-	_, err := db.NewQuery("Bug").
+	_, err = db.NewQuery("Bug").
 		Filter("Namespace=", ns).
 		Filter("NeedCommitInfo=", true).
 		Project("Commits").
@@ -259,9 +302,47 @@ func apiCommitPoll(c context.Context, ns string, r *http.Request, payload []byte
 	for com := range commits {
 		resp.Commits = append(resp.Commits, com)
 	}
+	resp.Backports, err = backportPolls(c, ns)
+	if err != nil {
+		return nil, err
+	}
+	resp.Releases, err = releasePolls(c, ns)
+	if err != nil {
+		return nil, err
+	}
+	resp.Watches, err = commitWatchPolls(c, ns)
+	if err != nil {
+		return nil, err
+	}
 	return resp, nil
 }
 
+// hintedCommitPollRepos returns the non-main repos of the namespace that the recently
+// active patch discussions target, the most popular first.
+func hintedCommitPollRepos(c context.Context, ns string) ([]dashapi.Repo, error) {
+	counts, err := recentTargetTrees(c)
+	if err != nil {
+		return nil, err
+	}
+	var repos []KernelRepo
+	for i, repo := range config.Namespaces[ns].Repos {
+		if i != 0 && !repo.Obsolete && counts[strings.ToLower(repo.Alias)] != 0 {
+			repos = append(repos, repo)
+		}
+	}
+	sort.SliceStable(repos, func(i, j int) bool {
+		return counts[strings.ToLower(repos[i].Alias)] > counts[strings.ToLower(repos[j].Alias)]
+	})
+	var ret []dashapi.Repo
+	for _, repo := range repos {
+		ret = append(ret, dashapi.Repo{
+			URL:    repo.URL,
+			Branch: repo.Branch,
+		})
+	}
+	return ret, nil
+}
+
 func apiUploadCommits(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
 	req := new(dashapi.CommitPollResultReq)
 	if err := json.Unmarshal(payload, req); err != nil {
@@ -339,14 +420,24 @@ func addCommitInfoToBugImpl(c context.Context, bug *Bug, com dashapi.Commit) (bo
 	for len(bug.CommitInfo) < len(bug.Commits) {
 		bug.CommitInfo = append(bug.CommitInfo, Commit{})
 	}
+	if bug.CommitInfo[ci].Pinned {
+		return false, nil
+	}
 	hash0 := bug.CommitInfo[ci].Hash
 	date0 := bug.CommitInfo[ci].Date
 	author0 := bug.CommitInfo[ci].Author
+	conflicts0 := bug.CommitInfo[ci].Conflicts
 	needCommitInfo0 := bug.NeedCommitInfo
 
+	if hash0 != com.Hash {
+		bug.CommitInfo[ci].Release = ""
+		bug.ReleasesDone = false
+	}
 	bug.CommitInfo[ci].Hash = com.Hash
 	bug.CommitInfo[ci].Date = com.Date
 	bug.CommitInfo[ci].Author = com.Author
+	bug.CommitInfo[ci].Conflicts = strings.Join(com.ConflictingHashes, "|")
+	bug.updateFixCommitConflict()
 	bug.NeedCommitInfo = false
 	for i := range bug.CommitInfo {
 		if bug.CommitInfo[i].Hash == "" {
@@ -357,6 +448,7 @@ func addCommitInfoToBugImpl(c context.Context, bug *Bug, com dashapi.Commit) (bo
 	changed := hash0 != bug.CommitInfo[ci].Hash ||
 		date0 != bug.CommitInfo[ci].Date ||
 		author0 != bug.CommitInfo[ci].Author ||
+		conflicts0 != bug.CommitInfo[ci].Conflicts ||
 		needCommitInfo0 != bug.NeedCommitInfo
 	return changed, nil
 }
@@ -417,7 +509,7 @@ func apiUploadBuild(c context.Context, ns string, r *http.Request, payload []byt
 				req.Manager, prevKernel, req.KernelCommit, prevSyzkaller, req.SyzkallerCommit)
 			mgr.CurrentBuild = req.ID
 			if req.KernelCommit != prevKernel {
-				mgr.FailedBuildBug = ""
+				mgr.buildFixed(now)
 			}
 			if req.SyzkallerCommit != prevSyzkaller {
 				mgr.FailedSyzBuildBug = ""
@@ -491,6 +583,10 @@ func uploadBuild(c context.Context, now time.Time, ns string, req *dashapi.Build
 	if err != nil {
 		return nil, false, err
 	}
+	vmConfigID, err := putVMConfig(c, ns, req.VMConfig)
+	if err != nil {
+		return nil, false, err
+	}
 	build := &Build{
 		Namespace:           ns,
 		Manager:             req.Manager,
@@ -509,17 +605,21 @@ func uploadBuild(c context.Context, now time.Time, ns string, req *dashapi.Build
 		KernelCommitTitle:   req.KernelCommitTitle,
 		KernelCommitDate:    req.KernelCommitDate,
 		KernelConfig:        configID,
+		KernelConfigHash:    kernelConfigHash(req.KernelConfig),
+		VMConfig:            vmConfigID,
 		Assets:              newAssets,
 	}
 	if _, err := db.Put(c, buildKey(c, ns, req.ID), build); err != nil {
 		return nil, false, err
 	}
+	recordAssetWrites(c, ns, req.Assets)
 	return build, true, nil
 }
 
 func addCommitsToBugs(c context.Context, ns, manager string, titles []string, fixCommits []dashapi.Commit) error {
 	presentCommits := make(map[string]bool)
 	bugFixedBy := make(map[string][]string)
+	var batchCommits []string
 	for _, com := range titles {
 		presentCommits[com] = true
 	}
@@ -528,26 +628,47 @@ func addCommitsToBugs(c context.Context, ns, manager string, titles []string, fi
 		for _, bugID := range com.BugIDs {
 			bugFixedBy[bugID] = append(bugFixedBy[bugID], com.Title)
 		}
+		if len(com.BugIDs) != 0 {
+			batchCommits = append(batchCommits, com.Title)
+		}
 	}
 	managers, err := managerList(c, ns)
 	if err != nil {
 		return err
 	}
+	batch := &fixBatch{
+		manager:        manager,
+		managers:       managers,
+		presentCommits: presentCommits,
+		bugFixedBy:     bugFixedBy,
+		seenBugIDs:     make(map[string]bool),
+	}
 	// Fetching all bugs in a namespace can be slow, and there is no way to filter only Open/Dup statuses.
 	// So we run a separate query for each status, this both avoids fetching unnecessary data
 	// and splits a long query into two (two smaller queries have lower chances of trigerring
 	// timeouts than one huge).
 	for _, status := range []int{BugStatusOpen, BugStatusDup} {
-		err := addCommitsToBugsInStatus(c, status, ns, manager, managers, presentCommits, bugFixedBy)
-		if err != nil {
+		if err := addCommitsToBugsInStatus(c, status, ns, batch); err != nil {
 			return err
 		}
 	}
-	return nil
+	for bugID, commits := range bugFixedBy {
+		if !batch.seenBugIDs[bugID] {
+			// The bug may be already fixed or invalid, this must not affect the rest of the batch.
+			log.Infof(c, "%v: bug %v is not open, skipping fix commits %q", ns, bugID, commits)
+		}
+	}
+	if err := recordFixBatches(c, ns, batchCommits); err != nil {
+		log.Errorf(c, "failed to record fix batches: %v", err)
+	}
+	if err := announceLandedFixes(c, batch.fixedBugs, manager); err != nil {
+		// The bugs are already closed, there's no point in failing the whole request.
+		log.Errorf(c, "failed to announce the fixes: %v", err)
+	}
+	return batch.err
 }
 
-func addCommitsToBugsInStatus(c context.Context, status int, ns, manager string, managers []string,
-	presentCommits map[string]bool, bugFixedBy map[string][]string) error {
+func addCommitsToBugsInStatus(c context.Context, status int, ns string, batch *fixBatch) error {
 	bugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
 		return query.Filter("Namespace=", ns).
 			Filter("Status=", status)
@@ -558,22 +679,20 @@ func addCommitsToBugsInStatus(c context.Context, status int, ns, manager string,
 	for _, bug := range bugs {
 		var fixCommits []string
 		for i := range bug.Reporting {
-			fixCommits = append(fixCommits, bugFixedBy[bug.Reporting[i].ID]...)
+			id := bug.Reporting[i].ID
+			batch.seenBugIDs[id] = true
+			fixCommits = append(fixCommits, batch.bugFixedBy[id]...)
 		}
 		sort.Strings(fixCommits)
-		if err := addCommitsToBug(c, bug, manager, managers, fixCommits, presentCommits); err != nil {
-			return err
-		}
+		batch.addCommitsToBug(c, bug, fixCommits)
 		if bug.Status == BugStatusDup {
 			canon, err := canonicalBug(c, bug)
 			if err != nil {
-				return err
+				batch.fail(c, bug, err)
+				continue
 			}
 			if canon.Status == BugStatusOpen && len(bug.Commits) == 0 {
-				if err := addCommitsToBug(c, canon, manager, managers,
-					fixCommits, presentCommits); err != nil {
-					return err
-				}
+				batch.addCommitsToBug(c, canon, fixCommits)
 			}
 		}
 	}
@@ -581,45 +700,75 @@ func addCommitsToBugsInStatus(c context.Context, status int, ns, manager string,
 }
 
 func addCommitsToBug(c context.Context, bug *Bug, manager string, managers, fixCommits []string,
-	presentCommits map[string]bool) error {
+	presentCommits map[string]bool) (*Bug, error) {
 	if !bugNeedsCommitUpdate(c, bug, manager, fixCommits, presentCommits, true) {
-		return nil
+		return nil, nil
 	}
 	now := timeNow(c)
 	bugKey := bug.key(c)
+	var fixedBug *Bug
 	tx := func(c context.Context) error {
 		bug := new(Bug)
+		fixedBug = nil
 		if err := db.Get(c, bugKey, bug); err != nil {
 			return fmt.Errorf("failed to get bug %v: %v", bugKey.StringID(), err)
 		}
 		if !bugNeedsCommitUpdate(c, bug, manager, fixCommits, presentCommits, false) {
 			return nil
 		}
+		cause := eventCause(causeAPI, "upload_commits")
+		if manager != "" {
+			cause = eventCause(causeAPI, "upload_build")
+		}
 		if len(fixCommits) != 0 && !reflect.DeepEqual(bug.Commits, fixCommits) {
 			bug.updateCommits(fixCommits, now)
+			bug.recordEvent(BugEvent{
+				Type:    BugEventFixAttached,
+				Time:    now,
+				Actor:   BugActorSystem,
+				Cause:   cause,
+				Details: fixCommitsDetails(fixCommits),
+			})
 		}
 		if manager != "" {
 			bug.PatchedOn = append(bug.PatchedOn, manager)
-			if bug.Status == BugStatusOpen {
-				fixed := true
-				for _, mgr := range managers {
-					if !stringInList(bug.PatchedOn, mgr) {
-						fixed = false
-						break
-					}
-				}
-				if fixed {
-					bug.Status = BugStatusFixed
-					bug.Closed = now
-				}
+			bug.PatchedSince = append(bug.PatchedSince, BugPatchedManager{Manager: manager, Time: now})
+			if bug.markFixedIfPatched(managers, now) {
+				bug.recordEvent(BugEvent{
+					Type:    BugEventFixed,
+					Time:    now,
+					Actor:   BugActorSystem,
+					Cause:   cause,
+					Details: "the fix reached " + manager,
+				})
+				fixedBug = bug
 			}
 		}
 		if _, err := db.Put(c, bugKey, bug); err != nil {
 			return fmt.Errorf("failed to put bug: %v", err)
 		}
-		return nil
+		return saveBugEvents(c, bugKey, bug)
 	}
-	return db.RunInTransaction(c, tx, nil)
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return nil, err
+	}
+	invalidateBugLists(c, bug.Namespace)
+	return fixedBug, nil
+}
+
+// markFixedIfPatched closes the open bug if its fix commits have reached all managers
+// (or have settled, see fix_hysteresis.go).
+func (bug *Bug) markFixedIfPatched(managers []string, now time.Time) bool {
+	if bug.Status != BugStatusOpen || bug.FixCommitConflict {
+		return false
+	}
+	if !bug.fixState(managers, now).Fixed {
+		return false
+	}
+	bug.Status = BugStatusFixed
+	bug.Closed = now
+	bug.setAssignee("", now)
+	return true
 }
 
 func bugNeedsCommitUpdate(c context.Context, bug *Bug, manager string, fixCommits []string,
@@ -680,7 +829,7 @@ func apiReportBuildError(c context.Context, ns string, r *http.Request, payload
 	if err := updateManager(c, ns, req.Build.Manager, func(mgr *Manager, stats *ManagerStats) error {
 		log.Infof(c, "failed build on %v: kernel=%v", req.Build.Manager, req.Build.KernelCommit)
 		if req.Build.KernelCommit != "" {
-			mgr.FailedBuildBug = bug.keyHash()
+			mgr.buildFailed(bug.keyHash(), req.Build.KernelCommit, now)
 		} else {
 			mgr.FailedSyzBuildBug = bug.keyHash()
 		}
@@ -724,6 +873,7 @@ func reportCrash(c context.Context, build *Build, req *dashapi.Crash) (*Bug, err
 	if err != nil {
 		return nil, err
 	}
+	recordAssetWrites(c, build.Namespace, req.Assets)
 	req.Title = canonicalizeCrashTitle(req.Title, req.Corrupted, req.Suppressed)
 	if req.Corrupted || req.Suppressed {
 		req.AltTitles = []string{req.Title}
@@ -736,12 +886,50 @@ func reportCrash(c context.Context, build *Build, req *dashapi.Crash) (*Bug, err
 	req.Maintainers = email.MergeEmailLists(req.Maintainers)
 
 	ns := build.Namespace
+	var frames, keywords []string
+	if !req.Corrupted {
+		frames = topFrames(req.Report)
+		keywords = reportKeywords(req.Report)
+	}
+	tainted := report.TaintFlags(req.Report) != ""
+	frameKey := frameDedupKey(ns, req)
 	bug, err := findBugForCrash(c, ns, req.AltTitles)
 	if err != nil {
 		return nil, err
 	}
+	frameAlias := false
+	if bug == nil && frameKey != "" {
+		if bug, err = findBugByFrameKey(c, ns, frameKey); err != nil {
+			return nil, err
+		}
+		if bug != nil {
+			log.Infof(c, "attaching %q to %q by the top frames", req.Title, bug.Title)
+			frameAlias = true
+		}
+	}
+	fixedBuildCrash := false
+	regressionOf := ""
+	if bug == nil {
+		regressed, err := findRegressedBug(c, ns, req.Title, build)
+		if err != nil {
+			return nil, err
+		}
+		if regressed != nil {
+			if regressionConfirmed(regressed, timeNow(c)) {
+				regressionOf = regressed.keyHash()
+			} else {
+				log.Infof(c, "%q crashed on a build with the fix, not reopening yet", regressed.Title)
+				bug = regressed
+				fixedBuildCrash = true
+			}
+		}
+	}
 	if bug == nil {
-		bug, err = createBugForCrash(c, ns, req)
+		dupCandidates, err := findDupCandidates(c, ns, req.Title, frames)
+		if err != nil {
+			return nil, err
+		}
+		bug, err = createBugForCrash(c, ns, req, regressionOf, dupCandidates, frameKey)
 		if err != nil {
 			return nil, err
 		}
@@ -755,15 +943,21 @@ func reportCrash(c context.Context, build *Build, req *dashapi.Crash) (*Bug, err
 	} else if len(req.ReproSyz) != 0 {
 		reproLevel = ReproLevelSyz
 	}
-	save := reproLevel != ReproLevelNone ||
-		bug.NumCrashes < int64(maxCrashes()) ||
+	signature := crashSignature(req.Title, req.Report)
+	suppress := bug.CrashWindow.coalesce(signature, reproLevel != ReproLevelNone, now)
+	save := !suppress && (reproLevel != ReproLevelNone ||
+		bug.NumCrashes < int64(crashRetention(ns).MaxCrashes) ||
 		now.Sub(bug.LastSavedCrash) > time.Hour ||
 		bug.NumCrashes%20 == 0 ||
-		!stringInList(bug.MergedTitles, req.Title)
+		!stringInList(bug.MergedTitles, req.Title))
+	var savedCrash *Crash
+	var savedCrashKey *db.Key
 	if save {
-		if err := saveCrash(c, ns, req, bug, bugKey, build, assets); err != nil {
+		if savedCrash, savedCrashKey, err = saveCrash(c, ns, req, bug, bugKey, build, assets); err != nil {
 			return nil, err
 		}
+	} else if suppress {
+		log.Infof(c, "suppressing a duplicate crash for %q", bug.Title)
 	} else {
 		log.Infof(c, "not saving crash for %q", bug.Title)
 	}
@@ -780,46 +974,125 @@ func reportCrash(c context.Context, build *Build, req *dashapi.Crash) (*Bug, err
 		}
 	}
 
+	relink := false
+	reproImproved := false
 	tx := func(c context.Context) error {
 		bug = new(Bug)
 		if err := db.Get(c, bugKey, bug); err != nil {
 			return fmt.Errorf("failed to get bug: %v", err)
 		}
 		bug.LastTime = now
+		bug.SyzkallerRange.add(build.SyzkallerCommit, build.SyzkallerCommitDate)
+		if fixedBuildCrash || pendingFixInBuild(bug, build) {
+			bug.addFixedBuildCrash(now)
+		}
 		if save {
 			bug.LastSavedCrash = now
 		}
 		if reproLevel != ReproLevelNone {
 			bug.NumRepro++
 			bug.LastReproTime = now
+			bug.LastReproSuccess = now
+			bug.LastReproManager = build.Manager
+			bug.LastReproOutcome = reproOutcomeForLevel(reproLevel)
+			bug.ReproParseError = ""
+			bug.ReproParseFailed = time.Time{}
 		}
+		reproImproved = bug.ReproLevel != ReproLevelNone && bug.ReproLevel < reproLevel
 		if bug.ReproLevel < reproLevel {
 			bug.ReproLevel = reproLevel
+			bug.recordEvent(BugEvent{
+				Type:    BugEventReproFound,
+				Time:    now,
+				Actor:   BugActorSystem,
+				Cause:   eventCause(causeAPI, "report_crash"),
+				Details: fmt.Sprintf("%v on %v", strings.TrimSpace(reproStr(reproLevel)), build.Manager),
+			})
+		}
+		if reproLevel != ReproLevelNone {
+			bug.promoteFromDigest(now, "reproducer")
+		}
+		if save && reproLevel != ReproLevelNone {
+			bug.addRepro(BugRepro{
+				Origin:    ReproOriginSyzbot,
+				Created:   now,
+				CrashID:   savedCrashKey.IntID(),
+				Arch:      build.Arch,
+				Level:     reproLevel,
+				ReproSyz:  savedCrash.ReproSyz,
+				ReproC:    savedCrash.ReproC,
+				ReproOpts: savedCrash.ReproOpts,
+			})
+		}
+		if bug.HeadReproLevel < reproLevel {
+			// The new reproducer was just found, so it does work on a recent kernel.
 			bug.HeadReproLevel = reproLevel
 		}
+		bug.updateReproRevoked()
 		if len(req.Report) != 0 {
 			bug.HasReport = true
 		}
 		if calculateSubsystems {
-			bug.SetAutoSubsystems(newSubsystems, now, getSubsystemRevision(c, ns))
+			bug.SetAutoSubsystems(newSubsystems, now, getSubsystemRevision(c, ns), subsystemCauseCrash)
+		}
+		// Keywords follow the crash that becomes representative, like subsystems do.
+		if len(keywords) != 0 && (calculateSubsystems || len(bug.Keywords) == 0) {
+			bug.Keywords = keywords
 		}
 		bug.increaseCrashStats(now)
+		if tainted {
+			bug.NumTaintedCrashes++
+		}
+		bug.recordFocusCrash(reproLevel, now)
+		if err := recordManagerCrash(c, bugKey, build, now); err != nil {
+			return err
+		}
+		bug.CrashWindow.add(signature, now)
+		if suppress {
+			bug.SuppressedCrashes++
+		}
 		bug.HappenedOn = mergeString(bug.HappenedOn, build.Manager)
 		// Migration of older entities (for new bugs Title is always in MergedTitles).
 		bug.MergedTitles = mergeString(bug.MergedTitles, bug.Title)
 		bug.MergedTitles = mergeString(bug.MergedTitles, req.Title)
+		titles := len(bug.AltTitles)
 		bug.AltTitles = mergeStringList(bug.AltTitles, req.AltTitles)
+		relink = len(bug.TopFrames) != 0 && len(bug.AltTitles) != titles
+		if len(bug.TopFrames) == 0 && len(frames) != 0 {
+			bug.TopFrames = frames
+			relink = true
+		}
+		if bug.FrameKey == "" {
+			bug.FrameKey = frameKey
+		}
+		if frameAlias && req.Title != bug.Title {
+			bug.FrameAliases = mergeString(bug.FrameAliases, req.Title)
+		}
 		if _, err = db.Put(c, bugKey, bug); err != nil {
 			return fmt.Errorf("failed to put bug: %v", err)
 		}
-		return nil
+		return saveBugEvents(c, bugKey, bug)
 	}
-	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{XG: true}); err != nil {
+	if err := db.RunInTransaction(c, countTxRetries("report_crash", tx), &db.TransactionOptions{XG: true}); err != nil {
 		return nil, err
 	}
+	incMetric(c, metricCrashesIngested, ns, 1)
+	if reproLevel != ReproLevelNone {
+		invalidateBugLists(c, ns)
+	}
 	if save {
 		purgeOldCrashes(c, bug, bugKey)
 	}
+	if relink {
+		if err := linkSimilarBugs(c, bug); err != nil {
+			log.Errorf(c, "%q: failed to link similar bugs: %v", bug.Title, err)
+		}
+	}
+	if reproImproved {
+		if err := retryBisections(c, bug, bugKey); err != nil {
+			log.Errorf(c, "%q: failed to retry bisections: %v", bug.Title, err)
+		}
+	}
 	return bug, nil
 }
 
@@ -856,7 +1129,7 @@ func (crash *Crash) UpdateReportingPriority(build *Build, bug *Bug) {
 }
 
 func saveCrash(c context.Context, ns string, req *dashapi.Crash, bug *Bug, bugKey *db.Key,
-	build *Build, assets []Asset) error {
+	build *Build, assets []Asset) (*Crash, *db.Key, error) {
 	crash := &Crash{
 		Title:   req.Title,
 		Manager: build.Manager,
@@ -865,40 +1138,48 @@ func saveCrash(c context.Context, ns string, req *dashapi.Crash, bug *Bug, bugKe
 		Maintainers: email.MergeEmailLists(req.Maintainers,
 			GetEmails(req.Recipients, dashapi.To),
 			GetEmails(req.Recipients, dashapi.Cc)),
-		ReproOpts: req.ReproOpts,
-		Flags:     int64(req.Flags),
-		Assets:    assets,
+		ReproOpts:     req.ReproOpts,
+		Flags:         int64(req.Flags),
+		Assets:        assets,
+		ReproCoverage: encodeReproCoverage(c, req.ReproCoverage),
+		Taint:         report.TaintFlags(req.Report),
 		ReportElements: CrashReportElements{
 			GuiltyFiles: req.GuiltyFiles,
+			Structured:  encodeStructuredReport(c, req.Structured),
 		},
 	}
+	extractSanitizerStacks(&crash.ReportElements, req.Report)
 	var err error
-	if crash.Log, err = putText(c, ns, textCrashLog, req.Log, false); err != nil {
-		return err
+	if crash.Log, crash.LogSize, err = putTextSize(c, ns, textCrashLog, req.Log, false); err != nil {
+		return nil, nil, err
 	}
 	if crash.Report, err = putText(c, ns, textCrashReport, req.Report, false); err != nil {
-		return err
+		return nil, nil, err
 	}
 	if crash.ReproSyz, err = putText(c, ns, textReproSyz, req.ReproSyz, false); err != nil {
-		return err
+		return nil, nil, err
 	}
 	if crash.ReproC, err = putText(c, ns, textReproC, req.ReproC, false); err != nil {
-		return err
+		return nil, nil, err
 	}
-	if crash.MachineInfo, err = putText(c, ns, textMachineInfo, req.MachineInfo, true); err != nil {
-		return err
+	if !crashRetention(ns).DropMachineInfo {
+		if crash.MachineInfo, err = putText(c, ns, textMachineInfo, req.MachineInfo, true); err != nil {
+			return nil, nil, err
+		}
 	}
 	crash.UpdateReportingPriority(build, bug)
-	crashKey := db.NewIncompleteKey(c, "Crash", bugKey)
-	if _, err = db.Put(c, crashKey, crash); err != nil {
-		return fmt.Errorf("failed to put crash: %v", err)
+	crashKey, err := db.Put(c, db.NewIncompleteKey(c, "Crash", bugKey), crash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to put crash: %v", err)
 	}
-	return nil
+	return crash, crashKey, nil
 }
 
 func purgeOldCrashes(c context.Context, bug *Bug, bugKey *db.Key) {
 	const purgeEvery = 10
-	if bug.NumCrashes <= int64(2*maxCrashes()) || (bug.NumCrashes-1)%purgeEvery != 0 {
+	retention := crashRetention(bug.Namespace)
+	purgeCrashes := bug.NumCrashes > int64(2*retention.MaxCrashes)
+	if !purgeCrashes && retention.NoReproLogDays == 0 || (bug.NumCrashes-1)%purgeEvery != 0 {
 		return
 	}
 	var crashes []*Crash
@@ -918,37 +1199,34 @@ func purgeOldCrashes(c context.Context, bug *Bug, bugKey *db.Key) {
 	sort.Slice(crashes, func(i, j int) bool {
 		return crashes[i].Time.After(crashes[j].Time)
 	})
-	var toDelete []*db.Key
+	now := timeNow(c)
+	var toDelete, expiredLogs []*db.Key
 	latestOnManager := make(map[string]bool)
 	uniqueTitle := make(map[string]bool)
 	deleted, reproCount, noreproCount := 0, 0, 0
+	freedLogs := int64(0)
 	for _, crash := range crashes {
 		if !crash.Reported.IsZero() {
 			log.Errorf(c, "purging reported crash?")
 			continue
 		}
-		// Preserve latest crash on each manager.
-		if !latestOnManager[crash.Manager] {
-			latestOnManager[crash.Manager] = true
+		if bug.hasReproCrash(keyMap[crash].IntID()) {
 			continue
 		}
-		// Preserve at least one crash with each title.
-		if !uniqueTitle[crash.Title] {
-			uniqueTitle[crash.Title] = true
+		if !purgeCrashes || retention.keepCrash(crash, latestOnManager, uniqueTitle,
+			&reproCount, &noreproCount) {
+			if retention.noReproLogExpired(crash, now) && len(expiredLogs) < 2*purgeEvery {
+				expiredLogs = append(expiredLogs, keyMap[crash])
+			}
 			continue
 		}
-		// Preserve maxCrashes latest crashes with repro and without repro.
-		count := &noreproCount
-		if crash.ReproSyz != 0 || crash.ReproC != 0 {
-			count = &reproCount
-		}
-		if *count < maxCrashes() {
-			*count++
+		if deleted == 2*purgeEvery {
 			continue
 		}
 		toDelete = append(toDelete, keyMap[crash])
 		if crash.Log != 0 {
 			toDelete = append(toDelete, db.NewKey(c, textCrashLog, "", crash.Log, nil))
+			freedLogs += crash.LogSize
 		}
 		if crash.Report != 0 {
 			toDelete = append(toDelete, db.NewKey(c, textCrashReport, "", crash.Report, nil))
@@ -960,18 +1238,28 @@ func purgeOldCrashes(c context.Context, bug *Bug, bugKey *db.Key) {
 			toDelete = append(toDelete, db.NewKey(c, textReproC, "", crash.ReproC, nil))
 		}
 		deleted++
-		if deleted == 2*purgeEvery {
-			break
+	}
+	if len(toDelete) != 0 {
+		if err := db.DeleteMulti(c, toDelete); err != nil {
+			log.Errorf(c, "failed to delete old crashes: %v", err)
+			return
 		}
+		log.Infof(c, "deleted %v crashes for bug %q", deleted, bug.Title)
 	}
-	if len(toDelete) == 0 {
-		return
+	purgedLogs := 0
+	for _, crashKey := range expiredLogs {
+		freed, err := evictCrashLog(c, crashKey)
+		if err != nil {
+			log.Errorf(c, "failed to delete expired crash log: %v", err)
+			break
+		}
+		freedLogs += freed
+		purgedLogs++
 	}
-	if err := db.DeleteMulti(c, toDelete); err != nil {
-		log.Errorf(c, "failed to delete old crashes: %v", err)
-		return
+	recordStorageFree(c, bug.Namespace, textCrashLog, freedLogs)
+	if err := recordPurgedCrashes(c, bugKey, int64(deleted), int64(purgedLogs)); err != nil {
+		log.Errorf(c, "failed to record purged crashes: %v", err)
 	}
-	log.Infof(c, "deleted %v crashes for bug %q", deleted, bug.Title)
 }
 
 func apiReportFailedRepro(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
@@ -988,6 +1276,12 @@ func apiReportFailedRepro(c context.Context, ns string, r *http.Request, payload
 	if bug == nil {
 		return nil, fmt.Errorf("%v: can't find bug for crash %q", ns, req.Title)
 	}
+	manager := ""
+	if build, err := loadBuild(c, ns, req.BuildID); err == nil {
+		manager = build.Manager
+	} else {
+		log.Errorf(c, "failed to load build for a failed repro: %v", err)
+	}
 	bugKey := bug.key(c)
 	now := timeNow(c)
 	tx := func(c context.Context) error {
@@ -997,6 +1291,8 @@ func apiReportFailedRepro(c context.Context, ns string, r *http.Request, payload
 		}
 		bug.NumRepro++
 		bug.LastReproTime = now
+		bug.LastReproManager = manager
+		bug.LastReproOutcome = ReproOutcomeFailed
 		if _, err := db.Put(c, bugKey, bug); err != nil {
 			return fmt.Errorf("failed to put bug: %v", err)
 		}
@@ -1089,7 +1385,17 @@ func apiManagerStats(c context.Context, ns string, r *http.Request, payload []by
 		stats.TotalExecs += int64(req.Execs)
 		return nil
 	})
-	return nil, err
+	if err != nil {
+		return nil, err
+	}
+	resp := new(dashapi.ManagerStatsResp)
+	if config.Namespaces[ns].Focus != nil {
+		// The stats are already saved, an error would make the manager upload them again.
+		if resp.Focus, err = managerFocusPrograms(c, ns); err != nil {
+			log.Errorf(c, "failed to load focus programs for %v: %v", req.Name, err)
+		}
+	}
+	return resp, nil
 }
 
 func apiBugList(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
@@ -1153,6 +1459,105 @@ func apiLoadBug(c context.Context, ns string, r *http.Request, payload []byte) (
 	return loadBugReport(c, bug)
 }
 
+const bisectionsPerPage = 100
+
+// apiLoadBisections returns the finished bisections of the namespace for external dashboards.
+// Only the bisections of the bugs visible to users are returned.
+func apiLoadBisections(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	req := new(dashapi.LoadBisectionsReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %v", err)
+	}
+	if req.Namespace != ns {
+		return nil, fmt.Errorf("the client does not belong to namespace %q", req.Namespace)
+	}
+	if config.Namespaces[ns].AccessLevel > AccessUser {
+		return nil, ErrAccess
+	}
+	query := db.NewQuery("Job").
+		Filter("Namespace=", ns).
+		Filter("Finished>", req.Since).
+		Order("Finished").
+		Order("__key__")
+	if req.Cursor != "" {
+		start, err := db.DecodeCursor(req.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("bad cursor: %v", err)
+		}
+		query = query.Start(start)
+	}
+	resp := new(dashapi.LoadBisectionsResp)
+	bugs := map[string]*Bug{}
+	iter := query.Run(c)
+	// The page is limited by the number of scanned jobs, so it may contain fewer bisections.
+	for i := 0; i < bisectionsPerPage; i++ {
+		job := new(Job)
+		jobKey, err := iter.Next(job)
+		if err == db.Done {
+			return resp, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to query jobs: %v", err)
+		}
+		if job.Type != JobBisectCause && job.Type != JobBisectFix || job.Error != 0 {
+			continue
+		}
+		bugKey := jobKey.Parent()
+		bug := bugs[bugKey.StringID()]
+		if bug == nil {
+			bug = new(Bug)
+			if err := db.Get(c, bugKey, bug); err != nil {
+				return nil, fmt.Errorf("failed to get bug: %v", err)
+			}
+			bugs[bugKey.StringID()] = bug
+		}
+		if bug.sanitizeAccess(AccessUser) > AccessUser {
+			continue
+		}
+		result, err := makeBisectionResult(c, job, bug, bugKey)
+		if err != nil {
+			return nil, err
+		}
+		resp.Bisections = append(resp.Bisections, result)
+	}
+	next, err := iter.Cursor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor: %v", err)
+	}
+	if _, err := iter.Next(new(Job)); err == db.Done {
+		return resp, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %v", err)
+	}
+	resp.Cursor = next.String()
+	return resp, nil
+}
+
+func makeBisectionResult(c context.Context, job *Job, bug *Bug, bugKey *db.Key) (
+	*dashapi.BisectionResult, error) {
+	crash := new(Crash)
+	if err := db.Get(c, db.NewKey(c, "Crash", "", job.CrashID, bugKey), crash); err != nil {
+		return nil, fmt.Errorf("failed to get crash: %v", err)
+	}
+	ret := &dashapi.BisectionResult{
+		BugID:           bugKey.StringID(),
+		BugTitle:        bug.displayTitle(),
+		Type:            job.Type.toDashapiReportType(),
+		Flags:           dashapi.JobDoneFlags(job.Flags),
+		CrashReportLink: externalLink(c, textCrashReport, crash.Report),
+		Finished:        job.Finished,
+	}
+	for _, com := range job.Commits {
+		ret.Commits = append(ret.Commits, dashapi.Commit{
+			Hash:       com.Hash,
+			Title:      com.Title,
+			Author:     com.Author,
+			AuthorName: com.AuthorName,
+			Date:       com.Date,
+		})
+	}
+	return ret, nil
+}
+
 func apiLoadFullBug(c context.Context, r *http.Request, payload []byte) (interface{}, error) {
 	req := new(dashapi.LoadFullBugReq)
 	if err := json.Unmarshal(payload, req); err != nil {
@@ -1200,6 +1605,7 @@ func apiAddBuildAssets(c context.Context, ns string, r *http.Request, payload []
 	if err != nil {
 		return nil, err
 	}
+	recordAssetWrites(c, ns, req.Assets)
 	return nil, nil
 }
 
@@ -1212,10 +1618,14 @@ func parseIncomingAsset(c context.Context, newAsset dashapi.NewAsset) (Asset, er
 	if err != nil {
 		return Asset{}, fmt.Errorf("invalid URL: %w", err)
 	}
+	if typeInfo.MaxSize != 0 && newAsset.Size > typeInfo.MaxSize {
+		return Asset{}, fmt.Errorf("%v asset is too big: %v > %v", newAsset.Type, newAsset.Size, typeInfo.MaxSize)
+	}
 	return Asset{
 		Type:        newAsset.Type,
 		DownloadURL: newAsset.DownloadURL,
 		CreateDate:  timeNow(c),
+		Size:        newAsset.Size,
 	}, nil
 }
 
@@ -1331,11 +1741,18 @@ func findBugForCrash(c context.Context, ns string, titles []string) (*Bug, error
 	return best, nil
 }
 
-func createBugForCrash(c context.Context, ns string, req *dashapi.Crash) (*Bug, error) {
+func createBugForCrash(c context.Context, ns string, req *dashapi.Crash, regressionOf string,
+	dupCandidates []string, frameKey string) (*Bug, error) {
+	firstSeq, err := renamedBugSeq(c, ns, req.Title)
+	if err != nil {
+		return nil, err
+	}
 	var bug *Bug
+	created := false
 	now := timeNow(c)
 	tx := func(c context.Context) error {
-		for seq := int64(0); ; seq++ {
+		created = false
+		for seq := firstSeq; ; seq++ {
 			bug = new(Bug)
 			bugHash := bugKeyHash(ns, req.Title, seq)
 			bugKey := db.NewKey(c, "Bug", bugHash, 0, nil)
@@ -1349,6 +1766,9 @@ func createBugForCrash(c context.Context, ns string, req *dashapi.Crash) (*Bug,
 					Title:          req.Title,
 					MergedTitles:   []string{req.Title},
 					AltTitles:      req.AltTitles,
+					RegressionOf:   regressionOf,
+					DupCandidates:  dupCandidates,
+					FrameKey:       frameKey,
 					Status:         BugStatusOpen,
 					NumCrashes:     0,
 					NumRepro:       0,
@@ -1358,6 +1778,7 @@ func createBugForCrash(c context.Context, ns string, req *dashapi.Crash) (*Bug,
 					LastTime:       now,
 					SubsystemsTime: now,
 				}
+				bug.classifyLowSeverity(config.Namespaces[ns].LowSeverity, len(req.ReproSyz) != 0)
 				err = bug.updateReportings(config.Namespaces[ns], now)
 				if err != nil {
 					return err
@@ -1365,6 +1786,7 @@ func createBugForCrash(c context.Context, ns string, req *dashapi.Crash) (*Bug,
 				if _, err = db.Put(c, bugKey, bug); err != nil {
 					return fmt.Errorf("failed to put new bug: %v", err)
 				}
+				created = true
 				return nil
 			}
 			canon, err := canonicalBug(c, bug)
@@ -1383,6 +1805,10 @@ func createBugForCrash(c context.Context, ns string, req *dashapi.Crash) (*Bug,
 	}); err != nil {
 		return nil, err
 	}
+	if created {
+		forgetReportingIDs(c, bug)
+		invalidateBugLists(c, ns)
+	}
 	return bug, nil
 }
 
@@ -1428,6 +1854,18 @@ func needReproForBug(c context.Context, bug *Bug) bool {
 	if syzErrorTitleRe.MatchString(bug.Title) {
 		bestReproLevel = ReproLevelSyz
 	}
+	if bug.needsReproRegeneration() {
+		// The reproducer does not parse with the current descriptions, see repro_migration.go.
+		return timeSince(c, bug.LastReproTime) >= reproRequestedRetryPeriod
+	}
+	if bug.noReproSinceLastRepro() {
+		// Developers could not reproduce the bug, a fresh reproducer may help them.
+		return timeSince(c, bug.LastReproTime) >= reproRequestedRetryPeriod
+	}
+	if bug.NeedsRepro && bug.ReproLevel == ReproLevelNone {
+		// Somebody is waiting for it, ignore the limit on the number of attempts.
+		return timeSince(c, bug.LastReproTime) >= reproRequestedRetryPeriod
+	}
 	if bug.HeadReproLevel < bestReproLevel {
 		// We have not found a best-level repro yet, try until we do.
 		return bug.NumRepro < maxReproPerBug || timeSince(c, bug.LastReproTime) >= reproRetryPeriod
@@ -1437,11 +1875,17 @@ func needReproForBug(c context.Context, bug *Bug) bool {
 }
 
 func putText(c context.Context, ns, tag string, data []byte, dedup bool) (int64, error) {
+	id, _, err := putTextSize(c, ns, tag, data, dedup)
+	return id, err
+}
+
+// putTextSize is like putText, but also returns the size of the stored (compressed) text.
+func putTextSize(c context.Context, ns, tag string, data []byte, dedup bool) (int64, int64, error) {
 	if ns == "" {
-		return 0, fmt.Errorf("putting text outside of namespace")
+		return 0, 0, fmt.Errorf("putting text outside of namespace")
 	}
 	if len(data) == 0 {
-		return 0, nil
+		return 0, 0, nil
 	}
 	const (
 		// Kernel crash log is capped at ~1MB, but vm.Diagnose can add more.
@@ -1476,28 +1920,45 @@ func putText(c context.Context, ns, tag string, data []byte, dedup bool) (int64,
 	}
 	key, err := db.Put(c, key, text)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	return key.IntID(), nil
+	size := int64(len(text.Text))
+	recordStorageWrite(c, ns, tag, size)
+	return key.IntID(), size, nil
 }
 
 func getText(c context.Context, tag string, id int64) ([]byte, string, error) {
+	data, ns, _, err := getTextPrefix(c, tag, id, 0)
+	return data, ns, err
+}
+
+// getTextPrefix is like getText, but decompresses at most limit bytes of the text (0 means no limit).
+// The returned bool is set if the text was longer than the limit.
+func getTextPrefix(c context.Context, tag string, id int64, limit int64) ([]byte, string, bool, error) {
 	if id == 0 {
-		return nil, "", nil
+		return nil, "", false, nil
 	}
 	text := new(Text)
 	if err := db.Get(c, db.NewKey(c, tag, "", id, nil), text); err != nil {
-		return nil, "", fmt.Errorf("failed to read text %v: %v", tag, err)
+		return nil, "", false, fmt.Errorf("failed to read text %v: %v", tag, err)
 	}
 	d, err := gzip.NewReader(bytes.NewBuffer(text.Text))
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read text %v: %v", tag, err)
+		return nil, "", false, fmt.Errorf("failed to read text %v: %v", tag, err)
+	}
+	var r io.Reader = d
+	if limit > 0 {
+		r = io.LimitReader(d, limit+1)
 	}
-	data, err := io.ReadAll(d)
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read text %v: %v", tag, err)
+		return nil, "", false, fmt.Errorf("failed to read text %v: %v", tag, err)
 	}
-	return data, text.Namespace, nil
+	truncated := limit > 0 && int64(len(data)) > limit
+	if truncated {
+		data = data[:limit]
+	}
+	return data, text.Namespace, truncated, nil
 }
 
 // limitLength essentially does return s[:max],
@@ -1597,5 +2058,19 @@ func apiSaveDiscussion(c context.Context, r *http.Request, payload []byte) (inte
 	if len(d.BugIDs) == 0 {
 		return nil, nil
 	}
-	return nil, mergeDiscussion(c, d)
+	return nil, mergeDiscussionWithQuota(c, "", d)
+}
+
+func apiReportDiscussion(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	d := new(dashapi.Discussion)
+	if err := json.Unmarshal(payload, d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %v", err)
+	}
+	if len(d.BugIDs) == 0 {
+		return nil, fmt.Errorf("no bug IDs")
+	}
+	if err := validateDiscussion(d); err != nil {
+		return nil, err
+	}
+	return nil, mergeDiscussionWithQuota(c, ns, d)
 }
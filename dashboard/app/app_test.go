@@ -34,6 +34,7 @@ func init() {
 	obsoleteWhatWontBeFixBisected = true
 	notifyAboutUnsuccessfulBisections = true
 	initMocks()
+	discussionSources[testDiscussionSource] = testDiscussionSourceImpl{}
 	installConfig(testConfig)
 }
 
@@ -47,6 +48,9 @@ var testConfig = &GlobalConfig{
 	EmailBlocklist: []string{
 		"\"Bar\" <Blocked@Domain.com>",
 	},
+	DoNotContact: []string{
+		"Private <Private@kernel.org>",
+	},
 	Obsoleting: ObsoletingConfig{
 		MinPeriod:         80 * 24 * time.Hour,
 		MaxPeriod:         100 * 24 * time.Hour,
@@ -56,6 +60,21 @@ var testConfig = &GlobalConfig{
 	},
 	DiscussionEmails: []DiscussionEmailConfig{
 		{"lore@email.com", dashapi.DiscussionLore},
+		{"test-source@email.com", testDiscussionSource},
+	},
+	DiscussionQuotas: map[dashapi.DiscussionSource]int{
+		testDiscussionSource: testDiscussionQuota,
+	},
+	DiscussionCheck: DiscussionCheckConfig{
+		SampleSize:        10,
+		AutoHealThreshold: 3,
+	},
+	EmailLoop: EmailLoopConfig{
+		Threshold:   5,
+		AlertEmails: []string{"admins@syzkaller.com"},
+	},
+	CorpusTransfer: &CorpusTransferConfig{
+		Bucket: "syzkaller-corpus",
 	},
 	DefaultNamespace: "test1",
 	Namespaces: map[string]*Config{
@@ -64,10 +83,14 @@ var testConfig = &GlobalConfig{
 			Key:                   "test1keytest1keytest1key",
 			FixBisectionAutoClose: true,
 			SimilarityDomain:      testDomain,
+			ShareLinks: &ShareLinkConfig{
+				Secret: "sharesecretsharesecret",
+			},
 			Clients: map[string]string{
 				client1: password1,
 				"oauth": auth.OauthMagic + "111111122222222",
 			},
+			BulkUpdateClients: []string{client1},
 			Repos: []KernelRepo{
 				{
 					URL:    "git://syzkaller.org",
@@ -119,6 +142,28 @@ var testConfig = &GlobalConfig{
 			Subsystems: SubsystemsConfig{
 				Service: subsystem.MustMakeService(testSubsystems),
 			},
+			ExternalAssetRetention: 60 * 24 * time.Hour,
+			CrashRateAlerts: &CrashRateAlertConfig{
+				Emails: []string{"crash-rate-alerts@test.com"},
+			},
+			ModerationSLA: &ModerationSLAConfig{
+				Emails: []string{"moderators@test.com"},
+			},
+			TrackReleases: true,
+			Backports: &BackportConfig{
+				Branches: []BackportBranch{
+					{
+						URL:    "git://syzkaller.org/stable.git",
+						Branch: "linux-6.1.y",
+						Alias:  "6.1",
+					},
+					{
+						URL:    "git://syzkaller.org/stable.git",
+						Branch: "linux-5.15.y",
+						Alias:  "5.15",
+					},
+				},
+			},
 		},
 		"test2": {
 			AccessLevel:      AccessAdmin,
@@ -167,6 +212,10 @@ var testConfig = &GlobalConfig{
 					Filter:     skipWithRepro,
 					Config: &EmailConfig{
 						Email: "test@syzkaller.com",
+						SubsystemLists: map[string][]string{
+							"net":      {"net-reports@list.com"},
+							"wireless": {"wireless-reports@list.com", "net-reports@list.com"},
+						},
 					},
 				},
 				{
@@ -194,8 +243,9 @@ var testConfig = &GlobalConfig{
 		},
 		// Namespaces for access level testing.
 		"access-admin": {
-			AccessLevel: AccessAdmin,
-			Key:         "adminkeyadminkeyadminkey",
+			AccessLevel:  AccessAdmin,
+			Key:          "adminkeyadminkeyadminkey",
+			StorageQuota: 3000,
 			Clients: map[string]string{
 				clientAdmin: keyAdmin,
 			},
@@ -274,11 +324,31 @@ var testConfig = &GlobalConfig{
 			},
 		},
 		"access-public-email": {
-			AccessLevel: AccessPublic,
-			Key:         "publickeypublickeypublickey",
+			AccessLevel:      AccessPublic,
+			Key:              "publickeypublickeypublickey",
+			SimilarityDomain: publicEmailDomain,
 			Clients: map[string]string{
 				clientPublicEmail: keyPublicEmail,
 			},
+			ReplyToReproRequests: true,
+			AnnounceLandedFixes:  true,
+			AutoPatchTesting:     true,
+			Focus: &FocusConfig{
+				MaxBugs: 1,
+			},
+			ConfigMinimization: &ConfigMinimizationConfig{
+				MaxPending: 1,
+			},
+			FrameDedup: &FrameDedupConfig{
+				CrashTypes: []string{"KASAN: ", "WARNING in "},
+			},
+			VMCoreAccessLevel: AccessUser,
+			Patchwork: []PatchworkConfig{
+				{
+					URL:     "https://patchwork.test.org",
+					Project: "test",
+				},
+			},
 			Managers: map[string]ConfigManager{
 				restrictedManager: {
 					RestrictedTestingRepo:   "git://restricted.git/restricted.git",
@@ -334,6 +404,33 @@ var testConfig = &GlobalConfig{
 				},
 			},
 		},
+		// The namespace that tracks downstream copies of access-public-email bugs.
+		"downstream": {
+			AccessLevel:       AccessPublic,
+			Key:               "downstreamkeydownstreamkeydownstreamkey",
+			SimilarityDomain:  publicEmailDomain,
+			UpstreamNamespace: "access-public-email",
+			Clients: map[string]string{
+				clientDownstream: keyDownstream,
+			},
+			Repos: []KernelRepo{
+				{
+					URL:    "git://syzkaller.org/downstream.git",
+					Branch: "downstream",
+					Alias:  "downstream",
+				},
+			},
+			Reporting: []Reporting{
+				{
+					AccessLevel: AccessPublic,
+					Name:        "downstream-reporting1",
+					DailyLimit:  1000,
+					Config: &EmailConfig{
+						Email: "downstream@syzkaller.com",
+					},
+				},
+			},
+		},
 		"fs-bugs-reporting": {
 			AccessLevel: AccessPublic,
 			Key:         "fspublickeypublickeypublickey",
@@ -452,6 +549,34 @@ var testConfig = &GlobalConfig{
 			},
 			RetestRepros: true,
 		},
+		"crash-retention": {
+			AccessLevel: AccessAdmin,
+			Key:         "crashretentioncrashretention",
+			Clients: map[string]string{
+				clientCrashRetention: keyCrashRetention,
+			},
+			Repos: []KernelRepo{
+				{
+					URL:    "git://syzkaller.org",
+					Branch: "branch10",
+					Alias:  "repo10alias",
+				},
+			},
+			Reporting: []Reporting{
+				{
+					Name:       "reporting1",
+					DailyLimit: 1000,
+					Config: &TestConfig{
+						Index: 1,
+					},
+				},
+			},
+			CrashRetention: &CrashRetentionConfig{
+				MaxCrashes:      5,
+				NoReproLogDays:  7,
+				DropMachineInfo: true,
+			},
+		},
 		"subsystem-reminders": {
 			AccessLevel: AccessPublic,
 			Key:         "subsystemreminderssubsystemreminders",
@@ -507,6 +632,16 @@ var testConfig = &GlobalConfig{
 					},
 				},
 			},
+			Digests: &DigestConfig{
+				Secret: "digestsecretdigestsecret",
+			},
+			LowSeverity: &LowSeverityConfig{
+				Rules: []LowSeverityRule{
+					{Name: "task-hung", Title: "^INFO: task hung"},
+				},
+				Mailto:         []string{"low-severity@syzkaller.com"},
+				SubsystemLists: true,
+			},
 		},
 	},
 }
@@ -541,6 +676,8 @@ const (
 	keyPublicEmail        = "clientpublicemailkeyclientpublicemailkey"
 	clientPublicEmail2    = "client-public-email2"
 	keyPublicEmail2       = "clientpublicemailkeyclientpublicemailkey2"
+	clientDownstream      = "client-downstream"
+	keyDownstream         = "clientdownstreamkeyclientdownstreamkey"
 	clientPublicFs        = "client-public-fs"
 	keyPublicFs           = "keypublicfskeypublicfskeypublicfs"
 	clientTestDecomm      = "client-test-decomm"
@@ -549,6 +686,8 @@ const (
 	keyMgrDecommission    = "keyMgrDecommissionkeyMgrDecommission"
 	clientSubsystemRemind = "client-subystem-reminders"
 	keySubsystemRemind    = "keySubsystemRemindkeySubsystemRemind"
+	clientCrashRetention  = "client-crash-retention"
+	keyCrashRetention     = "keyCrashRetentionkeyCrashRetention"
 
 	restrictedManager     = "restricted-manager"
 	noFixBisectionManager = "no-fix-bisection-manager"
@@ -556,7 +695,8 @@ const (
 	notYetDecommManger    = "not-yet-decomm-manager"
 	delegateToManager     = "delegate-to-manager"
 
-	testDomain = "test"
+	testDomain        = "test"
+	publicEmailDomain = "public-email"
 )
 
 func skipWithRepro(bug *Bug) FilterResult {
@@ -18,6 +18,7 @@ import (
 	"google.golang.org/appengine/v2"
 	db "google.golang.org/appengine/v2/datastore"
 	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
 )
 
 // TODO: decide if we want to save job-related assets.
@@ -146,6 +147,10 @@ func handleDeprecateAssets(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Errorf(c, "deprecateCrashAssets failed: %v", err)
 	}
+	checkStorageQuotas(c)
+	if err := deleteOldEmailAttachments(c); err != nil {
+		log.Errorf(c, "deleteOldEmailAttachments failed: %v", err)
+	}
 }
 
 func deprecateCrashAssets(c context.Context) error {
@@ -407,7 +412,7 @@ func (ad *crashAssetDeprecator) batchProcessCrashes(count int) error {
 	for i, crash := range crashes {
 		toDelete := []string{}
 		for _, asset := range crash.Assets {
-			needed, err := ad.needThisCrashAsset(crashKeys[i], &asset)
+			needed, err := ad.needThisCrashAsset(crashKeys[i], crash, &asset)
 			if err != nil {
 				return fmt.Errorf("failed to test crash asset: %w", err)
 			} else if !needed {
@@ -428,24 +433,107 @@ func (ad *crashAssetDeprecator) batchProcessCrashes(count int) error {
 	return nil
 }
 
-func (ad *crashAssetDeprecator) needThisCrashAsset(crashKey *db.Key, crashAsset *Asset) (bool, error) {
-	if crashAsset.Type == dashapi.MountInRepro {
-		// We keed mount images from reproducers for as long as the bug is still relevant.
+func (ad *crashAssetDeprecator) needThisCrashAsset(crashKey *db.Key, crash *Crash,
+	crashAsset *Asset) (bool, error) {
+	switch crashAsset.Type {
+	case dashapi.MountInRepro, dashapi.ReproCoverage, dashapi.MinimizedConfig:
+		// We keep mount images, coverage and minimized configs of reproducers for as long
+		// as the bug is still relevant.
 		// They're not that big to set stricter limits.
-		return ad.bugStatusPolicy(crashKey, crashAsset)
+		return ad.bugStatusPolicy(crashKey, crash)
+	case dashapi.VMCoreExcerpt:
+		// Crash dumps are big and sensitive, so they are kept for a limited time in any case.
+		if !timeNow(ad.c).Before(vmcoreExpiry(crashAsset)) {
+			return false, nil
+		}
+		return ad.bugStatusPolicy(crashKey, crash)
 	}
 	return false, fmt.Errorf("no deprecation policy for %s", crashAsset.Type)
 }
 
-func (ad *crashAssetDeprecator) bugStatusPolicy(crashKey *db.Key, crashAsset *Asset) (bool, error) {
+func (ad *crashAssetDeprecator) bugStatusPolicy(crashKey *db.Key, crash *Crash) (bool, error) {
 	bugKey := crashKey.Parent()
 	bug := new(Bug)
 	err := db.Get(ad.c, bugKey, bug)
 	if err != nil {
 		return false, fmt.Errorf("failed to query bug: %s", err)
 	}
-	return bug.Status == BugStatusOpen ||
-		bug.Closed.After(timeNow(ad.c).Add(-keepAssetsForClosedBugs)), nil
+	extension := config.Namespaces[bug.Namespace].ExternalAssetRetention
+	return keepCrashAssets(bug, crash, timeNow(ad.c), extension), nil
+}
+
+// keepCrashAssets decides whether the assets of the crash are still needed.
+// While the bug is open, they are always kept. After it's closed, they are kept for
+// keepAssetsForClosedBugs, which is extended for bugs that external trackers refer to
+// and for crashes whose logs and reproducers were recently downloaded.
+func keepCrashAssets(bug *Bug, crash *Crash, now time.Time, extension time.Duration) bool {
+	if bug.Status == BugStatusOpen {
+		return true
+	}
+	keepUntil := bug.Closed.Add(keepAssetsForClosedBugs)
+	if extension == 0 {
+		return now.Before(keepUntil)
+	}
+	if bug.hasExternalLink() {
+		keepUntil = keepUntil.Add(extension)
+	}
+	if accessedUntil := crash.LastAccess.Add(extension); !crash.LastAccess.IsZero() &&
+		accessedUntil.After(keepUntil) {
+		keepUntil = accessedUntil
+	}
+	return now.Before(keepUntil)
+}
+
+const (
+	// Crash accesses are counted in memcache and are written to the crash entity only
+	// on the first access in a period and then once per crashAccessBatch accesses,
+	// so that often downloaded crashes don't cause a datastore write per download.
+	crashAccessBatch  = 10
+	crashAccessPeriod = 24 * time.Hour
+)
+
+// recordCrashAccess is called when the crash log or reproducer is downloaded.
+func recordCrashAccess(c context.Context, crashKey *db.Key) {
+	key := "crash-access-" + crashKey.Encode()
+	count, err := memcache.IncrementExisting(c, key, 1)
+	if err == memcache.ErrCacheMiss {
+		err = memcache.Add(c, &memcache.Item{
+			Key:        key,
+			Value:      []byte("1"),
+			Expiration: crashAccessPeriod,
+		})
+		if err == memcache.ErrNotStored {
+			// There was a concurrent access, it will take care of the write.
+			return
+		}
+		count = 1
+	}
+	if err != nil {
+		log.Errorf(c, "failed to count crash access: %v", err)
+		return
+	}
+	if count%crashAccessBatch != 1 || isReadOnly(c) {
+		return
+	}
+	delta := int64(crashAccessBatch)
+	if count == 1 {
+		delta = 1
+	}
+	tx := func(c context.Context) error {
+		crash := new(Crash)
+		if err := db.Get(c, crashKey, crash); err != nil {
+			return fmt.Errorf("failed to get crash: %w", err)
+		}
+		crash.NumAccesses += delta
+		crash.LastAccess = timeNow(c)
+		if _, err := db.Put(c, crashKey, crash); err != nil {
+			return fmt.Errorf("failed to put crash: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		log.Errorf(c, "failed to record crash access: %v", err)
+	}
 }
 
 func (ad *crashAssetDeprecator) updateCrash(crashKey *db.Key, urlsToDelete []string) error {
@@ -6,6 +6,7 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -414,3 +415,202 @@ https://goo.gl/tpsmEJ#status for how to communicate with syzbot.`,
 	c.expectOK(err)
 	c.expectEQ(needed.DownloadURLs, []string{})
 }
+
+func TestKeepCrashAssets(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	const day = 24 * time.Hour
+	const extension = 60 * day
+	linked := []BugReporting{{Name: "reporting1", Link: "https://tracker.org/1"}}
+	unlinked := []BugReporting{{Name: "reporting1"}}
+	dummyLinked := []BugReporting{{Name: "reporting1", Link: "https://tracker.org/1", Dummy: true}}
+	tests := []struct {
+		name       string
+		status     int
+		closed     time.Duration // how long ago
+		reporting  []BugReporting
+		lastAccess time.Duration // how long ago, 0 means never
+		extension  time.Duration
+		keep       bool
+	}{
+		{"open", BugStatusOpen, 0, unlinked, 0, extension, true},
+		{"open old", BugStatusOpen, 365 * day, unlinked, 0, 0, true},
+		{"recently closed", BugStatusInvalid, 10 * day, unlinked, 0, extension, true},
+		{"closed", BugStatusFixed, 40 * day, unlinked, 0, extension, false},
+		{"closed linked", BugStatusFixed, 40 * day, linked, 0, extension, true},
+		{"closed linked no extension", BugStatusFixed, 40 * day, linked, 0, 0, false},
+		{"closed linked dummy", BugStatusFixed, 40 * day, dummyLinked, 0, extension, false},
+		{"closed linked long ago", BugStatusInvalid, 100 * day, linked, 0, extension, false},
+		{"closed accessed", BugStatusFixed, 100 * day, unlinked, 20 * day, extension, true},
+		{"closed accessed no extension", BugStatusFixed, 100 * day, unlinked, 20 * day, 0, false},
+		{"closed accessed long ago", BugStatusFixed, 100 * day, unlinked, 70 * day, extension, false},
+		{"closed linked accessed", BugStatusInvalid, 200 * day, linked, 59 * day, extension, true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			bug := &Bug{
+				Status:    test.status,
+				Reporting: test.reporting,
+			}
+			if test.status != BugStatusOpen {
+				bug.Closed = now.Add(-test.closed)
+			}
+			crash := &Crash{}
+			if test.lastAccess != 0 {
+				crash.LastAccess = now.Add(-test.lastAccess)
+			}
+			if got := keepCrashAssets(bug, crash, now, test.extension); got != test.keep {
+				t.Fatalf("got %v, want %v", got, test.keep)
+			}
+		})
+	}
+}
+
+func TestCrashAssetExternalRetention(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.Assets = []dashapi.NewAsset{
+		{
+			Type:        dashapi.MountInRepro,
+			DownloadURL: "http://google.com/disk_image",
+		},
+	}
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+	reply, _ := c.client.ReportingUpdate(&dashapi.BugUpdate{
+		ID:     rep.ID,
+		Status: dashapi.BugStatusOpen,
+		Link:   "https://tracker.org/bug/1",
+	})
+	c.expectTrue(reply.OK)
+	c.client.updateBug(rep.ID, dashapi.BugStatusInvalid, "")
+
+	// The usual retention period for closed bugs is over, but the bug is linked.
+	c.advanceTime(keepAssetsForClosedBugs + 24*time.Hour)
+	_, err := c.GET("/cron/deprecate_assets")
+	c.expectOK(err)
+	needed, err := c.client.NeededAssetsList()
+	c.expectOK(err)
+	c.expectEQ(needed.DownloadURLs, []string{"http://google.com/disk_image"})
+
+	// The extension is over as well.
+	c.advanceTime(config.Namespaces["test1"].ExternalAssetRetention)
+	_, err = c.GET("/cron/deprecate_assets")
+	c.expectOK(err)
+	needed, err = c.client.NeededAssetsList()
+	c.expectOK(err)
+	c.expectEQ(needed.DownloadURLs, []string{})
+}
+
+func TestCrashAccessCounter(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+	_, dbCrash, _ := c.loadBug(rep.ID)
+	logLink := externalLink(c.ctx, textCrashLog, dbCrash.Log)
+	c.expectEQ(dbCrash.NumAccesses, int64(0))
+
+	download := func(times int) {
+		for i := 0; i < times; i++ {
+			c.checkURLContents(logLink, crash.Log)
+		}
+	}
+	// The first download is recorded immediately.
+	download(1)
+	_, dbCrash, _ = c.loadBug(rep.ID)
+	c.expectEQ(dbCrash.NumAccesses, int64(1))
+	c.expectEQ(dbCrash.LastAccess, c.mockedTime)
+
+	// The next ones are written in batches.
+	accessTime := c.mockedTime
+	c.advanceTime(time.Hour)
+	download(crashAccessBatch - 1)
+	_, dbCrash, _ = c.loadBug(rep.ID)
+	c.expectEQ(dbCrash.NumAccesses, int64(1))
+	c.expectEQ(dbCrash.LastAccess, accessTime)
+	download(1)
+	_, dbCrash, _ = c.loadBug(rep.ID)
+	c.expectEQ(dbCrash.NumAccesses, int64(1+crashAccessBatch))
+	c.expectEQ(dbCrash.LastAccess, c.mockedTime)
+}
+
+func TestVMCoreAssets(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client2.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.Assets = []dashapi.NewAsset{
+		{
+			Type:        dashapi.VMCoreExcerpt,
+			DownloadURL: "http://google.com/vmcore",
+			Size:        3 << 20,
+		},
+		{
+			Type:        dashapi.MountInRepro,
+			DownloadURL: "http://google.com/disk_image",
+		},
+	}
+	c.client2.ReportCrash(crash)
+
+	// The dumps are never reported.
+	msg := c.pollEmailBug()
+	c.expectTrue(!strings.Contains(msg.Body, "vmcore"))
+	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+
+	// And are only shown to admins by default.
+	c.expectEQ(config.Namespaces["test2"].VMCoreAccessLevel, AccessAdmin)
+	page, err := c.AuthGET(AccessUser, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), "http://google.com/vmcore"))
+	page, err = c.AuthGET(AccessAdmin, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "http://google.com/vmcore"))
+	c.expectTrue(strings.Contains(string(page), "vmcore excerpt</a> (3.0 MiB, kept until 2000/01/15)"))
+
+	// The size is capped.
+	tooBig := testCrash(build, 2)
+	tooBig.Assets = []dashapi.NewAsset{{
+		Type:        dashapi.VMCoreExcerpt,
+		DownloadURL: "http://google.com/vmcore2",
+		Size:        1 << 30,
+	}}
+	_, err = c.makeClient(client2, password2, false).ReportCrash(tooBig)
+	c.expectTrue(err != nil && strings.Contains(err.Error(), "too big"))
+
+	// The namespace may make the dumps visible to users.
+	c.publicClient.UploadBuild(build)
+	publicCrash := testCrash(build, 3)
+	publicCrash.Assets = []dashapi.NewAsset{{
+		Type:        dashapi.VMCoreExcerpt,
+		DownloadURL: "http://google.com/vmcore3",
+	}}
+	c.publicClient.ReportCrash(publicCrash)
+	_, publicExtID, err := email.RemoveAddrContext(c.pollEmailBug().Sender)
+	c.expectOK(err)
+	page, err = c.AuthGET(AccessUser, "/bug?extid="+publicExtID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "http://google.com/vmcore3"))
+	page, err = c.AuthGET(AccessPublic, "/bug?extid="+publicExtID)
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), "http://google.com/vmcore3"))
+
+	// The dumps expire even while the bug is open.
+	c.advanceTime(15 * 24 * time.Hour)
+	_, err = c.GET("/cron/deprecate_assets")
+	c.expectOK(err)
+	needed, err := c.client2.NeededAssetsList()
+	c.expectOK(err)
+	c.expectEQ(needed.DownloadURLs, []string{"http://google.com/disk_image"})
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// For namespaces with AutoPatchTesting, patches posted to the lore discussions of bugs
+// with reproducers are tested without waiting for a "#syz test" command.
+// The patch is fetched from lore by its Message-ID, the copy that we received is only used
+// if lore does not have the message (yet). At most one patch is tested per thread and patch
+// version (see Job.AutoTest), the results are posted to the thread like for manual tests.
+
+// Lore messages are much smaller, this only protects against garbage responses.
+const maxLoreMessageSize = 4 << 20
+
+var (
+	patchSubjectRe = regexp.MustCompile(`(?i)^\[(?:RFC\s+)?PATCH\b([^\]]*)\]`)
+	patchVersionRe = regexp.MustCompile(`(?i)\bv(\d+)\b`)
+	patchSeriesRe  = regexp.MustCompile(`\b(\d+)/(\d+)\b`)
+)
+
+// parsePatchSubject returns the version of the patch, if the subject belongs to a standalone patch.
+// Replies, cover letters and parts of multi-patch series are not tested automatically:
+// we cannot test just a part of a series.
+func parsePatchSubject(subject string) (int, bool) {
+	match := patchSubjectRe.FindStringSubmatch(subject)
+	if match == nil {
+		return 0, false
+	}
+	if series := patchSeriesRe.FindStringSubmatch(match[1]); series != nil && series[2] != "1" {
+		return 0, false
+	}
+	version := 1
+	if v := patchVersionRe.FindStringSubmatch(match[1]); v != nil {
+		version, _ = strconv.Atoi(v[1])
+	}
+	return version, true
+}
+
+// autoTestPatch schedules a test of the patch from the discussion message, if it's eligible.
+func autoTestPatch(c context.Context, msg *email.Email, bugID string) error {
+	bug, bugKey, err := findBugByReportingID(c, bugID)
+	if err != nil {
+		return err
+	}
+	if !config.Namespaces[bug.Namespace].AutoPatchTesting || bug.Status != BugStatusOpen ||
+		bug.ReproLevel == ReproLevelNone || bug.sanitizeAccess(AccessPublic) != AccessPublic ||
+		stringInList(config.EmailBlocklist, msg.Author) {
+		return nil
+	}
+	version, ok := parsePatchSubject(msg.Subject)
+	if !ok {
+		return nil
+	}
+	bugReporting, _ := bugReportingByID(bug, bugID)
+	if bugReporting == nil || !bugReporting.Closed.IsZero() {
+		return nil
+	}
+	discussion, err := discussionByMessageID(c, dashapi.DiscussionLore, msg.MessageID)
+	if err != nil {
+		// E.g. the message was put aside due to the discussion quota.
+		return fmt.Errorf("failed to query the discussion: %w", err)
+	}
+	autoTest := fmt.Sprintf("%v/v%v", discussion.ID, version)
+	keys, err := db.NewQuery("Job").
+		Ancestor(bugKey).
+		Filter("AutoTest=", autoTest).
+		KeysOnly().
+		Limit(1).
+		GetAll(c, nil)
+	if err != nil {
+		return fmt.Errorf("failed to query jobs: %w", err)
+	}
+	if len(keys) != 0 {
+		return nil
+	}
+	patch := loreMessagePatch(c, msg.MessageID)
+	if patch == "" {
+		patch = msg.Patch
+	}
+	if patch == "" {
+		return nil
+	}
+	crash, crashKey, err := findCrashForBug(c, bug)
+	if err != nil {
+		return fmt.Errorf("failed to find a crash: %w", err)
+	}
+	build, err := loadBuild(c, bug.Namespace, crash.BuildID)
+	if err != nil {
+		return err
+	}
+	log.Infof(c, "auto-testing patch %v for bug %q on %v/%v",
+		msg.MessageID, bug.Title, build.KernelRepo, build.KernelBranch)
+	err = addTestJob(c, &testJobArgs{
+		crash:    crash,
+		crashKey: crashKey,
+		autoTest: autoTest,
+		testReqArgs: testReqArgs{
+			bug:          bug,
+			bugKey:       bugKey,
+			bugReporting: bugReporting,
+			user:         msg.Author,
+			extID:        msg.MessageID,
+			link:         msg.Link,
+			patch:        []byte(patch),
+			repo:         build.KernelRepo,
+			branch:       build.KernelBranch,
+			jobCC:        email.MergeEmailLists([]string{msg.Author}, msg.Cc),
+		},
+	}, timeNow(c))
+	if badReq := new(BadTestRequestError); errors.As(err, &badReq) {
+		// Nobody asked for the test, so there's no one to reply to.
+		log.Infof(c, "not auto-testing patch %v: %v", msg.MessageID, err)
+		return nil
+	}
+	return err
+}
+
+// loreMessagePatch returns the patch from the lore copy of the message.
+func loreMessagePatch(c context.Context, msgID string) string {
+	raw, err := fetchLoreMessage(c, msgID)
+	if err != nil {
+		// Lore may not have archived the message yet.
+		log.Warningf(c, "failed to fetch %v from lore: %v", msgID, err)
+		return ""
+	}
+	msg, err := email.Parse(bytes.NewReader(raw), ownEmails(c), ownMailingLists(), []string{appURL(c)})
+	if err != nil {
+		log.Warningf(c, "failed to parse %v from lore: %v", msgID, err)
+		return ""
+	}
+	return msg.Patch
+}
+
+var fetchLoreMessage = func(c context.Context, msgID string) ([]byte, error) {
+	addr := fmt.Sprintf("https://lore.kernel.org/all/%s/raw", url.PathEscape(strings.Trim(msgID, "<>")))
+	req, err := http.NewRequestWithContext(c, "GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", addr, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxLoreMessageSize))
+}
+
+// autoTestNotApplied checks whether the automatic test failed because the patch did not apply.
+// Such patches likely target a different tree, so the failure is not worth a reply.
+func autoTestNotApplied(c context.Context, job *Job) (bool, error) {
+	if job.AutoTest == "" || job.Type != JobTestPatch || job.Error == 0 {
+		return false, nil
+	}
+	jobError, _, err := getText(c, textError, job.Error)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(jobError, []byte("failed to apply patch")), nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestParsePatchSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		version int
+		ok      bool
+	}{
+		{"[PATCH] mm: fix the crash", 1, true},
+		{"[PATCH v3] mm: fix the crash", 3, true},
+		{"[PATCH net-next v2] net: fix the crash", 2, true},
+		{"[RFC PATCH] mm: fix the crash", 1, true},
+		{"[patch V4 1/1] mm: fix the crash", 4, true},
+		{"[PATCH v2 2/3] mm: fix the crash", 0, false},
+		{"[PATCH 0/3] mm: fix the crashes", 0, false},
+		{"Re: [PATCH] mm: fix the crash", 0, false},
+		{"mm: fix the crash", 0, false},
+	}
+	for _, test := range tests {
+		version, ok := parsePatchSubject(test.subject)
+		if version != test.version || ok != test.ok {
+			t.Errorf("%q: got %v/%v, want %v/%v", test.subject, version, ok, test.version, test.ok)
+		}
+	}
+}
+
+const autoTestPatch2 = `--- a/mm/kasan/kasan.c
++++ b/mm/kasan/kasan.c
+-       current->kasan_depth++;
++       current->kasan_depth = 0;
+`
+
+func TestAutoPatchTesting(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrashWithRepro(build, 1))
+	extBugID := c.pollEmailExtID()
+	testJobs := dashapi.ManagerJobs{TestPatches: true}
+
+	// The patch is taken from lore rather than from the received copy.
+	thread := c.incomingThread("[PATCH] foo: fix the crash", extBugID)
+	patchID := fmt.Sprintf("<thread-%v@test.com>", c.emailSeq+1)
+	c.loreMessages[patchID] = fmt.Sprintf("Message-ID: %v\nSubject: [PATCH] foo: fix the crash\n"+
+		"From: developer@kernel.org\nContent-Type: text/plain\n\nThe patch.\n%v", patchID, sampleGitPatch)
+	thread.reply("developer@kernel.org", "The patch (mangled).\n"+autoTestPatch2)
+	resp := client.pollSpecificJobs(build.Manager, testJobs)
+	c.expectEQ(resp.Type, dashapi.JobTestPatch)
+	c.expectEQ(resp.Patch, []byte(sampleGitPatch))
+	c.expectEQ(resp.KernelRepo, build.KernelRepo)
+	c.expectEQ(resp.KernelBranch, build.KernelBranch)
+
+	// Neither the replies nor the redelivered patch are tested again.
+	thread.reply("reviewer@kernel.org", "Try this instead.\n"+autoTestPatch2)
+	thread.redeliver()
+	c.expectEQ(client.pollSpecificJobs(build.Manager, testJobs).ID, "")
+
+	client.expectOK(client.JobDone(&dashapi.JobDoneReq{
+		ID:    resp.ID,
+		Build: *build,
+	}))
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.Headers["In-Reply-To"], []string{patchID})
+	c.expectTrue(strings.HasPrefix(msg.Body, "This is an automatic test of the patch posted in this thread"))
+	c.expectTrue(strings.Contains(msg.Body, "the reproducer did not trigger any issue"))
+
+	// There's no lore copy of the second version yet, and it does not apply.
+	thread = c.incomingThread("[PATCH v2] foo: fix the crash", extBugID)
+	thread.reply("developer@kernel.org", "The patch.\n"+autoTestPatch2)
+	resp = client.pollSpecificJobs(build.Manager, testJobs)
+	c.expectEQ(resp.Type, dashapi.JobTestPatch)
+	c.expectEQ(resp.Patch, []byte(autoTestPatch2))
+	client.expectOK(client.JobDone(&dashapi.JobDoneReq{
+		ID:    resp.ID,
+		Build: *build,
+		Error: []byte("failed to apply patch:\nhunk #1 FAILED"),
+	}))
+	c.expectNoEmail()
+
+	// Parts of patch series are not tested.
+	thread = c.incomingThread("[PATCH v3 2/2] foo: fix the crash", extBugID)
+	thread.reply("developer@kernel.org", "The patch.\n"+autoTestPatch2)
+	c.expectEQ(client.pollSpecificJobs(build.Manager, testJobs).ID, "")
+}
@@ -0,0 +1,339 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/vcs"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// For namespaces with a BackportConfig, syz-ci looks up the fix commits of the fixed bugs
+// in the stable branches during commit polling and reports back which of them have been backported.
+
+const (
+	// How often the backports of a bug are checked.
+	backportCheckPeriod = 24 * time.Hour
+	// Backports of bugs that were closed longer ago are no longer checked.
+	backportTrackingPeriod = 365 * 24 * time.Hour
+	// How many bugs are checked per commit poll.
+	backportPollBugs = 30
+)
+
+func (cfg *BackportConfig) branchAlias(repo dashapi.Repo) string {
+	for _, branch := range cfg.Branches {
+		if branch.URL == repo.URL && branch.Branch == repo.Branch {
+			return branch.Alias
+		}
+	}
+	return ""
+}
+
+// backportPolls returns the fix commits that need to be looked up in the stable branches.
+func backportPolls(c context.Context, ns string) ([]dashapi.BackportPoll, error) {
+	cfg := config.Namespaces[ns].Backports
+	if cfg == nil {
+		return nil, nil
+	}
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("Status=", BugStatusFixed).
+		Filter("BackportsDone=", false).
+		Filter("BackportsChecked<", timeNow(c).Add(-backportCheckPeriod)).
+		Order("BackportsChecked").
+		Limit(backportPollBugs).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	var ret []dashapi.BackportPoll
+	for _, branch := range cfg.Branches {
+		commits := map[string]string{}
+		for _, bug := range bugs {
+			for i, title := range bug.Commits {
+				if backport := bug.findBackport(branch.Alias, title); backport != nil && backport.Hash != "" {
+					continue
+				}
+				if hash := bug.getCommitInfo(i).Hash; hash != "" || commits[title] == "" {
+					commits[title] = hash
+				}
+			}
+		}
+		if len(commits) == 0 {
+			continue
+		}
+		poll := dashapi.BackportPoll{
+			Repo: dashapi.Repo{URL: branch.URL, Branch: branch.Branch},
+		}
+		for title, hash := range commits {
+			poll.Commits = append(poll.Commits, dashapi.Commit{Title: title, Hash: hash})
+		}
+		sort.Slice(poll.Commits, func(i, j int) bool {
+			return poll.Commits[i].Title < poll.Commits[j].Title
+		})
+		ret = append(ret, poll)
+	}
+	return ret, nil
+}
+
+type backportUpdate struct {
+	branch string
+	commit string
+	hash   string
+}
+
+func apiUploadBackports(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	req := new(dashapi.BackportResultReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	cfg := config.Namespaces[ns].Backports
+	if cfg == nil {
+		return nil, fmt.Errorf("namespace %v does not track backports", ns)
+	}
+	bugKeys := map[string][]*db.Key{}
+	updates := map[string][]backportUpdate{}
+	var keys []*db.Key
+	for _, res := range req.Results {
+		branch := cfg.branchAlias(res.Repo)
+		if branch == "" {
+			log.Errorf(c, "%v: unknown backport branch %v/%v", ns, res.Repo.URL, res.Repo.Branch)
+			continue
+		}
+		var items []backportUpdate
+		for _, com := range res.Found {
+			items = append(items, backportUpdate{branch, com.Title, com.Hash})
+		}
+		for _, title := range res.Missing {
+			items = append(items, backportUpdate{branch, title, ""})
+		}
+		for _, item := range items {
+			if _, ok := bugKeys[item.commit]; !ok {
+				list, err := db.NewQuery("Bug").
+					Filter("Namespace=", ns).
+					Filter("Commits=", item.commit).
+					KeysOnly().
+					GetAll(c, nil)
+				if err != nil {
+					return nil, fmt.Errorf("failed to query bugs: %w", err)
+				}
+				bugKeys[item.commit] = list
+			}
+			for _, key := range bugKeys[item.commit] {
+				if updates[key.StringID()] == nil {
+					keys = append(keys, key)
+				}
+				updates[key.StringID()] = append(updates[key.StringID()], item)
+			}
+		}
+	}
+	for _, key := range keys {
+		if err := updateBugBackports(c, key, cfg, updates[key.StringID()]); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func updateBugBackports(c context.Context, bugKey *db.Key, cfg *BackportConfig, updates []backportUpdate) error {
+	now := timeNow(c)
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		for _, item := range updates {
+			bug.setBackport(item.branch, item.commit, item.hash, now)
+		}
+		bug.updateBackportStatus(cfg, now)
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+func (bug *Bug) findBackport(branch, commit string) *BugBackport {
+	for i := range bug.Backports {
+		if bug.Backports[i].Branch == branch && bug.Backports[i].Commit == commit {
+			return &bug.Backports[i]
+		}
+	}
+	return nil
+}
+
+func (bug *Bug) setBackport(branch, commit, hash string, now time.Time) {
+	backport := bug.findBackport(branch, commit)
+	if backport == nil {
+		bug.Backports = append(bug.Backports, BugBackport{Branch: branch, Commit: commit})
+		backport = &bug.Backports[len(bug.Backports)-1]
+	}
+	backport.Hash = hash
+	backport.Checked = now
+}
+
+// updateBackportStatus recomputes the backport flags of the bug after a check.
+func (bug *Bug) updateBackportStatus(cfg *BackportConfig, now time.Time) {
+	missing, complete := false, true
+	for _, branch := range cfg.Branches {
+		for _, commit := range bug.Commits {
+			backport := bug.findBackport(branch.Alias, commit)
+			if backport == nil || backport.Hash == "" {
+				complete = false
+			}
+			if backport != nil && backport.Hash == "" {
+				missing = true
+			}
+		}
+	}
+	bug.BackportsChecked = now
+	bug.BackportsMissing = missing
+	bug.BackportsDone = complete || now.Sub(bug.Closed) > backportTrackingPeriod
+}
+
+type uiBackports struct {
+	Branches []string
+	Rows     []*uiBackportRow
+	ShowBugs bool
+	Now      time.Time
+}
+
+type uiBackportRow struct {
+	BugTitle string
+	BugLink  string
+	Closed   time.Time
+	Commit   string
+	Cells    []*uiBackportCell
+}
+
+// uiBackportCell is the status of a commit in a branch. If neither Hash nor Missing is set,
+// the branch has not been checked yet.
+type uiBackportCell struct {
+	Hash    string
+	Link    string
+	Missing bool
+	Checked time.Time
+}
+
+func makeBackportRows(bug *Bug, cfg *BackportConfig) []*uiBackportRow {
+	var rows []*uiBackportRow
+	for _, commit := range bug.Commits {
+		row := &uiBackportRow{
+			BugTitle: bug.displayTitle(),
+			BugLink:  bugLink(bug.keyHash()),
+			Closed:   bug.Closed,
+			Commit:   commit,
+		}
+		for _, branch := range cfg.Branches {
+			cell := &uiBackportCell{}
+			if backport := bug.findBackport(branch.Alias, commit); backport != nil {
+				cell.Hash = backport.Hash
+				cell.Link = vcs.CommitLink(branch.URL, backport.Hash)
+				cell.Missing = backport.Hash == ""
+				cell.Checked = backport.Checked
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func backportBranchNames(cfg *BackportConfig) []string {
+	var ret []string
+	for _, branch := range cfg.Branches {
+		ret = append(ret, branch.Alias)
+	}
+	return ret
+}
+
+// makeBackportsUI returns the backport matrix for the bug page.
+func makeBackportsUI(bug *Bug) *uiBackports {
+	cfg := config.Namespaces[bug.Namespace].Backports
+	if cfg == nil || bug.Status != BugStatusFixed || len(bug.Commits) == 0 {
+		return nil
+	}
+	return &uiBackports{
+		Branches: backportBranchNames(cfg),
+		Rows:     makeBackportRows(bug, cfg),
+	}
+}
+
+type uiMissingBackportsPage struct {
+	Header       *uiHeader
+	MissingAfter string
+	Backports    *uiBackports
+}
+
+// handleMissingBackports lists the fixes that are still missing in some stable branches
+// long after the bugs were fixed.
+func handleMissingBackports(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns := r.FormValue("ns")
+	if ns == "" {
+		ns = config.DefaultNamespace
+	}
+	hdr, err := commonHeader(c, r, w, ns)
+	if err != nil {
+		return err
+	}
+	cfg := config.Namespaces[hdr.Namespace].Backports
+	if cfg == nil {
+		return fmt.Errorf("backports are not tracked in %v: %w", hdr.Namespace, ErrClientNotFound)
+	}
+	rows, err := loadMissingBackports(c, namespaceAccessLevel(c, r, hdr.Namespace), hdr.Namespace, cfg)
+	if err != nil {
+		return err
+	}
+	return serveTemplate(w, "missing_backports.html", &uiMissingBackportsPage{
+		Header:       hdr,
+		MissingAfter: fmt.Sprintf("%v days", int(cfg.MissingAfter/(24*time.Hour))),
+		Backports: &uiBackports{
+			Branches: backportBranchNames(cfg),
+			Rows:     rows,
+			ShowBugs: true,
+			Now:      timeNow(c),
+		},
+	})
+}
+
+func loadMissingBackports(c context.Context, accessLevel AccessLevel, ns string,
+	cfg *BackportConfig) ([]*uiBackportRow, error) {
+	bugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("Status=", BugStatusFixed).
+			Filter("BackportsMissing=", true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []*uiBackportRow
+	for _, bug := range bugs {
+		if accessLevel < bug.sanitizeAccess(accessLevel) ||
+			timeNow(c).Sub(bug.Closed) < cfg.MissingAfter {
+			continue
+		}
+		for _, row := range makeBackportRows(bug, cfg) {
+			for _, cell := range row.Cells {
+				if cell.Missing {
+					rows = append(rows, row)
+					break
+				}
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Closed.Before(rows[j].Closed)
+	})
+	return rows, nil
+}
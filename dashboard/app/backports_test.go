@@ -0,0 +1,139 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestUpdateBackportStatus(t *testing.T) {
+	cfg := &BackportConfig{
+		Branches: []BackportBranch{{Alias: "6.1"}, {Alias: "5.15"}},
+	}
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	bug := &Bug{
+		Commits: []string{"foo: fix1", "foo: fix2"},
+		Closed:  now.Add(-24 * time.Hour),
+	}
+	bug.updateBackportStatus(cfg, now)
+	if bug.BackportsMissing || bug.BackportsDone || !bug.BackportsChecked.Equal(now) {
+		t.Fatalf("unexpected status of an unchecked bug: %+v", bug)
+	}
+	bug.setBackport("6.1", "foo: fix1", "hash1", now)
+	bug.setBackport("5.15", "foo: fix1", "", now)
+	bug.updateBackportStatus(cfg, now)
+	if !bug.BackportsMissing || bug.BackportsDone {
+		t.Fatalf("unexpected status of a partially backported bug: %+v", bug)
+	}
+	bug.setBackport("5.15", "foo: fix1", "hash2", now)
+	bug.setBackport("6.1", "foo: fix2", "hash3", now)
+	bug.setBackport("5.15", "foo: fix2", "hash4", now)
+	bug.updateBackportStatus(cfg, now)
+	if bug.BackportsMissing || !bug.BackportsDone || len(bug.Backports) != 4 {
+		t.Fatalf("unexpected status of a fully backported bug: %+v", bug)
+	}
+	// Old bugs are not tracked forever.
+	bug.setBackport("5.15", "foo: fix2", "", now)
+	bug.updateBackportStatus(cfg, now)
+	if !bug.BackportsMissing || bug.BackportsDone {
+		t.Fatalf("unexpected status of a recent bug: %+v", bug)
+	}
+	bug.updateBackportStatus(cfg, now.Add(backportTrackingPeriod))
+	if !bug.BackportsMissing || !bug.BackportsDone {
+		t.Fatalf("unexpected status of an old bug: %+v", bug)
+	}
+}
+
+func TestBackports(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+
+	// Open bugs are not checked.
+	resp, err := c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(len(resp.Backports), 0)
+
+	build.FixCommits = []dashapi.Commit{{Title: "foo: fix1", BugIDs: []string{rep.ID}}}
+	c.client.UploadBuild(build)
+	c.expectOK(c.client.UploadCommits([]dashapi.Commit{{Hash: "hash1", Title: "foo: fix1"}}))
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bug.Status, BugStatusFixed)
+
+	resp, err = c.client.CommitPoll()
+	c.expectOK(err)
+	stable := "git://syzkaller.org/stable.git"
+	fix := []dashapi.Commit{{Title: "foo: fix1", Hash: "hash1"}}
+	c.expectEQ(resp.Backports, []dashapi.BackportPoll{
+		{Repo: dashapi.Repo{URL: stable, Branch: "linux-6.1.y"}, Commits: fix},
+		{Repo: dashapi.Repo{URL: stable, Branch: "linux-5.15.y"}, Commits: fix},
+	})
+	c.expectOK(c.client.UploadBackports([]dashapi.BackportResult{
+		{
+			Repo:  dashapi.Repo{URL: stable, Branch: "linux-6.1.y"},
+			Found: []dashapi.Commit{{Title: "foo: fix1", Hash: "backport1"}},
+		},
+		{
+			Repo:    dashapi.Repo{URL: stable, Branch: "linux-5.15.y"},
+			Missing: []string{"foo: fix1"},
+		},
+	}))
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectTrue(bug.BackportsMissing)
+	c.expectTrue(!bug.BackportsDone)
+
+	// The bug is not checked again until the check period passes,
+	// and then only the missing backports are looked up.
+	resp, err = c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(len(resp.Backports), 0)
+	c.advanceTime(backportCheckPeriod + time.Hour)
+	resp, err = c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(resp.Backports, []dashapi.BackportPoll{
+		{Repo: dashapi.Repo{URL: stable, Branch: "linux-5.15.y"}, Commits: fix},
+	})
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Backports"))
+	c.expectTrue(strings.Contains(string(page), "backport1"))
+	c.expectTrue(strings.Contains(string(page), "missing"))
+
+	// The fix is reported as missing only once the bug is fixed for long enough.
+	page, err = c.AuthGET(AccessAdmin, "/missing_backports?ns=test1")
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), crash.Title))
+	c.advanceTime(testConfig.Namespaces["test1"].Backports.MissingAfter)
+	page, err = c.AuthGET(AccessAdmin, "/missing_backports?ns=test1")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), crash.Title))
+
+	// Once backported, the bug is no longer checked.
+	c.expectOK(c.client.UploadBackports([]dashapi.BackportResult{
+		{
+			Repo:  dashapi.Repo{URL: stable, Branch: "linux-5.15.y"},
+			Found: []dashapi.Commit{{Title: "foo: fix1", Hash: "backport2"}},
+		},
+	}))
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectTrue(!bug.BackportsMissing)
+	c.expectTrue(bug.BackportsDone)
+	page, err = c.AuthGET(AccessAdmin, "/missing_backports?ns=test1")
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), crash.Title))
+
+	// Namespaces without backport tracking have no such page.
+	_, err = c.AuthGET(AccessAdmin, "/missing_backports?ns=test2")
+	c.expectTrue(err != nil)
+}
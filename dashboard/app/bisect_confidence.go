@@ -0,0 +1,234 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Flaky reproducers, commits that can't be tested and infrastructure errors make bisections
+// land on unrelated commits, and such results erode the trust in all bisection emails.
+// syz-ci records the test results of each tested commit (dashapi.JobDoneReq.Revisions)
+// and whether the single resulting commit touches the directory of the guilty file.
+// bisectConfidence turns that and the reproducer reliability (see repro_reliability.go)
+// into a confidence level with human-readable reasons, which are stored in the Job and
+// shown in the result emails and on the bug page.
+// Authorized users may ask to redo the bisection with "#syz retest-bisect": the bug bisection
+// status is reset, and the next bisection job tests each commit bisectRetestRepeats times
+// as much. The command can be used once in bisectRetestPeriod per bug.
+
+type BisectConfidence int
+
+const (
+	BisectConfidenceUnknown BisectConfidence = iota // jobs created before the confidence was introduced
+	BisectConfidenceLow
+	BisectConfidenceMedium
+	BisectConfidenceHigh
+)
+
+func (conf BisectConfidence) String() string {
+	switch conf {
+	case BisectConfidenceLow:
+		return "low"
+	case BisectConfidenceMedium:
+		return "medium"
+	case BisectConfidenceHigh:
+		return "high"
+	default:
+		return ""
+	}
+}
+
+const (
+	bisectRetestRepeats = 3
+	bisectRetestPeriod  = 30 * 24 * time.Hour
+)
+
+type bisectConfidenceInput struct {
+	Revisions []dashapi.BisectRevision
+	// Culprit is set if the bisection has found a single commit.
+	Culprit           bool
+	GuiltyFile        string
+	TouchesGuiltyFile bool
+	// ReproReliability is the share of the runs that reproduced the crash, negative if unknown.
+	ReproReliability float64
+}
+
+// bisectConfidence estimates how much the bisection result can be trusted.
+// Each of the detected problems lowers the confidence and adds a note.
+func bisectConfidence(in *bisectConfidenceInput) (BisectConfidence, []string) {
+	if len(in.Revisions) == 0 {
+		return BisectConfidenceUnknown, nil
+	}
+	var notes []string
+	penalty := 0
+	skipped, unreliable := 0, 0
+	for _, rev := range in.Revisions {
+		if rev.Skipped {
+			skipped++
+			continue
+		}
+		// A commit that crashed only in a few runs may well have been a false negative
+		// in a neighbouring commit, and many errors leave too few runs for a verdict.
+		if rev.Crashes != 0 && rev.Crashes*4 < rev.Runs || rev.Errors*3 > rev.Runs {
+			unreliable++
+		}
+	}
+	if skipped != 0 {
+		notes = append(notes, fmt.Sprintf("%v of %v tested commits could not be tested",
+			skipped, len(in.Revisions)))
+		penalty++
+		if skipped*3 >= len(in.Revisions) {
+			penalty++
+		}
+	}
+	if unreliable != 0 {
+		notes = append(notes, fmt.Sprintf("%v of %v tested commits had unreliable test results",
+			unreliable, len(in.Revisions)))
+		penalty++
+	}
+	if in.Culprit && in.GuiltyFile != "" && !in.TouchesGuiltyFile {
+		notes = append(notes, fmt.Sprintf("the commit does not change files in %v/ (the crash is in %v)",
+			path.Dir(in.GuiltyFile), in.GuiltyFile))
+		penalty++
+	}
+	if in.ReproReliability >= 0 && in.ReproReliability < 0.5 {
+		notes = append(notes, fmt.Sprintf("the reproducer triggers the crash only in %v%% of runs",
+			int(in.ReproReliability*100)))
+		penalty++
+	}
+	switch penalty {
+	case 0:
+		return BisectConfidenceHigh, notes
+	case 1:
+		return BisectConfidenceMedium, notes
+	default:
+		return BisectConfidenceLow, notes
+	}
+}
+
+// setBisectConfidence records the bisection details of the finished job,
+// it's called in the doneJob transaction.
+func setBisectConfidence(c context.Context, job *Job, jobKey *db.Key, req *dashapi.JobDoneReq) error {
+	job.Revisions = req.Revisions
+	job.GuiltyFile = req.GuiltyFile
+	job.TouchesGuiltyFile = req.TouchesGuiltyFile
+	if len(req.Error) != 0 {
+		return nil
+	}
+	crash := new(Crash)
+	if err := db.Get(c, db.NewKey(c, "Crash", "", job.CrashID, jobKey.Parent()), crash); err != nil {
+		return fmt.Errorf("job %v: failed to get crash: %v", req.ID, err)
+	}
+	reliability, ok := crash.reproReliability()
+	if !ok {
+		reliability = -1
+	}
+	job.Confidence, job.ConfidenceNotes = bisectConfidence(&bisectConfidenceInput{
+		Revisions:         req.Revisions,
+		Culprit:           len(req.Commits) == 1,
+		GuiltyFile:        req.GuiltyFile,
+		TouchesGuiltyFile: req.TouchesGuiltyFile,
+		ReproReliability:  reliability,
+	})
+	return nil
+}
+
+type BisectRetestDeniedError struct {
+	message string
+}
+
+func (e *BisectRetestDeniedError) Error() string {
+	return e.message
+}
+
+func finishedBisection(status BisectStatus) bool {
+	return status != BisectNot && status != BisectPending
+}
+
+// checkBisectRetestRequest returns the type of the bisection to retest,
+// or a non-empty reason if the bisection of the bug can't be retested now.
+func checkBisectRetestRequest(bug *Bug, now time.Time) (JobType, string) {
+	switch {
+	case bug.Status != BugStatusOpen:
+		return 0, "The bug is already closed."
+	case bug.BisectRetestPending:
+		return 0, "The bisection retest was already requested and is still pending."
+	case now.Sub(bug.BisectRetestRequested) < bisectRetestPeriod:
+		return 0, fmt.Sprintf("The bisection was already retested on %v,"+
+			" the next request is possible in %v.",
+			bug.BisectRetestRequested.Format("2006/01/02"),
+			bug.BisectRetestRequested.Add(bisectRetestPeriod).Sub(now).Truncate(time.Hour))
+	case finishedBisection(bug.BisectCause):
+		return JobBisectCause, ""
+	case finishedBisection(bug.BisectFix):
+		return JobBisectFix, ""
+	}
+	return 0, "The bug has no finished bisection to retest."
+}
+
+// requestBisectRetest resets the bisection of the bug, so that it's picked up again
+// by findBugsForBisection with more test repetitions per commit.
+func requestBisectRetest(c context.Context, bugKey *db.Key, user string) (JobType, error) {
+	now := timeNow(c)
+	var jobType JobType
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %v", err)
+		}
+		var reason string
+		jobType, reason = checkBisectRetestRequest(bug, now)
+		if reason != "" {
+			return &BisectRetestDeniedError{reason}
+		}
+		if jobType == JobBisectCause {
+			bug.BisectCause = BisectNot
+		} else {
+			bug.BisectFix = BisectNot
+		}
+		bug.BisectRetestRequested = now
+		bug.BisectRetestPending = true
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %v", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return 0, err
+	}
+	log.Infof(c, "%v: %v requested a bisection retest", bugKey.StringID(), user)
+	return jobType, nil
+}
+
+func handleRetestBisectCommand(c context.Context, info *bugInfoResult, msg *email.Email) error {
+	bugID := info.bugReporting.ID
+	if !senderAuthorized(c, info.bug.Namespace, msg.Author) {
+		return replyTo(c, msg, bugID, "You are not authorized to retest the bisection of the bug.\n"+
+			"Please contact the bot's maintainers.")
+	}
+	msg.Cc = []string{info.reporting.Config.(*EmailConfig).Email}
+	jobType, err := requestBisectRetest(c, info.bugKey, msg.Author)
+	if denied, ok := err.(*BisectRetestDeniedError); ok {
+		return replyTo(c, msg, bugID, denied.Error())
+	} else if err != nil {
+		log.Errorf(c, "failed to request the bisection retest: %s", err)
+		return replyTo(c, msg, bugID, "I've failed to queue the bisection due to an internal error.\n")
+	}
+	what := "cause"
+	if jobType == JobBisectFix {
+		what = "fix"
+	}
+	return replyTo(c, msg, bugID, fmt.Sprintf("Thank you!\n\nI've queued the %v bisection once again,"+
+		" each commit will be tested %v times as much.\nThe new result will be shown on the bug page.",
+		what, bisectRetestRepeats))
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBisectConfidence(t *testing.T) {
+	good := dashapi.BisectRevision{Runs: 10}
+	crashed := dashapi.BisectRevision{Runs: 10, Crashes: 8}
+	skipped := dashapi.BisectRevision{Skipped: true}
+	flaky := dashapi.BisectRevision{Runs: 20, Crashes: 1}
+	broken := dashapi.BisectRevision{Runs: 10, Crashes: 1, Errors: 6}
+	tests := []struct {
+		name  string
+		input bisectConfidenceInput
+		conf  BisectConfidence
+		notes []string
+	}{
+		{
+			name:  "no-revisions",
+			input: bisectConfidenceInput{Culprit: true, ReproReliability: -1},
+			conf:  BisectConfidenceUnknown,
+		},
+		{
+			name: "clean",
+			input: bisectConfidenceInput{
+				Revisions:         []dashapi.BisectRevision{crashed, good, crashed, good},
+				Culprit:           true,
+				GuiltyFile:        "fs/ext4/inode.c",
+				TouchesGuiltyFile: true,
+				ReproReliability:  0.9,
+			},
+			conf: BisectConfidenceHigh,
+		},
+		{
+			name: "unknown-guilty-file-and-reliability",
+			input: bisectConfidenceInput{
+				Revisions:        []dashapi.BisectRevision{crashed, good, crashed, good},
+				Culprit:          true,
+				ReproReliability: -1,
+			},
+			conf: BisectConfidenceHigh,
+		},
+		{
+			name: "one-skipped",
+			input: bisectConfidenceInput{
+				Revisions:        []dashapi.BisectRevision{crashed, good, skipped, crashed, good},
+				Culprit:          true,
+				ReproReliability: -1,
+			},
+			conf:  BisectConfidenceMedium,
+			notes: []string{"1 of 5 tested commits could not be tested"},
+		},
+		{
+			name: "many-skipped",
+			input: bisectConfidenceInput{
+				Revisions:        []dashapi.BisectRevision{crashed, skipped, skipped, good},
+				ReproReliability: -1,
+			},
+			conf:  BisectConfidenceLow,
+			notes: []string{"2 of 4 tested commits could not be tested"},
+		},
+		{
+			name: "unreliable-runs",
+			input: bisectConfidenceInput{
+				Revisions:        []dashapi.BisectRevision{crashed, flaky, broken, good},
+				Culprit:          true,
+				ReproReliability: -1,
+			},
+			conf:  BisectConfidenceMedium,
+			notes: []string{"2 of 4 tested commits had unreliable test results"},
+		},
+		{
+			name: "unrelated-culprit",
+			input: bisectConfidenceInput{
+				Revisions:        []dashapi.BisectRevision{crashed, good},
+				Culprit:          true,
+				GuiltyFile:       "fs/ext4/inode.c",
+				ReproReliability: -1,
+			},
+			conf:  BisectConfidenceMedium,
+			notes: []string{"the commit does not change files in fs/ext4/ (the crash is in fs/ext4/inode.c)"},
+		},
+		{
+			name: "inconclusive-guilty-file",
+			input: bisectConfidenceInput{
+				Revisions:        []dashapi.BisectRevision{crashed, good},
+				GuiltyFile:       "fs/ext4/inode.c",
+				ReproReliability: -1,
+			},
+			conf: BisectConfidenceHigh,
+		},
+		{
+			name: "everything-wrong",
+			input: bisectConfidenceInput{
+				Revisions:        []dashapi.BisectRevision{crashed, flaky, skipped},
+				Culprit:          true,
+				GuiltyFile:       "mm/slab.c",
+				ReproReliability: 0.25,
+			},
+			conf: BisectConfidenceLow,
+			notes: []string{
+				"1 of 3 tested commits could not be tested",
+				"1 of 3 tested commits had unreliable test results",
+				"the commit does not change files in mm/ (the crash is in mm/slab.c)",
+				"the reproducer triggers the crash only in 25% of runs",
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			conf, notes := bisectConfidence(&test.input)
+			assert.Equal(t, test.conf, conf)
+			assert.Equal(t, test.notes, notes)
+		})
+	}
+}
+
+func TestRetestBisect(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client2.UploadBuild(build)
+	c.client2.ReportCrash(testCrashWithRepro(build, 1))
+	sender := c.client2.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	pollResp := c.client2.pollJobs(build.Manager)
+	c.expectEQ(pollResp.Type, dashapi.JobBisectCause)
+	c.expectEQ(pollResp.BisectTestRepeats, 0)
+	done := &dashapi.JobDoneReq{
+		ID:          pollResp.ID,
+		Build:       *build,
+		Log:         []byte("bisect log"),
+		CrashTitle:  "bisect crash title",
+		CrashLog:    []byte("bisect crash log"),
+		CrashReport: []byte("bisect crash report"),
+		Commits: []dashapi.Commit{{
+			Hash:       "36e65cb4a0448942ec316b24d60446bbd5cc7827",
+			Title:      "kernel: add a bug",
+			Author:     "author@kernel.org",
+			AuthorName: "Author Kernelov",
+			Date:       time.Date(2000, 2, 9, 4, 5, 6, 7, time.UTC),
+		}},
+		Revisions: []dashapi.BisectRevision{
+			{Commit: "1", Runs: 20, Crashes: 15},
+			{Commit: "2", Skipped: true},
+			{Commit: "3", Runs: 10, Crashes: 1},
+			{Commit: "4", Runs: 10},
+		},
+		GuiltyFile: "fs/ext4/inode.c",
+	}
+	done.Build.ID = pollResp.ID
+	c.expectOK(c.client2.JobDone(done))
+
+	msg := c.client2.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Body, "syzbot has bisected this issue to:"))
+	c.expectTrue(strings.Contains(msg.Body, `confidence:     low
+  - 1 of 4 tested commits could not be tested
+  - 1 of 4 tested commits had unreliable test results
+  - the commit does not change files in fs/ext4/ (the crash is in fs/ext4/inode.c)
+`))
+	c.expectTrue(strings.Contains(msg.Body, "#syz retest-bisect"))
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Confidence"))
+
+	// Random people can't request retests.
+	c.incomingEmail(sender, "#syz retest-bisect\n", EmailOptFrom("test@requester.com"))
+	c.expectTrue(strings.Contains(c.client2.pollEmailBug().Body, "You are not authorized"))
+
+	c.incomingEmail(sender, "#syz retest-bisect\n", EmailOptFrom("dev@syzkaller.com"))
+	reply := c.client2.pollEmailBug()
+	c.expectEQ(reply.To, []string{"dev@syzkaller.com"})
+	c.expectTrue(strings.Contains(reply.Body, "I've queued the cause bisection once again"))
+	c.incomingEmail(sender, "#syz retest-bisect\n", EmailOptFrom("dev@syzkaller.com"))
+	c.expectTrue(strings.Contains(c.client2.pollEmailBug().Body, "still pending"))
+
+	// The new bisection tests each commit more times.
+	pollResp = c.client2.pollJobs(build.Manager)
+	c.expectEQ(pollResp.Type, dashapi.JobBisectCause)
+	c.expectEQ(pollResp.BisectTestRepeats, bisectRetestRepeats)
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.BisectCause, BisectPending)
+	c.expectEQ(bug.BisectRetestPending, false)
+
+	// Only one retest per month.
+	c.advanceTime(24 * time.Hour)
+	c.incomingEmail(sender, "#syz retest-bisect\n", EmailOptFrom("dev@syzkaller.com"))
+	c.expectTrue(strings.Contains(c.client2.pollEmailBug().Body, "the next request is possible in"))
+}
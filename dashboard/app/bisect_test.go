@@ -848,6 +848,135 @@ func TestBisectCauseExternal(t *testing.T) {
 	c.expectEQ(bisect.Title, rep.Title)
 }
 
+func TestNeedBisectionRetry(t *testing.T) {
+	tests := []struct {
+		status   BisectStatus
+		jobRepro dashapi.ReproLevel
+		bugRepro dashapi.ReproLevel
+		want     bool
+	}{
+		{BisectError, ReproLevelSyz, ReproLevelC, true},
+		{BisectUnreliable, ReproLevelSyz, ReproLevelC, true},
+		{BisectInconclusive, ReproLevelSyz, ReproLevelC, true},
+		// The repro has not improved since the bisection.
+		{BisectError, ReproLevelC, ReproLevelC, false},
+		{BisectInconclusive, ReproLevelSyz, ReproLevelSyz, false},
+		{BisectUnreliable, ReproLevelC, ReproLevelC, false},
+		// Conclusive results are not retried.
+		{BisectYes, ReproLevelSyz, ReproLevelC, false},
+		{BisectHorizont, ReproLevelSyz, ReproLevelC, false},
+		// Nothing to retry yet.
+		{BisectNot, ReproLevelSyz, ReproLevelC, false},
+		{BisectPending, ReproLevelSyz, ReproLevelC, false},
+	}
+	for _, test := range tests {
+		got := needBisectionRetry(test.status, test.jobRepro, test.bugRepro)
+		if got != test.want {
+			t.Errorf("needBisectionRetry(%v, %v, %v) = %v, want %v",
+				test.status, test.jobRepro, test.bugRepro, got, test.want)
+		}
+	}
+}
+
+func TestBisectionRetryOnBetterRepro(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.ReproSyz = []byte("syncfs(1)")
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+
+	c.client.pollAndFailBisectJob(build.Manager)
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bug.BisectCause, BisectError)
+
+	// Another syz repro does not change anything.
+	c.client.ReportCrash(crash)
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.BisectCause, BisectError)
+
+	// A C repro makes the bisection run again.
+	c.client.ReportCrash(testCrashWithRepro(build, 1))
+	c.client.pollBug()
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.BisectCause, BisectNot)
+	pollResp := c.client.pollJobs(build.Manager)
+	c.expectEQ(pollResp.Type, dashapi.JobBisectCause)
+	c.expectNE(len(pollResp.ReproC), 0)
+	c.expectOK(c.client.JobDone(&dashapi.JobDoneReq{
+		ID:    pollResp.ID,
+		Error: []byte("still failing"),
+	}))
+
+	// The improvement has been used up.
+	c.client.ReportCrash(testCrashWithRepro(build, 1))
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.BisectCause, BisectError)
+	pollResp = c.client.pollJobs(build.Manager)
+	c.expectEQ(pollResp.ID, "")
+}
+
+func TestLoadBisections(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrashWithRepro(build, 1))
+	rep := c.client.pollBug()
+
+	pollResp := c.client.pollJobs(build.Manager)
+	done := &dashapi.JobDoneReq{
+		ID:    pollResp.ID,
+		Build: *build,
+		Log:   []byte("bisect log"),
+		Commits: []dashapi.Commit{
+			{
+				Hash:       "111111111111111111111111",
+				Title:      "kernel: break build",
+				Author:     "hacker@kernel.org",
+				AuthorName: "Hacker Kernelov",
+				Date:       time.Date(2000, 2, 9, 4, 5, 6, 7, time.UTC),
+			},
+		},
+		Flags: dashapi.BisectResultMerge,
+	}
+	done.Build.ID = pollResp.ID
+	c.expectOK(c.client.JobDone(done))
+	c.client.pollBug()
+
+	resp, err := c.client.LoadBisections("test1", time.Time{}, "")
+	c.expectOK(err)
+	c.expectEQ(resp.Cursor, "")
+	c.expectEQ(len(resp.Bisections), 1)
+	bisection := resp.Bisections[0]
+	dbBug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bisection.BugID, dbBug.keyHash())
+	c.expectEQ(bisection.BugTitle, "title1")
+	c.expectEQ(bisection.Type, dashapi.ReportBisectCause)
+	c.expectEQ(bisection.Flags, dashapi.BisectResultMerge)
+	c.expectEQ(len(bisection.Commits), 1)
+	c.expectEQ(bisection.Commits[0].Hash, "111111111111111111111111")
+	c.expectEQ(bisection.Commits[0].AuthorName, "Hacker Kernelov")
+	c.expectEQ(bisection.CrashReportLink, rep.ReportLink)
+	c.expectTrue(!bisection.Finished.IsZero())
+
+	resp, err = c.client.LoadBisections("test1", bisection.Finished, "")
+	c.expectOK(err)
+	c.expectEQ(len(resp.Bisections), 0)
+
+	c.expectFail("does not belong to namespace",
+		c.makeClient(client1, password1, false).Query("load_bisections",
+			&dashapi.LoadBisectionsReq{Namespace: "test2"}, nil))
+	// test2 is only accessible to admins.
+	c.expectFail("unauthorized",
+		c.makeClient(client2, password2, false).Query("load_bisections",
+			&dashapi.LoadBisectionsReq{Namespace: "test2"}, nil))
+}
+
 func TestBisectFixExternal(t *testing.T) {
 	c := NewCtx(t)
 	defer c.Close()
@@ -0,0 +1,365 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// The bug history used to be scattered over the bug fields (Reporting, Invalidations,
+// SubsystemsHistory, etc), and some transitions were only visible in the emails.
+// Now every state change also appends a BugEvent to the bug timeline: the code that changes
+// the bug records the event with recordEvent, and the transaction that saves the bug saves
+// the events with saveBugEvents. An event says who did the change (the system, a user or an admin)
+// and what caused it (an email message, a job, a cron handler, an API call or a page).
+// The timeline is shown on the bug page and is included in the JSON version of the page.
+// The events of the bugs that changed before the timeline existed are synthesized
+// from the bug fields by backfillBugTimeline.
+
+// The kinds of BugEvent.Cause.
+const (
+	causeMessage = "message"
+	causeJob     = "job"
+	causeCron    = "cron"
+	causeAPI     = "api"
+	causePage    = "page"
+)
+
+// eventCause formats BugEvent.Cause, it's empty if the reference is not known.
+func eventCause(kind, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	return kind + " " + ref
+}
+
+// recordEvent adds the event to the bug timeline, the event is saved by saveBugEvents.
+func (bug *Bug) recordEvent(event BugEvent) {
+	bug.NumEvents++
+	bug.events = append(bug.events, &event)
+}
+
+// saveBugEvents saves the events recorded since the bug was loaded.
+// It must be called in the transaction that saves the bug.
+func saveBugEvents(c context.Context, bugKey *db.Key, bug *Bug) error {
+	if len(bug.events) == 0 {
+		return nil
+	}
+	keys := make([]*db.Key, len(bug.events))
+	for i := range bug.events {
+		keys[i] = db.NewKey(c, "BugEvent", "", bug.NumEvents-int64(len(bug.events)-i-1), bugKey)
+	}
+	if _, err := db.PutMulti(c, keys, bug.events); err != nil {
+		return fmt.Errorf("failed to save bug events: %w", err)
+	}
+	bug.events = nil
+	return nil
+}
+
+// loadBugEvents returns the bug timeline in the chronological order.
+func loadBugEvents(c context.Context, bugKey *db.Key) ([]*BugEvent, error) {
+	var events []*BugEvent
+	keys, err := db.NewQuery("BugEvent").
+		Ancestor(bugKey).
+		GetAll(c, &events)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bug events: %w", err)
+	}
+	sortBugEvents(events, keys)
+	return events, nil
+}
+
+// sortBugEvents orders the events by time, the events that happened at the same time
+// are ordered as they were recorded.
+func sortBugEvents(events []*BugEvent, keys []*db.Key) {
+	idx := make([]int, len(events))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		a, b := events[idx[i]], events[idx[j]]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		return keys[idx[i]].IntID() < keys[idx[j]].IntID()
+	})
+	sorted := make([]*BugEvent, len(events))
+	sortedKeys := make([]*db.Key, len(keys))
+	for i, j := range idx {
+		sorted[i], sortedKeys[i] = events[j], keys[j]
+	}
+	copy(events, sorted)
+	copy(keys, sortedKeys)
+}
+
+// bugUpdateEvent is the event caused by the bug update. For the email commands cmd.User
+// is the sender and cmd.ExtID is the message ID.
+func bugUpdateEvent(cmd *dashapi.BugUpdate, typ BugEventType, now time.Time, reporting string) BugEvent {
+	event := BugEvent{
+		Type:      typ,
+		Time:      now,
+		Actor:     BugActorSystem,
+		Reporting: reporting,
+	}
+	if cmd.User != "" {
+		event.Actor = BugActorUser
+		event.User = cmd.User
+		event.Cause = eventCause(causeMessage, cmd.ExtID)
+	}
+	return event
+}
+
+func invalidationEventType(reason dashapi.BugStatusReason) BugEventType {
+	if reason == dashapi.InvalidatedByRevokedRepro || reason == dashapi.InvalidatedByNoActivity {
+		return BugEventObsoleted
+	}
+	return BugEventInvalidated
+}
+
+func subsystemChangeEvent(changes []string, now time.Time, cause subsystemChangeCause, user string) BugEvent {
+	event := BugEvent{
+		Type:    BugEventLabels,
+		Time:    now,
+		Actor:   BugActorSystem,
+		Details: fmt.Sprintf("%v (%v)", strings.Join(changes, " "), cause),
+	}
+	switch cause {
+	case subsystemCauseCrash:
+		event.Cause = eventCause(causeAPI, "report_crash")
+	case subsystemCauseRefresh, subsystemCauseRules:
+		event.Cause = eventCause(causeCron, "refresh_subsystems")
+	}
+	if user != "" {
+		event.Actor = BugActorUser
+		event.User = user
+	}
+	return event
+}
+
+func fixCommitsDetails(commits []string) string {
+	return strings.Join(commits, ", ")
+}
+
+// synthesizeBugEvents reconstructs the timeline of a bug from its fields. Only the transitions
+// whose time is known are reconstructed. dupTitle is the title of the bug this bug is a dup of.
+// nolint: gocyclo
+func synthesizeBugEvents(bug *Bug, dupTitle string) []BugEvent {
+	var events []BugEvent
+	add := func(typ BugEventType, t time.Time, reporting, details string) *BugEvent {
+		events = append(events, BugEvent{
+			Type:       typ,
+			Time:       t,
+			Actor:      BugActorSystem,
+			Reporting:  reporting,
+			Details:    details,
+			Backfilled: true,
+		})
+		return &events[len(events)-1]
+	}
+	closing := ""
+	for i := range bug.Reporting {
+		rep := &bug.Reporting[i]
+		if rep.Dummy {
+			continue
+		}
+		if !rep.Reported.IsZero() {
+			add(BugEventReported, rep.Reported, rep.Name, "")
+		}
+		if rep.Closed.IsZero() {
+			continue
+		}
+		if bug.Status != BugStatusOpen && rep.Closed.Equal(bug.Closed) {
+			closing = rep.Name
+			continue
+		}
+		add(BugEventUpstreamed, rep.Closed, rep.Name, "")
+	}
+	if len(bug.Commits) != 0 && !bug.FixTime.IsZero() {
+		add(BugEventFixAttached, bug.FixTime, "", fixCommitsDetails(bug.Commits))
+	}
+	last := bug.lastInvalidation()
+	for i := range bug.Invalidations {
+		inv := &bug.Invalidations[i]
+		typ := BugEventInvalidated
+		if inv == last {
+			typ = invalidationEventType(bug.StatusReason)
+		}
+		event := add(typ, inv.Time, inv.Reporting, inv.Reason)
+		if inv.User != "" {
+			event.Actor, event.User = BugActorUser, inv.User
+		}
+		if inv.RevertedTime.IsZero() {
+			continue
+		}
+		event = add(BugEventReopened, inv.RevertedTime, inv.Reporting, "")
+		if inv.RevertedBy != "" {
+			event.Actor, event.User = BugActorAdmin, inv.RevertedBy
+		}
+	}
+	if !bug.Closed.IsZero() {
+		switch bug.Status {
+		case BugStatusFixed:
+			add(BugEventFixed, bug.Closed, "", fixCommitsDetails(bug.Commits))
+		case BugStatusInvalid:
+			if last == nil {
+				add(invalidationEventType(bug.StatusReason), bug.Closed, closing, string(bug.StatusReason))
+			}
+		case BugStatusDup:
+			add(BugEventDup, bug.Closed, closing, dupTitle)
+		}
+	}
+	// Consecutive subsystem changes with the same time and cause were done at once.
+	for i := 0; i < len(bug.SubsystemsHistory); {
+		first := bug.SubsystemsHistory[i]
+		var changes []string
+		for ; i < len(bug.SubsystemsHistory); i++ {
+			item := bug.SubsystemsHistory[i]
+			if !item.Time.Equal(first.Time) || item.Cause != first.Cause || item.User != first.User {
+				break
+			}
+			if item.Removed {
+				changes = append(changes, "-"+item.Subsystem)
+			} else {
+				changes = append(changes, "+"+item.Subsystem)
+			}
+		}
+		event := subsystemChangeEvent(changes, first.Time, first.Cause, first.User)
+		event.Backfilled = true
+		events = append(events, event)
+	}
+	best := ReproLevelNone
+	for _, repro := range bug.Repros {
+		if repro.Origin == ReproOriginSyzbot {
+			if repro.Level > best {
+				best = repro.Level
+				add(BugEventReproFound, repro.Created, "", strings.TrimSpace(reproStr(repro.Level)))
+			}
+			continue
+		}
+		event := add(BugEventReproFound, repro.Created, "", uploadedReproDetails(&repro))
+		event.Actor, event.User = BugActorUser, repro.User
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events
+}
+
+func uploadedReproDetails(repro *BugRepro) string {
+	return fmt.Sprintf("reproducer #%v (%v) uploaded", repro.ID, strings.TrimSpace(reproStr(repro.Level)))
+}
+
+// backfillBugTimeline adds the synthesized events to the timeline of the bug, but only
+// the ones that happened before the first recorded event. It does nothing if the timeline
+// was already backfilled. It returns the number of the added events.
+func backfillBugTimeline(c context.Context, bugKey *db.Key) (int, error) {
+	bug := new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return 0, fmt.Errorf("failed to get bug: %w", err)
+	}
+	dupTitle := ""
+	if bug.DupOf != "" {
+		dup := new(Bug)
+		if err := db.Get(c, db.NewKey(c, "Bug", bug.DupOf, 0, nil), dup); err != nil {
+			return 0, fmt.Errorf("failed to get dup bug: %w", err)
+		}
+		dupTitle = dup.displayTitle()
+	}
+	added := 0
+	tx := func(c context.Context) error {
+		added = 0
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		existing, err := loadBugEvents(c, bugKey)
+		if err != nil {
+			return err
+		}
+		var cutoff time.Time
+		for _, event := range existing {
+			if event.Backfilled {
+				return nil
+			}
+			if cutoff.IsZero() || event.Time.Before(cutoff) {
+				cutoff = event.Time
+			}
+		}
+		for _, event := range synthesizeBugEvents(bug, dupTitle) {
+			if !cutoff.IsZero() && !event.Time.Before(cutoff) {
+				continue
+			}
+			bug.recordEvent(event)
+			added++
+		}
+		if added == 0 {
+			return nil
+		}
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return saveBugEvents(c, bugKey, bug)
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+type uiBugEvent struct {
+	Time       time.Time
+	Type       BugEventType
+	Actor      BugEventActor
+	User       string
+	Cause      string
+	Reporting  string
+	Details    string
+	Backfilled bool
+}
+
+// loadBugTimelineUI returns the bug timeline as seen with the access level: the events of the more
+// restricted reportings are hidden, and so are the emails of the users for the public access.
+func loadBugTimelineUI(c context.Context, bug *Bug, accessLevel AccessLevel) ([]*uiBugEvent, error) {
+	if bug.NumEvents == 0 {
+		return nil, nil
+	}
+	events, err := loadBugEvents(c, bug.key(c))
+	if err != nil {
+		return nil, err
+	}
+	return makeBugTimelineUI(bug.Namespace, events, accessLevel), nil
+}
+
+func makeBugTimelineUI(ns string, events []*BugEvent, accessLevel AccessLevel) []*uiBugEvent {
+	var ret []*uiBugEvent
+	for _, event := range events {
+		if event.Reporting != "" {
+			reporting := config.Namespaces[ns].ReportingByName(event.Reporting)
+			if reporting != nil && reporting.AccessLevel > accessLevel {
+				continue
+			}
+		}
+		ui := &uiBugEvent{
+			Time:       event.Time,
+			Type:       event.Type,
+			Actor:      event.Actor,
+			Cause:      event.Cause,
+			Reporting:  event.Reporting,
+			Details:    event.Details,
+			Backfilled: event.Backfilled,
+		}
+		if accessLevel >= AccessUser {
+			ui.User = event.User
+		}
+		ret = append(ret, ui)
+	}
+	return ret
+}
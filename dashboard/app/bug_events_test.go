@@ -0,0 +1,211 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/stretchr/testify/assert"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestSynthesizeBugEvents(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) time.Time {
+		return t0.Add(time.Duration(days) * 24 * time.Hour)
+	}
+	bug := &Bug{
+		Status:       BugStatusInvalid,
+		StatusReason: dashapi.InvalidatedByNoActivity,
+		Closed:       at(9),
+		Reporting: []BugReporting{
+			{Name: "moderation", Reported: at(1), Closed: at(2)},
+			{Name: "dummy", Dummy: true, Reported: at(2), Closed: at(2)},
+			{Name: "public", Reported: at(2), Closed: at(9)},
+		},
+		Invalidations: []BugInvalidation{
+			{
+				Time:         at(5),
+				Reporting:    "public",
+				User:         "dev@kernel.org",
+				Reason:       "not a bug",
+				RevertedBy:   "admin@syzkaller.com",
+				RevertedTime: at(6),
+			},
+			{Time: at(9), Reporting: "public"},
+		},
+		SubsystemsHistory: []BugSubsystemChange{
+			{Time: at(0), Subsystem: "net", Cause: subsystemCauseCrash},
+			{Time: at(0), Subsystem: "fs", Cause: subsystemCauseCrash},
+			{Time: at(3), Subsystem: "fs", Removed: true, Cause: subsystemCauseUser, User: "dev@kernel.org"},
+		},
+		Repros: []BugRepro{
+			{ID: 1, Origin: ReproOriginSyzbot, Created: at(1), Level: ReproLevelSyz},
+			{ID: 2, Origin: ReproOriginSyzbot, Created: at(2), Level: ReproLevelSyz},
+			{ID: 3, Origin: ReproOriginManual, Created: at(4), Level: ReproLevelC, User: "dev@kernel.org"},
+			{ID: 4, Origin: ReproOriginSyzbot, Created: at(7), Level: ReproLevelC},
+		},
+	}
+	type event struct {
+		Type      BugEventType
+		Time      time.Time
+		Actor     BugEventActor
+		User      string
+		Reporting string
+		Details   string
+	}
+	var got []event
+	for _, e := range synthesizeBugEvents(bug, "") {
+		assert.True(t, e.Backfilled)
+		got = append(got, event{e.Type, e.Time, e.Actor, e.User, e.Reporting, e.Details})
+	}
+	assert.Equal(t, []event{
+		{BugEventLabels, at(0), BugActorSystem, "", "", "+net +fs (new crash)"},
+		{BugEventReported, at(1), BugActorSystem, "", "moderation", ""},
+		{BugEventReproFound, at(1), BugActorSystem, "", "", "syz repro"},
+		{BugEventUpstreamed, at(2), BugActorSystem, "", "moderation", ""},
+		{BugEventReported, at(2), BugActorSystem, "", "public", ""},
+		{BugEventLabels, at(3), BugActorUser, "dev@kernel.org", "", "-fs (manual command)"},
+		{BugEventReproFound, at(4), BugActorUser, "dev@kernel.org", "", "reproducer #3 (C repro) uploaded"},
+		{BugEventInvalidated, at(5), BugActorUser, "dev@kernel.org", "public", "not a bug"},
+		{BugEventReopened, at(6), BugActorAdmin, "admin@syzkaller.com", "public", ""},
+		{BugEventReproFound, at(7), BugActorSystem, "", "", "C repro"},
+		{BugEventObsoleted, at(9), BugActorSystem, "", "public", ""},
+	}, got)
+
+	// Bugs closed before the invalidations were recorded.
+	bug = &Bug{
+		Status: BugStatusDup,
+		Closed: at(3),
+		Reporting: []BugReporting{
+			{Name: "public", Reported: at(1), Closed: at(3)},
+		},
+		Commits: []string{"foo: fix bar"},
+		FixTime: at(2),
+	}
+	got = nil
+	for _, e := range synthesizeBugEvents(bug, "WARNING in foo") {
+		got = append(got, event{e.Type, e.Time, e.Actor, e.User, e.Reporting, e.Details})
+	}
+	assert.Equal(t, []event{
+		{BugEventReported, at(1), BugActorSystem, "", "public", ""},
+		{BugEventFixAttached, at(2), BugActorSystem, "", "", "foo: fix bar"},
+		{BugEventDup, at(3), BugActorSystem, "", "public", "WARNING in foo"},
+	}, got)
+}
+
+func TestBugTimeline(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	types := func(bug *Bug) []BugEventType {
+		events, err := loadBugEvents(c.ctx, bug.key(c.ctx))
+		c.expectOK(err)
+		c.expectEQ(int64(len(events)), bug.NumEvents)
+		var ret []BugEventType
+		for _, event := range events {
+			ret = append(ret, event.Type)
+		}
+		return ret
+	}
+	update := func(cmd *dashapi.BugUpdate) {
+		reply, _ := c.client.ReportingUpdate(cmd)
+		c.expectTrue(reply.OK)
+	}
+
+	// Each transition appends exactly one event.
+	crash := testCrash(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(types(bug), []BugEventType{BugEventReported})
+	c.client.updateBug(rep.ID, dashapi.BugStatusUpstream, "")
+	rep = c.client.pollBug()
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(types(bug), []BugEventType{BugEventReported, BugEventUpstreamed, BugEventReported})
+	c.client.ReportCrash(testCrashWithRepro(build, 1))
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(len(types(bug)), 4)
+	update(&dashapi.BugUpdate{
+		ID:         rep.ID,
+		Status:     dashapi.BugStatusUpdate,
+		FixCommits: []string{"foo: fix the bug"},
+		User:       "dev@kernel.org",
+		ExtID:      "<123@kernel.org>",
+	})
+	update(&dashapi.BugUpdate{
+		ID:              rep.ID,
+		Status:          dashapi.BugStatusUpdate,
+		ResetFixCommits: true,
+		User:            "dev@kernel.org",
+	})
+	// Updates that don't change anything don't add events.
+	update(&dashapi.BugUpdate{
+		ID:     rep.ID,
+		Status: dashapi.BugStatusUpdate,
+		CC:     []string{"someone@kernel.org"},
+	})
+	update(&dashapi.BugUpdate{
+		ID:            rep.ID,
+		Status:        dashapi.BugStatusInvalid,
+		User:          "dev@kernel.org",
+		InvalidReason: "not a bug",
+	})
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(types(bug), []BugEventType{BugEventReported, BugEventUpstreamed, BugEventReported,
+		BugEventReproFound, BugEventFixAttached, BugEventFixRemoved, BugEventInvalidated})
+	events, err := loadBugEvents(c.ctx, bug.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(events[3].Details, "C repro on manager1")
+	c.expectEQ(events[3].Cause, "api report_crash")
+	c.expectEQ(events[4].Actor, BugActorUser)
+	c.expectEQ(events[4].User, "dev@kernel.org")
+	c.expectEQ(events[4].Cause, "message <123@kernel.org>")
+	c.expectEQ(events[4].Details, "foo: fix the bug")
+	c.expectEQ(events[5].Details, "foo: fix the bug")
+	c.expectEQ(events[6].Reporting, "reporting2")
+	c.expectEQ(events[6].Details, "not a bug")
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?id="+bug.keyHash())
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Timeline (7)"))
+	c.expectTrue(strings.Contains(string(page), "message &lt;123@kernel.org&gt;"))
+
+	// Dups and undups.
+	c.client.ReportCrash(testCrash(build, 2))
+	rep2 := c.client.pollBug()
+	c.client.ReportCrash(testCrash(build, 3))
+	rep3 := c.client.pollBug()
+	c.client.updateBug(rep2.ID, dashapi.BugStatusDup, rep3.ID)
+	c.client.updateBug(rep2.ID, dashapi.BugStatusOpen, "")
+	bug2, _, _ := c.loadBug(rep2.ID)
+	c.expectEQ(types(bug2), []BugEventType{BugEventReported, BugEventDup, BugEventReopened})
+	events, err = loadBugEvents(c.ctx, bug2.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(events[1].Details, "title3")
+
+	// The backfill only adds the events that precede the recorded ones.
+	added, err := backfillBugTimeline(c.ctx, bug2.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(added, 0)
+	keys, err := db.NewQuery("BugEvent").Ancestor(bug2.key(c.ctx)).KeysOnly().GetAll(c.ctx, nil)
+	c.expectOK(err)
+	c.expectOK(db.DeleteMulti(c.ctx, keys))
+	added, err = backfillBugTimeline(c.ctx, bug2.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(added, 1)
+	events, err = loadBugEvents(c.ctx, bug2.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(len(events), 1)
+	c.expectEQ(events[0].Type, BugEventReported)
+	c.expectTrue(events[0].Backfilled)
+	added, err = backfillBugTimeline(c.ctx, bug2.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(added, 0)
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+// The bug list of big namespaces loads thousands of bugs, so the rendered bug groups
+// of the namespace pages are cached in memcache for bugListCacheTTL as gzipped gobs
+// (memcache items are limited to 1MB).
+// The cache key includes the access level, the filter and the bug list generation
+// of the namespace. The generation is a memcache counter bumped by invalidateBugLists
+// on the changes of the listed bug fields (new bugs, new reproducers, reporting commands, fix commits,
+// batch updates, renames, assignees, discussion summaries and disputes, reverted invalidations),
+// so such changes are visible immediately and only the crash counters lag behind.
+// On a cache miss the unfiltered lists are taken from the BugListing entities that are
+// precomputed by handleBugListings every few minutes, if they are of the current generation.
+
+const (
+	bugListCacheTTL   = 5 * time.Minute
+	bugListingMaxAge  = 30 * time.Minute
+	maxBugListingSize = 900 << 10
+)
+
+// BugListing is the precomputed unfiltered bug list of a namespace for an access level.
+type BugListing struct {
+	Namespace   string
+	AccessLevel AccessLevel
+	Generation  int64
+	Updated     time.Time
+	// Groups is the gzipped gob of []*uiBugGroup.
+	Groups []byte `datastore:",noindex"`
+}
+
+func bugListingKey(c context.Context, ns string, accessLevel AccessLevel) *db.Key {
+	return db.NewKey(c, "BugListing", fmt.Sprintf("%v-%v", ns, accessLevel), 0, nil)
+}
+
+func bugListGenerationKey(ns string) string {
+	return "bug-list-generation-" + ns
+}
+
+// bugListGeneration returns the current bug list generation of the namespace.
+// If the counter was evicted, it's restarted from the current time, so that the stale entries are not reused.
+func bugListGeneration(c context.Context, ns string) (uint64, error) {
+	return memcache.Increment(c, bugListGenerationKey(ns), 0, uint64(timeNow(c).UnixNano()))
+}
+
+// invalidateBugLists must be called after the state of the namespace bugs changes.
+func invalidateBugLists(c context.Context, ns string) {
+	_, err := memcache.Increment(c, bugListGenerationKey(ns), 1, uint64(timeNow(c).UnixNano()))
+	if err != nil {
+		log.Errorf(c, "failed to invalidate %v bug lists: %v", ns, err)
+	}
+}
+
+func bugListCacheKey(ns string, accessLevel AccessLevel, generation uint64, filter *userBugFilter) string {
+	filterHash := ""
+	if filter.Any() {
+		filterHash = hash.String([]byte(fmt.Sprintf("%+v", *filter)))
+	}
+	return fmt.Sprintf("bug-list-%v-%v-%v-%v", ns, accessLevel, generation, filterHash)
+}
+
+// cachedNamespaceBugs is the cached version of fetchNamespaceBugs.
+func cachedNamespaceBugs(c context.Context, accessLevel AccessLevel, ns string,
+	filter *userBugFilter) ([]*uiBugGroup, error) {
+	generation, err := bugListGeneration(c, ns)
+	if err != nil {
+		log.Errorf(c, "failed to get the bug list generation: %v", err)
+		return fetchNamespaceBugs(c, accessLevel, ns, filter)
+	}
+	key := bugListCacheKey(ns, accessLevel, generation, filter)
+	if item, err := memcache.Get(c, key); err == nil {
+		groups, err := decodeBugGroups(item.Value)
+		if err == nil {
+			return refreshBugGroups(c, groups), nil
+		}
+		log.Errorf(c, "failed to decode the cached bug list: %v", err)
+	} else if err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to get the cached bug list: %v", err)
+	}
+	var groups []*uiBugGroup
+	if !filter.Any() {
+		groups, err = loadBugListing(c, ns, accessLevel, generation)
+		if err != nil {
+			log.Errorf(c, "%v", err)
+		}
+	}
+	if groups == nil {
+		groups, err = fetchNamespaceBugs(c, accessLevel, ns, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := encodeBugGroups(groups)
+	if err != nil {
+		log.Errorf(c, "failed to encode the bug list: %v", err)
+		return groups, nil
+	}
+	item := &memcache.Item{
+		Key:        key,
+		Value:      data,
+		Expiration: bugListCacheTTL,
+	}
+	if err := memcache.Set(c, item); err != nil {
+		log.Errorf(c, "failed to cache the bug list: %v", err)
+	}
+	return groups, nil
+}
+
+// encodeBugGroups returns the gzipped gob of the groups.
+// It fails if the result doesn't fit into a memcache item or a BugListing entity.
+func encodeBugGroups(groups []*uiBugGroup) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	if err := gob.NewEncoder(gz).Encode(groups); err != nil {
+		return nil, fmt.Errorf("failed to encode the bug list: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > maxBugListingSize {
+		return nil, fmt.Errorf("the bug list is too large: %v bytes", buf.Len())
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeBugGroups(data []byte) ([]*uiBugGroup, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the bug list: %w", err)
+	}
+	var groups []*uiBugGroup
+	if err := gob.NewDecoder(gz).Decode(&groups); err != nil {
+		return nil, fmt.Errorf("failed to decode the bug list: %w", err)
+	}
+	return groups, nil
+}
+
+func refreshBugGroups(c context.Context, groups []*uiBugGroup) []*uiBugGroup {
+	now := timeNow(c)
+	for _, group := range groups {
+		group.Now = now
+	}
+	return groups
+}
+
+// loadBugListing returns the precomputed bug list, or nil if it's missing or stale.
+func loadBugListing(c context.Context, ns string, accessLevel AccessLevel, generation uint64) (
+	[]*uiBugGroup, error) {
+	listing := new(BugListing)
+	if err := db.Get(c, bugListingKey(c, ns, accessLevel), listing); err != nil {
+		if err == db.ErrNoSuchEntity {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get the bug listing: %w", err)
+	}
+	if listing.Generation != int64(generation) || timeSince(c, listing.Updated) > bugListingMaxAge {
+		return nil, nil
+	}
+	groups, err := decodeBugGroups(listing.Groups)
+	if err != nil {
+		return nil, err
+	}
+	return refreshBugGroups(c, groups), nil
+}
+
+// handleBugListings refreshes the precomputed bug lists (called by cron.yaml).
+func handleBugListings(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for ns, cfg := range config.Namespaces {
+		if cfg.Decommissioned {
+			continue
+		}
+		for _, accessLevel := range []AccessLevel{AccessPublic, AccessUser, AccessAdmin} {
+			if err := updateBugListing(c, ns, accessLevel); err != nil {
+				log.Errorf(c, "failed to update the %v bug listing for access %v: %v", ns, accessLevel, err)
+			}
+		}
+	}
+}
+
+func updateBugListing(c context.Context, ns string, accessLevel AccessLevel) error {
+	generation, err := bugListGeneration(c, ns)
+	if err != nil {
+		return err
+	}
+	key := bugListingKey(c, ns, accessLevel)
+	listing := new(BugListing)
+	if err := db.Get(c, key, listing); err != nil && err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to get the bug listing: %w", err)
+	}
+	now := timeNow(c)
+	if listing.Generation == int64(generation) && now.Sub(listing.Updated) < bugListingMaxAge/2 {
+		return nil
+	}
+	groups, err := fetchNamespaceBugs(c, accessLevel, ns, &userBugFilter{})
+	if err != nil {
+		return err
+	}
+	data, err := encodeBugGroups(groups)
+	if err != nil {
+		return err
+	}
+	*listing = BugListing{
+		Namespace:   ns,
+		AccessLevel: accessLevel,
+		Generation:  int64(generation),
+		Updated:     now,
+		Groups:      data,
+	}
+	if _, err := db.Put(c, key, listing); err != nil {
+		return fmt.Errorf("failed to put the bug listing: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestBugListCacheKey(t *testing.T) {
+	keys := map[string]bool{}
+	for _, accessLevel := range []AccessLevel{AccessPublic, AccessUser, AccessAdmin} {
+		for _, filter := range []*userBugFilter{
+			{},
+			{Subsystem: "mm"},
+			{Subsystem: "net"},
+			{Manager: "mm"},
+			{ReproRevoked: true},
+		} {
+			key := bugListCacheKey("ns", accessLevel, 1, filter)
+			if keys[key] {
+				t.Fatalf("duplicate key %q for access %v, filter %+v", key, accessLevel, filter)
+			}
+			keys[key] = true
+		}
+	}
+	filter := &userBugFilter{}
+	if bugListCacheKey("ns", AccessUser, 1, filter) == bugListCacheKey("ns", AccessUser, 2, filter) {
+		t.Fatalf("the generation is not part of the key")
+	}
+}
+
+func TestBugListCache(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	const seeded = 50
+	for i := 0; i < seeded; i++ {
+		c.client.ReportCrash(testCrash(build, i))
+	}
+	// Only a few bugs fit into the daily reporting limit, but all of them are listed.
+	reports := c.client.pollBugs(3)
+
+	render := func() ([]byte, time.Duration) {
+		start := time.Now()
+		page, err := c.AuthGET(AccessAdmin, "/test1")
+		c.expectOK(err)
+		return page, time.Since(start)
+	}
+	contains := func(page []byte, title string) bool {
+		return bytes.Contains(page, []byte(">"+title+"</a>"))
+	}
+	cold, coldTime := render()
+	cached, cachedTime := render()
+	t.Logf("%v bugs: cold render %v, cached render %v", seeded, coldTime, cachedTime)
+	for i := 0; i < seeded; i++ {
+		title := fmt.Sprintf("title%v", i)
+		c.expectTrue(contains(cold, title))
+		c.expectTrue(contains(cached, title))
+	}
+
+	// Bug state transitions invalidate the cache.
+	c.client.updateBug(reports[0].ID, dashapi.BugStatusInvalid, "")
+	page, _ := render()
+	c.expectTrue(!contains(page, reports[0].Title))
+	c.expectTrue(contains(page, reports[1].Title))
+
+	// The precomputed listing is used only while it's of the current generation.
+	_, err := c.GET("/cron/bug_listings")
+	c.expectOK(err)
+	generation, err := bugListGeneration(c.ctx, "test1")
+	c.expectOK(err)
+	groups, err := loadBugListing(c.ctx, "test1", AccessAdmin, generation)
+	c.expectOK(err)
+	c.expectNE(groups, nil)
+	listed := 0
+	for _, group := range groups {
+		listed += len(group.Bugs)
+	}
+	c.expectEQ(listed, seeded-1)
+	c.client.updateBug(reports[1].ID, dashapi.BugStatusInvalid, "")
+	generation, err = bugListGeneration(c.ctx, "test1")
+	c.expectOK(err)
+	groups, err = loadBugListing(c.ctx, "test1", AccessAdmin, generation)
+	c.expectOK(err)
+	c.expectEQ(groups, []*uiBugGroup(nil))
+	page, _ = render()
+	c.expectTrue(!contains(page, reports[1].Title))
+
+	// Other changes of the listed fields invalidate the lists as well.
+	expectInvalidated := func(what string, change func()) {
+		t.Helper()
+		before, err := bugListGeneration(c.ctx, "test1")
+		c.expectOK(err)
+		change()
+		after, err := bugListGeneration(c.ctx, "test1")
+		c.expectOK(err)
+		if before == after {
+			t.Fatalf("%v did not invalidate the bug lists", what)
+		}
+	}
+	_, bugKey, err := findBugByReportingID(c.ctx, reports[2].ID)
+	c.expectOK(err)
+	expectInvalidated("rename", func() {
+		c.expectOK(renameBug(c.ctx, bugKey, "renamed title", "admin@foo.com"))
+	})
+	page, _ = render()
+	c.expectTrue(contains(page, "renamed title"))
+	expectInvalidated("assignment", func() {
+		c.expectOK(updateBugAssignee(c.ctx, bugKey, "dev@kernel.org"))
+	})
+	expectInvalidated("dispute clearing", func() {
+		c.expectOK(clearBugDispute(c.ctx, bugKey))
+	})
+	expectInvalidated("discussion summary refresh", func() {
+		c.expectOK(refreshBugDiscussionInfo(c.ctx, bugKey))
+	})
+}
+
+func TestBugGroupsEncoding(t *testing.T) {
+	groups := makeBenchmarkBugGroups(5000)
+	data, err := encodeBugGroups(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%v bugs: %v bytes", len(groups[0].Bugs), len(data))
+	decoded, err := decodeBugGroups(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(groups, decoded); diff != "" {
+		t.Fatal(diff)
+	}
+	if _, err := encodeBugGroups(makeBenchmarkBugGroups(100000)); err == nil {
+		t.Fatalf("too large bug list was encoded")
+	}
+}
+
+func BenchmarkBugGroupsEncoding(b *testing.B) {
+	groups := makeBenchmarkBugGroups(5000)
+	data, err := encodeBugGroups(groups)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("encode", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := encodeBugGroups(groups); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("decode", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := decodeBugGroups(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func makeBenchmarkBugGroups(count int) []*uiBugGroup {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	group := &uiBugGroup{
+		Caption:   "open",
+		Namespace: "ns",
+	}
+	for i := 0; i < count; i++ {
+		group.Bugs = append(group.Bugs, &uiBug{
+			Namespace:  "ns",
+			Title:      fmt.Sprintf("KASAN: use-after-free Read in function_%v", i),
+			NumCrashes: int64(i),
+			FirstTime:  now.Add(-time.Duration(i) * time.Hour),
+			LastTime:   now,
+			ReproLevel: dashapi.ReproLevelC,
+			Status:     "open",
+			Link:       fmt.Sprintf("/bug?extid=%040x", i),
+		})
+	}
+	return []*uiBugGroup{group}
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// When report parsing improves, the crashes of existing bugs start to get better titles.
+// Admins may rename such bugs. The bug key is still derived from the original title (KeyTitle),
+// so all references to the bug stay valid. The former titles are remembered: new crashes
+// with the old titles are still attached to the bug, links and dups by the old titles are
+// resolved to the renamed bug and the reporting threads are notified about the new title.
+
+func handleRenameBug(c context.Context, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	if err := renameBug(c, bug.key(c), strings.TrimSpace(r.FormValue("title")), author); err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+func renameBug(c context.Context, bugKey *db.Key, title, author string) error {
+	if title == "" || len(title) > MaxStringLen || strings.ContainsAny(title, "\n\r") {
+		return fmt.Errorf("bad bug title %q: %w", title, ErrClientBadRequest)
+	}
+	bug := new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return fmt.Errorf("failed to get bug: %w", err)
+	}
+	if bug.Title == title {
+		return nil
+	}
+	// There must be only one bug with the given display title,
+	// so we don't let a bug take the title of another one.
+	existing, err := db.NewQuery("Bug").
+		Filter("Namespace=", bug.Namespace).
+		Filter("Title=", title).
+		KeysOnly().
+		Limit(1).
+		GetAll(c, nil)
+	if err != nil {
+		return fmt.Errorf("failed to query bugs: %w", err)
+	}
+	if len(existing) != 0 {
+		return fmt.Errorf("a bug titled %q already exists: %w", title, ErrClientBadRequest)
+	}
+	var from string
+	now := timeNow(c)
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		from = bug.Title
+		bug.rename(title, author, now)
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	invalidateBugLists(c, bug.Namespace)
+	log.Infof(c, "bug %v: renamed from %q to %q by %v", bugKey.StringID(), from, title, author)
+	return nil
+}
+
+func (bug *Bug) rename(title, author string, now time.Time) {
+	if bug.KeyTitle == "" {
+		bug.KeyTitle = bug.Title
+	}
+	bug.Renames = append(bug.Renames, BugRename{
+		From: bug.Title,
+		To:   title,
+		User: author,
+		Time: now,
+	})
+	var former []string
+	for _, t := range mergeString(bug.FormerTitles, bug.Title) {
+		if t != title {
+			former = append(former, t)
+		}
+	}
+	bug.FormerTitles = former
+	bug.Title = title
+	// New crashes with both the old and the new titles are merged into the bug.
+	bug.MergedTitles = mergeString(bug.MergedTitles, title)
+	bug.AltTitles = mergeString(bug.AltTitles, title)
+}
+
+func (bug *Bug) lastRename() *BugRename {
+	if len(bug.Renames) == 0 {
+		return nil
+	}
+	return &bug.Renames[len(bug.Renames)-1]
+}
+
+// needsRenameNotification checks whether the bug was renamed after it was reported
+// and the reporting was not notified about it yet.
+func (bug *Bug) needsRenameNotification(bugReporting *BugReporting) bool {
+	rename := bug.lastRename()
+	return rename != nil &&
+		rename.Time.After(bugReporting.Reported) &&
+		bugReporting.RenameNotified.Before(rename.Time)
+}
+
+// renamedBugSeq returns the first Seq that a new bug with the title may use.
+// The keys of renamed bugs are derived from their original titles, so the Seq
+// of a renamed bug with the same title needs to be skipped explicitly.
+func renamedBugSeq(c context.Context, ns, title string) (int64, error) {
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("Title=", title).
+		GetAll(c, &bugs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	seq := int64(0)
+	for _, bug := range bugs {
+		if bug.KeyTitle != "" && bug.Seq >= seq {
+			seq = bug.Seq + 1
+		}
+	}
+	return seq, nil
+}
+
+// findRenamedBug looks up a bug that has or had the title (with the given Seq) after a rename.
+func findRenamedBug(c context.Context, ns, title string, seq int64) (*Bug, *db.Key, error) {
+	for _, field := range []string{"Title=", "FormerTitles="} {
+		var bugs []*Bug
+		keys, err := db.NewQuery("Bug").
+			Filter("Namespace=", ns).
+			Filter(field, title).
+			Filter("Seq=", seq).
+			GetAll(c, &bugs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query bugs: %w", err)
+		}
+		if len(bugs) != 0 {
+			return bugs[0], keys[0], nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// uiBugRename describes the former titles of the bug and the rename form for the bug page.
+type uiBugRename struct {
+	BugID        string
+	Title        string
+	FormerTitles []string
+	CanRename    bool
+}
+
+func makeBugRenameUI(bug *Bug, accessLevel AccessLevel) *uiBugRename {
+	if len(bug.FormerTitles) == 0 && accessLevel < AccessAdmin {
+		return nil
+	}
+	return &uiBugRename{
+		BugID:        bug.keyHash(),
+		Title:        bug.Title,
+		FormerTitles: bug.FormerTitles,
+		CanRename:    accessLevel >= AccessAdmin,
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestBugRename(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+	bug, _, _ := c.loadBug(rep.ID)
+	bugID := bug.keyHash()
+
+	// Only admins can rename bugs.
+	renameURL := "/admin?action=rename_bug&id=" + bugID + "&title=" + url.QueryEscape("new title1")
+	_, err := c.AuthGET(AccessUser, renameURL)
+	c.expectFailureStatus(err, http.StatusForbidden)
+	checkRedirect(c, AccessAdmin, renameURL, bugLink(bugID), http.StatusFound)
+
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.Title, "new title1")
+	c.expectEQ(bug.FormerTitles, []string{"title1"})
+	c.expectEQ(bug.keyHash(), bugID)
+	c.expectEQ(len(bug.Renames), 1)
+	c.expectEQ(bug.Renames[0].User, "user@syzkaller.com")
+
+	// The reporting is notified about the new title.
+	notifs := c.client.pollNotifs(1)
+	c.expectEQ(notifs[0].Type, dashapi.BugNotifRenamed)
+	c.expectEQ(notifs[0].Title, "new title1")
+	c.expectEQ(notifs[0].Text, "title1")
+	reply, _ := c.client.ReportingUpdate(&dashapi.BugUpdate{
+		ID:           rep.ID,
+		Status:       dashapi.BugStatusOpen,
+		Notification: true,
+	})
+	c.expectEQ(reply.OK, true)
+	c.client.pollNotifs(0)
+
+	// New crashes with both the old and the new title are attached to the renamed bug.
+	c.client.ReportCrash(crash)
+	crash2 := testCrash(build, 1)
+	crash2.Title = "new title1"
+	c.client.ReportCrash(crash2)
+	c.client.pollBugs(0)
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.NumCrashes, int64(3))
+
+	// Links and dups by the old title lead to the renamed bug.
+	checkRedirect(c, AccessUser, "/bug?ns=test1&title="+url.QueryEscape("title1"),
+		bugLink(bugID), http.StatusFound)
+	dup, _, err := findDupByTitle(c.ctx, "test1", "new title1")
+	c.expectOK(err)
+	c.expectEQ(dup.keyHash(), bugID)
+
+	page, err := c.AuthGET(AccessUser, bugLink(bugID))
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Formerly known as: <i>title1</i>")))
+	c.expectTrue(!bytes.Contains(page, []byte("rename_bug")))
+
+	// A bug can't take the title of another bug.
+	c.client.ReportCrash(testCrash(build, 2))
+	c.client.pollBug()
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=rename_bug&id="+bugID+"&title=title2")
+	c.expectBadReqest(err)
+
+	// Once the renamed bug is closed, the new crashes create a new bug with a new display title.
+	c.client.updateBug(rep.ID, dashapi.BugStatusInvalid, "")
+	c.client.ReportCrash(crash2)
+	rep2 := c.client.pollBug()
+	c.expectEQ(rep2.Title, "new title1 (2)")
+}
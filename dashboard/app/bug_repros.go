@@ -0,0 +1,500 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	"github.com/google/syzkaller/sys/targets"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Bug.Repros lists all reproducers of the bug. Syzbot repros are added when a crash with
+// a reproducer is saved, a new one supersedes the older syzbot repros for the same arch that
+// are not better than it. Developers may upload their own reproducers on the bug page or with
+// "#syz set repro" and an attached file, such repros are never superseded automatically.
+// A syzbot repro becomes broken once the repro retest jobs revoke its crash, and active again
+// if it starts working again. "#syz test: repo branch repro=N" runs the patch testing job
+// with the given reproducer (Job.ReproID for the uploaded ones).
+
+const (
+	maxUploadedReproLen = 256 << 10
+	// The options for the uploaded syz repros that don't have the options line.
+	defaultUploadedReproOpts = `{"repeat":true,"procs":1,"slowdown":1,"sandbox":"none"}`
+)
+
+// addRepro appends the new reproducer to the bug and returns it.
+func (bug *Bug) addRepro(repro BugRepro) *BugRepro {
+	repro.ID = int64(len(bug.Repros)) + 1
+	repro.Status = ReproStatusActive
+	repro.StatusTime = repro.Created
+	if repro.Origin == ReproOriginSyzbot {
+		for i := range bug.Repros {
+			old := &bug.Repros[i]
+			if old.Origin == ReproOriginSyzbot && old.Status == ReproStatusActive &&
+				old.Arch == repro.Arch && old.Level <= repro.Level {
+				old.Status = ReproStatusSuperseded
+				old.StatusTime = repro.Created
+			}
+		}
+	}
+	bug.Repros = append(bug.Repros, repro)
+	return &bug.Repros[len(bug.Repros)-1]
+}
+
+func (bug *Bug) reproByID(id int64) *BugRepro {
+	for i := range bug.Repros {
+		if bug.Repros[i].ID == id {
+			return &bug.Repros[i]
+		}
+	}
+	return nil
+}
+
+// hasReproCrash says whether the crash holds one of the syzbot reproducers of the bug,
+// such crashes are not purged.
+func (bug *Bug) hasReproCrash(crashID int64) bool {
+	for _, repro := range bug.Repros {
+		if repro.Origin == ReproOriginSyzbot && repro.CrashID == crashID {
+			return true
+		}
+	}
+	return false
+}
+
+// updateReproRetest reflects the result of a repro retest of the crash in the syzbot reproducers.
+func (bug *Bug) updateReproRetest(crashID int64, revoked bool, now time.Time) {
+	for i := range bug.Repros {
+		repro := &bug.Repros[i]
+		if repro.Origin != ReproOriginSyzbot || repro.CrashID != crashID {
+			continue
+		}
+		if revoked && repro.Status == ReproStatusActive {
+			repro.Status = ReproStatusBroken
+			repro.StatusTime = now
+		} else if !revoked && repro.Status == ReproStatusBroken {
+			repro.Status = ReproStatusActive
+			repro.StatusTime = now
+		}
+	}
+}
+
+// selectRepro returns the reproducer a test job has to use. If id is 0, it's nil unless the crash
+// has no reproducer of its own, in such case it's the latest active uploaded reproducer, if any.
+func (bug *Bug) selectRepro(id int64, crash *Crash) (*BugRepro, error) {
+	if id == 0 {
+		if crash.ReproSyz != 0 || crash.ReproC != 0 {
+			return nil, nil
+		}
+		for i := len(bug.Repros) - 1; i >= 0; i-- {
+			if repro := &bug.Repros[i]; repro.Origin == ReproOriginManual && repro.Status == ReproStatusActive {
+				return repro, nil
+			}
+		}
+		return nil, nil
+	}
+	repro := bug.reproByID(id)
+	if repro == nil {
+		return nil, &BadTestRequestError{fmt.Sprintf("The bug has no reproducer #%v.", id)}
+	}
+	if repro.Status == ReproStatusBroken {
+		return nil, &BadTestRequestError{fmt.Sprintf("Reproducer #%v no longer triggers the bug.", id)}
+	}
+	return repro, nil
+}
+
+var testReproArgRe = regexp.MustCompile(`^repro=([0-9]+)$`)
+
+// extractTestRepro removes the "repro=N" argument from the test command arguments.
+func extractTestRepro(args []string) ([]string, int64) {
+	if len(args) == 0 {
+		return args, 0
+	}
+	match := testReproArgRe.FindStringSubmatch(args[len(args)-1])
+	if match == nil {
+		return args, 0
+	}
+	id, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return args, 0
+	}
+	return args[:len(args)-1], id
+}
+
+var (
+	syzCallRe    = regexp.MustCompile(`^(?:r[0-9]+ = )?[a-zA-Z][a-zA-Z0-9_$]*\(.*\)$`)
+	syzReproOpts = regexp.MustCompile(`(?m)^#\s*(\{.*\})\s*$`)
+	cMainRe      = regexp.MustCompile(`\bmain\s*\(`)
+)
+
+// newUploadedRepro checks the reproducer uploaded by a developer and prepares its Bug.Repros entry.
+// The arch defaults to the arch of the build. The returned error is meant for the developer.
+func newUploadedRepro(build *Build, name, arch string, data []byte) (*BugRepro, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("the reproducer is empty")
+	}
+	if len(data) > maxUploadedReproLen {
+		return nil, fmt.Errorf("the reproducer is too large (%v bytes), the limit is %v bytes",
+			len(data), maxUploadedReproLen)
+	}
+	if arch == "" {
+		arch = build.Arch
+	}
+	if targets.List[build.OS][arch] == nil {
+		return nil, fmt.Errorf("unknown arch %q", arch)
+	}
+	repro := &BugRepro{
+		Origin: ReproOriginManual,
+		Arch:   arch,
+	}
+	if strings.HasSuffix(name, ".c") || (!strings.HasSuffix(name, ".syz") &&
+		strings.Contains(string(data), "#include")) {
+		if !cMainRe.Match(data) {
+			return nil, fmt.Errorf("the C reproducer has no main function")
+		}
+		repro.Level = ReproLevelC
+		return repro, nil
+	}
+	if err := checkSyzProgram(data); err != nil {
+		return nil, fmt.Errorf("the syz reproducer does not parse: %v", err)
+	}
+	repro.Level = ReproLevelSyz
+	repro.ReproOpts = []byte(defaultUploadedReproOpts)
+	if match := syzReproOpts.FindSubmatch(data); match != nil {
+		repro.ReproOpts = match[1]
+	}
+	return repro, nil
+}
+
+// checkSyzProgram does a syntax check of a syz program. A complete check needs the syscall
+// descriptions, which the dashboard does not link in, so syz-ci checks the program once again
+// when it runs a job (see repro_migration.go).
+func checkSyzProgram(data []byte) error {
+	calls := 0
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if !syzCallRe.MatchString(line) {
+			if len(line) > 40 {
+				line = line[:40] + "..."
+			}
+			return fmt.Errorf("line %v: %q is not a call", i+1, line)
+		}
+		if err := checkSyzBrackets(line); err != nil {
+			return fmt.Errorf("line %v: %v", i+1, err)
+		}
+		calls++
+	}
+	if calls == 0 {
+		return fmt.Errorf("no calls")
+	}
+	return nil
+}
+
+func checkSyzBrackets(line string) error {
+	var stack []byte
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		if quote != 0 {
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"':
+			quote = ch
+		case '(', '[', '{':
+			stack = append(stack, ch)
+		case ')', ']', '}':
+			open := map[byte]byte{')': '(', ']': '[', '}': '{'}[ch]
+			if len(stack) == 0 || stack[len(stack)-1] != open {
+				return fmt.Errorf("unbalanced %q at column %v", ch, i+1)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if quote != 0 {
+		return fmt.Errorf("unterminated string")
+	}
+	if len(stack) != 0 {
+		return fmt.Errorf("unclosed %q", stack[len(stack)-1])
+	}
+	return nil
+}
+
+// reproBuild returns the build the uploaded reproducers of the bug are checked against.
+func reproBuild(c context.Context, bug *Bug) (*Build, error) {
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return nil, err
+	}
+	return loadBuild(c, bug.Namespace, crash.BuildID)
+}
+
+// saveUploadedRepro stores the reproducer prepared by newUploadedRepro and adds it to the bug.
+func saveUploadedRepro(c context.Context, bugKey *db.Key, ns string, repro *BugRepro, data []byte,
+	author, cause string) (*BugRepro, error) {
+	tag := textReproSyz
+	if repro.Level == ReproLevelC {
+		tag = textReproC
+	}
+	textID, err := putText(c, ns, tag, data, false)
+	if err != nil {
+		return nil, err
+	}
+	if tag == textReproC {
+		repro.ReproC = textID
+	} else {
+		repro.ReproSyz = textID
+	}
+	repro.User = author
+	repro.Created = timeNow(c)
+	var added BugRepro
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		added = *bug.addRepro(*repro)
+		bug.LastActivity = repro.Created
+		bug.recordEvent(BugEvent{
+			Type:    BugEventReproFound,
+			Time:    repro.Created,
+			Actor:   BugActorUser,
+			User:    author,
+			Cause:   cause,
+			Details: uploadedReproDetails(&added),
+		})
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return saveBugEvents(c, bugKey, bug)
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		if err := db.Delete(c, db.NewKey(c, tag, "", textID, nil)); err != nil {
+			log.Errorf(c, "failed to delete the uploaded repro: %v", err)
+		}
+		return nil, err
+	}
+	return &added, nil
+}
+
+// loadJobRepro returns the uploaded reproducer a job runs.
+func loadJobRepro(c context.Context, job *Job, bugKey *db.Key) (reproSyz, reproC, reproOpts []byte, err error) {
+	bug := new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get bug: %w", err)
+	}
+	repro := bug.reproByID(job.ReproID)
+	if repro == nil {
+		return nil, nil, nil, fmt.Errorf("bug %v has no repro %v", bugKey.StringID(), job.ReproID)
+	}
+	if reproSyz, _, err = getText(c, textReproSyz, repro.ReproSyz); err != nil {
+		return nil, nil, nil, err
+	}
+	if reproC, _, err = getText(c, textReproC, repro.ReproC); err != nil {
+		return nil, nil, nil, err
+	}
+	return reproSyz, reproC, repro.ReproOpts, nil
+}
+
+// checkUploadedReproAccess is checkCrashTextAccess for the uploaded reproducers,
+// they are only referenced from Bug.Repros.
+func checkUploadedReproAccess(c context.Context, r *http.Request, field string, id int64) (
+	*Bug, *Crash, *db.Key, error) {
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Repros."+field+"=", id).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	if len(bugs) != 1 {
+		err := fmt.Errorf("checkUploadedReproAccess: found %v bugs for %v=%v", len(bugs), field, id)
+		if len(bugs) == 0 {
+			err = fmt.Errorf("%v: %w", err, ErrClientNotFound)
+		}
+		return nil, nil, nil, err
+	}
+	bug := bugs[0]
+	bugLevel := bug.sanitizeAccess(namespaceAccessLevel(c, r, bug.Namespace))
+	return bug, nil, nil, checkNamespaceAccessLevel(c, r, bug.Namespace, bugLevel)
+}
+
+// handleBugRepros uploads a reproducer from the bug page.
+func handleBugRepros(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
+	if accessLevel < AccessUser {
+		return ErrAccess
+	}
+	if err := checkNamespaceAccessLevel(c, r, bug.Namespace, bug.sanitizeAccess(accessLevel)); err != nil {
+		return err
+	}
+	u := user.Current(c)
+	if u == nil {
+		return ErrAccess
+	}
+	if action := r.FormValue("action"); action != "upload" {
+		return fmt.Errorf("unknown action %q: %w", action, ErrClientBadRequest)
+	}
+	if bug.Status != BugStatusOpen {
+		return fmt.Errorf("the bug is closed: %w", ErrClientBadRequest)
+	}
+	build, err := reproBuild(c, bug)
+	if err != nil {
+		return err
+	}
+	data := []byte(strings.ReplaceAll(r.FormValue("repro"), "\r\n", "\n"))
+	repro, err := newUploadedRepro(build, r.FormValue("name"), strings.TrimSpace(r.FormValue("arch")), data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrClientBadRequest, err)
+	}
+	if _, err := saveUploadedRepro(c, bug.key(c), bug.Namespace, repro, data, u.Email,
+		eventCause(causePage, "/repros")); err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+// handleSetReproCommand uploads the reproducer attached to a "#syz set repro [arch]" email.
+func handleSetReproCommand(c context.Context, info *bugInfoResult, msg *email.Email, arch string) error {
+	bugID := info.bugReporting.ID
+	if info.bug.sanitizeAccess(AccessPublic) != AccessPublic {
+		log.Warningf(c, "%v: bug is not AccessPublic, repro upload is denied", info.bug.Title)
+		return nil
+	}
+	if info.bug.Status != BugStatusOpen {
+		return replyTo(c, msg, bugID, "The bug is already closed.")
+	}
+	if len(msg.Attachments) == 0 {
+		reply := "Please attach the reproducer (a syz program or a C program) to the email."
+		if len(msg.Oversized) != 0 {
+			reply = fmt.Sprintf("The attached %q is too large (%v bytes), the limit is %v bytes.",
+				msg.Oversized[0].Name, msg.Oversized[0].Size, maxUploadedReproLen)
+		}
+		return replyTo(c, msg, bugID, reply)
+	}
+	build, err := reproBuild(c, info.bug)
+	if err != nil {
+		return err
+	}
+	attachment := msg.Attachments[0]
+	repro, err := newUploadedRepro(build, attachment.Name, arch, attachment.Data)
+	if err != nil {
+		return replyTo(c, msg, bugID, fmt.Sprintf("I could not accept the reproducer: %v.", err))
+	}
+	// All the replies below will only be sent to the initiator and the mailing list.
+	msg.Cc = []string{info.reporting.Config.(*EmailConfig).Email}
+	repro, err = saveUploadedRepro(c, info.bugKey, info.bug.Namespace, repro, attachment.Data, msg.Author,
+		eventCause(causeMessage, msg.MessageID))
+	if err != nil {
+		log.Errorf(c, "failed to save the uploaded repro: %v", err)
+		return replyTo(c, msg, bugID, "I've failed to save the reproducer due to an internal error.\n")
+	}
+	return replyTo(c, msg, bugID, fmt.Sprintf("Thank you!\n\nThe reproducer is added to the bug as #%v.\n"+
+		"Patches can be tested with it using \"#syz test: <repo> <branch> repro=%v\".", repro.ID, repro.ID))
+}
+
+type uiBugRepros struct {
+	BugID     string
+	Repros    []*uiBugRepro
+	CanUpload bool
+}
+
+type uiBugRepro struct {
+	ID         int64
+	Origin     ReproOrigin
+	User       string
+	Created    time.Time
+	Arch       string
+	Status     ReproStatus
+	StatusTime time.Time
+	// StatusChanged is set if the repro is no longer in its initial status.
+	StatusChanged bool
+	ReproSyzLink  string
+	ReproCLink    string
+	Reliability   *uiReproReliability
+}
+
+func makeBugReprosUI(c context.Context, bug *Bug, accessLevel AccessLevel) (*uiBugRepros, error) {
+	ui := &uiBugRepros{
+		BugID:     bug.keyHash(),
+		CanUpload: accessLevel >= AccessUser && bug.Status == BugStatusOpen,
+	}
+	if len(bug.Repros) == 0 && !ui.CanUpload {
+		return nil, nil
+	}
+	// The reliability of the syzbot repros is measured on their crashes (see repro_reliability.go).
+	var keys []*db.Key
+	for _, repro := range bug.Repros {
+		if repro.Origin == ReproOriginSyzbot {
+			keys = append(keys, db.NewKey(c, "Crash", "", repro.CrashID, bug.key(c)))
+		}
+	}
+	crashes := make([]*Crash, len(keys))
+	for i := range crashes {
+		crashes[i] = new(Crash)
+	}
+	if err := db.GetMulti(c, keys, crashes); err != nil {
+		var merr appengine.MultiError
+		if !errors.As(err, &merr) {
+			return nil, fmt.Errorf("failed to get repro crashes: %w", err)
+		}
+		for i, err := range merr {
+			if err == db.ErrNoSuchEntity {
+				crashes[i] = nil
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to get repro crashes: %w", err)
+			}
+		}
+	}
+	crashByID := map[int64]*Crash{}
+	for i, crash := range crashes {
+		if crash != nil {
+			crashByID[keys[i].IntID()] = crash
+		}
+	}
+	// Newest first.
+	for i := len(bug.Repros) - 1; i >= 0; i-- {
+		repro := bug.Repros[i]
+		item := &uiBugRepro{
+			ID:            repro.ID,
+			Origin:        repro.Origin,
+			User:          repro.User,
+			Created:       repro.Created,
+			Arch:          repro.Arch,
+			Status:        repro.Status,
+			StatusTime:    repro.StatusTime,
+			StatusChanged: !repro.StatusTime.Equal(repro.Created),
+			ReproSyzLink:  textLink(textReproSyz, repro.ReproSyz),
+			ReproCLink:    textLink(textReproC, repro.ReproC),
+		}
+		if crash := crashByID[repro.CrashID]; repro.Origin == ReproOriginSyzbot && crash != nil {
+			item.Reliability = makeReproReliabilityUI(crash)
+		}
+		ui.Repros = append(ui.Repros, item)
+	}
+	return ui, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBugReproLifecycle(t *testing.T) {
+	now := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	bug := &Bug{}
+	syzbot := func(crashID int64, arch string, level dashapi.ReproLevel) *BugRepro {
+		return bug.addRepro(BugRepro{
+			Origin:  ReproOriginSyzbot,
+			Created: now,
+			CrashID: crashID,
+			Arch:    arch,
+			Level:   level,
+		})
+	}
+	statuses := func() []ReproStatus {
+		var ret []ReproStatus
+		for _, repro := range bug.Repros {
+			ret = append(ret, repro.Status)
+		}
+		return ret
+	}
+	assert.Equal(t, int64(1), syzbot(1, targets.AMD64, ReproLevelC).ID)
+	// A worse repro does not supersede a better one, other arches are not affected.
+	syzbot(2, targets.AMD64, ReproLevelSyz)
+	syzbot(3, targets.ARM64, ReproLevelSyz)
+	assert.Equal(t, []ReproStatus{ReproStatusActive, ReproStatusActive, ReproStatusActive}, statuses())
+	now = now.Add(time.Hour)
+	syzbot(4, targets.AMD64, ReproLevelC)
+	assert.Equal(t, []ReproStatus{ReproStatusSuperseded, ReproStatusSuperseded, ReproStatusActive,
+		ReproStatusActive}, statuses())
+	assert.Equal(t, now, bug.Repros[0].StatusTime)
+	// Uploaded repros don't supersede anything.
+	manual := bug.addRepro(BugRepro{Origin: ReproOriginManual, Created: now, Arch: targets.AMD64,
+		Level: ReproLevelC})
+	assert.Equal(t, int64(5), manual.ID)
+	assert.Equal(t, ReproStatusActive, bug.Repros[3].Status)
+	assert.True(t, bug.hasReproCrash(2))
+	assert.False(t, bug.hasReproCrash(5))
+
+	// Retests break and restore the repros, but don't revive the superseded ones.
+	bug.updateReproRetest(4, true, now)
+	bug.updateReproRetest(1, true, now)
+	assert.Equal(t, ReproStatusBroken, bug.Repros[3].Status)
+	assert.Equal(t, ReproStatusSuperseded, bug.Repros[0].Status)
+	bug.updateReproRetest(1, false, now)
+	assert.Equal(t, ReproStatusSuperseded, bug.Repros[0].Status)
+
+	// Selection.
+	withRepro := &Crash{ReproSyz: 1}
+	repro, err := bug.selectRepro(0, withRepro)
+	assert.NoError(t, err)
+	assert.Nil(t, repro)
+	repro, err = bug.selectRepro(0, &Crash{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), repro.ID)
+	repro, err = bug.selectRepro(2, withRepro)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), repro.CrashID)
+	_, err = bug.selectRepro(4, withRepro)
+	assert.EqualError(t, err, "Reproducer #4 no longer triggers the bug.")
+	_, err = bug.selectRepro(6, withRepro)
+	assert.EqualError(t, err, "The bug has no reproducer #6.")
+
+	args, id := extractTestRepro([]string{"git://repo", "branch", "repro=12"})
+	assert.Equal(t, []string{"git://repo", "branch"}, args)
+	assert.Equal(t, int64(12), id)
+	args, id = extractTestRepro([]string{"git://repo", "branch"})
+	assert.Equal(t, []string{"git://repo", "branch"}, args)
+	assert.Equal(t, int64(0), id)
+}
+
+func TestUploadedReproValidation(t *testing.T) {
+	build := &Build{OS: targets.Linux, Arch: targets.AMD64}
+	tests := []struct {
+		name  string
+		arch  string
+		data  string
+		err   string
+		level dashapi.ReproLevel
+		opts  string
+	}{
+		{
+			data:  "r0 = openat(0xffffffffffffff9c, &(0x7f0000000000)='./file0\\x00', 0x42, 0x0)\nclose(r0)\n",
+			level: ReproLevelSyz,
+			opts:  defaultUploadedReproOpts,
+		},
+		{
+			name:  "repro.syz",
+			arch:  targets.ARM64,
+			data:  "# https://syzkaller.appspot.com/bug?id=123\n#{\"threaded\":true}\nsyncfs(0x0) (async)\n",
+			level: ReproLevelSyz,
+			opts:  `{"threaded":true}`,
+		},
+		{
+			data:  "#include <unistd.h>\n\nint main(void)\n{\n\tsyncfs(0);\n\treturn 0;\n}\n",
+			level: ReproLevelC,
+		},
+		{
+			name:  "repro.c",
+			data:  "int main() { return 0; }",
+			level: ReproLevelC,
+		},
+		{
+			data: "",
+			err:  "the reproducer is empty",
+		},
+		{
+			data: strings.Repeat("syncfs(0x0)\n", maxUploadedReproLen/12+1),
+			err:  "the reproducer is too large (262152 bytes), the limit is 262144 bytes",
+		},
+		{
+			arch: "pdp11",
+			data: "syncfs(0x0)\n",
+			err:  `unknown arch "pdp11"`,
+		},
+		{
+			name: "repro.c",
+			data: "syncfs(0x0)\n",
+			err:  "the C reproducer has no main function",
+		},
+		{
+			data: "# only comments\n",
+			err:  "the syz reproducer does not parse: no calls",
+		},
+		{
+			data: "syncfs(0x0)\nthis is not a program\n",
+			err:  `the syz reproducer does not parse: line 2: "this is not a program" is not a call`,
+		},
+		{
+			data: "write(0x0, &(0x7f0000000000)=\"0102\", 0x2]\n",
+			err:  `the syz reproducer does not parse: line 1: "write(0x0, &(0x7f0000000000)=\"0102\", 0x2..." is not a call`,
+		},
+		{
+			data: "write(0x0, &(0x7f0000000000)=[{0x1)], 0x2)\n",
+			err:  `the syz reproducer does not parse: line 1: unbalanced ')' at column 35`,
+		},
+		{
+			data:  "write(0x0, &(0x7f0000000000)='a)b\\'', 0x2)\n",
+			level: ReproLevelSyz,
+			opts:  defaultUploadedReproOpts,
+		},
+	}
+	for i, test := range tests {
+		repro, err := newUploadedRepro(build, test.name, test.arch, []byte(test.data))
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, "test #%v", i)
+			continue
+		}
+		if !assert.NoError(t, err, "test #%v", i) {
+			continue
+		}
+		assert.Equal(t, ReproOriginManual, repro.Origin, "test #%v", i)
+		assert.Equal(t, test.level, repro.Level, "test #%v", i)
+		assert.Equal(t, test.opts, string(repro.ReproOpts), "test #%v", i)
+		arch := test.arch
+		if arch == "" {
+			arch = targets.AMD64
+		}
+		assert.Equal(t, arch, repro.Arch, "test #%v", i)
+	}
+}
+
+func TestBugRepros(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	crash1 := testCrashWithRepro(build, 1)
+	client.ReportCrash(crash1)
+	sender := c.pollEmailBug().Sender
+	_, extID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+	crash2 := testCrash(build, 2)
+	crash2.Title = crash1.Title
+	crash2.ReproOpts = []byte("repro opts 2")
+	crash2.ReproSyz = []byte("syncfs(2)")
+	client.ReportCrash(crash2)
+	crash3 := testCrashWithRepro(build, 3)
+	crash3.Title = crash1.Title
+	client.ReportCrash(crash3)
+	bug, _, _ := c.loadBug(extID)
+	c.expectEQ(len(bug.Repros), 3)
+	c.expectEQ(bug.Repros[0].Status, ReproStatusSuperseded)
+	c.expectEQ(bug.Repros[1].Status, ReproStatusSuperseded)
+	c.expectEQ(bug.Repros[2].Status, ReproStatusActive)
+	c.expectEQ(bug.Repros[2].Level, ReproLevelC)
+
+	// A developer contributes a reproducer by email.
+	reproSyz := "r0 = openat(0xffffffffffffff9c, &(0x7f0000000000)='./file0\\x00', 0x42, 0x0)\nclose(r0)\n"
+	c.incomingEmail(sender, "#syz set repro\n", EmailOptFrom("dev@kernel.org"),
+		EmailOptAttachment(reproSyz))
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "The reproducer is added to the bug as #4."))
+	bug, _, _ = c.loadBug(extID)
+	c.expectEQ(len(bug.Repros), 4)
+	uploaded := bug.Repros[3]
+	c.expectEQ(uploaded.Origin, ReproOriginManual)
+	c.expectEQ(uploaded.User, "dev@kernel.org")
+	c.expectEQ(uploaded.Level, ReproLevelSyz)
+	c.expectEQ(uploaded.Arch, targets.AMD64)
+	data, err := c.GET(textLink(textReproSyz, uploaded.ReproSyz))
+	c.expectOK(err)
+	c.expectTrue(strings.HasSuffix(string(data), reproSyz))
+
+	// Bad reproducers are rejected.
+	c.incomingEmail(sender, "#syz set repro\n", EmailOptFrom("dev@kernel.org"),
+		EmailOptAttachment("not a program"), EmailOptMessageID(2))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "I could not accept the reproducer: the syz reproducer does not parse"))
+	c.incomingEmail(sender, "#syz set repro\n", EmailOptFrom("dev@kernel.org"), EmailOptMessageID(3))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "Please attach the reproducer"))
+
+	// The patch testing jobs may select the reproducer.
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch repro=4\n"+sampleGitPatch,
+		EmailOptFrom("test@requester.com"), EmailOptMessageID(4))
+	c.expectNoEmail()
+	resp := client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{TestPatches: true})
+	c.expectEQ(resp.Type, dashapi.JobTestPatch)
+	c.expectEQ(string(resp.ReproSyz), reproSyz)
+	c.expectEQ(len(resp.ReproC), 0)
+	c.expectEQ(string(resp.ReproOpts), defaultUploadedReproOpts)
+	client.expectOK(client.JobDone(&dashapi.JobDoneReq{ID: resp.ID}))
+	c.pollEmailBug()
+
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch repro=2\n"+sampleGitPatch,
+		EmailOptFrom("test@requester.com"), EmailOptMessageID(5))
+	c.expectNoEmail()
+	resp = client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{TestPatches: true})
+	c.expectEQ(string(resp.ReproSyz), string(crash2.ReproSyz))
+	c.expectEQ(string(resp.ReproOpts), string(crash2.ReproOpts))
+	client.expectOK(client.JobDone(&dashapi.JobDoneReq{ID: resp.ID}))
+	c.pollEmailBug()
+
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch repro=7\n"+sampleGitPatch,
+		EmailOptFrom("test@requester.com"), EmailOptMessageID(6))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "The bug has no reproducer #7."))
+
+	// Reproducers can be uploaded on the bug page as well.
+	reproC := "#include <unistd.h>\nint main() { syncfs(0); return 0; }\n"
+	upload := "/repros?action=upload&arch=arm64&id=" + bug.keyHash() + "&repro=" + url.QueryEscape(reproC)
+	_, err = c.AuthGET(AccessPublic, upload)
+	c.expectTrue(err != nil)
+	checkRedirect(c, AccessUser, upload, bugLink(bug.keyHash()), http.StatusFound)
+	checkResponseStatusCode(c, AccessUser, "/repros?action=upload&id="+bug.keyHash()+"&repro=foo",
+		http.StatusBadRequest)
+	bug, _, _ = c.loadBug(extID)
+	c.expectEQ(len(bug.Repros), 5)
+	c.expectEQ(bug.Repros[4].Arch, targets.ARM64)
+	c.expectEQ(bug.Repros[4].Level, ReproLevelC)
+
+	page, err := c.AuthGET(AccessUser, bugLink(bug.keyHash()))
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Reproducers (5)"))
+	c.expectTrue(strings.Contains(string(page), "dev@kernel.org"))
+	c.expectTrue(strings.Contains(string(page), "superseded"))
+}
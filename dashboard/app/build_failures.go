@@ -0,0 +1,277 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// When the kernel tree breaks the build, every affected manager reports a build error.
+// The /ns/build_failures page groups the current failures of the namespace by the error signature
+// extracted from the build error report, and shows how long each manager has been failing.
+// Failures that persist for more than buildBisectDelay get a build-only cause bisection:
+// it's a normal JobBisectCause job for the build error bug, so the culprit is shown on the bug page
+// and reported in the build error thread like any other bisection result.
+
+const (
+	buildBisectDelay       = 24 * time.Hour
+	maxBuildFailureHistory = 10
+)
+
+func (mgr *Manager) buildFailed(bugID, kernelCommit string, now time.Time) {
+	if mgr.FailedBuildBug == "" || mgr.FailedBuildSince.IsZero() {
+		mgr.FailedBuildSince = now
+		mgr.FailedBuildCommit = kernelCommit
+	}
+	mgr.FailedBuildBug = bugID
+}
+
+func (mgr *Manager) buildFixed(now time.Time) {
+	if mgr.FailedBuildBug != "" && !mgr.FailedBuildSince.IsZero() {
+		mgr.BuildFailures = append(mgr.BuildFailures, ManagerBuildFailure{
+			Bug:         mgr.FailedBuildBug,
+			FirstCommit: mgr.FailedBuildCommit,
+			Start:       mgr.FailedBuildSince,
+			End:         now,
+		})
+		if len(mgr.BuildFailures) > maxBuildFailureHistory {
+			mgr.BuildFailures = mgr.BuildFailures[len(mgr.BuildFailures)-maxBuildFailureHistory:]
+		}
+	}
+	mgr.FailedBuildBug = ""
+	mgr.FailedBuildSince = time.Time{}
+	mgr.FailedBuildCommit = ""
+}
+
+// BuildErrorSignature identifies the root cause of a build failure independently of
+// the line numbers and the surrounding noise in the build log.
+type BuildErrorSignature struct {
+	Class     string
+	Signature string
+}
+
+var buildErrorClassifiers = []struct {
+	class string
+	re    *regexp.Regexp
+	// Signature format with $N references to the re groups.
+	sig string
+}{
+	{"modpost", regexp.MustCompile(`ERROR: modpost: "([^"]+)" \[([^\]]+)\] undefined!`),
+		`modpost: undefined symbol $1`},
+	{"modpost", regexp.MustCompile(`ERROR: modpost: (.*)`), `modpost: $1`},
+	{"linker", regexp.MustCompile("undefined reference to [`'‘\"]?([^`'’\"\\s]+)"), `undefined reference to $1`},
+	{"linker", regexp.MustCompile("multiple definition of [`'‘\"]?([^`'’\"\\s]+)"), `multiple definition of $1`},
+	{"compiler", regexp.MustCompile(`^([a-zA-Z0-9_\-/.+]+):[0-9]+:(?:[0-9]+:)? (?:fatal )?error: (.*)`),
+		`$1: error: $2`},
+	{"make", regexp.MustCompile(`No rule to make target '([^']+)'`), `no rule to make target $1`},
+	{"kconfig", regexp.MustCompile(`^([a-zA-Z0-9_\-/.]*Kconfig[a-zA-Z0-9_\-.]*):[0-9]+: (.*)`), `$1: $2`},
+}
+
+var buildErrorNumberRe = regexp.MustCompile(`[0-9]+`)
+
+// buildErrorSignature classifies the build error report (or the build log).
+// The first line that matches a known error pattern determines the signature.
+func buildErrorSignature(report []byte) BuildErrorSignature {
+	var fallback []byte
+	for _, line := range bytes.Split(report, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		for _, cl := range buildErrorClassifiers {
+			match := cl.re.FindSubmatchIndex(line)
+			if match == nil {
+				continue
+			}
+			sig := cl.re.Expand(nil, []byte(cl.sig), line, match)
+			return BuildErrorSignature{cl.class, string(bytes.TrimSpace(sig))}
+		}
+		if fallback == nil && bytes.Contains(bytes.ToLower(line), []byte("error")) {
+			fallback = buildErrorNumberRe.ReplaceAll(line, []byte("N"))
+		}
+	}
+	if fallback == nil {
+		return BuildErrorSignature{"unknown", ""}
+	}
+	return BuildErrorSignature{"other", string(fallback)}
+}
+
+// createBuildBisectJob creates a build-only bisection for a build failure that persists for too long.
+func createBuildBisectJob(c context.Context, managers map[string]dashapi.ManagerJobs) (*Job, *db.Key, error) {
+	var mgrs []*Manager
+	_, err := db.NewQuery("Manager").
+		Filter("FailedBuildSince>", time.Time{}).
+		Filter("FailedBuildSince<", timeNow(c).Add(-buildBisectDelay)).
+		GetAll(c, &mgrs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query managers: %w", err)
+	}
+	for _, mgr := range mgrs {
+		if !managers[mgr.Name].BisectCause || mgr.FailedBuildBug == "" {
+			continue
+		}
+		bug := new(Bug)
+		bugKey := db.NewKey(c, "Bug", mgr.FailedBuildBug, 0, nil)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return nil, nil, fmt.Errorf("failed to get bug: %w", err)
+		}
+		if bug.Namespace != mgr.Namespace || bug.Status != BugStatusOpen || bug.BisectCause != BisectNot {
+			continue
+		}
+		crashes, crashKeys, err := queryCrashesForBug(c, bugKey, maxCrashes())
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, crash := range crashes {
+			if crash.Manager == mgr.Name {
+				return createBisectJobForBug(c, bug, crash, bugKey, crashKeys[i], JobBisectCause)
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+type uiBuildFailuresPage struct {
+	Header *uiHeader
+	Now    time.Time
+	Groups []*uiBuildFailureGroup
+}
+
+type uiBuildFailureGroup struct {
+	BuildErrorSignature
+	BugTitle  string
+	BugLink   string
+	Culprit   *uiCommit
+	Managers  []*uiBuildFailure
+	Bisection string
+}
+
+type uiBuildFailure struct {
+	Manager     string
+	Since       time.Time
+	FirstCommit string
+	History     []*uiBuildFailurePeriod
+}
+
+type uiBuildFailurePeriod struct {
+	Start    time.Time
+	Duration time.Duration
+}
+
+func handleBuildFailures(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	hdr, err := commonHeader(c, r, w, "")
+	if err != nil {
+		return err
+	}
+	accessLevel := namespaceAccessLevel(c, r, hdr.Namespace)
+	managers, _, err := loadManagerList(c, accessLevel, hdr.Namespace, nil)
+	if err != nil {
+		return err
+	}
+	groups := make(map[string]*uiBuildFailureGroup)
+	for _, mgr := range managers {
+		if mgr.FailedBuildBug == "" {
+			continue
+		}
+		group := groups[mgr.FailedBuildBug]
+		if group == nil {
+			if group, err = loadBuildFailureGroup(c, mgr.FailedBuildBug, accessLevel); err != nil {
+				return err
+			}
+			if group == nil {
+				continue
+			}
+			groups[mgr.FailedBuildBug] = group
+		}
+		ui := &uiBuildFailure{
+			Manager:     mgr.Name,
+			Since:       mgr.FailedBuildSince,
+			FirstCommit: mgr.FailedBuildCommit,
+		}
+		for i := len(mgr.BuildFailures) - 1; i >= 0; i-- {
+			failure := mgr.BuildFailures[i]
+			ui.History = append(ui.History, &uiBuildFailurePeriod{
+				Start:    failure.Start,
+				Duration: failure.End.Sub(failure.Start),
+			})
+		}
+		group.Managers = append(group.Managers, ui)
+	}
+	// Different bugs may have the same root cause, e.g. if managers use different repos.
+	var list []*uiBuildFailureGroup
+	bySignature := make(map[BuildErrorSignature]*uiBuildFailureGroup)
+	var bugIDs []string
+	for bugID := range groups {
+		bugIDs = append(bugIDs, bugID)
+	}
+	sort.Strings(bugIDs)
+	for _, bugID := range bugIDs {
+		group := groups[bugID]
+		if prev := bySignature[group.BuildErrorSignature]; prev != nil && group.Class != "unknown" {
+			prev.Managers = append(prev.Managers, group.Managers...)
+			continue
+		}
+		bySignature[group.BuildErrorSignature] = group
+		list = append(list, group)
+	}
+	for _, group := range list {
+		sort.Slice(group.Managers, func(i, j int) bool {
+			return group.Managers[i].Since.Before(group.Managers[j].Since)
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Managers[0].Since.Before(list[j].Managers[0].Since)
+	})
+	return serveTemplate(w, "build_failures.html", &uiBuildFailuresPage{
+		Header: hdr,
+		Now:    timeNow(c),
+		Groups: list,
+	})
+}
+
+func loadBuildFailureGroup(c context.Context, bugID string, accessLevel AccessLevel) (*uiBuildFailureGroup, error) {
+	bug := new(Bug)
+	if err := db.Get(c, db.NewKey(c, "Bug", bugID, 0, nil), bug); err != nil {
+		return nil, fmt.Errorf("failed to get bug %v: %w", bugID, err)
+	}
+	if bug.sanitizeAccess(accessLevel) > accessLevel {
+		return nil, nil
+	}
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return nil, err
+	}
+	report, _, err := getText(c, textCrashReport, crash.Report)
+	if err != nil {
+		return nil, err
+	}
+	group := &uiBuildFailureGroup{
+		BuildErrorSignature: buildErrorSignature(report),
+		BugTitle:            bug.displayTitle(),
+		BugLink:             bugLink(bugID),
+		Bisection:           bug.BisectCause.String(),
+	}
+	if bug.BisectCause == BisectYes {
+		job, _, _, _, err := loadBisectJob(c, bug, JobBisectCause)
+		if err != nil {
+			return nil, err
+		}
+		if len(job.Commits) == 1 {
+			com := job.Commits[0]
+			group.Culprit = &uiCommit{
+				Hash:   com.Hash,
+				Title:  com.Title,
+				Author: fmt.Sprintf("%v <%v>", com.AuthorName, com.Author),
+				Date:   com.Date,
+			}
+		}
+	}
+	return group, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestBuildErrorSignature(t *testing.T) {
+	tests := []struct {
+		log  string
+		want BuildErrorSignature
+	}{
+		{
+			log: `  CC      fs/ext4/inode.o
+fs/ext4/inode.c: In function 'ext4_write_begin':
+fs/ext4/inode.c:1163:9: error: implicit declaration of function 'ext4_foo' [-Werror=implicit-function-declaration]
+ 1163 |         ext4_foo(inode);
+      |         ^~~~~~~~
+cc1: some warnings being treated as errors
+make[3]: *** [scripts/Makefile.build:252: fs/ext4/inode.o] Error 1
+make[2]: *** [scripts/Makefile.build:494: fs/ext4] Error 2
+`,
+			want: BuildErrorSignature{"compiler",
+				"fs/ext4/inode.c: error: implicit declaration of function 'ext4_foo' " +
+					"[-Werror=implicit-function-declaration]"},
+		},
+		{
+			log: `In file included from drivers/net/wireless/ath/ath11k/core.c:10:
+drivers/net/wireless/ath/ath11k/core.h:12:10: fatal error: linux/rhashtable2.h: No such file or directory
+   12 | #include <linux/rhashtable2.h>
+compilation terminated.
+`,
+			want: BuildErrorSignature{"compiler",
+				"drivers/net/wireless/ath/ath11k/core.h: error: linux/rhashtable2.h: No such file or directory"},
+		},
+		{
+			log: `  LD      .tmp_vmlinux.kallsyms1
+ld: vmlinux.o: in function ` + "`" + `tcp_v4_rcv':
+net/ipv4/tcp_ipv4.c:2105: undefined reference to ` + "`" + `tcp_foo_bar'
+make[1]: *** [scripts/Makefile.vmlinux:35: vmlinux] Error 1
+`,
+			want: BuildErrorSignature{"linker", "undefined reference to tcp_foo_bar"},
+		},
+		{
+			log: `ld.lld: error: duplicate symbol: init_module
+>>> defined at drivers/foo.c
+ld: drivers/foo.o: multiple definition of ` + "`" + `init_module'; drivers/bar.o: first defined here
+`,
+			want: BuildErrorSignature{"linker", "multiple definition of init_module"},
+		},
+		{
+			log: `  MODPOST Module.symvers
+ERROR: modpost: "kvm_foo_bar" [arch/x86/kvm/kvm-intel.ko] undefined!
+make[2]: *** [scripts/Makefile.modpost:136: Module.symvers] Error 1
+`,
+			want: BuildErrorSignature{"modpost", "modpost: undefined symbol kvm_foo_bar"},
+		},
+		{
+			log: `make[3]: *** No rule to make target 'drivers/gpu/drm/foo.o', needed by 'drivers/gpu/drm/built-in.a'.  Stop.
+`,
+			want: BuildErrorSignature{"make", "no rule to make target drivers/gpu/drm/foo.o"},
+		},
+		{
+			log: `drivers/net/Kconfig:483: syntax error
+drivers/net/Kconfig:482: invalid statement
+`,
+			want: BuildErrorSignature{"kconfig", "drivers/net/Kconfig: syntax error"},
+		},
+		{
+			log: `BTF: .tmp_vmlinux.btf: pahole (pahole) is not available
+Failed to generate BTF for vmlinux, error code 127
+`,
+			want: BuildErrorSignature{"other", "Failed to generate BTF for vmlinux, error code N"},
+		},
+		{
+			log:  "Killed\n",
+			want: BuildErrorSignature{"unknown", ""},
+		},
+	}
+	for i, test := range tests {
+		got := buildErrorSignature([]byte(test.log))
+		if got != test.want {
+			t.Errorf("#%v: got %+v, want %+v", i, got, test.want)
+		}
+	}
+}
+
+func TestBuildFailures(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	failedBuild := testBuild(2)
+	failedBuild.Manager = build.Manager
+	failedBuild.KernelCommit = "kern2"
+	c.expectOK(c.client.ReportBuildError(&dashapi.BuildErrorReq{
+		Build: *failedBuild,
+		Crash: dashapi.Crash{
+			Title:  "repo build error",
+			Report: []byte("mm/slub.c:10:2: error: unknown type name 'foo_t'\n"),
+		},
+	}))
+	mgr, _ := c.loadManager("test1", build.Manager)
+	c.expectEQ(mgr.FailedBuildCommit, "kern2")
+	c.expectEQ(mgr.FailedBuildSince, c.mockedTime)
+
+	page, err := c.AuthGET(AccessUser, "/test1/build_failures")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("[compiler] mm/slub.c: error: unknown type name &#39;foo_t&#39;")))
+	c.expectTrue(bytes.Contains(page, []byte("repo build error")))
+
+	// The failure is not bisected until it persists for a day.
+	resp := c.client.pollJobs(build.Manager)
+	c.expectEQ(resp.ID, "")
+	c.advanceTime(25 * time.Hour)
+	resp = c.client.pollJobs(build.Manager)
+	c.expectEQ(resp.Type, dashapi.JobBisectCause)
+	c.expectEQ(resp.BuildOnly, true)
+	c.expectEQ(resp.KernelCommit, "kern2")
+	c.expectOK(c.client.JobDone(&dashapi.JobDoneReq{
+		ID:         resp.ID,
+		CrashTitle: "kernel build error",
+		Commits: []dashapi.Commit{{
+			Hash:       "1111111111111111111111111111111111111111",
+			Title:      "mm: break the build",
+			Author:     "author@kernel.org",
+			AuthorName: "Author Kernelov",
+			Date:       time.Date(2000, 2, 9, 4, 5, 6, 7, time.UTC),
+		}},
+	}))
+	page, err = c.AuthGET(AccessUser, "/test1/build_failures")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("mm: break the build")))
+
+	// A good build ends the failure and moves it to the history.
+	build.ID = "id3"
+	build.KernelCommit = "kern3"
+	c.client.UploadBuild(build)
+	mgr, _ = c.loadManager("test1", build.Manager)
+	c.expectEQ(mgr.FailedBuildBug, "")
+	c.expectEQ(len(mgr.BuildFailures), 1)
+	c.expectEQ(mgr.BuildFailures[0].FirstCommit, "kern2")
+	page, err = c.AuthGET(AccessUser, "/test1/build_failures")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("No build failures")))
+}
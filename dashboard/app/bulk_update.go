@@ -0,0 +1,165 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// apiBulkUpdateBugs applies the same status change to a list of bugs of the namespace.
+// Each bug goes through incomingCommand, exactly as if the command came by email,
+// so a failure for one bug does not affect the rest.
+// Only the clients listed in the namespace BulkUpdateClients may use it.
+func apiBulkUpdateBugs(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	client := r.PostFormValue("client")
+	if !stringInList(config.Namespaces[ns].BulkUpdateClients, client) {
+		return nil, fmt.Errorf("client %v is not allowed to bulk update bugs", client)
+	}
+	req := new(dashapi.BulkBugUpdateReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %v", err)
+	}
+	if err := checkBulkUpdateReq(req); err != nil {
+		return nil, err
+	}
+	// The User field is not authenticated, so the changes are attributed to the client.
+	return bulkUpdateBugs(c, ns, req, client, client)
+}
+
+// handleBulkUpdate is the web counterpart of apiBulkUpdateBugs for the namespace admins
+// (including the ones with the scoped role). The bugs are given by the "id" form values.
+func handleBulkUpdate(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns := r.FormValue("ns")
+	if config.Namespaces[ns] == nil {
+		return fmt.Errorf("%w: unknown namespace %q", ErrClientBadRequest, ns)
+	}
+	if namespaceAccessLevel(c, r, ns) < AccessAdmin {
+		return ErrAccess
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	req := &dashapi.BulkBugUpdateReq{
+		IDs:    r.Form["id"],
+		Action: dashapi.BulkBugAction(r.FormValue("action")),
+		User:   author,
+		DryRun: r.FormValue("dry_run") != "",
+	}
+	if err := checkBulkUpdateReq(req); err != nil {
+		return fmt.Errorf("%w: %v", ErrClientBadRequest, err)
+	}
+	resp, err := bulkUpdateBugs(c, ns, req, "", author)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(resp, "", "\t")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+func checkBulkUpdateReq(req *dashapi.BulkBugUpdateReq) error {
+	if len(req.IDs) == 0 {
+		return fmt.Errorf("no bug IDs")
+	}
+	if len(req.IDs) > dashapi.MaxBulkBugUpdate {
+		return fmt.Errorf("too many bug IDs: %v, at most %v are allowed per call",
+			len(req.IDs), dashapi.MaxBulkBugUpdate)
+	}
+	switch req.Action {
+	case dashapi.BulkBugInvalidate, dashapi.BulkBugObsolete, dashapi.BulkBugUpstream:
+	default:
+		return fmt.Errorf("unknown action %q", req.Action)
+	}
+	return nil
+}
+
+// bulkUpdateBugs applies the checked request on behalf of author and records the audit entry.
+// The client is empty for the requests that come from the web UI.
+func bulkUpdateBugs(c context.Context, ns string, req *dashapi.BulkBugUpdateReq, client, author string) (
+	*dashapi.BulkBugUpdateResp, error) {
+	var state *ReportingState
+	if req.DryRun {
+		var err error
+		if state, err = loadReportingState(c); err != nil {
+			return nil, err
+		}
+	}
+	resp := new(dashapi.BulkBugUpdateResp)
+	applied := 0
+	for _, id := range req.IDs {
+		reply := bulkUpdateBug(c, ns, req.Action, id, author, state)
+		if reply.OK && !req.DryRun {
+			applied++
+		}
+		resp.Results = append(resp.Results, dashapi.BugUpdateResult{ID: id, BugUpdateReply: reply})
+	}
+	if req.DryRun {
+		return resp, nil
+	}
+	log.Warningf(c, "%v: bulk %v of %v bugs by %v/%v, %v applied",
+		ns, req.Action, len(req.IDs), client, req.User, applied)
+	audit := &BulkBugUpdate{
+		Namespace: ns,
+		Client:    client,
+		User:      req.User,
+		Action:    string(req.Action),
+		Time:      timeNow(c),
+		IDs:       req.IDs,
+		Applied:   applied,
+	}
+	if _, err := db.Put(c, db.NewIncompleteKey(c, "BulkBugUpdate", nil), audit); err != nil {
+		// The updates are already done, so still return the results.
+		log.Errorf(c, "failed to save bulk update audit record: %v", err)
+	}
+	return resp, nil
+}
+
+// bulkUpdateBug applies the action to a single bug. If state is not nil, this is a dry run:
+// the update is checked against the state, but nothing is saved.
+func bulkUpdateBug(c context.Context, ns string, action dashapi.BulkBugAction, id, user string,
+	state *ReportingState) dashapi.BugUpdateReply {
+	bug, bugKey, err := findBugByReportingID(c, id)
+	if err != nil || bug.Namespace != ns {
+		return dashapi.BugUpdateReply{Text: "can't find the bug"}
+	}
+	cmd := &dashapi.BugUpdate{ID: id, User: user}
+	switch action {
+	case dashapi.BulkBugInvalidate:
+		cmd.Status = dashapi.BugStatusInvalid
+	case dashapi.BulkBugObsolete:
+		cmd.Status = dashapi.BugStatusInvalid
+		cmd.StatusReason = bugObsoletionReason(bug)
+	case dashapi.BulkBugUpstream:
+		cmd.Status = dashapi.BugStatusUpstream
+	}
+	var ok bool
+	var reason string
+	if state != nil {
+		ok, reason, err = incomingCommandUpdate(c, timeNow(c), cmd, bugKey, bug, nil, state)
+	} else {
+		ok, reason, err = incomingCommand(c, cmd)
+	}
+	if !ok && reason == "" && err == nil {
+		// incomingCommand does not explain these to avoid replying to emails about closed bugs.
+		reason = "the bug is already closed"
+	}
+	return dashapi.BugUpdateReply{
+		OK:    ok,
+		Error: err != nil,
+		Text:  reason,
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestBulkUpdateBugs(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		c.client.ReportCrash(testCrash(build, i))
+		rep := c.client.pollBug()
+		c.client.updateBug(rep.ID, dashapi.BugStatusOpen, "")
+		ids = append(ids, rep.ID)
+	}
+
+	// Nothing changes in the dry run mode.
+	resp, err := c.client.BulkUpdateBugs(&dashapi.BulkBugUpdateReq{
+		IDs:    []string{ids[0], ids[1], "foobar"},
+		Action: dashapi.BulkBugInvalidate,
+		DryRun: true,
+	})
+	c.expectOK(err)
+	c.expectEQ(len(resp.Results), 3)
+	c.expectEQ(resp.Results[0].OK, true)
+	c.expectEQ(resp.Results[1].OK, true)
+	c.expectEQ(resp.Results[2].OK, false)
+	c.expectEQ(resp.Results[2].Text, "can't find the bug")
+	bug, _, _ := c.loadBug(ids[0])
+	c.expectEQ(bug.Status, BugStatusOpen)
+
+	resp, err = c.client.BulkUpdateBugs(&dashapi.BulkBugUpdateReq{
+		IDs:    []string{ids[0]},
+		Action: dashapi.BulkBugInvalidate,
+		User:   "admin@foo.com",
+	})
+	c.expectOK(err)
+	c.expectEQ(resp.Results[0].OK, true)
+	bug, _, _ = c.loadBug(ids[0])
+	c.expectEQ(bug.Status, BugStatusInvalid)
+	c.expectEQ(bug.StatusReason, dashapi.BugStatusReason(""))
+	// The change is attributed to the authenticated client rather than to the claimed user.
+	c.expectEQ(bug.Invalidations[0].User, client1)
+
+	resp, err = c.client.BulkUpdateBugs(&dashapi.BulkBugUpdateReq{
+		IDs:    []string{ids[0], ids[1]},
+		Action: dashapi.BulkBugObsolete,
+		User:   "admin@foo.com",
+	})
+	c.expectOK(err)
+	c.expectEQ(resp.Results[0].OK, false)
+	c.expectEQ(resp.Results[0].Text, "the bug is already closed")
+	c.expectEQ(resp.Results[1].OK, true)
+	bug, _, _ = c.loadBug(ids[1])
+	c.expectEQ(bug.Status, BugStatusInvalid)
+	c.expectEQ(bug.StatusReason, dashapi.InvalidatedByNoActivity)
+	c.expectEQ(bug.Reporting[0].Auto, false)
+
+	resp, err = c.client.BulkUpdateBugs(&dashapi.BulkBugUpdateReq{
+		IDs:    []string{ids[2]},
+		Action: dashapi.BulkBugUpstream,
+	})
+	c.expectOK(err)
+	c.expectEQ(resp.Results[0].OK, true)
+	rep := c.client.pollBug()
+	c.expectEQ(rep.Title, "title2")
+
+	// Bugs of other namespaces are not accessible.
+	c.client2.UploadBuild(testBuild(2))
+	c.client2.ReportCrash(testCrash(testBuild(2), 1))
+	var otherBugs []*Bug
+	_, err = db.NewQuery("Bug").Filter("Namespace=", "test2").GetAll(c.ctx, &otherBugs)
+	c.expectOK(err)
+	c.expectEQ(len(otherBugs), 1)
+	resp, err = c.client.BulkUpdateBugs(&dashapi.BulkBugUpdateReq{
+		IDs:    []string{otherBugs[0].Reporting[0].ID},
+		Action: dashapi.BulkBugInvalidate,
+	})
+	c.expectOK(err)
+	c.expectEQ(resp.Results[0].OK, false)
+
+	// Only the explicitly allowed clients may bulk update bugs.
+	_, err = c.client2.BulkUpdateBugs(&dashapi.BulkBugUpdateReq{
+		IDs:    []string{otherBugs[0].Reporting[0].ID},
+		Action: dashapi.BulkBugInvalidate,
+	})
+	c.expectFail("not allowed to bulk update bugs", err)
+
+	var audit []*BulkBugUpdate
+	_, err = db.NewQuery("BulkBugUpdate").Order("Time").GetAll(c.ctx, &audit)
+	c.expectOK(err)
+	c.expectEQ(len(audit), 4)
+	c.expectEQ(audit[1].Client, client1)
+	c.expectEQ(audit[1].User, "admin@foo.com")
+	c.expectEQ(audit[1].Action, string(dashapi.BulkBugObsolete))
+	c.expectEQ(audit[1].IDs, []string{ids[0], ids[1]})
+	c.expectEQ(audit[1].Applied, 1)
+
+	var tooMany []string
+	for i := 0; i <= dashapi.MaxBulkBugUpdate; i++ {
+		tooMany = append(tooMany, ids[0])
+	}
+	c.expectFail("too many bug IDs", c.makeClient(client1, password1, false).Query("bulk_update_bugs",
+		&dashapi.BulkBugUpdateReq{IDs: tooMany, Action: dashapi.BulkBugInvalidate}, nil))
+	c.expectFail("unknown action", c.makeClient(client1, password1, false).Query("bulk_update_bugs",
+		&dashapi.BulkBugUpdateReq{IDs: ids, Action: "fix"}, nil))
+}
+
+func TestBulkUpdateBugsScopedAdmin(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build1 := testBuild(1)
+	c.client.UploadBuild(build1)
+	c.client.ReportCrash(testCrash(build1, 1))
+	rep1 := c.client.pollBug()
+	c.client.updateBug(rep1.ID, dashapi.BugStatusOpen, "")
+	build2 := testBuild(2)
+	c.client2.UploadBuild(build2)
+	c.client2.ReportCrash(testCrash(build2, 1))
+	var otherBugs []*Bug
+	_, err := db.NewQuery("Bug").Filter("Namespace=", "test2").GetAll(c.ctx, &otherBugs)
+	c.expectOK(err)
+	c.expectEQ(len(otherBugs), 1)
+
+	const partner = "partner@example.com"
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=grant_role&ns=test1&email="+partner+"&role=admin")
+	c.expectOK(err)
+
+	// The scoped admin may bulk update the bugs of their namespace.
+	reply, err := c.GETAs(partner, "/bulk_update?ns=test1&action=invalidate&id="+rep1.ID)
+	c.expectOK(err)
+	resp := new(dashapi.BulkBugUpdateResp)
+	c.expectOK(json.Unmarshal(reply, resp))
+	c.expectEQ(len(resp.Results), 1)
+	c.expectEQ(resp.Results[0].OK, true)
+	bug, _, _ := c.loadBug(rep1.ID)
+	c.expectEQ(bug.Status, BugStatusInvalid)
+	c.expectEQ(bug.Invalidations[0].User, partner)
+	var audit []*BulkBugUpdate
+	_, err = db.NewQuery("BulkBugUpdate").GetAll(c.ctx, &audit)
+	c.expectOK(err)
+	c.expectEQ(len(audit), 1)
+	c.expectEQ(audit[0].Client, "")
+	c.expectEQ(audit[0].User, partner)
+
+	// But not in other namespaces.
+	_, err = c.GETAs(partner, "/bulk_update?ns=test2&action=invalidate&id="+otherBugs[0].Reporting[0].ID)
+	c.expectForbidden(err)
+	_, err = c.GETAs(partner, "/bulk_update?ns=test1&action=invalidate&id="+otherBugs[0].Reporting[0].ID)
+	c.expectOK(err)
+	bug, _, _ = c.loadBug(otherBugs[0].Reporting[0].ID)
+	c.expectEQ(bug.Status, BugStatusOpen)
+
+	_, err = c.GETAs(partner, "/bulk_update?ns=test1&action=fix&id="+rep1.ID)
+	c.expectBadReqest(err)
+}
@@ -27,7 +27,7 @@ type CachedBugStats struct {
 }
 
 func CacheGet(c context.Context, r *http.Request, ns string) (*Cached, error) {
-	accessLevel := accessLevel(c, r)
+	accessLevel := namespaceAccessLevel(c, r, ns)
 	v := new(Cached)
 	_, err := memcache.Gob.Get(c, cacheKey(ns, accessLevel), v)
 	if err != nil && err != memcache.ErrCacheMiss {
@@ -0,0 +1,457 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/vcs"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	aemail "google.golang.org/appengine/v2/mail"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Users debugging a bug may watch the source files (or dirs) related to the bug, by default
+// its guilty file. During commit polling syz-ci lists the main repo commits that touched
+// the watched paths since the last poll (CommitWatch.LastCommit is the cursor), the commits
+// are shown on the bug page and, optionally, emailed to the users that asked for it.
+
+const (
+	maxWatchedPaths = 5
+	// How many recent changes are kept per watch.
+	maxWatchChanges = 30
+)
+
+// CommitWatch is keyed by the bug key hash, there's at most one watch per bug.
+type CommitWatch struct {
+	Namespace string
+	Paths     []string `datastore:",noindex"`
+	// Watchers are the emails of the users that want to be notified about the changes.
+	Watchers []string `datastore:",noindex"`
+	// LastCommit is the main repo commit up to which the paths were checked.
+	LastCommit string    `datastore:",noindex"`
+	Polled     time.Time `datastore:",noindex"`
+	// Changes are the commits touching the paths, the newest first.
+	Changes []CommitWatchChange `datastore:",noindex"`
+}
+
+type CommitWatchChange struct {
+	Path   string
+	Hash   string
+	Title  string
+	Author string
+	Date   time.Time
+	Found  time.Time
+}
+
+func commitWatchKey(c context.Context, bugHash string) *db.Key {
+	return db.NewKey(c, "CommitWatch", bugHash, 0, nil)
+}
+
+func loadCommitWatch(c context.Context, bugHash string) (*CommitWatch, error) {
+	watch := new(CommitWatch)
+	if err := db.Get(c, commitWatchKey(c, bugHash), watch); err != nil {
+		if err == db.ErrNoSuchEntity {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get commit watch: %w", err)
+	}
+	return watch, nil
+}
+
+// commitWatchPolls returns the watches of the open bugs of the namespace.
+func commitWatchPolls(c context.Context, ns string) ([]dashapi.WatchPoll, error) {
+	var watches []*CommitWatch
+	keys, err := db.NewQuery("CommitWatch").
+		Filter("Namespace=", ns).
+		GetAll(c, &watches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query commit watches: %w", err)
+	}
+	if len(watches) == 0 {
+		return nil, nil
+	}
+	bugKeys := make([]*db.Key, len(keys))
+	for i, key := range keys {
+		bugKeys[i] = db.NewKey(c, "Bug", key.StringID(), 0, nil)
+	}
+	bugs := make([]*Bug, len(keys))
+	if err := db.GetMulti(c, bugKeys, bugs); err != nil {
+		return nil, fmt.Errorf("failed to get bugs: %w", err)
+	}
+	var ret []dashapi.WatchPoll
+	for i, watch := range watches {
+		if bugs[i].Status != BugStatusOpen || len(watch.Paths) == 0 {
+			continue
+		}
+		ret = append(ret, dashapi.WatchPoll{
+			ID:         keys[i].StringID(),
+			Paths:      watch.Paths,
+			LastCommit: watch.LastCommit,
+		})
+	}
+	return ret, nil
+}
+
+func apiUploadWatchResults(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	req := new(dashapi.WatchResultReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	for _, res := range req.Results {
+		watch, changes, err := updateCommitWatch(c, ns, res)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) == 0 || len(watch.Watchers) == 0 {
+			continue
+		}
+		if err := sendCommitWatchEmail(c, res.ID, watch, changes); err != nil {
+			log.Errorf(c, "failed to email the watchers of %v: %v", res.ID, err)
+		}
+	}
+	return nil, nil
+}
+
+// updateCommitWatch stores the poll result and returns the changes that were not known before.
+func updateCommitWatch(c context.Context, ns string, res dashapi.WatchResult) (
+	*CommitWatch, []CommitWatchChange, error) {
+	now := timeNow(c)
+	watch := new(CommitWatch)
+	var added []CommitWatchChange
+	tx := func(c context.Context) error {
+		added = nil
+		key := commitWatchKey(c, res.ID)
+		if err := db.Get(c, key, watch); err != nil {
+			if err == db.ErrNoSuchEntity {
+				// The watch was removed during the poll.
+				return nil
+			}
+			return fmt.Errorf("failed to get commit watch: %w", err)
+		}
+		if watch.Namespace != ns {
+			return fmt.Errorf("watch %v belongs to namespace %v", res.ID, watch.Namespace)
+		}
+		added = watch.addChanges(res, now)
+		watch.LastCommit = res.LastCommit
+		watch.Polled = now
+		if _, err := db.Put(c, key, watch); err != nil {
+			return fmt.Errorf("failed to put commit watch: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return nil, nil, err
+	}
+	return watch, added, nil
+}
+
+// addChanges records the new commits touching the watched paths. A commit may come again
+// if two polls raced or the cursor was reset, such commits are skipped.
+func (watch *CommitWatch) addChanges(res dashapi.WatchResult, now time.Time) []CommitWatchChange {
+	watched := make(map[string]bool)
+	for _, path := range watch.Paths {
+		watched[path] = true
+	}
+	seen := make(map[string]bool)
+	for _, change := range watch.Changes {
+		seen[change.Path+"|"+change.Hash] = true
+	}
+	var added []CommitWatchChange
+	for _, change := range res.Changes {
+		if !watched[change.Path] {
+			// The path was unwatched during the poll.
+			continue
+		}
+		for _, com := range change.Commits {
+			if seen[change.Path+"|"+com.Hash] {
+				continue
+			}
+			seen[change.Path+"|"+com.Hash] = true
+			added = append(added, CommitWatchChange{
+				Path:   change.Path,
+				Hash:   com.Hash,
+				Title:  com.Title,
+				Author: com.Author,
+				Date:   com.Date,
+				Found:  now,
+			})
+		}
+	}
+	sort.SliceStable(added, func(i, j int) bool {
+		return added[i].Date.After(added[j].Date)
+	})
+	watch.Changes = append(append([]CommitWatchChange{}, added...), watch.Changes...)
+	if len(watch.Changes) > maxWatchChanges {
+		watch.Changes = watch.Changes[:maxWatchChanges]
+	}
+	return added
+}
+
+func sendCommitWatchEmail(c context.Context, bugHash string, watch *CommitWatch,
+	changes []CommitWatchChange) error {
+	bug := new(Bug)
+	if err := db.Get(c, db.NewKey(c, "Bug", bugHash, 0, nil), bug); err != nil {
+		return fmt.Errorf("failed to get bug: %w", err)
+	}
+	msg := &aemail.Message{
+		Sender:  fromAddr(c),
+		To:      watch.Watchers,
+		Subject: fmt.Sprintf("[syzbot] new changes to the files of %q", bug.displayTitle()),
+		Body: formatCommitWatchChanges(changes) +
+			fmt.Sprintf("\nSee %v%v for details.\n", appURL(c), bugLink(bugHash)),
+	}
+	return sendEmail(c, msg)
+}
+
+func formatCommitWatchChanges(changes []CommitWatchChange) string {
+	body := new(strings.Builder)
+	for _, group := range groupCommitWatchChanges(changes) {
+		fmt.Fprintf(body, "Recent changes to %v:\n", group.Path)
+		for _, com := range group.Commits {
+			fmt.Fprintf(body, "  %.12v %v (%v)\n", com.Hash, com.Title, com.Author)
+		}
+	}
+	return body.String()
+}
+
+type uiCommitWatch struct {
+	BugID      string
+	Paths      []*uiWatchedPath
+	Watching   bool
+	CanEdit    bool
+	CanAddPath bool
+	// DefaultPath is watched if the user does not specify any.
+	DefaultPath string
+}
+
+type uiWatchedPath struct {
+	Path    string
+	Commits []*uiWatchedCommit
+}
+
+type uiWatchedCommit struct {
+	Hash   string
+	Title  string
+	Author string
+	Date   time.Time
+	Link   string
+}
+
+func groupCommitWatchChanges(changes []CommitWatchChange) []*uiWatchedPath {
+	var ret []*uiWatchedPath
+	groups := make(map[string]*uiWatchedPath)
+	for _, change := range changes {
+		group := groups[change.Path]
+		if group == nil {
+			group = &uiWatchedPath{Path: change.Path}
+			groups[change.Path] = group
+			ret = append(ret, group)
+		}
+		group.Commits = append(group.Commits, &uiWatchedCommit{
+			Hash:   change.Hash,
+			Title:  change.Title,
+			Author: change.Author,
+			Date:   change.Date,
+		})
+	}
+	return ret
+}
+
+func makeCommitWatchUI(c context.Context, bug *Bug, sample *uiCrash, accessLevel AccessLevel) (
+	*uiCommitWatch, error) {
+	if accessLevel < AccessUser {
+		return nil, nil
+	}
+	watch, err := loadCommitWatch(c, bug.keyHash())
+	if err != nil {
+		return nil, err
+	}
+	ui := &uiCommitWatch{
+		BugID:       bug.keyHash(),
+		CanEdit:     bug.Status == BugStatusOpen,
+		CanAddPath:  true,
+		DefaultPath: bug.GuiltyFile,
+	}
+	if ui.DefaultPath == "" && sample != nil {
+		ui.DefaultPath = sample.GuiltyFile
+	}
+	if watch == nil {
+		return ui, nil
+	}
+	groups := groupCommitWatchChanges(watch.Changes)
+	for _, path := range watch.Paths {
+		item := &uiWatchedPath{Path: path}
+		for _, group := range groups {
+			if group.Path == path {
+				item.Commits = group.Commits
+			}
+		}
+		ui.Paths = append(ui.Paths, item)
+	}
+	repo := ""
+	if repos := config.Namespaces[bug.Namespace].Repos; len(repos) != 0 {
+		repo = repos[0].URL
+	}
+	for _, item := range ui.Paths {
+		for _, com := range item.Commits {
+			com.Link = vcs.CommitLink(repo, com.Hash)
+		}
+	}
+	ui.CanAddPath = len(watch.Paths) < maxWatchedPaths
+	if u := user.Current(c); u != nil {
+		ui.Watching = stringInList(watch.Watchers, u.Email)
+	}
+	return ui, nil
+}
+
+// handleCommitWatch serves the commit watch form of the bug page.
+func handleCommitWatch(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
+	if accessLevel < AccessUser {
+		return ErrAccess
+	}
+	if err := checkNamespaceAccessLevel(c, r, bug.Namespace, bug.sanitizeAccess(accessLevel)); err != nil {
+		return err
+	}
+	u := user.Current(c)
+	if u == nil {
+		return ErrAccess
+	}
+	var paths []string
+	switch action := r.FormValue("action"); action {
+	case "watch":
+		paths = strings.Fields(r.FormValue("paths"))
+		if len(paths) == 0 {
+			file, err := bugGuiltyFile(c, bug)
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				return fmt.Errorf("the bug has no guilty file, specify the paths: %w", ErrClientBadRequest)
+			}
+			paths = []string{file}
+		}
+		for _, path := range paths {
+			if err := validateGuiltyFile(path); err != nil {
+				return fmt.Errorf("%v: %w", err, ErrClientBadRequest)
+			}
+		}
+		if bug.Status != BugStatusOpen {
+			return fmt.Errorf("the bug is closed: %w", ErrClientBadRequest)
+		}
+	case "unwatch":
+		paths = []string{r.FormValue("path")}
+	case "subscribe", "unsubscribe":
+	default:
+		return fmt.Errorf("unknown action %q: %w", action, ErrClientBadRequest)
+	}
+	err = updateCommitWatchSettings(c, bug, func(watch *CommitWatch) error {
+		return watch.update(r.FormValue("action"), paths, u.Email, r.FormValue("notify") != "")
+	})
+	if err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+// bugGuiltyFile returns the guilty file of the bug taking the override into account.
+func bugGuiltyFile(c context.Context, bug *Bug) (string, error) {
+	if bug.GuiltyFile != "" {
+		return bug.GuiltyFile, nil
+	}
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return "", err
+	}
+	if files := bug.guiltyFiles(crash); len(files) != 0 {
+		return files[0], nil
+	}
+	return "", nil
+}
+
+// updateCommitWatchSettings updates the watch of the bug, the watch is deleted once
+// it has no paths left.
+func updateCommitWatchSettings(c context.Context, bug *Bug, fn func(*CommitWatch) error) error {
+	tx := func(c context.Context) error {
+		key := commitWatchKey(c, bug.keyHash())
+		watch := new(CommitWatch)
+		if err := db.Get(c, key, watch); err != nil && err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get commit watch: %w", err)
+		}
+		watch.Namespace = bug.Namespace
+		if err := fn(watch); err != nil {
+			return err
+		}
+		if len(watch.Paths) == 0 {
+			if err := db.Delete(c, key); err != nil && err != db.ErrNoSuchEntity {
+				return fmt.Errorf("failed to delete commit watch: %w", err)
+			}
+			return nil
+		}
+		if _, err := db.Put(c, key, watch); err != nil {
+			return fmt.Errorf("failed to put commit watch: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+func (watch *CommitWatch) update(action string, paths []string, user string, notify bool) error {
+	switch action {
+	case "watch":
+		for _, path := range paths {
+			if stringInList(watch.Paths, path) {
+				continue
+			}
+			if len(watch.Paths) >= maxWatchedPaths {
+				return fmt.Errorf("at most %v paths can be watched: %w", maxWatchedPaths, ErrClientBadRequest)
+			}
+			watch.Paths = append(watch.Paths, path)
+		}
+		if notify && !stringInList(watch.Watchers, user) {
+			watch.Watchers = append(watch.Watchers, user)
+		}
+	case "unwatch":
+		for _, path := range paths {
+			watch.Paths = removeFromList(watch.Paths, path)
+			var changes []CommitWatchChange
+			for _, change := range watch.Changes {
+				if change.Path != path {
+					changes = append(changes, change)
+				}
+			}
+			watch.Changes = changes
+		}
+	case "subscribe":
+		if !stringInList(watch.Watchers, user) {
+			watch.Watchers = append(watch.Watchers, user)
+		}
+	case "unsubscribe":
+		watch.Watchers = removeFromList(watch.Watchers, user)
+	}
+	return nil
+}
+
+func removeFromList(list []string, str string) []string {
+	var ret []string
+	for _, item := range list {
+		if item != str {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
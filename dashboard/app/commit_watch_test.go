@@ -0,0 +1,166 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestCommitWatchAddChanges(t *testing.T) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	commit := func(hash string, day int) dashapi.Commit {
+		return dashapi.Commit{Hash: hash, Title: "title " + hash, Date: now.AddDate(0, 0, day)}
+	}
+	watch := &CommitWatch{Paths: []string{"fs/ext4/inode.c", "mm/slab.c"}}
+	hashes := func(changes []CommitWatchChange) []string {
+		var ret []string
+		for _, change := range changes {
+			ret = append(ret, change.Path+":"+change.Hash)
+		}
+		return ret
+	}
+	// A synthetic stream of poll results, the newest commits first.
+	polls := []struct {
+		changes []dashapi.WatchChange
+		added   []string
+	}{
+		{
+			changes: []dashapi.WatchChange{
+				{Path: "fs/ext4/inode.c", Commits: []dashapi.Commit{commit("b", 2), commit("a", 1)}},
+				{Path: "mm/slab.c", Commits: []dashapi.Commit{commit("c", 3)}},
+				{Path: "kernel/fork.c", Commits: []dashapi.Commit{commit("d", 4)}},
+			},
+			added: []string{"mm/slab.c:c", "fs/ext4/inode.c:b", "fs/ext4/inode.c:a"},
+		},
+		{
+			// The same commits come again after a cursor reset.
+			changes: []dashapi.WatchChange{
+				{Path: "fs/ext4/inode.c", Commits: []dashapi.Commit{commit("e", 5), commit("b", 2)}},
+			},
+			added: []string{"fs/ext4/inode.c:e"},
+		},
+		{
+			// A commit touching both paths is shown for each of them.
+			changes: []dashapi.WatchChange{
+				{Path: "fs/ext4/inode.c", Commits: []dashapi.Commit{commit("f", 6)}},
+				{Path: "mm/slab.c", Commits: []dashapi.Commit{commit("f", 6)}},
+			},
+			added: []string{"fs/ext4/inode.c:f", "mm/slab.c:f"},
+		},
+		{
+			added: nil,
+		},
+	}
+	for i, poll := range polls {
+		added := watch.addChanges(dashapi.WatchResult{Changes: poll.changes}, now)
+		if diff := cmp.Diff(poll.added, hashes(added)); diff != "" {
+			t.Fatalf("poll #%v:\n%v", i, diff)
+		}
+	}
+	want := []string{"fs/ext4/inode.c:f", "mm/slab.c:f", "fs/ext4/inode.c:e",
+		"mm/slab.c:c", "fs/ext4/inode.c:b", "fs/ext4/inode.c:a"}
+	if diff := cmp.Diff(want, hashes(watch.Changes)); diff != "" {
+		t.Fatal(diff)
+	}
+	for i := 0; i < maxWatchChanges; i++ {
+		watch.addChanges(dashapi.WatchResult{Changes: []dashapi.WatchChange{
+			{Path: "mm/slab.c", Commits: []dashapi.Commit{commit(fmt.Sprint(i), 10+i)}},
+		}}, now)
+	}
+	if len(watch.Changes) != maxWatchChanges {
+		t.Fatalf("got %v changes", len(watch.Changes))
+	}
+}
+
+func TestCommitWatch(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.GuiltyFiles = []string{"fs/ext4/inode.c"}
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+	bug, _, _ := c.loadBug(rep.ID)
+	id := bug.keyHash()
+
+	page, err := c.AuthGET(AccessUser, bugLink(id))
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), `placeholder="fs/ext4/inode.c"`))
+
+	// Anonymous users can't watch.
+	_, err = c.AuthGET(AccessPublic, "/watch?action=watch&id="+id)
+	c.expectTrue(err != nil)
+	// The guilty file is watched by default.
+	checkRedirect(c, AccessUser, "/watch?action=watch&notify=1&id="+id, bugLink(id), http.StatusFound)
+	checkResponseStatusCode(c, AccessUser, "/watch?action=watch&paths=../etc&id="+id, http.StatusBadRequest)
+	checkRedirect(c, AccessUser, "/watch?action=watch&paths=mm/slab.c+mm/slub.c&id="+id,
+		bugLink(id), http.StatusFound)
+
+	// The first poll only sets the cursor.
+	resp, err := c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(resp.Watches, []dashapi.WatchPoll{{
+		ID:    id,
+		Paths: []string{"fs/ext4/inode.c", "mm/slab.c", "mm/slub.c"},
+	}})
+	c.expectOK(c.client.UploadWatchResults([]dashapi.WatchResult{{ID: id, LastCommit: "head1"}}))
+	c.expectNoEmail()
+
+	resp, err = c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(resp.Watches[0].LastCommit, "head1")
+	result := dashapi.WatchResult{
+		ID:         id,
+		LastCommit: "head2",
+		Changes: []dashapi.WatchChange{{
+			Path: "fs/ext4/inode.c",
+			Commits: []dashapi.Commit{{
+				Hash:   "1111111111111111111111111111111111111111",
+				Title:  "ext4: fix inode locking",
+				Author: "dev@kernel.org",
+				Date:   timeNow(c.ctx),
+			}},
+		}},
+	}
+	c.expectOK(c.client.UploadWatchResults([]dashapi.WatchResult{result}))
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.To, []string{"user@syzkaller.com"})
+	c.expectTrue(strings.Contains(msg.Body, "Recent changes to fs/ext4/inode.c:\n"+
+		"  111111111111 ext4: fix inode locking (dev@kernel.org)\n"))
+	// The same commit is not reported again.
+	c.expectOK(c.client.UploadWatchResults([]dashapi.WatchResult{result}))
+	c.expectNoEmail()
+
+	page, err = c.AuthGET(AccessUser, bugLink(id))
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "ext4: fix inode locking"))
+	c.expectTrue(strings.Contains(string(page), `stop emails`))
+
+	// The number of watched paths is limited.
+	checkRedirect(c, AccessUser, "/watch?action=watch&paths=a.c+b.c&id="+id, bugLink(id), http.StatusFound)
+	checkResponseStatusCode(c, AccessUser, "/watch?action=watch&paths=c.c&id="+id, http.StatusBadRequest)
+
+	// Unwatching the path drops its changes.
+	checkRedirect(c, AccessUser, "/watch?action=unwatch&path=fs/ext4/inode.c&id="+id,
+		bugLink(id), http.StatusFound)
+	watch, err := loadCommitWatch(c.ctx, id)
+	c.expectOK(err)
+	c.expectEQ(len(watch.Paths), maxWatchedPaths-1)
+	c.expectEQ(len(watch.Changes), 0)
+
+	// Closed bugs are not polled.
+	c.client.updateBug(rep.ID, dashapi.BugStatusInvalid, "")
+	resp, err = c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(len(resp.Watches), 0)
+}
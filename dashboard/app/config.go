@@ -8,7 +8,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/mail"
+	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/syzkaller/dashboard/dashapi"
@@ -37,6 +39,8 @@ type GlobalConfig struct {
 	Clients map[string]string
 	// List of emails blocked from issuing test requests.
 	EmailBlocklist []string
+	// Emails that must never be CCed just because they took part in a discussion.
+	DoNotContact []string
 	// Bug obsoleting settings. See ObsoletingConfig for details.
 	Obsoleting ObsoletingConfig
 	// Namespace that is shown by default (no namespace selected yet).
@@ -60,6 +64,79 @@ type GlobalConfig struct {
 	// Emails received via the addresses below will be attributed to the corresponding
 	// kind of Discussion.
 	DiscussionEmails []DiscussionEmailConfig
+	// Maximum number of discussion messages accepted from a source per hour.
+	// Messages beyond the quota are put aside and can be replayed later by an admin.
+	// If a source is not mentioned, defaultDiscussionQuota() is used.
+	DiscussionQuotas map[dashapi.DiscussionSource]int
+	// Periodic verification of per-bug discussion summaries.
+	DiscussionCheck DiscussionCheckConfig
+	// If set, requests of not logged in users and of API clients are rate limited (see rate_limit.go).
+	RateLimits *RateLimitConfig
+	// If set, the /metrics endpoint is also available with the "Authorization: Bearer <token>" header
+	// (see metrics.go). Admins can always access it.
+	MetricsToken string
+	// Detection of autoresponders that reply to every syzbot email (see email_loop.go).
+	EmailLoop EmailLoopConfig
+	// Corpus transfers between managers (see corpus_transfer.go). Disabled if nil.
+	CorpusTransfer *CorpusTransferConfig
+}
+
+// DiscussionCheckConfig configures the daily consistency check of discussion summaries.
+type DiscussionCheckConfig struct {
+	// The number of random bugs to verify per run (100 by default).
+	SampleSize int
+	// Summaries whose message counters differ less than this value are fixed automatically.
+	// Larger differences are only reported on the admin page. 0 disables auto-healing.
+	AutoHealThreshold int
+}
+
+// EmailLoopConfig regulates the quarantine of the senders of too many auto-generated emails.
+type EmailLoopConfig struct {
+	// A sender of more than Threshold auto-generated emails within Window is quarantined.
+	// The defaults are 20 emails and 1 hour.
+	Threshold int
+	Window    time.Duration
+	// The admins that are notified about the quarantined senders.
+	AlertEmails []string
+}
+
+// CorpusTransferConfig describes where the transferred corpora are kept.
+type CorpusTransferConfig struct {
+	// The GCS bucket for the corpora. The dashboard service account must be able to sign URLs for it.
+	Bucket string
+	// How long the signed upload/download URLs stay valid (6 hours by default).
+	URLExpiration time.Duration
+}
+
+// RateLimitConfig describes the request quotas.
+type RateLimitConfig struct {
+	// Per-IP limits for the requests of not logged in users. Classes without limits are not limited.
+	Classes map[RateLimitClass]RateLimit
+	// Requests from these addresses (IPs or CIDR ranges) are never limited.
+	Allowlist []string
+	// Per-client limits for the authenticated API clients.
+	// APIDefault applies to the clients that are not mentioned in APIClients, if set.
+	APIClients map[string]RateLimit
+	APIDefault *RateLimit
+}
+
+// RateLimitClass groups endpoints with a similar cost.
+type RateLimitClass string
+
+const (
+	// HTML pages.
+	RateLimitPages RateLimitClass = "pages"
+	// JSON exports of the pages (?json=1).
+	RateLimitJSON RateLimitClass = "json"
+	// Logs, reports, reproducers and other texts.
+	RateLimitText RateLimitClass = "text"
+)
+
+// RateLimit is a token bucket: PerMinute requests are allowed on average with bursts of up to Burst requests.
+type RateLimit struct {
+	PerMinute int
+	// Defaults to PerMinute.
+	Burst int
 }
 
 // Per-namespace config.
@@ -77,6 +154,9 @@ type Config struct {
 	// Per-namespace clients that act only on a particular namespace.
 	// The keys are client identities (names), the values are their passwords.
 	Clients map[string]string
+	// Clients (from Clients) that may close bugs via the bulk_update_bugs API.
+	// Such a client can close any bug of the namespace, so none may do it by default.
+	BulkUpdateClients []string
 	// A random string used for hashing, can be anything, but once fixed it can't
 	// be changed as it becomes a part of persistent bug identifiers.
 	Key string
@@ -106,10 +186,262 @@ type Config struct {
 	Repos []KernelRepo
 	// If not nil, bugs in this namespace will be exported to the specified Kcidb.
 	Kcidb *KcidbConfig
+	// Patchwork projects that are polled for patch series that fix bugs in this namespace.
+	Patchwork []PatchworkConfig
 	// Subsystems config.
 	Subsystems SubsystemsConfig
 	// Instead of Last acitivity, display Discussions on the main page.
 	DisplayDiscussions bool
+	// If set, bugs in this namespace are considered to be downstream copies of similar bugs
+	// from the specified namespace. Upstream discussions are then mentioned on bug pages
+	// and in reports. Both namespaces must belong to the same SimilarityDomain.
+	UpstreamNamespace string
+	// If set, syzbot replies with links to the reproducer when somebody asks for it
+	// in a discussion of a bug that has a reproducer.
+	ReplyToReproRequests bool
+	// If set, syzbot replies to the latest patch discussion of a bug once the bug
+	// is closed as fixed (i.e. the fix has reached all tested trees).
+	AnnounceLandedFixes bool
+	// If set, crash assets of closed bugs that are linked from external trackers are kept
+	// for this much longer. The assets of crashes whose logs and reproducers were downloaded
+	// within this period are kept as well.
+	ExternalAssetRetention time.Duration
+	// VMCoreAccessLevel is the access level required to see and download the vmcore excerpts
+	// of the crashes. The dumps contain kernel memory contents, so it's AccessAdmin by default.
+	VMCoreAccessLevel AccessLevel
+	// If set, namespace admins are alerted when the daily crash rate of a manager
+	// deviates too much from its usual rate.
+	CrashRateAlerts *CrashRateAlertConfig
+	// If set, syz-ci checks whether the fix commits of the namespace bugs
+	// have been backported to the specified stable branches.
+	Backports *BackportConfig
+	// If set, maintainers may subscribe to weekly digests of the bugs in their subsystems.
+	Digests *DigestConfig
+	// If set, syz-ci looks up the first release of the main repo that contains each fix commit,
+	// which makes it possible to list the bugs fixed between two releases (see /fixed_between).
+	TrackReleases bool
+	// If set, the oldest non-essential crash logs of the namespace are evicted ahead of
+	// the normal schedule once the namespace stores more than this many bytes.
+	StorageQuota int64
+	// If set, patches posted to the lore discussions of bugs with reproducers
+	// are tested automatically, without a "#syz test" command.
+	AutoPatchTesting bool
+	// InvalidReason is the policy for "#syz invalid" commands without a reason.
+	InvalidReason InvalidReasonPolicy
+	// If set, crashes observed by external CI systems (see ReportExternalObservation)
+	// are taken into account when bugs are obsoleted, just like crashes on the namespace managers.
+	CountExternalObservations bool
+	// If set, admins may generate links that give read-only access to a single bug page
+	// to people who otherwise have no access to it (see share_links.go).
+	ShareLinks *ShareLinkConfig
+	// If set, overrides the default crash retention policy for the namespace bugs
+	// (see crash_retention.go).
+	CrashRetention *CrashRetentionConfig
+	// If set, the time bugs wait for a decision in the moderation reportings is tracked
+	// (see moderation_sla.go).
+	ModerationSLA *ModerationSLAConfig
+	// If set, users may ask the namespace managers to focus fuzzing on a bug
+	// with "#syz focus" (see focus.go).
+	Focus *FocusConfig
+	// If set, users may ask to minimize the kernel config of the bug reproducer
+	// with "#syz minimize-config" (see config_minimize.go).
+	ConfigMinimization *ConfigMinimizationConfig
+	// If set, crashes of the listed types are also deduplicated by the top stack frames,
+	// not only by the title (see frame_dedup.go).
+	FrameDedup *FrameDedupConfig
+	// If set, the fixed state of bugs changes only after the fix has settled
+	// (see fix_hysteresis.go). Otherwise, a bug is fixed once all managers have the fix,
+	// and the first crash on a build with the fix creates a regression bug.
+	FixHysteresis *FixHysteresisConfig
+	// If set, reporting of new bugs is paused while the tree seems to be broken
+	// (see reporting_pause.go).
+	ReportingBreaker *ReportingBreakerConfig
+	// If set, new bugs are only reported during the specified days and hours,
+	// the bugs found outside of the window are queued (see reporting_window.go).
+	ReportingWindow *ReportingWindowConfig
+	// If set, the bug reports are split between variants of the report content
+	// (see report_experiments.go).
+	ReportExperiment *ReportExperimentConfig
+	// If set, new bugs of the low-severity crash classes are not reported individually,
+	// but are listed in weekly per-subsystem digests (see low_severity.go).
+	LowSeverity *LowSeverityConfig
+}
+
+// InvalidReasonPolicy regulates the invalidation of bugs by email commands without a reason.
+type InvalidReasonPolicy string
+
+const (
+	// The reason is not required.
+	InvalidReasonOptional InvalidReasonPolicy = ""
+	// The bug is invalidated, but the user is asked to give the reason next time.
+	InvalidReasonWarn InvalidReasonPolicy = "warn"
+	// The bug is not invalidated until the command is resent with a reason.
+	InvalidReasonReject InvalidReasonPolicy = "reject"
+)
+
+// DigestConfig configures the weekly per-subscriber bug digests.
+type DigestConfig struct {
+	// Secret is used to sign the subscription confirmation and unsubscribe links.
+	// Changing it invalidates the unsubscribe links in all previously sent digests.
+	Secret string
+	// Reported bugs that have not received any external reply for this long
+	// are listed as needing attention. Defaults to 2 weeks.
+	NoResponsePeriod time.Duration
+}
+
+// ShareLinkConfig configures the bug share links.
+type ShareLinkConfig struct {
+	// Secret is used to sign the links.
+	// Changing it invalidates all previously generated links.
+	Secret string
+	// MaxValidity is the longest validity period of a link. Defaults to 30 days.
+	MaxValidity time.Duration
+}
+
+// CrashRetentionConfig regulates how much crash history is stored for the namespace bugs.
+type CrashRetentionConfig struct {
+	// The number of the latest crashes with and without reproducers that are kept per bug.
+	// Defaults to the global limit.
+	MaxCrashes int
+	// If set, the logs of the crashes without reproducers are deleted after this many days.
+	// Reported crashes are never affected.
+	NoReproLogDays int
+	// If set, machine info dumps are not stored for the namespace crashes.
+	DropMachineInfo bool
+}
+
+// ModerationSLAConfig defines how long bugs may wait for a moderation decision.
+type ModerationSLAConfig struct {
+	// Bugs that wait longer are marked yellow and red on the moderation page.
+	// The defaults are 1 and 2 weeks.
+	Yellow time.Duration
+	Red    time.Duration
+	// Namespace admins that receive weekly emails about the bugs past the red threshold.
+	Emails []string
+}
+
+// FocusConfig regulates the focused fuzzing requests.
+type FocusConfig struct {
+	// The max number of bugs focused on at the same time. Defaults to 3.
+	MaxBugs int
+	// How long the managers prioritize the bug reproducer. Defaults to 1 day.
+	Duration time.Duration
+}
+
+// ConfigMinimizationConfig regulates the kernel config minimization requests.
+type ConfigMinimizationConfig struct {
+	// The max number of unfinished config minimization jobs in the namespace. Defaults to 3.
+	MaxPending int
+	// The min time between two requests for the same bug. Defaults to 2 weeks.
+	Cooldown time.Duration
+}
+
+// FixHysteresisConfig regulates the transitions between the fix pending, fixed and regressed states.
+type FixHysteresisConfig struct {
+	// The percentage of the namespace managers that must have the fix (100 by default).
+	Quorum int
+	// The bug is declared fixed once there were no crashes on builds with the fix for this long.
+	CleanPeriod time.Duration
+	// A fixed bug is reopened as a regression after this many crashes on builds with the fix (1 by default).
+	RegressionCrashes int
+}
+
+// ReportingBreakerConfig defines when the reporting of new bugs is paused automatically.
+type ReportingBreakerConfig struct {
+	// Namespace admins that are notified about pauses and resumes.
+	Emails []string
+	// Reporting is paused if there were at least MinNewBugs new bugs during the last day (10 by default),
+	// and that's NewBugsRatio times more than the median of the previous days (5 by default).
+	MinNewBugs   int
+	NewBugsRatio float64
+	// Reporting is also paused if most of the managers have been failing to build the kernel
+	// for this long (1 day by default).
+	BuildFailurePeriod time.Duration
+}
+
+// ReportingWindowConfig defines when new bugs may be reported.
+type ReportingWindowConfig struct {
+	// The time zone of the window, e.g. "Europe/Berlin". UTC by default.
+	TimeZone string
+	// The days of the week the window is open on. Monday to Friday by default.
+	Days []time.Weekday
+	// The window is open from StartHour to EndHour (exclusive) of the local time.
+	// The defaults are 9 and 17.
+	StartHour int
+	EndHour   int
+	// Bugs with reproducers whose titles start with one of these prefixes (e.g. "KASAN: use-after-free")
+	// are reported outside of the window as well.
+	UrgentCrashTypes []string
+	location         *time.Location
+}
+
+// LowSeverityConfig defines the crash classes that are only reported in digests.
+type LowSeverityConfig struct {
+	// New bugs without reproducers that match one of the rules are only listed in digests.
+	Rules []LowSeverityRule
+	// The digests are sent to the first reporting of the namespace if it's an email one,
+	// to these addresses and, if SubsystemLists is set, to the mailing lists of the subsystem.
+	Mailto         []string
+	SubsystemLists bool
+}
+
+type LowSeverityRule struct {
+	// Name identifies the rule on the bug page, e.g. "task-hung".
+	Name string
+	// Title is a regexp that is matched against the bug title, e.g. "^INFO: task hung".
+	Title   string
+	titleRe *regexp.Regexp
+}
+
+// ReportExperimentConfig splits the reported bugs between variants of the report content.
+type ReportExperimentConfig struct {
+	// Name identifies the experiment. Bugs keep the variant they were first reported with
+	// for as long as the experiment runs, changing the name starts a new experiment.
+	Name     string
+	Variants []ReportVariant
+}
+
+type ReportVariant struct {
+	Name string
+	// The percentage of the bugs that get the variant, the percentages must add up to 100.
+	Percent int
+	// Include the reproducer into the report instead of only linking it.
+	InlineRepro bool
+}
+
+// FrameDedupConfig regulates the deduplication of crashes by the top stack frames.
+type FrameDedupConfig struct {
+	// The crash title prefixes the deduplication is enabled for (e.g. "KASAN: ", "WARNING in ").
+	CrashTypes []string
+}
+
+// BackportConfig describes the stable branches that fixes are expected to be backported to.
+type BackportConfig struct {
+	Branches []BackportBranch
+	// Bugs whose fixes are still missing in some branches this long after the bugs were closed
+	// are listed on the missing backports page. Defaults to 4 weeks.
+	MissingAfter time.Duration
+}
+
+type BackportBranch struct {
+	URL    string
+	Branch string
+	// Alias is a short name of the branch displayed on the dashboard, e.g. "linux-6.1.y".
+	Alias string
+}
+
+// CrashRateAlertConfig describes when and where to send per-manager crash rate alerts.
+// The crashes of the previous day are compared with the median of the preceding 30 days.
+type CrashRateAlertConfig struct {
+	// Addresses of the namespace admins.
+	Emails []string
+	// An alert is sent if the rate is more than HighRatio times higher (10 by default)
+	// or LowRatio times lower (also 10 by default) than the baseline.
+	HighRatio float64
+	LowRatio  float64
+	// Managers with fewer daily crashes (both on the day and in the baseline) are not checked.
+	// The default value is 100.
+	MinCrashes int64
 }
 
 // DiscussionEmailConfig defines the correspondence between an email and a DiscussionSource.
@@ -234,6 +566,10 @@ type KernelRepo struct {
 	// This repository is no longer active and should not be polled for commits.
 	// It will only be used to display kernel aliases for older crashes.
 	Obsolete bool
+	// Mailing lists where patches for this repository are posted.
+	// A patch sent to such a list is assumed to target this repository,
+	// unless the list is shared with other repositories.
+	PatchLists []string
 }
 
 type CCConfig struct {
@@ -245,6 +581,13 @@ type CCConfig struct {
 	BuildMaintainers []string
 }
 
+type PatchworkConfig struct {
+	// URL is the base URL of the Patchwork instance, e.g. "https://patchwork.kernel.org".
+	URL string
+	// Project is the Patchwork project name, e.g. "netdevbpf".
+	Project string
+}
+
 type KcidbConfig struct {
 	// Origin is how this system identified in Kcidb, e.g. "syzbot_foobar".
 	Origin string
@@ -260,6 +603,7 @@ var (
 	namespaceNameRe = regexp.MustCompile("^[a-zA-Z0-9-_.]{4,32}$")
 	clientNameRe    = regexp.MustCompile("^[a-zA-Z0-9-_.]{4,100}$")
 	clientKeyRe     = regexp.MustCompile("^([a-zA-Z0-9]{16,128})|(" + regexp.QuoteMeta(auth.OauthMagic) + ".*)$")
+	experimentRe    = regexp.MustCompile("^[a-zA-Z0-9-_.]{1,32}$")
 )
 
 type (
@@ -302,10 +646,12 @@ func installConfig(cfg *GlobalConfig) {
 		panic("another config is already installed")
 	}
 	config = cfg
+	publicRateLimiter = newRateLimiter(cfg.RateLimits, memcacheRateLimitStore{})
 	initEmailReporting()
 	initHTTPHandlers()
 	initAPIHandlers()
 	initKcidb()
+	initPatchwork()
 }
 
 func checkConfig(cfg *GlobalConfig) {
@@ -318,6 +664,9 @@ func checkConfig(cfg *GlobalConfig) {
 	for i := range cfg.EmailBlocklist {
 		cfg.EmailBlocklist[i] = email.CanonicalEmail(cfg.EmailBlocklist[i])
 	}
+	for i := range cfg.DoNotContact {
+		cfg.DoNotContact[i] = email.CanonicalEmail(cfg.DoNotContact[i])
+	}
 	namespaces := make(map[string]bool)
 	clientNames := make(map[string]bool)
 	checkClients(clientNames, cfg.Clients)
@@ -329,7 +678,84 @@ func checkConfig(cfg *GlobalConfig) {
 	for ns, cfg := range cfg.Namespaces {
 		checkNamespace(ns, cfg, namespaces, clientNames)
 	}
+	for ns, nsCfg := range cfg.Namespaces {
+		checkUpstreamNamespace(ns, nsCfg, cfg.Namespaces)
+	}
 	checkDiscussionEmails(cfg.DiscussionEmails)
+	checkDiscussionQuotas(cfg.DiscussionQuotas)
+	checkRateLimits(cfg.RateLimits, clientNames)
+	checkEmailLoop(&cfg.EmailLoop)
+	checkCorpusTransfer(cfg.CorpusTransfer)
+}
+
+func checkCorpusTransfer(cfg *CorpusTransferConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.Bucket == "" || strings.Contains(cfg.Bucket, "/") {
+		panic(fmt.Sprintf("bad CorpusTransfer.Bucket %q", cfg.Bucket))
+	}
+	if cfg.URLExpiration == 0 {
+		cfg.URLExpiration = 6 * time.Hour
+	}
+	if cfg.URLExpiration < 0 {
+		panic("CorpusTransfer.URLExpiration must not be negative")
+	}
+}
+
+func checkEmailLoop(cfg *EmailLoopConfig) {
+	if cfg.Threshold == 0 {
+		cfg.Threshold = 20
+	}
+	if cfg.Window == 0 {
+		cfg.Window = time.Hour
+	}
+	if cfg.Threshold < 0 || cfg.Window < 0 {
+		panic("EmailLoop.Threshold and EmailLoop.Window must not be negative")
+	}
+	for _, email := range cfg.AlertEmails {
+		if _, err := mail.ParseAddress(email); err != nil {
+			panic(fmt.Sprintf("bad EmailLoop alert email %q: %v", email, err))
+		}
+	}
+}
+
+func checkRateLimits(cfg *RateLimitConfig, clientNames map[string]bool) {
+	if cfg == nil {
+		return
+	}
+	for class, limit := range cfg.Classes {
+		switch class {
+		case RateLimitPages, RateLimitJSON, RateLimitText:
+		default:
+			panic(fmt.Sprintf("RateLimits: unknown class %q", class))
+		}
+		cfg.Classes[class] = checkRateLimit(limit, string(class))
+	}
+	for _, addr := range cfg.Allowlist {
+		if parseIPNet(addr) == nil {
+			panic(fmt.Sprintf("RateLimits: bad allowlisted address %q", addr))
+		}
+	}
+	for client, limit := range cfg.APIClients {
+		if !clientNames[client] {
+			panic(fmt.Sprintf("RateLimits: unknown client %q", client))
+		}
+		cfg.APIClients[client] = checkRateLimit(limit, client)
+	}
+	if cfg.APIDefault != nil {
+		*cfg.APIDefault = checkRateLimit(*cfg.APIDefault, "APIDefault")
+	}
+}
+
+func checkRateLimit(limit RateLimit, what string) RateLimit {
+	if limit.PerMinute <= 0 || limit.Burst < 0 {
+		panic(fmt.Sprintf("RateLimits: bad %v limit %+v", what, limit))
+	}
+	if limit.Burst == 0 {
+		limit.Burst = limit.PerMinute
+	}
+	return limit
 }
 
 func checkDiscussionEmails(list []DiscussionEmailConfig) {
@@ -340,6 +766,24 @@ func checkDiscussionEmails(list []DiscussionEmailConfig) {
 			panic(fmt.Sprintf("duplicate %s in DiscussionEmails", email))
 		}
 		dup[email] = struct{}{}
+		impl := discussionSources[item.Source]
+		if impl == nil {
+			panic(fmt.Sprintf("unknown discussion source %q for %s", item.Source, email))
+		}
+		if err := impl.ValidateConfig(&item); err != nil {
+			panic(fmt.Sprintf("DiscussionEmails %s: %v", email, err))
+		}
+	}
+}
+
+func checkDiscussionQuotas(quotas map[dashapi.DiscussionSource]int) {
+	for source, quota := range quotas {
+		if discussionSources[source] == nil {
+			panic(fmt.Sprintf("unknown discussion source %q in DiscussionQuotas", source))
+		}
+		if quota <= 0 {
+			panic(fmt.Sprintf("DiscussionQuotas: bad quota %v for %q", quota, source))
+		}
 	}
 }
 
@@ -382,6 +826,11 @@ func checkNamespace(ns string, cfg *Config, namespaces, clientNames map[string]b
 		cfg.SimilarityDomain = ns
 	}
 	checkClients(clientNames, cfg.Clients)
+	for _, client := range cfg.BulkUpdateClients {
+		if _, ok := cfg.Clients[client]; !ok {
+			panic(fmt.Sprintf("%v: unknown bulk update client %q", ns, client))
+		}
+	}
 	for name, mgr := range cfg.Managers {
 		checkManager(ns, name, mgr)
 	}
@@ -404,9 +853,345 @@ func checkNamespace(ns string, cfg *Config, namespaces, clientNames map[string]b
 	if cfg.Kcidb != nil {
 		checkKcidb(ns, cfg.Kcidb)
 	}
+	checkPatchwork(ns, cfg.Patchwork)
 	checkKernelRepos(ns, cfg)
 	checkNamespaceReporting(ns, cfg)
+	checkVMCoreAccessLevel(ns, cfg)
 	checkSubsystems(ns, cfg)
+	checkCrashRateAlerts(ns, cfg.CrashRateAlerts)
+	checkBackports(ns, cfg.Backports)
+	checkDigests(ns, cfg)
+	checkShareLinks(ns, cfg.ShareLinks)
+	checkCrashRetention(ns, cfg.CrashRetention)
+	checkModerationSLA(ns, cfg)
+	checkFocus(ns, cfg.Focus)
+	checkConfigMinimization(ns, cfg.ConfigMinimization)
+	checkFrameDedup(ns, cfg.FrameDedup)
+	checkFixHysteresis(ns, cfg.FixHysteresis)
+	checkReportingBreaker(ns, cfg.ReportingBreaker)
+	checkReportingWindow(ns, cfg.ReportingWindow)
+	checkReportExperiment(ns, cfg.ReportExperiment)
+	checkLowSeverity(ns, cfg.LowSeverity)
+	if cfg.StorageQuota < 0 {
+		panic(fmt.Sprintf("%v: StorageQuota must not be negative", ns))
+	}
+	switch cfg.InvalidReason {
+	case InvalidReasonOptional, InvalidReasonWarn, InvalidReasonReject:
+	default:
+		panic(fmt.Sprintf("%v: unknown InvalidReason policy %q", ns, cfg.InvalidReason))
+	}
+}
+
+func checkVMCoreAccessLevel(ns string, cfg *Config) {
+	if cfg.VMCoreAccessLevel == 0 {
+		cfg.VMCoreAccessLevel = AccessAdmin
+	}
+	checkConfigAccessLevel(&cfg.VMCoreAccessLevel, cfg.AccessLevel, fmt.Sprintf("namespace %q vmcore", ns))
+}
+
+func checkDigests(ns string, cfg *Config) {
+	if cfg.Digests == nil {
+		return
+	}
+	if cfg.AccessLevel != AccessPublic {
+		panic(fmt.Sprintf("%v: Digests are only supported in public namespaces", ns))
+	}
+	if cfg.Subsystems.Service == nil {
+		panic(fmt.Sprintf("%v: Digests require Subsystems.Service", ns))
+	}
+	if len(cfg.Digests.Secret) < 16 {
+		panic(fmt.Sprintf("%v: Digests.Secret must be at least 16 characters long", ns))
+	}
+	if cfg.Digests.NoResponsePeriod == 0 {
+		cfg.Digests.NoResponsePeriod = 14 * 24 * time.Hour
+	}
+}
+
+func checkShareLinks(ns string, cfg *ShareLinkConfig) {
+	if cfg == nil {
+		return
+	}
+	if len(cfg.Secret) < 16 {
+		panic(fmt.Sprintf("%v: ShareLinks.Secret must be at least 16 characters long", ns))
+	}
+	if cfg.MaxValidity == 0 {
+		cfg.MaxValidity = 30 * 24 * time.Hour
+	}
+}
+
+func checkCrashRetention(ns string, cfg *CrashRetentionConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.MaxCrashes < 0 {
+		panic(fmt.Sprintf("%v: CrashRetention.MaxCrashes must not be negative", ns))
+	}
+	if cfg.NoReproLogDays < 0 {
+		panic(fmt.Sprintf("%v: CrashRetention.NoReproLogDays must not be negative", ns))
+	}
+}
+
+func checkModerationSLA(ns string, cfg *Config) {
+	sla := cfg.ModerationSLA
+	if sla == nil {
+		return
+	}
+	if len(cfg.Reporting) < 2 {
+		panic(fmt.Sprintf("%v: ModerationSLA requires a moderation reporting", ns))
+	}
+	if sla.Yellow == 0 {
+		sla.Yellow = 7 * 24 * time.Hour
+	}
+	if sla.Red == 0 {
+		sla.Red = 14 * 24 * time.Hour
+	}
+	if sla.Yellow < 0 || sla.Red <= sla.Yellow {
+		panic(fmt.Sprintf("%v: ModerationSLA thresholds must satisfy 0 < Yellow < Red", ns))
+	}
+	for _, email := range sla.Emails {
+		if _, err := mail.ParseAddress(email); err != nil {
+			panic(fmt.Sprintf("%v: bad ModerationSLA email %q: %v", ns, email, err))
+		}
+	}
+}
+
+func checkFocus(ns string, cfg *FocusConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.MaxBugs == 0 {
+		cfg.MaxBugs = 3
+	}
+	if cfg.Duration == 0 {
+		cfg.Duration = 24 * time.Hour
+	}
+	if cfg.MaxBugs < 0 || cfg.Duration < 0 {
+		panic(fmt.Sprintf("%v: Focus.MaxBugs and Focus.Duration must not be negative", ns))
+	}
+}
+
+func checkConfigMinimization(ns string, cfg *ConfigMinimizationConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.MaxPending == 0 {
+		cfg.MaxPending = 3
+	}
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = 14 * 24 * time.Hour
+	}
+	if cfg.MaxPending < 0 || cfg.Cooldown < 0 {
+		panic(fmt.Sprintf("%v: ConfigMinimization.MaxPending and Cooldown must not be negative", ns))
+	}
+}
+
+func checkFixHysteresis(ns string, cfg *FixHysteresisConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.Quorum == 0 {
+		cfg.Quorum = 100
+	}
+	if cfg.RegressionCrashes == 0 {
+		cfg.RegressionCrashes = 1
+	}
+	if cfg.Quorum < 0 || cfg.Quorum > 100 {
+		panic(fmt.Sprintf("%v: FixHysteresis.Quorum must be within [1, 100]", ns))
+	}
+	if cfg.CleanPeriod < 0 || cfg.RegressionCrashes < 0 {
+		panic(fmt.Sprintf("%v: FixHysteresis.CleanPeriod and RegressionCrashes must not be negative", ns))
+	}
+	if cfg.RegressionCrashes > maxFixedBuildCrashes {
+		panic(fmt.Sprintf("%v: FixHysteresis.RegressionCrashes must not exceed %v", ns, maxFixedBuildCrashes))
+	}
+}
+
+func checkReportingBreaker(ns string, cfg *ReportingBreakerConfig) {
+	if cfg == nil {
+		return
+	}
+	if len(cfg.Emails) == 0 {
+		panic(fmt.Sprintf("%v: ReportingBreaker.Emails must be set", ns))
+	}
+	for _, email := range cfg.Emails {
+		if _, err := mail.ParseAddress(email); err != nil {
+			panic(fmt.Sprintf("%v: bad ReportingBreaker email %q: %v", ns, email, err))
+		}
+	}
+	if cfg.MinNewBugs == 0 {
+		cfg.MinNewBugs = 10
+	}
+	if cfg.NewBugsRatio == 0 {
+		cfg.NewBugsRatio = 5
+	} else if cfg.NewBugsRatio <= 1 {
+		panic(fmt.Sprintf("%v: ReportingBreaker.NewBugsRatio must be > 1", ns))
+	}
+	if cfg.BuildFailurePeriod == 0 {
+		cfg.BuildFailurePeriod = 24 * time.Hour
+	}
+	if cfg.MinNewBugs < 0 || cfg.BuildFailurePeriod < 0 {
+		panic(fmt.Sprintf("%v: ReportingBreaker.MinNewBugs and BuildFailurePeriod must not be negative", ns))
+	}
+}
+
+func checkReportingWindow(ns string, cfg *ReportingWindowConfig) {
+	if cfg == nil {
+		return
+	}
+	loc, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		panic(fmt.Sprintf("%v: bad ReportingWindow.TimeZone %q: %v", ns, cfg.TimeZone, err))
+	}
+	cfg.location = loc
+	if len(cfg.Days) == 0 {
+		cfg.Days = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	}
+	for _, day := range cfg.Days {
+		if day < time.Sunday || day > time.Saturday {
+			panic(fmt.Sprintf("%v: bad ReportingWindow day %v", ns, int(day)))
+		}
+	}
+	if cfg.StartHour == 0 && cfg.EndHour == 0 {
+		cfg.StartHour, cfg.EndHour = 9, 17
+	}
+	if cfg.StartHour < 0 || cfg.StartHour >= cfg.EndHour || cfg.EndHour > 24 {
+		panic(fmt.Sprintf("%v: bad ReportingWindow hours %v-%v", ns, cfg.StartHour, cfg.EndHour))
+	}
+}
+
+func checkLowSeverity(ns string, cfg *LowSeverityConfig) {
+	if cfg == nil {
+		return
+	}
+	if len(cfg.Rules) == 0 {
+		panic(fmt.Sprintf("%v: LowSeverity has no rules", ns))
+	}
+	names := map[string]bool{}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Name == "" || names[rule.Name] {
+			panic(fmt.Sprintf("%v: empty or duplicate LowSeverity rule name %q", ns, rule.Name))
+		}
+		names[rule.Name] = true
+		re, err := regexp.Compile(rule.Title)
+		if err != nil || rule.Title == "" {
+			panic(fmt.Sprintf("%v: bad LowSeverity rule %v title %q: %v", ns, rule.Name, rule.Title, err))
+		}
+		rule.titleRe = re
+	}
+	for _, addr := range cfg.Mailto {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			panic(fmt.Sprintf("%v: bad LowSeverity email %q: %v", ns, addr, err))
+		}
+	}
+}
+
+func checkReportExperiment(ns string, cfg *ReportExperimentConfig) {
+	if cfg == nil {
+		return
+	}
+	if !experimentRe.MatchString(cfg.Name) {
+		panic(fmt.Sprintf("%v: bad ReportExperiment name %q", ns, cfg.Name))
+	}
+	names := map[string]bool{}
+	total := 0
+	for _, variant := range cfg.Variants {
+		if !experimentRe.MatchString(variant.Name) || names[variant.Name] {
+			panic(fmt.Sprintf("%v: bad or duplicate ReportExperiment variant %q", ns, variant.Name))
+		}
+		names[variant.Name] = true
+		if variant.Percent <= 0 {
+			panic(fmt.Sprintf("%v: ReportExperiment variant %v: Percent must be positive", ns, variant.Name))
+		}
+		total += variant.Percent
+	}
+	if total != 100 {
+		panic(fmt.Sprintf("%v: ReportExperiment variant percentages add up to %v, not 100", ns, total))
+	}
+}
+
+func checkFrameDedup(ns string, cfg *FrameDedupConfig) {
+	if cfg == nil {
+		return
+	}
+	if len(cfg.CrashTypes) == 0 {
+		panic(fmt.Sprintf("%v: FrameDedup.CrashTypes must not be empty", ns))
+	}
+	for _, prefix := range cfg.CrashTypes {
+		if prefix == "" {
+			panic(fmt.Sprintf("%v: FrameDedup.CrashTypes must not contain empty prefixes", ns))
+		}
+	}
+}
+
+func checkCrashRateAlerts(ns string, cfg *CrashRateAlertConfig) {
+	if cfg == nil {
+		return
+	}
+	if len(cfg.Emails) == 0 {
+		panic(fmt.Sprintf("%v: CrashRateAlerts.Emails must be set", ns))
+	}
+	for _, email := range cfg.Emails {
+		if _, err := mail.ParseAddress(email); err != nil {
+			panic(fmt.Sprintf("%v: bad CrashRateAlerts email %q: %v", ns, email, err))
+		}
+	}
+	if cfg.HighRatio == 0 {
+		cfg.HighRatio = 10
+	} else if cfg.HighRatio <= 1 {
+		panic(fmt.Sprintf("%v: CrashRateAlerts.HighRatio must be > 1", ns))
+	}
+	if cfg.LowRatio == 0 {
+		cfg.LowRatio = 10
+	} else if cfg.LowRatio <= 1 {
+		panic(fmt.Sprintf("%v: CrashRateAlerts.LowRatio must be > 1", ns))
+	}
+	if cfg.MinCrashes == 0 {
+		cfg.MinCrashes = 100
+	} else if cfg.MinCrashes < 0 {
+		panic(fmt.Sprintf("%v: CrashRateAlerts.MinCrashes must be > 0", ns))
+	}
+}
+
+func checkBackports(ns string, cfg *BackportConfig) {
+	if cfg == nil {
+		return
+	}
+	if len(cfg.Branches) == 0 {
+		panic(fmt.Sprintf("%v: Backports.Branches must be set", ns))
+	}
+	aliases := map[string]bool{}
+	for _, branch := range cfg.Branches {
+		if !vcs.CheckRepoAddress(branch.URL) {
+			panic(fmt.Sprintf("%v: bad backport repo URL %q", ns, branch.URL))
+		}
+		if !vcs.CheckBranch(branch.Branch) {
+			panic(fmt.Sprintf("%v: bad backport branch %q", ns, branch.Branch))
+		}
+		if branch.Alias == "" || aliases[branch.Alias] {
+			panic(fmt.Sprintf("%v: empty or duplicate backport branch alias %q", ns, branch.Alias))
+		}
+		aliases[branch.Alias] = true
+	}
+	if cfg.MissingAfter == 0 {
+		cfg.MissingAfter = 4 * 7 * 24 * time.Hour
+	} else if cfg.MissingAfter < 0 {
+		panic(fmt.Sprintf("%v: Backports.MissingAfter must be positive", ns))
+	}
+}
+
+func checkUpstreamNamespace(ns string, cfg *Config, namespaces map[string]*Config) {
+	if cfg.UpstreamNamespace == "" {
+		return
+	}
+	upstream := namespaces[cfg.UpstreamNamespace]
+	if upstream == nil || cfg.UpstreamNamespace == ns {
+		panic(fmt.Sprintf("%v: bad UpstreamNamespace %q", ns, cfg.UpstreamNamespace))
+	}
+	if upstream.SimilarityDomain != cfg.SimilarityDomain {
+		panic(fmt.Sprintf("%v: UpstreamNamespace %q is in a different SimilarityDomain",
+			ns, cfg.UpstreamNamespace))
+	}
 }
 
 func checkSubsystems(ns string, cfg *Config) {
@@ -565,6 +1350,18 @@ func checkKcidb(ns string, kcidb *KcidbConfig) {
 	}
 }
 
+func checkPatchwork(ns string, projects []PatchworkConfig) {
+	for _, pw := range projects {
+		u, err := url.Parse(pw.URL)
+		if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+			panic(fmt.Sprintf("%v: bad Patchwork URL %q", ns, pw.URL))
+		}
+		if pw.Project == "" {
+			panic(fmt.Sprintf("%v: empty Patchwork project for %v", ns, pw.URL))
+		}
+	}
+}
+
 func checkConfigAccessLevel(current *AccessLevel, parent AccessLevel, what string) {
 	verifyAccessLevel(parent)
 	if *current == 0 {
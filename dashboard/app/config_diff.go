@@ -0,0 +1,228 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/kconfig"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+// Prefixes of the sanitizer and debugging options (without CONFIG_) that may
+// affect whether and how a bug manifests itself.
+var configDriftOptions = []string{
+	"KASAN", "KMSAN", "KCSAN", "UBSAN", "KFENCE", "KCOV",
+	"LOCKDEP", "PROVE_", "DEBUG_", "FAULT_INJECTION", "FAIL_",
+	"SLUB_DEBUG", "HARDENED_USERCOPY", "BUG_ON_DATA_CORRUPTION",
+	"PANIC_ON_OOPS", "DETECT_HUNG_TASK", "SOFTLOCKUP_DETECTOR", "HARDLOCKUP_DETECTOR",
+}
+
+func isConfigDriftOption(name string) bool {
+	for _, prefix := range configDriftOptions {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// kernelConfigHash hashes the options of the config, so that configs that only differ
+// in comments (e.g. the compiler version) or in the order of options get the same hash.
+func kernelConfigHash(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	cf, err := kconfig.ParseConfigData(data, "config")
+	if err != nil {
+		return ""
+	}
+	var options []string
+	for _, cfg := range cf.Configs {
+		if cfg.Value != kconfig.No {
+			options = append(options, cfg.Name+"="+cfg.Value)
+		}
+	}
+	sort.Strings(options)
+	return hash.String([]byte(strings.Join(options, "\n")))
+}
+
+type uiConfigChange struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// configDiff describes how the options of the new config differ from the old one.
+type configDiff struct {
+	Total   int               // the number of all changed options
+	Changes []*uiConfigChange // only the changes of configDriftOptions
+}
+
+// diffKernelConfigs compares two configs, not set and missing options are considered equal.
+func diffKernelConfigs(oldData, newData []byte) (*configDiff, error) {
+	oldCf, err := kconfig.ParseConfigData(oldData, "old")
+	if err != nil {
+		return nil, err
+	}
+	newCf, err := kconfig.ParseConfigData(newData, "new")
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, cf := range []*kconfig.ConfigFile{oldCf, newCf} {
+		for _, cfg := range cf.Configs {
+			names[cfg.Name] = true
+		}
+	}
+	ret := new(configDiff)
+	for name := range names {
+		oldVal, newVal := oldCf.Value(name), newCf.Value(name)
+		if oldVal == newVal {
+			continue
+		}
+		ret.Total++
+		if !isConfigDriftOption(name) {
+			continue
+		}
+		ret.Changes = append(ret.Changes, &uiConfigChange{
+			Name: "CONFIG_" + name,
+			Old:  displayConfigValue(oldVal),
+			New:  displayConfigValue(newVal),
+		})
+	}
+	sort.Slice(ret.Changes, func(i, j int) bool {
+		return ret.Changes[i].Name < ret.Changes[j].Name
+	})
+	return ret, nil
+}
+
+func displayConfigValue(val string) string {
+	if val == kconfig.No {
+		return "not set"
+	}
+	return val
+}
+
+type uiConfigDrift struct {
+	Manager         string
+	CrashConfigLink string
+	LatestTime      time.Time
+	LatestLink      string
+	Total           int
+	Changes         []*uiConfigChange
+}
+
+// Config diffs never change, so it's fine to keep them in memcache for long.
+const configDiffCacheExpiration = 7 * 24 * time.Hour
+
+// loadConfigDrift compares the config of the build of the crash with the config
+// of the latest build of the same manager. It returns nil if the configs are the same.
+func loadConfigDrift(c context.Context, build *Build) (*uiConfigDrift, error) {
+	latest, err := lastManagerBuild(c, build.Namespace, build.Manager)
+	if err != nil {
+		// The manager might have been removed since then.
+		log.Infof(c, "no latest build for %v/%v: %v", build.Namespace, build.Manager, err)
+		return nil, nil
+	}
+	if latest.ID == build.ID || latest.KernelConfig == build.KernelConfig ||
+		build.KernelConfig == 0 || latest.KernelConfig == 0 {
+		return nil, nil
+	}
+	if build.KernelConfigHash != "" && build.KernelConfigHash == latest.KernelConfigHash {
+		return nil, nil
+	}
+	diff, err := cachedConfigDiff(c, build.KernelConfig, latest.KernelConfig)
+	if err != nil {
+		return nil, err
+	}
+	if diff.Total == 0 {
+		return nil, nil
+	}
+	return &uiConfigDrift{
+		Manager:         build.Manager,
+		CrashConfigLink: textLink(textKernelConfig, build.KernelConfig),
+		LatestTime:      latest.Time,
+		LatestLink:      textLink(textKernelConfig, latest.KernelConfig),
+		Total:           diff.Total,
+		Changes:         diff.Changes,
+	}, nil
+}
+
+// cachedConfigDiff lazily computes the diff of the two kernel config texts.
+// Config texts are deduplicated, so their IDs identify the contents.
+func cachedConfigDiff(c context.Context, oldID, newID int64) (*configDiff, error) {
+	cacheKey := fmt.Sprintf("config-diff-%v-%v", oldID, newID)
+	diff := new(configDiff)
+	_, err := memcache.Gob.Get(c, cacheKey, diff)
+	if err == nil {
+		return diff, nil
+	}
+	if err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to get cached config diff: %v", err)
+	}
+	oldData, _, err := getText(c, textKernelConfig, oldID)
+	if err != nil {
+		return nil, err
+	}
+	newData, _, err := getText(c, textKernelConfig, newID)
+	if err != nil {
+		return nil, err
+	}
+	diff, err = diffKernelConfigs(oldData, newData)
+	if err != nil {
+		return nil, err
+	}
+	item := &memcache.Item{
+		Key:        cacheKey,
+		Object:     diff,
+		Expiration: configDiffCacheExpiration,
+	}
+	if err := memcache.Gob.Set(c, item); err != nil {
+		log.Errorf(c, "failed to cache config diff: %v", err)
+	}
+	return diff, nil
+}
+
+// Options (without CONFIG_) that custom configs of test requests must enable
+// for syzkaller reproducers to work at all.
+var testConfigRequired = []string{"DEBUG_KERNEL", "KCOV"}
+
+// Sanitizers that detect bugs. If the config the bug was found with enables one of them,
+// so must the custom config, otherwise the bug may just go unnoticed.
+var testConfigSanitizers = []string{"KASAN", "KMSAN", "KCSAN", "UBSAN", "KFENCE", "PROVE_LOCKING"}
+
+// missingTestConfigOptions returns the options (with CONFIG_) that the custom config of
+// a test request lacks. The original config is the one the bug was found with, it's optional.
+func missingTestConfigOptions(customData, origData []byte) ([]string, error) {
+	custom, err := kconfig.ParseConfigData(customData, "custom")
+	if err != nil {
+		return nil, err
+	}
+	required := append([]string{}, testConfigRequired...)
+	if len(origData) != 0 {
+		orig, err := kconfig.ParseConfigData(origData, "original")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range testConfigSanitizers {
+			if orig.Value(name) == kconfig.Yes {
+				required = append(required, name)
+			}
+		}
+	}
+	var missing []string
+	for _, name := range required {
+		if custom.Value(name) != kconfig.Yes {
+			missing = append(missing, "CONFIG_"+name)
+		}
+	}
+	return missing, nil
+}
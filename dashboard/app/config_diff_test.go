@@ -0,0 +1,144 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKernelConfigHash(t *testing.T) {
+	base := kernelConfigHash([]byte(`
+# Compiler: gcc 10
+CONFIG_KASAN=y
+CONFIG_NET=y
+# CONFIG_KCSAN is not set
+`))
+	same := kernelConfigHash([]byte(`
+# Compiler: gcc 12
+CONFIG_NET=y
+CONFIG_KASAN=y
+`))
+	different := kernelConfigHash([]byte(`
+CONFIG_NET=y
+CONFIG_KASAN=m
+`))
+	if base == "" || base != same {
+		t.Fatalf("configs that only differ in comments have different hashes: %q %q", base, same)
+	}
+	if base == different {
+		t.Fatalf("different configs have the same hash %q", base)
+	}
+	if hash := kernelConfigHash(nil); hash != "" {
+		t.Fatalf("empty config has hash %q", hash)
+	}
+}
+
+func TestDiffKernelConfigs(t *testing.T) {
+	diff, err := diffKernelConfigs([]byte(`
+CONFIG_KASAN=y
+CONFIG_KASAN_INLINE=y
+CONFIG_DEBUG_INFO=y
+CONFIG_NET=y
+CONFIG_USB=y
+# CONFIG_KCOV is not set
+CONFIG_LOCKDEP=y
+`), []byte(`
+# CONFIG_KASAN is not set
+CONFIG_DEBUG_INFO=y
+CONFIG_NET=m
+CONFIG_KMSAN=y
+CONFIG_LOCKDEP=y
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &configDiff{
+		Total: 5,
+		Changes: []*uiConfigChange{
+			{Name: "CONFIG_KASAN", Old: "y", New: "not set"},
+			{Name: "CONFIG_KASAN_INLINE", Old: "y", New: "not set"},
+			{Name: "CONFIG_KMSAN", Old: "not set", New: "y"},
+		},
+	}
+	if d := cmp.Diff(want, diff); d != "" {
+		t.Fatal(d)
+	}
+}
+
+func TestBugPageConfigDrift(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build1 := testBuild(1)
+	build1.KernelConfig = []byte("CONFIG_KASAN=y\nCONFIG_NET=y\n")
+	c.client.UploadBuild(build1)
+	c.client.ReportCrash(testCrash(build1, 1))
+	rep := c.client.pollBug()
+
+	// No section while the crash happened on the latest build.
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("Kernel config changes")))
+
+	build2 := testBuild(1)
+	build2.ID = "build2"
+	build2.KernelConfig = []byte("# Compiler: gcc 12\nCONFIG_NET=y\nCONFIG_KASAN=y\n")
+	c.client.UploadBuild(build2)
+	page, err = c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("Kernel config changes")))
+
+	build3 := testBuild(1)
+	build3.ID = "build3"
+	build3.KernelConfig = []byte("CONFIG_KMSAN=y\nCONFIG_NET=m\n")
+	c.client.UploadBuild(build3)
+	page, err = c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Kernel config changes since the crash (3)")))
+	c.expectTrue(bytes.Contains(page, []byte("CONFIG_KASAN")))
+	c.expectTrue(bytes.Contains(page, []byte("CONFIG_KMSAN")))
+	c.expectTrue(!bytes.Contains(page, []byte("CONFIG_NET")))
+}
+
+func TestMissingTestConfigOptions(t *testing.T) {
+	orig := []byte(`
+CONFIG_DEBUG_KERNEL=y
+CONFIG_KCOV=y
+CONFIG_KASAN=y
+CONFIG_PROVE_LOCKING=y
+# CONFIG_KMSAN is not set
+`)
+	tests := []struct {
+		custom  string
+		orig    []byte
+		missing []string
+	}{
+		{
+			custom: "CONFIG_DEBUG_KERNEL=y\nCONFIG_KCOV=y\nCONFIG_KASAN=y\nCONFIG_PROVE_LOCKING=y\n",
+			orig:   orig,
+		},
+		{
+			custom:  "CONFIG_KCOV=m\nCONFIG_KASAN=y\n# CONFIG_PROVE_LOCKING is not set\n",
+			orig:    orig,
+			missing: []string{"CONFIG_DEBUG_KERNEL", "CONFIG_KCOV", "CONFIG_PROVE_LOCKING"},
+		},
+		{
+			// Without the original config, only the always required options are checked.
+			custom:  "CONFIG_DEBUG_KERNEL=y\n",
+			missing: []string{"CONFIG_KCOV"},
+		},
+	}
+	for i, test := range tests {
+		missing, err := missingTestConfigOptions([]byte(test.custom), test.orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.missing, missing); diff != "" {
+			t.Errorf("#%v: %s", i, diff)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Developers often can't reproduce a bug with their own kernel config. Users may ask to minimize
+// the kernel config of a bug with a reliable reproducer (with "#syz minimize-config" or
+// the bug page button). The request creates a JobMinimizeConfig job that syz-ci executes with
+// the bisection machinery: the enabled config options are halved against the manager baseline
+// config on the original kernel commit as long as the reproducer still triggers the crash.
+// The result is uploaded as a MinimizedConfig crash asset, which is linked on the bug page
+// and in the reminder emails.
+// The jobs take hours of VM time, so the requests are limited per bug and per namespace
+// (see ConfigMinimizationConfig).
+
+type ConfigMinimizeDeniedError struct {
+	message string
+}
+
+func (e *ConfigMinimizeDeniedError) Error() string {
+	return e.message
+}
+
+// checkConfigMinimizeRequest returns a non-empty reason if the config of the bug can't be minimized now.
+func checkConfigMinimizeRequest(bug *Bug, now time.Time) string {
+	cfg := config.Namespaces[bug.Namespace].ConfigMinimization
+	switch {
+	case cfg == nil:
+		return "Kernel config minimization is not enabled for this namespace."
+	case bug.Status != BugStatusOpen:
+		return "The bug is already closed."
+	case bug.ReproLevel == ReproLevelNone || bug.ReproRevoked:
+		return "The bug has no reliable reproducer."
+	case now.Sub(bug.ConfigMinimizeRequested) < cfg.Cooldown:
+		return fmt.Sprintf("The config minimization was already requested %v ago,"+
+			" the next request is possible in %v.",
+			now.Sub(bug.ConfigMinimizeRequested).Truncate(time.Minute),
+			bug.ConfigMinimizeRequested.Add(cfg.Cooldown).Sub(now).Truncate(time.Minute))
+	}
+	return ""
+}
+
+func requestConfigMinimization(c context.Context, bugKey *db.Key, user, link string) error {
+	bug := new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return fmt.Errorf("failed to get bug: %v", err)
+	}
+	now := timeNow(c)
+	if reason := checkConfigMinimizeRequest(bug, now); reason != "" {
+		return &ConfigMinimizeDeniedError{reason}
+	}
+	crash, crashKey, err := findCrashForBug(c, bug)
+	if err != nil {
+		return err
+	}
+	if crash.ReproSyz == 0 || crash.ReproIsRevoked {
+		return &ConfigMinimizeDeniedError{"The bug has no reliable reproducer."}
+	}
+	pending, err := pendingConfigMinimizations(c, bug.Namespace)
+	if err != nil {
+		return err
+	}
+	cfg := config.Namespaces[bug.Namespace].ConfigMinimization
+	if pending >= cfg.MaxPending {
+		return &ConfigMinimizeDeniedError{fmt.Sprintf("There are already %v config minimizations"+
+			" in progress, please try again later.", pending)}
+	}
+	build, err := loadBuild(c, bug.Namespace, crash.BuildID)
+	if err != nil {
+		return err
+	}
+	manager, _ := activeManager(crash.Manager, bug.Namespace)
+	job := &Job{
+		Type:         JobMinimizeConfig,
+		Created:      now,
+		User:         user,
+		Link:         link,
+		Namespace:    bug.Namespace,
+		Manager:      manager,
+		KernelRepo:   build.KernelRepo,
+		KernelBranch: build.KernelBranch,
+		BugTitle:     bug.displayTitle(),
+		CrashID:      crashKey.IntID(),
+		ReproLevel:   crash.reproLevel(),
+	}
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %v", err)
+		}
+		if reason := checkConfigMinimizeRequest(bug, now); reason != "" {
+			return &ConfigMinimizeDeniedError{reason}
+		}
+		bug.ConfigMinimizeRequested = now
+		jobKey := db.NewIncompleteKey(c, "Job", bugKey)
+		jobKey, err := db.Put(c, jobKey, job)
+		if err != nil {
+			return fmt.Errorf("failed to put job: %v", err)
+		}
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %v", err)
+		}
+		return addCrashReference(c, job.CrashID, bugKey,
+			CrashReference{CrashReferenceJob, extJobID(jobKey), now})
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{XG: true, Attempts: 10})
+}
+
+// pendingConfigMinimizations returns the number of unfinished config minimization jobs in the namespace.
+func pendingConfigMinimizations(c context.Context, ns string) (int, error) {
+	var jobs []*Job
+	_, err := db.NewQuery("Job").
+		Filter("Namespace=", ns).
+		Filter("Finished=", time.Time{}).
+		GetAll(c, &jobs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	pending := 0
+	for _, job := range jobs {
+		if job.Type == JobMinimizeConfig {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// updateBugConfigMinimization records the results of a config minimization job,
+// it's called in the doneJob transaction.
+func updateBugConfigMinimization(c context.Context, job *Job, jobKey *db.Key, req *dashapi.JobDoneReq,
+	now time.Time) error {
+	bug := new(Bug)
+	bugKey := jobKey.Parent()
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return fmt.Errorf("job %v: failed to get bug: %v", req.ID, err)
+	}
+	bug.ConfigMinimizeFinished = now
+	var minimized *Asset
+	for _, newAsset := range req.Assets {
+		if newAsset.Type != dashapi.MinimizedConfig || len(req.Error) != 0 {
+			continue
+		}
+		asset, err := parseIncomingAsset(c, newAsset)
+		if err != nil {
+			return fmt.Errorf("job %v: %w", req.ID, err)
+		}
+		minimized = &asset
+	}
+	// If there's no asset, the config could not be minimized.
+	if minimized != nil {
+		crash := new(Crash)
+		crashKey := db.NewKey(c, "Crash", "", job.CrashID, bugKey)
+		if err := db.Get(c, crashKey, crash); err != nil {
+			return fmt.Errorf("job %v: failed to get crash: %v", req.ID, err)
+		}
+		var assets []Asset
+		for _, asset := range crash.Assets {
+			if asset.Type != dashapi.MinimizedConfig {
+				assets = append(assets, asset)
+			}
+		}
+		crash.Assets = append(assets, *minimized)
+		if _, err := db.Put(c, crashKey, crash); err != nil {
+			return fmt.Errorf("failed to put crash: %v", err)
+		}
+		bug.MinimizedConfig = minimized.DownloadURL
+	}
+	if _, err := db.Put(c, bugKey, bug); err != nil {
+		return fmt.Errorf("failed to put bug: %v", err)
+	}
+	// The results are visible on the bug page, there's nothing to report.
+	job.Reported = true
+	return nil
+}
+
+// handleMinimizeConfig serves the "minimize config" button on the bug page.
+func handleMinimizeConfig(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
+	if accessLevel < AccessUser {
+		return ErrAccess
+	}
+	if err := checkNamespaceAccessLevel(c, r, bug.Namespace, bug.sanitizeAccess(accessLevel)); err != nil {
+		return err
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	err = requestConfigMinimization(c, bug.key(c), author, "")
+	if _, ok := err.(*ConfigMinimizeDeniedError); ok {
+		return fmt.Errorf("%v %w", err, ErrClientBadRequest)
+	} else if err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
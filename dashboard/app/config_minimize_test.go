@@ -0,0 +1,124 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestCheckConfigMinimizeRequest(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	const ns = "access-public-email"
+	cooldown := config.Namespaces[ns].ConfigMinimization.Cooldown
+	tests := []struct {
+		bug    *Bug
+		denied bool
+	}{
+		{&Bug{Namespace: ns, Status: BugStatusOpen, ReproLevel: ReproLevelSyz}, false},
+		{&Bug{Namespace: ns, Status: BugStatusOpen, ReproLevel: ReproLevelC,
+			ConfigMinimizeRequested: now.Add(-cooldown)}, false},
+		{&Bug{Namespace: ns, Status: BugStatusOpen, ReproLevel: ReproLevelSyz,
+			ConfigMinimizeRequested: now.Add(-cooldown + time.Hour)}, true},
+		{&Bug{Namespace: ns, Status: BugStatusOpen, ReproLevel: ReproLevelNone}, true},
+		{&Bug{Namespace: ns, Status: BugStatusOpen, ReproLevel: ReproLevelSyz, ReproRevoked: true}, true},
+		{&Bug{Namespace: ns, Status: BugStatusFixed, ReproLevel: ReproLevelSyz}, true},
+		{&Bug{Namespace: "test1", Status: BugStatusOpen, ReproLevel: ReproLevelSyz}, true},
+	}
+	for i, test := range tests {
+		if reason := checkConfigMinimizeRequest(test.bug, now); (reason != "") != test.denied {
+			t.Errorf("test #%v: got %q, want denied=%v", i, reason, test.denied)
+		}
+	}
+	reason := checkConfigMinimizeRequest(tests[2].bug, now)
+	if !strings.Contains(reason, "the next request is possible in 1h0m0s") {
+		t.Errorf("bad cooldown reason: %q", reason)
+	}
+}
+
+func TestConfigMinimizeJob(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.makeClient(clientPublicEmail, keyPublicEmail, true)
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	crash.ReproOpts = []byte("repro opts")
+	crash.ReproSyz = []byte("getpid()\n")
+	client.ReportCrash(crash)
+	sender := c.pollEmailBug().Sender
+	_, extID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	crash2 := testCrash(build, 2)
+	crash2.ReproOpts = []byte("repro opts")
+	crash2.ReproSyz = []byte("syncfs(1)\n")
+	client.ReportCrash(crash2)
+	sender2 := c.pollEmailBug().Sender
+
+	c.incomingEmail(sender, "#syz minimize-config\n", EmailOptFrom("dev@kernel.org"))
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "I've queued the minimization of the kernel config."))
+
+	// Only one config minimization may be pending in the namespace.
+	c.incomingEmail(sender2, "#syz minimize-config\n", EmailOptFrom("dev@kernel.org"))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "There are already 1 config minimizations in progress"))
+
+	// Config minimization jobs are only given to managers that support them.
+	resp := client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{Minimize: true})
+	c.expectEQ(resp.ID, "")
+	resp = client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{MinimizeConfig: true})
+	c.expectNE(resp.ID, "")
+	c.expectEQ(resp.Type, dashapi.JobMinimizeConfig)
+	c.expectEQ(resp.ReproSyz, crash.ReproSyz)
+	c.expectEQ(resp.KernelConfig, build.KernelConfig)
+
+	page, err := c.AuthGET(AccessUser, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "config minimization requested"))
+
+	const configURL = "http://google.com/minimized-config"
+	jobBuild := testBuild(2)
+	jobBuild.ID = resp.ID
+	jobBuild.KernelConfig = []byte("CONFIG_KASAN=y\n")
+	c.expectOK(client.JobDone(&dashapi.JobDoneReq{
+		ID:          resp.ID,
+		Build:       *jobBuild,
+		CrashTitle:  crash.Title,
+		CrashLog:    []byte("crash log"),
+		CrashReport: []byte("crash report"),
+		Assets: []dashapi.NewAsset{{
+			Type:        dashapi.MinimizedConfig,
+			DownloadURL: configURL,
+		}},
+	}))
+	bug, bestCrash, _ := c.loadBug(extID)
+	c.expectEQ(bug.MinimizedConfig, configURL)
+	c.expectEQ(len(bestCrash.Assets), 1)
+	c.expectEQ(bestCrash.Assets[0].Type, dashapi.MinimizedConfig)
+
+	page, err = c.AuthGET(AccessUser, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), configURL))
+	c.expectTrue(!strings.Contains(string(page), "config minimization requested"))
+	c.expectTrue(!strings.Contains(string(page), "minimize config"))
+
+	// After the cooldown the request can be repeated from the bug page.
+	c.advanceTime(config.Namespaces[bug.Namespace].ConfigMinimization.Cooldown)
+	page, err = c.AuthGET(AccessUser, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "minimize config"))
+	checkRedirect(c, AccessUser, "/minimize_config?id="+bug.keyHash(), bugLink(bug.keyHash()),
+		http.StatusFound)
+	_, err = c.AuthGET(AccessUser, "/minimize_config?id="+bug.keyHash())
+	c.expectTrue(err != nil)
+}
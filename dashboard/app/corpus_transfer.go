@@ -0,0 +1,345 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// A new namespace (e.g. for a downstream kernel) reaches good coverage much faster
+// if its managers start with the corpus of an existing manager. Admins request
+// "import the corpus of manager X into manager Y" on the admin page (CorpusImport).
+// The managers periodically report their corpus (report_corpus API). Once the source
+// manager reports, the dashboard gives it a signed GCS URL to upload its corpus to;
+// after the upload the corpus is offered to the target manager with a signed download URL.
+// The target manager reports the result with corpus_import_done. The dashboard never
+// touches the programs, it only brokers the URLs.
+// A corpus may only move to a namespace that is at least as restricted as its own,
+// so that corpora of private namespaces never leak to more public ones.
+
+// Imports that were offered, but were not finished, are offered again after the URL expires.
+const maxCorpusImportAttempts = 3
+
+var corpusDigestRe = regexp.MustCompile(`^[a-zA-Z0-9_\-]{1,64}$`)
+
+// Overridable for testing.
+var signCorpusURL = func(c context.Context, bucket, object, method string, expires time.Time) (string, error) {
+	account, err := appengine.ServiceAccount(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to query the service account: %w", err)
+	}
+	return storage.SignedURL(bucket, object, &storage.SignedURLOptions{
+		GoogleAccessID: account,
+		SignBytes: func(data []byte) ([]byte, error) {
+			_, signature, err := appengine.SignBytes(c, data)
+			return signature, err
+		},
+		Method:  method,
+		Expires: expires,
+		Scheme:  storage.SigningSchemeV4,
+	})
+}
+
+func corpusObject(ns, manager, digest string) string {
+	return fmt.Sprintf("corpus/%v/%v/%v.db", ns, manager, digest)
+}
+
+// checkCorpusTransferAccess verifies that the corpus of the source namespace may be imported into the target one.
+func checkCorpusTransferAccess(source, target string) error {
+	srcCfg, dstCfg := config.Namespaces[source], config.Namespaces[target]
+	if srcCfg == nil || dstCfg == nil {
+		return fmt.Errorf("%w: unknown namespace", ErrClientBadRequest)
+	}
+	if dstCfg.Decommissioned {
+		return fmt.Errorf("%w: namespace %v is decommissioned", ErrClientBadRequest, target)
+	}
+	if dstCfg.AccessLevel < srcCfg.AccessLevel {
+		return fmt.Errorf("%w: the corpus of %v can't be imported into the less restricted %v",
+			ErrClientBadRequest, source, target)
+	}
+	return nil
+}
+
+func apiReportCorpus(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	req := new(dashapi.CorpusReportReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	if req.Manager == "" || !corpusDigestRe.MatchString(req.Digest) ||
+		req.Exported != "" && !corpusDigestRe.MatchString(req.Exported) {
+		return nil, fmt.Errorf("bad corpus report: manager %q, digest %q, exported %q",
+			req.Manager, req.Digest, req.Exported)
+	}
+	now := timeNow(c)
+	exportDigest := ""
+	err := updateManager(c, ns, req.Manager, func(mgr *Manager, stats *ManagerStats) error {
+		mgr.CorpusDigest = req.Digest
+		mgr.CorpusPrograms = req.Programs
+		if req.Exported != "" {
+			mgr.CorpusExportDigest = req.Exported
+			mgr.CorpusExported = now
+		}
+		exportDigest = mgr.CorpusExportDigest
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := new(dashapi.CorpusReportResp)
+	cfg := config.CorpusTransfer
+	if cfg == nil {
+		return resp, nil
+	}
+	if err := exportCorpus(c, ns, req, exportDigest, resp); err != nil {
+		return nil, err
+	}
+	if resp.Import, err = offerCorpusImport(c, ns, req.Manager); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// exportCorpus requests an upload of the corpus if some imports wait for it,
+// or marks the imports ready if the corpus is already uploaded.
+func exportCorpus(c context.Context, ns string, req *dashapi.CorpusReportReq, exportDigest string,
+	resp *dashapi.CorpusReportResp) error {
+	var imports []*CorpusImport
+	keys, err := db.NewQuery("CorpusImport").
+		Filter("SourceNamespace=", ns).
+		Filter("SourceManager=", req.Manager).
+		GetAll(c, &imports)
+	if err != nil {
+		return fmt.Errorf("failed to query corpus imports: %w", err)
+	}
+	var waiting []*db.Key
+	for i, imp := range imports {
+		if imp.State == corpusImportWaiting {
+			waiting = append(waiting, keys[i])
+		}
+	}
+	if len(waiting) == 0 {
+		return nil
+	}
+	// An older export can be reused only if the corpus has not changed since then.
+	if exportDigest == "" || exportDigest != req.Digest && req.Exported == "" {
+		cfg := config.CorpusTransfer
+		resp.ExportURL, err = signCorpusURL(c, cfg.Bucket, corpusObject(ns, req.Manager, req.Digest),
+			http.MethodPut, timeNow(c).Add(cfg.URLExpiration))
+		if err != nil {
+			return fmt.Errorf("failed to sign the corpus upload URL: %w", err)
+		}
+		resp.ExportDigest = req.Digest
+		return nil
+	}
+	for _, key := range waiting {
+		err := updateCorpusImport(c, key, func(imp *CorpusImport) error {
+			if imp.State != corpusImportWaiting {
+				return nil
+			}
+			imp.State = corpusImportReady
+			imp.Digest = exportDigest
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// offerCorpusImport returns the next corpus the manager should import, if any.
+func offerCorpusImport(c context.Context, ns, manager string) (*dashapi.CorpusImport, error) {
+	var imports []*CorpusImport
+	keys, err := db.NewQuery("CorpusImport").
+		Filter("Namespace=", ns).
+		Filter("Manager=", manager).
+		GetAll(c, &imports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query corpus imports: %w", err)
+	}
+	cfg := config.CorpusTransfer
+	now := timeNow(c)
+	for i, imp := range imports {
+		stale := imp.State == corpusImportImporting && now.Sub(imp.Offered) > cfg.URLExpiration
+		if imp.State != corpusImportReady && !stale {
+			continue
+		}
+		var ret *dashapi.CorpusImport
+		err := updateCorpusImport(c, keys[i], func(imp *CorpusImport) error {
+			if imp.State != corpusImportReady && imp.State != corpusImportImporting {
+				return nil
+			}
+			// The namespace config could have changed since the import was requested.
+			if err := checkCorpusTransferAccess(imp.SourceNamespace, imp.Namespace); err != nil {
+				imp.State = corpusImportFailed
+				imp.Error = err.Error()
+				imp.Finished = now
+				return nil
+			}
+			if imp.Attempts >= maxCorpusImportAttempts {
+				imp.State = corpusImportFailed
+				imp.Error = "the manager did not report the import result"
+				imp.Finished = now
+				return nil
+			}
+			url, err := signCorpusURL(c, cfg.Bucket,
+				corpusObject(imp.SourceNamespace, imp.SourceManager, imp.Digest),
+				http.MethodGet, now.Add(cfg.URLExpiration))
+			if err != nil {
+				return fmt.Errorf("failed to sign the corpus download URL: %w", err)
+			}
+			imp.State = corpusImportImporting
+			imp.Offered = now
+			imp.Attempts++
+			ret = &dashapi.CorpusImport{
+				ID:     strconv.FormatInt(keys[i].IntID(), 10),
+				Source: imp.SourceNamespace + "/" + imp.SourceManager,
+				URL:    url,
+				Digest: imp.Digest,
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ret != nil {
+			// One import at a time.
+			return ret, nil
+		}
+	}
+	return nil, nil
+}
+
+func apiCorpusImportDone(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	req := new(dashapi.CorpusImportDoneReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	id, err := strconv.ParseInt(req.ID, 10, 64)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("bad corpus import id %q", req.ID)
+	}
+	now := timeNow(c)
+	key := db.NewKey(c, "CorpusImport", "", id, nil)
+	return nil, updateCorpusImport(c, key, func(imp *CorpusImport) error {
+		// Don't let managers of other namespaces learn about the import.
+		if imp.Namespace != ns || imp.Manager != req.Manager {
+			return fmt.Errorf("unknown corpus import %v", req.ID)
+		}
+		if imp.State != corpusImportImporting {
+			return fmt.Errorf("corpus import %v is %v", req.ID, imp.State)
+		}
+		imp.State = corpusImportDone
+		if req.Error != "" {
+			imp.State = corpusImportFailed
+		}
+		imp.Imported = req.Imported
+		imp.Error = req.Error
+		imp.Finished = now
+		return nil
+	})
+}
+
+func updateCorpusImport(c context.Context, key *db.Key, fn func(imp *CorpusImport) error) error {
+	tx := func(c context.Context) error {
+		imp := new(CorpusImport)
+		if err := db.Get(c, key, imp); err != nil {
+			if err == db.ErrNoSuchEntity {
+				return fmt.Errorf("unknown corpus import %v", key.IntID())
+			}
+			return fmt.Errorf("failed to get corpus import: %w", err)
+		}
+		if err := fn(imp); err != nil {
+			return err
+		}
+		if _, err := db.Put(c, key, imp); err != nil {
+			return fmt.Errorf("failed to put corpus import: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+// handleImportCorpus serves the import_corpus action of the admin page.
+func handleImportCorpus(c context.Context, r *http.Request) error {
+	if config.CorpusTransfer == nil {
+		return fmt.Errorf("%w: corpus transfers are not configured", ErrClientBadRequest)
+	}
+	imp := &CorpusImport{
+		Namespace:       r.FormValue("ns"),
+		Manager:         r.FormValue("manager"),
+		SourceNamespace: r.FormValue("source_ns"),
+		SourceManager:   r.FormValue("source_manager"),
+		State:           corpusImportWaiting,
+		Created:         timeNow(c),
+	}
+	if u := user.Current(c); u != nil {
+		imp.CreatedBy = u.Email
+	}
+	if err := checkCorpusTransferAccess(imp.SourceNamespace, imp.Namespace); err != nil {
+		return err
+	}
+	if imp.Namespace == imp.SourceNamespace && imp.Manager == imp.SourceManager {
+		return fmt.Errorf("%w: the source and the target managers are the same", ErrClientBadRequest)
+	}
+	for _, mgr := range [][2]string{{imp.Namespace, imp.Manager}, {imp.SourceNamespace, imp.SourceManager}} {
+		if err := db.Get(c, mgrKey(c, mgr[0], mgr[1]), new(Manager)); err != nil {
+			if err == db.ErrNoSuchEntity {
+				return fmt.Errorf("%w: unknown manager %v/%v", ErrClientBadRequest, mgr[0], mgr[1])
+			}
+			return fmt.Errorf("failed to get manager: %w", err)
+		}
+	}
+	var imports []*CorpusImport
+	_, err := db.NewQuery("CorpusImport").
+		Filter("Namespace=", imp.Namespace).
+		Filter("Manager=", imp.Manager).
+		GetAll(c, &imports)
+	if err != nil {
+		return fmt.Errorf("failed to query corpus imports: %w", err)
+	}
+	for _, other := range imports {
+		if other.Finished.IsZero() {
+			return fmt.Errorf("%w: %v/%v already has an unfinished import", ErrClientBadRequest,
+				imp.Namespace, imp.Manager)
+		}
+	}
+	if _, err := db.Put(c, db.NewIncompleteKey(c, "CorpusImport", nil), imp); err != nil {
+		return fmt.Errorf("failed to put corpus import: %w", err)
+	}
+	log.Infof(c, "%v requested the import of %v/%v into %v/%v", imp.CreatedBy,
+		imp.SourceNamespace, imp.SourceManager, imp.Namespace, imp.Manager)
+	return nil
+}
+
+// loadCorpusImportsUI returns the recent corpus imports for the admin page.
+func loadCorpusImportsUI(c context.Context) ([]*CorpusImport, error) {
+	var imports []*CorpusImport
+	_, err := db.NewQuery("CorpusImport").
+		Order("-Created").
+		Limit(20).
+		GetAll(c, &imports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query corpus imports: %w", err)
+	}
+	sort.SliceStable(imports, func(i, j int) bool {
+		// The unfinished ones first.
+		return imports[i].Finished.IsZero() && !imports[j].Finished.IsZero()
+	})
+	return imports, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestCorpusTransfer(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	const (
+		source    = "access-public-email"
+		importURL = "/admin?action=import_corpus&source_ns=access-public-email&source_manager=source" +
+			"&ns=test1&manager=target"
+	)
+	// The managers are created on the first report.
+	resp, err := c.publicClient.ReportCorpus(&dashapi.CorpusReportReq{Manager: "source", Digest: "s1", Programs: 100})
+	c.expectOK(err)
+	c.expectEQ(resp, &dashapi.CorpusReportResp{})
+	resp, err = c.client.ReportCorpus(&dashapi.CorpusReportReq{Manager: "target", Digest: "t1", Programs: 10})
+	c.expectOK(err)
+	c.expectEQ(resp, &dashapi.CorpusReportResp{})
+
+	// The corpus of a more restricted namespace can't go into a less restricted one.
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=import_corpus&source_ns=test1&source_manager=target"+
+		"&ns=access-public-email&manager=source")
+	c.expectBadReqest(err)
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=import_corpus&source_ns=access-public-email"+
+		"&source_manager=unknown&ns=test1&manager=target")
+	c.expectBadReqest(err)
+	_, err = c.AuthGET(AccessUser, importURL)
+	c.expectForbidden(err)
+	_, err = c.AuthGET(AccessAdmin, importURL)
+	c.expectOK(err)
+	_, err = c.AuthGET(AccessAdmin, importURL)
+	c.expectBadReqest(err)
+
+	// The target has nothing to import until the source uploads its corpus.
+	resp, err = c.client.ReportCorpus(&dashapi.CorpusReportReq{Manager: "target", Digest: "t1", Programs: 10})
+	c.expectOK(err)
+	c.expectEQ(resp, &dashapi.CorpusReportResp{})
+	resp, err = c.publicClient.ReportCorpus(&dashapi.CorpusReportReq{Manager: "source", Digest: "s2", Programs: 120})
+	c.expectOK(err)
+	c.expectEQ(resp, &dashapi.CorpusReportResp{
+		ExportURL:    "https://storage.googleapis.com/syzkaller-corpus/corpus/access-public-email/source/s2.db?method=PUT",
+		ExportDigest: "s2",
+	})
+	resp, err = c.publicClient.ReportCorpus(&dashapi.CorpusReportReq{Manager: "source", Digest: "s2", Programs: 120,
+		Exported: "s2"})
+	c.expectOK(err)
+	c.expectEQ(resp, &dashapi.CorpusReportResp{})
+
+	resp, err = c.client.ReportCorpus(&dashapi.CorpusReportReq{Manager: "target", Digest: "t1", Programs: 10})
+	c.expectOK(err)
+	imp := resp.Import
+	c.expectEQ(imp, &dashapi.CorpusImport{
+		ID:     imp.ID,
+		Source: source + "/source",
+		URL:    "https://storage.googleapis.com/syzkaller-corpus/corpus/access-public-email/source/s2.db?method=GET",
+		Digest: "s2",
+	})
+	// The import is offered only once while the URL is valid.
+	resp, err = c.client.ReportCorpus(&dashapi.CorpusReportReq{Manager: "target", Digest: "t1", Programs: 10})
+	c.expectOK(err)
+	c.expectEQ(resp.Import, (*dashapi.CorpusImport)(nil))
+
+	// Managers of other namespaces can't touch the import.
+	otherClient := c.makeClient(clientPublicEmail, keyPublicEmail, false)
+	c.expectFail("unknown corpus import", otherClient.CorpusImportDone(&dashapi.CorpusImportDoneReq{
+		ID:      imp.ID,
+		Manager: "target",
+	}))
+	c.expectOK(c.client.CorpusImportDone(&dashapi.CorpusImportDoneReq{
+		ID:       imp.ID,
+		Manager:  "target",
+		Imported: 80,
+	}))
+	var imports []*CorpusImport
+	_, err = db.NewQuery("CorpusImport").GetAll(c.ctx, &imports)
+	c.expectOK(err)
+	c.expectEQ(len(imports), 1)
+	c.expectEQ(imports[0].State, corpusImportDone)
+	c.expectEQ(imports[0].Imported, 80)
+	c.expectEQ(imports[0].Attempts, 1)
+
+	page, err := c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("access-public-email/source")))
+
+	// The uploaded corpus is reused while it does not change,
+	// and the import is offered again once the URL expires.
+	_, err = c.AuthGET(AccessAdmin, importURL)
+	c.expectOK(err)
+	resp, err = c.publicClient.ReportCorpus(&dashapi.CorpusReportReq{Manager: "source", Digest: "s2", Programs: 120})
+	c.expectOK(err)
+	c.expectEQ(resp, &dashapi.CorpusReportResp{})
+	resp, err = c.client.ReportCorpus(&dashapi.CorpusReportReq{Manager: "target", Digest: "t2", Programs: 90})
+	c.expectOK(err)
+	c.expectTrue(resp.Import != nil)
+	c.advanceTime(7 * time.Hour)
+	resp, err = c.client.ReportCorpus(&dashapi.CorpusReportReq{Manager: "target", Digest: "t2", Programs: 90})
+	c.expectOK(err)
+	c.expectTrue(resp.Import != nil)
+	c.expectOK(c.client.CorpusImportDone(&dashapi.CorpusImportDoneReq{
+		ID:      resp.Import.ID,
+		Manager: "target",
+		Error:   "failed to download the corpus",
+	}))
+	imports = nil
+	_, err = db.NewQuery("CorpusImport").Order("-Created").GetAll(c.ctx, &imports)
+	c.expectOK(err)
+	c.expectEQ(imports[0].State, corpusImportFailed)
+	c.expectEQ(imports[0].Attempts, 2)
+}
+
+func TestCorpusTransferAccess(t *testing.T) {
+	tests := []struct {
+		source string
+		target string
+		ok     bool
+	}{
+		{"access-public", "access-public-email", true},
+		{"access-public", "test1", true},
+		{"access-user", "test1", true},
+		{"test1", "test2", true},
+		{"test1", "access-user", false},
+		{"access-user", "access-public", false},
+		{"test1", "unknown", false},
+	}
+	for _, test := range tests {
+		err := checkCorpusTransferAccess(test.source, test.target)
+		if (err == nil) != test.ok {
+			t.Errorf("%v -> %v: got %v, want ok=%v", test.source, test.target, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+)
+
+// A manager stuck in a crash loop may upload thousands of identical crashes per hour for one bug.
+// Once the bug got more than crashCoalesceThreshold crashes with the same signature within an hour,
+// further such crashes are only counted in Bug.SuppressedCrashes. The first crash of every hourly
+// window is still processed as usual, so there's at least one full sample per hour.
+// Crashes with reproducers are never suppressed.
+
+const (
+	crashCoalesceWindow    = time.Hour
+	crashCoalesceThreshold = 100
+)
+
+// CrashWindow tracks the crashes of a bug with the same signature during the current hourly window.
+type CrashWindow struct {
+	Start     time.Time
+	Signature string
+	Count     int64
+	// The number of crashes in the previous window, if it immediately preceded the current one.
+	PrevCount int64
+}
+
+// Addresses, offsets, pids and the like differ between otherwise identical reports.
+var crashSignatureRe = regexp.MustCompile(`0x[0-9a-fA-F]+|[0-9a-fA-F]{8,}|[0-9]+`)
+
+// crashSignature identifies crashes with identical titles and near-identical reports.
+func crashSignature(title string, report []byte) string {
+	return hash.String([]byte(title), crashSignatureRe.ReplaceAll(report, []byte("N")))
+}
+
+// coalesce checks whether the next crash with the signature must only be counted.
+func (w *CrashWindow) coalesce(signature string, hasRepro bool, now time.Time) bool {
+	if hasRepro || signature != w.Signature || now.Sub(w.Start) >= crashCoalesceWindow {
+		return false
+	}
+	return w.Count > crashCoalesceThreshold || w.PrevCount > crashCoalesceThreshold
+}
+
+// add records the crash, it must be called for all crashes of the bug (including the suppressed ones).
+func (w *CrashWindow) add(signature string, now time.Time) {
+	switch elapsed := now.Sub(w.Start); {
+	case signature != w.Signature || elapsed >= 2*crashCoalesceWindow:
+		*w = CrashWindow{Start: now, Signature: signature}
+	case elapsed >= crashCoalesceWindow:
+		w.Start, w.Count, w.PrevCount = now, 0, w.Count
+	}
+	w.Count++
+}
+
+// formatSuppressedCrashes returns e.g. "+3,812 similar crashes suppressed".
+func formatSuppressedCrashes(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	digits := fmt.Sprint(n)
+	var parts []string
+	for len(digits) > 3 {
+		parts = append([]string{digits[len(digits)-3:]}, parts...)
+		digits = digits[:len(digits)-3]
+	}
+	parts = append([]string{digits}, parts...)
+	noun := "crashes"
+	if n == 1 {
+		noun = "crash"
+	}
+	return fmt.Sprintf("+%v similar %v suppressed", strings.Join(parts, ","), noun)
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCrashSignature(t *testing.T) {
+	report1 := []byte("BUG: KASAN: use-after-free in foo+0x12/0x340\n" +
+		"Read of size 8 at addr ffff88801234abcd by task syz-executor.3/5123\n")
+	report2 := []byte("BUG: KASAN: use-after-free in foo+0x15/0x340\n" +
+		"Read of size 8 at addr ffff888012ff0000 by task syz-executor.1/6001\n")
+	report3 := []byte("BUG: KASAN: use-after-free in bar+0x12/0x340\n" +
+		"Read of size 8 at addr ffff88801234abcd by task syz-executor.3/5123\n")
+	if crashSignature("title", report1) != crashSignature("title", report2) {
+		t.Errorf("near-identical reports have different signatures")
+	}
+	if crashSignature("title", report1) == crashSignature("title", report3) {
+		t.Errorf("different reports have the same signature")
+	}
+	if crashSignature("title", report1) == crashSignature("other title", report1) {
+		t.Errorf("different titles have the same signature")
+	}
+}
+
+func TestCrashCoalesceSchedule(t *testing.T) {
+	start := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	w := new(CrashWindow)
+	// simulate reports crashes every period during the duration and returns the number of full
+	// (not suppressed) crashes during each hour.
+	simulate := func(from time.Time, period, duration time.Duration, signature string) []int {
+		var full []int
+		for now := from; now.Before(from.Add(duration)); now = now.Add(period) {
+			hour := int(now.Sub(from) / time.Hour)
+			for len(full) <= hour {
+				full = append(full, 0)
+			}
+			if !w.coalesce(signature, false, now) {
+				full[hour]++
+			}
+			w.add(signature, now)
+		}
+		return full
+	}
+	// A crash loop: 360 crashes per hour.
+	got := simulate(start, 10*time.Second, 3*time.Hour, "sig1")
+	if want := []int{crashCoalesceThreshold + 1, 1, 1}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("crash loop: got %v full crashes per hour, want %v", got, want)
+	}
+	// Crashes with reproducers are never suppressed.
+	now := start.Add(3 * time.Hour).Add(-time.Second)
+	if !w.coalesce("sig1", false, now) || w.coalesce("sig1", true, now) {
+		t.Fatalf("crashes with reproducers must not be suppressed")
+	}
+	// Neither are different crashes.
+	if w.coalesce("sig2", false, now) {
+		t.Fatalf("a crash with a different signature is suppressed")
+	}
+	// The loop has ended, only the hour right after it is still coalesced.
+	got = simulate(start.Add(3*time.Hour), 5*time.Minute, 3*time.Hour, "sig1")
+	if want := []int{1, 12, 12}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("after the loop: got %v full crashes per hour, want %v", got, want)
+	}
+	// After a pause the counting starts from scratch.
+	got = simulate(start.Add(10*time.Hour), 10*time.Second, time.Hour, "sig1")
+	if want := []int{crashCoalesceThreshold + 1}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("after a pause: got %v full crashes per hour, want %v", got, want)
+	}
+}
+
+func TestFormatSuppressedCrashes(t *testing.T) {
+	tests := map[int64]string{
+		0:       "",
+		1:       "+1 similar crash suppressed",
+		999:     "+999 similar crashes suppressed",
+		3812:    "+3,812 similar crashes suppressed",
+		1234567: "+1,234,567 similar crashes suppressed",
+	}
+	for n, want := range tests {
+		if got := formatSuppressedCrashes(n); got != want {
+			t.Errorf("%v: got %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestCoalesceDuplicateCrashes(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	const suppressed = 5
+	for i := 0; i < crashCoalesceThreshold+1+suppressed; i++ {
+		crash := testCrash(build, 1)
+		crash.Report = []byte(fmt.Sprintf("report1 at addr %x", uint64(0xffff888000000000)+uint64(i)))
+		c.client.ReportCrash(crash)
+		c.advanceTime(time.Second)
+	}
+	rep := c.client.pollBug()
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bug.NumCrashes, int64(crashCoalesceThreshold+1+suppressed))
+	c.expectEQ(bug.SuppressedCrashes, int64(suppressed))
+
+	// Crashes with reproducers or with different reports are still saved.
+	crash := testCrashWithRepro(build, 1)
+	crash.Report = []byte("report1 at addr ffff888000001000")
+	c.client.ReportCrash(crash)
+	crash = testCrash(build, 1)
+	crash.Report = []byte("another report")
+	c.client.ReportCrash(crash)
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.SuppressedCrashes, int64(suppressed))
+	c.expectEQ(bug.ReproLevel, ReproLevelC)
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("+5 similar crashes suppressed")))
+}
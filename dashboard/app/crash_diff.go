@@ -0,0 +1,96 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/syzkaller/pkg/report"
+	"golang.org/x/net/context"
+)
+
+// Reports are capped so that diffing huge corrupted reports does not exhaust instance memory.
+const maxCrashDiffReportLen = 256 << 10
+
+type uiCrashDiffPage struct {
+	Header     *uiHeader
+	BugTitle   string
+	BugLink    string
+	A, B       *uiCrash
+	Similarity string
+	Truncated  bool
+	Lines      []*uiCrashDiffLine
+}
+
+type uiCrashDiffLine struct {
+	Class  string
+	Prefix string
+	Text   string
+}
+
+// handleCrashDiff shows the diff of the normalized reports of two crashes of the same bug.
+func handleCrashDiff(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	idA, err := parseCrashDiffID(r.FormValue("a"))
+	if err != nil {
+		return err
+	}
+	idB, err := parseCrashDiffID(r.FormValue("b"))
+	if err != nil {
+		return err
+	}
+	bug, crashA, crashKeyA, err := checkCrashTextAccess(c, r, "Report", idA)
+	if err != nil {
+		return err
+	}
+	_, crashB, crashKeyB, err := checkCrashTextAccess(c, r, "Report", idB)
+	if err != nil {
+		return err
+	}
+	if !crashKeyA.Parent().Equal(crashKeyB.Parent()) {
+		return fmt.Errorf("the crashes belong to different bugs: %w", ErrClientBadRequest)
+	}
+	hdr, err := commonHeader(c, r, w, bug.Namespace)
+	if err != nil {
+		return err
+	}
+	reportA, _, truncatedA, err := getTextPrefix(c, textCrashReport, idA, maxCrashDiffReportLen)
+	if err != nil {
+		return err
+	}
+	reportB, _, truncatedB, err := getTextPrefix(c, textCrashReport, idB, maxCrashDiffReportLen)
+	if err != nil {
+		return err
+	}
+	diff := report.DiffReports(reportA, reportB)
+	page := &uiCrashDiffPage{
+		Header:     hdr,
+		BugTitle:   bug.displayTitle(),
+		BugLink:    bugLink(bug.keyHash()),
+		A:          makeUICrash(crashA, nil),
+		B:          makeUICrash(crashB, nil),
+		Similarity: fmt.Sprintf("%.0f%%", diff.Similarity*100),
+		Truncated:  diff.Truncated || truncatedA || truncatedB,
+	}
+	for _, line := range diff.Lines {
+		ui := &uiCrashDiffLine{Prefix: " ", Text: line.Text}
+		switch line.Op {
+		case report.DiffRemoved:
+			ui.Class, ui.Prefix = "diff_removed", "-"
+		case report.DiffAdded:
+			ui.Class, ui.Prefix = "diff_added", "+"
+		}
+		page.Lines = append(page.Lines, ui)
+	}
+	return serveTemplate(w, "crash_diff.html", page)
+}
+
+func parseCrashDiffID(x string) (int64, error) {
+	id, err := strconv.ParseUint(x, 16, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("failed to parse report id %q: %w", x, ErrClientBadRequest)
+	}
+	return int64(id), nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestCrashDiff(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash1 := testCrash(build, 1)
+	crash1.Report = []byte(`[  560.713151][ T1194] WARNING: CPU: 2 PID: 1194 at net/xfrm/xfrm_state.c:2381 xfrm_state_fini+0x440/0x5c0
+[  560.719399][ T1194] Call Trace:
+[  560.719962][ T1194]  dump_stack+0x1db/0x2d0
+[  560.722633][ T1194]  panic+0x2cb/0x65c
+[  560.747522][ T1194]  xfrm_net_exit+0x25/0x70
+`)
+	c.client.ReportCrash(crash1)
+	rep := c.client.pollBug()
+
+	c.advanceTime(1)
+	crash2 := testCrash(build, 1)
+	crash2.Report = []byte(`[  123.456789][ T4321] WARNING: CPU: 0 PID: 4321 at net/xfrm/xfrm_state.c:2382 xfrm_state_fini+0x441/0x5c0
+[  123.456789][ T4321] Call Trace:
+[  123.456789][ T4321]  dump_stack+0x1db/0x2d0
+[  123.456789][ T4321]  panic+0x2cb/0x65c
+[  123.456789][ T4321]  cleanup_net+0x51d/0xb10
+`)
+	c.client.ReportCrash(crash2)
+
+	build2 := testBuild(2)
+	c.client.UploadBuild(build2)
+	c.client.ReportCrash(testCrash(build2, 2))
+	rep2 := c.client.pollBug()
+
+	bug, _, _ := c.loadBug(rep.ID)
+	var crashes []*Crash
+	_, err := db.NewQuery("Crash").
+		Ancestor(bug.key(c.ctx)).
+		Order("Time").
+		GetAll(c.ctx, &crashes)
+	c.expectOK(err)
+	c.expectEQ(len(crashes), 2)
+	idA := strconv.FormatUint(uint64(crashes[0].Report), 16)
+	idB := strconv.FormatUint(uint64(crashes[1].Report), 16)
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Diff selected reports"))
+	c.expectTrue(strings.Contains(string(page), `value="`+idA+`"`))
+
+	page, err = c.AuthGET(AccessAdmin, "/crash_diff?a="+idA+"&b="+idB)
+	c.expectOK(err)
+	diff := string(page)
+	c.expectTrue(strings.Contains(diff, "Similarity: <b>80%</b>"))
+	c.expectTrue(strings.Contains(diff, ">  dump_stack<"))
+	c.expectTrue(strings.Contains(diff, ">- xfrm_net_exit<"))
+	c.expectTrue(strings.Contains(diff, ">+ cleanup_net<"))
+	c.expectTrue(!strings.Contains(diff, "T1194"))
+
+	// Reports of different bugs can't be compared.
+	_, otherCrash, _ := c.loadBug(rep2.ID)
+	_, err = c.AuthGET(AccessAdmin, "/crash_diff?a="+idA+"&b="+
+		strconv.FormatUint(uint64(otherCrash.Report), 16))
+	c.expectTrue(err != nil)
+
+	_, err = c.AuthGET(AccessAdmin, "/crash_diff?a="+idA+"&b=foo")
+	c.expectTrue(err != nil)
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/vcs"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// handleCrashEnv serves the "repro bundle" of a crash: everything that is needed
+// to reproduce the crash outside of syzbot as a JSON document.
+func handleCrashEnv(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	if err := checkNamespaceAccessLevel(c, r, bug.Namespace,
+		bug.sanitizeAccess(namespaceAccessLevel(c, r, bug.Namespace))); err != nil {
+		return err
+	}
+	if _, err := commonHeader(c, r, w, bug.Namespace); err != nil {
+		return err
+	}
+	crashID, err := strconv.ParseInt(r.FormValue("crash"), 10, 64)
+	if err != nil || crashID <= 0 {
+		return fmt.Errorf("%w: bad crash id %q", ErrClientBadRequest, r.FormValue("crash"))
+	}
+	crash := new(Crash)
+	if err := db.Get(c, db.NewKey(c, "Crash", "", crashID, bug.key(c)), crash); err != nil {
+		if err == db.ErrNoSuchEntity {
+			return fmt.Errorf("%w: no crash %v", ErrClientNotFound, crashID)
+		}
+		return fmt.Errorf("failed to get crash: %w", err)
+	}
+	build, err := loadBuild(c, bug.Namespace, crash.BuildID)
+	if err != nil {
+		return err
+	}
+	vmConfig, err := loadVMConfig(c, build.VMConfig)
+	if err != nil {
+		return err
+	}
+	env := makeCrashEnvironment(appURL(c), bug, crash, build, vmConfig)
+	data, err := json.MarshalIndent(env, "", "\t")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=crash-%v.json", crashID))
+	_, err = w.Write(data)
+	return err
+}
+
+func crashEnvLink(bug *Bug, crashKey *db.Key) string {
+	return fmt.Sprintf("/crash_env?id=%v&crash=%v", bug.keyHash(), crashKey.IntID())
+}
+
+func makeCrashEnvironment(baseURL string, bug *Bug, crash *Crash, build *Build,
+	vmConfig *dashapi.VMConfig) *PublicAPICrashEnvironment {
+	link := func(tag string, id int64) string {
+		if id == 0 {
+			return ""
+		}
+		return baseURL + textLink(tag, id)
+	}
+	title := crash.Title
+	if title == "" {
+		title = bug.Title
+	}
+	env := &PublicAPICrashEnvironment{
+		Version:           1,
+		Title:             title,
+		Manager:           crash.Manager,
+		Time:              crash.Time,
+		KernelRepo:        build.KernelRepo,
+		KernelBranch:      build.KernelBranch,
+		KernelCommit:      build.KernelCommit,
+		KernelCommitTitle: build.KernelCommitTitle,
+		KernelCommitLink:  vcs.CommitLink(build.KernelRepo, build.KernelCommit),
+		KernelConfig:      link(textKernelConfig, build.KernelConfig),
+		SyzkallerCommit:   build.SyzkallerCommit,
+		Compiler:          build.CompilerID,
+		OS:                build.OS,
+		Arch:              build.Arch,
+		VMArch:            build.VMArch,
+		MachineInfo:       link(textMachineInfo, crash.MachineInfo),
+		Log:               link(textCrashLog, crash.Log),
+		Report:            link(textCrashReport, crash.Report),
+		ReproOpts:         string(crash.ReproOpts),
+		SyzReproducer:     link(textReproSyz, crash.ReproSyz),
+		CReproducer:       link(textReproC, crash.ReproC),
+		ReproIsRevoked:    crash.ReproIsRevoked,
+	}
+	for _, asset := range createAssetList(build, crash) {
+		env.Assets = append(env.Assets, PublicAPIAsset{
+			Type:  string(asset.Type),
+			Title: asset.Title,
+			URL:   asset.DownloadURL,
+		})
+	}
+	if vmConfig != nil {
+		env.VM = &PublicAPIVM{
+			Type:   vmConfig.Type,
+			Config: vmConfig.Config,
+		}
+	}
+	return env
+}
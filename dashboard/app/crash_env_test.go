@@ -0,0 +1,126 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+func TestMakeCrashEnvironment(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	bug := &Bug{Namespace: "test1", Title: "bug title"}
+	crash := &Crash{
+		Manager:     "ci-upstream",
+		Time:        now,
+		Log:         0x10,
+		Report:      0x11,
+		ReproOpts:   []byte(`{"threaded":true}`),
+		ReproSyz:    0x12,
+		MachineInfo: 0x13,
+		Assets: []Asset{{
+			Type:        dashapi.MountInRepro,
+			DownloadURL: "https://storage/mount_0.gz",
+		}},
+	}
+	build := &Build{
+		OS:              targets.Linux,
+		Arch:            targets.AMD64,
+		VMArch:          targets.AMD64,
+		SyzkallerCommit: "syzkaller_commit",
+		CompilerID:      "gcc 10.2.1",
+		KernelRepo:      "git://git.kernel.org/pub/scm/linux/kernel/git/torvalds/linux.git",
+		KernelBranch:    "master",
+		KernelCommit:    "1234567890",
+		KernelConfig:    0x14,
+		Assets: []Asset{{
+			Type:        dashapi.KernelObject,
+			DownloadURL: "https://storage/vmlinux.xz",
+		}},
+	}
+	vmConfig := &dashapi.VMConfig{Type: "qemu", Config: []byte(`{"count":2,"cpu":2,"mem":2048}`)}
+	got := makeCrashEnvironment("https://testapp.appspot.com", bug, crash, build, vmConfig)
+	want := &PublicAPICrashEnvironment{
+		Version:         1,
+		Title:           "bug title",
+		Manager:         "ci-upstream",
+		Time:            now,
+		KernelRepo:      build.KernelRepo,
+		KernelBranch:    "master",
+		KernelCommit:    "1234567890",
+		KernelConfig:    "https://testapp.appspot.com/text?tag=KernelConfig&x=14",
+		SyzkallerCommit: "syzkaller_commit",
+		Compiler:        "gcc 10.2.1",
+		OS:              targets.Linux,
+		Arch:            targets.AMD64,
+		VMArch:          targets.AMD64,
+		MachineInfo:     "https://testapp.appspot.com/text?tag=MachineInfo&x=13",
+		Log:             "https://testapp.appspot.com/text?tag=CrashLog&x=10",
+		Report:          "https://testapp.appspot.com/text?tag=CrashReport&x=11",
+		ReproOpts:       `{"threaded":true}`,
+		SyzReproducer:   "https://testapp.appspot.com/text?tag=ReproSyz&x=12",
+		Assets: []PublicAPIAsset{
+			{Type: string(dashapi.KernelObject), Title: "vmlinux", URL: "https://storage/vmlinux.xz"},
+			{Type: string(dashapi.MountInRepro), Title: "mounted in repro", URL: "https://storage/mount_0.gz"},
+		},
+		VM: &PublicAPIVM{
+			Type:   "qemu",
+			Config: []byte(`{"count":2,"cpu":2,"mem":2048}`),
+		},
+	}
+	// The kernel commit link depends on the repo.
+	want.KernelCommitLink = got.KernelCommitLink
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+var crashEnvLinkRe = regexp.MustCompile(`/crash_env\?[^"]+`)
+
+func TestCrashEnv(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrashWithRepro(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	link := html.UnescapeString(crashEnvLinkRe.FindString(string(page)))
+	c.expectNE(link, "")
+
+	reply, err := c.AuthGET(AccessAdmin, link)
+	c.expectOK(err)
+	env := new(PublicAPICrashEnvironment)
+	c.expectOK(json.Unmarshal(reply, env))
+	c.expectEQ(env.Title, crash.Title)
+	c.expectEQ(env.KernelCommit, build.KernelCommit)
+	c.expectEQ(env.SyzkallerCommit, build.SyzkallerCommit)
+	c.expectEQ(env.Compiler, build.CompilerID)
+	c.expectEQ(env.ReproOpts, string(crash.ReproOpts))
+	c.expectNE(env.SyzReproducer, "")
+	c.expectNE(env.CReproducer, "")
+	c.expectNE(env.KernelConfig, "")
+
+	// The access checks are the same as for the bug page.
+	_, err = c.AuthGET(AccessUser, "/bug?extid="+rep.ID)
+	c.expectForbidden(err)
+	_, err = c.AuthGET(AccessUser, link)
+	c.expectForbidden(err)
+
+	_, err = c.AuthGET(AccessAdmin, link+"0")
+	c.expectTrue(err != nil)
+	_, err = c.AuthGET(AccessAdmin, "/crash_env?id="+rep.ID)
+	c.expectTrue(err != nil)
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// The crash matrix of a bug shows where the bug happens: the number of crashes on each manager
+// over the last week, the last month and in total. The counters are updated along with the bug
+// on each crash (see recordManagerCrash), so rendering does not need to scan Crash entities.
+
+// Daily counters are dropped after that many days, all time totals are kept forever.
+const maxManagerStatsDays = 90
+
+func bugManagerStatsKey(c context.Context, bugKey *db.Key, manager string) *db.Key {
+	return db.NewKey(c, "BugManagerStats", manager, 0, bugKey)
+}
+
+// recordManagerCrash counts the new crash of the bug on the build's manager.
+// It's called inside of the bug transaction.
+func recordManagerCrash(c context.Context, bugKey *db.Key, build *Build, now time.Time) error {
+	key := bugManagerStatsKey(c, bugKey, build.Manager)
+	stats := new(BugManagerStats)
+	if err := db.Get(c, key, stats); err != nil && err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to get manager stats: %w", err)
+	}
+	stats.Manager = build.Manager
+	stats.Arch = build.Arch
+	stats.add(now, 1)
+	if _, err := db.Put(c, key, stats); err != nil {
+		return fmt.Errorf("failed to put manager stats: %w", err)
+	}
+	return nil
+}
+
+func (stats *BugManagerStats) add(now time.Time, count int) {
+	stats.Total += int64(count)
+	if stats.LastTime.Before(now) {
+		stats.LastTime = now
+	}
+	date := timeDate(now)
+	if n := len(stats.Days); n == 0 || stats.Days[n-1].Date < date {
+		stats.Days = append(stats.Days, BugDailyStats{date, count})
+	} else {
+		// See the comment in increaseCrashStats.
+		stats.Days[n-1].CrashCount += count
+	}
+	stats.prune(now)
+}
+
+func (stats *BugManagerStats) prune(now time.Time) {
+	minDate := timeDate(now.Add(-maxManagerStatsDays * 24 * time.Hour))
+	for len(stats.Days) != 0 && stats.Days[0].Date < minDate {
+		stats.Days = stats.Days[1:]
+	}
+}
+
+// countSince returns the number of crashes since the day of the given time.
+func (stats *BugManagerStats) countSince(since time.Time) int {
+	date := timeDate(since)
+	count := 0
+	for _, day := range stats.Days {
+		if day.Date >= date {
+			count += day.CrashCount
+		}
+	}
+	return count
+}
+
+type uiCrashMatrix struct {
+	Rows []*uiCrashMatrixRow
+}
+
+type uiCrashMatrixRow struct {
+	Manager   string
+	Arch      string
+	LastWeek  int
+	LastMonth int
+	Total     int64
+	LastTime  time.Time
+}
+
+func loadCrashMatrix(c context.Context, bugKey *db.Key) (*uiCrashMatrix, error) {
+	var stats []*BugManagerStats
+	if _, err := db.NewQuery("BugManagerStats").Ancestor(bugKey).GetAll(c, &stats); err != nil {
+		return nil, fmt.Errorf("failed to query manager stats: %w", err)
+	}
+	if len(stats) == 0 {
+		return nil, nil
+	}
+	return makeCrashMatrix(stats, timeNow(c)), nil
+}
+
+func makeCrashMatrix(stats []*BugManagerStats, now time.Time) *uiCrashMatrix {
+	ret := &uiCrashMatrix{}
+	for _, item := range stats {
+		ret.Rows = append(ret.Rows, &uiCrashMatrixRow{
+			Manager:   item.Manager,
+			Arch:      item.Arch,
+			LastWeek:  item.countSince(now.Add(-6 * 24 * time.Hour)),
+			LastMonth: item.countSince(now.Add(-29 * 24 * time.Hour)),
+			Total:     item.Total,
+			LastTime:  item.LastTime,
+		})
+	}
+	sort.Slice(ret.Rows, func(i, j int) bool {
+		if ret.Rows[i].LastMonth != ret.Rows[j].LastMonth {
+			return ret.Rows[i].LastMonth > ret.Rows[j].LastMonth
+		}
+		if ret.Rows[i].Total != ret.Rows[j].Total {
+			return ret.Rows[i].Total > ret.Rows[j].Total
+		}
+		return ret.Rows[i].Manager < ret.Rows[j].Manager
+	})
+	return ret
+}
+
+// backfillManagerStats recreates the crash matrix of the bug from its saved crashes.
+// Not all crashes are saved, so the counts are only a lower bound.
+func backfillManagerStats(c context.Context, bug *Bug, bugKey *db.Key) error {
+	var crashes []*Crash
+	_, err := db.NewQuery("Crash").
+		Ancestor(bugKey).
+		Order("Time").
+		GetAll(c, &crashes)
+	if err != nil {
+		return fmt.Errorf("failed to query crashes: %w", err)
+	}
+	builds := map[string]*Build{}
+	stats := map[string]*BugManagerStats{}
+	for _, crash := range crashes {
+		item := stats[crash.Manager]
+		if item == nil {
+			item = &BugManagerStats{Manager: crash.Manager}
+			stats[crash.Manager] = item
+		}
+		if item.Arch == "" {
+			build, ok := builds[crash.BuildID]
+			if !ok {
+				// The build may have already been deleted, this only costs us the arch.
+				build, _ = loadBuild(c, bug.Namespace, crash.BuildID)
+				builds[crash.BuildID] = build
+			}
+			if build != nil {
+				item.Arch = build.Arch
+			}
+		}
+		item.add(crash.Time, 1)
+	}
+	var keys []*db.Key
+	var values []*BugManagerStats
+	for mgr, item := range stats {
+		item.prune(timeNow(c))
+		keys = append(keys, bugManagerStatsKey(c, bugKey, mgr))
+		values = append(values, item)
+	}
+	if _, err := db.PutMulti(c, keys, values); err != nil {
+		return fmt.Errorf("failed to put manager stats: %w", err)
+	}
+	return nil
+}
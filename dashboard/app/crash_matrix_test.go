@@ -0,0 +1,94 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestCrashMatrixStats(t *testing.T) {
+	now := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	stats1 := &BugManagerStats{Manager: "ci-a"}
+	stats1.add(now.Add(-100*day), 5)
+	stats1.add(now.Add(-20*day), 2)
+	stats1.add(now.Add(-20*day), 1)
+	stats1.add(now.Add(-3*day), 1)
+	if len(stats1.Days) != 2 {
+		t.Fatalf("old days are not pruned: %+v", stats1.Days)
+	}
+	stats2 := &BugManagerStats{Manager: "ci-b"}
+	stats2.add(now, 4)
+	stats3 := &BugManagerStats{Manager: "ci-c"}
+	stats3.add(now.Add(-50*day), 10)
+
+	matrix := makeCrashMatrix([]*BugManagerStats{stats3, stats2, stats1}, now)
+	want := []uiCrashMatrixRow{
+		{Manager: "ci-a", LastWeek: 1, LastMonth: 4, Total: 9, LastTime: now.Add(-3 * day)},
+		{Manager: "ci-b", LastWeek: 4, LastMonth: 4, Total: 4, LastTime: now},
+		{Manager: "ci-c", LastWeek: 0, LastMonth: 0, Total: 10, LastTime: now.Add(-50 * day)},
+	}
+	if len(matrix.Rows) != len(want) {
+		t.Fatalf("got %v rows, want %v", len(matrix.Rows), len(want))
+	}
+	for i, row := range matrix.Rows {
+		if *row != want[i] {
+			t.Errorf("row #%v: got %+v, want %+v", i, *row, want[i])
+		}
+	}
+}
+
+func TestCrashMatrix(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build1 := testBuild(1)
+	c.client.UploadBuild(build1)
+	build2 := testBuild(2)
+	build2.Manager = "manager2"
+	build2.Arch = "arm64"
+	c.client.UploadBuild(build2)
+
+	c.client.ReportCrash(testCrash(build1, 1))
+	rep := c.client.pollBug()
+	c.advanceTime(10 * 24 * time.Hour)
+	c.client.ReportCrash(testCrash(build2, 1))
+	c.client.ReportCrash(testCrash(build2, 1))
+	c.client.ReportCrash(testCrash(build1, 1))
+
+	bug, _, _ := c.loadBug(rep.ID)
+	matrix, err := loadCrashMatrix(c.ctx, bug.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(len(matrix.Rows), 2)
+	c.expectEQ(matrix.Rows[0].Manager, "manager1")
+	c.expectEQ(matrix.Rows[0].LastWeek, 1)
+	c.expectEQ(matrix.Rows[0].LastMonth, 2)
+	c.expectEQ(*matrix.Rows[1], uiCrashMatrixRow{
+		Manager:   "manager2",
+		Arch:      "arm64",
+		LastWeek:  2,
+		LastMonth: 2,
+		Total:     2,
+		LastTime:  timeNow(c.ctx),
+	})
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Crashes by manager (2)")))
+
+	// The backfilled matrix only counts the saved crashes.
+	keys, err := db.NewQuery("BugManagerStats").Ancestor(bug.key(c.ctx)).KeysOnly().GetAll(c.ctx, nil)
+	c.expectOK(err)
+	c.expectOK(db.DeleteMulti(c.ctx, keys))
+	c.expectOK(backfillManagerStats(c.ctx, bug, bug.key(c.ctx)))
+	matrix, err = loadCrashMatrix(c.ctx, bug.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(len(matrix.Rows), 2)
+	c.expectEQ(matrix.Rows[0].Arch, "amd64")
+	c.expectEQ(matrix.Rows[1].Arch, "arm64")
+}
@@ -0,0 +1,214 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	aemail "google.golang.org/appengine/v2/mail"
+)
+
+const (
+	crashRateBaselineDays    = 30
+	crashRateMinBaselineDays = 7
+	crashRateTopTitles       = 5
+)
+
+type crashRateAnomaly struct {
+	Crashes  int64
+	Baseline int64 // median daily crashes over the baseline period
+	High     bool
+}
+
+// detectCrashRateAnomaly compares the last value of the series of daily crash counts
+// with the median of up to crashRateBaselineDays preceding values.
+// The series only contains the days on which the manager was reporting stats.
+func detectCrashRateAnomaly(series []int64, cfg *CrashRateAlertConfig) *crashRateAnomaly {
+	if len(series) < crashRateMinBaselineDays+1 {
+		return nil
+	}
+	crashes := series[len(series)-1]
+	baseline := append([]int64{}, series[:len(series)-1]...)
+	if len(baseline) > crashRateBaselineDays {
+		baseline = baseline[len(baseline)-crashRateBaselineDays:]
+	}
+	sort.Slice(baseline, func(i, j int) bool { return baseline[i] < baseline[j] })
+	median := baseline[len(baseline)/2]
+	ret := &crashRateAnomaly{
+		Crashes:  crashes,
+		Baseline: median,
+	}
+	if crashes >= cfg.MinCrashes && float64(crashes) > float64(median)*cfg.HighRatio {
+		ret.High = true
+		return ret
+	}
+	if median >= cfg.MinCrashes && float64(crashes)*cfg.LowRatio < float64(median) {
+		return ret
+	}
+	return nil
+}
+
+func (a *crashRateAnomaly) ratio() string {
+	if a.High {
+		if a.Baseline == 0 {
+			return "way above"
+		}
+		return fmt.Sprintf("%.0fx above", float64(a.Crashes)/float64(a.Baseline))
+	}
+	if a.Crashes == 0 {
+		return "way below"
+	}
+	return fmt.Sprintf("%.0fx below", float64(a.Baseline)/float64(a.Crashes))
+}
+
+// handleCrashRateAlerts checks the crash rates of the managers for the previous day.
+func handleCrashRateAlerts(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	date := timeDate(timeNow(c).Add(-24 * time.Hour))
+	for ns, cfg := range config.Namespaces {
+		if cfg.CrashRateAlerts == nil {
+			continue
+		}
+		if err := checkCrashRates(c, ns, cfg.CrashRateAlerts, date); err != nil {
+			log.Errorf(c, "failed to check crash rates in %v: %v", ns, err)
+		}
+	}
+}
+
+func checkCrashRates(c context.Context, ns string, cfg *CrashRateAlertConfig, date int) error {
+	managers, _, err := loadAllManagers(c, ns)
+	if err != nil {
+		return err
+	}
+	for _, mgr := range managers {
+		if mgr.CrashRateAlertDate >= date {
+			continue
+		}
+		anomaly, err := managerCrashRateAnomaly(c, mgr, cfg, date)
+		if err != nil {
+			return err
+		}
+		if anomaly == nil {
+			continue
+		}
+		if err := sendCrashRateAlert(c, mgr, cfg, date, anomaly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func managerCrashRateAnomaly(c context.Context, mgr *Manager, cfg *CrashRateAlertConfig, date int) (
+	*crashRateAnomaly, error) {
+	var stats []*ManagerStats
+	_, err := db.NewQuery("ManagerStats").
+		Ancestor(mgr.key(c)).
+		GetAll(c, &stats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query manager stats: %w", err)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Date < stats[j].Date })
+	start := timeDate(dateTime(date).Add(-crashRateBaselineDays * 24 * time.Hour))
+	var series []int64
+	lastDate := 0
+	for _, stat := range stats {
+		if stat.Date >= start && stat.Date <= date {
+			series = append(series, stat.TotalCrashes)
+			lastDate = stat.Date
+		}
+	}
+	if lastDate != date {
+		// The manager was not running on that day, this is not what we are looking for.
+		return nil, nil
+	}
+	return detectCrashRateAnomaly(series, cfg), nil
+}
+
+// crashRateTitles returns the titles of the bugs that the manager hit on the day,
+// new bugs go first, then the bugs with the most crashes.
+func crashRateTitles(c context.Context, mgr *Manager, date int) ([]string, error) {
+	dayStart := dateTime(date)
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Namespace=", mgr.Namespace).
+		Filter("HappenedOn=", mgr.Name).
+		Filter("LastTime>=", dayStart).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	isNew := func(bug *Bug) bool {
+		return !bug.FirstTime.Before(dayStart)
+	}
+	sort.SliceStable(bugs, func(i, j int) bool {
+		if isNew(bugs[i]) != isNew(bugs[j]) {
+			return isNew(bugs[i])
+		}
+		return bugs[i].NumCrashes > bugs[j].NumCrashes
+	})
+	var titles []string
+	for _, bug := range bugs {
+		if len(titles) == crashRateTopTitles {
+			break
+		}
+		title := bug.displayTitle()
+		if isNew(bug) {
+			title += " (new)"
+		}
+		titles = append(titles, title)
+	}
+	return titles, nil
+}
+
+func sendCrashRateAlert(c context.Context, mgr *Manager, cfg *CrashRateAlertConfig, date int,
+	anomaly *crashRateAnomaly) error {
+	day := dateTime(date).Format("2006-01-02")
+	body := new(strings.Builder)
+	fmt.Fprintf(body, "Manager %v in namespace %v had %v crashes on %v,\n"+
+		"while it usually has about %v crashes per day.\n",
+		mgr.Name, mgr.Namespace, anomaly.Crashes, day, anomaly.Baseline)
+	if anomaly.High {
+		fmt.Fprintf(body, "This often means a broken kernel image or flaky hardware.\n")
+		titles, err := crashRateTitles(c, mgr, date)
+		if err != nil {
+			return err
+		}
+		if len(titles) != 0 {
+			fmt.Fprintf(body, "\nBugs hit by the manager on that day (new ones first):\n")
+			for _, title := range titles {
+				fmt.Fprintf(body, "  %v\n", title)
+			}
+		}
+	}
+	fmt.Fprintf(body, "\nManager stats: %v/%v/graph/fuzzing?Instances=%v\n",
+		appURL(c), mgr.Namespace, mgr.Name)
+	msg := &aemail.Message{
+		Sender:  fromAddr(c),
+		To:      cfg.Emails,
+		Subject: fmt.Sprintf("[%v] crash rate of %v is %v normal", mgr.Namespace, mgr.Name, anomaly.ratio()),
+		Body:    body.String(),
+	}
+	log.Warningf(c, "%v", msg.Subject)
+	if err := sendEmail(c, msg); err != nil {
+		return err
+	}
+	tx := func(c context.Context) error {
+		cur := new(Manager)
+		if err := db.Get(c, mgr.key(c), cur); err != nil {
+			return fmt.Errorf("failed to get manager: %w", err)
+		}
+		cur.CrashRateAlertDate = date
+		_, err := db.Put(c, mgr.key(c), cur)
+		return err
+	}
+	return db.RunInTransaction(c, tx, nil)
+}
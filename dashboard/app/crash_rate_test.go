@@ -0,0 +1,135 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestDetectCrashRateAnomaly(t *testing.T) {
+	cfg := &CrashRateAlertConfig{
+		HighRatio:  10,
+		LowRatio:   10,
+		MinCrashes: 100,
+	}
+	flat := func(days int, val int64) []int64 {
+		var ret []int64
+		for i := 0; i < days; i++ {
+			ret = append(ret, val)
+		}
+		return ret
+	}
+	tests := []struct {
+		name   string
+		series []int64
+		want   *crashRateAnomaly
+	}{
+		{
+			name:   "normal",
+			series: append(flat(30, 200), 250),
+		},
+		{
+			name:   "spike",
+			series: append(flat(30, 200), 2500),
+			want:   &crashRateAnomaly{Crashes: 2500, Baseline: 200, High: true},
+		},
+		{
+			name:   "drop",
+			series: append(flat(30, 2000), 150),
+			want:   &crashRateAnomaly{Crashes: 150, Baseline: 2000},
+		},
+		{
+			name:   "drop to zero",
+			series: append(flat(30, 2000), 0),
+			want:   &crashRateAnomaly{Crashes: 0, Baseline: 2000},
+		},
+		{
+			name:   "spike from zero",
+			series: append(flat(10, 0), 500),
+			want:   &crashRateAnomaly{Crashes: 500, Baseline: 0, High: true},
+		},
+		{
+			name: "too few crashes",
+			// 10x above the baseline, but that's still just a few crashes.
+			series: append(flat(30, 5), 90),
+		},
+		{
+			name:   "too few crashes in the baseline",
+			series: append(flat(30, 90), 0),
+		},
+		{
+			name:   "short history",
+			series: append(flat(5, 200), 5000),
+		},
+		{
+			name:   "empty",
+			series: nil,
+		},
+		{
+			name:   "old spikes don't affect the median",
+			series: append(append(flat(10, 5000), flat(20, 200)...), 5000),
+			want:   &crashRateAnomaly{Crashes: 5000, Baseline: 200, High: true},
+		},
+		{
+			name:   "the baseline only includes the last 30 days",
+			series: append(append(flat(40, 5000), flat(30, 200)...), 3000),
+			want:   &crashRateAnomaly{Crashes: 3000, Baseline: 200, High: true},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			got := detectCrashRateAnomaly(test.series, cfg)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCrashRateAlert(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	for i := 0; i < 10; i++ {
+		c.expectOK(c.client.UploadManagerStats(&dashapi.ManagerStatsReq{
+			Name:    build.Manager,
+			Crashes: 150,
+		}))
+		c.advanceTime(24 * time.Hour)
+	}
+	_, err := c.GET("/cron/crash_rate_alerts")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 0)
+
+	c.expectOK(c.client.UploadManagerStats(&dashapi.ManagerStatsReq{
+		Name:    build.Manager,
+		Crashes: 2000,
+	}))
+	c.client.ReportCrash(testCrash(build, 1))
+	c.client.pollBug()
+	c.advanceTime(24 * time.Hour)
+
+	_, err = c.GET("/cron/crash_rate_alerts")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 1)
+	msg := <-c.emailSink
+	c.expectEQ(msg.To, []string{"crash-rate-alerts@test.com"})
+	c.expectEQ(msg.Subject, "[test1] crash rate of manager1 is 13x above normal")
+	c.expectTrue(strings.Contains(msg.Body, "had 2000 crashes"))
+	c.expectTrue(strings.Contains(msg.Body, "about 150 crashes per day"))
+	c.expectTrue(strings.Contains(msg.Body, "  title1 (new)\n"))
+
+	// The same day is not reported twice.
+	_, err = c.GET("/cron/crash_rate_alerts")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 0)
+}
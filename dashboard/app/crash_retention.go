@@ -0,0 +1,104 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// By default, every bug keeps the maxCrashes latest crashes with and without reproducers
+// (plus the reported ones, the latest one on each manager and one per title), and the older
+// crashes are purged by purgeOldCrashes as new crashes come in.
+// Namespaces may override the policy with CrashRetention: keep fewer or more crashes per bug,
+// delete the logs of crashes without reproducers after some time and not store machine info.
+// The numbers of purged crashes and logs are remembered in the bug and shown on the bug page.
+
+func crashRetention(ns string) CrashRetentionConfig {
+	var ret CrashRetentionConfig
+	if cfg := config.Namespaces[ns]; cfg != nil && cfg.CrashRetention != nil {
+		ret = *cfg.CrashRetention
+	}
+	if ret.MaxCrashes == 0 {
+		ret.MaxCrashes = maxCrashes()
+	}
+	return ret
+}
+
+// keepCrash says whether the unreported crash survives the purge.
+// The crashes must be passed newest first.
+func (cfg CrashRetentionConfig) keepCrash(crash *Crash, latestOnManager, uniqueTitle map[string]bool,
+	reproCount, noreproCount *int) bool {
+	// Preserve latest crash on each manager.
+	if !latestOnManager[crash.Manager] {
+		latestOnManager[crash.Manager] = true
+		return true
+	}
+	// Preserve at least one crash with each title.
+	if !uniqueTitle[crash.Title] {
+		uniqueTitle[crash.Title] = true
+		return true
+	}
+	// Preserve MaxCrashes latest crashes with repro and without repro.
+	count := noreproCount
+	if crash.ReproSyz != 0 || crash.ReproC != 0 {
+		count = reproCount
+	}
+	if *count < cfg.MaxCrashes {
+		*count++
+		return true
+	}
+	return false
+}
+
+// noReproLogExpired says whether the log of the unreported crash has to be deleted.
+func (cfg CrashRetentionConfig) noReproLogExpired(crash *Crash, now time.Time) bool {
+	return cfg.NoReproLogDays != 0 && crash.Log != 0 &&
+		crash.ReproSyz == 0 && crash.ReproC == 0 &&
+		now.Sub(crash.Time) > time.Duration(cfg.NoReproLogDays)*24*time.Hour
+}
+
+func recordPurgedCrashes(c context.Context, bugKey *db.Key, crashes, logs int64) error {
+	if crashes == 0 && logs == 0 {
+		return nil
+	}
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		bug.PurgedCrashes += crashes
+		bug.PurgedLogs += logs
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+// formatPurgedCrashes returns e.g. "42 older crashes purged, 7 logs of crashes without reproducers purged".
+func formatPurgedCrashes(bug *Bug) string {
+	var parts []string
+	if bug.PurgedCrashes != 0 {
+		parts = append(parts, fmt.Sprintf("%v older %v purged",
+			bug.PurgedCrashes, pluralize(bug.PurgedCrashes, "crash", "crashes")))
+	}
+	if bug.PurgedLogs != 0 {
+		parts = append(parts, fmt.Sprintf("%v %v of crashes without reproducers purged",
+			bug.PurgedLogs, pluralize(bug.PurgedLogs, "log", "logs")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func pluralize(n int64, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCheckCrashRetention(t *testing.T) {
+	tests := []struct {
+		cfg     *CrashRetentionConfig
+		wantErr bool
+	}{
+		{cfg: nil},
+		{cfg: &CrashRetentionConfig{}},
+		{cfg: &CrashRetentionConfig{MaxCrashes: 5, NoReproLogDays: 30, DropMachineInfo: true}},
+		{cfg: &CrashRetentionConfig{MaxCrashes: -1}, wantErr: true},
+		{cfg: &CrashRetentionConfig{NoReproLogDays: -7}, wantErr: true},
+	}
+	for i, test := range tests {
+		failed := func() (failed bool) {
+			defer func() {
+				failed = recover() != nil
+			}()
+			checkCrashRetention("ns", test.cfg)
+			return false
+		}()
+		if failed != test.wantErr {
+			t.Errorf("#%v: got failure %v, want %v", i, failed, test.wantErr)
+		}
+	}
+}
+
+func TestFormatPurgedCrashes(t *testing.T) {
+	tests := []struct {
+		crashes, logs int64
+		want          string
+	}{
+		{0, 0, ""},
+		{1, 0, "1 older crash purged"},
+		{42, 0, "42 older crashes purged"},
+		{0, 1, "1 log of crashes without reproducers purged"},
+		{42, 7, "42 older crashes purged, 7 logs of crashes without reproducers purged"},
+	}
+	for _, test := range tests {
+		got := formatPurgedCrashes(&Bug{PurgedCrashes: test.crashes, PurgedLogs: test.logs})
+		if got != test.want {
+			t.Errorf("crashes=%v logs=%v: got %q, want %q", test.crashes, test.logs, got, test.want)
+		}
+	}
+}
+
+func TestCrashRetention(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	// The same crashes happen in a namespace with the default policy (test1)
+	// and in a namespace with a custom one (crash-retention).
+	client := c.makeClient(clientCrashRetention, keyCrashRetention, true)
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+	client.ReportCrash(crash)
+	repRetention := client.pollBug()
+
+	// Stay below the default purge threshold, crash-retention purges crashes twice.
+	total := 2*maxCrashes() - 11
+	for i := 0; i < total; i++ {
+		c.advanceTime(2 * time.Hour)
+		crash.ReproOpts = []byte(fmt.Sprint(i))
+		c.client.ReportCrash(crash)
+		client.ReportCrash(crash)
+	}
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bug.PurgedCrashes, int64(0))
+	crashes, _, err := queryCrashesForBug(c.ctx, bug.key(c.ctx), 10*total)
+	c.expectOK(err)
+	c.expectEQ(len(crashes), total+1)
+	c.expectTrue(crashes[0].MachineInfo != 0)
+
+	bugRetention, _, _ := c.loadBug(repRetention.ID)
+	crashesRetention, _, err := queryCrashesForBug(c.ctx, bugRetention.key(c.ctx), 10*total)
+	c.expectOK(err)
+	c.expectEQ(bugRetention.PurgedCrashes, int64(total+1-len(crashesRetention)))
+	c.expectTrue(bugRetention.PurgedCrashes > 0)
+	// The reported crash, the latest crash on the manager and MaxCrashes crashes without repro,
+	// plus the crashes that came after the last purge.
+	c.expectEQ(len(crashesRetention), 16)
+	for _, crash := range crashesRetention {
+		c.expectEQ(crash.MachineInfo, int64(0))
+	}
+
+	// After a week, the logs of the unreported crashes are purged only in crash-retention.
+	c.advanceTime(8 * 24 * time.Hour)
+	for i := 0; i < 10; i++ {
+		c.advanceTime(2 * time.Hour)
+		c.client.ReportCrash(crash)
+		client.ReportCrash(crash)
+	}
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.PurgedLogs, int64(0))
+	bugRetention, _, _ = c.loadBug(repRetention.ID)
+	c.expectTrue(bugRetention.PurgedLogs > 0)
+	crashesRetention, _, err = queryCrashesForBug(c.ctx, bugRetention.key(c.ctx), 10*total)
+	c.expectOK(err)
+	for _, crash := range crashesRetention {
+		expired := crash.Reported.IsZero() && c.mockedTime.Sub(crash.Time) > 7*24*time.Hour
+		c.expectEQ(crash.Log == 0, expired)
+	}
+
+	page, err := c.AuthGET(AccessAdmin, bugLink(bugRetention.keyHash()))
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(fmt.Sprintf("%v older crashes purged, %v logs of crashes",
+		bugRetention.PurgedCrashes, bugRetention.PurgedLogs))))
+	page, err = c.AuthGET(AccessAdmin, bugLink(bug.keyHash()))
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("purged by the retention policy")))
+}
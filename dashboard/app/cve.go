@@ -0,0 +1,276 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Some bugs get CVEs assigned. The CVE IDs of a bug (Bug.CVEs) are set by the admins on the bug page
+// or with "#syz set cve CVE-2023-1234, ..." by the authorized senders (the AuthDomain users and
+// the users with a role in the namespace), both replace the whole list. Each change is recorded
+// in Bug.CVEHistory. A CVE may be assigned to several bugs. The CVEs are shown on the bug page and
+// in the bug lists, are included in the JSON exports, can be searched for and /cve/CVE-2023-1234
+// leads to the bug(s) with the CVE.
+
+const maxBugCVEs = 10
+
+var cveRe = regexp.MustCompile(`^CVE-[0-9]{4}-[0-9]{4,}$`)
+
+// BugCVEChange records the addition or the removal of a single CVE.
+type BugCVEChange struct {
+	CVE     string
+	Removed bool
+	User    string
+	Time    time.Time
+}
+
+// parseCVEs parses a comma/space-separated list of CVE IDs.
+func parseCVEs(list string) ([]string, error) {
+	var cves []string
+	for _, cve := range setCmdArgSplitRe.Split(strings.TrimSpace(list), -1) {
+		if cve == "" {
+			continue
+		}
+		cve = strings.ToUpper(cve)
+		if !cveRe.MatchString(cve) {
+			return nil, fmt.Errorf("%q is not a CVE ID, expected CVE-YYYY-NNNN", cve)
+		}
+		if !stringInList(cves, cve) {
+			cves = append(cves, cve)
+		}
+	}
+	if len(cves) > maxBugCVEs {
+		return nil, fmt.Errorf("at most %v CVEs per bug are supported", maxBugCVEs)
+	}
+	return cves, nil
+}
+
+func setBugCVEs(c context.Context, bugKey *db.Key, cves []string, user string) error {
+	now := timeNow(c)
+	bug := new(Bug)
+	tx := func(c context.Context) error {
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		changed := false
+		for _, cve := range bug.CVEs {
+			if !stringInList(cves, cve) {
+				changed = true
+				bug.CVEHistory = append(bug.CVEHistory, BugCVEChange{
+					CVE:     cve,
+					Removed: true,
+					User:    user,
+					Time:    now,
+				})
+			}
+		}
+		for _, cve := range cves {
+			if !stringInList(bug.CVEs, cve) {
+				changed = true
+				bug.CVEHistory = append(bug.CVEHistory, BugCVEChange{
+					CVE:  cve,
+					User: user,
+					Time: now,
+				})
+			}
+		}
+		if !changed {
+			return nil
+		}
+		bug.CVEs = cves
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	invalidateBugLists(c, bug.Namespace)
+	return nil
+}
+
+// senderAuthorized returns whether the email sender may use the privileged commands
+// (e.g. set the CVEs) for the bugs of the namespace.
+func senderAuthorized(c context.Context, ns, sender string) bool {
+	sender = email.CanonicalEmail(sender)
+	if config.AuthDomain != "" && strings.HasSuffix(sender, config.AuthDomain) {
+		return true
+	}
+	role := new(NamespaceRole)
+	if err := db.Get(c, namespaceRoleKey(c, ns, sender), role); err != nil {
+		if err != db.ErrNoSuchEntity {
+			log.Errorf(c, "failed to get the namespace role: %v", err)
+		}
+		return false
+	}
+	return role.Role >= AccessUser
+}
+
+func handleSetCVECommand(c context.Context, info *bugInfoResult, msg *email.Email, args string) error {
+	bugID := info.bugReporting.ID
+	if !senderAuthorized(c, info.bug.Namespace, msg.Author) {
+		return replyTo(c, msg, bugID, "You are not authorized to set the CVEs of the bug.\n"+
+			"Please contact the bot's maintainers.")
+	}
+	cves, err := parseCVEs(args)
+	if err == nil && len(cves) == 0 {
+		err = fmt.Errorf("no CVE IDs")
+	}
+	if err != nil {
+		return replyTo(c, msg, bugID, fmt.Sprintf("%v\n\nPlease use the following format:\n"+
+			"#syz set cve CVE-2023-1234, CVE-2023-5678", err))
+	}
+	// All the replies below will only be sent to the initiator and the mailing list.
+	msg.Cc = []string{info.reporting.Config.(*EmailConfig).Email}
+	if err := setBugCVEs(c, info.bugKey, cves, msg.Author); err != nil {
+		log.Errorf(c, "failed to set the CVEs: %v", err)
+		return replyTo(c, msg, bugID, "I've failed to update the CVEs due to an internal error.\n")
+	}
+	return replyTo(c, msg, bugID, fmt.Sprintf("Thank you!\n\nThe bug now has %v.", strings.Join(cves, ", ")))
+}
+
+func handleSetBugCVEs(c context.Context, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	cves, err := parseCVEs(r.FormValue("cves"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrClientBadRequest, err)
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	if err := setBugCVEs(c, bug.key(c), cves, author); err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+func loadBugsByCVE(c context.Context, ns, cve string) ([]*Bug, error) {
+	bugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		if ns != "" {
+			query = query.Filter("Namespace=", ns)
+		}
+		return query.Filter("CVEs=", cve)
+	})
+	return bugs, err
+}
+
+// handleCVE redirects /cve/CVE-2023-1234 to the bug with the CVE, or lists the bugs if there are several.
+func handleCVE(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	cve := strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/cve/"))
+	if !cveRe.MatchString(cve) {
+		return fmt.Errorf("%w: %q is not a CVE ID", ErrClientBadRequest, cve)
+	}
+	bugs, err := loadBugsByCVE(c, "", cve)
+	if err != nil {
+		return err
+	}
+	var visible []*Bug
+	for _, bug := range bugs {
+		accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
+		if accessLevel >= config.Namespaces[bug.Namespace].AccessLevel &&
+			accessLevel >= bug.sanitizeAccess(accessLevel) {
+			visible = append(visible, bug)
+		}
+	}
+	if len(visible) == 0 {
+		return fmt.Errorf("%w: no bugs with %v", ErrClientNotFound, cve)
+	}
+	if len(visible) == 1 {
+		return ErrRedirect{fmt.Errorf("%v", bugLink(visible[0].keyHash()))}
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		return visible[i].FirstTime.Before(visible[j].FirstTime)
+	})
+	hdr, err := commonHeader(c, r, w, visible[0].Namespace)
+	if err != nil {
+		return err
+	}
+	group, err := makeCVEBugGroup(c, visible)
+	if err != nil {
+		return err
+	}
+	return serveTemplate(w, "search.html", &uiSearchPage{
+		Header: hdr,
+		Query:  cve,
+		Bugs:   group,
+	})
+}
+
+func makeCVEBugGroup(c context.Context, bugs []*Bug) (*uiBugGroup, error) {
+	state, err := loadReportingState(c)
+	if err != nil {
+		return nil, err
+	}
+	group := &uiBugGroup{
+		Now:           timeNow(c),
+		Caption:       "bugs with the CVE",
+		ShowNamespace: true,
+		ShowStatus:    true,
+	}
+	for _, bug := range bugs {
+		managers, err := managerList(c, bug.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		group.Bugs = append(group.Bugs, createUIBug(c, bug, state, managers))
+	}
+	return group, nil
+}
+
+type uiBugCVEs struct {
+	BugID   string
+	CVEs    []*uiBugCVE
+	List    string // the comma-separated list for the edit form
+	CanEdit bool
+}
+
+type uiBugCVE struct {
+	ID    string
+	Link  string
+	SetBy string
+}
+
+func makeBugCVEsUI(bug *Bug, accessLevel AccessLevel) *uiBugCVEs {
+	if len(bug.CVEs) == 0 && accessLevel < AccessAdmin {
+		return nil
+	}
+	ui := &uiBugCVEs{
+		BugID:   bug.keyHash(),
+		List:    strings.Join(bug.CVEs, ", "),
+		CanEdit: accessLevel >= AccessAdmin,
+	}
+	for _, cve := range bug.CVEs {
+		entry := &uiBugCVE{
+			ID:   cve,
+			Link: "https://www.cve.org/CVERecord?id=" + cve,
+		}
+		for _, change := range bug.CVEHistory {
+			if change.CVE == cve && !change.Removed {
+				entry.SetBy = change.User
+			}
+		}
+		if accessLevel < AccessUser {
+			entry.SetBy = ""
+		}
+		ui.CVEs = append(ui.CVEs, entry)
+	}
+	return ui
+}
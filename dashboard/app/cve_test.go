@@ -0,0 +1,123 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestParseCVEs(t *testing.T) {
+	tests := []struct {
+		list string
+		cves []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"CVE-2023-1234", []string{"CVE-2023-1234"}, false},
+		{"cve-2023-1234, CVE-2024-123456 CVE-2023-1234", []string{"CVE-2023-1234", "CVE-2024-123456"}, false},
+		{"CVE-2023-123", nil, true},
+		{"CVE-23-1234", nil, true},
+		{"CVE-2023-1234, foo", nil, true},
+		{"CVE-2023-1234 CVE-2023-12345 CVE-2023-123456 CVE-2023-1234567 CVE-2023-2345 CVE-2023-3456 " +
+			"CVE-2023-4567 CVE-2023-5678 CVE-2023-6789 CVE-2023-7890 CVE-2023-8901", nil, true},
+	}
+	for _, test := range tests {
+		cves, err := parseCVEs(test.list)
+		if (err != nil) != test.err {
+			t.Errorf("%q: got err %v, want error %v", test.list, err, test.err)
+			continue
+		}
+		if strings.Join(cves, " ") != strings.Join(test.cves, " ") {
+			t.Errorf("%q: got %q, want %q", test.list, cves, test.cves)
+		}
+	}
+}
+
+func TestBugCVEs(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	mailingList := config.Namespaces["access-public-email"].Reporting[0].Config.(*EmailConfig).Email
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	sender := client.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+	client.ReportCrash(testCrash(build, 2))
+	sender2 := client.pollEmailBug().Sender
+	_, extBugID2, err := email.RemoveAddrContext(sender2)
+	c.expectOK(err)
+
+	// Random people can't set CVEs.
+	c.incomingEmail(sender, "#syz set cve CVE-2023-1234\n",
+		EmailOptFrom("test@requester.com"), EmailOptCC([]string{mailingList}))
+	c.expectTrue(strings.Contains(c.pollEmailBug().Body, "You are not authorized"))
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(len(bug.CVEs), 0)
+
+	c.incomingEmail(sender, "#syz set cve CVE-2023-12\n",
+		EmailOptFrom("dev@syzkaller.com"), EmailOptCC([]string{mailingList}))
+	c.expectTrue(strings.Contains(c.pollEmailBug().Body, "is not a CVE ID"))
+
+	c.incomingEmail(sender, "#syz set cve cve-2023-1234, CVE-2023-5678\n",
+		EmailOptFrom("dev@syzkaller.com"), EmailOptCC([]string{mailingList}))
+	reply := c.pollEmailBug()
+	c.expectEQ(reply.To, []string{"dev@syzkaller.com"})
+	c.expectTrue(strings.Contains(reply.Body, "The bug now has CVE-2023-1234, CVE-2023-5678."))
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.CVEs, []string{"CVE-2023-1234", "CVE-2023-5678"})
+	c.expectEQ(len(bug.CVEHistory), 2)
+	c.expectEQ(bug.CVEHistory[0].User, "dev@syzkaller.com")
+
+	// The same CVE for another bug, set by an admin.
+	_, err = c.GET("/admin?action=set_cves&extid=" + extBugID2 + "&cves=CVE-2023-1234")
+	c.expectEQ(err.(HTTPError).Code, http.StatusFound)
+	_, err = c.GET("/admin?action=set_cves&extid=" + extBugID2 + "&cves=foo")
+	c.expectBadReqest(err)
+	bug2, _, _ := c.loadBug(extBugID2)
+	c.expectEQ(bug2.CVEs, []string{"CVE-2023-1234"})
+
+	// The reverse lookup.
+	_, err = c.AuthGET(AccessPublic, "/cve/CVE-2023-5678")
+	c.expectEQ(err.(HTTPError).Code, http.StatusFound)
+	c.expectEQ(err.(HTTPError).Headers["Location"], []string{bugLink(bug.keyHash())})
+	page, err := c.AuthGET(AccessPublic, "/cve/CVE-2023-1234")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), bug.Title))
+	c.expectTrue(strings.Contains(string(page), bug2.Title))
+	_, err = c.AuthGET(AccessPublic, "/cve/CVE-2023-9999")
+	c.expectEQ(err.(HTTPError).Code, http.StatusNotFound)
+
+	// The bug page and its JSON.
+	page, err = c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "https://www.cve.org/CVERecord?id=CVE-2023-5678"))
+	c.expectTrue(!strings.Contains(string(page), "dev@syzkaller.com"))
+	reply2, err := c.AuthGET(AccessPublic, "/bug?extid="+extBugID+"&json=1")
+	c.expectOK(err)
+	var descr PublicAPIBugDescription
+	c.expectOK(json.Unmarshal(reply2, &descr))
+	c.expectEQ(descr.CVEs, []string{"CVE-2023-1234", "CVE-2023-5678"})
+
+	// Search.
+	page, err = c.AuthGET(AccessPublic, "/access-public-email/search?q=cve-2023-5678")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), bug.Title))
+	c.expectTrue(!strings.Contains(string(page), bug2.Title))
+
+	// Removal is recorded in the history as well.
+	_, err = c.GET("/admin?action=set_cves&extid=" + extBugID + "&cves=CVE-2023-5678")
+	c.expectEQ(err.(HTTPError).Code, http.StatusFound)
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.CVEs, []string{"CVE-2023-5678"})
+	c.expectEQ(len(bug.CVEHistory), 3)
+	c.expectTrue(bug.CVEHistory[2].Removed)
+}
@@ -0,0 +1,481 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	"github.com/google/syzkaller/pkg/hash"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	aemail "google.golang.org/appengine/v2/mail"
+)
+
+// Maintainers may subscribe to a weekly email that lists the bugs in the subsystems they care about
+// instead of (or in addition to) the per-bug traffic. A subscription is only created once the owner
+// of the address follows the signed confirmation link, every digest contains a signed unsubscribe link.
+
+// Subscription is a confirmed subscription of an email address to the digests of a namespace.
+type Subscription struct {
+	Namespace  string
+	Email      string
+	Subsystems []string
+	Created    time.Time
+	LastDigest time.Time
+}
+
+const (
+	digestPeriod = 7 * 24 * time.Hour
+	// If the cron is invoked once again soon after the previous run, subscribers must not get a second digest.
+	digestMinInterval = 6 * 24 * time.Hour
+	// Confirmation links are valid for this long.
+	digestConfirmValidity = 7 * 24 * time.Hour
+	// The maximum number of bugs in a single list of a digest group.
+	digestMaxBugs = 10
+)
+
+func subscriptionKey(c context.Context, ns, addr string) *db.Key {
+	return db.NewKey(c, "Subscription", hash.String([]byte(ns), []byte(addr)), 0, nil)
+}
+
+// digestToken signs the fields with the namespace secret.
+func digestToken(secret string, fields ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func checkDigestToken(secret, token string, fields ...string) bool {
+	return hmac.Equal([]byte(token), []byte(digestToken(secret, fields...)))
+}
+
+func digestConfirmLink(c context.Context, secret, ns, addr string, subsystems []string, now time.Time) string {
+	list := strings.Join(subsystems, ",")
+	date := fmt.Sprint(now.Unix())
+	return appURL(c) + "/digests/confirm?" + url.Values{
+		"ns":         {ns},
+		"email":      {addr},
+		"subsystems": {list},
+		"date":       {date},
+		"token":      {digestToken(secret, "confirm", ns, addr, list, date)},
+	}.Encode()
+}
+
+func digestUnsubscribeLink(c context.Context, secret, ns, addr string) string {
+	return appURL(c) + "/digests/unsubscribe?" + url.Values{
+		"ns":    {ns},
+		"email": {addr},
+		"token": {digestToken(secret, "unsubscribe", ns, addr)},
+	}.Encode()
+}
+
+// parseDigestSubsystems parses a comma- or space-separated list of subsystem names.
+func parseDigestSubsystems(c context.Context, ns, value string) ([]string, error) {
+	service := getSubsystemService(c, ns)
+	if service == nil {
+		return nil, fmt.Errorf("the namespace does not have subsystems")
+	}
+	names := map[string]bool{}
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		if service.ByName(name) == nil {
+			return nil, fmt.Errorf("unknown subsystem %q", name)
+		}
+		names[name] = true
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no subsystems are specified")
+	}
+	var ret []string
+	for name := range names {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func digestRequestNamespace(c context.Context, r *http.Request) (string, *DigestConfig, error) {
+	ns := r.FormValue("ns")
+	cfg := config.Namespaces[ns]
+	if cfg == nil || cfg.Digests == nil {
+		return "", nil, fmt.Errorf("digests are not enabled in namespace %q: %w", ns, ErrClientNotFound)
+	}
+	if err := checkNamespaceAccessLevel(c, r, ns, cfg.AccessLevel); err != nil {
+		return "", nil, err
+	}
+	return ns, cfg.Digests, nil
+}
+
+// handleDigestSubscribe sends the confirmation link to the address that wants to receive the digests.
+func handleDigestSubscribe(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns, cfg, err := digestRequestNamespace(c, r)
+	if err != nil {
+		return err
+	}
+	addr, err := mail.ParseAddress(r.FormValue("email"))
+	if err != nil {
+		return fmt.Errorf("bad email address: %v: %w", err, ErrClientBadRequest)
+	}
+	canonical := email.CanonicalEmail(addr.Address)
+	subsystems, err := parseDigestSubsystems(c, ns, r.FormValue("subsystems"))
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, ErrClientBadRequest)
+	}
+	body := fmt.Sprintf("Somebody (hopefully you) has asked to receive weekly syzbot digests of the %v bugs\n"+
+		"in the following subsystems: %v.\n\n"+
+		"To confirm the subscription, please follow the link below within %v days:\n%v\n\n"+
+		"If you did not request it, just ignore this email.\n",
+		ns, strings.Join(subsystems, ", "), int(digestConfirmValidity/(24*time.Hour)),
+		digestConfirmLink(c, cfg.Secret, ns, canonical, subsystems, timeNow(c)))
+	msg := &aemail.Message{
+		Sender:  fromAddr(c),
+		To:      []string{canonical},
+		Subject: fmt.Sprintf("[syzbot] confirm the weekly %v digest subscription", ns),
+		Body:    body,
+	}
+	if err := sendEmail(c, msg); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "The confirmation link has been sent to %v.\n", canonical)
+	return nil
+}
+
+func handleDigestConfirm(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns, cfg, err := digestRequestNamespace(c, r)
+	if err != nil {
+		return err
+	}
+	addr, list, date := r.FormValue("email"), r.FormValue("subsystems"), r.FormValue("date")
+	if !checkDigestToken(cfg.Secret, r.FormValue("token"), "confirm", ns, addr, list, date) {
+		return fmt.Errorf("invalid confirmation link: %w", ErrClientBadRequest)
+	}
+	var sent int64
+	if _, err := fmt.Sscan(date, &sent); err != nil {
+		return fmt.Errorf("invalid confirmation link: %w", ErrClientBadRequest)
+	}
+	now := timeNow(c)
+	if now.Sub(time.Unix(sent, 0)) > digestConfirmValidity {
+		return fmt.Errorf("the confirmation link has expired, please subscribe once again: %w",
+			ErrClientBadRequest)
+	}
+	subsystems, err := parseDigestSubsystems(c, ns, list)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, ErrClientBadRequest)
+	}
+	key := subscriptionKey(c, ns, addr)
+	tx := func(c context.Context) error {
+		sub := new(Subscription)
+		if err := db.Get(c, key, sub); err != nil && err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get subscription: %w", err)
+		}
+		if sub.Created.IsZero() {
+			sub.Created = now
+		}
+		sub.Namespace = ns
+		sub.Email = addr
+		sub.Subsystems = subsystems
+		if _, err := db.Put(c, key, sub); err != nil {
+			return fmt.Errorf("failed to put subscription: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%v is now subscribed to the weekly digests of the %v bugs in: %v.\n",
+		addr, ns, strings.Join(subsystems, ", "))
+	return nil
+}
+
+func handleDigestUnsubscribe(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns, cfg, err := digestRequestNamespace(c, r)
+	if err != nil {
+		return err
+	}
+	addr := r.FormValue("email")
+	if !checkDigestToken(cfg.Secret, r.FormValue("token"), "unsubscribe", ns, addr) {
+		return fmt.Errorf("invalid unsubscribe link: %w", ErrClientBadRequest)
+	}
+	if err := db.Delete(c, subscriptionKey(c, ns, addr)); err != nil && err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	fmt.Fprintf(w, "%v is unsubscribed from the weekly digests of the %v bugs.\n", addr, ns)
+	return nil
+}
+
+// handleWeeklyDigests sends the digests to all subscribers that have not received one during the last week.
+func handleWeeklyDigests(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for ns, cfg := range config.Namespaces {
+		if cfg.Digests == nil || cfg.Decommissioned {
+			continue
+		}
+		if err := sendDigests(c, ns, cfg.Digests); err != nil {
+			log.Errorf(c, "failed to send digests in %v: %v", ns, err)
+		}
+	}
+}
+
+func sendDigests(c context.Context, ns string, cfg *DigestConfig) error {
+	var subs []*Subscription
+	keys, err := db.NewQuery("Subscription").
+		Filter("Namespace=", ns).
+		GetAll(c, &subs)
+	if err != nil {
+		return fmt.Errorf("failed to query subscriptions: %w", err)
+	}
+	now := timeNow(c)
+	var bugs []*Bug
+	for i, sub := range subs {
+		if now.Sub(sub.LastDigest) < digestMinInterval {
+			continue
+		}
+		if bugs == nil {
+			if bugs, err = loadDigestBugs(c, ns, now.Add(-digestPeriod)); err != nil {
+				return err
+			}
+		}
+		digest := buildDigest(appURL(c), bugs, sub, cfg, now)
+		if digest != nil {
+			digest.UnsubscribeLink = digestUnsubscribeLink(c, cfg.Secret, ns, sub.Email)
+			if err := sendDigest(c, digest); err != nil {
+				return err
+			}
+		}
+		sub.LastDigest = now
+		if _, err := db.Put(c, keys[i], sub); err != nil {
+			return fmt.Errorf("failed to put subscription: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadDigestBugs returns the open bugs and the bugs closed since the specified time.
+func loadDigestBugs(c context.Context, ns string, since time.Time) ([]*Bug, error) {
+	open, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("Status=", BugStatusOpen)
+	})
+	if err != nil {
+		return nil, err
+	}
+	closed, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("Closed>=", since)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(open, closed...), nil
+}
+
+func sendDigest(c context.Context, digest *uiDigest) error {
+	body := new(bytes.Buffer)
+	if err := mailTemplates.ExecuteTemplate(body, "mail_digest.txt", digest); err != nil {
+		return fmt.Errorf("failed to execute digest template: %w", err)
+	}
+	msg := &aemail.Message{
+		Sender:  fromAddr(c),
+		To:      []string{digest.Email},
+		Subject: fmt.Sprintf("[syzbot] weekly %v digest: %v", digest.Namespace, digest.summary()),
+		Body:    body.String(),
+		Headers: mail.Header{
+			"List-Unsubscribe": []string{"<" + digest.UnsubscribeLink + ">"},
+		},
+	}
+	return sendEmail(c, msg)
+}
+
+type uiDigest struct {
+	Namespace       string
+	Email           string
+	Since           time.Time
+	Until           time.Time
+	Groups          []*uiDigestGroup
+	UnsubscribeLink string
+}
+
+// uiDigestGroup lists the bugs of a single subsystem.
+type uiDigestGroup struct {
+	Subsystem string
+	New       uiDigestList
+	Repro     uiDigestList
+	Fixed     uiDigestList
+	Attention uiDigestList
+}
+
+type uiDigestList struct {
+	Caption string
+	Bugs    []*uiDigestBug
+	// The number of bugs that did not fit into the list.
+	More int
+}
+
+type uiDigestBug struct {
+	Title string
+	Link  string
+	Note  string
+	// Only used for sorting.
+	numCrashes int64
+}
+
+func newDigestGroup(subsystem string) *uiDigestGroup {
+	return &uiDigestGroup{
+		Subsystem: subsystem,
+		New:       uiDigestList{Caption: "New bugs"},
+		Repro:     uiDigestList{Caption: "New reproducers"},
+		Fixed:     uiDigestList{Caption: "Fixed bugs"},
+		Attention: uiDigestList{Caption: "Bugs that need attention"},
+	}
+}
+
+// Lists returns the lists of the group in the order they are displayed.
+func (group *uiDigestGroup) Lists() []*uiDigestList {
+	return []*uiDigestList{&group.New, &group.Repro, &group.Fixed, &group.Attention}
+}
+
+func (group *uiDigestGroup) count() int {
+	ret := 0
+	for _, list := range group.Lists() {
+		ret += list.count()
+	}
+	return ret
+}
+
+func (list *uiDigestList) add(bug *Bug, link, note string) {
+	list.Bugs = append(list.Bugs, &uiDigestBug{
+		Title:      bug.displayTitle(),
+		Link:       link,
+		Note:       note,
+		numCrashes: bug.NumCrashes,
+	})
+}
+
+func (list *uiDigestList) trim() {
+	// The most frequent bugs go first.
+	sort.SliceStable(list.Bugs, func(i, j int) bool {
+		if list.Bugs[i].numCrashes != list.Bugs[j].numCrashes {
+			return list.Bugs[i].numCrashes > list.Bugs[j].numCrashes
+		}
+		return list.Bugs[i].Title < list.Bugs[j].Title
+	})
+	if len(list.Bugs) > digestMaxBugs {
+		list.More = len(list.Bugs) - digestMaxBugs
+		list.Bugs = list.Bugs[:digestMaxBugs]
+	}
+}
+
+func (list *uiDigestList) count() int {
+	return len(list.Bugs) + list.More
+}
+
+func (digest *uiDigest) summary() string {
+	var newBugs, fixed, attention int
+	for _, group := range digest.Groups {
+		newBugs += group.New.count()
+		fixed += group.Fixed.count()
+		attention += group.Attention.count()
+	}
+	return fmt.Sprintf("%v new, %v fixed, %v need attention", newBugs, fixed, attention)
+}
+
+// buildDigest assembles the digest for the subscriber, it returns nil if there's nothing to report.
+// Only the bugs that are publicly visible are included.
+func buildDigest(baseURL string, bugs []*Bug, sub *Subscription, cfg *DigestConfig, now time.Time) *uiDigest {
+	since := now.Add(-digestPeriod)
+	digest := &uiDigest{
+		Namespace: sub.Namespace,
+		Email:     sub.Email,
+		Since:     since,
+		Until:     now,
+	}
+	for _, name := range sub.Subsystems {
+		group := newDigestGroup(name)
+		for _, bug := range bugs {
+			reported := bugFirstReported(bug)
+			if bug.Namespace != sub.Namespace || !bug.hasSubsystem(name) || reported.IsZero() ||
+				AccessPublic < bug.sanitizeAccess(AccessPublic) {
+				continue
+			}
+			link := baseURL + bugLink(bug.keyHash())
+			switch {
+			case bug.Status == BugStatusFixed && !bug.Closed.Before(since):
+				group.Fixed.add(bug, link, strings.Join(bug.Commits, ", "))
+			case bug.Status != BugStatusOpen:
+			case !reported.Before(since):
+				group.New.add(bug, link, digestReproNote(bug))
+			case !bug.LastReproTime.Before(since) &&
+				(bug.LastReproOutcome == ReproOutcomeC || bug.LastReproOutcome == ReproOutcomeSyz):
+				group.Repro.add(bug, link, string(bug.LastReproOutcome))
+			default:
+				if note := digestAttentionNote(bug, reported, cfg, now); note != "" {
+					group.Attention.add(bug, link, note)
+				}
+			}
+		}
+		if group.count() == 0 {
+			continue
+		}
+		for _, list := range group.Lists() {
+			list.trim()
+		}
+		digest.Groups = append(digest.Groups, group)
+	}
+	if len(digest.Groups) == 0 {
+		return nil
+	}
+	return digest
+}
+
+func bugFirstReported(bug *Bug) time.Time {
+	var ret time.Time
+	for _, item := range bug.Reporting {
+		if !item.Reported.IsZero() && (ret.IsZero() || item.Reported.Before(ret)) {
+			ret = item.Reported
+		}
+	}
+	return ret
+}
+
+func digestReproNote(bug *Bug) string {
+	switch bug.ReproLevel {
+	case ReproLevelC:
+		return "C reproducer"
+	case ReproLevelSyz:
+		return "syz reproducer"
+	}
+	return ""
+}
+
+// digestAttentionNote returns a non-empty explanation if nobody has replied to the bug
+// and either it was reported long ago or its cause was already bisected.
+func digestAttentionNote(bug *Bug, reported time.Time, cfg *DigestConfig, now time.Time) string {
+	for _, item := range bug.DiscussionInfo {
+		if item.Summary.ExternalMessages != 0 {
+			return ""
+		}
+	}
+	var reasons []string
+	if now.Sub(reported) >= cfg.NoResponsePeriod {
+		reasons = append(reasons, fmt.Sprintf("no response for %v days", int(now.Sub(reported)/(24*time.Hour))))
+	}
+	if bug.BisectCause == BisectYes {
+		reasons = append(reasons, "cause bisected")
+	}
+	return strings.Join(reasons, ", ")
+}
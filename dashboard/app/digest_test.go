@@ -0,0 +1,268 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+func TestDigestToken(t *testing.T) {
+	token := digestToken("secret", "unsubscribe", "ns", "a@b.com")
+	if !checkDigestToken("secret", token, "unsubscribe", "ns", "a@b.com") {
+		t.Fatalf("valid token is rejected")
+	}
+	if checkDigestToken("secret", token, "unsubscribe", "ns", "c@b.com") ||
+		checkDigestToken("secret", token, "confirm", "ns", "a@b.com") ||
+		checkDigestToken("other secret", token, "unsubscribe", "ns", "a@b.com") {
+		t.Fatalf("invalid token is accepted")
+	}
+	// The field boundaries must matter.
+	if digestToken("secret", "ab", "c") == digestToken("secret", "a", "bc") {
+		t.Fatalf("tokens of different fields match")
+	}
+}
+
+// TestDigestTemplate compares the rendered digest with testdata/digest/digest.txt.
+// Run with -update to regenerate the golden file.
+func TestDigestTemplate(t *testing.T) {
+	now := time.Date(2023, time.June, 5, 6, 0, 0, 0, time.UTC)
+	const ns = "subsystem-reminders"
+	reported := func(private, public time.Time) []BugReporting {
+		return []BugReporting{
+			{Name: "non-public", Reported: private, Closed: public},
+			{Name: "public", Reported: public},
+		}
+	}
+	subsystems := func(names ...string) BugTags {
+		var tags BugTags
+		for _, name := range names {
+			tags.Subsystems = append(tags.Subsystems, BugSubsystem{Name: name})
+		}
+		return tags
+	}
+	day := 24 * time.Hour
+	bugs := []*Bug{
+		{
+			Title:      "WARNING in new_bug",
+			NumCrashes: 10,
+			ReproLevel: ReproLevelC,
+			Reporting:  reported(time.Time{}, now.Add(-2*day)),
+			Tags:       subsystems("subsystemA"),
+		},
+		{
+			Title:            "KASAN: use-after-free in new_repro",
+			NumCrashes:       5,
+			ReproLevel:       ReproLevelSyz,
+			LastReproTime:    now.Add(-day),
+			LastReproOutcome: ReproOutcomeSyz,
+			Reporting:        reported(time.Time{}, now.Add(-30*day)),
+			Tags:             subsystems("subsystemA"),
+		},
+		{
+			Title:     "general protection fault in fixed_bug",
+			Status:    BugStatusFixed,
+			Closed:    now.Add(-3 * day),
+			Commits:   []string{"subsystemA: fix the crash"},
+			Reporting: reported(time.Time{}, now.Add(-40*day)),
+			Tags:      subsystems("subsystemA"),
+		},
+		{
+			Title:      "INFO: task hung in no_response",
+			NumCrashes: 100,
+			Reporting:  reported(time.Time{}, now.Add(-30*day)),
+			Tags:       subsystems("subsystemA", "subsystemB"),
+		},
+		{
+			Title:       "BUG: unable to handle kernel paging request in bisected",
+			NumCrashes:  3,
+			BisectCause: BisectYes,
+			Reporting:   reported(time.Time{}, now.Add(-10*day)),
+			Tags:        subsystems("subsystemA"),
+		},
+		{
+			// The maintainers have already replied.
+			Title:     "WARNING in discussed",
+			Reporting: reported(time.Time{}, now.Add(-30*day)),
+			DiscussionInfo: []BugDiscussionInfo{
+				{Summary: DiscussionSummary{AllMessages: 2, ExternalMessages: 1}},
+			},
+			Tags: subsystems("subsystemA"),
+		},
+		{
+			// The bug was fixed long ago.
+			Title:     "WARNING in old_fix",
+			Status:    BugStatusFixed,
+			Closed:    now.Add(-30 * day),
+			Reporting: reported(time.Time{}, now.Add(-40*day)),
+			Tags:      subsystems("subsystemA"),
+		},
+		{
+			// The bug is not public yet.
+			Title:     "WARNING in keep private",
+			Reporting: reported(now.Add(-day), time.Time{}),
+			Tags:      subsystems("subsystemA"),
+		},
+		{
+			// The bug is not reported at all.
+			Title: "WARNING in unreported",
+			Tags:  subsystems("subsystemA"),
+		},
+	}
+	for _, bug := range bugs {
+		bug.Namespace = ns
+		if bug.Status == 0 {
+			bug.Status = BugStatusOpen
+		}
+	}
+	sub := &Subscription{
+		Namespace:  ns,
+		Email:      "maintainer@kernel.org",
+		Subsystems: []string{"subsystemA", "subsystemB"},
+	}
+	digest := buildDigest("https://testapp.appspot.com", bugs, sub, config.Namespaces[ns].Digests, now)
+	if digest == nil {
+		t.Fatal("got no digest")
+	}
+	digest.UnsubscribeLink = "https://testapp.appspot.com/digests/unsubscribe?token=1234"
+	if got, want := digest.summary(), "1 new, 1 fixed, 3 need attention"; got != want {
+		t.Errorf("bad summary: %q, want %q", got, want)
+	}
+	body := new(bytes.Buffer)
+	if err := mailTemplates.ExecuteTemplate(body, "mail_digest.txt", digest); err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "digest", "digest.txt")
+	if *flagUpdate {
+		if err := osutil.WriteFile(golden, body.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), body.String()); diff != "" {
+		t.Fatalf("digest mismatch (-want +got), run with -update if it's expected:\n%s", diff)
+	}
+
+	// Nothing happened in subsystemB except for the bug that needs attention.
+	sub.Subsystems = []string{"subsystemB"}
+	digest = buildDigest("https://testapp.appspot.com", bugs[3:4], sub, config.Namespaces[ns].Digests, now)
+	if digest == nil || len(digest.Groups) != 1 || digest.Groups[0].Attention.count() != 1 {
+		t.Fatalf("bad digest: %+v", digest)
+	}
+	// There's nothing to send.
+	if digest := buildDigest("https://testapp.appspot.com", bugs[5:], sub,
+		config.Namespaces[ns].Digests, now); digest != nil {
+		t.Fatalf("expected no digest, got %+v", digest)
+	}
+}
+
+func TestDigestListTrim(t *testing.T) {
+	list := uiDigestList{}
+	for i := 0; i < digestMaxBugs+3; i++ {
+		list.add(&Bug{Namespace: "test1", Title: "title", Seq: int64(i), NumCrashes: int64(i)}, "", "")
+	}
+	list.trim()
+	if len(list.Bugs) != digestMaxBugs || list.More != 3 || list.count() != digestMaxBugs+3 {
+		t.Fatalf("bad trimmed list: %v bugs, %v more", len(list.Bugs), list.More)
+	}
+	if list.Bugs[0].numCrashes != digestMaxBugs+2 {
+		t.Fatalf("the most frequent bug is not the first one")
+	}
+}
+
+var digestLinkRe = regexp.MustCompile(`https://\S+/digests/(?:confirm|unsubscribe)\?\S+`)
+
+func TestWeeklyDigests(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.makeClient(clientSubsystemRemind, keySubsystemRemind, true)
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	page, err := c.AuthGET(AccessPublic, "/subsystem-reminders/subsystems")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(`action="/digests/subscribe"`)))
+
+	// Unknown subsystems and bad addresses are rejected.
+	_, err = c.AuthGET(AccessPublic, "/digests/subscribe?ns=subsystem-reminders"+
+		"&email=dev@kernel.org&subsystems=unknown")
+	c.expectBadReqest(err)
+	_, err = c.AuthGET(AccessPublic, "/digests/subscribe?ns=subsystem-reminders"+
+		"&email=dev&subsystems=subsystemA")
+	c.expectBadReqest(err)
+
+	_, err = c.AuthGET(AccessPublic, "/digests/subscribe?ns=subsystem-reminders"+
+		"&email=Dev@kernel.org&subsystems=subsystemA,subsystemB")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 1)
+	msg := <-c.emailSink
+	c.expectEQ(msg.To, []string{"dev@kernel.org"})
+	confirm := digestLinkRe.FindString(msg.Body)
+	c.expectNE(confirm, "")
+	confirmURL, err := url.Parse(confirm)
+	c.expectOK(err)
+
+	// A tampered link is not accepted.
+	query := confirmURL.Query()
+	query.Set("email", "other@kernel.org")
+	_, err = c.AuthGET(AccessPublic, confirmURL.Path+"?"+query.Encode())
+	c.expectBadReqest(err)
+
+	reply, err := c.AuthGET(AccessPublic, confirmURL.RequestURI())
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(reply), "dev@kernel.org is now subscribed"))
+
+	crash := testCrash(build, 1)
+	crash.Title = "WARNING in a_func"
+	crash.GuiltyFiles = []string{"a.c"}
+	client.ReportCrash(crash)
+	client.pollEmailBug()
+
+	_, err = c.GET("/cron/weekly_digests")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 1)
+	msg = <-c.emailSink
+	c.expectEQ(msg.To, []string{"dev@kernel.org"})
+	c.expectEQ(msg.Subject, "[syzbot] weekly subsystem-reminders digest: 1 new, 0 fixed, 0 need attention")
+	c.expectTrue(strings.Contains(msg.Body, "== subsystemA ==\n\nNew bugs:\n- WARNING in a_func"))
+	c.expectTrue(!strings.Contains(msg.Body, "subsystemB"))
+
+	// The digest is sent at most once a week.
+	c.advanceTime(time.Hour)
+	_, err = c.GET("/cron/weekly_digests")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 0)
+
+	unsubscribe := digestLinkRe.FindString(msg.Body)
+	c.expectNE(unsubscribe, "")
+	c.expectEQ(msg.Headers["List-Unsubscribe"], []string{"<" + unsubscribe + ">"})
+	unsubscribeURL, err := url.Parse(unsubscribe)
+	c.expectOK(err)
+	_, err = c.AuthGET(AccessPublic, unsubscribeURL.RequestURI())
+	c.expectOK(err)
+
+	c.advanceTime(digestPeriod)
+	_, err = c.GET("/cron/weekly_digests")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 0)
+
+	// Confirmation links expire.
+	c.advanceTime(digestConfirmValidity)
+	_, err = c.AuthGET(AccessPublic, confirmURL.RequestURI())
+	c.expectBadReqest(err)
+}
@@ -4,14 +4,22 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/hash"
 	"golang.org/x/net/context"
 	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
 )
 
 type newDiscussionMessage struct {
@@ -20,21 +28,34 @@ type newDiscussionMessage struct {
 	msgSource dashapi.DiscussionSource
 	msgType   dashapi.DiscussionType
 	bugIDs    []string
-	inReplyTo string
-	external  bool
-	time      time.Time
+	// bugReasons maps bugIDs to the reasons they were found for.
+	bugReasons map[string]dashapi.AttachmentReason
+	parentIDs  []string // the messages this one replies to, the closest first
+	external   bool
+	autoReply  bool
+	excerpt    string
+	author     string
+	time       time.Time
+	// targetTree is the tree the patch targets, only guessed for patch messages.
+	targetTree string
 }
 
 // saveDiscussionMessage is meant to be called after each received E-mail message,
 // for which we know the BugID.
 func saveDiscussionMessage(c context.Context, msg *newDiscussionMessage) error {
+	impl := discussionSources[msg.msgSource]
+	if impl == nil {
+		return fmt.Errorf("unknown discussion source %q", msg.msgSource)
+	}
 	discUpdate := &dashapi.Discussion{
-		Source: msg.msgSource,
-		Type:   msg.msgType,
-		BugIDs: msg.bugIDs,
+		Source:     msg.msgSource,
+		Type:       msg.msgType,
+		BugIDs:     msg.bugIDs,
+		BugReasons: msg.bugReasons,
+		TargetTree: msg.targetTree,
 	}
-	if msg.inReplyTo != "" {
-		d, err := discussionByMessageID(c, msg.msgSource, msg.inReplyTo)
+	if len(msg.parentIDs) != 0 {
+		d, err := discussionByParents(c, msg.msgSource, msg.parentIDs)
 		if err == nil {
 			discUpdate.ID = d.ID
 			discUpdate.Type = dashapi.DiscussionType(d.Type)
@@ -48,27 +69,244 @@ func saveDiscussionMessage(c context.Context, msg *newDiscussionMessage) error {
 		discUpdate.ID = msg.id
 		discUpdate.Subject = msg.subject
 	}
+	msgTime := msg.time
+	if msgTime.IsZero() {
+		// The Date header was missing or malformed.
+		msgTime = timeNow(c)
+	}
 	discUpdate.Messages = append(discUpdate.Messages, dashapi.DiscussionMessage{
-		ID:       msg.id,
-		Time:     msg.time,
-		External: msg.external,
+		ID:        msg.id,
+		Time:      msgTime,
+		External:  msg.external,
+		AutoReply: msg.autoReply,
+		Excerpt:   msg.excerpt,
+		Author:    msg.author,
 	})
-	return mergeDiscussion(c, discUpdate)
+	return mergeDiscussionWithQuota(c, "", discUpdate)
+}
+
+// mergeDiscussionWithQuota is the entry point for discussion updates coming from the outside.
+// If ns is not empty, the update may only refer to the bugs of the namespace.
+// If the source has exceeded its hourly quota, the update is saved aside instead.
+func mergeDiscussionWithQuota(c context.Context, ns string, update *dashapi.Discussion) error {
+	// Don't charge the quota for invalid updates.
+	if err := normalizeDiscussion(update); err != nil {
+		return err
+	}
+	ok, err := chargeDiscussionQuota(c, update.Source, len(update.Messages))
+	if err != nil {
+		return err
+	}
+	if ok {
+		return mergeNamespaceDiscussion(c, ns, update)
+	}
+	log.Warningf(c, "discussion source %v is over quota, spilling %v", update.Source, update.ID)
+	data, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the update: %w", err)
+	}
+	spill := &DiscussionSpill{
+		Source:    string(update.Source),
+		Namespace: ns,
+		Time:      timeNow(c),
+		Update:    data,
+	}
+	if _, err := db.Put(c, db.NewIncompleteKey(c, "DiscussionSpill", nil), spill); err != nil {
+		return fmt.Errorf("failed to save the spilled update: %w", err)
+	}
+	return nil
+}
+
+func defaultDiscussionQuota(source dashapi.DiscussionSource) int {
+	if source == dashapi.DiscussionLore {
+		// All mailing lists go through it.
+		return 20000
+	}
+	return 1000
+}
+
+func discussionQuota(source dashapi.DiscussionSource) int {
+	if quota := config.DiscussionQuotas[source]; quota != 0 {
+		return quota
+	}
+	return defaultDiscussionQuota(source)
+}
+
+// The quota is counted by memcache counters, as lore may send thousands of messages per hour
+// and a single DiscussionQuota entity can't sustain such a write rate.
+// The counters are persisted to DiscussionQuota every discussionQuotaFlushStep messages,
+// which gives a lower bound to restore the counters from, if they are evicted.
+const discussionQuotaFlushStep = 100
+
+func discussionQuotaCounterKey(source string, hour time.Time, counter string) string {
+	return fmt.Sprintf("discussion-quota-%v-%v-%v", source, hour.Unix(), counter)
+}
+
+// chargeDiscussionQuota accounts the messages against the current hour quota of the source.
+// It returns false if the messages must not be processed.
+func chargeDiscussionQuota(c context.Context, source dashapi.DiscussionSource, messages int) (bool, error) {
+	hour := timeNow(c).Truncate(time.Hour)
+	key := discussionQuotaKey(c, string(source), hour)
+	messagesKey := discussionQuotaCounterKey(string(source), hour, "messages")
+	total, err := incDiscussionQuotaCounter(c, key, messagesKey, messages,
+		func(quota *DiscussionQuota) int { return quota.Messages })
+	if err != nil {
+		// Memcache problems must not stop the ingestion.
+		log.Errorf(c, "failed to count %v discussion messages: %v", source, err)
+		return true, nil
+	}
+	if total <= discussionQuota(source) {
+		flushDiscussionQuota(c, key, source, hour, total-messages, total, 0)
+		return true, nil
+	}
+	if _, err := memcache.IncrementExisting(c, messagesKey, -int64(messages)); err != nil {
+		log.Errorf(c, "failed to uncount %v discussion messages: %v", source, err)
+	}
+	dropped, err := incDiscussionQuotaCounter(c, key, discussionQuotaCounterKey(string(source), hour, "dropped"),
+		messages, func(quota *DiscussionQuota) int { return quota.Dropped })
+	if err != nil {
+		log.Errorf(c, "failed to count %v dropped discussion messages: %v", source, err)
+		return false, nil
+	}
+	flushDiscussionQuota(c, key, source, hour, dropped-messages, 0, dropped)
+	return false, nil
+}
+
+// incDiscussionQuotaCounter adds delta to the memcache counter and returns its new value.
+// If the counter was evicted, it's restored from the persisted DiscussionQuota.
+func incDiscussionQuotaCounter(c context.Context, key *db.Key, counterKey string, delta int,
+	persisted func(*DiscussionQuota) int) (int, error) {
+	val, err := memcache.IncrementExisting(c, counterKey, int64(delta))
+	if err == memcache.ErrCacheMiss {
+		quota := new(DiscussionQuota)
+		if err := db.Get(c, key, quota); err != nil && err != db.ErrNoSuchEntity {
+			return 0, fmt.Errorf("failed to get discussion quota: %w", err)
+		}
+		val, err = memcache.Increment(c, counterKey, int64(delta), uint64(persisted(quota)))
+	}
+	return int(val), err
+}
+
+// flushDiscussionQuota persists the counter that went from prev to cur, if it has crossed
+// a multiple of discussionQuotaFlushStep (or if it's the first update of the hour).
+func flushDiscussionQuota(c context.Context, key *db.Key, source dashapi.DiscussionSource, hour time.Time,
+	prev, messages, dropped int) {
+	cur := messages + dropped
+	if prev != 0 && prev/discussionQuotaFlushStep == cur/discussionQuotaFlushStep {
+		return
+	}
+	tx := func(c context.Context) error {
+		quota := new(DiscussionQuota)
+		if err := db.Get(c, key, quota); err != nil && err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get discussion quota: %w", err)
+		}
+		quota.Source = string(source)
+		quota.Hour = hour
+		// The flushes may race, the counters never go back.
+		if quota.Messages < messages {
+			quota.Messages = messages
+		}
+		if quota.Dropped < dropped {
+			quota.Dropped = dropped
+		}
+		if _, err := db.Put(c, key, quota); err != nil {
+			return fmt.Errorf("failed to put discussion quota: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 15}); err != nil {
+		log.Errorf(c, "failed to persist %v discussion quota: %v", source, err)
+	}
+}
+
+// loadDiscussionQuotas returns quota usage records for the last day, newest first.
+// The persisted counters are refreshed from memcache, if they are still there.
+func loadDiscussionQuotas(c context.Context) ([]*DiscussionQuota, error) {
+	var quotas []*DiscussionQuota
+	_, err := db.NewQuery("DiscussionQuota").
+		Filter("Hour>", timeNow(c).Add(-24*time.Hour)).
+		Order("-Hour").
+		GetAll(c, &quotas)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, quota := range quotas {
+		keys = append(keys,
+			discussionQuotaCounterKey(quota.Source, quota.Hour, "messages"),
+			discussionQuotaCounterKey(quota.Source, quota.Hour, "dropped"))
+	}
+	items, err := memcache.GetMulti(c, keys)
+	if err != nil {
+		log.Errorf(c, "failed to get discussion quota counters: %v", err)
+		return quotas, nil
+	}
+	counter := func(key string, persisted int) int {
+		if item := items[key]; item != nil {
+			if val, err := strconv.Atoi(string(item.Value)); err == nil && val > persisted {
+				return val
+			}
+		}
+		return persisted
+	}
+	for i, quota := range quotas {
+		quota.Messages = counter(keys[2*i], quota.Messages)
+		quota.Dropped = counter(keys[2*i+1], quota.Dropped)
+	}
+	return quotas, nil
+}
+
+// replayDiscussionSpills processes up to limit spilled discussion updates, bypassing the quota.
+func replayDiscussionSpills(c context.Context, limit int) (int, error) {
+	var spills []*DiscussionSpill
+	keys, err := db.NewQuery("DiscussionSpill").
+		Order("Time").
+		Limit(limit).
+		GetAll(c, &spills)
+	if err != nil {
+		return 0, err
+	}
+	for i, spill := range spills {
+		update := new(dashapi.Discussion)
+		if err := json.Unmarshal(spill.Update, update); err != nil {
+			return i, fmt.Errorf("failed to unmarshal the update: %w", err)
+		}
+		if err := mergeNamespaceDiscussion(c, spill.Namespace, update); err != nil {
+			return i, err
+		}
+		if err := db.Delete(c, keys[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(spills), nil
 }
 
 // mergeDiscussion either creates a new discussion or updates the existing one.
-// It is assumed that the input is valid.
+// The bug IDs must refer to existing bugs.
 func mergeDiscussion(c context.Context, update *dashapi.Discussion) error {
-	if len(update.Messages) == 0 {
-		return fmt.Errorf("no messages")
+	return mergeNamespaceDiscussion(c, "", update)
+}
+
+// mergeNamespaceDiscussion is mergeDiscussion that only accepts bugs of the namespace, if ns is not empty.
+func mergeNamespaceDiscussion(c context.Context, ns string, update *dashapi.Discussion) error {
+	if err := normalizeDiscussion(update); err != nil {
+		return err
 	}
-	newBugKeys, err := getBugKeys(c, update.BugIDs)
+	// The discussion may have been merged into another one.
+	id, err := resolveDiscussionID(c, string(update.Source), update.ID)
 	if err != nil {
-		return nil
+		return err
+	}
+	update.ID = id
+	newBugKeys, err := getBugKeys(c, ns, update.BugIDs)
+	if err != nil {
+		return err
 	}
 	// First update the discussion itself.
 	d := new(Discussion)
 	var diff DiscussionSummary
+	// The bugs that were not attached to the discussion before the update.
+	attached := map[string]bool{}
 	tx := func(c context.Context) error {
 		err := db.Get(c, discussionKey(c, string(update.Source), update.ID), d)
 		if err != nil && err != db.ErrNoSuchEntity {
@@ -79,11 +317,33 @@ func mergeDiscussion(c context.Context, update *dashapi.Discussion) error {
 			d.Type = string(update.Type)
 			d.Subject = update.Subject
 		}
-		d.BugKeys = unique(append(d.BugKeys, newBugKeys...))
-		diff = d.addMessages(update.Messages)
+		attached = map[string]bool{}
+		for i, key := range newBugKeys {
+			reason := update.BugReasons[update.BugIDs[i]]
+			if reason == "" {
+				reason = dashapi.AttachAPI
+			}
+			if !stringInList(d.BugKeys, key) {
+				attached[key] = true
+			}
+			d.attachBug(key, reason)
+		}
+		diff = d.addMessages(update.Messages, timeNow(c))
 		if d.Type == string(dashapi.DiscussionPatch) {
 			diff.LastPatchMessage = diff.LastMessage
 		}
+		if d.Type == string(dashapi.DiscussionPatch) && d.TargetTree == "" {
+			d.TargetTree = update.TargetTree
+			if d.TargetTree == "" {
+				d.TargetTree = guessTargetTree(update)
+			}
+		}
+		if update.PatchState != "" && update.PatchState != d.PatchState {
+			d.PatchState = update.PatchState
+			if d.PatchState == patchStateAccepted {
+				diff.LastPatchAccepted = timeNow(c)
+			}
+		}
 		d.Summary.merge(diff)
 		_, err = db.Put(c, d.key(c), d)
 		if err != nil {
@@ -91,30 +351,102 @@ func mergeDiscussion(c context.Context, update *dashapi.Discussion) error {
 		}
 		return nil
 	}
-	err = db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 15, XG: true})
+	err = db.RunInTransaction(c, countTxRetries("discussion", tx), &db.TransactionOptions{Attempts: 15, XG: true})
 	if err != nil {
 		return err
 	}
+	incMetric(c, metricDiscussionMessages, d.Source, int64(diff.AllMessages))
 	// Update individual bug statistics.
 	// We have to do it outside of the main transaction, as we might hit the "operating on
 	// too many entity groups in a single transaction." error.
+	// The newly attached bugs get the whole discussion counted, not just the new messages.
 	for _, key := range d.BugKeys {
-		err := db.RunInTransaction(c, func(c context.Context) error {
-			return mergeDiscussionSummary(c, key, d.Source, diff)
-		}, &db.TransactionOptions{Attempts: 15})
-		if err != nil {
+		bugDiff := diff
+		if attached[key] {
+			bugDiff = d.Summary
+		}
+		if err := updateBugDiscussionSummary(c, key, d.Source, bugDiff); err != nil {
 			return fmt.Errorf("failed to put update summary for %s: %w", key, err)
 		}
 	}
 	return nil
 }
 
-func mergeDiscussionSummary(c context.Context, key, source string, diff DiscussionSummary) error {
+// normalizeDiscussion does the minimal checks of the update and normalizes its message IDs.
+func normalizeDiscussion(update *dashapi.Discussion) error {
+	if len(update.Messages) == 0 {
+		return fmt.Errorf("no messages")
+	}
+	impl := discussionSources[update.Source]
+	if impl == nil {
+		return fmt.Errorf("unknown discussion source %q", update.Source)
+	}
+	update.ID = impl.NormalizeID(update.ID)
+	for i := range update.Messages {
+		update.Messages[i].ID = impl.NormalizeID(update.Messages[i].ID)
+	}
+	return nil
+}
+
+// validateDiscussion checks the update received via the report_discussion API
+// and normalizes and deduplicates its message IDs.
+// The other paths don't do these checks to not break the existing clients.
+func validateDiscussion(update *dashapi.Discussion) error {
+	impl := discussionSources[update.Source]
+	if impl == nil {
+		return fmt.Errorf("unknown discussion source %q", update.Source)
+	}
+	if strings.TrimSpace(update.ID) == "" {
+		return fmt.Errorf("empty discussion ID")
+	}
+	if len(update.Messages) == 0 {
+		return fmt.Errorf("no messages")
+	}
+	if len(update.Messages) > dashapi.MaxDiscussionMessages {
+		return fmt.Errorf("too many messages: %v, the limit is %v",
+			len(update.Messages), dashapi.MaxDiscussionMessages)
+	}
+	for id, reason := range update.BugReasons {
+		if _, ok := attachmentStrength[reason]; !ok {
+			return fmt.Errorf("unknown attachment reason %q for %v", reason, id)
+		}
+	}
+	update.ID = impl.NormalizeID(update.ID)
+	seen := map[string]bool{}
+	var messages []dashapi.DiscussionMessage
+	for _, m := range update.Messages {
+		if strings.TrimSpace(m.ID) == "" {
+			return fmt.Errorf("empty message ID")
+		}
+		if m.Time.IsZero() {
+			return fmt.Errorf("message %q has no time", m.ID)
+		}
+		m.ID = impl.NormalizeID(m.ID)
+		if seen[m.ID] {
+			continue
+		}
+		seen[m.ID] = true
+		messages = append(messages, m)
+	}
+	update.Messages = messages
+	return nil
+}
+
+// mergeDiscussionSummary merges the diff into the bug summary and returns the bug namespace.
+func mergeDiscussionSummary(c context.Context, key, source string, diff DiscussionSummary) (string, error) {
 	bug := new(Bug)
 	bugKey := db.NewKey(c, "Bug", key, 0, nil)
 	if err := db.Get(c, bugKey, bug); err != nil {
-		return fmt.Errorf("failed to get bug: %v", err)
+		return "", fmt.Errorf("failed to get bug: %v", err)
 	}
+	bug.mergeDiscussionSummary(source, diff)
+	if _, err := db.Put(c, bugKey, bug); err != nil {
+		return "", fmt.Errorf("failed to put bug: %v", err)
+	}
+	return bug.Namespace, nil
+}
+
+func (bug *Bug) mergeDiscussionSummary(source string, diff DiscussionSummary) {
 	var record *BugDiscussionInfo
 	for i, item := range bug.DiscussionInfo {
 		if item.Source == source {
@@ -128,8 +460,98 @@ func mergeDiscussionSummary(c context.Context, key, source string, diff Discussi
 		record = &bug.DiscussionInfo[len(bug.DiscussionInfo)-1]
 	}
 	record.Summary.merge(diff)
-	if _, err := db.Put(c, bugKey, bug); err != nil {
-		return fmt.Errorf("failed to put bug: %v", err)
+	bug.updateDiscussionActivity()
+	if diff.ExternalMessages != 0 {
+		bug.promoteFromDigest(diff.LastMessage, "discussion")
+	}
+}
+
+// moveBugDiscussions re-attaches all discussions of the bug with oldKey to the bug with newKey.
+// It is supposed to be used when an already existing bug is re-created under a new key.
+// Other bugs referenced by the same discussions are left intact.
+func moveBugDiscussions(c context.Context, oldKey, newKey *db.Key) error {
+	discussions, err := discussionsForBug(c, oldKey)
+	if err != nil {
+		return err
+	}
+	var keys []*db.Key
+	for _, d := range discussions {
+		keys = append(keys, d.key(c))
+	}
+	// The discussions that were not yet attached to the new bug,
+	// only their summaries are to be added to it.
+	var moved []*Discussion
+	for len(keys) != 0 {
+		// There's a 25 entity group limit for XG transactions.
+		batchSize := 20
+		if batchSize > len(keys) {
+			batchSize = len(keys)
+		}
+		batchKeys := keys[:batchSize]
+		keys = keys[batchSize:]
+		var batchMoved []*Discussion
+		tx := func(c context.Context) error {
+			batch := make([]*Discussion, len(batchKeys))
+			if err := db.GetMulti(c, batchKeys, batch); err != nil {
+				return fmt.Errorf("failed to get discussions: %w", err)
+			}
+			batchMoved = nil
+			for _, d := range batch {
+				if !stringInList(d.BugKeys, newKey.StringID()) {
+					batchMoved = append(batchMoved, d)
+				}
+				d.moveBug(oldKey.StringID(), newKey.StringID())
+			}
+			if _, err := db.PutMulti(c, batchKeys, batch); err != nil {
+				return fmt.Errorf("failed to put discussions: %w", err)
+			}
+			return nil
+		}
+		if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 15, XG: true}); err != nil {
+			return err
+		}
+		moved = append(moved, batchMoved...)
+	}
+	// Now move the aggregated statistics.
+	var namespaces []string
+	tx := func(c context.Context) error {
+		oldBug, newBug := new(Bug), new(Bug)
+		if err := db.Get(c, oldKey, oldBug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		if err := db.Get(c, newKey, newBug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		for _, d := range moved {
+			var record *BugDiscussionInfo
+			for i := range newBug.DiscussionInfo {
+				if newBug.DiscussionInfo[i].Source == d.Source {
+					record = &newBug.DiscussionInfo[i]
+				}
+			}
+			if record == nil {
+				newBug.DiscussionInfo = append(newBug.DiscussionInfo, BugDiscussionInfo{
+					Source:  d.Source,
+					Summary: d.Summary,
+				})
+				continue
+			}
+			record.Summary.merge(d.Summary)
+		}
+		newBug.updateDiscussionActivity()
+		oldBug.DiscussionInfo = nil
+		oldBug.updateDiscussionActivity()
+		if _, err := db.PutMulti(c, []*db.Key{oldKey, newKey}, []*Bug{oldBug, newBug}); err != nil {
+			return fmt.Errorf("failed to put bugs: %w", err)
+		}
+		namespaces = []string{oldBug.Namespace, newBug.Namespace}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 15, XG: true}); err != nil {
+		return err
+	}
+	for _, ns := range unique(namespaces) {
+		invalidateBugLists(c, ns)
 	}
 	return nil
 }
@@ -143,6 +565,13 @@ func (ds *DiscussionSummary) merge(diff DiscussionSummary) {
 	if ds.LastPatchMessage.Before(diff.LastPatchMessage) {
 		ds.LastPatchMessage = diff.LastPatchMessage
 	}
+	if ds.LastVerdictTime.Before(diff.LastVerdictTime) {
+		ds.LastVerdict = diff.LastVerdict
+		ds.LastVerdictTime = diff.LastVerdictTime
+	}
+	if ds.LastPatchAccepted.Before(diff.LastPatchAccepted) {
+		ds.LastPatchAccepted = diff.LastPatchAccepted
+	}
 }
 
 func (bug *Bug) discussionSummary() DiscussionSummary {
@@ -155,9 +584,90 @@ func (bug *Bug) discussionSummary() DiscussionSummary {
 	return ret
 }
 
+// updateDiscussionActivity refreshes the fields denormalized from DiscussionInfo.
+func (bug *Bug) updateDiscussionActivity() {
+	summary := bug.discussionSummary()
+	bug.LastDiscussionActivity = summary.LastMessage
+	bug.Disputed = summary.LastVerdict == sentimentDisputed &&
+		summary.LastVerdictTime.After(bug.DisputeClearedTime)
+}
+
+// handleClearDisputed resets the Disputed flag of the bug if the classifier got it wrong.
+func handleClearDisputed(c context.Context, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	if err := clearBugDispute(c, bug.key(c)); err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+// clearBugDispute resets the Disputed flag until a newer verdict appears in the discussions.
+func clearBugDispute(c context.Context, bugKey *db.Key) error {
+	ns := ""
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		ns = bug.Namespace
+		bug.DisputeClearedTime = bug.discussionSummary().LastVerdictTime
+		bug.updateDiscussionActivity()
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return err
+	}
+	invalidateBugLists(c, ns)
+	return nil
+}
+
 const maxMessagesInDiscussion = 1500
 
-func (d *Discussion) addMessages(messages []dashapi.DiscussionMessage) DiscussionSummary {
+// If the Date header and the receive time of a message differ more than that,
+// the message is considered to have been backfilled from an archive.
+const maxDiscussionClockSkew = 24 * time.Hour
+
+// orderTime is the time by which messages are ordered within a discussion.
+// The receive time reflects the actual order of replies better than the Date header,
+// but for backfilled and old messages only the header time is meaningful.
+func (m *DiscussionMessage) orderTime() time.Time {
+	if m.ReceivedTime.IsZero() || m.ReceivedTime.Sub(m.Time) > maxDiscussionClockSkew {
+		return m.Time
+	}
+	return m.ReceivedTime
+}
+
+// activityTime is the time the message counts as activity at: max(header, receive time),
+// so that messages with a back-dated Date header don't move the last activity back.
+// Backfilled messages only count with their header time.
+func (m *DiscussionMessage) activityTime() time.Time {
+	if m.ReceivedTime.IsZero() || m.ReceivedTime.Sub(m.Time) > maxDiscussionClockSkew ||
+		m.Time.After(m.ReceivedTime) {
+		return m.Time
+	}
+	return m.ReceivedTime
+}
+
+// lastActivity returns the last activity time of the discussion.
+// The summaries of the older discussions were only based on the header times.
+func (d *Discussion) lastActivity() time.Time {
+	ret := d.Summary.LastMessage
+	for i := range d.Messages {
+		m := &d.Messages[i]
+		if t := m.activityTime(); !m.AutoReply && ret.Before(t) {
+			ret = t
+		}
+	}
+	return ret
+}
+
+func (d *Discussion) addMessages(messages []dashapi.DiscussionMessage, now time.Time) DiscussionSummary {
 	var diff DiscussionSummary
 	existingIDs := d.messageIDs()
 	for _, m := range messages {
@@ -165,26 +675,124 @@ func (d *Discussion) addMessages(messages []dashapi.DiscussionMessage) Discussio
 			continue
 		}
 		existingIDs[m.ID] = struct{}{}
+		sentiment := sentimentNeutral
+		if m.External && !m.AutoReply {
+			sentiment = classifySentiment(m.Excerpt)
+		}
+		authorDomain, authorHash := authorIdentity(m.Author)
+		author := ""
+		if d.Type == string(dashapi.DiscussionPatch) {
+			author = m.Author
+		}
+		msg := DiscussionMessage{
+			ID:           m.ID,
+			External:     m.External,
+			Time:         m.Time,
+			AutoReply:    m.AutoReply,
+			ReceivedTime: now,
+			Sentiment:    sentiment,
+			AuthorDomain: authorDomain,
+			AuthorHash:   authorHash,
+			Author:       author,
+		}
+		d.Messages = append(d.Messages, msg)
+		if m.AutoReply {
+			// Out-of-office replies do not mean that anyone has looked at the bug.
+			continue
+		}
 		diff.AllMessages++
 		if m.External {
 			diff.ExternalMessages++
 		}
-		if diff.LastMessage.Before(m.Time) {
-			diff.LastMessage = m.Time
+		// Summaries are merged by taking the maximum, so together with activityTime
+		// a reply dated before its parent does not move the last activity back.
+		activity := msg.activityTime()
+		if diff.LastMessage.Before(activity) {
+			diff.LastMessage = activity
+		}
+		if sentiment != sentimentNeutral && diff.LastVerdictTime.Before(activity) {
+			diff.LastVerdict = sentiment
+			diff.LastVerdictTime = activity
 		}
-		d.Messages = append(d.Messages, DiscussionMessage{
-			ID:       m.ID,
-			External: m.External,
-			Time:     m.Time,
-		})
 	}
-	sort.Slice(d.Messages, func(i, j int) bool {
-		return d.Messages[i].Time.Before(d.Messages[j].Time)
+	d.sortMessages()
+	if last := d.lastMessage(); last != nil {
+		for _, m := range messages {
+			if m.ID == last.ID {
+				d.LastExcerpt = limitLength(m.Excerpt, maxExcerptLen)
+			}
+		}
+	}
+	return diff
+}
+
+// sortMessages orders messages by the time we received them and drops the oldest ones if needed.
+func (d *Discussion) sortMessages() {
+	sort.SliceStable(d.Messages, func(i, j int) bool {
+		a, b := &d.Messages[i], &d.Messages[j]
+		if ta, tb := a.orderTime(), b.orderTime(); !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+		return a.Time.Before(b.Time)
 	})
 	if len(d.Messages) > maxMessagesInDiscussion {
 		d.Messages = d.Messages[len(d.Messages)-maxMessagesInDiscussion:]
 	}
-	return diff
+}
+
+// lastMessage returns the most recent message that was not generated by an auto-responder.
+func (d *Discussion) lastMessage() *DiscussionMessage {
+	for i := len(d.Messages) - 1; i >= 0; i-- {
+		if !d.Messages[i].AutoReply {
+			return &d.Messages[i]
+		}
+	}
+	return nil
+}
+
+// authorIdentity returns the domain and a short hash of the sender address.
+func authorIdentity(addr string) (string, string) {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	if addr == "" {
+		return "", ""
+	}
+	domain := ""
+	if pos := strings.LastIndexByte(addr, '@'); pos >= 0 {
+		domain = addr[pos+1:]
+	}
+	return domain, hash.String([]byte(addr))[:16]
+}
+
+const maxExcerptLen = 1000
+
+// discussionExcerpt extracts the new text from an email body by dropping the quoted parts.
+func discussionExcerpt(body string) string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") || strings.HasSuffix(trimmed, "wrote:") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, "\r"))
+	}
+	return limitLength(strings.Join(lines, "\n"), maxExcerptLen)
+}
+
+var reproRequestRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(do|does|did|can|could|would)\s+(you|syzbot|anyone|someone)\b[^?\n]*\brepro(ducer)?s?\b`),
+	regexp.MustCompile(`(?i)\bis\s+there\s+(a|any)\s+repro(ducer)?\b`),
+	regexp.MustCompile(`(?i)\bany\s+repro(ducer)?s?\b[^\n]*\?`),
+	regexp.MustCompile(`(?i)\bis\s+(this|it)\s+reproducible\b`),
+}
+
+// isReproRequest checks whether the message text (w/o quoted parts) asks for a reproducer.
+func isReproRequest(excerpt string) bool {
+	for _, re := range reproRequestRes {
+		if re.MatchString(excerpt) {
+			return true
+		}
+	}
+	return false
 }
 
 func (d *Discussion) messageIDs() map[string]struct{} {
@@ -196,11 +804,52 @@ func (d *Discussion) messageIDs() map[string]struct{} {
 }
 
 func (d *Discussion) link() string {
-	switch dashapi.DiscussionSource(d.Source) {
-	case dashapi.DiscussionLore:
-		return fmt.Sprintf("https://lore.kernel.org/all/%s/T/", strings.Trim(d.ID, "<>"))
+	impl := discussionSources[dashapi.DiscussionSource(d.Source)]
+	if impl == nil {
+		return ""
 	}
-	return ""
+	return impl.Link(d.ID)
+}
+
+// DiscussionSourceImpl encapsulates everything that's specific to a particular discussion source.
+type DiscussionSourceImpl interface {
+	// Link returns a URL to the discussion with the specified ID.
+	Link(id string) string
+	// NormalizeID returns the canonical form of a discussion/message ID.
+	// All IDs are normalized before they are stored or looked up in the DB.
+	NormalizeID(id string) string
+	// ValidateConfig verifies the DiscussionEmails entry that refers to the source.
+	ValidateConfig(cfg *DiscussionEmailConfig) error
+}
+
+// discussionSources contains all supported discussion sources.
+// Tests may add their own sources before installing the config.
+var discussionSources = map[dashapi.DiscussionSource]DiscussionSourceImpl{
+	dashapi.DiscussionLore:      loreDiscussionSource{},
+	dashapi.DiscussionPatchwork: patchworkDiscussionSource{},
+}
+
+type loreDiscussionSource struct{}
+
+func (loreDiscussionSource) Link(id string) string {
+	return fmt.Sprintf("https://lore.kernel.org/all/%s/T/", strings.Trim(id, "<>"))
+}
+
+func (loreDiscussionSource) NormalizeID(id string) string {
+	// Lore threads are identified by Message-ID's, which may or may not
+	// come surrounded by angle brackets.
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return ""
+	}
+	return "<" + strings.Trim(id, "<>") + ">"
+}
+
+func (loreDiscussionSource) ValidateConfig(cfg *DiscussionEmailConfig) error {
+	if _, err := mail.ParseAddress(cfg.ReceiveAddress); err != nil {
+		return fmt.Errorf("bad ReceiveAddress %q: %w", cfg.ReceiveAddress, err)
+	}
+	return nil
 }
 
 func discussionByMessageID(c context.Context, source dashapi.DiscussionSource,
@@ -222,6 +871,26 @@ func discussionByMessageID(c context.Context, source dashapi.DiscussionSource,
 	return discussions[0], nil
 }
 
+// Only that many closest parents of a message are looked up.
+const maxDiscussionParents = 10
+
+// discussionByParents returns the discussion of the closest known parent message.
+// The closest parents may be unknown e.g. if they are forwarded copies of our messages.
+func discussionByParents(c context.Context, source dashapi.DiscussionSource,
+	parentIDs []string) (*Discussion, error) {
+	impl := discussionSources[source]
+	if len(parentIDs) > maxDiscussionParents {
+		parentIDs = parentIDs[:maxDiscussionParents]
+	}
+	for _, id := range parentIDs {
+		d, err := discussionByMessageID(c, source, impl.NormalizeID(id))
+		if err != db.ErrNoSuchEntity {
+			return d, err
+		}
+	}
+	return nil, db.ErrNoSuchEntity
+}
+
 func discussionsForBug(c context.Context, bugKey *db.Key) ([]*Discussion, error) {
 	var discussions []*Discussion
 	_, err := db.NewQuery("Discussion").
@@ -233,18 +902,90 @@ func discussionsForBug(c context.Context, bugKey *db.Key) ([]*Discussion, error)
 	return discussions, nil
 }
 
-func getBugKeys(c context.Context, bugIDs []string) ([]string, error) {
+func getBugKeys(c context.Context, ns string, bugIDs []string) ([]string, error) {
 	keys := []string{}
 	for _, id := range bugIDs {
-		_, bugKey, err := findBugByReportingID(c, id)
+		bug, bugKey, err := findBugByReportingID(c, id)
 		if err != nil {
 			return nil, fmt.Errorf("failed to find bug for %s: %w", id, err)
 		}
+		if ns != "" && bug.Namespace != ns {
+			// Don't reveal the existence of the bugs in other namespaces.
+			return nil, fmt.Errorf("failed to find bug for %s", id)
+		}
 		keys = append(keys, bugKey.StringID())
 	}
 	return keys, nil
 }
 
+// Once a bug is attached to a discussion for a stronger reason, weaker reasons don't matter anymore.
+var attachmentStrength = map[dashapi.AttachmentReason]int{
+	dashapi.AttachUnknown:    0,
+	dashapi.AttachTitle:      1,
+	dashapi.AttachAPI:        2,
+	dashapi.AttachBody:       3,
+	dashapi.AttachReportedBy: 4,
+	dashapi.AttachAddress:    5,
+}
+
+// attachBug attaches the discussion to the bug or upgrades the reason of an existing attachment.
+func (d *Discussion) attachBug(key string, reason dashapi.AttachmentReason) {
+	for len(d.BugReasons) < len(d.BugKeys) {
+		d.BugReasons = append(d.BugReasons, string(dashapi.AttachUnknown))
+	}
+	for i, existing := range d.BugKeys {
+		if existing != key {
+			continue
+		}
+		if attachmentStrength[reason] > attachmentStrength[dashapi.AttachmentReason(d.BugReasons[i])] {
+			d.BugReasons[i] = string(reason)
+		}
+		return
+	}
+	d.BugKeys = append(d.BugKeys, key)
+	d.BugReasons = append(d.BugReasons, string(reason))
+}
+
+func (d *Discussion) attachmentReason(key string) dashapi.AttachmentReason {
+	for i, existing := range d.BugKeys {
+		if existing == key && i < len(d.BugReasons) {
+			return dashapi.AttachmentReason(d.BugReasons[i])
+		}
+	}
+	return dashapi.AttachUnknown
+}
+
+// moveBug replaces the bug key, the attachment reason is preserved.
+func (d *Discussion) moveBug(oldKey, newKey string) {
+	keys := d.BugKeys
+	reasons := make([]dashapi.AttachmentReason, len(keys))
+	for i, key := range keys {
+		reasons[i] = d.attachmentReason(key)
+	}
+	d.BugKeys, d.BugReasons = nil, nil
+	for i, key := range keys {
+		if key == oldKey {
+			key = newKey
+		}
+		d.attachBug(key, reasons[i])
+	}
+}
+
+// detachBug removes the bug key together with its attachment reason.
+func (d *Discussion) detachBug(key string) {
+	keys := d.BugKeys
+	reasons := make([]dashapi.AttachmentReason, len(keys))
+	for i, key := range keys {
+		reasons[i] = d.attachmentReason(key)
+	}
+	d.BugKeys, d.BugReasons = nil, nil
+	for i, existing := range keys {
+		if existing != key {
+			d.attachBug(existing, reasons[i])
+		}
+	}
+}
+
 func unique(items []string) []string {
 	dup := map[string]struct{}{}
 	ret := []string{}
@@ -257,3 +998,79 @@ func unique(items []string) []string {
 	}
 	return ret
 }
+
+// The lookup queries the similar bugs and all their discussions. Reporting repeats it
+// for every pending report on each poll, and the bug page on every view, so the results
+// are cached in memcache. Upstream discussions are informational, a few minutes of delay are fine.
+const upstreamDiscussionCacheTTL = 10 * time.Minute
+
+type upstreamDiscussionCacheEntry struct {
+	Discussion *dashapi.UpstreamDiscussion
+}
+
+func upstreamDiscussionCacheKey(bug *Bug, accessLevel AccessLevel) string {
+	return fmt.Sprintf("upstream-discussion-%v-%v", bug.keyHash(), accessLevel)
+}
+
+// upstreamDiscussion returns the most recent discussion of the upstream counterpart of the bug
+// (a similar bug from Config.UpstreamNamespace) that is visible at the given access level.
+// The result is cached in memcache for upstreamDiscussionCacheTTL.
+func upstreamDiscussion(c context.Context, bug *Bug, accessLevel AccessLevel) (
+	*dashapi.UpstreamDiscussion, error) {
+	ns := config.Namespaces[bug.Namespace].UpstreamNamespace
+	if ns == "" {
+		return nil, nil
+	}
+	cacheKey := upstreamDiscussionCacheKey(bug, accessLevel)
+	entry := new(upstreamDiscussionCacheEntry)
+	if _, err := memcache.Gob.Get(c, cacheKey, entry); err == nil {
+		return entry.Discussion, nil
+	} else if err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to get upstream discussion from memcache: %v", err)
+	}
+	ret, err := loadUpstreamDiscussion(c, bug, ns, accessLevel)
+	if err != nil {
+		return nil, err
+	}
+	item := &memcache.Item{
+		Key:        cacheKey,
+		Object:     &upstreamDiscussionCacheEntry{Discussion: ret},
+		Expiration: upstreamDiscussionCacheTTL,
+	}
+	if err := memcache.Gob.Set(c, item); err != nil {
+		log.Errorf(c, "failed to cache upstream discussion: %v", err)
+	}
+	return ret, nil
+}
+
+func loadUpstreamDiscussion(c context.Context, bug *Bug, ns string, accessLevel AccessLevel) (
+	*dashapi.UpstreamDiscussion, error) {
+	similar, err := loadSimilarBugs(c, bug)
+	if err != nil {
+		return nil, err
+	}
+	var ret *dashapi.UpstreamDiscussion
+	for _, upstream := range similar {
+		if upstream.Namespace != ns ||
+			upstream.LastDiscussionActivity.IsZero() ||
+			accessLevel < upstream.sanitizeAccess(accessLevel) {
+			continue
+		}
+		discussions, err := discussionsForBug(c, upstream.key(c))
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range discussions {
+			last := d.lastActivity()
+			if d.Summary.AllMessages == 0 || ret != nil && !ret.LastActivity.Before(last) {
+				continue
+			}
+			ret = &dashapi.UpstreamDiscussion{
+				Link:         d.link(),
+				Messages:     d.Summary.AllMessages,
+				LastActivity: last,
+			}
+		}
+	}
+	return ret, nil
+}
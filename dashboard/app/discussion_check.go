@@ -0,0 +1,305 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Discussion entities and Bug.DiscussionInfo are updated in separate transactions,
+// so they may diverge. The code below periodically verifies a sample of bugs.
+
+func handleCheckDiscussions(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	cfg := config.DiscussionCheck
+	sampleSize := cfg.SampleSize
+	if sampleSize == 0 {
+		sampleSize = 100
+	}
+	if err := checkDiscussionSummaries(c, sampleSize, cfg.AutoHealThreshold); err != nil {
+		log.Errorf(c, "discussion consistency check failed: %v", err)
+	}
+}
+
+// checkDiscussionSummaries recomputes discussion summaries of the next sampleSize bugs.
+// Each run continues from where the previous one stopped, so all bugs get eventually checked.
+func checkDiscussionSummaries(c context.Context, sampleSize, healThreshold int) error {
+	keys, err := nextDiscussionCheckSample(c, sampleSize)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := checkBugDiscussionSummary(c, key, healThreshold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextDiscussionCheckSample returns up to sampleSize keys of bugs with discussions starting
+// from the saved cursor. Once the end is reached, it wraps around to the beginning.
+func nextDiscussionCheckSample(c context.Context, sampleSize int) ([]*db.Key, error) {
+	state := new(DiscussionCheckState)
+	if err := db.Get(c, discussionCheckStateKey(c), state); err != nil && err != db.ErrNoSuchEntity {
+		return nil, fmt.Errorf("failed to get the check state: %w", err)
+	}
+	var keys []*db.Key
+	seen := map[string]bool{}
+	cursor := state.Cursor
+	for {
+		limit := sampleSize - len(keys)
+		query := db.NewQuery("Bug").
+			Filter("LastDiscussionActivity>", time.Time{}).
+			KeysOnly().
+			Limit(limit)
+		wrapped := cursor == ""
+		if !wrapped {
+			start, err := db.DecodeCursor(cursor)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode cursor: %w", err)
+			}
+			query = query.Start(start)
+		}
+		iter := query.Run(c)
+		count := 0
+		for {
+			key, err := iter.Next(nil)
+			if err == db.Done {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to query bugs: %w", err)
+			}
+			count++
+			if !seen[key.StringID()] {
+				seen[key.StringID()] = true
+				keys = append(keys, key)
+			}
+		}
+		if count == limit {
+			next, err := iter.Cursor()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get cursor: %w", err)
+			}
+			cursor = next.String()
+			break
+		}
+		// We've reached the end, the next query starts from the beginning.
+		cursor = ""
+		if wrapped {
+			break
+		}
+	}
+	state.Cursor = cursor
+	if _, err := db.Put(c, discussionCheckStateKey(c), state); err != nil {
+		return nil, fmt.Errorf("failed to save the check state: %w", err)
+	}
+	return keys, nil
+}
+
+// computeDiscussionSummaries aggregates per-source summaries from the bug discussions.
+// Each discussion is counted in full, as mergeNamespaceDiscussion does for the bugs attached later.
+func computeDiscussionSummaries(c context.Context, bugKey *db.Key) (map[string]DiscussionSummary, error) {
+	discussions, err := discussionsForBug(c, bugKey)
+	if err != nil {
+		return nil, err
+	}
+	computed := map[string]DiscussionSummary{}
+	for _, d := range discussions {
+		summary := computed[d.Source]
+		summary.merge(d.Summary)
+		computed[d.Source] = summary
+	}
+	return computed, nil
+}
+
+// refreshBugDiscussionInfo unconditionally replaces Bug.DiscussionInfo with the recomputed summaries.
+func refreshBugDiscussionInfo(c context.Context, bugKey *db.Key) error {
+	// Otherwise the pending deltas would be applied once again on top of the recomputed values.
+	if err := foldBugSummaryDeltas(c, bugKey.StringID()); err != nil {
+		return err
+	}
+	computed, err := computeDiscussionSummaries(c, bugKey)
+	if err != nil {
+		return err
+	}
+	ns := ""
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		ns = bug.Namespace
+		bug.setDiscussionInfo(computed)
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	invalidateBugLists(c, ns)
+	return deleteResolvedMismatches(c, bugKey.StringID(), nil)
+}
+
+func (bug *Bug) setDiscussionInfo(summaries map[string]DiscussionSummary) {
+	bug.DiscussionInfo = nil
+	for source, summary := range summaries {
+		bug.DiscussionInfo = append(bug.DiscussionInfo, BugDiscussionInfo{
+			Source:  source,
+			Summary: summary,
+		})
+	}
+	sort.Slice(bug.DiscussionInfo, func(i, j int) bool {
+		return bug.DiscussionInfo[i].Source < bug.DiscussionInfo[j].Source
+	})
+	bug.updateDiscussionActivity()
+}
+
+func checkBugDiscussionSummary(c context.Context, bugKey *db.Key, healThreshold int) error {
+	if err := foldBugSummaryDeltas(c, bugKey.StringID()); err != nil {
+		return err
+	}
+	computed, err := computeDiscussionSummaries(c, bugKey)
+	if err != nil {
+		return err
+	}
+	var mismatches []*DiscussionMismatch
+	healedNs := ""
+	tx := func(c context.Context) error {
+		mismatches, healedNs = nil, ""
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		stored := map[string]DiscussionSummary{}
+		for _, item := range bug.DiscussionInfo {
+			stored[item.Source] = item.Summary
+		}
+		healed := false
+		for source := range mergeSourceSets(stored, computed) {
+			if stored[source].equal(computed[source]) {
+				continue
+			}
+			log.Errorf(c, "discussion summary mismatch: bug=%v source=%v stored=%+v computed=%+v",
+				bugKey.StringID(), source, stored[source], computed[source])
+			if !stored[source].canHeal(computed[source], healThreshold) {
+				mismatches = append(mismatches, &DiscussionMismatch{
+					BugKey:   bugKey.StringID(),
+					Source:   source,
+					Stored:   stored[source],
+					Computed: computed[source],
+					Time:     timeNow(c),
+				})
+				continue
+			}
+			healed = true
+			stored[source] = computed[source]
+		}
+		if !healed {
+			return nil
+		}
+		bug.setDiscussionInfo(stored)
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		healedNs = bug.Namespace
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	if healedNs != "" {
+		invalidateBugLists(c, healedNs)
+	}
+	for _, m := range mismatches {
+		if _, err := db.Put(c, discussionMismatchKey(c, m.BugKey, m.Source), m); err != nil {
+			return fmt.Errorf("failed to save the mismatch: %w", err)
+		}
+	}
+	return deleteResolvedMismatches(c, bugKey.StringID(), mismatches)
+}
+
+// deleteResolvedMismatches deletes the bug's mismatch records except the still present ones.
+func deleteResolvedMismatches(c context.Context, bugKey string, present []*DiscussionMismatch) error {
+	keys, err := db.NewQuery("DiscussionMismatch").
+		Filter("BugKey=", bugKey).
+		KeysOnly().
+		GetAll(c, nil)
+	if err != nil {
+		return fmt.Errorf("failed to query mismatches: %w", err)
+	}
+	keep := map[string]bool{}
+	for _, m := range present {
+		keep[discussionMismatchKey(c, m.BugKey, m.Source).StringID()] = true
+	}
+	var resolved []*db.Key
+	for _, key := range keys {
+		if !keep[key.StringID()] {
+			resolved = append(resolved, key)
+		}
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+	if err := db.DeleteMulti(c, resolved); err != nil {
+		return fmt.Errorf("failed to delete resolved mismatches: %w", err)
+	}
+	return nil
+}
+
+func mergeSourceSets(a, b map[string]DiscussionSummary) map[string]struct{} {
+	ret := map[string]struct{}{}
+	for source := range a {
+		ret[source] = struct{}{}
+	}
+	for source := range b {
+		ret[source] = struct{}{}
+	}
+	return ret
+}
+
+func (ds DiscussionSummary) equal(other DiscussionSummary) bool {
+	return ds.AllMessages == other.AllMessages &&
+		ds.ExternalMessages == other.ExternalMessages &&
+		ds.LastMessage.Equal(other.LastMessage) &&
+		ds.LastPatchMessage.Equal(other.LastPatchMessage) &&
+		ds.LastVerdict == other.LastVerdict &&
+		ds.LastVerdictTime.Equal(other.LastVerdictTime) &&
+		ds.LastPatchAccepted.Equal(other.LastPatchAccepted)
+}
+
+// canHeal returns true if the counters differ less than threshold.
+func (ds DiscussionSummary) canHeal(other DiscussionSummary, threshold int) bool {
+	abs := func(v int) int {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	return abs(ds.AllMessages-other.AllMessages) < threshold &&
+		abs(ds.ExternalMessages-other.ExternalMessages) < threshold
+}
+
+// loadDiscussionMismatches returns the recently detected and not yet resolved mismatches.
+func loadDiscussionMismatches(c context.Context) ([]*DiscussionMismatch, error) {
+	var mismatches []*DiscussionMismatch
+	_, err := db.NewQuery("DiscussionMismatch").
+		Order("-Time").
+		Limit(50).
+		GetAll(c, &mismatches)
+	if err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+// Some bugs are CCed so often that concurrent discussion summary updates exhaust
+// the transaction retries on the Bug entity. Once such a contention is observed,
+// the updates of the bug are saved as PendingSummaryDelta entities for a while
+// and are folded into the bug by a cron job.
+
+const (
+	// How long a bug stays in the deferred mode after a contention.
+	discussionContentionPeriod = 10 * time.Minute
+	// A contended transaction fails quickly, there's a fallback anyway.
+	syncSummaryAttempts = 3
+	// Every delta is a separate entity group and XG transactions may span only 25 groups.
+	deltasPerFold = 20
+	// The cron runs every minute.
+	foldSummaryDeltasBudget = 45 * time.Second
+)
+
+// updateBugDiscussionSummary merges the diff into the bug summary either right away
+// or, if the bug is contended, via a PendingSummaryDelta.
+func updateBugDiscussionSummary(c context.Context, key, source string, diff DiscussionSummary) error {
+	if !discussionContention(c, key) {
+		ns := ""
+		err := db.RunInTransaction(c, func(c context.Context) error {
+			var err error
+			ns, err = mergeDiscussionSummary(c, key, source, diff)
+			return err
+		}, &db.TransactionOptions{Attempts: syncSummaryAttempts})
+		if err == nil {
+			invalidateBugLists(c, ns)
+			return nil
+		}
+		if !errors.Is(err, db.ErrConcurrentTransaction) {
+			return err
+		}
+		log.Warningf(c, "bug %v is contended, deferring its discussion summary updates", key)
+		markDiscussionContention(c, key)
+	}
+	delta := &PendingSummaryDelta{
+		Bug:     key,
+		Source:  source,
+		Delta:   diff,
+		Created: timeNow(c),
+	}
+	if _, err := db.Put(c, db.NewIncompleteKey(c, "PendingSummaryDelta", nil), delta); err != nil {
+		return fmt.Errorf("failed to save PendingSummaryDelta: %w", err)
+	}
+	return nil
+}
+
+func discussionContentionKey(bugKey string) string {
+	return "discussion-contention-" + bugKey
+}
+
+func discussionContention(c context.Context, bugKey string) bool {
+	_, err := memcache.Get(c, discussionContentionKey(bugKey))
+	if err != nil && err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to query memcache: %v", err)
+	}
+	return err == nil
+}
+
+func markDiscussionContention(c context.Context, bugKey string) {
+	item := &memcache.Item{
+		Key:        discussionContentionKey(bugKey),
+		Value:      []byte{1},
+		Expiration: discussionContentionPeriod,
+	}
+	if err := memcache.Set(c, item); err != nil {
+		log.Errorf(c, "failed to update memcache: %v", err)
+	}
+}
+
+func handleFoldSummaryDeltas(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	folded, err := foldPendingSummaryDeltas(c, foldSummaryDeltasBudget)
+	if err != nil {
+		log.Errorf(c, "failed to fold summary deltas: %v", err)
+	}
+	if folded != 0 {
+		log.Infof(c, "folded %v summary deltas", folded)
+	}
+}
+
+// foldPendingSummaryDeltas applies the oldest deltas to their bugs until there are none left
+// or the budget is exhausted. It returns the number of applied deltas.
+// A bug whose deltas cannot be folded is skipped, so that it does not block the others.
+func foldPendingSummaryDeltas(c context.Context, budget time.Duration) (int, error) {
+	deadline := timeNow(c).Add(budget)
+	folded := 0
+	var cursor *db.Cursor
+	for timeNow(c).Before(deadline) {
+		query := db.NewQuery("PendingSummaryDelta").
+			Order("Created").
+			Limit(500)
+		if cursor != nil {
+			query = query.Start(*cursor)
+		}
+		var keys []*db.Key
+		var deltas []*PendingSummaryDelta
+		iter := query.Run(c)
+		for {
+			delta := new(PendingSummaryDelta)
+			key, err := iter.Next(delta)
+			if err == db.Done {
+				break
+			}
+			if err != nil {
+				return folded, fmt.Errorf("failed to query deltas: %w", err)
+			}
+			keys = append(keys, key)
+			deltas = append(deltas, delta)
+		}
+		if len(keys) == 0 {
+			break
+		}
+		next, err := iter.Cursor()
+		if err != nil {
+			return folded, fmt.Errorf("failed to get cursor: %w", err)
+		}
+		cursor = &next
+		var bugs []string
+		perBug := map[string][]*db.Key{}
+		for i, delta := range deltas {
+			if perBug[delta.Bug] == nil {
+				bugs = append(bugs, delta.Bug)
+			}
+			perBug[delta.Bug] = append(perBug[delta.Bug], keys[i])
+		}
+		for _, bug := range bugs {
+			n, err := foldSummaryDeltas(c, bug, perBug[bug])
+			folded += n
+			if err != nil {
+				log.Errorf(c, "failed to fold summary deltas of bug %v: %v", bug, err)
+			}
+		}
+	}
+	return folded, nil
+}
+
+// foldBugSummaryDeltas applies all pending deltas of the bug.
+func foldBugSummaryDeltas(c context.Context, bugKey string) error {
+	keys, err := db.NewQuery("PendingSummaryDelta").
+		Filter("Bug=", bugKey).
+		KeysOnly().
+		GetAll(c, nil)
+	if err != nil {
+		return fmt.Errorf("failed to query deltas: %w", err)
+	}
+	_, err = foldSummaryDeltas(c, bugKey, keys)
+	return err
+}
+
+// foldSummaryDeltas applies the deltas to the bug and returns the number of applied ones.
+// The deltas of a deleted bug are deleted as well.
+func foldSummaryDeltas(c context.Context, bugKey string, keys []*db.Key) (int, error) {
+	folded := 0
+	for len(keys) != 0 {
+		batch := keys
+		if len(batch) > deltasPerFold {
+			batch = batch[:deltasPerFold]
+		}
+		keys = keys[len(batch):]
+		applied, ns := 0, ""
+		tx := func(c context.Context) error {
+			applied = 0
+			deltas := make([]*PendingSummaryDelta, len(batch))
+			missing := make([]bool, len(batch))
+			if err := db.GetMulti(c, batch, deltas); err != nil {
+				var merr appengine.MultiError
+				if !errors.As(err, &merr) {
+					return fmt.Errorf("failed to get deltas: %w", err)
+				}
+				for i, err := range merr {
+					if err == db.ErrNoSuchEntity {
+						// The delta has just been folded by a concurrent request.
+						missing[i] = true
+					} else if err != nil {
+						return fmt.Errorf("failed to get deltas: %w", err)
+					}
+				}
+			}
+			var existing []*db.Key
+			for i := range deltas {
+				if !missing[i] {
+					existing = append(existing, batch[i])
+				}
+			}
+			bug := new(Bug)
+			if err := db.Get(c, db.NewKey(c, "Bug", bugKey, 0, nil), bug); err != nil {
+				if err == db.ErrNoSuchEntity {
+					// There's nothing to apply the deltas to.
+					return db.DeleteMulti(c, existing)
+				}
+				return fmt.Errorf("failed to get bug: %w", err)
+			}
+			for i, delta := range deltas {
+				if !missing[i] {
+					bug.mergeDiscussionSummary(delta.Source, delta.Delta)
+				}
+			}
+			if _, err := db.Put(c, bug.key(c), bug); err != nil {
+				return fmt.Errorf("failed to put bug: %w", err)
+			}
+			applied, ns = len(existing), bug.Namespace
+			return db.DeleteMulti(c, existing)
+		}
+		if err := db.RunInTransaction(c, tx, &db.TransactionOptions{XG: true, Attempts: 15}); err != nil {
+			return folded, err
+		}
+		if applied != 0 {
+			invalidateBugLists(c, ns)
+		}
+		folded += applied
+	}
+	return folded, nil
+}
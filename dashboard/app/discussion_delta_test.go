@@ -0,0 +1,131 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/sync/errgroup"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+func TestDiscussionSummaryDeltas(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+	_, bugKey, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+
+	expectPending := func(want int) {
+		t.Helper()
+		count, err := db.NewQuery("PendingSummaryDelta").Count(c.ctx)
+		c.expectOK(err)
+		c.expectEQ(count, want)
+	}
+	expectMessages := func(want int) {
+		t.Helper()
+		bug := new(Bug)
+		c.expectOK(db.Get(c.ctx, bugKey, bug))
+		summary := bug.discussionSummary()
+		c.expectEQ(summary.AllMessages, want)
+		c.expectEQ(summary.ExternalMessages, want)
+	}
+
+	// A burst of updates of a hot bug.
+	markDiscussionContention(c.ctx, bugKey.StringID())
+	const updates = 100
+	var eg errgroup.Group
+	eg.SetLimit(10)
+	for i := 0; i < updates; i++ {
+		id := fmt.Sprintf("<burst-%v@kernel.org>", i)
+		eg.Go(func() error {
+			return mergeDiscussion(c.ctx, &dashapi.Discussion{
+				ID:      id,
+				Source:  dashapi.DiscussionLore,
+				Type:    dashapi.DiscussionReport,
+				Subject: "Re: the bug",
+				BugIDs:  []string{extBugID},
+				Messages: []dashapi.DiscussionMessage{
+					{ID: id, External: true, Time: timeNow(c.ctx)},
+				},
+			})
+		})
+	}
+	c.expectOK(eg.Wait())
+	expectPending(updates)
+	expectMessages(0)
+
+	_, err = c.GET("/cron/fold_summary_deltas")
+	c.expectOK(err)
+	expectPending(0)
+	expectMessages(updates)
+
+	// Once the contention period is over, updates are applied right away.
+	c.expectOK(memcache.Delete(c.ctx, discussionContentionKey(bugKey.StringID())))
+	c.advanceTime(time.Minute)
+	c.expectOK(mergeDiscussion(c.ctx, &dashapi.Discussion{
+		ID:      "<sync@kernel.org>",
+		Source:  dashapi.DiscussionLore,
+		Type:    dashapi.DiscussionReport,
+		Subject: "Re: the bug",
+		BugIDs:  []string{extBugID},
+		Messages: []dashapi.DiscussionMessage{
+			{ID: "<sync@kernel.org>", External: true, Time: timeNow(c.ctx)},
+		},
+	}))
+	expectPending(0)
+	expectMessages(updates + 1)
+
+	// The summary recomputation takes the pending deltas into account.
+	markDiscussionContention(c.ctx, bugKey.StringID())
+	c.expectOK(mergeDiscussion(c.ctx, &dashapi.Discussion{
+		ID:     "<sync@kernel.org>",
+		Source: dashapi.DiscussionLore,
+		BugIDs: []string{extBugID},
+		Messages: []dashapi.DiscussionMessage{
+			{ID: "<sync-reply@kernel.org>", External: true, Time: timeNow(c.ctx)},
+		},
+	}))
+	expectPending(1)
+	c.expectOK(refreshBugDiscussionInfo(c.ctx, bugKey))
+	expectPending(0)
+	expectMessages(updates + 2)
+
+	// Only the deltas that still exist are counted as folded.
+	putDelta := func(bug string) *db.Key {
+		t.Helper()
+		key, err := db.Put(c.ctx, db.NewIncompleteKey(c.ctx, "PendingSummaryDelta", nil), &PendingSummaryDelta{
+			Bug:     bug,
+			Source:  string(dashapi.DiscussionLore),
+			Delta:   DiscussionSummary{AllMessages: 1, ExternalMessages: 1},
+			Created: timeNow(c.ctx),
+		})
+		c.expectOK(err)
+		return key
+	}
+	gone := putDelta(bugKey.StringID())
+	c.expectOK(db.Delete(c.ctx, gone))
+	folded, err := foldSummaryDeltas(c.ctx, bugKey.StringID(), []*db.Key{gone, putDelta(bugKey.StringID())})
+	c.expectOK(err)
+	c.expectEQ(folded, 1)
+	expectMessages(updates + 3)
+
+	// The deltas of deleted bugs are dropped and do not block the others.
+	putDelta("deleted-bug")
+	putDelta(bugKey.StringID())
+	folded, err = foldPendingSummaryDeltas(c.ctx, time.Minute)
+	c.expectOK(err)
+	c.expectEQ(folded, 1)
+	expectPending(0)
+	expectMessages(updates + 4)
+}
@@ -0,0 +1,249 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Discussion exports are meant for researchers, so they contain no addresses and no message texts.
+
+const (
+	// Text entities must belong to a namespace, but exports span all of them.
+	discussionExportNamespace = "discussion-export"
+	discussionExportChunkSize = 200
+	// Keep chunks well below the putText limit, otherwise their tails would be cut.
+	discussionExportMaxChunkBytes = 4 << 20
+	discussionExportTimeBudget    = 5 * time.Minute
+)
+
+type exportedDiscussion struct {
+	ID       string            `json:"id"`
+	Source   string            `json:"source"`
+	Type     string            `json:"type"`
+	Subject  string            `json:"subject"`
+	Bugs     []string          `json:"bugs"`
+	Messages []exportedMessage `json:"messages"`
+}
+
+type exportedMessage struct {
+	Time         time.Time `json:"time"`
+	External     bool      `json:"external"`
+	AutoReply    bool      `json:"auto_reply,omitempty"`
+	AuthorDomain string    `json:"author_domain,omitempty"`
+	Author       string    `json:"author,omitempty"`
+}
+
+// startDiscussionExport creates a new export manifest that is then processed by the cron job.
+func startDiscussionExport(c context.Context) error {
+	last, _, err := lastDiscussionExport(c)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.Finished.IsZero() {
+		return fmt.Errorf("a discussion export is already in progress since %v", last.Started)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	export := &DiscussionExport{
+		Started: timeNow(c),
+		Salt:    hex.EncodeToString(salt),
+	}
+	if _, err := db.Put(c, db.NewIncompleteKey(c, "DiscussionExport", nil), export); err != nil {
+		return fmt.Errorf("failed to save the export: %w", err)
+	}
+	return nil
+}
+
+func lastDiscussionExport(c context.Context) (*DiscussionExport, *db.Key, error) {
+	var exports []*DiscussionExport
+	keys, err := db.NewQuery("DiscussionExport").
+		Order("-Started").
+		Limit(1).
+		GetAll(c, &exports)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query exports: %w", err)
+	}
+	if len(exports) == 0 {
+		return nil, nil, nil
+	}
+	return exports[0], keys[0], nil
+}
+
+func handleExportDiscussions(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for start := timeNow(c); timeNow(c).Sub(start) < discussionExportTimeBudget; {
+		more, err := exportDiscussionsChunk(c, discussionExportChunkSize)
+		if err != nil {
+			log.Errorf(c, "discussion export failed: %v", err)
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// exportDiscussionsChunk continues the unfinished export (if any) from its cursor.
+// It returns whether there is more work to do.
+func exportDiscussionsChunk(c context.Context, chunkSize int) (bool, error) {
+	export, key, err := lastDiscussionExport(c)
+	if err != nil || export == nil || !export.Finished.IsZero() {
+		return false, err
+	}
+	query := db.NewQuery("Discussion").Limit(chunkSize)
+	if export.Cursor != "" {
+		cursor, err := db.DecodeCursor(export.Cursor)
+		if err != nil {
+			return false, fmt.Errorf("failed to decode cursor: %w", err)
+		}
+		query = query.Start(cursor)
+	}
+	buf := new(bytes.Buffer)
+	count := 0
+	iter := query.Run(c)
+	for buf.Len() < discussionExportMaxChunkBytes {
+		d := new(Discussion)
+		_, err := iter.Next(d)
+		if err == db.Done {
+			break
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch discussions: %w", err)
+		}
+		data, err := json.Marshal(makeExportedDiscussion(d, export.Salt))
+		if err != nil {
+			return false, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+		count++
+	}
+	cursor, err := iter.Cursor()
+	if err != nil {
+		return false, fmt.Errorf("failed to get cursor: %w", err)
+	}
+	var chunkID int64
+	if buf.Len() != 0 {
+		chunkID, err = putText(c, discussionExportNamespace, textDiscussionExport, buf.Bytes(), false)
+		if err != nil {
+			return false, fmt.Errorf("failed to save the chunk: %w", err)
+		}
+	}
+	prevCursor := export.Cursor
+	tx := func(c context.Context) error {
+		if err := db.Get(c, key, export); err != nil {
+			return fmt.Errorf("failed to get the export: %w", err)
+		}
+		if export.Cursor != prevCursor {
+			return fmt.Errorf("the export was advanced concurrently")
+		}
+		if chunkID != 0 {
+			export.Chunks = append(export.Chunks, chunkID)
+		}
+		export.Discussions += count
+		export.Cursor = cursor.String()
+		if count < chunkSize && buf.Len() < discussionExportMaxChunkBytes {
+			export.Finished = timeNow(c)
+		}
+		_, err := db.Put(c, key, export)
+		return err
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return false, err
+	}
+	return export.Finished.IsZero(), nil
+}
+
+func makeExportedDiscussion(d *Discussion, salt string) *exportedDiscussion {
+	ret := &exportedDiscussion{
+		ID:      d.ID,
+		Source:  d.Source,
+		Type:    d.Type,
+		Subject: d.Subject,
+		Bugs:    d.BugKeys,
+	}
+	for _, m := range d.Messages {
+		msg := exportedMessage{
+			Time:         m.Time,
+			External:     m.External,
+			AutoReply:    m.AutoReply,
+			AuthorDomain: m.AuthorDomain,
+		}
+		if m.AuthorHash != "" {
+			// Stored hashes are not salted, so they could be matched against known addresses.
+			msg.Author = hash.String([]byte(salt), []byte(m.AuthorHash))[:16]
+		}
+		ret.Messages = append(ret.Messages, msg)
+	}
+	return ret
+}
+
+// handleDiscussionExport serves the concatenated chunks of a finished export.
+func handleDiscussionExport(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if accessLevel(c, r) != AccessAdmin {
+		return ErrAccess
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		return fmt.Errorf("failed to parse export id: %v: %w", err, ErrClientBadRequest)
+	}
+	export := new(DiscussionExport)
+	if err := db.Get(c, db.NewKey(c, "DiscussionExport", "", id, nil), export); err != nil {
+		return fmt.Errorf("failed to get the export: %w", err)
+	}
+	if export.Finished.IsZero() {
+		return fmt.Errorf("the export is not finished yet: %w", ErrClientBadRequest)
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=discussions.jsonl")
+	for _, chunk := range export.Chunks {
+		data, _, err := getText(c, textDiscussionExport, chunk)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write the export: %w", err)
+		}
+	}
+	return nil
+}
+
+type uiDiscussionExport struct {
+	Started     time.Time
+	Finished    time.Time
+	Discussions int
+	Link        string
+}
+
+func loadDiscussionExportUI(c context.Context) (*uiDiscussionExport, error) {
+	export, key, err := lastDiscussionExport(c)
+	if err != nil || export == nil {
+		return nil, err
+	}
+	ret := &uiDiscussionExport{
+		Started:     export.Started,
+		Finished:    export.Finished,
+		Discussions: export.Discussions,
+	}
+	if !export.Finished.IsZero() {
+		ret.Link = fmt.Sprintf("/admin/discussion_export?id=%v", key.IntID())
+	}
+	return ret, nil
+}
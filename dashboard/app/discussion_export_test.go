@@ -0,0 +1,106 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestDiscussionExport(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+	_, bugKey, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+
+	for i := 0; i < 3; i++ {
+		c.expectOK(client.ReportDiscussion(&dashapi.Discussion{
+			ID:      fmt.Sprintf("discussion-%d", i),
+			Source:  testDiscussionSource,
+			Type:    dashapi.DiscussionPatch,
+			Subject: fmt.Sprintf("[PATCH] fix %d", i),
+			BugIDs:  []string{extBugID},
+			Messages: []dashapi.DiscussionMessage{
+				{
+					ID:       fmt.Sprintf("message-%d-1", i),
+					External: true,
+					Time:     timeNow(c.ctx),
+					Author:   "Developer@Kernel.org",
+					Excerpt:  "secret text",
+				},
+				{
+					ID:       fmt.Sprintf("message-%d-2", i),
+					External: true,
+					Time:     timeNow(c.ctx),
+					Author:   "maintainer@kernel.org",
+				},
+			},
+		}))
+	}
+
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=export_discussions")
+	c.expectOK(err)
+	// Only one export may run at a time.
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=export_discussions")
+	c.expectNE(err, nil)
+
+	chunks := 0
+	for more := true; more; chunks++ {
+		more, err = exportDiscussionsChunk(c.ctx, 2)
+		c.expectOK(err)
+	}
+	c.expectEQ(chunks, 2)
+	more, err := exportDiscussionsChunk(c.ctx, 2)
+	c.expectOK(err)
+	c.expectEQ(more, false)
+
+	exportUI, err := loadDiscussionExportUI(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(exportUI.Discussions, 3)
+	c.expectNE(exportUI.Link, "")
+	page, err := c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectEQ(bytes.Contains(page, []byte(exportUI.Link)), true)
+
+	_, err = c.AuthGET(AccessPublic, exportUI.Link)
+	c.expectNE(err, nil)
+	data, err := c.AuthGET(AccessAdmin, exportUI.Link)
+	c.expectOK(err)
+	for _, forbidden := range []string{"developer@", "maintainer@", "secret text"} {
+		if bytes.Contains(bytes.ToLower(data), []byte(forbidden)) {
+			t.Fatalf("the export contains %q:\n%s", forbidden, data)
+		}
+	}
+	var exported []*exportedDiscussion
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		d := new(exportedDiscussion)
+		c.expectOK(json.Unmarshal(s.Bytes(), d))
+		exported = append(exported, d)
+	}
+	c.expectEQ(len(exported), 3)
+	authors := map[string]bool{}
+	for _, d := range exported {
+		c.expectEQ(d.Source, string(testDiscussionSource))
+		c.expectEQ(d.Bugs, []string{bugKey.StringID()})
+		c.expectEQ(len(d.Messages), 2)
+		for _, m := range d.Messages {
+			c.expectEQ(m.AuthorDomain, "kernel.org")
+			c.expectEQ(m.External, true)
+			authors[m.Author] = true
+		}
+	}
+	// The same sender must get the same hash within the export.
+	c.expectEQ(len(authors), 2)
+}
@@ -0,0 +1,364 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// Lore sometimes serves the same thread under several Message-IDs (e.g. differently capitalized
+// or rewritten by a mailing list), so we end up with several Discussion entities for one thread.
+// The code below finds such pairs and, once an admin approves them, merges them together.
+// The merged discussion leaves a DiscussionAlias behind, so later updates that still use
+// its ID (e.g. the next upload of the whole thread) reach the merge target.
+
+// discussionDigest is the part of Discussion that is relevant for finding equivalent discussions.
+type discussionDigest struct {
+	Source  string
+	ID      string
+	Subject string
+	BugKeys []string
+	First   time.Time
+	Last    time.Time
+}
+
+func makeDiscussionDigest(d *Discussion) *discussionDigest {
+	ret := &discussionDigest{
+		Source:  d.Source,
+		ID:      d.ID,
+		Subject: d.Subject,
+		BugKeys: d.BugKeys,
+	}
+	for _, m := range d.Messages {
+		if ret.First.IsZero() || m.Time.Before(ret.First) {
+			ret.First = m.Time
+		}
+		if ret.Last.Before(m.Time) {
+			ret.Last = m.Time
+		}
+	}
+	return ret
+}
+
+const (
+	mergeReasonSameID      = "same normalized ID"
+	mergeReasonSameSubject = "same subject, bugs and time range"
+)
+
+// proposeDiscussionMerges returns pairs of discussions that likely represent the same thread.
+// The older discussion (by its first message) is always the merge target.
+func proposeDiscussionMerges(digests []*discussionDigest) []*DiscussionMergeCandidate {
+	sorted := append([]*discussionDigest{}, digests...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].First.Equal(sorted[j].First) {
+			return sorted[i].First.Before(sorted[j].First)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	var ret []*DiscussionMergeCandidate
+	merged := map[*discussionDigest]bool{}
+	propose := func(from, to *discussionDigest, reason string) {
+		merged[from] = true
+		ret = append(ret, &DiscussionMergeCandidate{
+			Source: from.Source,
+			FromID: from.ID,
+			ToID:   to.ID,
+			Reason: reason,
+		})
+	}
+	byID := map[string]*discussionDigest{}
+	for _, d := range sorted {
+		key := d.Source + "|" + canonicalDiscussionID(d.Source, d.ID)
+		if target := byID[key]; target != nil {
+			propose(d, target, mergeReasonSameID)
+			continue
+		}
+		byID[key] = d
+	}
+	bySubject := map[string][]*discussionDigest{}
+	for _, d := range sorted {
+		if merged[d] {
+			continue
+		}
+		subject := canonicalDiscussionSubject(d.Subject)
+		if subject == "" {
+			continue
+		}
+		key := d.Source + "|" + subject
+		var target *discussionDigest
+		for _, candidate := range bySubject[key] {
+			if similarDiscussions(candidate, d) {
+				target = candidate
+				break
+			}
+		}
+		if target != nil {
+			propose(d, target, mergeReasonSameSubject)
+			continue
+		}
+		bySubject[key] = append(bySubject[key], d)
+	}
+	return ret
+}
+
+func canonicalDiscussionID(source, id string) string {
+	if impl := discussionSources[dashapi.DiscussionSource(source)]; impl != nil {
+		id = impl.NormalizeID(id)
+	}
+	return strings.ToLower(id)
+}
+
+func canonicalDiscussionSubject(subject string) string {
+	subject = strings.ToLower(strings.TrimSpace(subject))
+	for {
+		trimmed := strings.TrimSpace(strings.TrimPrefix(subject, "re:"))
+		if trimmed == subject {
+			break
+		}
+		subject = trimmed
+	}
+	return strings.Join(strings.Fields(subject), " ")
+}
+
+// similarDiscussions checks that the discussions are about the same bugs and happened at the same time.
+func similarDiscussions(a, b *discussionDigest) bool {
+	if a.First.IsZero() || b.First.IsZero() || a.Last.Before(b.First) || b.Last.Before(a.First) {
+		return false
+	}
+	for _, key := range a.BugKeys {
+		if stringInList(b.BugKeys, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// findDiscussionMergeCandidates scans all discussions and saves the new merge proposals for review.
+// It returns the number of new proposals.
+func findDiscussionMergeCandidates(c context.Context) (int, error) {
+	var digests []*discussionDigest
+	iter := db.NewQuery("Discussion").Run(c)
+	for {
+		d := new(Discussion)
+		_, err := iter.Next(d)
+		if err == db.Done {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch discussions: %w", err)
+		}
+		digests = append(digests, makeDiscussionDigest(d))
+	}
+	existingKeys, err := db.NewQuery("DiscussionMergeCandidate").KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query merge candidates: %w", err)
+	}
+	existing := map[string]bool{}
+	for _, key := range existingKeys {
+		existing[key.StringID()] = true
+	}
+	var keys []*db.Key
+	var candidates []*DiscussionMergeCandidate
+	for _, candidate := range proposeDiscussionMerges(digests) {
+		if existing[candidate.id()] {
+			continue
+		}
+		candidate.Created = timeNow(c)
+		keys = append(keys, candidate.key(c))
+		candidates = append(candidates, candidate)
+	}
+	total := 0
+	for len(keys) > 0 {
+		batch := 100
+		if batch > len(keys) {
+			batch = len(keys)
+		}
+		if _, err := db.PutMulti(c, keys[:batch], candidates[:batch]); err != nil {
+			return 0, fmt.Errorf("failed to save merge candidates: %w", err)
+		}
+		keys, candidates = keys[batch:], candidates[batch:]
+		total += batch
+	}
+	return total, nil
+}
+
+func loadDiscussionMergeCandidates(c context.Context) ([]*DiscussionMergeCandidate, []*db.Key, error) {
+	var candidates []*DiscussionMergeCandidate
+	keys, err := db.NewQuery("DiscussionMergeCandidate").
+		Filter("Rejected=", false).
+		Order("Created").
+		Limit(100).
+		GetAll(c, &candidates)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query merge candidates: %w", err)
+	}
+	return candidates, keys, nil
+}
+
+type uiDiscussionMerge struct {
+	ID       string
+	Source   string
+	From     string
+	FromLink string
+	To       string
+	ToLink   string
+	Reason   string
+}
+
+func loadDiscussionMergesUI(c context.Context) ([]*uiDiscussionMerge, error) {
+	candidates, keys, err := loadDiscussionMergeCandidates(c)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*uiDiscussionMerge
+	for i, candidate := range candidates {
+		from := &Discussion{ID: candidate.FromID, Source: candidate.Source}
+		to := &Discussion{ID: candidate.ToID, Source: candidate.Source}
+		ret = append(ret, &uiDiscussionMerge{
+			ID:       keys[i].StringID(),
+			Source:   candidate.Source,
+			From:     candidate.FromID,
+			FromLink: from.link(),
+			To:       candidate.ToID,
+			ToLink:   to.link(),
+			Reason:   candidate.Reason,
+		})
+	}
+	return ret, nil
+}
+
+// applyDiscussionMerge performs (approve == true) or rejects the proposed merge.
+func applyDiscussionMerge(c context.Context, id string, approve bool) error {
+	key := db.NewKey(c, "DiscussionMergeCandidate", id, 0, nil)
+	candidate := new(DiscussionMergeCandidate)
+	if err := db.Get(c, key, candidate); err != nil {
+		return fmt.Errorf("failed to get merge candidate: %w", err)
+	}
+	if !approve {
+		candidate.Rejected = true
+		_, err := db.Put(c, key, candidate)
+		return err
+	}
+	if err := mergeDiscussionInto(c, candidate.Source, candidate.FromID, candidate.ToID); err != nil {
+		return err
+	}
+	return db.Delete(c, key)
+}
+
+// mergeDiscussionInto moves messages and bugs of one discussion into another one
+// and replaces the former with an alias, so that further updates of it reach the target.
+// Summaries of the affected bugs are recomputed afterwards.
+func mergeDiscussionInto(c context.Context, source, fromID, toID string) error {
+	var bugKeys []string
+	now := timeNow(c)
+	tx := func(c context.Context) error {
+		from, to := new(Discussion), new(Discussion)
+		fromKey, toKey := discussionKey(c, source, fromID), discussionKey(c, source, toID)
+		if err := db.GetMulti(c, []*db.Key{fromKey, toKey}, []*Discussion{from, to}); err != nil {
+			return fmt.Errorf("failed to get discussions: %w", err)
+		}
+		to.mergeFrom(from)
+		bugKeys = to.BugKeys
+		if _, err := db.Put(c, toKey, to); err != nil {
+			return fmt.Errorf("failed to put discussion: %w", err)
+		}
+		alias := &DiscussionAlias{
+			Source:   source,
+			ID:       fromID,
+			TargetID: toID,
+			Created:  now,
+		}
+		if _, err := db.Put(c, discussionAliasKey(c, source, fromID), alias); err != nil {
+			return fmt.Errorf("failed to put discussion alias: %w", err)
+		}
+		return db.Delete(c, fromKey)
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10, XG: true}); err != nil {
+		return err
+	}
+	for _, key := range bugKeys {
+		if err := refreshBugDiscussionInfo(c, db.NewKey(c, "Bug", key, 0, nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Once a discussion is merged, it may be merged again, so the aliases may form chains.
+const maxDiscussionAliasChain = 10
+
+// resolveDiscussionID returns the ID of the discussion that the updates of the id must go to.
+func resolveDiscussionID(c context.Context, source, id string) (string, error) {
+	for i := 0; i < maxDiscussionAliasChain; i++ {
+		alias := new(DiscussionAlias)
+		if err := db.Get(c, discussionAliasKey(c, source, id), alias); err == db.ErrNoSuchEntity {
+			return id, nil
+		} else if err != nil {
+			return "", fmt.Errorf("failed to get discussion alias: %w", err)
+		}
+		id = alias.TargetID
+	}
+	return "", fmt.Errorf("too long chain of aliases for discussion %v", id)
+}
+
+func (d *Discussion) mergeFrom(other *Discussion) {
+	for _, key := range other.BugKeys {
+		d.attachBug(key, other.attachmentReason(key))
+	}
+	if d.ReproSentTime.Before(other.ReproSentTime) {
+		d.ReproSentTime = other.ReproSentTime
+	}
+	if d.TargetTree == "" {
+		d.TargetTree = other.TargetTree
+	}
+	if d.PatchState == "" {
+		d.PatchState = other.PatchState
+	}
+	lastExcerpt := map[string]string{}
+	if last := d.lastMessage(); last != nil {
+		lastExcerpt[last.ID] = d.LastExcerpt
+	}
+	if last := other.lastMessage(); last != nil {
+		lastExcerpt[last.ID] = other.LastExcerpt
+	}
+	diff := DiscussionSummary{
+		LastPatchAccepted: other.Summary.LastPatchAccepted,
+	}
+	existingIDs := d.messageIDs()
+	for _, m := range other.Messages {
+		if _, ok := existingIDs[m.ID]; ok {
+			continue
+		}
+		d.Messages = append(d.Messages, m)
+		if m.AutoReply {
+			continue
+		}
+		diff.AllMessages++
+		if m.External {
+			diff.ExternalMessages++
+		}
+		if diff.LastMessage.Before(m.Time) {
+			diff.LastMessage = m.Time
+		}
+		if m.Sentiment != sentimentNeutral && diff.LastVerdictTime.Before(m.Time) {
+			diff.LastVerdict = m.Sentiment
+			diff.LastVerdictTime = m.Time
+		}
+	}
+	if d.Type == string(dashapi.DiscussionPatch) {
+		diff.LastPatchMessage = diff.LastMessage
+	}
+	d.Summary.merge(diff)
+	d.sortMessages()
+	if last := d.lastMessage(); last != nil {
+		d.LastExcerpt = lastExcerpt[last.ID]
+	}
+}
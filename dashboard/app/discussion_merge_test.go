@@ -0,0 +1,216 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestProposeDiscussionMerges(t *testing.T) {
+	base := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	lore := string(dashapi.DiscussionLore)
+	digest := func(id, subject string, first, last time.Duration, bugs ...string) *discussionDigest {
+		return &discussionDigest{
+			Source:  lore,
+			ID:      id,
+			Subject: subject,
+			BugKeys: bugs,
+			First:   base.Add(first),
+			Last:    base.Add(last),
+		}
+	}
+	tests := []struct {
+		name      string
+		digests   []*discussionDigest
+		proposals []*DiscussionMergeCandidate
+	}{
+		{
+			name: "capitalization",
+			digests: []*discussionDigest{
+				digest("<ABC@kernel.org>", "subject 1", time.Hour, 2*time.Hour, "bug1"),
+				digest("<abc@kernel.org>", "subject 2", 0, time.Hour, "bug2"),
+			},
+			proposals: []*DiscussionMergeCandidate{
+				{Source: lore, FromID: "<ABC@kernel.org>", ToID: "<abc@kernel.org>", Reason: mergeReasonSameID},
+			},
+		},
+		{
+			name: "same subject",
+			digests: []*discussionDigest{
+				digest("<a@kernel.org>", "[PATCH] fix the bug", 0, 3*time.Hour, "bug1", "bug2"),
+				digest("<b@list.org>", "Re: [PATCH]  Fix the bug", time.Hour, 4*time.Hour, "bug2"),
+			},
+			proposals: []*DiscussionMergeCandidate{
+				{Source: lore, FromID: "<b@list.org>", ToID: "<a@kernel.org>", Reason: mergeReasonSameSubject},
+			},
+		},
+		{
+			name: "same subject, different bugs",
+			digests: []*discussionDigest{
+				digest("<a@kernel.org>", "[PATCH] fix the bug", 0, 3*time.Hour, "bug1"),
+				digest("<b@list.org>", "[PATCH] fix the bug", time.Hour, 4*time.Hour, "bug2"),
+			},
+		},
+		{
+			name: "same subject, different time",
+			digests: []*discussionDigest{
+				digest("<a@kernel.org>", "[PATCH] fix the bug", 0, time.Hour, "bug1"),
+				digest("<b@list.org>", "[PATCH] fix the bug", 2*time.Hour, 4*time.Hour, "bug1"),
+			},
+		},
+		{
+			name: "different sources",
+			digests: []*discussionDigest{
+				digest("<a@kernel.org>", "subject", 0, time.Hour, "bug1"),
+				{
+					Source:  string(testDiscussionSource),
+					ID:      "a@kernel.org",
+					Subject: "subject",
+					BugKeys: []string{"bug1"},
+					First:   base,
+					Last:    base.Add(time.Hour),
+				},
+			},
+		},
+		{
+			name: "three copies",
+			digests: []*discussionDigest{
+				digest("<X@kernel.org>", "subject", time.Hour, time.Hour, "bug1"),
+				digest("x@kernel.org", "subject", 0, time.Hour, "bug1"),
+				digest("<y@list.org>", "Re: subject", time.Minute, 2*time.Hour, "bug1"),
+			},
+			proposals: []*DiscussionMergeCandidate{
+				{Source: lore, FromID: "<X@kernel.org>", ToID: "x@kernel.org", Reason: mergeReasonSameID},
+				{Source: lore, FromID: "<y@list.org>", ToID: "x@kernel.org", Reason: mergeReasonSameSubject},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			got := proposeDiscussionMerges(test.digests)
+			if diff := cmp.Diff(test.proposals, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestMergeDiscussionState(t *testing.T) {
+	accepted := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+	to := &Discussion{Type: string(dashapi.DiscussionPatch)}
+	to.mergeFrom(&Discussion{
+		Type:       string(dashapi.DiscussionPatch),
+		TargetTree: "net",
+		PatchState: patchStateAccepted,
+		Summary:    DiscussionSummary{LastPatchAccepted: accepted},
+	})
+	if to.TargetTree != "net" || to.PatchState != patchStateAccepted ||
+		!to.Summary.LastPatchAccepted.Equal(accepted) {
+		t.Fatalf("the state was not carried over: %+v", to)
+	}
+	// The state of the target takes precedence.
+	to.mergeFrom(&Discussion{TargetTree: "bpf", PatchState: patchStateRejected})
+	if to.TargetTree != "net" || to.PatchState != patchStateAccepted {
+		t.Fatalf("the state was overwritten: %+v", to)
+	}
+}
+
+func TestMergeDiscussions(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+	_, bugKey, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+
+	report := func(id string, messages ...string) {
+		t.Helper()
+		d := &dashapi.Discussion{
+			ID:      id,
+			Source:  dashapi.DiscussionLore,
+			Type:    dashapi.DiscussionReport,
+			Subject: "Bug reported",
+			BugIDs:  []string{extBugID},
+		}
+		for _, msg := range messages {
+			d.Messages = append(d.Messages, dashapi.DiscussionMessage{
+				ID:       msg,
+				External: true,
+				Time:     timeNow(c.ctx),
+			})
+			c.advanceTime(time.Minute)
+		}
+		c.expectOK(client.ReportDiscussion(d))
+	}
+	report("<thread@kernel.org>", "<thread@kernel.org>", "<reply-1@kernel.org>")
+	report("<Thread@Kernel.org>", "<Thread@Kernel.org>", "<reply-1@kernel.org>", "<reply-2@kernel.org>")
+	expectMessages := func(want int) {
+		t.Helper()
+		bug := new(Bug)
+		c.expectOK(db.Get(c.ctx, bugKey, bug))
+		c.expectEQ(bug.discussionSummary().AllMessages, want)
+	}
+	expectMessages(5)
+
+	found, err := findDiscussionMergeCandidates(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(found, 1)
+	merges, err := loadDiscussionMergesUI(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(merges), 1)
+	c.expectEQ(merges[0].From, "<Thread@Kernel.org>")
+	c.expectEQ(merges[0].To, "<thread@kernel.org>")
+	page, err := c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectEQ(bytes.Contains(page, []byte("action=merge_discussions&amp;id="+merges[0].ID)), true)
+
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=merge_discussions&id="+merges[0].ID)
+	c.expectOK(err)
+	discussions, err := discussionsForBug(c.ctx, bugKey)
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	c.expectEQ(discussions[0].ID, "<thread@kernel.org>")
+	c.expectEQ(discussions[0].Summary.AllMessages, 4)
+	c.expectEQ(len(discussions[0].Messages), 4)
+	expectMessages(4)
+	merges, err = loadDiscussionMergesUI(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(merges), 0)
+
+	// Later updates under the merged ID go to the merge target and are not counted twice.
+	report("<Thread@Kernel.org>", "<Thread@Kernel.org>", "<reply-1@kernel.org>", "<reply-2@kernel.org>",
+		"<reply-3@kernel.org>")
+	discussions, err = discussionsForBug(c.ctx, bugKey)
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	c.expectEQ(discussions[0].ID, "<thread@kernel.org>")
+	c.expectEQ(discussions[0].Summary.AllMessages, 5)
+	expectMessages(5)
+
+	// Rejected proposals are not proposed again.
+	report("<THREAD@kernel.org>", "<THREAD@kernel.org>")
+	found, err = findDiscussionMergeCandidates(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(found, 1)
+	merges, err = loadDiscussionMergesUI(c.ctx)
+	c.expectOK(err)
+	c.expectOK(applyDiscussionMerge(c.ctx, merges[0].ID, false))
+	found, err = findDiscussionMergeCandidates(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(found, 0)
+	merges, err = loadDiscussionMergesUI(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(merges), 0)
+}
@@ -4,13 +4,21 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/syzkaller/dashboard/dashapi"
 	"github.com/google/syzkaller/pkg/email"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/memcache"
 )
 
 func TestDiscussionAccess(t *testing.T) {
@@ -35,6 +43,7 @@ func TestDiscussionAccess(t *testing.T) {
 	rep2 := client.pollBug()
 
 	// Patch to both bugs.
+	// The messages reach us an hour after they were sent, the activity is counted since then.
 	firstTime := timeNow(c.ctx)
 	c.advanceTime(time.Hour)
 	c.expectOK(client.SaveDiscussion(&dashapi.SaveDiscussionReq{
@@ -78,15 +87,17 @@ func TestDiscussionAccess(t *testing.T) {
 	c.expectOK(err)
 
 	// Verify discussion that spans only one bug.
-	got, err := getBugDiscussionsUI(c.ctx, firstBug)
+	got, err := c.bugPageDiscussions(firstBug)
 	c.expectOK(err)
 	if diff := cmp.Diff([]*uiBugDiscussion{
 		{
-			Subject:  "Patch for both bugs",
-			Link:     "https://lore.kernel.org/all/123/T/",
-			Total:    1,
-			External: 1,
-			Last:     firstTime,
+			Subject:    "Patch for both bugs",
+			Link:       "https://lore.kernel.org/all/123/T/",
+			Reason:     string(dashapi.AttachAPI),
+			ReasonInfo: attachmentReasonInfo[dashapi.AttachAPI],
+			Total:      1,
+			External:   1,
+			Last:       firstTime.Add(time.Hour),
 		},
 	}, got); diff != "" {
 		t.Fatal(diff)
@@ -96,22 +107,26 @@ func TestDiscussionAccess(t *testing.T) {
 	c.expectOK(err)
 
 	// Verify that we also show discussions for several bugs.
-	got, err = getBugDiscussionsUI(c.ctx, secondBug)
+	got, err = c.bugPageDiscussions(secondBug)
 	c.expectOK(err)
 	if diff := cmp.Diff([]*uiBugDiscussion{
 		{
-			Subject:  "Second bug reported",
-			Link:     "https://lore.kernel.org/all/456/T/",
-			Total:    1,
-			External: 0,
-			Last:     secondTime,
+			Subject:    "Second bug reported",
+			Link:       "https://lore.kernel.org/all/456/T/",
+			Reason:     string(dashapi.AttachAPI),
+			ReasonInfo: attachmentReasonInfo[dashapi.AttachAPI],
+			Total:      1,
+			External:   0,
+			Last:       secondTime.Add(time.Hour),
 		},
 		{
-			Subject:  "Patch for both bugs",
-			Link:     "https://lore.kernel.org/all/123/T/",
-			Total:    1,
-			External: 1,
-			Last:     firstTime,
+			Subject:    "Patch for both bugs",
+			Link:       "https://lore.kernel.org/all/123/T/",
+			Reason:     string(dashapi.AttachAPI),
+			ReasonInfo: attachmentReasonInfo[dashapi.AttachAPI],
+			Total:      1,
+			External:   1,
+			Last:       firstTime.Add(time.Hour),
 		},
 	}, got); diff != "" {
 		t.Fatal(diff)
@@ -122,8 +137,8 @@ func TestDiscussionAccess(t *testing.T) {
 	if diff := cmp.Diff(DiscussionSummary{
 		AllMessages:      2,
 		ExternalMessages: 1,
-		LastMessage:      secondTime,
-		LastPatchMessage: firstTime,
+		LastMessage:      secondTime.Add(time.Hour),
+		LastPatchMessage: firstTime.Add(time.Hour),
 	}, summary); diff != "" {
 		t.Fatal(diff)
 	}
@@ -140,71 +155,60 @@ func TestEmailOwnDiscussions(t *testing.T) {
 
 	crash := testCrash(build, 1)
 	client.ReportCrash(crash)
-	msg := client.pollEmailBug()
-	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
-	c.expectOK(err)
+	extBugID := c.pollEmailExtID()
 
 	// Start a discussion.
-	incoming1 := fmt.Sprintf(`Sender: syzkaller@googlegroups.com
-Date: Tue, 15 Aug 2017 14:59:00 -0700
-Message-ID: <1234>
-Subject: Bug reported
-From: %v
-To: foo@bar.com, linux-kernel@vger.kernel.org
-Content-Type: text/plain
-
-Hello`, msg.Sender)
-	_, err = c.POST("/_ah/mail/lore@email.com", incoming1)
-	c.expectOK(err)
+	thread := c.incomingThread("Bug reported", extBugID)
+	firstTime := timeNow(c.ctx)
+	thread.reply(thread.botEmail, "Hello")
 
 	bug, _, err := findBugByReportingID(c.ctx, extBugID)
 	c.expectOK(err)
 
-	zone := time.FixedZone("", -7*60*60)
-	got, err := getBugDiscussionsUI(c.ctx, bug)
+	got, err := c.bugPageDiscussions(bug)
 	c.expectOK(err)
 	if diff := cmp.Diff([]*uiBugDiscussion{
 		{
-			Subject:  "Bug reported",
-			Link:     "https://lore.kernel.org/all/1234/T/",
-			Total:    1,
-			External: 0,
-			Last:     time.Date(2017, time.August, 15, 14, 59, 0, 0, zone),
+			Subject:    "Bug reported",
+			Link:       "https://lore.kernel.org/all/thread-1@test.com/T/",
+			Reason:     string(dashapi.AttachAddress),
+			ReasonInfo: attachmentReasonInfo[dashapi.AttachAddress],
+			Total:      1,
+			External:   0,
+			Last:       firstTime,
 		},
 	}, got); diff != "" {
 		t.Fatal(diff)
 	}
 
 	// Emulate some user-reply to the discussion.
-	incoming2 := fmt.Sprintf(`Sender: user@user.com
-Date: Tue, 16 Aug 2017 14:59:00 -0700
-Message-ID: <2345>
-Subject: Re. Bug reported
-From: user@user.com
-In-Reply-To: <1234>
-Cc: %v, linux-kernel@vger.kernel.org
-Content-Type: text/plain
-
-Hello`, msg.Sender)
-	_, err = c.POST("/_ah/mail/lore@email.com", incoming2)
-	c.expectOK(err)
+	c.advanceTime(24 * time.Hour)
+	secondTime := timeNow(c.ctx)
+	thread.reply("user@user.com", "Hello")
 
 	bug, _, err = findBugByReportingID(c.ctx, extBugID)
 	c.expectOK(err)
 
-	got, err = getBugDiscussionsUI(c.ctx, bug)
+	got, err = c.bugPageDiscussions(bug)
 	c.expectOK(err)
 	if diff := cmp.Diff([]*uiBugDiscussion{
 		{
-			Subject:  "Bug reported",
-			Link:     "https://lore.kernel.org/all/1234/T/",
-			Total:    2,
-			External: 1,
-			Last:     time.Date(2017, time.August, 16, 14, 59, 0, 0, zone),
+			Subject:    "Bug reported",
+			Link:       "https://lore.kernel.org/all/thread-1@test.com/T/",
+			Reason:     string(dashapi.AttachAddress),
+			ReasonInfo: attachmentReasonInfo[dashapi.AttachAddress],
+			Total:      2,
+			External:   1,
+			Last:       secondTime,
 		},
 	}, got); diff != "" {
 		t.Fatal(diff)
 	}
+	c.expectDiscussionSummary(extBugID, DiscussionSummary{
+		AllMessages:      2,
+		ExternalMessages: 1,
+		LastMessage:      secondTime,
+	})
 }
 
 func TestEmailUnrelatedDiscussion(t *testing.T) {
@@ -239,7 +243,7 @@ Hello`, msg.Sender)
 	c.expectOK(err)
 
 	// The discussion should go ignored.
-	got, err := getBugDiscussionsUI(c.ctx, bug)
+	got, err := c.bugPageDiscussions(bug)
 	c.expectOK(err)
 	if diff := cmp.Diff([]*uiBugDiscussion(nil), got); diff != "" {
 		t.Fatal(diff)
@@ -257,31 +261,160 @@ func TestEmailSubdiscussion(t *testing.T) {
 
 	crash := testCrash(build, 1)
 	client.ReportCrash(crash)
-	msg := client.pollEmailBug()
-	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("Some discussion", extBugID)
+	thread.reply("user@user.com", "Hello", EmailOptInReplyTo("<1234>"))
+
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
 	c.expectOK(err)
 
-	incoming1 := fmt.Sprintf(`Date: Tue, 15 Aug 2017 14:59:00 -0700
-Message-ID: <2345>
-Subject: Some discussion
-In-Reply-To: <1234>
-From: user@user.com
-To: %v
-Cc: lore@email.com
+	// We have not seen the start of the discussion, but it should not go ignored.
+	got, err := c.bugPageDiscussions(bug)
+	c.expectOK(err)
+	client.expectEQ(len(got), 1)
+	client.expectEQ(got[0].Link, "https://lore.kernel.org/all/thread-1@test.com/T/")
+}
+
+func TestEmailSplitThread(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("Bug reported", extBugID)
+	thread.reply(thread.botEmail, "Hello")
+	c.advanceTime(time.Hour)
+	thread.reply("user@user.com", "Looking into it")
+
+	// Someone replies to a message we have never received, e.g. one that was sent
+	// only to a different mailing list. The rest of such a sub-thread is tracked separately.
+	c.advanceTime(time.Hour)
+	thread.reply("user2@user.com", "Me too", EmailOptInReplyTo("<unseen@test.com>"),
+		EmailOptReferences("<unseen-base@test.com> <unseen@test.com>"))
+	c.advanceTime(time.Hour)
+	lastTime := timeNow(c.ctx)
+	thread.reply("user@user.com", "Thanks")
+
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	got, err := c.bugPageDiscussions(bug)
+	c.expectOK(err)
+	var links []string
+	var total []int
+	for _, d := range got {
+		links = append(links, d.Link)
+		total = append(total, d.Total)
+	}
+	c.expectEQ(links, []string{
+		"https://lore.kernel.org/all/thread-3@test.com/T/",
+		"https://lore.kernel.org/all/thread-1@test.com/T/",
+	})
+	c.expectEQ(total, []int{2, 2})
+	c.expectDiscussionSummary(extBugID, DiscussionSummary{
+		AllMessages:      4,
+		ExternalMessages: 3,
+		LastMessage:      lastTime,
+	})
+}
+
+func TestEmailReplyToForward(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("Bug reported", extBugID)
+	botMessage := thread.reply(thread.botEmail, "Hello")
+
+	// Someone forwarded the report to a colleague and the colleague replied to the forward.
+	// Neither the forwarded copy nor the reply are addressed to us, the bug is only known
+	// from a mangled link in the quoted text.
+	c.advanceTime(time.Hour)
+	replyTime := timeNow(c.ctx)
+	link := url.QueryEscape("https://testapp.appspot.com/bug?extid=" + extBugID)
+	incoming := fmt.Sprintf(`Date: %v
+Message-ID: <reply-to-forward@test.com>
+In-Reply-To: <forward@test.com>
+References: %v <forward@test.com>
+Subject: RE: FW: Bug reported
+From: colleague@user.com
+To: lore@email.com
 Content-Type: text/plain
 
-Hello`, msg.Sender)
-	_, err = c.POST("/_ah/mail/lore@email.com", incoming1)
+I'll take a look.
+
+________________________________
+From: user@user.com
+Subject: FW: Bug reported
+
+> dashboard link: https://safelinks.outlook.com/?url=%v&data=05
+`, replyTime.Format(time.RFC1123Z), botMessage, link)
+	_, err := c.POST("/_ah/mail/lore@email.com", incoming)
 	c.expectOK(err)
 
 	bug, _, err := findBugByReportingID(c.ctx, extBugID)
 	c.expectOK(err)
+	discussions, err := discussionsForBug(c.ctx, bug.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	c.expectEQ(len(discussions[0].Messages), 2)
+	c.expectDiscussionSummary(extBugID, DiscussionSummary{
+		AllMessages:      2,
+		ExternalMessages: 1,
+		LastMessage:      replyTime,
+	})
+}
 
-	// We have not seen the start of the discussion, but it should not go ignored.
-	got, err := getBugDiscussionsUI(c.ctx, bug)
+func TestEmailDiscussionDedup(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("Bug reported", extBugID)
+	thread.reply(thread.botEmail, "Hello")
+	c.advanceTime(time.Hour)
+	replyTime := timeNow(c.ctx)
+	thread.reply("user@user.com", "Looking into it")
+
+	// The same message may arrive several times, e.g. via different mailing lists.
+	c.advanceTime(time.Hour)
+	thread.redeliver()
+	thread.redeliver()
+
+	c.expectDiscussionSummary(extBugID, DiscussionSummary{
+		AllMessages:      2,
+		ExternalMessages: 1,
+		LastMessage:      replyTime,
+	})
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
 	c.expectOK(err)
-	client.expectEQ(len(got), 1)
-	client.expectEQ(got[0].Link, "https://lore.kernel.org/all/2345/T/")
+	discussions, err := discussionsForBug(c.ctx, bug.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	c.expectEQ(len(discussions[0].Messages), 2)
 }
 
 func TestEmailPatchWithLink(t *testing.T) {
@@ -317,9 +450,1145 @@ Link: https://testapp.appspot.com/bug?extid=%v
 	c.expectOK(err)
 
 	// We have not seen the start of the discussion, but it should not go ignored.
-	got, err := getBugDiscussionsUI(c.ctx, bug)
+	got, err := c.bugPageDiscussions(bug)
 	c.expectOK(err)
 	client.expectEQ(len(got), 1)
 	client.expectEQ(got[0].Link, "https://lore.kernel.org/all/2345/T/")
 	client.expectEQ(got[0].Subject, "[PATCH v3] A lot of fixes")
 }
+
+func TestLoreDiscussionSource(t *testing.T) {
+	impl := discussionSources[dashapi.DiscussionLore]
+	for _, id := range []string{"123@host.com", "<123@host.com>", " <123@host.com>\n"} {
+		if got := impl.NormalizeID(id); got != "<123@host.com>" {
+			t.Errorf("NormalizeID(%q) = %q", id, got)
+		}
+	}
+	if got, want := impl.Link("<123@host.com>"), "https://lore.kernel.org/all/123@host.com/T/"; got != want {
+		t.Errorf("got link %q, want %q", got, want)
+	}
+	if err := impl.ValidateConfig(&DiscussionEmailConfig{ReceiveAddress: "not an email"}); err == nil {
+		t.Errorf("expected ValidateConfig to fail")
+	}
+}
+
+const testDiscussionSource dashapi.DiscussionSource = "test-source"
+
+// testDiscussionSourceImpl is a fake discussion source that stores IDs in lowercase.
+type testDiscussionSourceImpl struct{}
+
+func (testDiscussionSourceImpl) Link(id string) string {
+	return "https://discussions.test/" + id
+}
+
+func (testDiscussionSourceImpl) NormalizeID(id string) string {
+	return strings.ToLower(strings.Trim(id, "<> "))
+}
+
+func (testDiscussionSourceImpl) ValidateConfig(cfg *DiscussionEmailConfig) error {
+	if !strings.HasPrefix(cfg.ReceiveAddress, "test-source@") {
+		return fmt.Errorf("unexpected address %q", cfg.ReceiveAddress)
+	}
+	return nil
+}
+
+func TestCustomDiscussionSource(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	msg := client.pollEmailBug()
+	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+
+	incoming1 := fmt.Sprintf(`Date: Tue, 15 Aug 2017 14:59:00 -0700
+Message-ID: <ABCD>
+Subject: Bug reported
+From: user@user.com
+To: %v, test-source@email.com
+Content-Type: text/plain
+
+Hello`, msg.Sender)
+	_, err = c.POST("/_ah/mail/test-source@email.com", incoming1)
+	c.expectOK(err)
+
+	// The reply refers to the message by a differently written ID.
+	incoming2 := fmt.Sprintf(`Date: Tue, 16 Aug 2017 14:59:00 -0700
+Message-ID: <EFGH>
+Subject: Re: Bug reported
+From: user2@user.com
+In-Reply-To: <abcd>
+To: %v, test-source@email.com
+Content-Type: text/plain
+
+Hello`, msg.Sender)
+	_, err = c.POST("/_ah/mail/test-source@email.com", incoming2)
+	c.expectOK(err)
+
+	// The same discussion, but reported via API.
+	c.expectOK(client.SaveDiscussion(&dashapi.SaveDiscussionReq{
+		Discussion: &dashapi.Discussion{
+			ID:     "Abcd",
+			Source: testDiscussionSource,
+			Type:   dashapi.DiscussionReport,
+			BugIDs: []string{extBugID},
+			Messages: []dashapi.DiscussionMessage{
+				{
+					ID:       "efgh",
+					External: true,
+					Time:     time.Date(2017, time.August, 16, 21, 59, 0, 0, time.UTC),
+				},
+				{
+					ID:       "IJKL",
+					External: true,
+					Time:     time.Date(2017, time.August, 17, 21, 59, 0, 0, time.UTC),
+				},
+			},
+		},
+	}))
+
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+
+	got, err := c.bugPageDiscussions(bug)
+	c.expectOK(err)
+	if diff := cmp.Diff([]*uiBugDiscussion{
+		{
+			Subject:    "Bug reported",
+			Link:       "https://discussions.test/abcd",
+			Reason:     string(dashapi.AttachAddress),
+			ReasonInfo: attachmentReasonInfo[dashapi.AttachAddress],
+			Total:      3,
+			External:   3,
+			Last:       time.Date(2017, time.August, 17, 21, 59, 0, 0, time.UTC),
+		},
+	}, got, cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) })); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestEmailAutoReply(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("Bug reported", extBugID)
+	firstTime := timeNow(c.ctx)
+	thread.reply(thread.botEmail, "Hello")
+
+	// An Exchange out-of-office reply.
+	c.advanceTime(24 * time.Hour)
+	exchangeID := thread.reply("user@user.com", "I am out of office.",
+		EmailOptInReplyTo(thread.refs[0]),
+		EmailOptHeader("Auto-Submitted: auto-generated"),
+		EmailOptHeader("X-Auto-Response-Suppress: All"))
+
+	// A Gmail vacation responder.
+	c.advanceTime(24 * time.Hour)
+	gmailID := thread.reply("user2@user.com", "I am on vacation.",
+		EmailOptInReplyTo(thread.refs[0]),
+		EmailOptHeader("Auto-Submitted: auto-replied"),
+		EmailOptHeader("Precedence: bulk"))
+
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+
+	// Auto-replies must not affect the stats.
+	got, err := c.bugPageDiscussions(bug)
+	c.expectOK(err)
+	if diff := cmp.Diff([]*uiBugDiscussion{
+		{
+			Subject:    "Bug reported",
+			Link:       "https://lore.kernel.org/all/thread-1@test.com/T/",
+			Reason:     string(dashapi.AttachAddress),
+			ReasonInfo: attachmentReasonInfo[dashapi.AttachAddress],
+			Total:      1,
+			External:   0,
+			Last:       firstTime,
+		},
+	}, got); diff != "" {
+		t.Fatal(diff)
+	}
+	c.expectDiscussionSummary(extBugID, DiscussionSummary{
+		AllMessages: 1,
+		LastMessage: firstTime,
+	})
+
+	// But they are still stored for debugging.
+	discussions, err := discussionsForBug(c.ctx, bug.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	var autoReplies []string
+	for _, m := range discussions[0].Messages {
+		if m.AutoReply {
+			autoReplies = append(autoReplies, m.ID)
+		}
+	}
+	c.expectEQ(autoReplies, []string{exchangeID, gmailID})
+}
+
+func TestUpstreamDiscussion(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	upstreamClient := c.publicClient
+	downstreamClient := c.makeClient(clientDownstream, keyDownstream, true)
+
+	build := testBuild(1)
+	upstreamClient.UploadBuild(build)
+	crash := testCrash(build, 1)
+	upstreamClient.ReportCrash(crash)
+	msg := upstreamClient.pollEmailBug()
+
+	incoming := fmt.Sprintf(`Date: Tue, 15 Aug 2017 14:59:00 -0700
+Message-ID: <1234>
+Subject: Re: title1
+From: user@user.com
+To: %v
+Cc: lore@email.com
+Content-Type: text/plain
+
+Looking into it.`, msg.Sender)
+	_, err := c.POST("/_ah/mail/lore@email.com", incoming)
+	c.expectOK(err)
+
+	// The same crash happens downstream.
+	build2 := testBuild(2)
+	downstreamClient.UploadBuild(build2)
+	downstreamClient.ReportCrash(testCrash(build2, 1))
+	msg = c.pollEmailBug()
+	c.expectEQ(msg.To, []string{"downstream@syzkaller.com"})
+	c.expectTrue(strings.Contains(msg.Body, "upstream:       thread with 1 messages, "+
+		"last activity 2017/08/15 21:59: https://lore.kernel.org/all/1234/T/"))
+	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	c.expectEQ(bug.Namespace, "downstream")
+	upstream, err := upstreamDiscussion(c.ctx, bug, AccessPublic)
+	c.expectOK(err)
+	c.expectEQ(upstream.Link, "https://lore.kernel.org/all/1234/T/")
+	c.expectEQ(upstream.Messages, 1)
+	// The following lookups are served from memcache.
+	entry := new(upstreamDiscussionCacheEntry)
+	_, err = memcache.Gob.Get(c.ctx, upstreamDiscussionCacheKey(bug, AccessPublic), entry)
+	c.expectOK(err)
+	c.expectEQ(entry.Discussion, upstream)
+
+	page, err := c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "https://lore.kernel.org/all/1234/T/"))
+}
+
+func TestMoveBugDiscussions(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	client.ReportCrash(testCrash(build, 1))
+	oldBugID := c.pollEmailExtID()
+	client.ReportCrash(testCrash(build, 2))
+	otherBugID := c.pollEmailExtID()
+	// The bug that replaces the old one.
+	client.ReportCrash(testCrash(build, 3))
+	newBugID := c.pollEmailExtID()
+
+	c.expectOK(client.SaveDiscussion(&dashapi.SaveDiscussionReq{
+		Discussion: &dashapi.Discussion{
+			ID:      "123",
+			Source:  dashapi.DiscussionLore,
+			Type:    dashapi.DiscussionReport,
+			Subject: "Bug report",
+			BugIDs:  []string{oldBugID},
+			Messages: []dashapi.DiscussionMessage{
+				{ID: "123", External: true, Time: timeNow(c.ctx)},
+			},
+		},
+	}))
+	c.advanceTime(time.Hour)
+	lastTime := timeNow(c.ctx)
+	c.expectOK(client.SaveDiscussion(&dashapi.SaveDiscussionReq{
+		Discussion: &dashapi.Discussion{
+			ID:      "456",
+			Source:  dashapi.DiscussionLore,
+			Type:    dashapi.DiscussionPatch,
+			Subject: "Patch for two bugs",
+			BugIDs:  []string{oldBugID, otherBugID},
+			Messages: []dashapi.DiscussionMessage{
+				{ID: "456", External: true, Time: lastTime},
+			},
+		},
+	}))
+
+	expectLinks := func(extID string, want ...string) {
+		t.Helper()
+		page, err := c.AuthGET(AccessPublic, "/bug?extid="+extID)
+		c.expectOK(err)
+		for _, id := range []string{"123", "456"} {
+			link := "https://lore.kernel.org/all/" + id + "/T/"
+			shouldHave := false
+			for _, wantID := range want {
+				shouldHave = shouldHave || wantID == id
+			}
+			if strings.Contains(string(page), link) != shouldHave {
+				t.Fatalf("bug %v: expected link %v presence: %v", extID, link, shouldHave)
+			}
+		}
+	}
+	expectLinks(oldBugID, "123", "456")
+	expectLinks(otherBugID, "456")
+	expectLinks(newBugID)
+
+	_, oldKey, err := findBugByReportingID(c.ctx, oldBugID)
+	c.expectOK(err)
+	_, newKey, err := findBugByReportingID(c.ctx, newBugID)
+	c.expectOK(err)
+	c.expectOK(moveBugDiscussions(c.ctx, oldKey, newKey))
+
+	expectLinks(oldBugID)
+	expectLinks(otherBugID, "456")
+	expectLinks(newBugID, "123", "456")
+	c.expectDiscussionSummary(oldBugID, DiscussionSummary{})
+	c.expectDiscussionSummary(newBugID, DiscussionSummary{
+		AllMessages:      2,
+		ExternalMessages: 2,
+		LastMessage:      lastTime,
+		LastPatchMessage: lastTime,
+	})
+
+	// The discussion that is already attached to the new bug is not counted twice.
+	_, otherKey, err := findBugByReportingID(c.ctx, otherBugID)
+	c.expectOK(err)
+	c.expectOK(moveBugDiscussions(c.ctx, otherKey, newKey))
+	expectLinks(otherBugID)
+	expectLinks(newBugID, "123", "456")
+	c.expectDiscussionSummary(newBugID, DiscussionSummary{
+		AllMessages:      2,
+		ExternalMessages: 2,
+		LastMessage:      lastTime,
+		LastPatchMessage: lastTime,
+	})
+}
+
+func TestIsReproRequest(t *testing.T) {
+	tests := map[string]bool{
+		"Do you have a reproducer for this?":          true,
+		"Could syzbot share the repro, please?":       true,
+		"Is there a reproducer?":                      true,
+		"Hi,\n\nany repro for this one?\n\nThanks":    true,
+		"Is it reproducible?":                         true,
+		"I've sent a patch.":                          false,
+		"The reproducer no longer triggers the bug.":  false,
+		"Do you know why this happens?":               false,
+		"I could not reproduce it locally, any idea?": false,
+	}
+	for text, want := range tests {
+		if got := isReproRequest(text); got != want {
+			t.Errorf("%q: got %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestEmailReproRequest(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrashWithRepro(build, 1)
+	client.ReportCrash(crash)
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("Bug reported", extBugID)
+	thread.reply(thread.botEmail, "Hello")
+	c.advanceTime(time.Hour)
+	thread.reply("user@user.com", "Do you have a reproducer?")
+
+	reply := c.pollEmailBug()
+	c.expectEQ(reply.To, []string{"user@user.com"})
+	c.expectTrue(strings.Contains(reply.Body, "syz repro:      https://testapp.appspot.com/x/repro.syz?x="))
+	c.expectTrue(strings.Contains(reply.Body, "C reproducer:   https://testapp.appspot.com/x/repro.c?x="))
+	c.expectTrue(strings.Contains(reply.Body, "kernel config:  https://testapp.appspot.com/x/.config?x="))
+
+	// We reply at most once per discussion.
+	c.advanceTime(time.Hour)
+	thread.reply("user2@user.com", "Is there a reproducer?")
+	c.expectNoEmail()
+}
+
+func TestEmailReproRequestNoRepro(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("Bug reported", extBugID)
+	thread.reply(thread.botEmail, "Hello")
+	thread.reply("user@user.com", "Is there a reproducer?")
+	c.expectNoEmail()
+
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	c.expectTrue(bug.NeedsRepro)
+}
+
+func TestReportDiscussion(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.makeClient(clientPublicEmail, keyPublicEmail, false)
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+
+	now := timeNow(c.ctx)
+	valid := func() *dashapi.Discussion {
+		return &dashapi.Discussion{
+			ID:      "review-1",
+			Source:  testDiscussionSource,
+			Type:    dashapi.DiscussionPatch,
+			Subject: "A fix for the bug",
+			BugIDs:  []string{extBugID},
+			Messages: []dashapi.DiscussionMessage{
+				{ID: "review-1", External: true, Time: now},
+			},
+		}
+	}
+	d := valid()
+	d.Source = "unknown"
+	c.expectFail("unknown discussion source", client.ReportDiscussion(d))
+	d = valid()
+	d.BugIDs = []string{"non-existent"}
+	c.expectFail("failed to find bug for non-existent", client.ReportDiscussion(d))
+	// Bugs of other namespaces can't be referenced.
+	c.expectFail("failed to find bug for "+extBugID, c.client.ReportDiscussion(valid()))
+	d = valid()
+	d.Messages[0].Time = time.Time{}
+	c.expectFail("has no time", client.ReportDiscussion(d))
+
+	d = valid()
+	d.Messages = append(d.Messages,
+		dashapi.DiscussionMessage{ID: "review-2", External: true, Time: now},
+		dashapi.DiscussionMessage{ID: "REVIEW-2", External: true, Time: now})
+	c.expectOK(client.ReportDiscussion(d))
+	c.expectDiscussionSummary(extBugID, DiscussionSummary{
+		AllMessages:      2,
+		ExternalMessages: 2,
+		LastMessage:      now,
+		LastPatchMessage: now,
+	})
+
+	// The older save_discussion API does not do the stricter checks.
+	d = valid()
+	d.Messages = []dashapi.DiscussionMessage{{ID: "review-3", External: true}}
+	c.expectOK(client.SaveDiscussion(&dashapi.SaveDiscussionReq{Discussion: d}))
+	c.expectDiscussionSummary(extBugID, DiscussionSummary{
+		AllMessages:      3,
+		ExternalMessages: 3,
+		LastMessage:      now,
+		LastPatchMessage: now,
+	})
+}
+
+func TestValidateDiscussion(t *testing.T) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	var tooMany []dashapi.DiscussionMessage
+	for i := 0; i <= dashapi.MaxDiscussionMessages; i++ {
+		tooMany = append(tooMany, dashapi.DiscussionMessage{ID: fmt.Sprint(i), Time: now})
+	}
+	tests := []struct {
+		d   *dashapi.Discussion
+		err string
+	}{
+		{
+			d:   &dashapi.Discussion{ID: "1", Source: "unknown"},
+			err: `unknown discussion source "unknown"`,
+		},
+		{
+			d: &dashapi.Discussion{
+				Source:   dashapi.DiscussionLore,
+				Messages: []dashapi.DiscussionMessage{{ID: "1", Time: now}},
+			},
+			err: "empty discussion ID",
+		},
+		{
+			d:   &dashapi.Discussion{ID: "1", Source: dashapi.DiscussionLore},
+			err: "no messages",
+		},
+		{
+			d:   &dashapi.Discussion{ID: "1", Source: dashapi.DiscussionLore, Messages: tooMany},
+			err: "too many messages: 101, the limit is 100",
+		},
+		{
+			d: &dashapi.Discussion{
+				ID:       "1",
+				Source:   dashapi.DiscussionLore,
+				Messages: []dashapi.DiscussionMessage{{ID: " ", Time: now}},
+			},
+			err: "empty message ID",
+		},
+		{
+			d: &dashapi.Discussion{
+				ID:       "1",
+				Source:   dashapi.DiscussionLore,
+				Messages: []dashapi.DiscussionMessage{{ID: "1"}},
+			},
+			err: `message "1" has no time`,
+		},
+	}
+	for _, test := range tests {
+		err := validateDiscussion(test.d)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("expected error %q, got %v", test.err, err)
+		}
+	}
+
+	d := &dashapi.Discussion{
+		ID:     "1",
+		Source: dashapi.DiscussionLore,
+		Messages: []dashapi.DiscussionMessage{
+			{ID: "1", Time: now},
+			{ID: "<2>", Time: now},
+			{ID: "2", Time: now.Add(time.Hour)},
+		},
+	}
+	if err := validateDiscussion(d); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&dashapi.Discussion{
+		ID:     "<1>",
+		Source: dashapi.DiscussionLore,
+		Messages: []dashapi.DiscussionMessage{
+			{ID: "<1>", Time: now},
+			{ID: "<2>", Time: now},
+		},
+	}, d); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+// Per-hour quota of testDiscussionSource.
+const testDiscussionQuota = 10
+
+func TestDiscussionQuota(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+
+	report := func(ids ...int) {
+		t.Helper()
+		d := &dashapi.Discussion{
+			ID:      "review-1",
+			Source:  testDiscussionSource,
+			Type:    dashapi.DiscussionPatch,
+			Subject: "A fix for the bug",
+			BugIDs:  []string{extBugID},
+		}
+		for _, id := range ids {
+			d.Messages = append(d.Messages, dashapi.DiscussionMessage{
+				ID:       fmt.Sprintf("review-%d", id),
+				External: true,
+				Time:     timeNow(c.ctx),
+			})
+		}
+		c.expectOK(client.ReportDiscussion(d))
+	}
+	var ids []int
+	for i := 0; i < testDiscussionQuota; i++ {
+		ids = append(ids, i)
+	}
+	report(ids...)
+	// The quota is exhausted, the message must be put aside.
+	report(testDiscussionQuota)
+	expectMessages := func(want int) {
+		t.Helper()
+		bug, _, err := findBugByReportingID(c.ctx, extBugID)
+		c.expectOK(err)
+		c.expectEQ(bug.discussionSummary().AllMessages, want)
+	}
+	expectMessages(testDiscussionQuota)
+
+	quotas, err := loadDiscussionQuotas(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(quotas), 1)
+	c.expectEQ(quotas[0].Messages, testDiscussionQuota)
+	c.expectEQ(quotas[0].Dropped, 1)
+	_, err = c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+
+	// The counters are restored from the persisted copy, if memcache loses them.
+	c.expectOK(memcache.Flush(c.ctx))
+	report(testDiscussionQuota + 1)
+	expectMessages(testDiscussionQuota)
+
+	replayed, err := replayDiscussionSpills(c.ctx, 100)
+	c.expectOK(err)
+	c.expectEQ(replayed, 2)
+	expectMessages(testDiscussionQuota + 2)
+
+	// The next hour has a new quota.
+	c.advanceTime(time.Hour)
+	report(testDiscussionQuota + 2)
+	expectMessages(testDiscussionQuota + 3)
+}
+
+func TestDiscussionMessageOrder(t *testing.T) {
+	base := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := &Discussion{}
+	d.addMessages([]dashapi.DiscussionMessage{
+		{ID: "parent", External: true, Time: base},
+	}, base)
+	// The reply has a Date header 2 hours before its parent (wrong timezone).
+	diff := d.addMessages([]dashapi.DiscussionMessage{
+		{ID: "reply", External: true, Time: base.Add(-2 * time.Hour), Excerpt: "reply text"},
+	}, base.Add(time.Hour))
+	summary := DiscussionSummary{LastMessage: base}
+	summary.merge(diff)
+	// The last activity is the time the reply was received.
+	if !summary.LastMessage.Equal(base.Add(time.Hour)) {
+		t.Fatalf("wrong last activity: %v", summary.LastMessage)
+	}
+	var ids []string
+	for _, m := range d.Messages {
+		ids = append(ids, m.ID)
+	}
+	if diff := cmp.Diff([]string{"parent", "reply"}, ids); diff != "" {
+		t.Fatal(diff)
+	}
+	if last := d.lastMessage(); last.ID != "reply" || !last.Time.Equal(base.Add(-2*time.Hour)) {
+		t.Fatalf("wrong last message: %+v", last)
+	}
+	if d.LastExcerpt != "reply text" {
+		t.Fatalf("wrong excerpt: %q", d.LastExcerpt)
+	}
+
+	// Backfilled messages are ordered by their header time.
+	d.addMessages([]dashapi.DiscussionMessage{
+		{ID: "archived", External: true, Time: base.Add(-30 * 24 * time.Hour)},
+	}, base.Add(2*time.Hour))
+	ids = nil
+	for _, m := range d.Messages {
+		ids = append(ids, m.ID)
+	}
+	if diff := cmp.Diff([]string{"archived", "parent", "reply"}, ids); diff != "" {
+		t.Fatal(diff)
+	}
+	if last := d.lastActivity(); !last.Equal(base.Add(time.Hour)) {
+		t.Fatalf("wrong last activity: %v", last)
+	}
+
+	// The summaries of the older discussions only took the header time into account.
+	d.Summary.LastMessage = base.Add(-2 * time.Hour)
+	if last := d.lastActivity(); !last.Equal(base.Add(time.Hour)) {
+		t.Fatalf("wrong last activity: %v", last)
+	}
+}
+
+func TestDiscussionConsistencyCheck(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+
+	c.expectOK(client.ReportDiscussion(&dashapi.Discussion{
+		ID:      "review-1",
+		Source:  testDiscussionSource,
+		Type:    dashapi.DiscussionPatch,
+		Subject: "A fix for the bug",
+		BugIDs:  []string{extBugID},
+		Messages: []dashapi.DiscussionMessage{
+			{ID: "review-1", External: true, Time: timeNow(c.ctx)},
+			{ID: "review-2", External: true, Time: timeNow(c.ctx)},
+		},
+	}))
+	_, bugKey, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	want := DiscussionSummary{
+		AllMessages:      2,
+		ExternalMessages: 2,
+		LastMessage:      timeNow(c.ctx),
+		LastPatchMessage: timeNow(c.ctx),
+	}
+	corrupt := func(diff int) {
+		t.Helper()
+		bug := new(Bug)
+		c.expectOK(db.Get(c.ctx, bugKey, bug))
+		for i := range bug.DiscussionInfo {
+			bug.DiscussionInfo[i].Summary.AllMessages += diff
+			bug.DiscussionInfo[i].Summary.ExternalMessages += diff
+		}
+		_, err := db.Put(c.ctx, bugKey, bug)
+		c.expectOK(err)
+	}
+	expectMessages := func(want int) {
+		t.Helper()
+		bug := new(Bug)
+		c.expectOK(db.Get(c.ctx, bugKey, bug))
+		c.expectEQ(bug.discussionSummary().AllMessages, want)
+	}
+
+	// A consistent summary is left as is.
+	_, err = c.GET("/cron/check_discussions")
+	c.expectOK(err)
+	mismatches, err := loadDiscussionMismatches(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(mismatches), 0)
+
+	// A small drift is healed.
+	corrupt(1)
+	_, err = c.GET("/cron/check_discussions")
+	c.expectOK(err)
+	expectMessages(2)
+	mismatches, err = loadDiscussionMismatches(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(mismatches), 0)
+
+	// A large one is only reported.
+	corrupt(10)
+	_, err = c.GET("/cron/check_discussions")
+	c.expectOK(err)
+	expectMessages(12)
+	mismatches, err = loadDiscussionMismatches(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(mismatches), 1)
+	c.expectEQ(mismatches[0].BugKey, bugKey.StringID())
+	c.expectEQ(mismatches[0].Source, string(testDiscussionSource))
+	c.expectEQ(mismatches[0].Computed.equal(want), true)
+	reply, err := c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectEQ(bytes.Contains(reply, []byte("Discussion summary mismatches")), true)
+
+	// Once the summary is consistent again, the mismatch is deleted.
+	corrupt(-10)
+	_, err = c.GET("/cron/check_discussions")
+	c.expectOK(err)
+	mismatches, err = loadDiscussionMismatches(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(mismatches), 0)
+
+	// The same happens after an explicit refresh.
+	corrupt(10)
+	_, err = c.GET("/cron/check_discussions")
+	c.expectOK(err)
+	mismatches, err = loadDiscussionMismatches(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(mismatches), 1)
+	c.expectOK(refreshBugDiscussionInfo(c.ctx, bugKey))
+	expectMessages(2)
+	mismatches, err = loadDiscussionMismatches(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(mismatches), 0)
+}
+
+func TestDiscussionCheckLateAttach(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	firstBugID := c.pollEmailExtID()
+	client.ReportCrash(testCrash(build, 2))
+	secondBugID := c.pollEmailExtID()
+
+	first := timeNow(c.ctx)
+	c.expectOK(client.ReportDiscussion(&dashapi.Discussion{
+		ID:      "late-1",
+		Source:  testDiscussionSource,
+		Type:    dashapi.DiscussionPatch,
+		Subject: "A fix for the bug",
+		BugIDs:  []string{firstBugID},
+		Messages: []dashapi.DiscussionMessage{
+			{ID: "late-1", External: true, Time: first},
+			{ID: "late-2", External: true, Time: first},
+			{ID: "late-3", Time: first},
+		},
+	}))
+	// The second bug is only mentioned in a later message.
+	c.advanceTime(time.Hour)
+	second := timeNow(c.ctx)
+	c.expectOK(client.ReportDiscussion(&dashapi.Discussion{
+		ID:       "late-1",
+		Source:   testDiscussionSource,
+		Type:     dashapi.DiscussionPatch,
+		Subject:  "A fix for the bug",
+		BugIDs:   []string{secondBugID},
+		Messages: []dashapi.DiscussionMessage{{ID: "late-4", External: true, Time: second}},
+	}))
+	want := DiscussionSummary{
+		AllMessages:      4,
+		ExternalMessages: 3,
+		LastMessage:      second,
+		LastPatchMessage: second,
+	}
+	// Both bugs count the whole discussion.
+	c.expectDiscussionSummary(firstBugID, want)
+	c.expectDiscussionSummary(secondBugID, want)
+	for _, extID := range []string{firstBugID, secondBugID} {
+		_, bugKey, err := findBugByReportingID(c.ctx, extID)
+		c.expectOK(err)
+		c.expectOK(checkBugDiscussionSummary(c.ctx, bugKey, 0))
+	}
+	mismatches, err := loadDiscussionMismatches(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(mismatches), 0)
+}
+
+func TestDiscussionCheckSample(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	for i := 0; i < 3; i++ {
+		client.ReportCrash(testCrash(build, i))
+		extBugID := c.pollEmailExtID()
+		c.expectOK(client.ReportDiscussion(&dashapi.Discussion{
+			ID:       fmt.Sprintf("sample-%v", i),
+			Source:   testDiscussionSource,
+			Type:     dashapi.DiscussionReport,
+			Subject:  "A bug report",
+			BugIDs:   []string{extBugID},
+			Messages: []dashapi.DiscussionMessage{{ID: fmt.Sprintf("sample-%v", i), Time: timeNow(c.ctx)}},
+		}))
+	}
+	sample := func() []string {
+		t.Helper()
+		keys, err := nextDiscussionCheckSample(c.ctx, 2)
+		c.expectOK(err)
+		var ret []string
+		for _, key := range keys {
+			ret = append(ret, key.StringID())
+		}
+		return ret
+	}
+	// Two consecutive runs cover all bugs and the second one wraps around.
+	first, second := sample(), sample()
+	c.expectEQ(len(first), 2)
+	c.expectEQ(len(second), 2)
+	covered := map[string]bool{}
+	for _, key := range append(first, second...) {
+		covered[key] = true
+	}
+	c.expectEQ(len(covered), 3)
+	c.expectEQ(second[1], first[0])
+}
+
+func TestDiscussionSummaryCanHeal(t *testing.T) {
+	stored := DiscussionSummary{AllMessages: 5, ExternalMessages: 3}
+	tests := []struct {
+		computed  DiscussionSummary
+		threshold int
+		heal      bool
+	}{
+		{DiscussionSummary{AllMessages: 6, ExternalMessages: 3}, 2, true},
+		{DiscussionSummary{AllMessages: 3, ExternalMessages: 3}, 2, false},
+		{DiscussionSummary{AllMessages: 5, ExternalMessages: 4}, 0, false},
+	}
+	for i, test := range tests {
+		if got := stored.canHeal(test.computed, test.threshold); got != test.heal {
+			t.Errorf("test #%d: got %v, want %v", i, got, test.heal)
+		}
+	}
+}
+
+func TestDisputedBug(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+
+	expectDisputed := func(want bool) {
+		t.Helper()
+		bug, _, err := findBugByReportingID(c.ctx, extBugID)
+		c.expectOK(err)
+		c.expectEQ(bug.Disputed, want)
+		page, err := c.AuthGET(AccessPublic, "/access-public-email")
+		c.expectOK(err)
+		c.expectEQ(bytes.Contains(page, []byte(`class="disputed"`)), want)
+	}
+
+	thread := c.incomingThread("Bug reported", extBugID)
+	thread.reply(thread.botEmail, "Hello")
+	c.advanceTime(time.Hour)
+	thread.reply("dev@kernel.org", "This is not a real bug, the reproducer abuses root.")
+	expectDisputed(true)
+
+	// Later replies without any verdict do not change the consensus.
+	c.advanceTime(time.Hour)
+	thread.reply("other@kernel.org", "Thanks for the details.")
+	expectDisputed(true)
+
+	c.advanceTime(time.Hour)
+	thread.reply("other@kernel.org", "Good catch, it's reachable without root as well.")
+	expectDisputed(false)
+
+	c.advanceTime(time.Hour)
+	thread.reply("dev@kernel.org", "No, that's a false positive.")
+	expectDisputed(true)
+
+	// Admins may override the flag.
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	bugPage, err := c.AuthGET(AccessAdmin, bugLink(bug.keyHash()))
+	c.expectOK(err)
+	clearURL := "/admin?action=clear_disputed&id=" + bug.keyHash()
+	c.expectEQ(bytes.Contains(bugPage, []byte(html.EscapeString(clearURL))), true)
+	_, err = c.AuthGET(AccessUser, clearURL)
+	c.expectFailureStatus(err, http.StatusForbidden)
+	checkRedirect(c, AccessAdmin, clearURL, bugLink(bug.keyHash()), http.StatusFound)
+	expectDisputed(false)
+
+	// But a new negative verdict sets it again.
+	c.advanceTime(time.Hour)
+	thread.reply("dev@kernel.org", "Still a false positive, please invalidate.")
+	expectDisputed(true)
+}
+
+func TestBugDiscussionPagination(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+	_, bugKey, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+
+	const count = discussionsPerPage + 5
+	for i := 0; i < count; i++ {
+		source, typ := dashapi.DiscussionLore, dashapi.DiscussionReport
+		if i%5 == 0 {
+			source = testDiscussionSource
+		}
+		if i%2 == 0 {
+			typ = dashapi.DiscussionPatch
+		}
+		c.expectOK(client.ReportDiscussion(&dashapi.Discussion{
+			ID:      fmt.Sprintf("<discussion-%d@test.com>", i),
+			Source:  source,
+			Type:    typ,
+			Subject: fmt.Sprintf("discussion %d", i),
+			BugIDs:  []string{extBugID},
+			Messages: []dashapi.DiscussionMessage{
+				{ID: fmt.Sprintf("<discussion-%d@test.com>", i), External: true, Time: timeNow(c.ctx)},
+			},
+		}))
+		c.advanceTime(time.Hour)
+	}
+
+	// Discussions that only consist of auto-replies are neither shown nor counted.
+	c.expectOK(client.ReportDiscussion(&dashapi.Discussion{
+		ID:      "<auto-reply@test.com>",
+		Source:  dashapi.DiscussionLore,
+		Type:    dashapi.DiscussionPatch,
+		Subject: "auto-reply",
+		BugIDs:  []string{extBugID},
+		Messages: []dashapi.DiscussionMessage{
+			{ID: "<auto-reply@test.com>", External: true, AutoReply: true, Time: timeNow(c.ctx)},
+		},
+	}))
+
+	subjects := func(list []*Discussion) []string {
+		var ret []string
+		for _, d := range list {
+			ret = append(ret, d.Subject)
+		}
+		return ret
+	}
+	var want []string
+	for i := count - 1; i >= 0; i-- {
+		want = append(want, fmt.Sprintf("discussion %d", i))
+	}
+	first, next, err := loadBugDiscussionPage(c.ctx, bugKey, "", "", "")
+	c.expectOK(err)
+	c.expectNE(next, "")
+	second, last, err := loadBugDiscussionPage(c.ctx, bugKey, "", "", next)
+	c.expectOK(err)
+	c.expectEQ(last, "")
+	if diff := cmp.Diff(want, append(subjects(first), subjects(second)...)); diff != "" {
+		t.Fatal(diff)
+	}
+
+	patches, next, err := loadBugDiscussionPage(c.ctx, bugKey, string(testDiscussionSource),
+		string(dashapi.DiscussionPatch), "")
+	c.expectOK(err)
+	c.expectEQ(next, "")
+	c.expectEQ(subjects(patches), []string{"discussion 20", "discussion 10", "discussion 0"})
+
+	page, err := c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectEQ(bytes.Contains(page, []byte(fmt.Sprintf("Discussions (%d)", count))), true)
+	c.expectEQ(bytes.Contains(page, []byte("next page")), true)
+	c.expectEQ(bytes.Contains(page, []byte("discussion 4<")), false)
+	page, err = c.AuthGET(AccessPublic, "/bug?extid="+extBugID+"&discussion_type=patch")
+	c.expectOK(err)
+	c.expectEQ(bytes.Contains(page, []byte("Discussions (13)")), true)
+	c.expectEQ(bytes.Contains(page, []byte("next page")), false)
+	_, err = c.AuthGET(AccessPublic, "/bug?extid="+extBugID+"&discussion_cursor=garbage")
+	c.expectNE(err, nil)
+}
+
+func TestEmailAttachmentReason(t *testing.T) {
+	msg := &email.Email{
+		BugIDs:     []string{"1111", "2222", "3333", "4444"},
+		BodyBugIDs: []string{"2222", "3333", "4444"},
+		Body: `Fix the crash.
+
+> Reported-by: syzbot+4444@testapp.appspotmail.com
+Reported-by: syzbot+2222@testapp.appspotmail.com
+Link: https://testapp.appspot.com/bug?extid=3333
+`,
+	}
+	for id, want := range map[string]dashapi.AttachmentReason{
+		"1111": dashapi.AttachAddress,
+		"2222": dashapi.AttachReportedBy,
+		"3333": dashapi.AttachBody,
+		"4444": dashapi.AttachBody,
+	} {
+		if got := emailAttachmentReason(msg, id); got != want {
+			t.Errorf("%v: got %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestDiscussionAttachBug(t *testing.T) {
+	// The entity was saved before the reasons were recorded.
+	d := &Discussion{BugKeys: []string{"bug1", "bug2"}}
+	d.attachBug("bug3", dashapi.AttachTitle)
+	d.attachBug("bug2", dashapi.AttachBody)
+	// Weaker reasons do not override stronger ones.
+	d.attachBug("bug2", dashapi.AttachTitle)
+	d.attachBug("bug3", dashapi.AttachAddress)
+	d.moveBug("bug1", "bug4")
+	// The stronger reason survives when two attached bugs become the same.
+	d.moveBug("bug3", "bug2")
+	if diff := cmp.Diff([]string{"bug4", "bug2"}, d.BugKeys); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff([]string{"unknown", "address"}, d.BugReasons); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := d.attachmentReason("bug1"); got != dashapi.AttachUnknown {
+		t.Fatalf("got %q for a detached bug", got)
+	}
+}
+
+func TestDiscussionAttachmentReasons(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+	reportedBy, err := email.AddAddrContext(ownEmail(c.ctx), extBugID)
+	c.expectOK(err)
+
+	// The bug is only mentioned in the tag.
+	_, err = c.POST("/_ah/mail/lore@email.com", fmt.Sprintf(`Date: Tue, 15 Aug 2017 14:59:00 -0700
+Message-ID: <patch@kernel.org>
+Subject: [PATCH] fix the crash
+From: dev@kernel.org
+To: lore@email.com
+Content-Type: text/plain
+
+Reported-by: %v
+`, reportedBy))
+	c.expectOK(err)
+	c.expectOK(client.SaveDiscussion(&dashapi.SaveDiscussionReq{
+		Discussion: &dashapi.Discussion{
+			ID:      "<review@kernel.org>",
+			Source:  dashapi.DiscussionLore,
+			Type:    dashapi.DiscussionReport,
+			Subject: "Review",
+			BugIDs:  []string{extBugID},
+			Messages: []dashapi.DiscussionMessage{
+				{ID: "<review@kernel.org>", External: true, Time: timeNow(c.ctx)},
+			},
+		},
+	}))
+	// Bogus reasons are rejected.
+	err = client.SaveDiscussion(&dashapi.SaveDiscussionReq{
+		Discussion: &dashapi.Discussion{
+			ID:         "<other@kernel.org>",
+			Source:     dashapi.DiscussionLore,
+			Type:       dashapi.DiscussionReport,
+			BugIDs:     []string{extBugID},
+			BugReasons: map[string]dashapi.AttachmentReason{extBugID: "guess"},
+			Messages: []dashapi.DiscussionMessage{
+				{ID: "<other@kernel.org>", External: true, Time: timeNow(c.ctx)},
+			},
+		},
+	})
+	c.expectNE(err, nil)
+
+	info, err := client.LoadFullBug(&dashapi.LoadFullBugReq{BugID: extBugID})
+	c.expectOK(err)
+	reasons := map[string]dashapi.AttachmentReason{}
+	for _, d := range info.Discussions {
+		reasons[d.Subject] = d.Reason
+	}
+	c.expectEQ(reasons, map[string]dashapi.AttachmentReason{
+		"[PATCH] fix the crash": dashapi.AttachReportedBy,
+		"Review":                dashapi.AttachAPI,
+	})
+	page, err := c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(`title="the Reported-by tag mentions the bug">reported-by</span>`)))
+}
+
+// bugPageDiscussions returns the discussions shown on the first page of the bug page.
+func (c *Ctx) bugPageDiscussions(bug *Bug) ([]*uiBugDiscussion, error) {
+	r := httptest.NewRequest("GET", "/bug?id="+bug.keyHash(), nil)
+	list, _, err := getBugDiscussionPageUI(c.ctx, r, bug)
+	if err != nil {
+		return nil, err
+	}
+	return list.Discussions, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Many new bugs are near-duplicates of open bugs with slightly different titles (e.g. a different
+// access type or a different lock name in the same function). When a bug is created, it's compared
+// with the open bugs of the namespace and the most similar ones are remembered in Bug.DupCandidates.
+// The candidates are only mentioned in the report and on the bug page, the bug is never
+// marked as a duplicate automatically.
+
+const (
+	// dupCandidateThreshold is the minimal bugSimilarity score of a candidate.
+	dupCandidateThreshold = 0.6
+	maxDupCandidates      = 3
+)
+
+var (
+	titleTokenRe = regexp.MustCompile(`[a-z0-9_]+`)
+	// Tokens that are specific to a crash instance rather than to the bug: numbers,
+	// addresses and lock class suffixes.
+	volatileTokenRe = regexp.MustCompile(`^(?:[0-9]+|0x[0-9a-f]+|[0-9a-f]{8,})$`)
+	titleStopWords  = map[string]bool{
+		"a":   true,
+		"at":  true,
+		"in":  true,
+		"of":  true,
+		"on":  true,
+		"the": true,
+	}
+)
+
+// titleTokens returns the set of the normalized title words.
+func titleTokens(title string) map[string]bool {
+	ret := make(map[string]bool)
+	for _, token := range titleTokenRe.FindAllString(strings.ToLower(title), -1) {
+		if titleStopWords[token] || volatileTokenRe.MatchString(token) {
+			continue
+		}
+		ret[token] = true
+	}
+	return ret
+}
+
+func jaccardIndex(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for item := range a {
+		if b[item] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+func stringSet(list []string) map[string]bool {
+	ret := make(map[string]bool)
+	for _, item := range list {
+		ret[item] = true
+	}
+	return ret
+}
+
+// titleSimilarity compares the crash kinds and the crash locations of the titles separately,
+// as most titles look like "<kind> in <function>" and both parts are equally important.
+func titleSimilarity(a, b string) float64 {
+	kindA, locA := splitTitle(a)
+	kindB, locB := splitTitle(b)
+	kind := jaccardIndex(titleTokens(kindA), titleTokens(kindB))
+	if locA == "" && locB == "" {
+		return kind
+	}
+	return (kind + jaccardIndex(titleTokens(locA), titleTokens(locB))) / 2
+}
+
+func splitTitle(title string) (string, string) {
+	pos := strings.LastIndex(title, " in ")
+	if pos == -1 {
+		return title, ""
+	}
+	return title[:pos], title[pos+len(" in "):]
+}
+
+// bugSimilarity returns the similarity score of two crashes in the [0, 1] range.
+// It's the mean of the title similarity and of the Jaccard index of the top call trace frames,
+// so the crashes must both have similar titles and happen in the same place to score high.
+// The function is symmetric and does not depend on the order of the frames.
+func bugSimilarity(titleA string, framesA []string, titleB string, framesB []string) float64 {
+	return (titleSimilarity(titleA, titleB) + jaccardIndex(stringSet(framesA), stringSet(framesB))) / 2
+}
+
+type dupCandidate struct {
+	hash  string
+	score float64
+}
+
+// selectDupCandidates returns the hashes of the most similar bugs, the best ones first.
+func selectDupCandidates(title string, frames []string, bugs []*Bug) []string {
+	var candidates []dupCandidate
+	for _, bug := range bugs {
+		score := bugSimilarity(title, frames, bug.Title, bug.TopFrames)
+		if score < dupCandidateThreshold {
+			continue
+		}
+		candidates = append(candidates, dupCandidate{bug.keyHash(), score})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].hash < candidates[j].hash
+	})
+	var ret []string
+	for i := 0; i < len(candidates) && i < maxDupCandidates; i++ {
+		ret = append(ret, candidates[i].hash)
+	}
+	return ret
+}
+
+// findDupCandidates returns the hashes of the open bugs that the new crash may be a duplicate of.
+func findDupCandidates(c context.Context, ns, title string, frames []string) ([]string, error) {
+	if len(frames) == 0 {
+		// Titles alone never reach the threshold.
+		return nil, nil
+	}
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("Status=", BugStatusOpen).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open bugs: %w", err)
+	}
+	ret := selectDupCandidates(title, frames, bugs)
+	if len(ret) != 0 {
+		log.Infof(c, "%v: %q may be a duplicate of %q", ns, title, ret)
+	}
+	return ret, nil
+}
+
+// loadDupCandidates returns the dup candidates of the bug that are visible at the access level.
+func loadDupCandidates(c context.Context, bug *Bug, accessLevel AccessLevel) ([]*Bug, error) {
+	var ret []*Bug
+	for _, hash := range bug.DupCandidates {
+		other := new(Bug)
+		if err := db.Get(c, db.NewKey(c, "Bug", hash, 0, nil), other); err != nil {
+			if err == db.ErrNoSuchEntity {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get bug %v: %w", hash, err)
+		}
+		if accessLevel < other.sanitizeAccess(accessLevel) {
+			continue
+		}
+		ret = append(ret, other)
+	}
+	return ret, nil
+}
+
+func bugDupCandidates(c context.Context, bug *Bug, accessLevel AccessLevel) ([]dashapi.BugLink, error) {
+	bugs, err := loadDupCandidates(c, bug, accessLevel)
+	if err != nil {
+		return nil, err
+	}
+	var ret []dashapi.BugLink
+	for _, other := range bugs {
+		ret = append(ret, dashapi.BugLink{
+			Title: other.displayTitle(),
+			Link:  appURL(c) + bugLink(other.keyHash()),
+		})
+	}
+	return ret, nil
+}
+
+func makeDupCandidatesUI(c context.Context, bug *Bug, accessLevel AccessLevel) ([]*uiSimilarBug, error) {
+	bugs, err := loadDupCandidates(c, bug, accessLevel)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*uiSimilarBug
+	for _, other := range bugs {
+		ret = append(ret, &uiSimilarBug{
+			Namespace: other.Namespace,
+			Title:     other.displayTitle(),
+			Link:      bugLink(other.keyHash()),
+			Status:    similarBugStatus(other),
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+func TestBugSimilarity(t *testing.T) {
+	type crash struct {
+		title  string
+		frames []string
+	}
+	tests := []struct {
+		a, b crash
+		dup  bool
+	}{
+		// Different access types of the same memory corruption.
+		{
+			a: crash{"KASAN: use-after-free Read in ext4_xattr_set_entry",
+				[]string{"ext4_xattr_set_entry", "ext4_xattr_ibody_set", "ext4_xattr_set_handle"}},
+			b: crash{"KASAN: slab-out-of-bounds Read in ext4_xattr_set_entry",
+				[]string{"ext4_xattr_set_entry", "ext4_xattr_ibody_set", "ext4_xattr_set_handle"}},
+			dup: true,
+		},
+		{
+			a: crash{"KASAN: use-after-free Write in hci_conn_del",
+				[]string{"hci_conn_del", "hci_abort_conn_sync", "hci_cmd_sync_work"}},
+			b: crash{"KASAN: use-after-free Read in hci_conn_del",
+				[]string{"hci_conn_del", "hci_conn_failed", "hci_abort_conn_sync"}},
+			dup: true,
+		},
+		// The same NULL dereference reported by different tools.
+		{
+			a: crash{"general protection fault in rds_recv_rcvbuf_delta",
+				[]string{"rds_recv_rcvbuf_delta", "rds_recv_incoming", "rds_loop_xmit"}},
+			b: crash{"KASAN: null-ptr-deref Read in rds_recv_rcvbuf_delta",
+				[]string{"rds_recv_rcvbuf_delta", "rds_recv_incoming", "rds_loop_xmit"}},
+			dup: true,
+		},
+		// Different lockdep reports about the same lock.
+		{
+			a: crash{"possible deadlock in ext4_xattr_set_handle",
+				[]string{"ext4_xattr_set_handle", "ext4_set_acl", "set_posix_acl"}},
+			b: crash{"inconsistent lock state in ext4_xattr_set_handle",
+				[]string{"ext4_xattr_set_handle", "ext4_set_acl", "set_posix_acl"}},
+			dup: true,
+		},
+		// A data race with a different second access.
+		{
+			a: crash{"KCSAN: data-race in __filemap_add_folio / filemap_map_pages",
+				[]string{"filemap_map_pages", "do_read_fault", "do_fault"}},
+			b: crash{"KCSAN: data-race in filemap_map_pages / page_cache_delete",
+				[]string{"filemap_map_pages", "do_read_fault", "do_fault"}},
+			dup: true,
+		},
+		// Only the lock class suffix is different.
+		{
+			a: crash{"WARNING: bad unlock balance in sch_direct_xmit#2",
+				[]string{"sch_direct_xmit", "__dev_queue_xmit", "packet_snd"}},
+			b: crash{"WARNING: bad unlock balance in sch_direct_xmit#10",
+				[]string{"sch_direct_xmit", "__dev_queue_xmit", "ip_finish_output2"}},
+			dup: true,
+		},
+		// Same title words, but different functions and call traces.
+		{
+			a: crash{"KASAN: use-after-free Read in tcp_retransmit_timer",
+				[]string{"tcp_retransmit_timer", "tcp_write_timer_handler", "tcp_write_timer"}},
+			b: crash{"KASAN: use-after-free Read in tcp_write_timer",
+				[]string{"tcp_write_timer", "call_timer_fn", "run_timer_softirq"}},
+			dup: false,
+		},
+		// Hung tasks share the scheduler frames, but wait for different things.
+		{
+			a: crash{"INFO: task hung in lock_sock_nested",
+				[]string{"__schedule", "schedule", "lock_sock_nested"}},
+			b: crash{"INFO: task hung in rtnl_lock",
+				[]string{"__schedule", "schedule", "schedule_preempt_disabled"}},
+			dup: false,
+		},
+		// Deadlocks in different functions.
+		{
+			a: crash{"possible deadlock in ext4_xattr_set_handle",
+				[]string{"ext4_xattr_set_handle", "ext4_set_acl", "set_posix_acl"}},
+			b: crash{"possible deadlock in ext4_xattr_get",
+				[]string{"ext4_xattr_get", "ext4_xattr_set_handle", "ext4_set_acl"}},
+			dup: false,
+		},
+		// Different bugs in the same function.
+		{
+			a: crash{"WARNING in __queue_work",
+				[]string{"__queue_work", "queue_work_on", "hci_cmd_timeout"}},
+			b: crash{"KMSAN: uninit-value in __queue_work",
+				[]string{"__queue_work", "delayed_work_timer_fn", "call_timer_fn"}},
+			dup: false,
+		},
+		// The same call trace, but unrelated titles.
+		{
+			a: crash{"kernel BUG in ext4_write_inline_data",
+				[]string{"ext4_write_inline_data", "ext4_write_inline_data_end", "ext4_da_write_end"}},
+			b: crash{"WARNING in ext4_da_write_end",
+				[]string{"ext4_write_inline_data", "ext4_write_inline_data_end", "ext4_da_write_end"}},
+			dup: false,
+		},
+		// No call traces.
+		{
+			a:   crash{"KASAN: use-after-free Read in nbd_genl_connect", nil},
+			b:   crash{"KASAN: slab-use-after-free Read in nbd_genl_connect", nil},
+			dup: false,
+		},
+	}
+	for i, test := range tests {
+		score := bugSimilarity(test.a.title, test.a.frames, test.b.title, test.b.frames)
+		reverse := bugSimilarity(test.b.title, test.b.frames, test.a.title, test.a.frames)
+		if score != reverse {
+			t.Errorf("#%v: the score is not symmetric: %v vs %v", i, score, reverse)
+		}
+		if dup := score >= dupCandidateThreshold; dup != test.dup {
+			t.Errorf("#%v: %q vs %q: score %.2f, want dup=%v", i, test.a.title, test.b.title, score, test.dup)
+		}
+	}
+}
+
+func TestSelectDupCandidates(t *testing.T) {
+	frames := []string{"foo", "bar", "baz"}
+	var bugs []*Bug
+	for _, title := range []string{
+		"KASAN: use-after-free Read in foo",
+		"KASAN: use-after-free Write in foo",
+		"KASAN: slab-out-of-bounds Write in foo",
+		"KASAN: slab-out-of-bounds Read in foo",
+		"WARNING in qux",
+	} {
+		bugs = append(bugs, &Bug{Namespace: "test1", Title: title, TopFrames: frames})
+	}
+	got := selectDupCandidates("KASAN: use-after-free Write in foo", frames, bugs)
+	want := []string{bugs[1].keyHash(), bugs[0].keyHash(), bugs[2].keyHash()}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+	// The result does not depend on the order of the bugs.
+	for i, j := 0, len(bugs)-1; i < j; i, j = i+1, j-1 {
+		bugs[i], bugs[j] = bugs[j], bugs[i]
+	}
+	if diff := cmp.Diff(want, selectDupCandidates("KASAN: use-after-free Write in foo", frames, bugs)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestDupCandidatesTemplate(t *testing.T) {
+	body := new(bytes.Buffer)
+	err := mailTemplates.ExecuteTemplate(body, "mail_bug.txt", &dashapi.BugReport{
+		First:             true,
+		Link:              "https://testapp.appspot.com/bug?extid=abcd",
+		KernelCommit:      "1234567890abcdef",
+		KernelCommitTitle: "Merge tag 'net-6.6-rc5'",
+		KernelRepoAlias:   "upstream",
+		CreditEmail:       "syzbot+abcd@testapp.appspotmail.com",
+		Report:            []byte("KASAN: slab-out-of-bounds Read in foo\n"),
+		NoRepro:           true,
+		DupCandidates: []dashapi.BugLink{
+			{Title: "KASAN: use-after-free Read in foo", Link: "https://testapp.appspot.com/bug?id=1234"},
+			{Title: "KASAN: use-after-free Write in foo (2)", Link: "https://testapp.appspot.com/bug?id=5678"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "dup_candidates", "mail_bug.txt")
+	if *flagUpdate {
+		if err := osutil.MkdirAll(filepath.Dir(golden)); err != nil {
+			t.Fatal(err)
+		}
+		if err := osutil.WriteFile(golden, body.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), body.String()); diff != "" {
+		t.Fatalf("report mismatch (-want +got), run with -update if it's expected:\n%s", diff)
+	}
+}
+
+func TestDupCandidates(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash1 := testCrash(build, 1)
+	crash1.Title = "KASAN: use-after-free Read in foo_bar"
+	crash1.Report = []byte(similarTestReport)
+	c.client.ReportCrash(crash1)
+	rep1 := c.client.pollBug()
+	c.expectEQ(len(rep1.DupCandidates), 0)
+	bug1, _, _ := c.loadBug(rep1.ID)
+
+	// Same call trace, but an unrelated title.
+	crash2 := testCrash(build, 2)
+	crash2.Title = "WARNING in qux"
+	crash2.Report = []byte(similarTestReport)
+	c.client.ReportCrash(crash2)
+	rep2 := c.client.pollBug()
+	c.expectEQ(len(rep2.DupCandidates), 0)
+
+	crash3 := testCrash(build, 3)
+	crash3.Title = "KASAN: slab-out-of-bounds Read in foo_bar"
+	crash3.Report = []byte(similarTestReport)
+	c.client.ReportCrash(crash3)
+	rep3 := c.client.pollBug()
+	c.expectEQ(rep3.DupCandidates, []dashapi.BugLink{{
+		Title: crash1.Title,
+		Link:  "https://testapp.appspot.com" + bugLink(bug1.keyHash()),
+	}})
+
+	// Nothing is changed automatically.
+	bug1, _, _ = c.loadBug(rep1.ID)
+	bug3, _, _ := c.loadBug(rep3.ID)
+	c.expectEQ(bug1.Status, BugStatusOpen)
+	c.expectEQ(bug3.Status, BugStatusOpen)
+
+	page, err := c.AuthGET(AccessUser, bugLink(bug3.keyHash()))
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Possibly duplicate of:"))
+	c.expectTrue(strings.Contains(string(page), crash1.Title))
+
+	// Once the bug is closed, the candidates are not shown.
+	c.client.updateBug(rep3.ID, dashapi.BugStatusDup, rep1.ID)
+	page, err = c.AuthGET(AccessUser, bugLink(bug3.keyHash()))
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), "Possibly duplicate of:"))
+}
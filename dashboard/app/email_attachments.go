@@ -0,0 +1,179 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Incoming emails may be huge (e.g. a patch series or a full console log attached), and App Engine
+// instances have little memory. So the emails are parsed as a stream: only a prefix of the body is
+// kept and the large attachments are moved to EmailAttachment entities right away.
+// The stored attachments are referenced from email.OversizedAttachment.Ref, so that the commands
+// can still use them (e.g. "#syz test" with a large patch). If an attachment does not fit even
+// into the storage, it's marked as truncated and the command gets a clear error reply.
+// The attachments are only needed while the email is being processed, so they are deleted
+// after emailAttachmentTTL. Once the email is matched to a bug, its attachments record the bug
+// namespace, so that they are also deleted together with the namespace.
+
+var incomingEmailLimits = email.Limits{
+	MaxBody:       1 << 20,
+	MaxAttachment: 2 << 20,
+}
+
+const (
+	// Same as the limits of putText, so that a stored patch can be saved as the job patch as is.
+	maxEmailAttachmentLen        = 10 << 20
+	maxEmailAttachmentCompressed = 1000 << 10 // datastore entity limit is 1MB
+	emailAttachmentTTL           = 30 * 24 * time.Hour
+)
+
+// EmailAttachment is a large attachment of an incoming email.
+type EmailAttachment struct {
+	Name      string
+	Namespace string // empty if the email was not matched to a bug
+	Time      time.Time
+	Size      int64  `datastore:",noindex"` // uncompressed size
+	Data      []byte `datastore:",noindex"` // gzip-compressed
+}
+
+func incomingEmailLimitsFor(c context.Context) email.Limits {
+	limits := incomingEmailLimits
+	limits.Store = func(name string, r io.Reader) (string, bool) {
+		return storeEmailAttachment(c, name, r)
+	}
+	return limits
+}
+
+// storeEmailAttachment saves the attachment and returns its reference.
+// The returned bool is set if the attachment did not fit into the storage, in such case nothing is saved.
+func storeEmailAttachment(c context.Context, name string, r io.Reader) (string, bool) {
+	b := new(bytes.Buffer)
+	z, _ := gzip.NewWriterLevel(&limitedWriter{w: b, left: maxEmailAttachmentCompressed}, gzip.BestCompression)
+	size, err := io.Copy(z, io.LimitReader(r, maxEmailAttachmentLen+1))
+	if err == nil {
+		err = z.Close()
+	}
+	if err == errWriteLimit || size > maxEmailAttachmentLen {
+		log.Warningf(c, "email attachment %q is too large to store", name)
+		return "", true
+	}
+	if err != nil {
+		log.Errorf(c, "failed to read email attachment %q: %v", name, err)
+		return "", true
+	}
+	attachment := &EmailAttachment{
+		Name: name,
+		Time: timeNow(c),
+		Size: size,
+		Data: b.Bytes(),
+	}
+	key, err := db.Put(c, db.NewIncompleteKey(c, "EmailAttachment", nil), attachment)
+	if err != nil {
+		log.Errorf(c, "failed to save email attachment %q: %v", name, err)
+		return "", true
+	}
+	return fmt.Sprint(key.IntID()), false
+}
+
+func emailAttachmentKey(c context.Context, ref string) (*db.Key, error) {
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad email attachment reference %q", ref)
+	}
+	return db.NewKey(c, "EmailAttachment", "", id, nil), nil
+}
+
+// setEmailAttachmentsNamespace records the namespace of the bug the email was matched to
+// in the stored attachments of the email.
+func setEmailAttachmentsNamespace(c context.Context, msg *email.Email, ns string) {
+	var keys []*db.Key
+	for _, oversized := range msg.Oversized {
+		if oversized.Ref == "" {
+			continue
+		}
+		key, err := emailAttachmentKey(c, oversized.Ref)
+		if err != nil {
+			log.Errorf(c, "%v", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	attachments := make([]*EmailAttachment, len(keys))
+	if err := db.GetMulti(c, keys, attachments); err != nil {
+		log.Errorf(c, "failed to get email attachments: %v", err)
+		return
+	}
+	for _, attachment := range attachments {
+		attachment.Namespace = ns
+	}
+	if _, err := db.PutMulti(c, keys, attachments); err != nil {
+		log.Errorf(c, "failed to save email attachments: %v", err)
+	}
+}
+
+func loadEmailAttachment(c context.Context, ref string) ([]byte, error) {
+	key, err := emailAttachmentKey(c, ref)
+	if err != nil {
+		return nil, err
+	}
+	id := key.IntID()
+	attachment := new(EmailAttachment)
+	if err := db.Get(c, key, attachment); err != nil {
+		return nil, fmt.Errorf("failed to get email attachment %v: %w", id, err)
+	}
+	d, err := gzip.NewReader(bytes.NewReader(attachment.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email attachment %v: %w", id, err)
+	}
+	data, err := io.ReadAll(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email attachment %v: %w", id, err)
+	}
+	return data, nil
+}
+
+func deleteOldEmailAttachments(c context.Context) error {
+	keys, err := db.NewQuery("EmailAttachment").
+		Filter("Time<", timeNow(c).Add(-emailAttachmentTTL)).
+		KeysOnly().
+		GetAll(c, nil)
+	if err != nil {
+		return fmt.Errorf("failed to query email attachments: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	log.Infof(c, "deleting %v old email attachments", len(keys))
+	return db.DeleteMulti(c, keys)
+}
+
+var errWriteLimit = errors.New("write limit exceeded")
+
+type limitedWriter struct {
+	w    io.Writer
+	left int
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > lw.left {
+		return 0, errWriteLimit
+	}
+	lw.left -= len(p)
+	return lw.w.Write(p)
+}
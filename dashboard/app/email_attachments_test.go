@@ -0,0 +1,97 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func largeTestPatch(lines int, line func(i int) string) string {
+	var patch strings.Builder
+	patch.WriteString("--- a/mm/kasan/kasan.c\n+++ b/mm/kasan/kasan.c\n@@ -1,1 +1,1 @@\n")
+	for i := 0; i < lines; i++ {
+		patch.WriteString("+" + line(i) + "\n")
+	}
+	return patch.String()
+}
+
+func TestLargeEmailPatch(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrashWithRepro(build, 1))
+	sender := c.pollEmailBug().Sender
+
+	// A multi-megabyte patch that compresses well is stored and tested.
+	patch := largeTestPatch(200000, func(i int) string {
+		return fmt.Sprintf("\tcurrent->kasan_depth += %v;", i%10)
+	})
+	c.expectTrue(len(patch) > 2*incomingEmailLimits.MaxAttachment)
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch\n",
+		EmailOptFrom("test@requester.com"), EmailOptAttachment(patch))
+	c.expectNoEmail()
+	resp := client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{TestPatches: true})
+	c.expectEQ(resp.Type, dashapi.JobTestPatch)
+	c.expectEQ(string(resp.Patch), email.ParsePatch([]byte(patch)))
+
+	// An incompressible patch does not fit into the storage, the command gets an error reply.
+	rnd := rand.New(rand.NewSource(0))
+	patch = largeTestPatch(50000, func(i int) string {
+		return fmt.Sprintf("\t%016x%016x%016x%016x;", rnd.Uint64(), rnd.Uint64(), rnd.Uint64(), rnd.Uint64())
+	})
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch\n",
+		EmailOptFrom("test@requester.com"), EmailOptAttachment(patch), EmailOptMessageID(2))
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.To, []string{"test@requester.com"})
+	c.expectTrue(strings.Contains(msg.Body, "is too large"))
+	c.expectTrue(strings.Contains(msg.Body, "was truncated"))
+	resp = client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{TestPatches: true})
+	c.expectEQ(resp.ID, "")
+
+	// The stored attachments are eventually deleted.
+	count := func() int {
+		keys, err := db.NewQuery("EmailAttachment").KeysOnly().GetAll(c.ctx, nil)
+		c.expectOK(err)
+		return len(keys)
+	}
+	c.expectEQ(count(), 1)
+	// The attachment is deleted together with the namespace of the bug.
+	var attachments []*EmailAttachment
+	_, err := db.NewQuery("EmailAttachment").GetAll(c.ctx, &attachments)
+	c.expectOK(err)
+	c.expectEQ(attachments[0].Namespace, "access-public-email")
+	c.advanceTime(emailAttachmentTTL + time.Hour)
+	c.expectOK(deleteOldEmailAttachments(c.ctx))
+	c.expectEQ(count(), 0)
+}
+
+func TestLargeEmailCommand(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	sender := c.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	// A huge attached log does not prevent the command from being processed.
+	log := strings.Repeat("[  123.456789] some kernel log line\n", 100000)
+	c.incomingEmail(sender, "#syz invalid\n", EmailOptAttachment(log))
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.Status, BugStatusInvalid)
+}
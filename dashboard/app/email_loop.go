@@ -0,0 +1,305 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	aemail "google.golang.org/appengine/v2/mail"
+	"google.golang.org/appengine/v2/memcache"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Some autoresponders reply to every single email they get, and if syzbot processes
+// and answers the replies, the two end up in a loop. Auto-generated incoming emails
+// (see email.Email.AutoReply) are counted per sender in a sliding window of
+// EmailLoopConfig.Window. Once a sender exceeds the threshold, the sender is quarantined:
+// all further emails of the sender are only stored as QuarantinedEmail entities and
+// are not processed at all, and the admins are alerted. Admins review and release
+// the quarantined senders on the admin page.
+// The windows are kept in memcache. If memcache is not available, the smaller
+// EmailSenderWindow entities are used instead.
+
+// Only the beginning of the quarantined emails is kept.
+const maxQuarantinedBody = 16 << 10
+
+// quarantineEmail returns true if the email must not be processed because its sender is quarantined.
+func quarantineEmail(c context.Context, msg *email.Email) bool {
+	sender := email.CanonicalEmail(msg.Author)
+	if sender == "" || sender == email.CanonicalEmail(ownEmail(c)) {
+		return false
+	}
+	quarantined, err := isSenderQuarantined(c, sender)
+	if err != nil {
+		log.Errorf(c, "failed to check email quarantine: %v", err)
+		return false
+	}
+	if !quarantined {
+		if !msg.AutoReply {
+			return false
+		}
+		count, err := countSenderEmail(c, sender, timeNow(c))
+		if err != nil {
+			log.Errorf(c, "failed to count emails of %v: %v", sender, err)
+			return false
+		}
+		if count <= config.EmailLoop.Threshold {
+			return false
+		}
+		reason := fmt.Sprintf("%v auto-generated emails within %v", count, config.EmailLoop.Window)
+		if err := quarantineSender(c, sender, reason); err != nil {
+			log.Errorf(c, "failed to quarantine %v: %v", sender, err)
+			return false
+		}
+	}
+	log.Warningf(c, "quarantining email %q from %v", msg.MessageID, sender)
+	if err := storeQuarantinedEmail(c, sender, msg); err != nil {
+		log.Errorf(c, "failed to store quarantined email: %v", err)
+	}
+	return true
+}
+
+func quarantinedSenderKey(c context.Context, sender string) *db.Key {
+	return db.NewKey(c, "QuarantinedSender", sender, 0, nil)
+}
+
+func isSenderQuarantined(c context.Context, sender string) (bool, error) {
+	qs := new(QuarantinedSender)
+	if err := db.Get(c, quarantinedSenderKey(c, sender), qs); err != nil {
+		if err == db.ErrNoSuchEntity {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get quarantined sender: %w", err)
+	}
+	return qs.Released.IsZero(), nil
+}
+
+// countSenderEmail records an auto-generated email of the sender and returns
+// the number of such emails within the window.
+func countSenderEmail(c context.Context, sender string, now time.Time) (int, error) {
+	window := config.EmailLoop.Window
+	key := "email-loop-" + sender
+	update := func(times []time.Time) []time.Time {
+		var ret []time.Time
+		for _, t := range times {
+			if now.Sub(t) < window {
+				ret = append(ret, t)
+			}
+		}
+		return append(ret, now)
+	}
+	const attempts = 3
+	for i := 0; i < attempts; i++ {
+		var times []time.Time
+		item, err := memcache.Gob.Get(c, key, &times)
+		if err != nil && err != memcache.ErrCacheMiss {
+			log.Warningf(c, "memcache is not available, falling back to datastore: %v", err)
+			return countSenderEmailDB(c, sender, update)
+		}
+		times = update(times)
+		if item == nil {
+			item = &memcache.Item{Key: key}
+		}
+		item.Object = times
+		item.Expiration = window
+		if err == memcache.ErrCacheMiss {
+			err = memcache.Gob.Add(c, item)
+		} else {
+			err = memcache.Gob.CompareAndSwap(c, item)
+		}
+		if err == nil {
+			return len(times), nil
+		}
+		if err != memcache.ErrNotStored && err != memcache.ErrCASConflict {
+			log.Warningf(c, "memcache is not available, falling back to datastore: %v", err)
+			return countSenderEmailDB(c, sender, update)
+		}
+	}
+	return countSenderEmailDB(c, sender, update)
+}
+
+func countSenderEmailDB(c context.Context, sender string, update func([]time.Time) []time.Time) (int, error) {
+	count := 0
+	key := db.NewKey(c, "EmailSenderWindow", sender, 0, nil)
+	tx := func(c context.Context) error {
+		window := new(EmailSenderWindow)
+		if err := db.Get(c, key, window); err != nil && err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get email sender window: %w", err)
+		}
+		window.Times = update(window.Times)
+		count = len(window.Times)
+		if _, err := db.Put(c, key, window); err != nil {
+			return fmt.Errorf("failed to put email sender window: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func quarantineSender(c context.Context, sender, reason string) error {
+	key := quarantinedSenderKey(c, sender)
+	added := false
+	tx := func(c context.Context) error {
+		qs := new(QuarantinedSender)
+		if err := db.Get(c, key, qs); err != nil && err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get quarantined sender: %w", err)
+		}
+		if !qs.Time.IsZero() && qs.Released.IsZero() {
+			return nil
+		}
+		*qs = QuarantinedSender{
+			Sender: sender,
+			Time:   timeNow(c),
+			Reason: reason,
+		}
+		if _, err := db.Put(c, key, qs); err != nil {
+			return fmt.Errorf("failed to put quarantined sender: %w", err)
+		}
+		added = true
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	if !added {
+		return nil
+	}
+	// This is how the admins learn about it even if there are no alert emails.
+	log.Errorf(c, "email sender %v is quarantined: %v", sender, reason)
+	if len(config.EmailLoop.AlertEmails) == 0 {
+		return nil
+	}
+	msg := &aemail.Message{
+		Sender:  fromAddr(c),
+		To:      config.EmailLoop.AlertEmails,
+		Subject: fmt.Sprintf("email sender %v is quarantined", sender),
+		Body: fmt.Sprintf("The emails from %v are not processed anymore: %v.\n\n"+
+			"The quarantined emails can be reviewed and the sender can be released at %v/admin\n",
+			sender, reason, appURL(c)),
+	}
+	return sendEmail(c, msg)
+}
+
+func storeQuarantinedEmail(c context.Context, sender string, msg *email.Email) error {
+	body := []byte(msg.Body)
+	if len(body) > maxQuarantinedBody {
+		body = body[:maxQuarantinedBody]
+	}
+	senderKey := quarantinedSenderKey(c, sender)
+	tx := func(c context.Context) error {
+		qs := new(QuarantinedSender)
+		if err := db.Get(c, senderKey, qs); err != nil {
+			return fmt.Errorf("failed to get quarantined sender: %w", err)
+		}
+		qs.Messages++
+		if _, err := db.Put(c, senderKey, qs); err != nil {
+			return fmt.Errorf("failed to put quarantined sender: %w", err)
+		}
+		quarantined := &QuarantinedEmail{
+			Time:      timeNow(c),
+			MessageID: msg.MessageID,
+			Subject:   msg.Subject,
+			Body:      body,
+		}
+		if _, err := db.Put(c, db.NewIncompleteKey(c, "QuarantinedEmail", senderKey), quarantined); err != nil {
+			return fmt.Errorf("failed to put quarantined email: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+// releaseSender lets the emails of the sender be processed again and resets its window.
+func releaseSender(c context.Context, sender, admin string) error {
+	key := quarantinedSenderKey(c, sender)
+	tx := func(c context.Context) error {
+		qs := new(QuarantinedSender)
+		if err := db.Get(c, key, qs); err != nil {
+			if err == db.ErrNoSuchEntity {
+				return fmt.Errorf("%w: sender %v is not quarantined", ErrClientNotFound, sender)
+			}
+			return fmt.Errorf("failed to get quarantined sender: %w", err)
+		}
+		if !qs.Released.IsZero() {
+			return nil
+		}
+		qs.Released = timeNow(c)
+		qs.ReleasedBy = admin
+		if _, err := db.Put(c, key, qs); err != nil {
+			return fmt.Errorf("failed to put quarantined sender: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	if err := memcache.Delete(c, "email-loop-"+sender); err != nil && err != memcache.ErrCacheMiss {
+		return fmt.Errorf("failed to reset the email window: %w", err)
+	}
+	err := db.Delete(c, db.NewKey(c, "EmailSenderWindow", sender, 0, nil))
+	if err != nil && err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to reset the email window: %w", err)
+	}
+	return nil
+}
+
+func handleReleaseEmailSender(c context.Context, r *http.Request) error {
+	sender := email.CanonicalEmail(r.FormValue("sender"))
+	if sender == "" {
+		return fmt.Errorf("%w: no sender", ErrClientBadRequest)
+	}
+	admin := ""
+	if u := user.Current(c); u != nil {
+		admin = u.Email
+	}
+	return releaseSender(c, sender, admin)
+}
+
+type uiQuarantinedSender struct {
+	Sender   string
+	Time     time.Time
+	Reason   string
+	Messages int
+	Recent   []*QuarantinedEmail
+}
+
+// loadQuarantinedSendersUI returns the currently quarantined senders with their latest emails.
+func loadQuarantinedSendersUI(c context.Context) ([]*uiQuarantinedSender, error) {
+	var senders []*QuarantinedSender
+	_, err := db.NewQuery("QuarantinedSender").
+		Filter("Released=", time.Time{}).
+		GetAll(c, &senders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quarantined senders: %w", err)
+	}
+	var ret []*uiQuarantinedSender
+	for _, qs := range senders {
+		var recent []*QuarantinedEmail
+		_, err := db.NewQuery("QuarantinedEmail").
+			Ancestor(quarantinedSenderKey(c, qs.Sender)).
+			Order("-Time").
+			Limit(5).
+			GetAll(c, &recent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query quarantined emails: %w", err)
+		}
+		ret = append(ret, &uiQuarantinedSender{
+			Sender:   qs.Sender,
+			Time:     qs.Time,
+			Reason:   qs.Reason,
+			Messages: qs.Messages,
+			Recent:   recent,
+		})
+	}
+	return ret, nil
+}
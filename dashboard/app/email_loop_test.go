@@ -0,0 +1,98 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestEmailLoop(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	sender := c.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	const responder = "responder@corp.com"
+	autoReply := func(id int) {
+		c.incomingEmail(sender, "I am out of office.",
+			EmailOptFrom(responder), EmailOptMessageID(id),
+			EmailOptHeader("Auto-Submitted: auto-replied"))
+	}
+	// A few auto-replies are fine.
+	threshold := config.EmailLoop.Threshold
+	for i := 1; i <= threshold; i++ {
+		autoReply(i)
+		c.advanceTime(time.Minute)
+	}
+	c.expectNoEmail()
+	quarantined, err := isSenderQuarantined(c.ctx, responder)
+	c.expectOK(err)
+	c.expectTrue(!quarantined)
+
+	// The same number of replies, but spread out over a longer period, is fine as well.
+	c.advanceTime(config.EmailLoop.Window)
+	for i := 1; i <= threshold; i++ {
+		autoReply(100 + i)
+		c.advanceTime(time.Minute)
+	}
+	c.expectNoEmail()
+
+	// One more within the window quarantines the sender.
+	autoReply(200)
+	alert := c.pollEmailBug()
+	c.expectEQ(alert.To, []string{"admins@syzkaller.com"})
+	c.expectTrue(strings.Contains(alert.Body, responder))
+	quarantined, err = isSenderQuarantined(c.ctx, responder)
+	c.expectOK(err)
+	c.expectTrue(quarantined)
+
+	// Now all emails of the sender are put aside, even the ones that look manual.
+	c.incomingEmail(sender, "#syz invalid", EmailOptFrom(responder), EmailOptMessageID(201))
+	c.expectNoEmail()
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.Status, BugStatusOpen)
+	// But other senders are not affected.
+	c.incomingEmail(sender, "I will look into it.", EmailOptFrom("human@corp.com"), EmailOptMessageID(202))
+	c.expectNoEmail()
+
+	var emails []*QuarantinedEmail
+	_, err = db.NewQuery("QuarantinedEmail").
+		Ancestor(quarantinedSenderKey(c.ctx, responder)).
+		GetAll(c.ctx, &emails)
+	c.expectOK(err)
+	c.expectEQ(len(emails), 2)
+
+	page, err := c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Quarantined email senders"))
+	c.expectTrue(strings.Contains(string(page), responder))
+
+	// The release path.
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=release_email_sender&sender="+responder)
+	c.expectOK(err)
+	quarantined, err = isSenderQuarantined(c.ctx, responder)
+	c.expectOK(err)
+	c.expectTrue(!quarantined)
+	page, err = c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), responder))
+
+	// The window is reset, so the next auto-reply does not quarantine the sender again.
+	autoReply(300)
+	c.expectNoEmail()
+	c.incomingEmail(sender, "#syz invalid", EmailOptFrom(responder), EmailOptMessageID(301))
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.Status, BugStatusInvalid)
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"testing"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/google/syzkaller/dashboard/dashapi"
 	"github.com/google/syzkaller/pkg/email"
+	"github.com/google/syzkaller/pkg/subsystem"
 	"github.com/google/syzkaller/sys/targets"
 )
 
@@ -859,6 +861,17 @@ func TestSubjectTitleParser(t *testing.T) {
 			outTitle:  "",
 			outSeq:    0,
 		},
+		{
+			// Replies to forwarded reports.
+			inSubject: "Re: Fwd: Re: [syzbot] kernel BUG in blk_mq_dispatch_rq_list (4)",
+			outTitle:  "kernel BUG in blk_mq_dispatch_rq_list",
+			outSeq:    3,
+		},
+		{
+			inSubject: "RE: FW: [syzbot] kernel BUG in blk_mq_dispatch_rq_list",
+			outTitle:  "kernel BUG in blk_mq_dispatch_rq_list",
+			outSeq:    0,
+		},
 		{
 			// Make sure we delete filesystem tags.
 			inSubject: "Re: [syzbot] [ntfs3?] [ext4?] kernel BUG in blk_mq_dispatch_rq_list (4)",
@@ -1150,3 +1163,264 @@ func TestEmailSetCommand(t *testing.T) {
 	c.pollEmailBug()
 	expectSubsystems(t, client, extBugID, "subsystemA", "subsystemB")
 }
+
+func TestEmailReplyLink(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	sender := c.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	// Until we have seen our report, there's nothing to reply to.
+	page, err := c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), "mailto:"))
+	// Replies that overtook the report are not suitable either.
+	c.incomingEmail(sender, "looking", EmailOptMessageID(2), EmailOptInReplyTo("<1>"))
+	page, err = c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), "mailto:"))
+
+	// Our report comes back through the mailing list.
+	c.incomingEmail(sender, "report", EmailOptMessageID(1), EmailOptFrom(sender))
+	page, err = c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "In-Reply-To=%3C1%3E"))
+	c.expectTrue(strings.Contains(string(page), "--in-reply-to=&#39;&lt;1&gt;&#39;"))
+}
+
+func TestMailtoLink(t *testing.T) {
+	tests := []struct {
+		to, cc    []string
+		subject   string
+		inReplyTo string
+		want      string
+	}{
+		{
+			to:        []string{"syzbot+123@testapp.appspotmail.com"},
+			subject:   "KASAN: use-after-free in foo",
+			inReplyTo: "<000000000000abcd@google.com>",
+			want: "mailto:syzbot%2B123%40testapp.appspotmail.com?" +
+				"subject=Re%3A%20KASAN%3A%20use-after-free%20in%20foo&" +
+				"In-Reply-To=%3C000000000000abcd%40google.com%3E",
+		},
+		{
+			to:      []string{"syzbot+123@testapp.appspotmail.com"},
+			cc:      []string{"a@b.com", `"Foo Bar" <foo@bar.com>`},
+			subject: `Re: WARNING in "strange" naïve_func & co`,
+			want: "mailto:syzbot%2B123%40testapp.appspotmail.com?" +
+				"cc=a%40b.com%2C%22Foo%20Bar%22%20%3Cfoo%40bar.com%3E&" +
+				"subject=Re%3A%20WARNING%20in%20%22strange%22%20na%C3%AFve_func%20%26%20co",
+		},
+	}
+	for _, test := range tests {
+		got := mailtoLink(test.to, test.cc, test.subject, test.inReplyTo)
+		if got != test.want {
+			t.Errorf("got:\n%v\nwant:\n%v", got, test.want)
+		}
+	}
+}
+
+func TestGitSendEmailCommand(t *testing.T) {
+	got := gitSendEmailCommand([]string{"syzbot+123@testapp.appspotmail.com"},
+		[]string{"a@b.com", `"O'Brien" <ob@b.com>`}, "<123@host>")
+	want := `git send-email --in-reply-to='<123@host>' --to='syzbot+123@testapp.appspotmail.com' ` +
+		`--cc='a@b.com' --cc='"O'\''Brien" <ob@b.com>' 0001-*.patch`
+	if got != want {
+		t.Errorf("got:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestEmailAssignCommand(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	mailingList := config.Namespaces["access-public-email"].Reporting[0].Config.(*EmailConfig).Email
+	build := testBuild(1)
+	client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	sender := c.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	expectAssignee := func(want string) {
+		t.Helper()
+		bug, _, err := findBugByReportingID(c.ctx, extBugID)
+		c.expectOK(err)
+		c.expectEQ(bug.AssigneeEmail, want)
+	}
+
+	// The report is also seen in the mailing list archive.
+	thread := c.incomingThread(crash.Title, extBugID)
+	reportID := thread.reply(thread.botEmail, "The report.")
+
+	c.incomingEmail(sender, "#syz assign\n", EmailOptFrom("Dev@Kernel.org"),
+		EmailOptCC([]string{mailingList}), EmailOptMessageID(1), EmailOptInReplyTo(reportID))
+	c.expectEQ(strings.Contains(c.pollEmailBug().Body, "The bug is now assigned to dev@kernel.org."), true)
+	expectAssignee("dev@kernel.org")
+
+	// The command is recorded in the discussion.
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	discussions, err := discussionsForBug(c.ctx, bug.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	_, recorded := discussions[0].messageIDs()["<1>"]
+	c.expectEQ(recorded, true)
+
+	page, err := c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectEQ(bytes.Contains(page, []byte("Claimed by: dev@kernel.org")), true)
+	page, err = c.AuthGET(AccessPublic, "/access-public-email?assignee=dev@kernel.org")
+	c.expectOK(err)
+	c.expectEQ(bytes.Contains(page, []byte(crash.Title)), true)
+	page, err = c.AuthGET(AccessPublic, "/access-public-email?assignee=other@kernel.org")
+	c.expectOK(err)
+	c.expectEQ(bytes.Contains(page, []byte(crash.Title)), false)
+
+	c.incomingEmail(sender, "#syz unassign\n", EmailOptFrom("dev@kernel.org"),
+		EmailOptCC([]string{mailingList}), EmailOptMessageID(2))
+	c.expectEQ(strings.Contains(c.pollEmailBug().Body, "The bug is no longer assigned to anyone."), true)
+	expectAssignee("")
+
+	// A plain text claim works without a reply.
+	c.incomingEmail(sender, "Hi,\n\nI'll take this one.\n", EmailOptFrom("other@kernel.org"),
+		EmailOptCC([]string{mailingList}), EmailOptMessageID(3))
+	c.expectNoEmail()
+	expectAssignee("other@kernel.org")
+
+	// A claim does not take the bug away from the assignee.
+	c.incomingEmail(sender, "I'll take it!\n", EmailOptFrom("third@kernel.org"),
+		EmailOptCC([]string{mailingList}), EmailOptMessageID(5))
+	c.expectNoEmail()
+	expectAssignee("other@kernel.org")
+
+	// Like other commands, unassigning is not limited to the assignee.
+	c.incomingEmail(sender, "#syz unassign\n", EmailOptFrom("stranger@example.com"),
+		EmailOptCC([]string{mailingList}), EmailOptMessageID(7))
+	c.expectEQ(strings.Contains(c.pollEmailBug().Body, "The bug is no longer assigned to anyone."), true)
+	expectAssignee("")
+	c.incomingEmail(sender, "I'll take it!\n", EmailOptFrom("other@kernel.org"),
+		EmailOptCC([]string{mailingList}), EmailOptMessageID(8))
+	c.expectNoEmail()
+	expectAssignee("other@kernel.org")
+
+	// The assignment is reset once the fix is in.
+	reply, _ := client.ReportingUpdate(&dashapi.BugUpdate{
+		ID:         extBugID,
+		Status:     dashapi.BugStatusOpen,
+		FixCommits: []string{"foo: fix the crash"},
+	})
+	c.expectEQ(reply.OK, true)
+	build2 := testBuild(2)
+	build2.Manager = build.Manager
+	build2.Commits = []string{"foo: fix the crash"}
+	client.UploadBuild(build2)
+	expectAssignee("")
+
+	// The bug is closed now.
+	c.incomingEmail(sender, "#syz assign\n", EmailOptFrom("dev@kernel.org"),
+		EmailOptCC([]string{mailingList}), EmailOptMessageID(4))
+	c.expectEQ(strings.Contains(c.pollEmailBug().Body, "The bug is already closed."), true)
+	expectAssignee("")
+}
+
+func TestIsClaimMessage(t *testing.T) {
+	tests := map[string]bool{
+		"I'll take this.":                             true,
+		"Thanks!\nI will take it\nBest":               true,
+		"I'll take this one!":                         true,
+		"I will take it from here.":                   false,
+		"I'll take this into account when reviewing.": false,
+		"> I'll take this\nOk":                        false,
+		"Will you take this?":                         false,
+		"I'd take this with a grain of salt":          false,
+	}
+	for text, want := range tests {
+		if got := isClaimMessage(text); got != want {
+			t.Errorf("%q: got %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestEmailSubsystemLists(t *testing.T) {
+	cfg := &EmailConfig{
+		SubsystemLists: map[string][]string{
+			"net":      {"net@list.com"},
+			"wireless": {"wireless@list.com", "net@list.com"},
+			"usb":      {"usb@list.com"},
+		},
+	}
+	tests := []struct {
+		subsystems []string
+		lists      []string
+	}{
+		{nil, nil},
+		{[]string{"fs"}, nil},
+		{[]string{"net"}, []string{"net@list.com"}},
+		{[]string{"wireless", "net"}, []string{"net@list.com", "wireless@list.com"}},
+		{[]string{"usb", "fs", "wireless"}, []string{"net@list.com", "usb@list.com", "wireless@list.com"}},
+	}
+	for _, test := range tests {
+		lists := cfg.subsystemLists(test.subsystems)
+		if fmt.Sprint(lists) != fmt.Sprint(test.lists) {
+			t.Errorf("%v: got %v, want %v", test.subsystems, lists, test.lists)
+		}
+	}
+}
+
+func TestEmailSubsystemListsFollowUp(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	c.setSubsystems("test2", []*subsystem.Subsystem{
+		{Name: "net", PathRules: []subsystem.PathRule{{IncludeRegexp: `net\.c`}}},
+		{Name: "wireless", PathRules: []subsystem.PathRule{{IncludeRegexp: `wifi\.c`}}},
+	}, 1)
+	build := testBuild(1)
+	c.client2.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.GuiltyFiles = []string{"net.c"}
+	c.client2.ReportCrash(crash)
+
+	// The initial report goes to the list of the inferred subsystem.
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.To, []string{"net-reports@list.com", "test@syzkaller.com"})
+	sender := msg.Sender
+
+	// The new subsystem list gets a follow-up, the already notified one doesn't.
+	c.incomingEmail(sender, "#syz set subsystems: net, wireless\n", EmailOptFrom("test@requester.com"))
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "I've successfully updated the bug's subsystems."))
+	notif := c.pollEmailBug()
+	c.expectEQ(notif.Sender, sender)
+	c.expectTrue(stringInList(notif.To, "wireless-reports@list.com"))
+	c.expectTrue(strings.Contains(notif.Body, "Now also notifying wireless-reports@list.com\n"))
+	c.expectNoEmail()
+
+	// Each list is notified at most once.
+	c.incomingEmail(sender, "#syz set subsystems: wireless\n", EmailOptFrom("test@requester.com"))
+	c.pollEmailBug()
+	c.expectNoEmail()
+	c.incomingEmail(sender, "#syz set subsystems: net, wireless\n", EmailOptFrom("test@requester.com"))
+	c.pollEmailBug()
+	c.expectNoEmail()
+
+	// Further reports are also sent to both lists.
+	crash.ReproOpts = []byte("repro opts")
+	crash.ReproSyz = []byte("getpid()")
+	c.client2.ReportCrash(crash)
+	msg = c.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Body, "syzbot has found a reproducer"))
+	c.expectTrue(stringInList(msg.To, "net-reports@list.com"))
+	c.expectTrue(stringInList(msg.To, "wireless-reports@list.com"))
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
 	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/subsystem"
 	"golang.org/x/net/context"
@@ -34,6 +35,37 @@ type Manager struct {
 	FailedSyzBuildBug string
 	LastAlive         time.Time
 	CurrentUpTime     time.Duration
+	// The date (YYYYMMDD) of the day covered by the last crash rate alert.
+	CrashRateAlertDate int `datastore:",noindex"`
+	// DescriptionsHash is the hash of the syscall list of the last ManagerDescriptions.
+	DescriptionsHash string `datastore:",noindex"`
+	// FailedBuildSince and FailedBuildCommit describe the current kernel build failure:
+	// when it started and the first kernel commit that failed to build.
+	// BuildFailures is the history of the previous failures, see build_failures.go.
+	FailedBuildSince  time.Time
+	FailedBuildCommit string                `datastore:",noindex"`
+	BuildFailures     []ManagerBuildFailure `datastore:",noindex"`
+	// The last reported corpus of the manager and the last corpus uploaded for
+	// a corpus import (see corpus_transfer.go).
+	CorpusDigest       string    `datastore:",noindex"`
+	CorpusPrograms     int       `datastore:",noindex"`
+	CorpusExportDigest string    `datastore:",noindex"`
+	CorpusExported     time.Time `datastore:",noindex"`
+}
+
+type ManagerBuildFailure struct {
+	Bug         string
+	FirstCommit string
+	Start       time.Time
+	End         time.Time
+}
+
+// ManagerDescriptions records a change of the syscall descriptions used by the manager.
+// Has Manager as parent entity. Keyed by the syzkaller commit that was the first to have them.
+type ManagerDescriptions struct {
+	SyzkallerCommit string
+	Time            time.Time
+	Syscalls        []string `datastore:",noindex"`
 }
 
 // ManagerStats holds per-day manager runtime stats.
@@ -54,6 +86,7 @@ type Asset struct {
 	Type        dashapi.AssetType
 	DownloadURL string
 	CreateDate  time.Time
+	Size        int64 `datastore:",noindex"` // uncompressed size, 0 if unknown
 }
 
 type Build struct {
@@ -74,6 +107,8 @@ type Build struct {
 	KernelCommitTitle   string    `datastore:",noindex"`
 	KernelCommitDate    time.Time `datastore:",noindex"`
 	KernelConfig        int64     // reference to KernelConfig text entity
+	KernelConfigHash    string    `datastore:",noindex"` // see kernelConfigHash
+	VMConfig            int64     // reference to VMConfig text entity, see vm_config.go
 	Assets              []Asset   // build-related assets
 	AssetsLastCheck     time.Time // the last time we checked the assets for deprecation
 }
@@ -87,6 +122,8 @@ type Bug struct {
 	Status       int
 	StatusReason dashapi.BugStatusReason // e.g. if the bug status is "invalid", here's the reason why
 	DupOf        string
+	// RegressionOf is the hash of the fixed bug that this bug is a regression of.
+	RegressionOf string
 	NumCrashes   int64
 	NumRepro     int64
 	// ReproLevel is the best ever found repro level for this bug.
@@ -115,10 +152,276 @@ type Bug struct {
 	// Kcidb publishing status bitmask:
 	// bit 0 - the bug is published
 	// bit 1 - don't want to publish it (syzkaller build/test errors)
-	KcidbStatus    int64
-	DailyStats     []BugDailyStats
-	Tags           BugTags
-	DiscussionInfo []BugDiscussionInfo
+	KcidbStatus int64
+	DailyStats  []BugDailyStats
+	Tags        BugTags
+	// SubsystemsHistory records the latest additions and removals of subsystem labels.
+	SubsystemsHistory []BugSubsystemChange `datastore:",noindex"`
+	DiscussionInfo    []BugDiscussionInfo
+	// LastDiscussionActivity is the time of the last message in any of the bug discussions.
+	// It's denormalized from DiscussionInfo to make it possible to query by it.
+	LastDiscussionActivity time.Time
+	// NeedsRepro is set if developers asked for a reproducer in the bug discussions.
+	// Reproduction of such bugs is retried more aggressively.
+	NeedsRepro bool
+	// ReproRevoked is set if the bug had reproducers, but none of them work on the HEAD commit any more.
+	ReproRevoked bool
+	// LastReproSuccess is the last time a reproducer triggered the bug: either the time
+	// when it was found or the time of the last successful repro retest job.
+	LastReproSuccess time.Time `datastore:",noindex"`
+	// Disputed is set if the latest external opinion in the discussions is that it's not a real bug.
+	// Such bugs need a human review rather than more reminders.
+	Disputed bool
+	// CrashWindow and SuppressedCrashes implement coalescing of duplicate crashes, see crash_coalesce.go.
+	CrashWindow       CrashWindow `datastore:",noindex"`
+	SuppressedCrashes int64       `datastore:",noindex"`
+	// DisputeClearedTime is set when an admin clears the Disputed flag.
+	// Only newer verdicts may set the flag again.
+	DisputeClearedTime time.Time `datastore:",noindex"`
+	// AssigneeEmail is the developer who claimed the bug with "#syz assign".
+	// It's reset once the bug is fixed.
+	AssigneeEmail string
+	AssignedTime  time.Time `datastore:",noindex"`
+	// GuiltyFile overrides the guilty file extracted from the crash reports (see "#syz set-guilty").
+	// GuiltyFileHistory records all changes of the override, the last entry is the current one.
+	GuiltyFile        string                `datastore:",noindex"`
+	GuiltyFileHistory []BugGuiltyFileChange `datastore:",noindex"`
+	// Backports is the status of the fix commits in the stable branches of the namespace.
+	// BackportsMissing is set if some fix commits were not found in some branches during the last check.
+	// BackportsDone is set once the backports no longer need to be checked.
+	Backports        []BugBackport `datastore:",noindex"`
+	BackportsChecked time.Time
+	BackportsMissing bool
+	BackportsDone    bool
+	// ReleasesChecked is the last time the releases of the fix commits were looked up,
+	// ReleasesDone is set once all of them have been released (see CommitInfo.Release).
+	ReleasesChecked time.Time
+	ReleasesDone    bool
+	// FixCommitConflict is set if a fix commit title matches different commits,
+	// such bugs are not closed as fixed until the right commit is pinned.
+	FixCommitConflict bool
+	// LastReproManager and LastReproOutcome describe the latest reproduction or minimization
+	// attempt that finished at LastReproTime.
+	LastReproManager string       `datastore:",noindex"`
+	LastReproOutcome ReproOutcome `datastore:",noindex"`
+	// TopFrames are the top call trace frames of the first crash report of the bug.
+	// SimilarBugs are the key hashes of the same crashes in other namespaces, see similar_bugs.go.
+	TopFrames   []string `datastore:",noindex"`
+	SimilarBugs []string `datastore:",noindex"`
+	// MinimizeRequested is the time of the last manual minimization request (see "#syz minimize").
+	MinimizeRequested time.Time `datastore:",noindex"`
+	// Invalidations records the latest invalidations of the bug, see invalidations.go.
+	Invalidations []BugInvalidation `datastore:",noindex"`
+	// ExternalObservations are the crashes of the bug seen by external CI systems,
+	// see external_observations.go.
+	ExternalObservations []ExternalObservation `datastore:",noindex"`
+	// InheritedFrom is the hash of the bug in another namespace this bug was seeded from
+	// when its namespace was bootstrapped, see namespace_bootstrap.go.
+	InheritedFrom string `datastore:",noindex"`
+	// SyzkallerRange is the range of syzkaller revisions the bug crashes were observed with,
+	// see syzkaller_range.go.
+	SyzkallerRange SyzkallerRange `datastore:",noindex"`
+	// FormerTitles are the titles the bug had before it was renamed by an admin, see bug_rename.go.
+	// KeyTitle is the original title the bug key was derived from, it's only set for renamed bugs.
+	FormerTitles []string
+	KeyTitle     string      `datastore:",noindex"`
+	Renames      []BugRename `datastore:",noindex"`
+	// PurgedCrashes and PurgedLogs count the crashes and the crash logs deleted
+	// by the crash retention policy, see crash_retention.go.
+	PurgedCrashes int64 `datastore:",noindex"`
+	PurgedLogs    int64 `datastore:",noindex"`
+	// ReproParseError is set if the syz reproducer of the bug could not be parsed by a job,
+	// see repro_migration.go. It's reset once a new reproducer is found.
+	ReproParseError  string    `datastore:",noindex"`
+	ReproParseFailed time.Time `datastore:",noindex"`
+	// FocusUntil is the end of the focused fuzzing window requested with "#syz focus" (see focus.go).
+	FocusUntil time.Time
+	Focus      BugFocus `datastore:",noindex"`
+	// DupCandidates are the hashes of the open bugs this bug looked similar to when it was created,
+	// see dup_candidates.go.
+	DupCandidates []string `datastore:",noindex"`
+	// ConfigMinimizeRequested/Finished are the times of the last kernel config minimization
+	// request and job, MinimizedConfig is the download link of the result (see config_minimize.go).
+	ConfigMinimizeRequested time.Time `datastore:",noindex"`
+	ConfigMinimizeFinished  time.Time `datastore:",noindex"`
+	MinimizedConfig         string    `datastore:",noindex"`
+	// NoReproReports are the latest "#syz norepro" reports of developers, see norepro.go.
+	NoReproReports []NoReproReport `datastore:",noindex"`
+	// FixedTogetherWith are the hashes of the bugs fixed by the same commits, see fix_batches.go.
+	FixedTogetherWith []string `datastore:",noindex"`
+	// FrameKey identifies the crash type and the top stack frames of the bug crashes, and FrameAliases
+	// are the titles of the crashes that were attached to the bug by the key (see frame_dedup.go).
+	FrameKey     string
+	FrameAliases []string `datastore:",noindex"`
+	// PatchedSince records when the fix commits reached the managers of PatchedOn, and
+	// FixedBuildCrashes are the times of the latest crashes on builds that contained the fix
+	// (see fix_hysteresis.go).
+	PatchedSince      []BugPatchedManager `datastore:",noindex"`
+	FixedBuildCrashes []time.Time         `datastore:",noindex"`
+	// Keywords are the function names and file basenames of the top frames of the representative
+	// crash, they are used for search (see report_search.go).
+	Keywords []string
+	// PauseDigest is set if the bug was created while the reporting was paused, and it was
+	// reported in the digest sent after the pause instead of individually (see reporting_pause.go).
+	PauseDigest time.Time `datastore:",noindex"`
+	// CVEs are the CVE IDs assigned to the bug, CVEHistory records who changed them (see cve.go).
+	CVEs       []string
+	CVEHistory []BugCVEChange `datastore:",noindex"`
+	// NumTaintedCrashes is the number of crashes that happened on tainted kernels (see taint.go).
+	NumTaintedCrashes int64 `datastore:",noindex"`
+	// BisectRetestRequested is the time of the last "#syz retest-bisect" request, BisectRetestPending
+	// is set until the next bisection job of the bug is created (see bisect_confidence.go).
+	BisectRetestRequested time.Time `datastore:",noindex"`
+	BisectRetestPending   bool      `datastore:",noindex"`
+	// ReportingMode is ReportingModeDigest for the low-severity bugs that are only listed in digests,
+	// LowSeverityRule is the rule that matched the bug. Promoted is when the bug got a reproducer
+	// or a discussion and left the digests, PromotedReason says which (see low_severity.go).
+	ReportingMode   BugReportingMode
+	LowSeverityRule string    `datastore:",noindex"`
+	Promoted        time.Time `datastore:",noindex"`
+	PromotedReason  string    `datastore:",noindex"`
+	// Repros are all reproducers of the bug: the ones found by syzbot and the ones uploaded
+	// by developers, the older ones are kept as superseded (see bug_repros.go).
+	Repros []BugRepro
+	// NumEvents is the number of the bug timeline events, it's also the ID of the last BugEvent.
+	// events are the events recorded by the current update, they are saved by saveBugEvents
+	// in the same transaction as the bug (see bug_events.go).
+	NumEvents int64 `datastore:",noindex"`
+	events    []*BugEvent
+}
+
+type BugPatchedManager struct {
+	Manager string
+	Time    time.Time
+}
+
+// ReproOutcome is the result of a reproduction or a minimization attempt.
+type ReproOutcome string
+
+const (
+	ReproOutcomeC      ReproOutcome = "C reproducer"
+	ReproOutcomeSyz    ReproOutcome = "syz reproducer"
+	ReproOutcomeFailed ReproOutcome = "failed to reproduce"
+	ReproOutcomeError  ReproOutcome = "error"
+)
+
+func reproOutcomeForLevel(level dashapi.ReproLevel) ReproOutcome {
+	switch level {
+	case ReproLevelC:
+		return ReproOutcomeC
+	case ReproLevelSyz:
+		return ReproOutcomeSyz
+	default:
+		return ReproOutcomeFailed
+	}
+}
+
+type BugBackport struct {
+	Branch  string // alias of the stable branch
+	Commit  string // title of the upstream fix commit
+	Hash    string // hash of the backport, empty if it's missing
+	Checked time.Time
+}
+
+type BugRepro struct {
+	ID      int64              `datastore:",noindex"` // 1-based index in Bug.Repros
+	Origin  ReproOrigin        `datastore:",noindex"`
+	Created time.Time          `datastore:",noindex"`
+	User    string             `datastore:",noindex"` // the developer who uploaded the repro
+	CrashID int64              `datastore:",noindex"` // the crash the syzbot repro was found for
+	Arch    string             `datastore:",noindex"`
+	Level   dashapi.ReproLevel `datastore:",noindex"`
+	// References to the ReproSyz and ReproC text entities, they are indexed for checkTextAccess.
+	ReproSyz   int64
+	ReproC     int64
+	ReproOpts  []byte      `datastore:",noindex"`
+	Status     ReproStatus `datastore:",noindex"`
+	StatusTime time.Time   `datastore:",noindex"`
+}
+
+type ReproOrigin string
+
+const (
+	ReproOriginSyzbot ReproOrigin = "syzbot"
+	ReproOriginManual ReproOrigin = "manual"
+)
+
+type ReproStatus string
+
+const (
+	ReproStatusActive     ReproStatus = "active"
+	ReproStatusSuperseded ReproStatus = "superseded"
+	ReproStatusBroken     ReproStatus = "broken"
+)
+
+// BugEvent is an entry of the bug timeline, it's a child entity of the bug.
+type BugEvent struct {
+	Type  BugEventType
+	Time  time.Time
+	Actor BugEventActor `datastore:",noindex"`
+	// User is the email of the person who caused the event, it's empty for the system events.
+	User string `datastore:",noindex"`
+	// Cause refers to the source of the event, e.g. "message <id>", "job <id>" or "cron <name>".
+	Cause     string `datastore:",noindex"`
+	Reporting string `datastore:",noindex"`
+	Details   string `datastore:",noindex"`
+	// Backfilled is set for the events synthesized from the fields of the older bugs.
+	Backfilled bool `datastore:",noindex"`
+}
+
+type BugEventType string
+
+const (
+	BugEventReported    BugEventType = "reported"
+	BugEventUpstreamed  BugEventType = "upstreamed"
+	BugEventFixAttached BugEventType = "fix-attached"
+	BugEventFixRemoved  BugEventType = "fix-removed"
+	BugEventFixed       BugEventType = "fixed"
+	BugEventInvalidated BugEventType = "invalidated"
+	BugEventObsoleted   BugEventType = "obsoleted"
+	BugEventDup         BugEventType = "dup"
+	BugEventReopened    BugEventType = "reopened"
+	BugEventLabels      BugEventType = "labels"
+	BugEventReproFound  BugEventType = "repro-found"
+)
+
+type BugEventActor string
+
+const (
+	BugActorSystem BugEventActor = "system"
+	BugActorUser   BugEventActor = "user"
+	BugActorAdmin  BugEventActor = "admin"
+)
+
+type BugInvalidation struct {
+	Time      time.Time
+	Reporting string
+	User      string // empty for automatic invalidations
+	Reason    string
+	// Set if the invalidation was reverted by an admin.
+	RevertedBy   string
+	RevertedTime time.Time
+}
+
+type ExternalObservation struct {
+	Reporter     string // the tag of the external CI system
+	Client       string // the dashboard client that reported it
+	KernelCommit string
+	Count        int64
+	LastSeen     time.Time
+}
+
+type BugRename struct {
+	From string
+	To   string
+	User string
+	Time time.Time
+}
+
+type BugGuiltyFileChange struct {
+	File string // empty if the override was dropped
+	User string
+	Time time.Time
 }
 
 type BugTags struct {
@@ -134,13 +437,37 @@ type BugSubsystem struct {
 	SetBy string
 }
 
-func (bug *Bug) SetAutoSubsystems(list []*subsystem.Subsystem, now time.Time, rev int) {
+// BugSubsystemChange records the addition or the removal of a single subsystem label.
+type BugSubsystemChange struct {
+	Time      time.Time
+	Subsystem string
+	Removed   bool
+	Cause     subsystemChangeCause
+	User      string // only set for manual changes
+}
+
+// subsystemChangeCause describes why the subsystems of a bug have changed.
+type subsystemChangeCause string
+
+const (
+	subsystemCauseCrash      subsystemChangeCause = "new crash"
+	subsystemCauseRefresh    subsystemChangeCause = "periodic refresh"
+	subsystemCauseRules      subsystemChangeCause = "rule update"
+	subsystemCauseUser       subsystemChangeCause = "manual command"
+	subsystemCauseGuiltyFile subsystemChangeCause = "guilty file change"
+)
+
+// Only the latest changes are kept to limit the size of the bug entity.
+const maxSubsystemsHistory = 100
+
+func (bug *Bug) SetAutoSubsystems(list []*subsystem.Subsystem, now time.Time, rev int,
+	cause subsystemChangeCause) {
 	objects := []BugSubsystem{}
 	for _, item := range list {
 		objects = append(objects, BugSubsystem{Name: item.Name})
 	}
 	bug.SubsystemsRev = rev
-	bug.SetSubsystems(objects, now)
+	bug.SetSubsystems(objects, now, cause, "")
 }
 
 func (bug *Bug) SetUserSubsystems(list []*subsystem.Subsystem, now time.Time, user string) {
@@ -151,12 +478,49 @@ func (bug *Bug) SetUserSubsystems(list []*subsystem.Subsystem, now time.Time, us
 			SetBy: user,
 		})
 	}
-	bug.SetSubsystems(objects, now)
+	bug.SetSubsystems(objects, now, subsystemCauseUser, user)
 }
 
-func (bug *Bug) SetSubsystems(list []BugSubsystem, now time.Time) {
+func (bug *Bug) SetSubsystems(list []BugSubsystem, now time.Time, cause subsystemChangeCause, user string) {
+	var changes []string
+	for _, item := range list {
+		if !bug.hasSubsystem(item.Name) {
+			changes = append(changes, "+"+item.Name)
+			bug.SubsystemsHistory = append(bug.SubsystemsHistory, BugSubsystemChange{
+				Time:      now,
+				Subsystem: item.Name,
+				Cause:     cause,
+				User:      user,
+			})
+		}
+	}
+	for _, old := range bug.Tags.Subsystems {
+		removed := true
+		for _, item := range list {
+			if item.Name == old.Name {
+				removed = false
+				break
+			}
+		}
+		if removed {
+			changes = append(changes, "-"+old.Name)
+			bug.SubsystemsHistory = append(bug.SubsystemsHistory, BugSubsystemChange{
+				Time:      now,
+				Subsystem: old.Name,
+				Removed:   true,
+				Cause:     cause,
+				User:      user,
+			})
+		}
+	}
+	if len(bug.SubsystemsHistory) > maxSubsystemsHistory {
+		bug.SubsystemsHistory = bug.SubsystemsHistory[len(bug.SubsystemsHistory)-maxSubsystemsHistory:]
+	}
 	bug.Tags.Subsystems = list
 	bug.SubsystemsTime = now
+	if len(changes) != 0 {
+		bug.recordEvent(subsystemChangeEvent(changes, now, cause, user))
+	}
 }
 
 func (bug *Bug) hasUserSubsystems() bool {
@@ -168,6 +532,16 @@ func (bug *Bug) hasUserSubsystems() bool {
 	return false
 }
 
+// hasExternalLink returns true if the bug is linked from an external tracker.
+func (bug *Bug) hasExternalLink() bool {
+	for _, item := range bug.Reporting {
+		if item.Link != "" && !item.Dummy {
+			return true
+		}
+	}
+	return false
+}
+
 func (bug *Bug) hasSubsystem(name string) bool {
 	for _, item := range bug.Tags.Subsystems {
 		if item.Name == name {
@@ -177,6 +551,11 @@ func (bug *Bug) hasSubsystem(name string) bool {
 	return false
 }
 
+// updateReproRevoked recalculates ReproRevoked after a change of the repro levels.
+func (bug *Bug) updateReproRevoked() {
+	bug.ReproRevoked = bug.ReproLevel != ReproLevelNone && bug.HeadReproLevel == ReproLevelNone
+}
+
 func (bug *Bug) Load(ps []db.Property) error {
 	if err := db.LoadStruct(bug, ps); err != nil {
 		return err
@@ -205,6 +584,16 @@ type BugDailyStats struct {
 	CrashCount int
 }
 
+// BugManagerStats counts crashes of a bug on a single manager, see crash_matrix.go.
+// The parent is the Bug entity, the key is the manager name.
+type BugManagerStats struct {
+	Manager  string
+	Arch     string
+	Total    int64
+	LastTime time.Time
+	Days     []BugDailyStats `datastore:",noindex"` // only the last maxManagerStatsDays days
+}
+
 type Commit struct {
 	Hash       string
 	Title      string
@@ -212,6 +601,13 @@ type Commit struct {
 	AuthorName string
 	CC         string `datastore:",noindex"` // (|-delimited list)
 	Date       time.Time
+	// Release is the first release tag of the main repo that contains the commit (e.g. v6.7-rc1).
+	Release string
+	// Conflicts are the hashes of other commits with the same title in the namespace repos
+	// (|-delimited list), see fix_conflicts.go.
+	Conflicts string `datastore:",noindex"`
+	// Pinned is set if the hash was chosen by an admin and must not be updated.
+	Pinned bool `datastore:",noindex"`
 }
 
 type BugDiscussionInfo struct {
@@ -224,6 +620,11 @@ type DiscussionSummary struct {
 	ExternalMessages int
 	LastMessage      time.Time
 	LastPatchMessage time.Time
+	// LastVerdict is the sentiment of the latest external non-neutral message.
+	LastVerdict     string    `datastore:",noindex"`
+	LastVerdictTime time.Time `datastore:",noindex"`
+	// LastPatchAccepted is the time a patch series was last accepted by the maintainers.
+	LastPatchAccepted time.Time `datastore:",noindex"`
 }
 
 type BugReporting struct {
@@ -242,6 +643,17 @@ type BugReporting struct {
 	OnHold     time.Time          // if set, the bug must not be upstreamed
 	Reported   time.Time
 	Closed     time.Time
+	// ReportMessageID is the Message-ID of our report email, as it came back through the mailing list.
+	// App Engine does not let us set Message-ID of outgoing emails, so we can only learn it this way.
+	ReportMessageID string `datastore:",noindex"`
+	// RenameNotified is the last time the reporting was notified about a bug rename.
+	RenameNotified time.Time `datastore:",noindex"`
+	// Queued is set if the bug was ready to be reported outside of the reporting window
+	// (see reporting_window.go).
+	Queued time.Time `datastore:",noindex"`
+	// The report experiment and its variant the bug was reported with (see report_experiments.go).
+	Experiment string
+	Variant    string `datastore:",noindex"`
 }
 
 type Crash struct {
@@ -255,6 +667,7 @@ type Crash struct {
 	References      []CrashReference
 	Maintainers     []string            `datastore:",noindex"`
 	Log             int64               // reference to CrashLog text entity
+	LogSize         int64               `datastore:",noindex"` // compressed size of the CrashLog entity
 	Flags           int64               // properties of the Crash
 	Report          int64               // reference to CrashReport text entity
 	ReportElements  CrashReportElements // parsed parts of the crash report
@@ -264,16 +677,35 @@ type Crash struct {
 	ReproIsRevoked  bool                // the repro no longer triggers the bug on HEAD
 	LastReproRetest time.Time           // the last time when the repro was re-checked
 	MachineInfo     int64               // Reference to MachineInfo text entity.
+	ReproCoverage   []byte              `datastore:",noindex"` // see encodeReproCoverage
 	// Custom crash priority for reporting (greater values are higher priority).
 	// For example, a crash in mainline kernel has higher priority than a crash in a side branch.
 	// For historical reasons this is called ReportLen.
 	ReportLen       int64
 	Assets          []Asset   // crash-related assets
 	AssetsLastCheck time.Time // the last time we checked the assets for deprecation
+	// Downloads of the crash logs and reproducers (see recordCrashAccess).
+	// Both fields are updated in batches, so they are only approximate.
+	NumAccesses int64     `datastore:",noindex"`
+	LastAccess  time.Time `datastore:",noindex"`
+	// ReproSyzMigrated refers to the syz reproducer migrated to the current syscall descriptions,
+	// it's set if ReproSyz no longer parses (see repro_migration.go).
+	ReproSyzMigrated int64 `datastore:",noindex"`
+	// The decayed numbers of the repro retest runs and of the runs that crashed,
+	// and the time of the last measurement (see repro_reliability.go).
+	ReproAttempts  float64   `datastore:",noindex"`
+	ReproSuccesses float64   `datastore:",noindex"`
+	ReproMeasured  time.Time `datastore:",noindex"`
+	// Taint are the kernel taint flags at the time of the crash, e.g. "W" (see taint.go).
+	Taint string `datastore:",noindex"`
 }
 
 type CrashReportElements struct {
 	GuiltyFiles []string // guilty files as determined during the crash report parsing
+	Structured  []byte   `datastore:",noindex"` // JSON-encoded dashapi.StructuredReport
+	// The racing accesses of KCSAN data races and the uninit origin of KMSAN reports.
+	RaceAccesses []string `datastore:",noindex"`
+	KMSANOrigin  string   `datastore:",noindex"`
 }
 
 type CrashReferenceType string
@@ -346,12 +778,291 @@ type Discussion struct {
 	Type    string
 	Subject string
 	BugKeys []string
+	// BugReasons[i] is the dashapi.AttachmentReason of BugKeys[i].
+	// Discussions attached before the reasons were recorded lack them, those are treated as unknown.
+	BugReasons []string `datastore:",noindex"`
 	// Message contains last N messages.
 	// N is supposed to be big enough, so that in almost all cases
 	// AllMessages == len(Messages) holds true.
 	Messages []DiscussionMessage
 	// Since Messages could be trimmed, we have to keep aggregate stats.
 	Summary DiscussionSummary
+	// LastExcerpt is a short text of the last non-auto-reply message (w/o quoted parts).
+	LastExcerpt string `datastore:",noindex"`
+	// ReproSentTime is set once syzbot has replied with the reproducer to the discussion.
+	ReproSentTime time.Time
+	// PatchState is the state of the patch series as reported by the source (e.g. Patchwork).
+	PatchState string `datastore:",noindex"`
+	// TargetTree is the kernel tree the patch targets, if it could be guessed.
+	TargetTree string
+}
+
+// PatchworkPoll keeps the state of polling of one Patchwork project for one namespace.
+type PatchworkPoll struct {
+	Namespace string
+	URL       string
+	Project   string
+	LastPoll  time.Time
+}
+
+func patchworkPollKey(c context.Context, ns string, cfg *PatchworkConfig) *db.Key {
+	return db.NewKey(c, "PatchworkPoll", fmt.Sprintf("%v|%v|%v", ns, cfg.URL, cfg.Project), 0, nil)
+}
+
+// DiscussionQuota counts discussion messages received from a source during one hour.
+// The live counters are in memcache, the entity is their periodically persisted copy.
+type DiscussionQuota struct {
+	Source   string
+	Hour     time.Time
+	Messages int
+	Dropped  int
+}
+
+func discussionQuotaKey(c context.Context, source string, hour time.Time) *db.Key {
+	return db.NewKey(c, "DiscussionQuota", fmt.Sprintf("%v-%v", source, hour.Unix()), 0, nil)
+}
+
+// DiscussionSpill keeps a discussion update that was not processed due to the source quota.
+type DiscussionSpill struct {
+	Source string
+	// Namespace restricts the bugs the update may refer to, if set.
+	Namespace string `datastore:",noindex"`
+	Time      time.Time
+	Update    []byte `datastore:",noindex"` // JSON-encoded dashapi.Discussion
+}
+
+// QuarantinedSender is an email sender whose messages are not processed because the sender
+// looks like an autoresponder in a loop with syzbot. The entity key is the canonical address.
+type QuarantinedSender struct {
+	Sender     string
+	Time       time.Time
+	Reason     string    `datastore:",noindex"`
+	Messages   int       `datastore:",noindex"` // the number of quarantined messages
+	Released   time.Time // set once an admin releases the sender
+	ReleasedBy string    `datastore:",noindex"`
+}
+
+// QuarantinedEmail keeps an incoming message of a quarantined sender for review.
+// The parent is the QuarantinedSender entity.
+type QuarantinedEmail struct {
+	Time      time.Time
+	MessageID string `datastore:",noindex"`
+	Subject   string `datastore:",noindex"`
+	Body      []byte `datastore:",noindex"` // truncated to maxQuarantinedBody
+}
+
+// EmailSenderWindow keeps the times of the recent auto-generated emails of a sender
+// if memcache is not available (see email_loop.go). The entity key is the canonical address.
+type EmailSenderWindow struct {
+	Times []time.Time `datastore:",noindex"`
+}
+
+// CorpusImport tracks the transfer of the corpus of one manager to another manager
+// (see corpus_transfer.go).
+type CorpusImport struct {
+	Namespace       string
+	Manager         string
+	SourceNamespace string
+	SourceManager   string
+	State           string
+	Created         time.Time
+	CreatedBy       string    `datastore:",noindex"`
+	Digest          string    `datastore:",noindex"` // the digest of the transferred corpus
+	Offered         time.Time `datastore:",noindex"` // when the target manager got the URL last time
+	Attempts        int       `datastore:",noindex"`
+	Finished        time.Time `datastore:",noindex"`
+	Imported        int       `datastore:",noindex"` // the number of programs added by the target manager
+	Error           string    `datastore:",noindex"`
+}
+
+const (
+	corpusImportWaiting   = "waiting for export"
+	corpusImportReady     = "ready"
+	corpusImportImporting = "importing"
+	corpusImportDone      = "done"
+	corpusImportFailed    = "failed"
+)
+
+// DiscussionExport tracks the progress of an export of all discussions for research purposes.
+// The exported data is stored in textDiscussionExport chunks.
+type DiscussionExport struct {
+	Started     time.Time
+	Finished    time.Time
+	Cursor      string  `datastore:",noindex"`
+	Salt        string  `datastore:",noindex"` // used to hash author identities
+	Chunks      []int64 `datastore:",noindex"`
+	Discussions int     `datastore:",noindex"`
+}
+
+// NamespaceBootstrap tracks the progress of seeding the Target namespace with the bugs of
+// the Source namespace. The entity key is the Target namespace.
+type NamespaceBootstrap struct {
+	Source      string
+	Target      string
+	BranchPoint time.Time
+	User        string
+	Started     time.Time
+	Finished    time.Time
+	Cursor      string `datastore:",noindex"`
+	Processed   int    `datastore:",noindex"`
+	Seeded      int    `datastore:",noindex"`
+}
+
+// NamespaceDeletion tracks the deletion of all data of a decommissioned namespace.
+// The entity key is the namespace.
+type NamespaceDeletion struct {
+	Namespace   string
+	Token       string `datastore:",noindex"` // must be presented to confirm the deletion
+	RequestedBy string `datastore:",noindex"`
+	Requested   time.Time
+	ConfirmedBy string `datastore:",noindex"`
+	Confirmed   time.Time
+	Finished    time.Time
+	Updated     time.Time `datastore:",noindex"`
+	// Phase is the index of the current phase in namespaceDeletionPhases,
+	// Cursor is the position within the phase.
+	Phase  int    `datastore:",noindex"`
+	Cursor string `datastore:",noindex"`
+	// Deleted is the number of deleted entities per kind.
+	Deleted []NamespaceDeletionCount `datastore:",noindex"`
+	// Assets is the number of the released build and crash assets.
+	Assets int `datastore:",noindex"`
+	// Detached is the number of discussions that also reference bugs of other namespaces,
+	// they are not deleted, only the references to the namespace bugs are removed.
+	Detached int `datastore:",noindex"`
+	// Remaining is the result of the final verification pass.
+	Remaining []NamespaceDeletionCount `datastore:",noindex"`
+	Error     string                   `datastore:",noindex"`
+}
+
+type NamespaceDeletionCount struct {
+	Kind  string
+	Count int
+}
+
+// BugShareLink is the audit record of a link that gives read-only access to a single bug.
+// The entity key is the random link ID that is a part of the signed link token.
+type BugShareLink struct {
+	Namespace  string
+	BugID      string // the bug key hash
+	User       string // who generated the link
+	Created    time.Time
+	Expires    time.Time
+	Revoked    time.Time
+	RevokedBy  string    `datastore:",noindex"`
+	Accesses   int64     `datastore:",noindex"`
+	LastAccess time.Time `datastore:",noindex"`
+}
+
+// TopCrashersSnapshot is the weekly ranking of the most frequently crashing open bugs
+// of a namespace, see top_crashers.go. The entity key is "namespace-YYYYMMDD".
+type TopCrashersSnapshot struct {
+	Namespace string
+	Date      int          // YYYYMMDD
+	Entries   []TopCrasher `datastore:",noindex"` // sorted by rank
+}
+
+type TopCrasher struct {
+	BugID   string
+	Title   string
+	Crashes int64 // during the week before the snapshot
+}
+
+// FixTimeStats is the daily snapshot of the time-to-fix statistics of a namespace,
+// see fix_times.go. The entity key is the namespace name.
+type FixTimeStats struct {
+	Namespace string
+	Computed  time.Time
+	// Excluded is the number of fixed bugs that were never reported publicly or have no known fix time.
+	Excluded int
+	Groups   []FixTimeGroup `datastore:",noindex"`
+}
+
+type FixTimeGroup struct {
+	Window    string // e.g. "90d"
+	Dimension string // e.g. "repro"
+	Value     string // e.g. "C repro"
+	Bugs      int
+	P50       time.Duration
+	P75       time.Duration
+	P90       time.Duration
+}
+
+// BulkBugUpdate is the audit record of a bulk bug status update done via the bulk_update_bugs API
+// or the /bulk_update handler.
+type BulkBugUpdate struct {
+	Namespace string
+	Client    string // empty for the updates done by signed in users
+	User      string
+	Action    string
+	Time      time.Time
+	IDs       []string `datastore:",noindex"`
+	Applied   int      `datastore:",noindex"`
+}
+
+// DiscussionMergeCandidate is a proposal to merge two discussions that likely represent the same thread.
+// The proposals are reviewed by admins on the admin page.
+type DiscussionMergeCandidate struct {
+	Source  string
+	FromID  string
+	ToID    string
+	Reason  string `datastore:",noindex"`
+	Created time.Time
+	// Rejected proposals are kept so that they are not proposed again.
+	Rejected bool
+}
+
+func (dmc *DiscussionMergeCandidate) key(c context.Context) *db.Key {
+	return db.NewKey(c, "DiscussionMergeCandidate", dmc.id(), 0, nil)
+}
+
+func (dmc *DiscussionMergeCandidate) id() string {
+	return hash.String([]byte(dmc.Source), []byte(dmc.FromID), []byte(dmc.ToID))
+}
+
+// PendingSummaryDelta is a discussion summary update of a bug that has not been applied yet.
+// Each delta is a separate entity, so saving them does not contend on the bug.
+type PendingSummaryDelta struct {
+	Bug     string // the bug key
+	Source  string
+	Delta   DiscussionSummary
+	Created time.Time
+}
+
+// DiscussionMismatch records a divergence between Bug.DiscussionInfo and the Discussion entities
+// that was too big to be fixed automatically.
+type DiscussionMismatch struct {
+	BugKey   string
+	Source   string
+	Stored   DiscussionSummary
+	Computed DiscussionSummary
+	Time     time.Time
+}
+
+func discussionMismatchKey(c context.Context, bugKey, source string) *db.Key {
+	return db.NewKey(c, "DiscussionMismatch", fmt.Sprintf("%v-%v", bugKey, source), 0, nil)
+}
+
+// DiscussionCheckState is a singleton that keeps the position of the periodic discussion summary check.
+type DiscussionCheckState struct {
+	Cursor string `datastore:",noindex"`
+}
+
+func discussionCheckStateKey(c context.Context) *db.Key {
+	return db.NewKey(c, "DiscussionCheckState", "", 1, nil)
+}
+
+// DiscussionAlias redirects the ID of a discussion that was merged into another one to the merge target.
+// The key is the same as the key of the merged discussion was.
+type DiscussionAlias struct {
+	Source   string
+	ID       string
+	TargetID string
+	Created  time.Time
+}
+
+func discussionAliasKey(c context.Context, source, id string) *db.Key {
+	return db.NewKey(c, "DiscussionAlias", fmt.Sprintf("%v-%v", source, id), 0, nil)
 }
 
 func discussionKey(c context.Context, source, id string) *db.Key {
@@ -368,11 +1079,29 @@ type DiscussionMessage struct {
 	// Let's use a shorter name to save space.
 	External bool      `datastore:"e"`
 	Time     time.Time `datastore:",noindex"`
+	// AutoReply is true for vacation responders and other auto-generated messages.
+	// Such messages are stored, but are not accounted in DiscussionSummary.
+	AutoReply bool `datastore:"a"`
+	// ReceivedTime is the server time when the message was saved.
+	// Time comes from the Date header and may be off due to wrong client clocks/timezones.
+	// It is empty for messages saved before the field was introduced.
+	ReceivedTime time.Time `datastore:"r,noindex"`
+	// Sentiment is the result of classifySentiment over the message excerpt.
+	// Full excerpts are not stored per message, as they would not fit into the entity size limit.
+	Sentiment string `datastore:"s,noindex"`
+	// The domain and a hash of the sender address that allows to tell senders apart.
+	AuthorDomain string `datastore:"d,noindex"`
+	AuthorHash   string `datastore:"h,noindex"`
+	// Author is the full sender address. It is only stored for patch discussions,
+	// whose participants are CCed once the fix lands.
+	Author string `datastore:"f,noindex"`
 }
 
 // ReportingState holds dynamic info associated with reporting.
 type ReportingState struct {
 	Entries []ReportingStateEntry
+	// The bugs that needReport held because of the reporting window, they are not saved.
+	windowQueued []*Bug
 }
 
 type ReportingStateEntry struct {
@@ -467,17 +1196,27 @@ type Job struct {
 	Manager   string
 	BugTitle  string
 	CrashID   int64
+	// The repro level of the crash at the time of the bisection (see needBisectionRetry).
+	ReproLevel dashapi.ReproLevel
 
 	// Provided by user:
 	KernelRepo   string
 	KernelBranch string
 	Patch        int64 // reference to Patch text entity
 	KernelConfig int64 // reference to the kernel config entity
+	// For automatic tests of posted patches, identifies the thread and the patch version.
+	AutoTest string
+	// TestOn is the manager or arch requested with "#syz test-on", TestOnManagers are the managers
+	// that satisfy it, TestOnTimedOut is set if none of them took the job (see test_on.go).
+	TestOn         string
+	TestOnManagers []string `datastore:",noindex"`
+	TestOnTimedOut bool
 
 	Attempts    int       // number of times we tried to execute this job
 	IsRunning   bool      // the job might have been started, but never finished
 	LastStarted time.Time `datastore:"Started"`
 	Finished    time.Time // if set, job is finished
+	Cancelled   bool      // the job was cancelled by an admin before it started, Finished is also set
 
 	// Result of execution:
 	CrashTitle  string // if empty, we did not hit crash during testing
@@ -488,10 +1227,30 @@ type Job struct {
 	Log         int64 // reference to Log text entity
 	Error       int64 // reference to Error text entity, if set job failed
 	Flags       JobFlags
+	// TestRepeats is the number of test rounds per commit for the bisections requested
+	// with "#syz retest-bisect" (0 means the default).
+	TestRepeats int `datastore:",noindex"`
+	// The bisection details recorded by syz-ci and the resulting confidence (see bisect_confidence.go).
+	Revisions         []dashapi.BisectRevision `datastore:",noindex"`
+	GuiltyFile        string                   `datastore:",noindex"`
+	TouchesGuiltyFile bool                     `datastore:",noindex"`
+	Confidence        BisectConfidence         `datastore:",noindex"`
+	ConfidenceNotes   []string                 `datastore:",noindex"`
+	// ReproID is the uploaded reproducer the job runs instead of the crash one (see bug_repros.go).
+	ReproID int64 `datastore:",noindex"`
 
 	Reported bool // have we reported result back to user?
 }
 
+func (crash *Crash) reproLevel() dashapi.ReproLevel {
+	if crash.ReproC != 0 {
+		return ReproLevelC
+	} else if crash.ReproSyz != 0 {
+		return ReproLevelSyz
+	}
+	return ReproLevelNone
+}
+
 func (job *Job) IsFinished() bool {
 	return !job.Finished.IsZero()
 }
@@ -502,6 +1261,8 @@ const (
 	JobTestPatch JobType = iota
 	JobBisectCause
 	JobBisectFix
+	JobMinimize
+	JobMinimizeConfig
 )
 
 func (typ JobType) toDashapiReportType() dashapi.ReportType {
@@ -572,9 +1333,12 @@ const (
 	textReproC       = "ReproC"
 	textMachineInfo  = "MachineInfo"
 	textKernelConfig = "KernelConfig"
+	textVMConfig     = "VMConfig"
 	textPatch        = "Patch"
 	textLog          = "Log"
 	textError        = "Error"
+	// Chunks of DiscussionExport in the JSON Lines format.
+	textDiscussionExport = "DiscussionExportChunk"
 )
 
 const (
@@ -601,6 +1365,14 @@ const (
 	BuildJob
 )
 
+type BugReportingMode int
+
+const (
+	ReportingModeNormal BugReportingMode = iota
+	ReportingModeDigest
+	ReportingModePromoted
+)
+
 type BisectStatus int
 
 const (
@@ -793,7 +1565,11 @@ func (bug *Bug) key(c context.Context) *db.Key {
 }
 
 func (bug *Bug) keyHash() string {
-	return bugKeyHash(bug.Namespace, bug.Title, bug.Seq)
+	title := bug.Title
+	if bug.KeyTitle != "" {
+		title = bug.KeyTitle
+	}
+	return bugKeyHash(bug.Namespace, title, bug.Seq)
 }
 
 func bugKeyHash(ns, title string, seq int64) string {
@@ -845,6 +1621,23 @@ func (bug *Bug) updateCommits(commits []string, now time.Time) {
 	bug.NeedCommitInfo = true
 	bug.FixTime = now
 	bug.PatchedOn = nil
+	bug.PatchedSince = nil
+	bug.FixedBuildCrashes = nil
+	bug.ReleasesDone = false
+	bug.FixCommitConflict = false
+}
+
+// setAssignee assigns the bug to addr, an empty addr unassigns the bug.
+func (bug *Bug) setAssignee(addr string, now time.Time) {
+	addr = email.CanonicalEmail(addr)
+	if addr == bug.AssigneeEmail {
+		return
+	}
+	bug.AssigneeEmail = addr
+	bug.AssignedTime = now
+	if addr == "" {
+		bug.AssignedTime = time.Time{}
+	}
 }
 
 func (bug *Bug) getCommitInfo(i int) Commit {
@@ -0,0 +1,158 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/vcs"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+// External CI systems (e.g. vendor syzkaller instances) may tell that they also see an existing bug
+// without reporting their crashes to a namespace of their own. The observations are only shown
+// on the bug page and don't affect the crash statistics of the bug.
+
+const (
+	// Only the latest observations are kept to limit the size of the bug entity.
+	maxExternalObservations = 20
+	// The number of observations a client may report per hour.
+	maxExternalObservationsRate = 60
+)
+
+var externalReporterTagRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,49}$`)
+
+func apiReportExternalObservation(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	req := new(dashapi.ExternalObservationReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	if !externalReporterTagRe.MatchString(req.ReporterTag) {
+		return nil, fmt.Errorf("bad reporter tag %q", req.ReporterTag)
+	}
+	if !vcs.CheckCommitHash(req.KernelCommit) {
+		return nil, fmt.Errorf("bad kernel commit %q", req.KernelCommit)
+	}
+	if req.Count <= 0 {
+		return nil, fmt.Errorf("bad crash count %v", req.Count)
+	}
+	client := r.PostFormValue("client")
+	if err := throttleExternalObservations(c, client); err != nil {
+		return nil, err
+	}
+	now := timeNow(c)
+	lastSeen := req.LastSeen
+	if lastSeen.IsZero() || lastSeen.After(now) {
+		lastSeen = now
+	}
+	bugKey := db.NewKey(c, "Bug", req.BugID, 0, nil)
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			if err == db.ErrNoSuchEntity {
+				return fmt.Errorf("no such bug %v", req.BugID)
+			}
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		if bug.Namespace != ns {
+			return fmt.Errorf("no such bug %v", req.BugID)
+		}
+		bug.addExternalObservation(ExternalObservation{
+			Reporter:     req.ReporterTag,
+			Client:       client,
+			KernelCommit: req.KernelCommit,
+			Count:        int64(req.Count),
+			LastSeen:     lastSeen,
+		})
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return nil, err
+	}
+	log.Infof(c, "bug %v: observed by %v (%v) on %v", req.BugID, req.ReporterTag, client, req.KernelCommit)
+	return nil, nil
+}
+
+// throttleExternalObservations limits the number of observations per client and hour.
+func throttleExternalObservations(c context.Context, client string) error {
+	key := fmt.Sprintf("external-observations-%v-%v", client, timeNow(c).Unix()/3600)
+	count, err := memcache.Increment(c, key, 1, 0)
+	if err != nil {
+		// Don't reject the observation just because memcache is unavailable.
+		log.Errorf(c, "failed to count external observations: %v", err)
+		return nil
+	}
+	if count > maxExternalObservationsRate {
+		return fmt.Errorf("client %v reports too many external observations, try again later", client)
+	}
+	return nil
+}
+
+// addExternalObservation merges the repeated observations of the same system on the same commit.
+func (bug *Bug) addExternalObservation(obs ExternalObservation) {
+	for i, old := range bug.ExternalObservations {
+		if old.Reporter != obs.Reporter || old.KernelCommit != obs.KernelCommit {
+			continue
+		}
+		obs.Count += old.Count
+		if obs.LastSeen.Before(old.LastSeen) {
+			obs.LastSeen = old.LastSeen
+		}
+		bug.ExternalObservations = append(bug.ExternalObservations[:i], bug.ExternalObservations[i+1:]...)
+		break
+	}
+	bug.ExternalObservations = append(bug.ExternalObservations, obs)
+	if len(bug.ExternalObservations) > maxExternalObservations {
+		bug.ExternalObservations = bug.ExternalObservations[len(bug.ExternalObservations)-maxExternalObservations:]
+	}
+}
+
+// lastCrashTime returns the time of the last crash of the bug for the purposes of obsoletion.
+func (bug *Bug) lastCrashTime() time.Time {
+	last := bug.LastTime
+	if !config.Namespaces[bug.Namespace].CountExternalObservations {
+		return last
+	}
+	for _, obs := range bug.ExternalObservations {
+		if last.Before(obs.LastSeen) {
+			last = obs.LastSeen
+		}
+	}
+	return last
+}
+
+type uiExternalObservation struct {
+	Reporter     string
+	KernelCommit string
+	Count        int64
+	LastSeen     time.Time
+}
+
+func makeExternalObservationsUI(bug *Bug) []*uiExternalObservation {
+	var ret []*uiExternalObservation
+	for _, obs := range bug.ExternalObservations {
+		ret = append(ret, &uiExternalObservation{
+			Reporter:     obs.Reporter,
+			KernelCommit: obs.KernelCommit,
+			Count:        obs.Count,
+			LastSeen:     obs.LastSeen,
+		})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].LastSeen.After(ret[j].LastSeen)
+	})
+	return ret
+}
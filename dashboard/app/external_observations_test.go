@@ -0,0 +1,112 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestAddExternalObservation(t *testing.T) {
+	now := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	bug := &Bug{}
+	for i := 0; i < maxExternalObservations+5; i++ {
+		bug.addExternalObservation(ExternalObservation{
+			Reporter:     "vendor-ci",
+			KernelCommit: fmt.Sprintf("%040x", i),
+			Count:        1,
+			LastSeen:     now,
+		})
+	}
+	if len(bug.ExternalObservations) != maxExternalObservations {
+		t.Fatalf("got %v observations", len(bug.ExternalObservations))
+	}
+	// A repeated observation is merged and becomes the latest one.
+	commit := bug.ExternalObservations[0].KernelCommit
+	bug.addExternalObservation(ExternalObservation{
+		Reporter:     "vendor-ci",
+		KernelCommit: commit,
+		Count:        2,
+		LastSeen:     now.Add(-time.Hour),
+	})
+	if len(bug.ExternalObservations) != maxExternalObservations {
+		t.Fatalf("got %v observations", len(bug.ExternalObservations))
+	}
+	last := bug.ExternalObservations[maxExternalObservations-1]
+	if last.KernelCommit != commit || last.Count != 3 || !last.LastSeen.Equal(now) {
+		t.Fatalf("bad merged observation: %+v", last)
+	}
+}
+
+func TestExternalObservation(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	rep := c.client.pollBug()
+	bug, _, _ := c.loadBug(rep.ID)
+
+	req := &dashapi.ExternalObservationReq{
+		BugID:        bug.keyHash(),
+		KernelCommit: "1234567890123456789012345678901234567890",
+		Count:        3,
+		LastSeen:     timeNow(c.ctx),
+		ReporterTag:  "vendor-ci",
+	}
+	c.expectOK(c.client.ReportExternalObservation(req))
+	c.expectOK(c.client.ReportExternalObservation(req))
+
+	client := c.makeClient(client1, password1, false)
+	bad := *req
+	bad.KernelCommit = "master"
+	c.expectFail("bad kernel commit", client.ReportExternalObservation(&bad))
+	bad = *req
+	bad.ReporterTag = "<script>"
+	c.expectFail("bad reporter tag", client.ReportExternalObservation(&bad))
+	// The bug belongs to a different namespace.
+	client2 := c.makeClient(client2, password2, false)
+	c.expectFail("no such bug", client2.ReportExternalObservation(req))
+
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(len(bug.ExternalObservations), 1)
+	c.expectEQ(bug.ExternalObservations[0].Count, int64(6))
+	c.expectEQ(bug.ExternalObservations[0].Client, client1)
+	c.expectEQ(bug.NumCrashes, int64(1))
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Also observed by vendor-ci")))
+
+	for i := 2; i < maxExternalObservationsRate; i++ {
+		c.expectOK(client.ReportExternalObservation(req))
+	}
+	c.expectFail("too many external observations", client.ReportExternalObservation(req))
+	c.advanceTime(time.Hour)
+	c.expectOK(client.ReportExternalObservation(req))
+}
+
+func TestExternalObservationObsoletion(t *testing.T) {
+	now := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	bug := &Bug{
+		Namespace: "test1",
+		LastTime:  now.Add(-100 * 24 * time.Hour),
+		ExternalObservations: []ExternalObservation{
+			{Reporter: "vendor-ci", LastSeen: now},
+		},
+	}
+	if got := bug.lastCrashTime(); !got.Equal(bug.LastTime) {
+		t.Fatalf("external observations are counted by default: %v", got)
+	}
+	config.Namespaces["test1"].CountExternalObservations = true
+	defer func() { config.Namespaces["test1"].CountExternalObservations = false }()
+	if got := bug.lastCrashTime(); !got.Equal(now) {
+		t.Fatalf("external observations are not counted: %v", got)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/html"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+// /feed?ns=...&type=new|fixed|all serves an Atom feed of the bugs of a namespace that were
+// reported or got fix commits during the last feedPeriod. The feed is anonymous, so it only
+// includes what is visible with AccessPublic. The generated XML is cached in memcache
+// and is served with an ETag, so that the feed readers can poll it with conditional GETs.
+// Entry IDs only depend on the bug and on the fix commits, so they don't change
+// when the feed is regenerated.
+
+const (
+	feedPeriod   = 30 * 24 * time.Hour
+	feedCacheTTL = 5 * time.Minute
+)
+
+const (
+	feedTypeAll   = "all"
+	feedTypeNew   = "new"
+	feedTypeFixed = "fixed"
+)
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Links   []atomLink   `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary"`
+
+	time time.Time
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func handleFeed(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns := r.FormValue("ns")
+	if config.Namespaces[ns] == nil {
+		return fmt.Errorf("%w: unknown namespace %q", ErrClientBadRequest, ns)
+	}
+	if config.Namespaces[ns].AccessLevel != AccessPublic {
+		return fmt.Errorf("%w: namespace %q has no public feed", ErrAccess, ns)
+	}
+	feedType := r.FormValue("type")
+	switch feedType {
+	case "":
+		feedType = feedTypeAll
+	case feedTypeAll, feedTypeNew, feedTypeFixed:
+	default:
+		return fmt.Errorf("%w: unknown feed type %q", ErrClientBadRequest, feedType)
+	}
+	data, err := cachedFeed(c, ns, feedType)
+	if err != nil {
+		return err
+	}
+	etag := fmt.Sprintf("%q", hash.String(data))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%v", int(feedCacheTTL.Seconds())))
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(match) == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	_, err = w.Write(data)
+	return err
+}
+
+func feedCacheKey(ns, feedType string) string {
+	return fmt.Sprintf("feed-%v-%v", ns, feedType)
+}
+
+func cachedFeed(c context.Context, ns, feedType string) ([]byte, error) {
+	key := feedCacheKey(ns, feedType)
+	if item, err := memcache.Get(c, key); err == nil {
+		return item.Value, nil
+	} else if err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to get the cached feed: %v", err)
+	}
+	feed, err := makeFeed(c, ns, feedType)
+	if err != nil {
+		return nil, err
+	}
+	data, err := xml.MarshalIndent(feed, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the feed: %w", err)
+	}
+	data = append([]byte(xml.Header), data...)
+	item := &memcache.Item{
+		Key:        key,
+		Value:      data,
+		Expiration: feedCacheTTL,
+	}
+	if err := memcache.Set(c, item); err != nil {
+		log.Errorf(c, "failed to cache the feed: %v", err)
+	}
+	return data, nil
+}
+
+func makeFeed(c context.Context, ns, feedType string) (*atomFeed, error) {
+	bugs, _, err := loadNamespaceBugs(c, ns)
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow(c)
+	since := now.Add(-feedPeriod)
+	url := appURL(c)
+	feedURL := fmt.Sprintf("%v/feed?ns=%v&type=%v", url, ns, feedType)
+	feed := &atomFeed{
+		ID:    feedURL,
+		Title: fmt.Sprintf("syzbot %v: %v bugs", ns, feedType),
+		Links: []atomLink{
+			{Href: feedURL, Rel: "self"},
+			{Href: fmt.Sprintf("%v/%v", url, ns)},
+		},
+	}
+	for _, bug := range bugs {
+		if bug.sanitizeAccess(AccessPublic) > AccessPublic {
+			continue
+		}
+		if feedType != feedTypeFixed {
+			if reported := bugPublicReportTime(bug); reported.After(since) &&
+				bug.Status != BugStatusInvalid && bug.Status != BugStatusDup {
+				feed.Entries = append(feed.Entries, makeFeedEntry(bug, url, feedTypeNew, reported,
+					fmt.Sprintf("First crashed: %v\nReported: %v",
+						html.FormatTime(bug.FirstTime), html.FormatTime(reported))))
+			}
+		}
+		if feedType != feedTypeNew {
+			if len(bug.Commits) != 0 && bug.FixTime.After(since) {
+				feed.Entries = append(feed.Entries, makeFeedEntry(bug, url, feedTypeFixed, bug.FixTime,
+					"Fix commits:\n"+strings.Join(bug.Commits, "\n")))
+			}
+		}
+	}
+	sort.Slice(feed.Entries, func(i, j int) bool {
+		if !feed.Entries[i].time.Equal(feed.Entries[j].time) {
+			return feed.Entries[i].time.After(feed.Entries[j].time)
+		}
+		return feed.Entries[i].ID < feed.Entries[j].ID
+	})
+	// The feed is updated when its latest entry is, this keeps the ETag stable
+	// as long as there are no new entries.
+	updated := since
+	if len(feed.Entries) != 0 {
+		updated = feed.Entries[0].time
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	return feed, nil
+}
+
+// bugPublicReportTime returns when the bug was reported to the first public reporting.
+func bugPublicReportTime(bug *Bug) time.Time {
+	ns := config.Namespaces[bug.Namespace]
+	for i := range bug.Reporting {
+		bugReporting := &bug.Reporting[i]
+		reporting := ns.ReportingByName(bugReporting.Name)
+		if reporting != nil && reporting.AccessLevel == AccessPublic {
+			return bugReporting.Reported
+		}
+	}
+	return time.Time{}
+}
+
+func makeFeedEntry(bug *Bug, url, kind string, when time.Time, summary string) *atomEntry {
+	title := bug.displayTitle()
+	var subsystems []string
+	for _, item := range bug.Tags.Subsystems {
+		subsystems = append(subsystems, item.Name)
+	}
+	if len(subsystems) != 0 {
+		title = fmt.Sprintf("[%v] %v", strings.Join(subsystems, ", "), title)
+	}
+	link := url + bugLink(bug.keyHash())
+	id := fmt.Sprintf("%v#%v", link, kind)
+	if kind == feedTypeFixed {
+		title = "Fixed: " + title
+		// The bug may get other fix commits later, that's a new entry.
+		id += "-" + hash.String([]byte(strings.Join(bug.Commits, "\n")))
+	} else {
+		title = "New: " + title
+	}
+	entry := &atomEntry{
+		ID:      id,
+		Title:   title,
+		Updated: when.UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Href: link}},
+		Categories: []atomCategory{
+			{Term: crashTitleType(bug.Title)},
+		},
+		Summary: summary,
+		time:    when,
+	}
+	for _, name := range subsystems {
+		entry.Categories = append(entry.Categories, atomCategory{Term: name})
+	}
+	return entry
+}
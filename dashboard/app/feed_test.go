@@ -0,0 +1,125 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestFeed(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.Title = "KASAN: use-after-free Read in foo"
+	crash.GuiltyFiles = []string{"a.c"}
+	client.ReportCrash(crash)
+	msg := client.pollEmailBug()
+	_, extID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+
+	feed := c.getFeed("/feed?ns=access-public-email")
+	c.expectEQ(feed.XMLName, xml.Name{Space: "http://www.w3.org/2005/Atom", Local: "feed"})
+	c.expectEQ(len(feed.Entries), 1)
+	entry := feed.Entries[0]
+	c.expectEQ(entry.Title, "New: [subsystemA] KASAN: use-after-free Read in foo")
+	c.expectEQ(entry.Categories, []atomCategory{{Term: "KASAN: use-after-free Read"}, {Term: "subsystemA"}})
+	c.expectTrue(strings.HasSuffix(entry.ID, "#new"))
+	c.expectEQ(feed.Updated, entry.Updated)
+	newID := entry.ID
+
+	// The fix commit adds an entry, the old one stays as is.
+	c.advanceTime(time.Hour)
+	build.FixCommits = []dashapi.Commit{{Title: "foo: fix the crash", BugIDs: []string{extID}}}
+	client.UploadBuild(build)
+	c.advanceTime(feedCacheTTL + time.Minute)
+	feed = c.getFeed("/feed?ns=access-public-email&type=all")
+	c.expectEQ(len(feed.Entries), 2)
+	c.expectEQ(feed.Entries[0].Title, "Fixed: [subsystemA] KASAN: use-after-free Read in foo")
+	c.expectEQ(feed.Entries[1].ID, newID)
+	fixedID := feed.Entries[0].ID
+
+	// Entry IDs don't change when the feed is regenerated.
+	for _, feedType := range []string{feedTypeAll, feedTypeNew, feedTypeFixed} {
+		regenerated, err := makeFeed(c.ctx, "access-public-email", feedType)
+		c.expectOK(err)
+		for _, entry := range regenerated.Entries {
+			c.expectTrue(entry.ID == newID || entry.ID == fixedID)
+		}
+	}
+	feed = c.getFeed("/feed?ns=access-public-email&type=fixed")
+	c.expectEQ(len(feed.Entries), 1)
+	c.expectEQ(feed.Entries[0].ID, fixedID)
+
+	// The entries expire after 30 days.
+	c.advanceTime(feedPeriod)
+	feed = c.getFeed("/feed?ns=access-public-email&type=all")
+	c.expectEQ(len(feed.Entries), 0)
+
+	// Non-public namespaces have no feeds.
+	_, err = c.AuthGET(AccessPublic, "/feed?ns=test1")
+	c.expectNE(err, nil)
+	_, err = c.AuthGET(AccessPublic, "/feed?ns=access-public-email&type=foo")
+	c.expectBadReqest(err)
+}
+
+func TestFeedETag(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.publicClient.UploadBuild(build)
+	c.publicClient.ReportCrash(testCrash(build, 1))
+	c.publicClient.pollEmailBug()
+
+	w := c.feedRequest("/feed?ns=access-public-email", "")
+	c.expectEQ(w.Code, http.StatusOK)
+	c.expectEQ(w.Header().Get("Content-Type"), "application/atom+xml; charset=utf-8")
+	etag := w.Header().Get("ETag")
+	c.expectNE(etag, "")
+
+	w = c.feedRequest("/feed?ns=access-public-email", etag)
+	c.expectEQ(w.Code, http.StatusNotModified)
+	c.expectEQ(w.Body.Len(), 0)
+
+	// The ETag stays the same after the cache expires.
+	c.advanceTime(feedCacheTTL + time.Minute)
+	w = c.feedRequest("/feed?ns=access-public-email", `"foo", `+etag)
+	c.expectEQ(w.Code, http.StatusNotModified)
+
+	w = c.feedRequest("/feed?ns=access-public-email&type=fixed", etag)
+	c.expectEQ(w.Code, http.StatusOK)
+}
+
+func (c *Ctx) getFeed(url string) *atomFeed {
+	reply, err := c.AuthGET(AccessPublic, url)
+	c.expectOK(err)
+	feed := new(atomFeed)
+	c.expectOK(xml.Unmarshal(reply, feed))
+	return feed
+}
+
+func (c *Ctx) feedRequest(url, ifNoneMatch string) *httptest.ResponseRecorder {
+	r, err := c.inst.NewRequest("GET", url, nil)
+	c.expectOK(err)
+	r = registerRequest(r, c)
+	r = r.WithContext(c.transformContext(r.Context()))
+	if ifNoneMatch != "" {
+		r.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// A single patch series often fixes several bugs at once: one commit may have several
+// Reported-by tags, or several bugs may wait for the same commit title (see "#syz fix").
+// addCommitsToBugs processes all bugs affected by a commit upload as one batch:
+//   - a failure to update one bug does not prevent the rest of the batch from being updated,
+//     and the bugs that are already fixed or invalid are just skipped;
+//   - the bugs fixed by the same commit remember each other in Bug.FixedTogetherWith,
+//     which is shown on the bug page;
+//   - the bugs that get closed at once and were discussed in the same patch thread get
+//     a single combined announcement (see announceLandedFixes).
+
+// Only that many bugs fixed together are remembered per bug.
+const maxFixedTogetherWith = 20
+
+// fixBatch is the state of an addCommitsToBugs call.
+type fixBatch struct {
+	manager        string
+	managers       []string
+	presentCommits map[string]bool
+	bugFixedBy     map[string][]string // bug reporting ID -> fix commit titles
+	seenBugIDs     map[string]bool     // the reporting IDs of the open and dup bugs
+	fixedBugs      []*Bug              // the bugs that were closed as fixed
+	err            error               // the first error, the rest are only logged
+}
+
+func (batch *fixBatch) addCommitsToBug(c context.Context, bug *Bug, fixCommits []string) {
+	fixedBug, err := addCommitsToBug(c, bug, batch.manager, batch.managers, fixCommits, batch.presentCommits)
+	if err != nil {
+		batch.fail(c, bug, err)
+		return
+	}
+	if fixedBug != nil {
+		batch.fixedBugs = append(batch.fixedBugs, fixedBug)
+	}
+}
+
+func (batch *fixBatch) fail(c context.Context, bug *Bug, err error) {
+	log.Errorf(c, "failed to add fix commits to %q: %v", bug.Title, err)
+	if batch.err == nil {
+		batch.err = err
+	}
+}
+
+// recordFixBatches cross-references the bugs of the namespace that are fixed by the same commits.
+func recordFixBatches(c context.Context, ns string, titles []string) error {
+	var firstErr error
+	for _, title := range titles {
+		keys, err := db.NewQuery("Bug").
+			Filter("Namespace=", ns).
+			Filter("Commits=", title).
+			KeysOnly().
+			GetAll(c, nil)
+		if err != nil {
+			return fmt.Errorf("failed to query bugs: %w", err)
+		}
+		if len(keys) < 2 {
+			continue
+		}
+		var hashes []string
+		for _, key := range keys {
+			hashes = append(hashes, key.StringID())
+		}
+		for _, key := range keys {
+			if err := addFixedTogetherWith(c, key, hashes); err != nil {
+				log.Errorf(c, "failed to record the fix batch of %v: %v", key.StringID(), err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	return firstErr
+}
+
+func addFixedTogetherWith(c context.Context, bugKey *db.Key, hashes []string) error {
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		if !bug.mergeFixedTogetherWith(bugKey.StringID(), hashes) {
+			return nil
+		}
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+// mergeFixedTogetherWith adds the hashes (except for the bug own one) and says whether anything changed.
+func (bug *Bug) mergeFixedTogetherWith(self string, hashes []string) bool {
+	changed := false
+	for _, hash := range hashes {
+		if hash == self || stringInList(bug.FixedTogetherWith, hash) {
+			continue
+		}
+		bug.FixedTogetherWith = append(bug.FixedTogetherWith, hash)
+		changed = true
+	}
+	if len(bug.FixedTogetherWith) > maxFixedTogetherWith {
+		bug.FixedTogetherWith = bug.FixedTogetherWith[len(bug.FixedTogetherWith)-maxFixedTogetherWith:]
+	}
+	return changed
+}
+
+func makeFixedTogetherUI(c context.Context, bug *Bug, accessLevel AccessLevel) ([]*uiSimilarBug, error) {
+	var ret []*uiSimilarBug
+	for _, hash := range bug.FixedTogetherWith {
+		other := new(Bug)
+		if err := db.Get(c, db.NewKey(c, "Bug", hash, 0, nil), other); err != nil {
+			if err == db.ErrNoSuchEntity {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get bug %v: %w", hash, err)
+		}
+		if accessLevel < other.sanitizeAccess(accessLevel) {
+			continue
+		}
+		ret = append(ret, &uiSimilarBug{
+			Namespace: other.Namespace,
+			Title:     other.displayTitle(),
+			Link:      bugLink(other.keyHash()),
+			Status:    similarBugStatus(other),
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+func TestMergeFixedTogetherWith(t *testing.T) {
+	bug := &Bug{FixedTogetherWith: []string{"b"}}
+	if !bug.mergeFixedTogetherWith("a", []string{"a", "b", "c"}) {
+		t.Fatalf("no change")
+	}
+	if diff := cmp.Diff([]string{"b", "c"}, bug.FixedTogetherWith); diff != "" {
+		t.Fatal(diff)
+	}
+	if bug.mergeFixedTogetherWith("a", []string{"c", "a"}) {
+		t.Fatalf("unexpected change")
+	}
+}
+
+func TestFixLandedBatchTemplate(t *testing.T) {
+	body := new(bytes.Buffer)
+	err := mailTemplates.ExecuteTemplate(body, "mail_fix_landed.txt", &uiFixLanded{
+		Tree: "upstream",
+		Commits: []*uiCommit{
+			{Hash: "1234567890abcdef", Title: "foo: fix the use-after-free"},
+			{Hash: "abcdef1234567890", Title: "foo: fix the deadlock"},
+		},
+		Link: "https://testapp.appspot.com/bug?extid=abcd",
+		Bugs: []*uiFixLandedBug{
+			{Title: "KASAN: use-after-free Read in foo", Link: "https://testapp.appspot.com/bug?extid=abcd"},
+			{Title: "possible deadlock in foo", Link: "https://testapp.appspot.com/bug?extid=efgh"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "fix_batches", "mail_fix_landed.txt")
+	if *flagUpdate {
+		if err := osutil.MkdirAll(filepath.Dir(golden)); err != nil {
+			t.Fatal(err)
+		}
+		if err := osutil.WriteFile(golden, body.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), body.String()); diff != "" {
+		t.Fatalf("email mismatch (-want +got), run with -update if it's expected:\n%s", diff)
+	}
+}
+
+func TestFixBatch(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build1 := testBuild(1)
+	client.UploadBuild(build1)
+	var extIDs, senders []string
+	for i := 1; i <= 3; i++ {
+		client.ReportCrash(testCrash(build1, i))
+		sender := c.pollEmailBug().Sender
+		_, extID, err := email.RemoveAddrContext(sender)
+		c.expectOK(err)
+		senders = append(senders, sender)
+		extIDs = append(extIDs, extID)
+	}
+	// The third bug is already closed, it must not prevent the rest of the batch from being fixed.
+	c.incomingEmail(senders[2], "#syz invalid")
+
+	thread := c.incomingThread("[PATCH 0/2] foo: fix the crashes", extIDs[0])
+	thread.reply("developer@kernel.org", "Reported-by: "+senders[0]+"\nReported-by: "+senders[1]+"\n")
+	lastID := thread.reply("maintainer@kernel.org", "Applied, thanks!")
+
+	const title = "foo: fix the crashes"
+	c.expectOK(client.UploadCommits([]dashapi.Commit{{
+		Hash:   "1234567890abcdef",
+		Title:  title,
+		BugIDs: extIDs,
+	}}))
+	var bugs []*Bug
+	for _, extID := range extIDs[:2] {
+		bug, _, _ := c.loadBug(extID)
+		c.expectEQ(bug.Commits, []string{title})
+		bugs = append(bugs, bug)
+	}
+	c.expectEQ(bugs[0].FixedTogetherWith, []string{bugs[1].keyHash()})
+	c.expectEQ(bugs[1].FixedTogetherWith, []string{bugs[0].keyHash()})
+	bug3, _, _ := c.loadBug(extIDs[2])
+	c.expectEQ(bug3.Status, BugStatusInvalid)
+	c.expectEQ(len(bug3.Commits), 0)
+
+	page, err := c.AuthGET(AccessPublic, "/bug?extid="+extIDs[0])
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Fixed together with:"))
+	c.expectTrue(strings.Contains(string(page), bugs[1].displayTitle()))
+
+	// Both bugs are closed at once with a single announcement.
+	build2 := testBuild(2)
+	build2.Manager = build1.Manager
+	build2.Commits = []string{title}
+	client.UploadBuild(build2)
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.Headers["In-Reply-To"], []string{lastID})
+	c.expectTrue(strings.Contains(msg.Body, "The following bugs are now closed as fixed:"))
+	c.expectTrue(strings.Contains(msg.Body, bugs[0].displayTitle()))
+	c.expectTrue(strings.Contains(msg.Body, bugs[1].displayTitle()))
+	c.expectNoEmail()
+	for _, extID := range extIDs[:2] {
+		bug, _, _ := c.loadBug(extID)
+		c.expectEQ(bug.Status, BugStatusFixed)
+	}
+}
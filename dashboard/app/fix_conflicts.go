@@ -0,0 +1,159 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// A fix commit title may match different commits in the namespace repos, e.g. the original commit
+// in one tree and its re-application after a revert in another. syz-ci reports such conflicts
+// along with the commit info, and the bug is not closed as fixed until an admin pins the right hash.
+
+func (bug *Bug) updateFixCommitConflict() {
+	bug.FixCommitConflict = false
+	for _, info := range bug.CommitInfo {
+		if info.Conflicts != "" && !info.Pinned {
+			bug.FixCommitConflict = true
+		}
+	}
+}
+
+// handlePinFixCommit serves the pin_fix_commit admin action.
+func handlePinFixCommit(c context.Context, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	if err := pinFixCommit(c, bug, r.FormValue("commit"), r.FormValue("hash"), author); err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+// pinFixCommit resolves the fix commit conflict in favor of the given hash.
+func pinFixCommit(c context.Context, bug *Bug, title, hash, author string) error {
+	managers, err := managerList(c, bug.Namespace)
+	if err != nil {
+		return err
+	}
+	now := timeNow(c)
+	bugKey := bug.key(c)
+	var fixedBug *Bug
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		fixedBug = nil
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		ci := -1
+		for i, com := range bug.Commits {
+			if com == title && i < len(bug.CommitInfo) {
+				ci = i
+			}
+		}
+		if ci == -1 {
+			return fmt.Errorf("%w: no commit info for %q", ErrClientBadRequest, title)
+		}
+		info := &bug.CommitInfo[ci]
+		if hash != info.Hash && !stringInList(strings.Split(info.Conflicts, "|"), hash) {
+			return fmt.Errorf("%w: %v is not a candidate for %q", ErrClientBadRequest, hash, title)
+		}
+		if hash != info.Hash {
+			info.Hash = hash
+			info.Release = ""
+			bug.ReleasesDone = false
+		}
+		info.Conflicts = ""
+		info.Pinned = true
+		bug.updateFixCommitConflict()
+		// The bug may have been kept open only because of the conflict.
+		if bug.markFixedIfPatched(managers, now) {
+			bug.recordEvent(BugEvent{
+				Type:    BugEventFixed,
+				Time:    now,
+				Actor:   BugActorAdmin,
+				User:    author,
+				Cause:   eventCause(causePage, "/admin?action=pin_fix_commit"),
+				Details: fmt.Sprintf("%q pinned to %v", title, hash),
+			})
+			fixedBug = bug
+		}
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return saveBugEvents(c, bugKey, bug)
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return err
+	}
+	log.Infof(c, "bug %v: fix commit %q pinned to %v by %v", bug.keyHash(), title, hash, author)
+	if fixedBug != nil && len(fixedBug.PatchedOn) != 0 {
+		if err := announceLandedFix(c, fixedBug, fixedBug.PatchedOn[len(fixedBug.PatchedOn)-1]); err != nil {
+			log.Errorf(c, "failed to announce the fix for %q: %v", fixedBug.Title, err)
+		}
+	}
+	return nil
+}
+
+type uiFixConflict struct {
+	BugID  string
+	Commit string
+	// Hashes are the candidate commits, the currently used one first.
+	Hashes []string
+}
+
+type uiFixConflictBug struct {
+	Namespace string
+	Title     string
+	Link      string
+	Conflicts []*uiFixConflict
+}
+
+func makeFixConflictsUI(bug *Bug) []*uiFixConflict {
+	var ret []*uiFixConflict
+	for i, info := range bug.CommitInfo {
+		if info.Conflicts == "" || info.Pinned || i >= len(bug.Commits) {
+			continue
+		}
+		ret = append(ret, &uiFixConflict{
+			BugID:  bug.keyHash(),
+			Commit: bug.Commits[i],
+			Hashes: append([]string{info.Hash}, strings.Split(info.Conflicts, "|")...),
+		})
+	}
+	return ret
+}
+
+// loadFixConflictBugs returns the bugs that wait for their fix commits to be pinned.
+func loadFixConflictBugs(c context.Context) ([]*uiFixConflictBug, error) {
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("FixCommitConflict=", true).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	var ret []*uiFixConflictBug
+	for _, bug := range bugs {
+		ret = append(ret, &uiFixConflictBug{
+			Namespace: bug.Namespace,
+			Title:     bug.displayTitle(),
+			Link:      bugLink(bug.keyHash()),
+			Conflicts: makeFixConflictsUI(bug),
+		})
+	}
+	return ret, nil
+}
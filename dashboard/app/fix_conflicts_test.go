@@ -0,0 +1,117 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestFixCommitConflict(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build1 := testBuild(1)
+	c.client.UploadBuild(build1)
+	c.client.ReportCrash(testCrash(build1, 1))
+	rep := c.client.pollBug()
+	const title = "foo: fix the crash"
+	reply, _ := c.client.ReportingUpdate(&dashapi.BugUpdate{
+		ID:         rep.ID,
+		Status:     dashapi.BugStatusOpen,
+		FixCommits: []string{title},
+	})
+	c.expectEQ(reply.OK, true)
+
+	// The fix was reverted and re-applied in the main repo, but another repo has the original commit.
+	const reapplied, original = "2222222222222222222222222222222222222222", "1111111111111111111111111111111111111111"
+	c.expectOK(c.client.UploadCommits([]dashapi.Commit{{
+		Hash:              reapplied,
+		Title:             title,
+		ConflictingHashes: []string{original},
+	}}))
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectTrue(bug.FixCommitConflict)
+	c.expectEQ(bug.CommitInfo[0].Hash, reapplied)
+
+	// The bug is kept open after the fix reaches the manager.
+	build2 := testBuild(2)
+	build2.Manager = build1.Manager
+	build2.Commits = []string{title}
+	c.client.UploadBuild(build2)
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.Status, BugStatusOpen)
+	c.expectEQ(bug.PatchedOn, []string{build1.Manager})
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Fix commit conflict")))
+	page, err = c.AuthGET(AccessUser, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("Fix commit conflict")))
+	page, err = c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Fix commit conflicts")))
+
+	pinURL := "/admin?action=pin_fix_commit&id=" + bug.keyHash() + "&commit=" + url.QueryEscape(title)
+	_, err = c.AuthGET(AccessAdmin, pinURL+"&hash=3333333333333333333333333333333333333333")
+	c.expectBadReqest(err)
+	_, err = c.AuthGET(AccessUser, pinURL+"&hash="+original)
+	c.expectForbidden(err)
+	checkRedirect(c, AccessAdmin, pinURL+"&hash="+original, bugLink(bug.keyHash()), http.StatusFound)
+
+	// Pinning resolves the conflict and closes the already patched bug.
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectTrue(!bug.FixCommitConflict)
+	c.expectEQ(bug.Status, BugStatusFixed)
+	c.expectEQ(bug.CommitInfo[0].Hash, original)
+	c.expectTrue(bug.CommitInfo[0].Pinned)
+
+	// The pinned hash is not overwritten by the next commit poll.
+	c.expectOK(c.client.UploadCommits([]dashapi.Commit{{
+		Hash:              reapplied,
+		Title:             title,
+		ConflictingHashes: []string{original},
+	}}))
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.CommitInfo[0].Hash, original)
+	c.expectTrue(!bug.FixCommitConflict)
+}
+
+func TestFixCommitNoConflict(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build1 := testBuild(1)
+	c.client.UploadBuild(build1)
+	c.client.ReportCrash(testCrash(build1, 1))
+	rep := c.client.pollBug()
+	const title = "foo: fix the crash"
+	c.client.ReportingUpdate(&dashapi.BugUpdate{
+		ID:         rep.ID,
+		Status:     dashapi.BugStatusOpen,
+		FixCommits: []string{title},
+	})
+	c.expectOK(c.client.UploadCommits([]dashapi.Commit{{
+		Hash:              "1111111111111111111111111111111111111111",
+		Title:             title,
+		ConflictingHashes: []string{"2222222222222222222222222222222222222222"},
+	}}))
+	// The conflict is gone once all repos agree on the hash.
+	c.expectOK(c.client.UploadCommits([]dashapi.Commit{{
+		Hash:  "1111111111111111111111111111111111111111",
+		Title: title,
+	}}))
+	build2 := testBuild(2)
+	build2.Manager = build1.Manager
+	build2.Commits = []string{title}
+	c.client.UploadBuild(build2)
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectTrue(!bug.FixCommitConflict)
+	c.expectEQ(bug.Status, BugStatusFixed)
+}
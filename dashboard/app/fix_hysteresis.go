@@ -0,0 +1,243 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// If the fix of a bug is present only in some of the tested trees, the bug may flip between
+// "fix pending", fixed and a new regression bug, and each flip generates emails.
+// With FixHysteresisConfig, a bug is declared fixed only once the fix has reached a quorum
+// of the namespace managers and there were no crashes on builds with the fix for CleanPeriod
+// (the handleFixHysteresis cron job checks it). A fixed bug is reopened as a regression
+// only after RegressionCrashes crashes on builds with the fix; the crashes before that
+// are attached to the fixed bug. All decisions are made by evaluateFixState,
+// its result is also shown on the bug page.
+
+// Only the latest crashes on builds with the fix are remembered.
+const maxFixedBuildCrashes = 20
+
+// fixState is the evaluation of the fixed state of a bug.
+type fixState struct {
+	Managers int // the number of the tested managers
+	Patched  int // the number of the managers with the fix
+	Quorum   int // the number of the managers that must have the fix
+	// QuorumTime is when the quorum was reached, it may be zero for old bugs.
+	QuorumReached bool
+	QuorumTime    time.Time
+	// LastFixedCrash is the latest crash on a build with the fix.
+	LastFixedCrash time.Time
+	// FixedAt is when the open bug is declared fixed if nothing crashes on builds with the fix until then.
+	FixedAt time.Time
+	Fixed   bool
+	// RegressionCrashes is the number of crashes on builds with the fix since the bug was closed.
+	RegressionCrashes   int
+	RegressionThreshold int
+	Regressed           bool
+}
+
+// evaluateFixState decides whether a bug is fixed and whether a fixed bug has regressed.
+// managers are the tested managers of the namespace, patchedSince is when the fix reached
+// the managers (a zero time if it's unknown), fixedBuildCrashes are the times of the recent
+// crashes on builds with the fix, closed is the time the bug was closed as fixed (zero if it's open).
+// With a nil config, the bug is fixed once all managers have the fix, and it regresses on the first crash.
+func evaluateFixState(cfg *FixHysteresisConfig, managers []string, patchedSince map[string]time.Time,
+	fixedBuildCrashes []time.Time, closed, now time.Time) *fixState {
+	quorumPercent, cleanPeriod, threshold := 100, time.Duration(0), 1
+	if cfg != nil {
+		quorumPercent, cleanPeriod, threshold = cfg.Quorum, cfg.CleanPeriod, cfg.RegressionCrashes
+	}
+	state := &fixState{
+		Managers:            len(managers),
+		Quorum:              (len(managers)*quorumPercent + 99) / 100,
+		RegressionThreshold: threshold,
+	}
+	var patchTimes []time.Time
+	for _, mgr := range managers {
+		if t, ok := patchedSince[mgr]; ok {
+			patchTimes = append(patchTimes, t)
+		}
+	}
+	state.Patched = len(patchTimes)
+	state.QuorumReached = state.Patched >= state.Quorum
+	if state.QuorumReached && state.Quorum > 0 {
+		sort.Slice(patchTimes, func(i, j int) bool {
+			return patchTimes[i].Before(patchTimes[j])
+		})
+		state.QuorumTime = patchTimes[state.Quorum-1]
+	}
+	for _, t := range fixedBuildCrashes {
+		if t.After(state.LastFixedCrash) {
+			state.LastFixedCrash = t
+		}
+		if !closed.IsZero() && t.After(closed) {
+			state.RegressionCrashes++
+		}
+	}
+	if !closed.IsZero() {
+		state.Fixed = true
+		state.Regressed = state.RegressionCrashes >= threshold
+		return state
+	}
+	if !state.QuorumReached {
+		return state
+	}
+	state.FixedAt = state.QuorumTime
+	if state.LastFixedCrash.After(state.FixedAt) {
+		state.FixedAt = state.LastFixedCrash
+	}
+	state.FixedAt = state.FixedAt.Add(cleanPeriod)
+	state.Fixed = !now.Before(state.FixedAt)
+	return state
+}
+
+// String explains the state on the bug page.
+func (state *fixState) String() string {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("patched on %v/%v managers (%v needed)",
+		state.Patched, state.Managers, state.Quorum))
+	if !state.LastFixedCrash.IsZero() {
+		parts = append(parts, fmt.Sprintf("last crash with the fix %v",
+			state.LastFixedCrash.Format("2006/01/02 15:04")))
+	}
+	switch {
+	case state.Fixed && state.RegressionCrashes != 0:
+		parts = append(parts, fmt.Sprintf("%v/%v crashes with the fix to reopen",
+			state.RegressionCrashes, state.RegressionThreshold))
+	case state.Fixed:
+	case !state.QuorumReached:
+		parts = append(parts, "waiting for the quorum")
+	default:
+		parts = append(parts, fmt.Sprintf("to be closed at %v if it does not crash with the fix",
+			state.FixedAt.Format("2006/01/02 15:04")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (bug *Bug) fixState(managers []string, now time.Time) *fixState {
+	patchedSince := make(map[string]time.Time)
+	for _, mgr := range bug.PatchedOn {
+		// The time is unknown for the bugs patched before PatchedSince was introduced.
+		patchedSince[mgr] = time.Time{}
+	}
+	for _, patched := range bug.PatchedSince {
+		patchedSince[patched.Manager] = patched.Time
+	}
+	closed := time.Time{}
+	if bug.Status == BugStatusFixed {
+		closed = bug.Closed
+	}
+	return evaluateFixState(config.Namespaces[bug.Namespace].FixHysteresis, managers, patchedSince,
+		bug.FixedBuildCrashes, closed, now)
+}
+
+// pendingFixInBuild checks whether the build already contained the fix of the open bug.
+func pendingFixInBuild(bug *Bug, build *Build) bool {
+	if bug.Status != BugStatusOpen || len(bug.Commits) == 0 || !stringInList(bug.PatchedOn, build.Manager) {
+		return false
+	}
+	for _, patched := range bug.PatchedSince {
+		if patched.Manager == build.Manager {
+			return !build.Time.Before(patched.Time)
+		}
+	}
+	return true
+}
+
+func (bug *Bug) addFixedBuildCrash(now time.Time) {
+	bug.FixedBuildCrashes = append(bug.FixedBuildCrashes, now)
+	if len(bug.FixedBuildCrashes) > maxFixedBuildCrashes {
+		bug.FixedBuildCrashes = bug.FixedBuildCrashes[len(bug.FixedBuildCrashes)-maxFixedBuildCrashes:]
+	}
+}
+
+// regressionConfirmed checks whether one more crash on a build with the fix reopens the fixed bug.
+func regressionConfirmed(bug *Bug, now time.Time) bool {
+	cfg := config.Namespaces[bug.Namespace].FixHysteresis
+	crashes := append(append([]time.Time{}, bug.FixedBuildCrashes...), now)
+	// The managers do not matter for fixed bugs.
+	return evaluateFixState(cfg, nil, nil, crashes, bug.Closed, now).Regressed
+}
+
+// handleFixHysteresis closes the fix pending bugs whose fixes have settled.
+func handleFixHysteresis(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for ns, cfg := range config.Namespaces {
+		if cfg.FixHysteresis == nil || cfg.Decommissioned {
+			continue
+		}
+		if err := closeSettledFixes(c, ns); err != nil {
+			log.Errorf(c, "%v: failed to close settled fixes: %v", ns, err)
+		}
+	}
+}
+
+func closeSettledFixes(c context.Context, ns string) error {
+	managers, err := managerList(c, ns)
+	if err != nil {
+		return err
+	}
+	var bugs []*Bug
+	keys, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("Status=", BugStatusOpen).
+		GetAll(c, &bugs)
+	if err != nil {
+		return fmt.Errorf("failed to query bugs: %w", err)
+	}
+	now := timeNow(c)
+	for i, bug := range bugs {
+		if len(bug.Commits) == 0 || bug.FixCommitConflict || !bug.fixState(managers, now).Fixed {
+			continue
+		}
+		var fixedBug *Bug
+		tx := func(c context.Context) error {
+			bug := new(Bug)
+			fixedBug = nil
+			if err := db.Get(c, keys[i], bug); err != nil {
+				return fmt.Errorf("failed to get bug: %w", err)
+			}
+			if !bug.markFixedIfPatched(managers, now) {
+				return nil
+			}
+			bug.recordEvent(BugEvent{
+				Type:    BugEventFixed,
+				Time:    now,
+				Actor:   BugActorSystem,
+				Cause:   eventCause(causeCron, "fix_hysteresis"),
+				Details: "the fix has settled",
+			})
+			fixedBug = bug
+			if _, err := db.Put(c, keys[i], bug); err != nil {
+				return fmt.Errorf("failed to put bug: %w", err)
+			}
+			return saveBugEvents(c, keys[i], bug)
+		}
+		if err := db.RunInTransaction(c, tx, nil); err != nil {
+			return err
+		}
+		if fixedBug == nil {
+			continue
+		}
+		invalidateBugLists(c, ns)
+		if len(fixedBug.PatchedOn) == 0 {
+			continue
+		}
+		log.Infof(c, "bug %q: the fix has settled", fixedBug.Title)
+		if err := announceLandedFix(c, fixedBug, fixedBug.PatchedOn[len(fixedBug.PatchedOn)-1]); err != nil {
+			log.Errorf(c, "failed to announce the fix for %q: %v", fixedBug.Title, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestEvaluateFixState(t *testing.T) {
+	start := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	hour := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+	managers := []string{"manager1", "manager2", "manager3"}
+	cfg := &FixHysteresisConfig{Quorum: 50, CleanPeriod: 24 * time.Hour, RegressionCrashes: 2}
+	tests := []struct {
+		name      string
+		cfg       *FixHysteresisConfig
+		patched   map[string]time.Time
+		crashes   []time.Time
+		closed    time.Time
+		now       time.Time
+		fixed     bool
+		fixedAt   time.Time
+		regressed bool
+	}{
+		{
+			name:    "all managers are needed by default",
+			patched: map[string]time.Time{"manager1": hour(1), "manager2": hour(2)},
+			now:     hour(100),
+		},
+		{
+			name:    "fixed once the last manager is patched",
+			patched: map[string]time.Time{"manager1": hour(1), "manager2": hour(2), "manager3": hour(3)},
+			now:     hour(3),
+			fixed:   true,
+			fixedAt: hour(3),
+		},
+		{
+			name:    "patch times of old bugs are unknown",
+			patched: map[string]time.Time{"manager1": {}, "manager2": {}, "manager3": {}},
+			now:     hour(0),
+			fixed:   true,
+		},
+		{
+			name:    "quorum is not reached",
+			cfg:     cfg,
+			patched: map[string]time.Time{"manager1": hour(1), "unknown": hour(1)},
+			now:     hour(100),
+		},
+		{
+			name:    "clean period is not over",
+			cfg:     cfg,
+			patched: map[string]time.Time{"manager1": hour(1), "manager3": hour(5)},
+			now:     hour(28),
+			fixedAt: hour(29),
+		},
+		{
+			name:    "clean period is over",
+			cfg:     cfg,
+			patched: map[string]time.Time{"manager1": hour(1), "manager3": hour(5)},
+			now:     hour(29),
+			fixed:   true,
+			fixedAt: hour(29),
+		},
+		{
+			name:    "crash with the fix restarts the clean period",
+			cfg:     cfg,
+			patched: map[string]time.Time{"manager1": hour(1), "manager3": hour(5)},
+			crashes: []time.Time{hour(2), hour(10)},
+			now:     hour(29),
+			fixedAt: hour(34),
+		},
+		{
+			name:    "one crash does not reopen the bug",
+			cfg:     cfg,
+			crashes: []time.Time{hour(10), hour(40)},
+			closed:  hour(30),
+			now:     hour(40),
+			fixed:   true,
+		},
+		{
+			name:      "two crashes reopen the bug",
+			cfg:       cfg,
+			crashes:   []time.Time{hour(10), hour(40), hour(41)},
+			closed:    hour(30),
+			now:       hour(41),
+			fixed:     true,
+			regressed: true,
+		},
+		{
+			name:      "one crash reopens the bug by default",
+			crashes:   []time.Time{hour(40)},
+			closed:    hour(30),
+			now:       hour(40),
+			fixed:     true,
+			regressed: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := evaluateFixState(test.cfg, managers, test.patched, test.crashes, test.closed, test.now)
+			if state.Fixed != test.fixed || !state.FixedAt.Equal(test.fixedAt) || state.Regressed != test.regressed {
+				t.Fatalf("got fixed=%v fixedAt=%v regressed=%v, want fixed=%v fixedAt=%v regressed=%v (%v)",
+					state.Fixed, state.FixedAt, state.Regressed,
+					test.fixed, test.fixedAt, test.regressed, state)
+			}
+		})
+	}
+}
+
+func TestFixHysteresis(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	config.Namespaces["test1"].FixHysteresis = &FixHysteresisConfig{
+		Quorum:            100,
+		CleanPeriod:       24 * time.Hour,
+		RegressionCrashes: 2,
+	}
+	defer func() {
+		config.Namespaces["test1"].FixHysteresis = nil
+	}()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	rep := c.client.pollBug()
+
+	c.advanceTime(time.Hour)
+	build2 := testBuild(1)
+	build2.ID = "build1-fixed"
+	build2.FixCommits = []dashapi.Commit{{Title: "foo: fix1", BugIDs: []string{rep.ID}}}
+	c.client.UploadBuild(build2)
+	c.expectOK(c.client.UploadCommits([]dashapi.Commit{{Hash: "hash1", Title: "foo: fix1"}}))
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bug.Status, BugStatusOpen)
+
+	// A crash on the build with the fix restarts the clean period.
+	c.advanceTime(12 * time.Hour)
+	c.client.ReportCrash(testCrash(build2, 1))
+	c.client.pollBugs(0)
+	c.advanceTime(20 * time.Hour)
+	_, err := c.GET("/cron/fix_hysteresis")
+	c.expectOK(err)
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.Status, BugStatusOpen)
+	c.expectEQ(len(bug.FixedBuildCrashes), 1)
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Fix state:")))
+	c.expectTrue(bytes.Contains(page, []byte("to be closed at")))
+
+	c.advanceTime(5 * time.Hour)
+	_, err = c.GET("/cron/fix_hysteresis")
+	c.expectOK(err)
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(bug.Status, BugStatusFixed)
+
+	// The first crash with the fix is attached to the fixed bug.
+	c.advanceTime(time.Hour)
+	c.client.ReportCrash(testCrash(build2, 1))
+	c.client.pollBugs(0)
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectEQ(len(bug.FixedBuildCrashes), 2)
+
+	// The second one reopens it as a regression.
+	c.advanceTime(time.Hour)
+	c.client.ReportCrash(testCrash(build2, 1))
+	rep2 := c.client.pollBug()
+	c.expectNE(rep2.ID, rep.ID)
+	c.expectTrue(rep2.RegressionOf != nil)
+	newBug, _, _ := c.loadBug(rep2.ID)
+	c.expectEQ(newBug.RegressionOf, bug.keyHash())
+}
@@ -4,9 +4,12 @@
 package main
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/syzkaller/dashboard/dashapi"
 )
 
@@ -570,3 +573,182 @@ func TestFixedDup3(t *testing.T) {
 	rep3 := c.client.pollBug()
 	c.expectEQ(rep3.Title, rep1.Title+" (2)")
 }
+
+func TestFixLandedAnnouncement(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build1 := testBuild(1)
+	client.UploadBuild(build1)
+	client.ReportCrash(testCrash(build1, 1))
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("[PATCH] foo: fix the crash", extBugID)
+	thread.reply("developer@kernel.org", "The patch.")
+	thread.reply("private@kernel.org", "Looks good.")
+	c.advanceTime(time.Hour)
+	lastID := thread.reply("Maintainer <maintainer@kernel.org>", "Applied, thanks!")
+
+	reply, _ := client.ReportingUpdate(&dashapi.BugUpdate{
+		ID:         extBugID,
+		Status:     dashapi.BugStatusOpen,
+		FixCommits: []string{"foo: fix the crash"},
+	})
+	c.expectEQ(reply.OK, true)
+
+	// The fix reaches the only tested tree.
+	build2 := testBuild(2)
+	build2.Manager = build1.Manager
+	build2.Commits = []string{"foo: fix the crash"}
+	client.UploadBuild(build2)
+
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.To, []string{"test@syzkaller.com"})
+	// The participants are CCed, the most recent first.
+	c.expectEQ(msg.Cc, []string{"maintainer@kernel.org", "developer@kernel.org"})
+	c.expectEQ(msg.Subject, "Re: [PATCH] foo: fix the crash")
+	c.expectEQ(msg.Headers["In-Reply-To"], []string{lastID})
+	c.expectTrue(strings.Contains(msg.Body, `"foo: fix the crash"`))
+
+	// The announcement is recorded in the discussion.
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	c.expectEQ(bug.Status, BugStatusFixed)
+	discussions, err := discussionsForBug(c.ctx, bug.key(c.ctx))
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	_, recorded := discussions[0].messageIDs()[fixLandedMessageID(extBugID)]
+	c.expectTrue(recorded)
+
+	// No more announcements.
+	build3 := testBuild(3)
+	build3.Manager = build1.Manager
+	build3.Commits = []string{"foo: fix the crash"}
+	client.UploadBuild(build3)
+	c.expectNoEmail()
+}
+
+func TestFixLandedAnnouncementSameThread(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build1 := testBuild(1)
+	client.UploadBuild(build1)
+	client.ReportCrash(testCrash(build1, 1))
+	extBugID1 := c.pollEmailExtID()
+	client.ReportCrash(testCrash(build1, 2))
+	extBugID2 := c.pollEmailExtID()
+
+	// Both bugs are discussed in the same thread.
+	thread1 := c.incomingThread("[PATCH] foo: fix the crashes", extBugID1)
+	thread1.reply("developer@kernel.org", "The patch.")
+	thread2 := c.incomingThread("[PATCH] foo: fix the crashes", extBugID2)
+	thread2.refs = thread1.refs
+	c.advanceTime(time.Hour)
+	lastID := thread2.reply("developer@kernel.org", "It also fixes the other bug.")
+
+	fixBug := func(extBugID, commit string, buildID int) {
+		reply, _ := client.ReportingUpdate(&dashapi.BugUpdate{
+			ID:         extBugID,
+			Status:     dashapi.BugStatusOpen,
+			FixCommits: []string{commit},
+		})
+		c.expectEQ(reply.OK, true)
+		build := testBuild(buildID)
+		build.Manager = build1.Manager
+		build.Commits = []string{commit}
+		client.UploadBuild(build)
+	}
+	fixBug(extBugID1, "foo: fix the first crash", 2)
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.Headers["In-Reply-To"], []string{lastID})
+
+	// Our previous announcement is the latest record in the thread,
+	// but it does not have a real Message-ID to reply to.
+	c.advanceTime(time.Hour)
+	fixBug(extBugID2, "foo: fix the second crash", 3)
+	msg = c.pollEmailBug()
+	c.expectEQ(msg.Headers["In-Reply-To"], []string{lastID})
+}
+
+func TestFixLandedCC(t *testing.T) {
+	tests := []struct {
+		name         string
+		to           []string
+		participants []string
+		doNotContact []string
+		limit        int
+		cc           []string
+	}{
+		{
+			name:         "overlapping",
+			to:           []string{"list@kernel.org", "Dev <dev@kernel.org>"},
+			participants: []string{"DEV@kernel.org", "dev+tag@kernel.org", "list@kernel.org", "other@kernel.org"},
+			limit:        10,
+			cc:           []string{"other@kernel.org"},
+		},
+		{
+			name:         "duplicates",
+			participants: []string{"a@kernel.org", "\"A\" <A@kernel.org>", "b@kernel.org", "a@kernel.org"},
+			limit:        10,
+			cc:           []string{"a@kernel.org", "b@kernel.org"},
+		},
+		{
+			name:         "malformed",
+			participants: []string{"", "not an email", "a@", "<b@kernel.org", "c@kernel.org"},
+			limit:        10,
+			cc:           []string{"c@kernel.org"},
+		},
+		{
+			name:         "do not contact",
+			participants: []string{"Private <Private@kernel.org>", "a@kernel.org"},
+			doNotContact: []string{"private@kernel.org"},
+			limit:        10,
+			cc:           []string{"a@kernel.org"},
+		},
+		{
+			name:         "limit",
+			participants: []string{"a@kernel.org", "a@kernel.org", "b@kernel.org", "c@kernel.org"},
+			limit:        2,
+			cc:           []string{"a@kernel.org", "b@kernel.org"},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			cc := fixLandedCC(test.to, test.participants, test.doNotContact, test.limit)
+			if diff := cmp.Diff(test.cc, cc); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestFixLandedTemplate(t *testing.T) {
+	body := new(bytes.Buffer)
+	err := mailTemplates.ExecuteTemplate(body, "mail_fix_landed.txt", &uiFixLanded{
+		Tree: "upstream",
+		Commits: []*uiCommit{
+			{Hash: "1234567890abcdef", Title: "foo: fix the crash"},
+			{Title: `bar: don't "crash"`},
+		},
+		Link: "https://testapp.appspot.com/bug?extid=abcd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `syzbot confirms that the fix has landed in upstream as:
+
+commit 12345678 "foo: fix the crash"
+"bar: don't "crash""
+
+The bug is now closed as fixed.
+
+dashboard link: https://testapp.appspot.com/bug?extid=abcd
+`
+	if got := body.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// The /<ns>/fix_times page shows how long it takes to fix bugs depending on their characteristics
+// (e.g. whether bugs with reproducers get fixed faster). The time to fix is measured from the earliest
+// public report of a fixed bug to its fix commit. The commit date is used for the fix time,
+// and the time we learned about the fix commit is used if the date is not known.
+// The statistics are computed once a day into the FixTimeStats entity of the namespace,
+// the page only renders them.
+
+type fixTimeWindow struct {
+	Name string
+	Days int // 0 means all time
+}
+
+// fixTimeWindows select the bugs by the fix time.
+var fixTimeWindows = []fixTimeWindow{
+	{"90d", 90},
+	{"1y", 365},
+	{"all", 0},
+}
+
+const defaultFixTimeWindow = "1y"
+
+// The bug characteristics the statistics are broken down by, in the page order.
+const (
+	fixTimeAll       = "all"
+	fixTimeRepro     = "repro"
+	fixTimeBisection = "bisection"
+	fixTimeCrashType = "crash type"
+	fixTimeSubsystem = "subsystem"
+)
+
+var fixTimeDimensions = []string{fixTimeAll, fixTimeRepro, fixTimeBisection, fixTimeCrashType, fixTimeSubsystem}
+
+// fixedBug is the time to fix and the characteristics of a fixed bug.
+type fixedBug struct {
+	fixed    time.Time
+	duration time.Duration
+	values   map[string][]string // dimension -> values
+}
+
+func handleFixTimeStats(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	now := timeNow(c)
+	for ns, cfg := range config.Namespaces {
+		if cfg.Decommissioned {
+			continue
+		}
+		if err := updateFixTimeStats(c, ns, now); err != nil {
+			log.Errorf(c, "failed to update fix time stats in %v: %v", ns, err)
+		}
+	}
+}
+
+func updateFixTimeStats(c context.Context, ns string, now time.Time) error {
+	bugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("Status=", BugStatusFixed)
+	})
+	if err != nil {
+		return err
+	}
+	stats := computeFixTimeStats(config.Namespaces[ns], bugs, now)
+	stats.Namespace = ns
+	if _, err := db.Put(c, fixTimeStatsKey(c, ns), stats); err != nil {
+		return fmt.Errorf("failed to save fix time stats: %w", err)
+	}
+	return nil
+}
+
+func fixTimeStatsKey(c context.Context, ns string) *db.Key {
+	return db.NewKey(c, "FixTimeStats", ns, 0, nil)
+}
+
+func computeFixTimeStats(cfg *Config, bugs []*Bug, now time.Time) *FixTimeStats {
+	stats := &FixTimeStats{
+		Computed: now,
+	}
+	var fixed []*fixedBug
+	for _, bug := range bugs {
+		info := makeFixedBug(cfg, bug)
+		if info == nil {
+			stats.Excluded++
+			continue
+		}
+		fixed = append(fixed, info)
+	}
+	for _, window := range fixTimeWindows {
+		durations := make(map[string]map[string][]time.Duration)
+		for _, bug := range fixed {
+			if window.Days != 0 && now.Sub(bug.fixed) > time.Duration(window.Days)*24*time.Hour {
+				continue
+			}
+			for dim, values := range bug.values {
+				if durations[dim] == nil {
+					durations[dim] = make(map[string][]time.Duration)
+				}
+				for _, val := range values {
+					durations[dim][val] = append(durations[dim][val], bug.duration)
+				}
+			}
+		}
+		for _, dim := range fixTimeDimensions {
+			var groups []FixTimeGroup
+			for val, list := range durations[dim] {
+				sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+				groups = append(groups, FixTimeGroup{
+					Window:    window.Name,
+					Dimension: dim,
+					Value:     val,
+					Bugs:      len(list),
+					P50:       durationPercentile(list, 50),
+					P75:       durationPercentile(list, 75),
+					P90:       durationPercentile(list, 90),
+				})
+			}
+			sort.Slice(groups, func(i, j int) bool {
+				if groups[i].Bugs != groups[j].Bugs {
+					return groups[i].Bugs > groups[j].Bugs
+				}
+				return groups[i].Value < groups[j].Value
+			})
+			stats.Groups = append(stats.Groups, groups...)
+		}
+	}
+	return stats
+}
+
+// makeFixedBug returns nil if the bug was never reported publicly or its fix time is not known.
+func makeFixedBug(cfg *Config, bug *Bug) *fixedBug {
+	reported := firstPublicReport(cfg, bug)
+	if reported.IsZero() || len(bug.Commits) == 0 {
+		return nil
+	}
+	// The bug is fixed once the last of its fix commits lands.
+	var fixed time.Time
+	for i := range bug.Commits {
+		date := bug.getCommitInfo(i).Date
+		if date.IsZero() {
+			date = bug.FixTime
+		}
+		if date.After(fixed) {
+			fixed = date
+		}
+	}
+	if fixed.IsZero() {
+		return nil
+	}
+	// The fix may land before the public report (e.g. if the bug spent a long time in moderation).
+	duration := fixed.Sub(reported)
+	if duration < 0 {
+		duration = 0
+	}
+	ret := &fixedBug{
+		fixed:    fixed,
+		duration: duration,
+		values: map[string][]string{
+			fixTimeAll:       {"all bugs"},
+			fixTimeRepro:     {fixTimeReproName(bug)},
+			fixTimeBisection: {fixTimeBisectionName(bug)},
+			fixTimeCrashType: {crashType(bug.Title)},
+		},
+	}
+	for _, entry := range bug.Tags.Subsystems {
+		ret.values[fixTimeSubsystem] = append(ret.values[fixTimeSubsystem], entry.Name)
+	}
+	if len(ret.values[fixTimeSubsystem]) == 0 {
+		ret.values[fixTimeSubsystem] = []string{"-"}
+	}
+	return ret
+}
+
+// firstPublicReport returns the earliest time the bug was reported in a public reporting.
+func firstPublicReport(cfg *Config, bug *Bug) time.Time {
+	var ret time.Time
+	for _, bugReporting := range bug.Reporting {
+		reporting := cfg.ReportingByName(bugReporting.Name)
+		if reporting == nil || reporting.AccessLevel != AccessPublic ||
+			bugReporting.Dummy || bugReporting.Reported.IsZero() {
+			continue
+		}
+		if ret.IsZero() || bugReporting.Reported.Before(ret) {
+			ret = bugReporting.Reported
+		}
+	}
+	return ret
+}
+
+func fixTimeReproName(bug *Bug) string {
+	switch bug.ReproLevel {
+	case ReproLevelC:
+		return "C repro"
+	case ReproLevelSyz:
+		return "syz repro"
+	default:
+		return "no repro"
+	}
+}
+
+func fixTimeBisectionName(bug *Bug) string {
+	switch bug.BisectCause {
+	case BisectNot, BisectPending:
+		return "not bisected"
+	case BisectYes:
+		return "bisected"
+	default:
+		return "bisection failed"
+	}
+}
+
+// crashType returns the kind of the crash without the access type, e.g. "KASAN: use-after-free"
+// for "KASAN: use-after-free Read in foo".
+func crashType(title string) string {
+	kind, _ := splitTitle(title)
+	for _, suffix := range []string{" Read", " Write"} {
+		kind = strings.TrimSuffix(kind, suffix)
+	}
+	return kind
+}
+
+// durationPercentile returns the nearest-rank percentile of the sorted durations.
+func durationPercentile(sorted []time.Duration, percent int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (percent*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+type uiFixTimesPage struct {
+	Header   *uiHeader
+	Computed time.Time
+	Excluded int
+	Windows  []*uiFixTimeWindow
+	Tables   []*uiFixTimeTable
+	CSVLink  string
+}
+
+type uiFixTimeWindow struct {
+	Name     string
+	Link     string
+	Selected bool
+}
+
+type uiFixTimeTable struct {
+	Dimension string
+	Groups    []FixTimeGroup
+}
+
+func handleFixTimes(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	hdr, err := commonHeader(c, r, w, "")
+	if err != nil {
+		return err
+	}
+	window := r.FormValue("window")
+	if window == "" {
+		window = defaultFixTimeWindow
+	}
+	known := false
+	page := &uiFixTimesPage{
+		Header:  hdr,
+		CSVLink: fmt.Sprintf("/%v/fix_times?window=%v&format=csv", hdr.Namespace, window),
+	}
+	for _, win := range fixTimeWindows {
+		known = known || win.Name == window
+		page.Windows = append(page.Windows, &uiFixTimeWindow{
+			Name:     win.Name,
+			Link:     fmt.Sprintf("/%v/fix_times?window=%v", hdr.Namespace, win.Name),
+			Selected: win.Name == window,
+		})
+	}
+	if !known {
+		return fmt.Errorf("%w: unknown window %q", ErrClientBadRequest, window)
+	}
+	stats := new(FixTimeStats)
+	if err := db.Get(c, fixTimeStatsKey(c, hdr.Namespace), stats); err != nil && err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to get fix time stats: %w", err)
+	}
+	page.Computed = stats.Computed
+	page.Excluded = stats.Excluded
+	var groups []FixTimeGroup
+	for _, group := range stats.Groups {
+		if group.Window == window {
+			groups = append(groups, group)
+		}
+	}
+	if r.FormValue("format") == "csv" {
+		return writeFixTimesCSV(w, hdr.Namespace, window, groups)
+	}
+	for _, dim := range fixTimeDimensions {
+		table := &uiFixTimeTable{Dimension: dim}
+		for _, group := range groups {
+			if group.Dimension == dim {
+				table.Groups = append(table.Groups, group)
+			}
+		}
+		if len(table.Groups) != 0 {
+			page.Tables = append(page.Tables, table)
+		}
+	}
+	return serveTemplate(w, "fix_times.html", page)
+}
+
+func writeFixTimesCSV(w http.ResponseWriter, ns, window string, groups []FixTimeGroup) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=fix_times_%v_%v.csv", ns, window))
+	days := func(d time.Duration) string {
+		return strconv.FormatFloat(d.Hours()/24, 'f', 1, 64)
+	}
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"window", "dimension", "value", "bugs", "median days", "p75 days", "p90 days"})
+	for _, group := range groups {
+		writer.Write([]string{
+			group.Window,
+			group.Dimension,
+			group.Value,
+			strconv.Itoa(group.Bugs),
+			days(group.P50),
+			days(group.P75),
+			days(group.P90),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestComputeFixTimeStats(t *testing.T) {
+	cfg := &Config{
+		Reporting: []Reporting{
+			{Name: "private", AccessLevel: AccessAdmin},
+			{Name: "public", AccessLevel: AccessPublic},
+			{Name: "public2", AccessLevel: AccessPublic},
+		},
+	}
+	now := time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	reported := now.Add(-400 * day)
+	makeBug := func(title string, days int, repro dashapi.ReproLevel) *Bug {
+		return &Bug{
+			Title:      title,
+			ReproLevel: repro,
+			Commits:    []string{"fix"},
+			CommitInfo: []Commit{{Title: "fix", Date: reported.Add(time.Duration(days) * day)}},
+			Reporting: []BugReporting{
+				// The private report is earlier, but it does not count.
+				{Name: "private", Reported: reported.Add(-100 * day)},
+				{Name: "public", Reported: reported},
+				{Name: "public2", Reported: reported.Add(10 * day)},
+			},
+		}
+	}
+	bugs := []*Bug{
+		makeBug("KASAN: use-after-free Read in foo", 10, ReproLevelC),
+		makeBug("KASAN: use-after-free Write in bar", 20, ReproLevelC),
+		makeBug("WARNING in foo", 30, ReproLevelNone),
+		// Fixed more than 90 days ago.
+		makeBug("WARNING in bar", 40, ReproLevelNone),
+		// Never reported publicly.
+		{
+			Title:      "WARNING in baz",
+			Commits:    []string{"fix"},
+			CommitInfo: []Commit{{Date: now}},
+			Reporting:  []BugReporting{{Name: "private", Reported: reported}},
+		},
+	}
+	for i := 0; i < 3; i++ {
+		bugs[i].CommitInfo[0].Date = bugs[i].CommitInfo[0].Date.Add(350 * day)
+	}
+	// The date of one of the commits is unknown, so the time we learned about it is used.
+	bugs[0].Commits = append(bugs[0].Commits, "fix2")
+	bugs[0].FixTime = bugs[0].CommitInfo[0].Date.Add(5 * day)
+	bugs[0].BisectCause = BisectYes
+	bugs[0].Tags.Subsystems = []BugSubsystem{{Name: "mm"}, {Name: "net"}}
+	bugs[1].Tags.Subsystems = []BugSubsystem{{Name: "net"}}
+
+	stats := computeFixTimeStats(cfg, bugs, now)
+	if stats.Excluded != 1 {
+		t.Errorf("got %v excluded bugs", stats.Excluded)
+	}
+	got := make(map[string]string)
+	for _, group := range stats.Groups {
+		got[group.Window+"|"+group.Dimension+"|"+group.Value] = fmt.Sprintf("%v %v %v %v",
+			group.Bugs, int64(group.P50/day), int64(group.P75/day), int64(group.P90/day))
+	}
+	want := map[string]string{
+		"90d|all|all bugs":                     "3 370 380 380",
+		"90d|repro|C repro":                    "2 365 370 370",
+		"90d|repro|no repro":                   "1 380 380 380",
+		"90d|bisection|bisected":               "1 365 365 365",
+		"90d|bisection|not bisected":           "2 370 380 380",
+		"90d|crash type|KASAN: use-after-free": "2 365 370 370",
+		"90d|crash type|WARNING":               "1 380 380 380",
+		"90d|subsystem|net":                    "2 365 370 370",
+		"90d|subsystem|mm":                     "1 365 365 365",
+		"90d|subsystem|-":                      "1 380 380 380",
+		// The bug fixed long ago is counted only in the longer windows.
+		"1y|all|all bugs":        "4 365 370 380",
+		"1y|repro|no repro":      "2 40 380 380",
+		"all|all|all bugs":       "4 365 370 380",
+		"all|crash type|WARNING": "2 40 380 380",
+		"all|subsystem|-":        "2 40 380 380",
+	}
+	for key, val := range want {
+		if got[key] != val {
+			t.Errorf("%v: got %q, want %q", key, got[key], val)
+		}
+	}
+}
+
+func TestDurationPercentile(t *testing.T) {
+	var list []time.Duration
+	for i := 1; i <= 10; i++ {
+		list = append(list, time.Duration(i))
+	}
+	for percent, want := range map[int]time.Duration{0: 1, 10: 1, 11: 2, 50: 5, 90: 9, 91: 10, 100: 10} {
+		if got := durationPercentile(list, percent); got != want {
+			t.Errorf("p%v: got %v, want %v", percent, got, want)
+		}
+	}
+	if got := durationPercentile(nil, 50); got != 0 {
+		t.Errorf("empty list: got %v", got)
+	}
+}
+
+func TestFixTimes(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	sender := c.pollEmailBug().Sender
+
+	c.advanceTime(10 * 24 * time.Hour)
+	c.incomingEmail(sender, "#syz fix: foo: fix the crash\n")
+	build2 := testBuild(2)
+	build2.Manager = build.Manager
+	build2.Commits = []string{"foo: fix the crash"}
+	client.UploadBuild(build2)
+
+	// No stats yet.
+	page, err := c.AuthGET(AccessPublic, "/access-public-email/fix_times")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "No fix time statistics yet"))
+
+	_, err = c.GET("/cron/fix_time_stats")
+	c.expectOK(err)
+	page, err = c.AuthGET(AccessPublic, "/access-public-email/fix_times")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "all bugs"))
+	c.expectTrue(strings.Contains(string(page), "10d"))
+
+	csv, err := c.AuthGET(AccessPublic, "/access-public-email/fix_times?window=90d&format=csv")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(csv), "90d,all,all bugs,1,10.0,10.0,10.0\n"))
+	c.expectTrue(strings.Contains(string(csv), "90d,repro,no repro,1,"))
+
+	checkResponseStatusCode(c, AccessPublic, "/access-public-email/fix_times?window=2y", 400)
+}
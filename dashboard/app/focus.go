@@ -0,0 +1,302 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	aemail "google.golang.org/appengine/v2/mail"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Developers may ask syzbot to hammer a bug for a while (with "#syz focus" or the bug page button),
+// e.g. to get a better reproducer or to check whether a tentative fix holds.
+// While Bug.FocusUntil is in the future, the syz reproducer of the bug is returned to all namespace
+// managers in the manager_stats reply and the managers prioritize its mutations. The crashes and
+// the reproducers that arrive during the window are counted in Bug.Focus, and once the window
+// is over, the summary is sent as a reply to the request thread (see handleFocusSummaries).
+// The number of bugs focused on at the same time is limited per namespace.
+
+// BugFocus describes the latest focused fuzzing request of a bug.
+type BugFocus struct {
+	Requested time.Time
+	User      string
+	Link      string
+	// The email thread the results are sent to, empty for requests from the bug page.
+	MessageID   string
+	Subject     string
+	ReportingID string
+	CC          string
+	// ReproLevel is the bug repro level at the time of the request.
+	ReproLevel dashapi.ReproLevel
+	// Crashes and Repros count the crashes and the reproducers found during the window.
+	Crashes     int64
+	Repros      int64
+	SummarySent bool
+}
+
+type FocusDeniedError struct {
+	message string
+}
+
+func (e *FocusDeniedError) Error() string {
+	return e.message
+}
+
+func (bug *Bug) focused(now time.Time) bool {
+	return now.Before(bug.FocusUntil)
+}
+
+// recordFocusCrash is called in the reportCrash transaction.
+func (bug *Bug) recordFocusCrash(reproLevel dashapi.ReproLevel, now time.Time) {
+	if !bug.focused(now) {
+		return
+	}
+	bug.Focus.Crashes++
+	if reproLevel != ReproLevelNone {
+		bug.Focus.Repros++
+	}
+}
+
+// checkFocusRequest returns a non-empty reason if the bug can't be focused on now.
+func checkFocusRequest(bug *Bug, now time.Time) string {
+	switch {
+	case config.Namespaces[bug.Namespace].Focus == nil:
+		return "Focused fuzzing is not enabled for this namespace."
+	case bug.Status != BugStatusOpen:
+		return "The bug is already closed."
+	case bug.focused(now):
+		return fmt.Sprintf("The bug is already being focused on until %v.",
+			bug.FocusUntil.Format("2006/01/02 15:04 MST"))
+	}
+	return ""
+}
+
+// loadFocusedBugs returns the namespace bugs with an active focus window.
+func loadFocusedBugs(c context.Context, ns string, now time.Time) ([]*Bug, []*db.Key, error) {
+	var bugs []*Bug
+	keys, err := db.NewQuery("Bug").
+		Filter("FocusUntil>", now).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query focused bugs: %w", err)
+	}
+	var retBugs []*Bug
+	var retKeys []*db.Key
+	for i, bug := range bugs {
+		if bug.Namespace == ns {
+			retBugs = append(retBugs, bug)
+			retKeys = append(retKeys, keys[i])
+		}
+	}
+	return retBugs, retKeys, nil
+}
+
+// requestFocus starts the focus window for the bug and returns its end.
+func requestFocus(c context.Context, bugKey *db.Key, focus *BugFocus) (time.Time, error) {
+	bug := new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get bug: %w", err)
+	}
+	now := timeNow(c)
+	if reason := checkFocusRequest(bug, now); reason != "" {
+		return time.Time{}, &FocusDeniedError{reason}
+	}
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if crash.ReproSyz == 0 {
+		return time.Time{}, &FocusDeniedError{"The bug has no syz reproducer to focus on."}
+	}
+	cfg := config.Namespaces[bug.Namespace].Focus
+	// The limit is checked outside of the transaction, so it may be slightly exceeded
+	// by concurrent requests, which is fine.
+	focused, _, err := loadFocusedBugs(c, bug.Namespace, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(focused) >= cfg.MaxBugs {
+		var titles []string
+		for _, other := range focused {
+			titles = append(titles, other.displayTitle())
+		}
+		return time.Time{}, &FocusDeniedError{fmt.Sprintf("Too many bugs are already being focused on:\n%v\n"+
+			"Please try again later.", strings.Join(titles, "\n"))}
+	}
+	until := now.Add(cfg.Duration)
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		if reason := checkFocusRequest(bug, now); reason != "" {
+			return &FocusDeniedError{reason}
+		}
+		bug.FocusUntil = until
+		bug.Focus = *focus
+		bug.Focus.Requested = now
+		bug.Focus.ReproLevel = bug.ReproLevel
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// managerFocusPrograms returns the reproducers of the focused bugs for the manager_stats reply.
+func managerFocusPrograms(c context.Context, ns string) ([]dashapi.FocusProgram, error) {
+	now := timeNow(c)
+	bugs, keys, err := loadFocusedBugs(c, ns, now)
+	if err != nil {
+		return nil, err
+	}
+	var ret []dashapi.FocusProgram
+	for i, bug := range bugs {
+		crash, _, err := findCrashForBug(c, bug)
+		if err != nil {
+			return nil, err
+		}
+		repro, err := loadJobReproSyz(c, crash)
+		if err != nil {
+			return nil, err
+		}
+		if len(repro) == 0 {
+			continue
+		}
+		ret = append(ret, dashapi.FocusProgram{
+			BugID: keys[i].StringID(),
+			Title: bug.displayTitle(),
+			Prog:  repro,
+			Until: bug.FocusUntil,
+		})
+	}
+	return ret, nil
+}
+
+// handleFocus serves the "focus" button on the bug page.
+func handleFocus(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
+	if accessLevel < AccessUser {
+		return ErrAccess
+	}
+	if err := checkNamespaceAccessLevel(c, r, bug.Namespace, bug.sanitizeAccess(accessLevel)); err != nil {
+		return err
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	_, err = requestFocus(c, bug.key(c), &BugFocus{User: author})
+	if _, ok := err.(*FocusDeniedError); ok {
+		return fmt.Errorf("%v %w", err, ErrClientBadRequest)
+	} else if err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+// handleFocusSummaries replies to the focus requests whose windows are over.
+func handleFocusSummaries(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	now := timeNow(c)
+	var bugs []*Bug
+	keys, err := db.NewQuery("Bug").
+		Filter("FocusUntil<=", now).
+		Filter("FocusUntil>", now.Add(-7*24*time.Hour)).
+		GetAll(c, &bugs)
+	if err != nil {
+		log.Errorf(c, "failed to query focused bugs: %v", err)
+		return
+	}
+	for i, bug := range bugs {
+		if bug.Focus.SummarySent {
+			continue
+		}
+		if err := sendFocusSummary(c, bug, keys[i]); err != nil {
+			log.Errorf(c, "%q: failed to send focus summary: %v", bug.Title, err)
+		}
+	}
+}
+
+func sendFocusSummary(c context.Context, bug *Bug, bugKey *db.Key) error {
+	// Mark the summary as sent first, so that we don't spam in case of errors.
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		bug.Focus.SummarySent = true
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	focus := &bug.Focus
+	if focus.MessageID == "" {
+		// The request came from the bug page, the results are visible there.
+		return nil
+	}
+	from, err := email.AddAddrContext(fromAddr(c), focus.ReportingID)
+	if err != nil {
+		return err
+	}
+	msg := &aemail.Message{
+		Sender:  from,
+		To:      []string{focus.User},
+		Cc:      []string{focus.CC},
+		Subject: replySubject(focus.Subject),
+		Body:    formatFocusSummary(bug),
+		Headers: mail.Header{"In-Reply-To": []string{focus.MessageID}},
+	}
+	return sendEmail(c, msg)
+}
+
+func formatFocusSummary(bug *Bug) string {
+	focus := &bug.Focus
+	body := new(strings.Builder)
+	fmt.Fprintf(body, "The focused fuzzing of this bug is over (%v - %v).\n\n",
+		focus.Requested.Format("2006/01/02 15:04"), bug.FocusUntil.Format("2006/01/02 15:04 MST"))
+	fmt.Fprintf(body, "New crashes: %v\n", focus.Crashes)
+	fmt.Fprintf(body, "New reproducers: %v\n", focus.Repros)
+	if bug.ReproLevel > focus.ReproLevel {
+		fmt.Fprintf(body, "The reproducer has improved: %v -> %v\n",
+			reproLevelName(focus.ReproLevel), reproLevelName(bug.ReproLevel))
+	}
+	if focus.Crashes == 0 {
+		body.WriteString("\nThe bug was not triggered during the focus window.\n")
+	}
+	return body.String()
+}
+
+func reproLevelName(level dashapi.ReproLevel) string {
+	switch level {
+	case ReproLevelC:
+		return "C"
+	case ReproLevelSyz:
+		return "syz"
+	}
+	return "none"
+}
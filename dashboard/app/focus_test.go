@@ -0,0 +1,126 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestFocus(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	sender := c.pollEmailBug().Sender
+	_, extID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	// Bugs without reproducers can't be focused on.
+	c.incomingEmail(sender, "#syz focus\n", EmailOptFrom("dev@kernel.org"))
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "The bug has no syz reproducer to focus on."))
+
+	crash.ReproOpts = []byte("repro opts")
+	crash.ReproSyz = []byte("getpid()\n")
+	client.ReportCrash(crash)
+	c.pollEmailBug()
+	c.incomingEmail(sender, "#syz focus\n", EmailOptFrom("dev@kernel.org"), EmailOptMessageID(1))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "will focus on the reproducer of this bug until 2000/01/02"))
+
+	// The managers get the reproducer in the stats reply.
+	resp := client.uploadManagerStats(&dashapi.ManagerStatsReq{Name: build.Manager})
+	c.expectEQ(len(resp.Focus), 1)
+	c.expectEQ(resp.Focus[0].Title, crash.Title)
+	c.expectTrue(strings.Contains(string(resp.Focus[0].Prog), "getpid()"))
+	resp = c.client.uploadManagerStats(&dashapi.ManagerStatsReq{Name: build.Manager})
+	c.expectEQ(len(resp.Focus), 0)
+
+	// Only one bug may be focused on at a time in this namespace.
+	crash2 := testCrash(build, 2)
+	crash2.ReproSyz = []byte("getppid()\n")
+	client.ReportCrash(crash2)
+	sender2 := c.pollEmailBug().Sender
+	c.incomingEmail(sender2, "#syz focus\n", EmailOptFrom("dev@kernel.org"))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "Too many bugs are already being focused on:\n"+crash.Title))
+
+	// The crashes during the window are counted.
+	c.advanceTime(time.Hour)
+	client.ReportCrash(crash)
+	bug, _, _ := c.loadBug(extID)
+	c.expectEQ(bug.Focus.Crashes, int64(1))
+	c.expectEQ(bug.Focus.Repros, int64(1))
+	page, err := c.AuthGET(AccessUser, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "focused fuzzing until"))
+
+	_, err = c.GET("/cron/focus_summaries")
+	c.expectOK(err)
+	c.expectNoEmail()
+
+	c.advanceTime(24 * time.Hour)
+	resp = client.uploadManagerStats(&dashapi.ManagerStatsReq{Name: build.Manager})
+	c.expectEQ(len(resp.Focus), 0)
+	_, err = c.GET("/cron/focus_summaries")
+	c.expectOK(err)
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.To, []string{"dev@kernel.org"})
+	c.expectEQ(msg.Headers["In-Reply-To"], []string{"<1>"})
+	c.expectTrue(strings.Contains(msg.Body, "New crashes: 1\nNew reproducers: 1\n"))
+	_, err = c.GET("/cron/focus_summaries")
+	c.expectOK(err)
+	c.expectNoEmail()
+
+	// Now the second bug can be focused on from the bug page.
+	_, extID2, err := email.RemoveAddrContext(sender2)
+	c.expectOK(err)
+	bug2, _, _ := c.loadBug(extID2)
+	_, err = c.AuthGET(AccessPublic, "/focus?id="+bug2.keyHash())
+	c.expectTrue(err != nil)
+	checkRedirect(c, AccessUser, "/focus?id="+bug2.keyHash(), bugLink(bug2.keyHash()), http.StatusFound)
+	resp = client.uploadManagerStats(&dashapi.ManagerStatsReq{Name: build.Manager})
+	c.expectEQ(len(resp.Focus), 1)
+	c.expectEQ(resp.Focus[0].Title, crash2.Title)
+	_, err = c.AuthGET(AccessUser, "/focus?id="+bug2.keyHash())
+	c.expectTrue(err != nil)
+}
+
+func TestFocusLookupError(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	crash := testCrashWithRepro(build, 1)
+	client.ReportCrash(crash)
+	sender := c.pollEmailBug().Sender
+	c.incomingEmail(sender, "#syz focus\n", EmailOptFrom("dev@kernel.org"))
+	c.pollEmailBug()
+
+	// The reproducer can't be loaded, but the stats are still accepted exactly once.
+	keys, err := db.NewQuery(textReproSyz).KeysOnly().GetAll(c.ctx, nil)
+	c.expectOK(err)
+	c.expectOK(db.DeleteMulti(c.ctx, keys))
+	resp := client.uploadManagerStats(&dashapi.ManagerStatsReq{Name: build.Manager, Crashes: 3})
+	c.expectEQ(len(resp.Focus), 0)
+	var stats []*ManagerStats
+	_, err = db.NewQuery("ManagerStats").GetAll(c.ctx, &stats)
+	c.expectOK(err)
+	c.expectEQ(len(stats), 1)
+	c.expectEQ(stats[0].TotalCrashes, int64(3))
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/hash"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// Crashes are normally deduplicated by title only, but the title function of the same bug
+// often varies with inlining and compiler versions. For the crash types listed in
+// FrameDedupConfig, the crash type and the top non-inlined frames of the first call trace
+// form a secondary key (Bug.FrameKey). If a crash does not match any open bug by title,
+// but matches one by the key, it's attached to that bug and its title is remembered
+// in Bug.FrameAliases (and MergedTitles, so that the next crashes match by title).
+// The key includes the crash type, so e.g. a use-after-free and a WARNING in the same
+// functions are never merged.
+
+// frameDedupKey returns the secondary dedup key of the crash,
+// or an empty string if the deduplication is not enabled for it.
+func frameDedupKey(ns string, req *dashapi.Crash) string {
+	cfg := config.Namespaces[ns].FrameDedup
+	if cfg == nil || req.Corrupted || req.Suppressed {
+		return ""
+	}
+	enabled := false
+	for _, prefix := range cfg.CrashTypes {
+		if strings.HasPrefix(req.Title, prefix) {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return ""
+	}
+	frames := callTraceFrames(req.Report, false)
+	if len(frames) < similarFrames {
+		// Too few frames give too many false matches.
+		return ""
+	}
+	var key []string
+	key = append(key, crashTitleType(req.Title))
+	for _, frame := range frames {
+		key = append(key, normalizeFrame(frame))
+	}
+	return hash.String([]byte(strings.Join(key, "\n")))
+}
+
+// crashTitleType returns the crash title without the trailing function part,
+// e.g. "KASAN: use-after-free Read" for "KASAN: use-after-free Read in foo".
+func crashTitleType(title string) string {
+	if pos := strings.LastIndex(title, " in "); pos != -1 {
+		return title[:pos]
+	}
+	return title
+}
+
+// normalizeFrame strips the compiler-generated suffixes like ".isra.0", ".constprop.0" or ".cold".
+func normalizeFrame(frame string) string {
+	if pos := strings.IndexByte(frame, '.'); pos > 0 {
+		return frame[:pos]
+	}
+	return frame
+}
+
+// findBugByFrameKey returns the open bug of the namespace with the given frame key, if any.
+func findBugByFrameKey(c context.Context, ns, key string) (*Bug, error) {
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("FrameKey=", key).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	sort.Slice(bugs, func(i, j int) bool {
+		return bugs[i].FirstTime.Before(bugs[j].FirstTime)
+	})
+	for _, bug := range bugs {
+		// Closed bugs and dups are never reused.
+		if bug.Status == BugStatusOpen {
+			return bug, nil
+		}
+	}
+	return nil, nil
+}
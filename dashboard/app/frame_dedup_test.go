@@ -0,0 +1,156 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestFrameDedupKey(t *testing.T) {
+	const ns = "access-public-email"
+	crash := func(title, report string) *dashapi.Crash {
+		return &dashapi.Crash{Title: title, Report: []byte(report)}
+	}
+	// The same non-inlined frames, but a different inlined frame and compiler suffixes.
+	otherReport := strings.Replace(strings.Replace(similarTestReport, "foo_inner", "foo_helper", 1),
+		"baz+0x10/0x20", "baz.isra.0+0x10/0x20", 1)
+	base := frameDedupKey(ns, crash("KASAN: use-after-free Read in foo_bar", similarTestReport))
+	if base == "" {
+		t.Fatalf("no key for the base crash")
+	}
+	tests := []struct {
+		crash *dashapi.Crash
+		same  bool
+		empty bool
+	}{
+		{
+			crash: crash("KASAN: use-after-free Read in foo_helper", otherReport),
+			same:  true,
+		},
+		{
+			// A different crash type in the same functions.
+			crash: crash("KASAN: slab-out-of-bounds Read in foo_bar", similarTestReport),
+		},
+		{
+			crash: crash("WARNING in foo_bar", similarTestReport),
+		},
+		{
+			// The crash type is not enabled.
+			crash: crash("general protection fault in foo_bar", similarTestReport),
+			empty: true,
+		},
+		{
+			// Too few frames.
+			crash: crash("KASAN: use-after-free Read in foo_bar", "Call Trace:\n foo_bar+0x1/0x2\n baz+0x1/0x2\n"),
+			empty: true,
+		},
+		{
+			crash: &dashapi.Crash{Title: "KASAN: use-after-free Read in foo_bar",
+				Report: []byte(similarTestReport), Corrupted: true},
+			empty: true,
+		},
+	}
+	for i, test := range tests {
+		key := frameDedupKey(ns, test.crash)
+		if test.empty {
+			if key != "" {
+				t.Errorf("test #%v: unexpected key %q", i, key)
+			}
+			continue
+		}
+		if (key == base) != test.same {
+			t.Errorf("test #%v: key %q, base %q, expected same=%v", i, key, base, test.same)
+		}
+	}
+	// The feature is off in other namespaces.
+	if key := frameDedupKey("test1", crash("KASAN: use-after-free Read in foo_bar", similarTestReport)); key != "" {
+		t.Errorf("unexpected key %q with the feature off", key)
+	}
+}
+
+func TestFrameDedup(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	crash1 := testCrash(build, 1)
+	crash1.Title = "KASAN: use-after-free Read in foo_bar"
+	crash1.Report = []byte(similarTestReport)
+	client.ReportCrash(crash1)
+	sender := client.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	// The title differs because of inlining, but the top frames are the same.
+	crash2 := testCrash(build, 2)
+	crash2.Title = "KASAN: use-after-free Read in foo_helper"
+	crash2.Report = []byte(strings.Replace(similarTestReport, "foo_inner", "foo_helper", 1))
+	client.ReportCrash(crash2)
+	c.expectNoEmail()
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.NumCrashes, int64(2))
+	c.expectEQ(bug.FrameAliases, []string{crash2.Title})
+	c.expectTrue(stringInList(bug.MergedTitles, crash2.Title))
+
+	// The next crash with the alias title is found by title.
+	client.ReportCrash(crash2)
+	c.expectNoEmail()
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.NumCrashes, int64(3))
+
+	page, err := c.AuthGET(AccessPublic, bugLink(bug.keyHash()))
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Also crashes as: <i>"+crash2.Title+"</i>"))
+
+	// A different crash type in the same functions is a different bug.
+	crash3 := testCrash(build, 3)
+	crash3.Title = "WARNING in foo_bar"
+	crash3.Report = []byte(similarTestReport)
+	client.ReportCrash(crash3)
+	client.pollEmailBug()
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.NumCrashes, int64(3))
+
+	// Once the bug is closed, the same frames create a new bug.
+	c.incomingEmail(sender, "#syz invalid")
+	crash4 := testCrash(build, 4)
+	crash4.Title = "KASAN: use-after-free Read in foo_other"
+	crash4.Report = []byte(similarTestReport)
+	client.ReportCrash(crash4)
+	client.pollEmailBug()
+}
+
+func TestFrameDedupDisabled(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash1 := testCrash(build, 1)
+	crash1.Title = "KASAN: use-after-free Read in foo_bar"
+	crash1.Report = []byte(similarTestReport)
+	c.client.ReportCrash(crash1)
+	c.client.pollBug()
+	crash2 := testCrash(build, 2)
+	crash2.Title = "KASAN: use-after-free Read in foo_helper"
+	crash2.Report = []byte(strings.Replace(similarTestReport, "foo_inner", "foo_helper", 1))
+	c.client.ReportCrash(crash2)
+	c.client.pollBug()
+
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").Filter("Namespace=", "test1").GetAll(c.ctx, &bugs)
+	c.expectOK(err)
+	c.expectEQ(len(bugs), 2)
+	for _, bug := range bugs {
+		c.expectEQ(bug.FrameKey, "")
+		c.expectEQ(len(bug.FrameAliases), 0)
+	}
+}
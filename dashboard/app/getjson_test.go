@@ -19,6 +19,23 @@ func TestJSONAPIIntegration(t *testing.T) {
 			"syzkaller-git": "https://github.com/google/syzkaller/commits/syzkaller_commit1",
 			"syzkaller-commit": "syzkaller_commit1"
 		}
+	],
+	"crashes-by-manager": [
+		{
+			"manager": "manager1",
+			"arch": "amd64",
+			"last-week": 1,
+			"last-month": 1,
+			"total": 1
+		}
+	],
+	"timeline": [
+		{
+			"time": "2000-01-01T00:00:00Z",
+			"type": "reported",
+			"actor": "system",
+			"reporting": "reporting1"
+		}
 	]
 }`,
 	)
@@ -35,6 +52,30 @@ func TestJSONAPIIntegration(t *testing.T) {
 			"syzkaller-git": "https://github.com/google/syzkaller/commits/syzkaller_commit1",
 			"syzkaller-commit": "syzkaller_commit1"
 		}
+	],
+	"crashes-by-manager": [
+		{
+			"manager": "manager1",
+			"arch": "amd64",
+			"last-week": 1,
+			"last-month": 1,
+			"total": 1
+		}
+	],
+	"timeline": [
+		{
+			"time": "2000-01-01T00:00:00Z",
+			"type": "repro-found",
+			"actor": "system",
+			"cause": "api report_crash",
+			"details": "C repro on manager1"
+		},
+		{
+			"time": "2000-01-01T00:00:00Z",
+			"type": "reported",
+			"actor": "system",
+			"reporting": "reporting2"
+		}
 	]
 }`,
 	)
@@ -505,7 +505,7 @@ func handleGraphCrashes(c context.Context, w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		return err
 	}
-	accessLevel := accessLevel(c, r)
+	accessLevel := namespaceAccessLevel(c, r, hdr.Namespace)
 	nbugs := 0
 	for _, bug := range bugs {
 		if accessLevel < bug.sanitizeAccess(accessLevel) {
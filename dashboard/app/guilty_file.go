@@ -0,0 +1,188 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	"github.com/google/syzkaller/pkg/subsystem"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// The guilty file heuristic sometimes picks a wrong file and the report goes to wrong people.
+// Users can override the guilty file of a bug with "#syz set-guilty" or via the bug page.
+// The override is stored in the bug, so it survives new crashes and report updates.
+
+// guiltyFiles returns the guilty files of the crash taking the bug override into account.
+func (bug *Bug) guiltyFiles(crash *Crash) []string {
+	if bug.GuiltyFile != "" {
+		return []string{bug.GuiltyFile}
+	}
+	return crash.ReportElements.GuiltyFiles
+}
+
+// crashMaintainers returns the maintainers responsible for the crash guilty file.
+// Maintainers that came with the crash were derived from the original guilty file,
+// so for overridden files we use the maintainers of the matching subsystems instead.
+func crashMaintainers(c context.Context, bug *Bug, crash *Crash) []string {
+	if bug.GuiltyFile == "" {
+		return crash.Maintainers
+	}
+	return guiltyFileMaintainers(c, bug.Namespace, bug.GuiltyFile)
+}
+
+func guiltyFileMaintainers(c context.Context, ns, file string) []string {
+	service := getSubsystemService(c, ns)
+	if service == nil {
+		return nil
+	}
+	var ret []string
+	for _, item := range service.Extract([]*subsystem.Crash{{GuiltyPath: file}}) {
+		ret = email.MergeEmailLists(ret, item.Emails())
+	}
+	return ret
+}
+
+func validateGuiltyFile(file string) error {
+	if file == "" || strings.ContainsAny(file, " \t\r\n") || path.IsAbs(file) ||
+		path.Clean(file) != file || file == "." || file == ".." || strings.HasPrefix(file, "../") {
+		return fmt.Errorf("%q is not a valid source file path", file)
+	}
+	return nil
+}
+
+// setBugGuiltyFile overrides the guilty file of the bug, an empty file drops the override.
+// Automatically inferred subsystems of the bug are updated right away.
+func setBugGuiltyFile(c context.Context, bugKey *db.Key, file, user string) error {
+	if file != "" {
+		if err := validateGuiltyFile(file); err != nil {
+			return err
+		}
+	}
+	now := timeNow(c)
+	bug := new(Bug)
+	changed := false
+	tx := func(c context.Context) error {
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		changed = bug.GuiltyFile != file
+		if !changed {
+			return nil
+		}
+		bug.GuiltyFile = file
+		bug.GuiltyFileHistory = append(bug.GuiltyFileHistory, BugGuiltyFileChange{
+			File: file,
+			User: user,
+			Time: now,
+		})
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	log.Infof(c, "bug %s: guilty file set to %q by %v", bug.keyHash(), file, user)
+	if bug.hasUserSubsystems() || getSubsystemService(c, bug.Namespace) == nil {
+		return nil
+	}
+	list, err := inferSubsystems(c, bug, bugKey)
+	if err != nil {
+		return fmt.Errorf("failed to infer subsystems: %w", err)
+	}
+	return updateBugSubsystems(c, bugKey, list,
+		autoInference{getSubsystemRevision(c, bug.Namespace), subsystemCauseGuiltyFile})
+}
+
+// handleSetGuiltyFile processes the guilty file form of the bug page.
+func handleSetGuiltyFile(c context.Context, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	err = setBugGuiltyFile(c, bug.key(c), strings.TrimSpace(r.FormValue("file")), author)
+	if err != nil {
+		return &ErrClient{err}
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+type uiGuiltyFile struct {
+	BugID       string
+	File        string // the file used for reporting
+	Extracted   string // the file extracted from the latest crash
+	Overridden  bool
+	SetBy       string
+	SetTime     time.Time
+	Maintainers string
+	CanEdit     bool
+}
+
+type uiGuiltyFileChange struct {
+	Time time.Time
+	User string
+	File string
+}
+
+func makeGuiltyFileUI(c context.Context, bug *Bug, sample *uiCrash, accessLevel AccessLevel) *uiGuiltyFile {
+	if accessLevel < AccessUser {
+		return nil
+	}
+	ui := &uiGuiltyFile{
+		BugID:      bug.keyHash(),
+		File:       bug.GuiltyFile,
+		Overridden: bug.GuiltyFile != "",
+		CanEdit:    accessLevel >= AccessAdmin,
+	}
+	var maintainers []string
+	if sample != nil {
+		ui.Extracted = sample.GuiltyFile
+		maintainers = sample.maintainers
+	}
+	if ui.Overridden {
+		maintainers = guiltyFileMaintainers(c, bug.Namespace, bug.GuiltyFile)
+		last := bug.GuiltyFileHistory[len(bug.GuiltyFileHistory)-1]
+		ui.SetBy, ui.SetTime = last.User, last.Time
+	} else {
+		ui.File = ui.Extracted
+	}
+	for _, item := range bug.Tags.Subsystems {
+		maintainers = email.MergeEmailLists(maintainers, subsystemMaintainers(c, bug.Namespace, item.Name))
+	}
+	ui.Maintainers = strings.Join(maintainers, ", ")
+	if ui.File == "" && !ui.CanEdit {
+		return nil
+	}
+	return ui
+}
+
+func makeGuiltyFileHistoryUI(bug *Bug) []*uiGuiltyFileChange {
+	var ret []*uiGuiltyFileChange
+	for i := len(bug.GuiltyFileHistory) - 1; i >= 0; i-- {
+		item := bug.GuiltyFileHistory[i]
+		ret = append(ret, &uiGuiltyFileChange{
+			Time: item.Time,
+			User: item.User,
+			File: item.File,
+		})
+	}
+	return ret
+}
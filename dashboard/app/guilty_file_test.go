@@ -0,0 +1,109 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestValidateGuiltyFile(t *testing.T) {
+	for file, valid := range map[string]bool{
+		"mm/slub.c":           true,
+		"a.c":                 true,
+		"include/linux/mm.h":  true,
+		"":                    false,
+		"/mm/slub.c":          false,
+		"mm/../slub.c":        false,
+		"../slub.c":           false,
+		"mm//slub.c":          false,
+		"mm/slub.c mm/slab.c": false,
+		".":                   false,
+	} {
+		if err := validateGuiltyFile(file); (err == nil) != valid {
+			t.Errorf("validateGuiltyFile(%q) = %v, expected valid=%v", file, err, valid)
+		}
+	}
+}
+
+func TestSetGuiltyFile(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.makeClient(clientPublicEmail, keyPublicEmail, true)
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	crash.GuiltyFiles = []string{"a.c"}
+	client.ReportCrash(crash)
+	c.incomingEmail(c.pollEmailBug().Sender, "#syz upstream\n")
+	sender := c.pollEmailBug().Sender
+	_, extID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+	expectSubsystems(t, client, extID, "subsystemA")
+
+	// Invalid paths are rejected.
+	c.incomingEmail(sender, "#syz set-guilty /a.c\n", EmailOptFrom("test@requester.com"))
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, `"/a.c" is not a valid source file path`))
+	bug, _, _ := c.loadBug(extID)
+	c.expectEQ(bug.GuiltyFile, "")
+
+	c.incomingEmail(sender, "#syz set-guilty b.c\n", EmailOptFrom("test@requester.com"))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "The guilty file of the bug is now b.c."))
+	bug, _, _ = c.loadBug(extID)
+	c.expectEQ(bug.GuiltyFile, "b.c")
+	c.expectEQ(len(bug.GuiltyFileHistory), 1)
+	c.expectEQ(bug.GuiltyFileHistory[0].User, "test@requester.com")
+	expectSubsystems(t, client, extID, "subsystemB")
+
+	// The override survives new crashes and report updates.
+	client.ReportCrash(crash)
+	rep, err := client.LoadBug(extID)
+	c.expectOK(err)
+	guiltyFiles := []string{"a.c"}
+	c.expectOK(client.UpdateReport(&dashapi.UpdateReportReq{
+		BugID:       extID,
+		CrashID:     rep.CrashID,
+		GuiltyFiles: &guiltyFiles,
+	}))
+	rep, err = client.LoadBug(extID)
+	c.expectOK(err)
+	c.expectEQ(rep.ReportElements.GuiltyFiles, []string{"b.c"})
+	c.expectTrue(strings.Contains(strings.Join(rep.Maintainers, " "), "subsystemB@person.com"))
+	c.advanceTime(openBugsUpdateTime + time.Hour)
+	_, err = c.AuthGET(AccessUser, "/cron/refresh_subsystems")
+	c.expectOK(err)
+	expectSubsystems(t, client, extID, "subsystemB")
+
+	// The override and its history are shown on the bug page.
+	reply1, err := c.AuthGET(AccessUser, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(reply1), "Guilty file: b.c (set by test@requester.com"))
+	c.expectTrue(strings.Contains(string(reply1), "Guilty file changes (1)"))
+	c.expectTrue(!strings.Contains(string(reply1), "set_guilty_file"))
+	reply1, err = c.AuthGET(AccessPublic, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(reply1), "Guilty file"))
+
+	// Admins can drop the override from the bug page.
+	checkRedirect(c, AccessAdmin, "/admin?action=set_guilty_file&id="+bug.keyHash()+"&file=",
+		bugLink(bug.keyHash()), http.StatusFound)
+	bug, _, _ = c.loadBug(extID)
+	c.expectEQ(bug.GuiltyFile, "")
+	c.expectEQ(len(bug.GuiltyFileHistory), 2)
+	c.expectEQ(bug.GuiltyFileHistory[1].User, "user@syzkaller.com")
+	expectSubsystems(t, client, extID, "subsystemA")
+	reply1, err = c.AuthGET(AccessAdmin, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(reply1), "override dropped"))
+	c.expectTrue(strings.Contains(string(reply1), "set_guilty_file"))
+}
@@ -26,7 +26,7 @@ import (
 type contextHandler func(c context.Context, w http.ResponseWriter, r *http.Request) error
 
 func handlerWrapper(fn contextHandler) http.Handler {
-	return handleContext(handleAuth(fn))
+	return handleContext(handleRateLimit(handleAuth(fn)))
 }
 
 func handleContext(fn contextHandler) http.Handler {
@@ -91,6 +91,8 @@ type (
 
 var ErrClientNotFound = &ErrClient{errors.New("resource not found")}
 var ErrClientBadRequest = &ErrClient{errors.New("bad request")}
+var ErrClientGone = &ErrClient{errors.New("no longer available")}
+var ErrReadOnly = &ErrClient{errors.New("the dashboard is in read-only mode for maintenance, try again later")}
 
 func (ce *ErrClient) HTTPStatus() int {
 	switch ce {
@@ -98,6 +100,10 @@ func (ce *ErrClient) HTTPStatus() int {
 		return http.StatusNotFound
 	case ErrClientBadRequest:
 		return http.StatusBadRequest
+	case ErrClientGone:
+		return http.StatusGone
+	case ErrReadOnly:
+		return http.StatusServiceUnavailable
 	}
 	return http.StatusInternalServerError
 }
@@ -131,6 +137,7 @@ type uiHeader struct {
 	BugCounts           *CachedBugStats
 	Namespaces          []uiNamespace
 	ShowSubsystems      bool
+	ReadOnly            *uiReadOnlyBanner
 }
 
 type uiNamespace struct {
@@ -148,6 +155,7 @@ func commonHeaderRaw(c context.Context, r *http.Request) *uiHeader {
 		URLPath:             r.URL.Path,
 		AnalyticsTrackingID: config.AnalyticsTrackingID,
 		ContactEmail:        config.ContactEmail,
+		ReadOnly:            makeReadOnlyBanner(c),
 	}
 	if user.Current(c) == nil {
 		h.LoginLink, _ = user.LoginURL(c, r.URL.String())
@@ -170,8 +178,12 @@ func commonHeader(c context.Context, r *http.Request, w http.ResponseWriter, ns
 	const adminPage = "admin"
 	isAdminPage := r.URL.Path == "/"+adminPage
 	found := false
+	var roles map[string]AccessLevel
+	if accessLevel != AccessAdmin {
+		roles = userNamespaceRoles(c)
+	}
 	for ns1, cfg := range config.Namespaces {
-		if accessLevel < cfg.AccessLevel {
+		if withNamespaceRole(accessLevel, roles, ns1) < cfg.AccessLevel {
 			if ns1 == ns {
 				return nil, ErrAccess
 			}
@@ -194,7 +206,8 @@ func commonHeader(c context.Context, r *http.Request, w http.ResponseWriter, ns
 	cookie := decodeCookie(r)
 	if !found {
 		ns = config.DefaultNamespace
-		if cfg := config.Namespaces[cookie.Namespace]; cfg != nil && cfg.AccessLevel <= accessLevel {
+		if cfg := config.Namespaces[cookie.Namespace]; cfg != nil &&
+			cfg.AccessLevel <= withNamespaceRole(accessLevel, roles, cookie.Namespace) {
 			ns = cookie.Namespace
 		}
 		if accessLevel == AccessAdmin {
@@ -206,6 +219,7 @@ func commonHeader(c context.Context, r *http.Request, w http.ResponseWriter, ns
 	}
 	if ns != adminPage {
 		h.Namespace = ns
+		h.Admin = withNamespaceRole(accessLevel, roles, ns) == AccessAdmin
 		h.ShowSubsystems = getSubsystemService(c, ns) != nil
 		cookie.Namespace = ns
 		encodeCookie(w, cookie)
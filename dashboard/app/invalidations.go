@@ -0,0 +1,205 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Bugs record who invalidated them and why, so that admins can review recent invalidations
+// on the /invalidations page and reopen the bugs that were closed by mistake.
+
+// Only the latest invalidations are kept to limit the size of the bug entity.
+const maxBugInvalidations = 10
+
+// Only that many recently closed bugs are reviewed.
+const maxReviewedInvalidations = 100
+
+func (bug *Bug) recordInvalidation(now time.Time, reporting, user, reason string) {
+	bug.Invalidations = append(bug.Invalidations, BugInvalidation{
+		Time:      now,
+		Reporting: reporting,
+		User:      user,
+		Reason:    reason,
+	})
+	if len(bug.Invalidations) > maxBugInvalidations {
+		bug.Invalidations = bug.Invalidations[len(bug.Invalidations)-maxBugInvalidations:]
+	}
+}
+
+// lastInvalidation returns the invalidation that closed the bug, if it's known.
+func (bug *Bug) lastInvalidation() *BugInvalidation {
+	if bug.Status != BugStatusInvalid || len(bug.Invalidations) == 0 {
+		return nil
+	}
+	inv := &bug.Invalidations[len(bug.Invalidations)-1]
+	if !inv.RevertedTime.IsZero() {
+		return nil
+	}
+	return inv
+}
+
+type uiInvalidationsPage struct {
+	Header        *uiHeader
+	Invalidations []*uiInvalidation
+}
+
+type uiInvalidation struct {
+	BugID     string
+	BugTitle  string
+	BugLink   string
+	Time      time.Time
+	Reporting string
+	User      string
+	Reason    string
+}
+
+// handleInvalidations serves the list of recently invalidated bugs of a namespace.
+func handleInvalidations(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns := r.FormValue("ns")
+	if ns == "" {
+		ns = config.DefaultNamespace
+	}
+	if namespaceAccessLevel(c, r, ns) != AccessAdmin {
+		return ErrAccess
+	}
+	hdr, err := commonHeader(c, r, w, ns)
+	if err != nil {
+		return err
+	}
+	switch action := r.FormValue("action"); action {
+	case "":
+	case "revert":
+		author := ""
+		if u := user.Current(c); u != nil {
+			author = u.Email
+		}
+		if err := revertInvalidation(c, hdr.Namespace, r.FormValue("id"), author); err != nil {
+			return err
+		}
+		return ErrRedirect{fmt.Errorf("/invalidations?ns=%v", url.QueryEscape(hdr.Namespace))}
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrClientBadRequest, action)
+	}
+	list, err := loadRecentInvalidations(c, hdr.Namespace)
+	if err != nil {
+		return err
+	}
+	return serveTemplate(w, "invalidations.html", &uiInvalidationsPage{
+		Header:        hdr,
+		Invalidations: list,
+	})
+}
+
+func loadRecentInvalidations(c context.Context, ns string) ([]*uiInvalidation, error) {
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("Status=", BugStatusInvalid).
+		Order("-Closed").
+		Limit(maxReviewedInvalidations).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	var ret []*uiInvalidation
+	for _, bug := range bugs {
+		inv := bug.lastInvalidation()
+		if inv == nil {
+			// The bug was closed before the invalidations were recorded.
+			continue
+		}
+		ret = append(ret, &uiInvalidation{
+			BugID:     bug.keyHash(),
+			BugTitle:  bug.displayTitle(),
+			BugLink:   bugLink(bug.keyHash()),
+			Time:      inv.Time,
+			Reporting: inv.Reporting,
+			User:      inv.User,
+			Reason:    inv.Reason,
+		})
+	}
+	return ret, nil
+}
+
+// revertInvalidation reopens the invalidated bug in the reporting that closed it.
+func revertInvalidation(c context.Context, ns, bugID, author string) error {
+	bugKey := db.NewKey(c, "Bug", bugID, 0, nil)
+	bug := new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		if err == db.ErrNoSuchEntity {
+			return fmt.Errorf("bug %v: %w", bugID, ErrClientNotFound)
+		}
+		return fmt.Errorf("failed to get bug: %w", err)
+	}
+	if bug.Namespace != ns {
+		return fmt.Errorf("bug %v: %w", bugID, ErrClientNotFound)
+	}
+	// New crashes of invalid bugs create new bugs with the same title,
+	// there must be only one open bug per title.
+	newer, err := db.NewQuery("Bug").
+		Filter("Namespace=", bug.Namespace).
+		Filter("Title=", bug.Title).
+		Filter("Seq>", bug.Seq).
+		KeysOnly().
+		Limit(1).
+		GetAll(c, nil)
+	if err != nil {
+		return fmt.Errorf("failed to query bugs: %w", err)
+	}
+	if len(newer) != 0 {
+		return fmt.Errorf("%w: the bug has already happened again as %v",
+			ErrClientBadRequest, newer[0].StringID())
+	}
+	now := timeNow(c)
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		inv := bug.lastInvalidation()
+		if inv == nil {
+			return fmt.Errorf("%w: the bug is not invalidated", ErrClientBadRequest)
+		}
+		bugReporting := bugReportingByName(bug, inv.Reporting)
+		if bugReporting == nil {
+			return fmt.Errorf("%w: no reporting %q", ErrClientBadRequest, inv.Reporting)
+		}
+		inv.RevertedBy = author
+		inv.RevertedTime = now
+		bug.Status = BugStatusOpen
+		bug.StatusReason = ""
+		bug.Closed = time.Time{}
+		bug.LastActivity = now
+		bugReporting.Closed = time.Time{}
+		bugReporting.Auto = false
+		bug.recordEvent(BugEvent{
+			Type:      BugEventReopened,
+			Time:      now,
+			Actor:     BugActorAdmin,
+			User:      author,
+			Cause:     eventCause(causePage, "/invalidations"),
+			Reporting: bugReporting.Name,
+			Details:   "the invalidation was reverted",
+		})
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return saveBugEvents(c, bugKey, bug)
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	invalidateBugLists(c, ns)
+	log.Infof(c, "bug %v: invalidation reverted by %v", bugID, author)
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestInvalidationReason(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	config.Namespaces["access-public-email"].InvalidReason = InvalidReasonReject
+	defer func() { config.Namespaces["access-public-email"].InvalidReason = InvalidReasonOptional }()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	msg := c.pollEmailBug()
+	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+
+	c.incomingEmail(msg.Sender, "#syz invalid\nit's a broken test setup\n", EmailOptMessageID(1))
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "The bug was not invalidated"))
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.Status, BugStatusOpen)
+
+	c.incomingEmail(msg.Sender, "#syz invalid: it's a broken test setup\n", EmailOptMessageID(2),
+		EmailOptFrom("developer@kernel.org"))
+	c.expectNoEmail()
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.Status, BugStatusInvalid)
+	c.expectEQ(len(bug.Invalidations), 1)
+	c.expectEQ(bug.Invalidations[0].User, "developer@kernel.org")
+	c.expectEQ(bug.Invalidations[0].Reason, "it's a broken test setup")
+	c.expectEQ(bug.Invalidations[0].Reporting, "access-public-email-reporting1")
+}
+
+func TestInvalidationReasonWarning(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	config.Namespaces["access-public-email"].InvalidReason = InvalidReasonWarn
+	defer func() { config.Namespaces["access-public-email"].InvalidReason = InvalidReasonOptional }()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	msg := c.pollEmailBug()
+	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+
+	c.incomingEmail(msg.Sender, "#syz invalid")
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "The bug was invalidated, but next time"))
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.Status, BugStatusInvalid)
+	c.expectEQ(bug.Invalidations[0].Reason, "")
+}
+
+func TestRevertInvalidation(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	client.ReportCrash(testCrash(build, 2))
+	msg1 := c.pollEmailBug()
+	msg2 := c.pollEmailBug()
+	_, extBugID1, err := email.RemoveAddrContext(msg1.Sender)
+	c.expectOK(err)
+	_, extBugID2, err := email.RemoveAddrContext(msg2.Sender)
+	c.expectOK(err)
+	c.incomingEmail(msg1.Sender, "#syz invalid: a false positive", EmailOptMessageID(1))
+	c.incomingEmail(msg2.Sender, "#syz invalid: another false positive", EmailOptMessageID(2))
+	bug1, _, _ := c.loadBug(extBugID1)
+	bug2, _, _ := c.loadBug(extBugID2)
+
+	const pageURL = "/invalidations?ns=access-public-email"
+	_, err = c.AuthGET(AccessUser, pageURL)
+	c.expectForbidden(err)
+	page, err := c.AuthGET(AccessAdmin, pageURL)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Recent invalidations (2)")))
+	c.expectTrue(bytes.Contains(page, []byte("another false positive")))
+
+	checkRedirect(c, AccessAdmin, pageURL+"&action=revert&id="+bug1.keyHash(), pageURL, http.StatusFound)
+	bug1, _, _ = c.loadBug(extBugID1)
+	c.expectEQ(bug1.Status, BugStatusOpen)
+	c.expectTrue(bug1.Closed.IsZero())
+	c.expectTrue(bug1.Reporting[0].Closed.IsZero())
+	c.expectTrue(!bug1.Invalidations[0].RevertedTime.IsZero())
+	page, err = c.AuthGET(AccessAdmin, pageURL)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Recent invalidations (1)")))
+
+	// The reopened bug is updated by new crashes and can be invalidated again.
+	client.ReportCrash(testCrash(build, 1))
+	c.expectNoEmail()
+	c.incomingEmail(msg1.Sender, "#syz invalid: a false positive after all", EmailOptMessageID(3))
+	bug1, _, _ = c.loadBug(extBugID1)
+	c.expectEQ(bug1.Status, BugStatusInvalid)
+	c.expectEQ(len(bug1.Invalidations), 2)
+
+	// The bug that happened again can't be reopened.
+	client.ReportCrash(testCrash(build, 2))
+	c.pollEmailBug()
+	_, err = c.AuthGET(AccessAdmin, pageURL+"&action=revert&id="+bug2.keyHash())
+	c.expectBadReqest(err)
+}
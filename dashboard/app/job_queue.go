@@ -0,0 +1,268 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// The /jobs page shows the job queue of a namespace, admins may cancel pending jobs there.
+// A cancelled job is finished without a result and is never given out to syz-ci.
+
+const (
+	jobStatePending   = "pending"
+	jobStateRunning   = "running"
+	jobStateFinished  = "finished"
+	jobStateCancelled = "cancelled"
+)
+
+// Only that many recently finished jobs are shown.
+const maxFinishedJobs = 100
+
+func (job *Job) state() string {
+	switch {
+	case job.Cancelled:
+		return jobStateCancelled
+	case !job.Finished.IsZero():
+		return jobStateFinished
+	case job.IsRunning:
+		return jobStateRunning
+	default:
+		return jobStatePending
+	}
+}
+
+type uiJobQueuePage struct {
+	Header    *uiHeader
+	State     string
+	Manager   string
+	States    []string
+	Managers  []string
+	CanCancel bool
+	Jobs      []*uiQueuedJob
+}
+
+type uiQueuedJob struct {
+	*uiJob
+	ID    string
+	State string
+	Age   time.Duration
+}
+
+// handleJobQueue serves the list of pending, running and recently finished jobs of a namespace.
+func handleJobQueue(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns := r.FormValue("ns")
+	if ns == "" {
+		ns = config.DefaultNamespace
+	}
+	hdr, err := commonHeader(c, r, w, ns)
+	if err != nil {
+		return err
+	}
+	accessLevel := namespaceAccessLevel(c, r, hdr.Namespace)
+	switch action := r.FormValue("action"); action {
+	case "":
+	case "cancel":
+		if accessLevel != AccessAdmin {
+			return ErrAccess
+		}
+		if err := cancelJob(c, hdr.Namespace, r.FormValue("id")); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrClientBadRequest, action)
+	}
+	page := &uiJobQueuePage{
+		Header:    hdr,
+		State:     r.FormValue("state"),
+		Manager:   r.FormValue("manager"),
+		States:    []string{jobStatePending, jobStateRunning, jobStateFinished, jobStateCancelled},
+		CanCancel: accessLevel == AccessAdmin,
+	}
+	if page.State != "" && !stringInList(page.States, page.State) {
+		return fmt.Errorf("%w: unknown job state %q", ErrClientBadRequest, page.State)
+	}
+	jobs, keys, err := loadQueuedJobs(c, hdr.Namespace, page.State)
+	if err != nil {
+		return err
+	}
+	bugs, err := loadJobBugs(c, keys)
+	if err != nil {
+		return err
+	}
+	managers := map[string]bool{}
+	for i, job := range jobs {
+		bug := bugs[keys[i].Parent().StringID()]
+		if bug == nil || accessLevel < bug.sanitizeAccess(accessLevel) {
+			continue
+		}
+		managers[job.Manager] = true
+		if page.Manager != "" && job.Manager != page.Manager ||
+			page.State != "" && job.state() != page.State {
+			continue
+		}
+		page.Jobs = append(page.Jobs, &uiQueuedJob{
+			uiJob: makeUIJob(job, keys[i], nil, nil, nil),
+			ID:    extJobID(keys[i]),
+			State: job.state(),
+			Age:   timeNow(c).Sub(job.Created),
+		})
+	}
+	for mgr := range managers {
+		page.Managers = append(page.Managers, mgr)
+	}
+	sort.Strings(page.Managers)
+	return serveTemplate(w, "jobs.html", page)
+}
+
+// loadQueuedJobs returns the unfinished jobs of the namespace, the oldest first,
+// followed by the recently finished ones, the most recent first.
+func loadQueuedJobs(c context.Context, ns, state string) ([]*Job, []*db.Key, error) {
+	var jobs []*Job
+	var keys []*db.Key
+	if state == "" || state == jobStatePending || state == jobStateRunning {
+		var err error
+		keys, err = db.NewQuery("Job").
+			Filter("Namespace=", ns).
+			Filter("Finished=", time.Time{}).
+			GetAll(c, &jobs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query jobs: %w", err)
+		}
+		sort.Stable(&jobCreatedSorter{jobs: jobs, keys: keys})
+	}
+	if state == "" || state == jobStateFinished || state == jobStateCancelled {
+		var finished []*Job
+		finishedKeys, err := db.NewQuery("Job").
+			Filter("Namespace=", ns).
+			Filter("Finished>", time.Time{}).
+			Order("-Finished").
+			Limit(maxFinishedJobs).
+			GetAll(c, &finished)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query jobs: %w", err)
+		}
+		jobs = append(jobs, finished...)
+		keys = append(keys, finishedKeys...)
+	}
+	return jobs, keys, nil
+}
+
+type jobCreatedSorter struct {
+	jobs []*Job
+	keys []*db.Key
+}
+
+func (s *jobCreatedSorter) Len() int { return len(s.jobs) }
+func (s *jobCreatedSorter) Less(i, j int) bool {
+	return s.jobs[i].Created.Before(s.jobs[j].Created)
+}
+func (s *jobCreatedSorter) Swap(i, j int) {
+	s.jobs[i], s.jobs[j] = s.jobs[j], s.jobs[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// loadJobBugs returns the parent bugs of the jobs by their key hashes.
+func loadJobBugs(c context.Context, jobKeys []*db.Key) (map[string]*Bug, error) {
+	var keys []*db.Key
+	seen := map[string]bool{}
+	for _, key := range jobKeys {
+		if id := key.Parent().StringID(); !seen[id] {
+			seen[id] = true
+			keys = append(keys, key.Parent())
+		}
+	}
+	bugs := make([]*Bug, len(keys))
+	if err := db.GetMulti(c, keys, bugs); err != nil {
+		var merr appengine.MultiError
+		if !errors.As(err, &merr) {
+			return nil, fmt.Errorf("failed to get bugs: %w", err)
+		}
+		for i, err := range merr {
+			if err == db.ErrNoSuchEntity {
+				bugs[i] = nil
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to get bugs: %w", err)
+			}
+		}
+	}
+	ret := map[string]*Bug{}
+	for i, bug := range bugs {
+		if bug != nil {
+			ret[keys[i].StringID()] = bug
+		}
+	}
+	return ret, nil
+}
+
+// cancelJob finishes the pending job without a result. Jobs that syz-ci has already
+// claimed can no longer be cancelled: both the claim in createJobResp and the cancellation
+// are transactions on the job entity, so exactly one of them wins a concurrent race.
+func cancelJob(c context.Context, ns, jobID string) error {
+	jobKey, err := jobID2Key(c, jobID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrClientBadRequest, err)
+	}
+	now := timeNow(c)
+	tx := func(c context.Context) error {
+		job := new(Job)
+		if err := db.Get(c, jobKey, job); err != nil {
+			if err == db.ErrNoSuchEntity {
+				return fmt.Errorf("job %v: %w", jobID, ErrClientNotFound)
+			}
+			return fmt.Errorf("job %v: failed to get job: %w", jobID, err)
+		}
+		if job.Namespace != ns {
+			return fmt.Errorf("job %v: %w", jobID, ErrClientNotFound)
+		}
+		if state := job.state(); state != jobStatePending {
+			return fmt.Errorf("%w: job %v is already %v", ErrClientBadRequest, jobID, state)
+		}
+		job.Cancelled = true
+		job.Finished = now
+		// There's no result to report.
+		job.Reported = true
+		if job.Type == JobBisectCause || job.Type == JobBisectFix {
+			if err := cancelBugBisection(c, jobKey.Parent(), job.Type); err != nil {
+				return err
+			}
+		}
+		if _, err := db.Put(c, jobKey, job); err != nil {
+			return fmt.Errorf("job %v: failed to put job: %w", jobID, err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	log.Infof(c, "cancelled job %v", jobID)
+	return nil
+}
+
+// cancelBugBisection treats the cancelled bisection as a failed one,
+// so that it's retried (see needBisectionRetry) once the bug gets a better reproducer.
+func cancelBugBisection(c context.Context, bugKey *db.Key, typ JobType) error {
+	bug := new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return fmt.Errorf("failed to get bug: %w", err)
+	}
+	if typ == JobBisectCause {
+		bug.BisectCause = BisectError
+	} else {
+		bug.BisectFix = BisectError
+	}
+	if _, err := db.Put(c, bugKey, bug); err != nil {
+		return fmt.Errorf("failed to put bug: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestJobState(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		job   *Job
+		state string
+	}{
+		{&Job{}, jobStatePending},
+		{&Job{Attempts: 1, IsRunning: true, LastStarted: now}, jobStateRunning},
+		{&Job{Attempts: 1, LastStarted: now, Finished: now}, jobStateFinished},
+		{&Job{Finished: now, Cancelled: true}, jobStateCancelled},
+	}
+	for i, test := range tests {
+		if got := test.job.state(); got != test.state {
+			t.Errorf("#%v: got %q, want %q", i, got, test.state)
+		}
+	}
+}
+
+func TestJobQueueCancel(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrashWithRepro(build, 1))
+	sender := c.pollEmailBug().Sender
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch\n"+sampleGitPatch,
+		EmailOptMessageID(1))
+	c.advanceTime(time.Minute)
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch\n"+sampleGitPatch,
+		EmailOptMessageID(2))
+	var jobs []*Job
+	keys, err := db.NewQuery("Job").Order("Created").GetAll(c.ctx, &jobs)
+	c.expectOK(err)
+	c.expectEQ(len(jobs), 2)
+	cancelURL := func(key *db.Key) string {
+		return "/jobs?ns=access-public-email&action=cancel&id=" + url.QueryEscape(extJobID(key))
+	}
+
+	// Only admins may cancel jobs.
+	page, err := c.AuthGET(AccessPublic, "/jobs?ns=access-public-email")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("title1")))
+	c.expectTrue(!bytes.Contains(page, []byte("action=cancel")))
+	_, err = c.AuthGET(AccessPublic, cancelURL(keys[1]))
+	c.expectForbidden(err)
+	page, err = c.AuthGET(AccessAdmin, "/jobs?ns=access-public-email")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("action=cancel")))
+
+	// The job claimed by syz-ci can no longer be cancelled.
+	testJobs := dashapi.ManagerJobs{TestPatches: true}
+	resp := client.pollSpecificJobs(build.Manager, testJobs)
+	c.expectEQ(resp.ID, extJobID(keys[0]))
+	_, err = c.AuthGET(AccessAdmin, cancelURL(keys[0]))
+	c.expectBadReqest(err)
+
+	// The job is cancelled after syz-ci has queried it, but before it managed to claim it.
+	job, jobKey, err := loadPendingJob(c.ctx, map[string]dashapi.ManagerJobs{build.Manager: testJobs})
+	c.expectOK(err)
+	c.expectEQ(extJobID(jobKey), extJobID(keys[1]))
+	_, err = c.AuthGET(AccessAdmin, cancelURL(keys[1]))
+	c.expectOK(err)
+	_, stale, err := createJobResp(c.ctx, job, jobKey)
+	c.expectOK(err)
+	c.expectTrue(stale)
+	c.expectEQ(client.pollSpecificJobs(build.Manager, testJobs).ID, "")
+	_, err = c.AuthGET(AccessAdmin, cancelURL(keys[1]))
+	c.expectBadReqest(err)
+
+	page, err = c.AuthGET(AccessPublic, "/jobs?ns=access-public-email&state=cancelled")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Jobs (1)")))
+	page, err = c.AuthGET(AccessPublic, "/jobs?ns=access-public-email&manager=unknown")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Jobs (0)")))
+
+	// Only the finished job is reported.
+	client.expectOK(client.JobDone(&dashapi.JobDoneReq{
+		ID:    resp.ID,
+		Build: *build,
+	}))
+	c.pollEmailBug()
+	c.expectNoEmail()
+}
@@ -27,9 +27,12 @@ type testReqArgs struct {
 	extID        string
 	link         string
 	patch        []byte
+	config       []byte // custom kernel config, if any
 	repo         string
 	branch       string
 	jobCC        []string
+	testOn       string // manager or arch requested with "#syz test-on"
+	reproID      int64  // reproducer requested with "repro=N" (see bug_repros.go)
 }
 
 // handleTestRequest added new job to db.
@@ -52,10 +55,26 @@ func handleTestRequest(c context.Context, args *testReqArgs) error {
 	if err != nil {
 		return fmt.Errorf("failed to find a crash: %v", err)
 	}
-	err = addTestJob(c, &testJobArgs{
+	repro, err := args.bug.selectRepro(args.reproID, crash)
+	if err != nil {
+		return err
+	}
+	jobArgs := &testJobArgs{
 		testReqArgs: *args,
 		crash:       crash, crashKey: crashKey,
-	}, now)
+	}
+	// Only the uploaded repros are referenced by the job, syzbot repros are run as the repros of their crashes.
+	jobArgs.reproID = 0
+	if repro != nil && repro.Origin == ReproOriginSyzbot {
+		jobArgs.crashKey = db.NewKey(c, "Crash", "", repro.CrashID, args.bugKey)
+		jobArgs.crash = new(Crash)
+		if err := db.Get(c, jobArgs.crashKey, jobArgs.crash); err != nil {
+			return fmt.Errorf("failed to get the crash of repro %v: %v", repro.ID, err)
+		}
+	} else if repro != nil {
+		jobArgs.reproID = repro.ID
+	}
+	err = addTestJob(c, jobArgs, now)
 	if err != nil {
 		return err
 	}
@@ -87,15 +106,30 @@ type testJobArgs struct {
 	crash     *Crash
 	crashKey  *db.Key
 	configRef int64
+	// Set for automatic tests of patches posted to bug discussions (see Job.AutoTest).
+	autoTest string
 	testReqArgs
 }
 
 func addTestJob(c context.Context, args *testJobArgs, now time.Time) error {
-	if reason := checkTestJob(c, args.bug, args.bugReporting, args.crash,
+	if reason := checkTestJob(c, args.bug, args.bugReporting, args.crash, args.reproID != 0,
 		args.repo, args.branch); reason != "" {
 		return &BadTestRequestError{reason}
 	}
 	manager, mgrConfig := activeManager(args.crash.Manager, args.bug.Namespace)
+	var onManagers []string
+	if args.testOn != "" {
+		var err error
+		onManagers, err = testOnManagers(c, args.bug.Namespace, args.testOn)
+		if err != nil {
+			return err
+		}
+		if len(onManagers) == 0 {
+			return &BadTestRequestError{fmt.Sprintf("%q is neither a manager nor an arch of the active managers.",
+				args.testOn)}
+		}
+		manager, mgrConfig = activeManager(onManagers[0], args.bug.Namespace)
+	}
 	if mgrConfig != nil && mgrConfig.RestrictedTestingRepo != "" &&
 		args.repo != mgrConfig.RestrictedTestingRepo {
 		return &BadTestRequestError{mgrConfig.RestrictedTestingReason}
@@ -104,6 +138,12 @@ func addTestJob(c context.Context, args *testJobArgs, now time.Time) error {
 	if err != nil {
 		return err
 	}
+	configRef := args.configRef
+	if len(args.config) != 0 {
+		if configRef, err = putText(c, args.bug.Namespace, textKernelConfig, args.config, true); err != nil {
+			return err
+		}
+	}
 	reportingName := ""
 	if args.bugReporting != nil {
 		reportingName = args.bugReporting.Name
@@ -123,7 +163,13 @@ func addTestJob(c context.Context, args *testJobArgs, now time.Time) error {
 		KernelRepo:   args.repo,
 		KernelBranch: args.branch,
 		Patch:        patchID,
-		KernelConfig: args.configRef,
+		KernelConfig: configRef,
+		AutoTest:     args.autoTest,
+		TestOn:       args.testOn,
+		ReproID:      args.reproID,
+	}
+	if args.testOn != "" {
+		job.TestOnManagers = onManagers
 	}
 
 	deletePatch := false
@@ -177,12 +223,12 @@ func addTestJob(c context.Context, args *testJobArgs, now time.Time) error {
 }
 
 func checkTestJob(c context.Context, bug *Bug, bugReporting *BugReporting, crash *Crash,
-	repo, branch string) string {
+	uploadedRepro bool, repo, branch string) string {
 	needRepro := !strings.Contains(crash.Title, "boot error:") &&
 		!strings.Contains(crash.Title, "test error:") &&
 		!strings.Contains(crash.Title, "build error")
 	switch {
-	case needRepro && crash.ReproC == 0 && crash.ReproSyz == 0:
+	case needRepro && crash.ReproC == 0 && crash.ReproSyz == 0 && !uploadedRepro:
 		return "This crash does not have a reproducer. I cannot test it."
 	case !vcs.CheckRepoAddress(repo):
 		return fmt.Sprintf("%q does not look like a valid git repo address.", repo)
@@ -238,6 +284,10 @@ func getNextJob(c context.Context, managers map[string]dashapi.ManagerJobs) (*Jo
 	if job != nil || err != nil {
 		return job, jobKey, err
 	}
+	job, jobKey, err = createBuildBisectJob(c, managers)
+	if job != nil || err != nil {
+		return job, jobKey, err
+	}
 	// We need both C and syz repros, but the crazy datastore query restrictions
 	// do not allow to use ReproLevel>ReproLevelNone in the query. So we do 2 separate queries.
 	// C repros tend to be of higher reliability so maybe it's not bad.
@@ -304,8 +354,9 @@ func handleRetestForBug(c context.Context, now time.Time, bug *Bug, bugKey *db.K
 		if now.Sub(crash.LastReproRetest) < config.Obsoleting.ReproRetestPeriod {
 			continue
 		}
-		if crash.ReproIsRevoked {
-			// No sense in retesting the already revoked repro.
+		if crash.ReproIsRevoked && !bug.ReproRevoked {
+			// No sense in retesting the already revoked repro while others still work.
+			// But if all repros are revoked, keep checking whether they work again.
 			continue
 		}
 		// TODO: check if the manager can do such jobs.
@@ -427,7 +478,8 @@ func bisectCrashForBug(c context.Context, bug *Bug, bugKey *db.Key, managers map
 	if err != nil {
 		return nil, nil, err
 	}
-	for ci, crash := range crashes {
+	for _, ci := range reproReliabilityOrder(crashes) {
+		crash := crashes[ci]
 		if crash.ReproSyz == 0 || !managers[crash.Manager] {
 			continue
 		}
@@ -440,6 +492,65 @@ func bisectCrashForBug(c context.Context, bug *Bug, bugKey *db.Key, managers map
 	return nil, nil, nil
 }
 
+// needBisectionRetry decides whether the last bisection of the bug must be repeated
+// because the bug now has a better reproducer than the one the bisection used.
+// The results that are likely to be affected by a bad reproducer are retried,
+// each improvement of the reproducer triggers at most one retry.
+func needBisectionRetry(status BisectStatus, jobReproLevel, bugReproLevel dashapi.ReproLevel) bool {
+	return retryableBisection(status) && jobReproLevel < bugReproLevel
+}
+
+func retryableBisection(status BisectStatus) bool {
+	return status == BisectError || status == BisectUnreliable || status == BisectInconclusive
+}
+
+// retryBisections resets the inconclusive bisections of the bug after its reproducer has improved,
+// so that the bug is picked up again by findBugsForBisection.
+func retryBisections(c context.Context, bug *Bug, bugKey *db.Key) error {
+	for _, jobType := range []JobType{JobBisectCause, JobBisectFix} {
+		status := bug.BisectCause
+		if jobType == JobBisectFix {
+			status = bug.BisectFix
+		}
+		if !retryableBisection(status) {
+			continue
+		}
+		job, crash, _, _, err := loadBisectJob(c, bug, jobType)
+		if err != nil {
+			return err
+		}
+		jobReproLevel := job.ReproLevel
+		if jobReproLevel == ReproLevelNone {
+			// Jobs created before ReproLevel was introduced.
+			jobReproLevel = crash.reproLevel()
+		}
+		if !needBisectionRetry(status, jobReproLevel, bug.ReproLevel) {
+			continue
+		}
+		tx := func(c context.Context) error {
+			bug := new(Bug)
+			if err := db.Get(c, bugKey, bug); err != nil {
+				return fmt.Errorf("failed to get bug: %v", err)
+			}
+			if jobType == JobBisectCause && bug.BisectCause == status {
+				bug.BisectCause = BisectNot
+			} else if jobType == JobBisectFix && bug.BisectFix == status {
+				bug.BisectFix = BisectNot
+			} else {
+				return nil
+			}
+			_, err := db.Put(c, bugKey, bug)
+			return err
+		}
+		if err := db.RunInTransaction(c, tx, nil); err != nil {
+			return fmt.Errorf("failed to reset bisection: %v", err)
+		}
+		log.Infof(c, "%v: retrying %v bisection of %q with a better repro",
+			bug.Namespace, status, bug.Title)
+	}
+	return nil
+}
+
 func createBisectJobForBug(c context.Context, bug0 *Bug, crash *Crash, bugKey, crashKey *db.Key, jobType JobType) (
 	*Job, *db.Key, error) {
 	build, err := loadBuild(c, bug0.Namespace, crash.BuildID)
@@ -456,6 +567,7 @@ func createBisectJobForBug(c context.Context, bug0 *Bug, crash *Crash, bugKey, c
 		KernelBranch: build.KernelBranch,
 		BugTitle:     bug0.displayTitle(),
 		CrashID:      crashKey.IntID(),
+		ReproLevel:   crash.reproLevel(),
 	}
 	var jobKey *db.Key
 	tx := func(c context.Context) error {
@@ -475,6 +587,11 @@ func createBisectJobForBug(c context.Context, bug0 *Bug, crash *Crash, bugKey, c
 		} else {
 			bug.BisectFix = BisectPending
 		}
+		job.TestRepeats = 0
+		if bug.BisectRetestPending {
+			job.TestRepeats = bisectRetestRepeats
+			bug.BisectRetestPending = false
+		}
 		// Create a new job.
 		var err error
 		jobKey = db.NewIncompleteKey(c, "Job", bugKey)
@@ -498,6 +615,8 @@ func createBisectJobForBug(c context.Context, bug0 *Bug, crash *Crash, bugKey, c
 
 func createJobResp(c context.Context, job *Job, jobKey *db.Key) (*dashapi.JobPollResp, bool, error) {
 	jobID := extJobID(jobKey)
+	// For test-on jobs, loadPendingJob has picked the manager that claims the job.
+	manager := job.Manager
 	patch, _, err := getText(c, textPatch, job.Patch)
 	if err != nil {
 		return nil, false, err
@@ -510,6 +629,10 @@ func createJobResp(c context.Context, job *Job, jobKey *db.Key) (*dashapi.JobPol
 	}
 
 	build, err := loadBuild(c, job.Namespace, crash.BuildID)
+	if job.TestOn != "" {
+		// The crash build may be for a different arch, so test on what the manager runs.
+		build, err = lastManagerBuild(c, job.Namespace, manager)
+	}
 	if err != nil {
 		return nil, false, err
 	}
@@ -527,10 +650,16 @@ func createJobResp(c context.Context, job *Job, jobKey *db.Key) (*dashapi.JobPol
 	if err != nil {
 		return nil, false, err
 	}
-	reproSyz, err := loadReproSyz(c, crash)
+	reproSyz, err := loadJobReproSyz(c, crash)
 	if err != nil {
 		return nil, false, err
 	}
+	reproOpts := crash.ReproOpts
+	if job.ReproID != 0 {
+		if reproSyz, reproC, reproOpts, err = loadJobRepro(c, job, bugKey); err != nil {
+			return nil, false, err
+		}
+	}
 
 	now := timeNow(c)
 	stale := false
@@ -542,9 +671,13 @@ func createJobResp(c context.Context, job *Job, jobKey *db.Key) (*dashapi.JobPol
 		}
 		if !job.Finished.IsZero() {
 			// This happens sometimes due to inconsistent db.
+			// Or the job was cancelled after loadPendingJob has queried it.
 			stale = true
 			return nil
 		}
+		if job.TestOn != "" {
+			job.Manager = manager
+		}
 		job.Attempts++
 		job.IsRunning = true
 		job.LastStarted = now
@@ -570,9 +703,11 @@ func createJobResp(c context.Context, job *Job, jobKey *db.Key) (*dashapi.JobPol
 		KernelConfig:      kernelConfig,
 		SyzkallerCommit:   build.SyzkallerCommit,
 		Patch:             patch,
-		ReproOpts:         crash.ReproOpts,
+		ReproOpts:         reproOpts,
 		ReproSyz:          reproSyz,
 		ReproC:            reproC,
+		BuildOnly:         job.Type == JobBisectCause && build.Type == BuildFailed,
+		BisectTestRepeats: job.TestRepeats,
 	}
 	switch job.Type {
 	case JobTestPatch:
@@ -581,6 +716,10 @@ func createJobResp(c context.Context, job *Job, jobKey *db.Key) (*dashapi.JobPol
 		resp.Type = dashapi.JobBisectCause
 	case JobBisectFix:
 		resp.Type = dashapi.JobBisectFix
+	case JobMinimize:
+		resp.Type = dashapi.JobMinimize
+	case JobMinimizeConfig:
+		resp.Type = dashapi.JobMinimizeConfig
 	default:
 		return nil, false, fmt.Errorf("bad job type %v", job.Type)
 	}
@@ -592,7 +731,7 @@ func createJobResp(c context.Context, job *Job, jobKey *db.Key) (*dashapi.JobPol
 // patch.
 func isRetestReproJob(job *Job, build *Build) bool {
 	return (job.Type == JobTestPatch || job.Type == JobBisectFix) &&
-		job.Patch == 0 &&
+		job.Patch == 0 && job.ReproID == 0 &&
 		job.KernelRepo == build.KernelRepo &&
 		job.KernelBranch == build.KernelBranch
 }
@@ -612,16 +751,22 @@ func handleRetestedRepro(c context.Context, now time.Time, job *Job, jobKey *db.
 	allTitles := gatherCrashTitles(req)
 	// Update the crash.
 	crash.LastReproRetest = now
-	if req.Error == nil && !crash.ReproIsRevoked {
+	if req.Error == nil {
 		// If repro testing itself failed, it might be just a temporary issue.
 		if job.Type == JobTestPatch {
 			// If there was any crash at all, the repro is still not worth discarding.
+			// That also brings back the repros that were revoked before.
 			crash.ReproIsRevoked = len(allTitles) == 0
-		} else if job.Type == JobBisectFix {
+			if !crash.ReproIsRevoked {
+				bug.LastReproSuccess = now
+			}
+			crash.addReproRuns(req.ReproAttempts, req.ReproSuccesses, now)
+		} else if job.Type == JobBisectFix && !crash.ReproIsRevoked {
 			// More than one commit is suspected => repro stopped working at some point.
 			crash.ReproIsRevoked = len(req.Commits) > 0
 		}
 	}
+	bug.updateReproRetest(job.CrashID, crash.ReproIsRevoked, now)
 	crash.UpdateReportingPriority(lastBuild, bug)
 	if _, err := db.Put(c, crashKey, crash); err != nil {
 		return fmt.Errorf("failed to put crash: %v", err)
@@ -646,6 +791,7 @@ func handleRetestedRepro(c context.Context, now time.Time, job *Job, jobKey *db.
 			bug.HeadReproLevel = ReproLevelSyz
 		}
 	}
+	bug.updateReproRevoked()
 	if stringInList(allTitles, bug.Title) || stringListsIntersect(bug.AltTitles, allTitles) {
 		// We don't want to confuse users, so only update LastTime if the generated crash
 		// really relates to the existing bug.
@@ -740,8 +886,10 @@ func doneJob(c context.Context, req *dashapi.JobDoneReq) error {
 			}
 		}
 		ns := job.Namespace
+		var build *Build
 		if req.Build.ID != "" {
-			if _, isNewBuild, err := uploadBuild(c, now, ns, &req.Build, BuildJob); err != nil {
+			var isNewBuild bool
+			if build, isNewBuild, err = uploadBuild(c, now, ns, &req.Build, BuildJob); err != nil {
 				return err
 			} else if !isNewBuild {
 				log.Errorf(c, "job %v: duplicate build %v", jobID, req.Build.ID)
@@ -778,18 +926,37 @@ func doneJob(c context.Context, req *dashapi.JobDoneReq) error {
 		job.IsRunning = false
 		job.Flags = JobFlags(req.Flags)
 		if job.Type == JobBisectCause || job.Type == JobBisectFix {
+			if err := setBisectConfidence(c, job, jobKey, req); err != nil {
+				return err
+			}
 			// Update bug.BisectCause/Fix status and also remember current bug reporting to send results.
 			if err := updateBugBisection(c, job, jobKey, req, now); err != nil {
 				return err
 			}
 		}
+		if job.Type == JobMinimize {
+			if err := updateBugMinimization(c, job, jobKey, req, build, now); err != nil {
+				return err
+			}
+		}
+		if job.Type == JobMinimizeConfig {
+			if err := updateBugConfigMinimization(c, job, jobKey, req, now); err != nil {
+				return err
+			}
+		}
 		if _, err := db.Put(c, jobKey, job); err != nil {
 			return fmt.Errorf("failed to put job: %v", err)
 		}
 		log.Infof(c, "DONE JOB %v: reported=%v reporting=%v", jobID, job.Reported, job.Reporting)
 		return nil
 	}
-	return db.RunInTransaction(c, tx, &db.TransactionOptions{XG: true, Attempts: 30})
+	err = db.RunInTransaction(c, countTxRetries("job_done", tx), &db.TransactionOptions{XG: true, Attempts: 30})
+	if err != nil {
+		return err
+	}
+	// Bisection and repro retesting results are displayed in the bug lists.
+	invalidateBugLists(c, job.Namespace)
+	return recordReproMigration(c, job, jobKey, req)
 }
 
 func updateBugBisection(c context.Context, job *Job, jobKey *db.Key, req *dashapi.JobDoneReq, now time.Time) error {
@@ -884,6 +1051,13 @@ func pollCompletedJobs(c context.Context, typ string) ([]*dashapi.BugReport, err
 				continue
 			}
 		}
+		if notApplied, err := autoTestNotApplied(c, job); err != nil {
+			return nil, fmt.Errorf("job %v: %w", extJobID(keys[i]), err)
+		} else if notApplied {
+			log.Infof(c, "job %v: the auto-tested patch did not apply", extJobID(keys[i]))
+			jobReported(c, extJobID(keys[i]))
+			continue
+		}
 		rep, err := createBugReportForJob(c, job, keys[i], reporting.Config)
 		if err != nil {
 			log.Errorf(c, "failed to create report for job: %v", err)
@@ -952,9 +1126,19 @@ func createBugReportForJob(c context.Context, job *Job, jobKey *db.Key, config i
 		Error:           jobError,
 		ErrorLink:       externalLink(c, textError, job.Error),
 		PatchLink:       externalLink(c, textPatch, job.Patch),
+		AutoTest:        job.AutoTest != "",
+		TestOnTimeout:   job.TestOnTimedOut,
+	}
+	if job.TestOn != "" {
+		rep.TestManager = job.Manager
+	}
+	if repro := bug.reproByID(job.ReproID); job.ReproID != 0 && repro != nil {
+		rep.ReproCLink = externalLink(c, textReproC, repro.ReproC)
+		rep.ReproSyzLink = externalLink(c, textReproSyz, repro.ReproSyz)
+		rep.ReproOpts = repro.ReproOpts
 	}
 	if job.Type == JobBisectCause || job.Type == JobBisectFix {
-		rep.Maintainers = append(crash.Maintainers, kernelRepo.CC.Maintainers...)
+		rep.Maintainers = append(crashMaintainers(c, bug, crash), kernelRepo.CC.Maintainers...)
 		rep.ExtID = bugReporting.ExtID
 		if bugReporting.CC != "" {
 			rep.CC = strings.Split(bugReporting.CC, "|")
@@ -991,6 +1175,8 @@ func bisectFromJob(c context.Context, job *Job) (*dashapi.BisectResult, []string
 		CrashLogLink:    externalLink(c, textCrashLog, job.CrashLog),
 		CrashReportLink: externalLink(c, textCrashReport, job.CrashReport),
 		Fix:             job.Type == JobBisectFix,
+		Confidence:      job.Confidence.String(),
+		ConfidenceNotes: job.ConfidenceNotes,
 	}
 	for _, com := range job.Commits {
 		bisect.Commits = append(bisect.Commits, &dashapi.Commit{
@@ -1036,9 +1222,19 @@ func jobReported(c context.Context, jobID string) error {
 			}
 			if bug.Status == BugStatusOpen && len(bug.Commits) == 0 {
 				bug.updateCommits([]string{job.Commits[0].Title}, now)
+				bug.recordEvent(BugEvent{
+					Type:    BugEventFixAttached,
+					Time:    now,
+					Actor:   BugActorSystem,
+					Cause:   eventCause(causeJob, jobID),
+					Details: fixCommitsDetails(bug.Commits),
+				})
 				if _, err := db.Put(c, bugKey, bug); err != nil {
 					return fmt.Errorf("failed to put bug: %v", err)
 				}
+				if err := saveBugEvents(c, bugKey, bug); err != nil {
+					return err
+				}
 			}
 		}
 		if _, err := db.Put(c, jobKey, job); err != nil {
@@ -1119,6 +1315,9 @@ func loadPendingJob(c context.Context, managers map[string]dashapi.ManagerJobs)
 	for i, job := range jobs {
 		switch job.Type {
 		case JobTestPatch:
+			if job.TestOn != "" {
+				job.Manager = pickTestOnManager(job, managers)
+			}
 			if !managers[job.Manager].TestPatches {
 				continue
 			}
@@ -1135,6 +1334,14 @@ func loadPendingJob(c context.Context, managers map[string]dashapi.ManagerJobs)
 				timeSince(c, job.LastStarted) < bisectRepeat {
 				continue
 			}
+		case JobMinimize:
+			if !managers[job.Manager].Minimize {
+				continue
+			}
+		case JobMinimizeConfig:
+			if !managers[job.Manager].MinimizeConfig {
+				continue
+			}
 		default:
 			return nil, nil, fmt.Errorf("bad job type %v", job.Type)
 		}
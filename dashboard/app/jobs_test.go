@@ -488,6 +488,84 @@ func TestReproRetestJob(t *testing.T) {
 	c.expectEQ(bug.StatusReason, dashapi.InvalidatedByRevokedRepro)
 }
 
+func TestReproRevokedBugFilter(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	oldBuild := testBuild(1)
+	c.client2.UploadBuild(oldBuild)
+	crash := testCrash(oldBuild, 1)
+	crash.ReproOpts = []byte("repro opts")
+	crash.ReproSyz = []byte("repro syz")
+	c.client2.ReportCrash(crash)
+	reportTime := c.mockedTime
+	sender := c.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	c.advanceTime(time.Minute)
+	build := testBuild(1)
+	build.ID = "new-build"
+	build.KernelRepo = "git://mygit.com/new-git.git"
+	build.KernelBranch = "new-main"
+	c.client2.UploadBuild(build)
+
+	// Wait until the bug is upstreamed.
+	c.advanceTime(15 * 24 * time.Hour)
+	c.pollEmailBug()
+	c.pollEmailBug()
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.ReproRevoked, false)
+	c.expectEQ(bug.LastReproSuccess, reportTime)
+
+	retest := func(works bool) {
+		c.advanceTime(config.Obsoleting.ReproRetestPeriod + time.Hour)
+		c.updRetestReproJobs()
+		resp := c.client2.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{TestPatches: true})
+		c.expectEQ(resp.Type, dashapi.JobTestPatch)
+		c.expectEQ(resp.KernelBranch, build.KernelBranch)
+		done := &dashapi.JobDoneReq{
+			ID: resp.ID,
+		}
+		if works {
+			done.CrashTitle = crash.Title
+			done.CrashLog = []byte("test crash log")
+			done.CrashReport = []byte("test crash report")
+		}
+		c.client2.expectOK(c.client2.JobDone(done))
+	}
+
+	// The only repro stops working.
+	retest(false)
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.HeadReproLevel, ReproLevelNone)
+	c.expectEQ(bug.ReproRevoked, true)
+	c.expectEQ(bug.LastReproSuccess, reportTime)
+
+	page, err := c.AuthGET(AccessAdmin, "/test2?repro_revoked=1")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(crash.Title)))
+	c.expectTrue(bytes.Contains(page, []byte("ReproRevoked=true")))
+	// The filter does not apply to the fixed bugs.
+	page, err = c.AuthGET(AccessAdmin, "/test2/fixed?repro_revoked=1")
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("ReproRevoked=true")))
+
+	// The revoked repro is still retested and it works again.
+	retest(true)
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.HeadReproLevel, ReproLevelSyz)
+	c.expectEQ(bug.ReproRevoked, false)
+	c.expectEQ(bug.LastReproSuccess, c.mockedTime)
+
+	page, err = c.AuthGET(AccessAdmin, "/test2?repro_revoked=1")
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte(crash.Title)))
+	page, err = c.AuthGET(AccessAdmin, "/test2")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(crash.Title)))
+}
+
 func TestDelegatedManagerReproRetest(t *testing.T) {
 	c := NewCtx(t)
 	defer c.Close()
@@ -1168,3 +1246,38 @@ func TestParallelJobs(t *testing.T) {
 	emptyPollResp = client.pollJobs(build.Manager)
 	c.expectEQ(emptyPollResp, &dashapi.JobPollResp{})
 }
+
+func TestJobCustomConfigWarning(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	build.KernelConfig = []byte("CONFIG_DEBUG_KERNEL=y\nCONFIG_KCOV=y\nCONFIG_KASAN=y\n")
+	client.UploadBuild(build)
+	client.ReportCrash(testCrashWithRepro(build, 1))
+	sender := c.pollEmailBug().Sender
+
+	var options strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&options, "CONFIG_OPTION_%v=y\n", i)
+	}
+	config := options.String() + "CONFIG_DEBUG_KERNEL=y\n# CONFIG_KASAN is not set\n"
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch\n"+sampleGitPatch,
+		EmailOptFrom("test@requester.com"), EmailOptAttachment(config))
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.To, []string{"test@requester.com"})
+	c.expectTrue(strings.Contains(msg.Body, "CONFIG_KCOV\nCONFIG_KASAN\n"))
+	c.expectTrue(strings.Contains(msg.Body, "The bug was found on a different tree (repo1 branch1)"))
+
+	// The job is still scheduled, with the custom config.
+	resp := client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{TestPatches: true})
+	c.expectEQ(resp.Type, dashapi.JobTestPatch)
+	c.expectEQ(resp.KernelConfig, []byte(config))
+
+	// No warning for complete configs.
+	config = options.String() + "CONFIG_DEBUG_KERNEL=y\nCONFIG_KCOV=y\nCONFIG_KASAN=y\n"
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch\n"+sampleGitPatch,
+		EmailOptMessageID(2), EmailOptAttachment(config))
+	c.expectNoEmail()
+}
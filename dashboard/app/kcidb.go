@@ -16,7 +16,7 @@ import (
 )
 
 func initKcidb() {
-	http.HandleFunc("/cron/kcidb_poll", handleKcidbPoll)
+	http.HandleFunc("/cron/kcidb_poll", handleCron(handleKcidbPoll))
 }
 
 func handleKcidbPoll(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,134 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	"github.com/google/syzkaller/pkg/email/lore"
+	"github.com/google/syzkaller/pkg/hash"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+// Instead of an inline patch, "#syz test" may reference a patch series on lore:
+//   #syz test https://lore.kernel.org/r/<msgid> [repo branch]
+// The whole thread is fetched from lore and the series the message belongs to is reconstructed
+// using the x/y numbering of the subjects. The patches are then tested as a single patch
+// on top of the specified tree or the tree the bug was found on.
+
+const (
+	maxLoreThreadSize         = 32 << 20
+	maxLoreSeriesPatches      = 50
+	maxLoreSeriesSize         = 4 << 20
+	loreSeriesCacheExpiration = time.Hour
+)
+
+type loreSeriesPatch struct {
+	Patch   string
+	Patches int
+}
+
+// loadLoreSeries returns the combined patch of the series referenced by the link.
+// The returned errors are meant to be shown to the user.
+func loadLoreSeries(c context.Context, link string) (*loreSeriesPatch, error) {
+	msgID, err := lore.MessageIDFromLink(link)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := "lore-series-" + hash.String([]byte(msgID))
+	ret := new(loreSeriesPatch)
+	if _, err := memcache.Gob.Get(c, cacheKey, ret); err == nil {
+		return ret, nil
+	} else if err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to get cached lore series: %v", err)
+	}
+	raw, err := fetchLoreThread(c, msgID)
+	if err != nil {
+		log.Warningf(c, "failed to fetch %v from lore: %v", msgID, err)
+		return nil, fmt.Errorf("failed to fetch the thread from lore, it may not have been archived yet")
+	}
+	var msgs []*email.Email
+	for _, data := range lore.SplitMbox(raw) {
+		msg, err := email.Parse(bytes.NewReader(data), ownEmails(c), ownMailingLists(), []string{appURL(c)})
+		if err != nil {
+			log.Warningf(c, "failed to parse a message of %v: %v", msgID, err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	series, err := lore.PatchSeries(msgs, msgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(series.Missing) != 0 {
+		return nil, fmt.Errorf("the series is incomplete, patches %v of %v were not found in the thread",
+			joinInts(series.Missing), series.Total)
+	}
+	if len(series.Patches) > maxLoreSeriesPatches {
+		return nil, fmt.Errorf("the series is too long (%v patches), at most %v patches can be tested",
+			len(series.Patches), maxLoreSeriesPatches)
+	}
+	ret.Patch = series.Diff()
+	ret.Patches = len(series.Patches)
+	if len(ret.Patch) > maxLoreSeriesSize {
+		return nil, fmt.Errorf("the series is too big (%v bytes), at most %v bytes can be tested",
+			len(ret.Patch), maxLoreSeriesSize)
+	}
+	item := &memcache.Item{
+		Key:        cacheKey,
+		Object:     ret,
+		Expiration: loreSeriesCacheExpiration,
+	}
+	if err := memcache.Gob.Set(c, item); err != nil {
+		log.Errorf(c, "failed to cache lore series: %v", err)
+	}
+	return ret, nil
+}
+
+func joinInts(nums []int) string {
+	var strs []string
+	for _, num := range nums {
+		strs = append(strs, fmt.Sprint(num))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// fetchLoreThread returns the mbox of the whole thread the message belongs to.
+var fetchLoreThread = func(c context.Context, msgID string) ([]byte, error) {
+	addr := fmt.Sprintf("https://lore.kernel.org/all/%s/t.mbox.gz", url.PathEscape(strings.Trim(msgID, "<>")))
+	req, err := http.NewRequestWithContext(c, "GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", addr, resp.Status)
+	}
+	reader, err := gzip.NewReader(io.LimitReader(resp.Body, maxLoreThreadSize))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, maxLoreThreadSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == maxLoreThreadSize {
+		return nil, fmt.Errorf("the thread is too big")
+	}
+	return data, nil
+}
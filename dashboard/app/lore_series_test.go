@@ -0,0 +1,70 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestLoreSeriesTest(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrashWithRepro(build, 1))
+	sender := c.pollEmailBug().Sender
+
+	addMessage := func(id, subject, body string) {
+		c.loreMessages[id] = fmt.Sprintf("Message-ID: %v\nSubject: %v\nFrom: developer@kernel.org\n"+
+			"Content-Type: text/plain\n\n%v", id, subject, body)
+	}
+	addMessage("<series-0@test.com>", "[PATCH 0/2] foo: fix the crash", "The cover letter.\n")
+	addMessage("<series-2@test.com>", "[PATCH 2/2] foo: second", "The second patch.\n"+autoTestPatch2)
+	addMessage("<series-1@test.com>", "[PATCH 1/2] foo: first", "The first patch.\n"+sampleGitPatch)
+	addMessage("<series-re@test.com>", "Re: [PATCH 1/2] foo: first", "> quoted\n")
+	addMessage("<partial-1@test.com>", "[PATCH v2 1/2] foo: first", "The first patch.\n"+sampleGitPatch)
+
+	// The series is tested on the tree the bug was found on by default.
+	c.incomingEmail(sender, "#syz test https://lore.kernel.org/r/series-0@test.com\n",
+		EmailOptMessageID(1), EmailOptFrom("test@requester.com"))
+	c.expectNoEmail()
+	resp := client.pollJobs(build.Manager)
+	c.expectEQ(resp.Type, dashapi.JobTestPatch)
+	c.expectEQ(resp.KernelRepo, build.KernelRepo)
+	c.expectEQ(resp.KernelBranch, build.KernelBranch)
+	first := bytes.Index(resp.Patch, []byte(sampleGitPatch))
+	second := bytes.Index(resp.Patch, []byte(autoTestPatch2))
+	c.expectTrue(first != -1 && second > first)
+	c.expectTrue(!bytes.Contains(resp.Patch, []byte("quoted")))
+
+	c.incomingEmail(sender, "#syz test https://lore.kernel.org/all/series-2@test.com/"+
+		" git://git.git/git.git kernel-branch\n", EmailOptMessageID(2), EmailOptFrom("test@requester.com"))
+	c.expectNoEmail()
+	resp = client.pollJobs(build.Manager)
+	c.expectEQ(resp.KernelRepo, "git://git.git/git.git")
+	c.expectEQ(resp.KernelBranch, "kernel-branch")
+	c.expectTrue(bytes.Contains(resp.Patch, []byte(autoTestPatch2)))
+
+	for _, test := range []struct {
+		args  string
+		reply string
+	}{
+		{"https://lore.kernel.org/r/partial-1@test.com", "patches 2 of 2 were not found"},
+		{"https://lore.kernel.org/r/unknown@test.com", "failed to fetch the thread from lore"},
+		{"https://lore.kernel.org/r/series-re@test.com", "does not contain a patch"},
+		{"https://lore.kernel.org/r/series-1@test.com git://git.git/git.git", "want a lore link"},
+	} {
+		c.incomingEmail(sender, "#syz test "+test.args+"\n", EmailOptFrom("test@requester.com"))
+		body := c.pollEmailBug().Body
+		c.expectTrue(strings.Contains(body, test.reply))
+	}
+	c.expectEQ(client.pollJobs(build.Manager).ID, "")
+}
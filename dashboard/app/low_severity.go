@@ -0,0 +1,235 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	aemail "google.golang.org/appengine/v2/mail"
+)
+
+// Some crash classes (e.g. "INFO: task hung" without a reproducer, lockdep warnings) produce many
+// reports that are individually of little value. For namespaces with LowSeverityConfig, new bugs
+// without reproducers that match one of the rules get ReportingModeDigest: they are not reported
+// individually, instead handleLowSeverityDigests lists all such open bugs in a weekly digest email
+// per subsystem. Once such a bug gets a reproducer or an external discussion, it's promoted
+// to ReportingModePromoted and goes through the normal reporting.
+
+// lowSeverityNoSubsystem is the digest group of the bugs without subsystems.
+const lowSeverityNoSubsystem = "no subsystem"
+
+// LowSeverityDigest is the state of the low-severity digests of a subsystem,
+// the key is "namespace|subsystem".
+type LowSeverityDigest struct {
+	Namespace string
+	Subsystem string
+	LastSent  time.Time
+	Bugs      int `datastore:",noindex"` // the number of bugs in the last digest
+}
+
+func lowSeverityDigestKey(c context.Context, ns, subsystem string) *db.Key {
+	return db.NewKey(c, "LowSeverityDigest", ns+"|"+subsystem, 0, nil)
+}
+
+// classifyLowSeverity puts the new bug into the digest-only mode if it matches one of the rules.
+func (bug *Bug) classifyLowSeverity(cfg *LowSeverityConfig, hasRepro bool) {
+	if cfg == nil || hasRepro {
+		return
+	}
+	for _, rule := range cfg.Rules {
+		if rule.titleRe.MatchString(bug.Title) {
+			bug.ReportingMode = ReportingModeDigest
+			bug.LowSeverityRule = rule.Name
+			return
+		}
+	}
+}
+
+// promoteFromDigest switches the digest-only bug to the individual reporting.
+func (bug *Bug) promoteFromDigest(now time.Time, reason string) {
+	if bug.ReportingMode != ReportingModeDigest {
+		return
+	}
+	bug.ReportingMode = ReportingModePromoted
+	bug.Promoted = now
+	bug.PromotedReason = reason
+}
+
+// lowSeverityStatus returns why the bug is not reported individually, if it's not.
+func lowSeverityStatus(bug *Bug) string {
+	if bug.ReportingMode != ReportingModeDigest {
+		return ""
+	}
+	return fmt.Sprintf("only listed in the low-severity digests (%v)", bug.LowSeverityRule)
+}
+
+func handleLowSeverityDigests(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for ns, cfg := range config.Namespaces {
+		if cfg.LowSeverity == nil || cfg.Decommissioned {
+			continue
+		}
+		if err := sendLowSeverityDigests(c, ns, cfg); err != nil {
+			log.Errorf(c, "%v: failed to send low-severity digests: %v", ns, err)
+		}
+	}
+}
+
+// lowSeverityGroup is the digest of a single subsystem.
+type lowSeverityGroup struct {
+	subsystem string
+	bugs      []*Bug
+	promoted  []*Bug
+}
+
+func sendLowSeverityDigests(c context.Context, ns string, cfg *Config) error {
+	digestBugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("ReportingMode=", ReportingModeDigest)
+	})
+	if err != nil {
+		return err
+	}
+	promotedBugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("ReportingMode=", ReportingModePromoted)
+	})
+	if err != nil {
+		return err
+	}
+	now := timeNow(c)
+	groups := map[string]*lowSeverityGroup{}
+	group := func(bug *Bug) []*lowSeverityGroup {
+		names := []string{lowSeverityNoSubsystem}
+		if len(bug.Tags.Subsystems) != 0 {
+			names = nil
+			for _, item := range bug.Tags.Subsystems {
+				names = append(names, item.Name)
+			}
+		}
+		var ret []*lowSeverityGroup
+		for _, name := range names {
+			if groups[name] == nil {
+				groups[name] = &lowSeverityGroup{subsystem: name}
+			}
+			ret = append(ret, groups[name])
+		}
+		return ret
+	}
+	for _, bug := range digestBugs {
+		if bug.Status != BugStatusOpen {
+			continue
+		}
+		for _, g := range group(bug) {
+			g.bugs = append(g.bugs, bug)
+		}
+	}
+	for _, bug := range promotedBugs {
+		if now.Sub(bug.Promoted) > digestPeriod {
+			continue
+		}
+		for _, g := range group(bug) {
+			g.promoted = append(g.promoted, bug)
+		}
+	}
+	var names []string
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := sendLowSeverityDigest(c, ns, cfg, groups[name], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendLowSeverityDigest sends the digest of the subsystem unless it was already sent this week.
+func sendLowSeverityDigest(c context.Context, ns string, cfg *Config, group *lowSeverityGroup,
+	now time.Time) error {
+	key := lowSeverityDigestKey(c, ns, group.subsystem)
+	digest := &LowSeverityDigest{
+		Namespace: ns,
+		Subsystem: group.subsystem,
+	}
+	if err := db.Get(c, key, digest); err != nil && err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to get the digest state: %w", err)
+	}
+	if len(group.bugs) == 0 || now.Sub(digest.LastSent) < digestMinInterval {
+		return nil
+	}
+	msg := lowSeverityDigestEmail(c, ns, cfg, group, digest.LastSent)
+	if len(msg.To) == 0 {
+		log.Errorf(c, "%v: no recipients for the low-severity digest of %v", ns, group.subsystem)
+	} else if err := sendEmail(c, msg); err != nil {
+		return err
+	}
+	digest.LastSent = now
+	digest.Bugs = len(group.bugs)
+	if _, err := db.Put(c, key, digest); err != nil {
+		return fmt.Errorf("failed to save the digest state: %w", err)
+	}
+	return nil
+}
+
+func lowSeverityDigestEmail(c context.Context, ns string, cfg *Config, group *lowSeverityGroup,
+	lastSent time.Time) *aemail.Message {
+	var to []string
+	if emailCfg, ok := cfg.Reporting[0].Config.(*EmailConfig); ok {
+		to = append(to, emailCfg.Email)
+	}
+	to = append(to, cfg.LowSeverity.Mailto...)
+	if cfg.LowSeverity.SubsystemLists {
+		if service := getSubsystemService(c, ns); service != nil {
+			if item := service.ByName(group.subsystem); item != nil {
+				to = append(to, item.Lists...)
+			}
+		}
+	}
+	sort.Slice(group.bugs, func(i, j int) bool {
+		if group.bugs[i].NumCrashes != group.bugs[j].NumCrashes {
+			return group.bugs[i].NumCrashes > group.bugs[j].NumCrashes
+		}
+		return group.bugs[i].Title < group.bugs[j].Title
+	})
+	body := new(strings.Builder)
+	fmt.Fprintf(body, "The following %v open %v bugs in %v are low-severity, so they are not reported\n"+
+		"individually. A bug is reported as usual once it gets a reproducer or a discussion.\n"+
+		"Bugs marked with [new] have appeared since the previous digest.\n\n",
+		len(group.bugs), ns, group.subsystem)
+	for _, bug := range group.bugs {
+		mark := ""
+		if bug.FirstTime.After(lastSent) {
+			mark = "[new] "
+		}
+		fmt.Fprintf(body, "%v%v (%v crashes, since %v)\n%v%v\n\n", mark, bug.displayTitle(),
+			bug.NumCrashes, bug.FirstTime.Format("2006/01/02"), appURL(c), bugLink(bug.keyHash()))
+	}
+	if len(group.promoted) != 0 {
+		fmt.Fprintf(body, "The following bugs were promoted to individual reports during the last week:\n\n")
+		for _, bug := range group.promoted {
+			fmt.Fprintf(body, "%v (got a %v)\n%v%v\n\n", bug.displayTitle(), bug.PromotedReason,
+				appURL(c), bugLink(bug.keyHash()))
+		}
+	}
+	fmt.Fprintf(body, "---\nThis digest is generated by a bot. It may contain errors.\n"+
+		"See https://goo.gl/tpsmEJ for more information about syzbot.\n"+
+		"syzbot engineers can be reached at syzkaller@googlegroups.com.\n")
+	return &aemail.Message{
+		Sender: fromAddr(c),
+		To:     to,
+		Subject: fmt.Sprintf("[syzbot] weekly %v low-severity digest: %v (%v bugs)",
+			ns, group.subsystem, len(group.bugs)),
+		Body: body.String(),
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/stretchr/testify/assert"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestLowSeverityModeTransitions(t *testing.T) {
+	cfg := &LowSeverityConfig{
+		Rules: []LowSeverityRule{
+			{Name: "task-hung", Title: "^INFO: task hung"},
+			{Name: "lockdep", Title: "^possible deadlock in|^WARNING: possible circular locking"},
+		},
+		Mailto: []string{"low-severity@syzkaller.com"},
+	}
+	checkLowSeverity("test", cfg)
+	now := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	bug := &Bug{Title: "INFO: task hung in foo"}
+	bug.classifyLowSeverity(cfg, false)
+	assert.Equal(t, ReportingModeDigest, bug.ReportingMode)
+	assert.Equal(t, "task-hung", bug.LowSeverityRule)
+	assert.Equal(t, "only listed in the low-severity digests (task-hung)", lowSeverityStatus(bug))
+	bug.promoteFromDigest(now, "reproducer")
+	assert.Equal(t, ReportingModePromoted, bug.ReportingMode)
+	assert.Equal(t, now, bug.Promoted)
+	assert.Equal(t, "", lowSeverityStatus(bug))
+	// Promoted bugs stay promoted.
+	bug.promoteFromDigest(now.Add(time.Hour), "discussion")
+	assert.Equal(t, now, bug.Promoted)
+	assert.Equal(t, "reproducer", bug.PromotedReason)
+
+	bug = &Bug{Title: "WARNING: possible circular locking dependency detected"}
+	bug.classifyLowSeverity(cfg, false)
+	assert.Equal(t, "lockdep", bug.LowSeverityRule)
+	bug.mergeDiscussionSummary(string(dashapi.DiscussionLore), DiscussionSummary{
+		AllMessages: 1,
+		LastMessage: now,
+	})
+	assert.Equal(t, ReportingModeDigest, bug.ReportingMode)
+	bug.mergeDiscussionSummary(string(dashapi.DiscussionLore), DiscussionSummary{
+		AllMessages:      1,
+		ExternalMessages: 1,
+		LastMessage:      now,
+	})
+	assert.Equal(t, ReportingModePromoted, bug.ReportingMode)
+	assert.Equal(t, "discussion", bug.PromotedReason)
+
+	// Bugs that already have a reproducer and other crashes are reported as usual.
+	bug = &Bug{Title: "INFO: task hung in bar"}
+	bug.classifyLowSeverity(cfg, true)
+	assert.Equal(t, ReportingModeNormal, bug.ReportingMode)
+	bug = &Bug{Title: "KASAN: use-after-free in baz"}
+	bug.classifyLowSeverity(cfg, false)
+	assert.Equal(t, ReportingModeNormal, bug.ReportingMode)
+	bug.classifyLowSeverity(nil, false)
+	assert.Equal(t, ReportingModeNormal, bug.ReportingMode)
+}
+
+func TestLowSeverityDigests(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.makeClient(clientSubsystemRemind, keySubsystemRemind, true)
+	build := testBuild(1)
+	client.UploadBuild(build)
+	crash := func(title, file string) *dashapi.Crash {
+		crash := testCrash(build, 1)
+		crash.Title = title
+		crash.GuiltyFiles = []string{file}
+		return crash
+	}
+	loadBug := func(title string) *Bug {
+		var bugs []*Bug
+		_, err := db.NewQuery("Bug").Filter("Title=", title).GetAll(c.ctx, &bugs)
+		c.expectOK(err)
+		c.expectEQ(len(bugs), 1)
+		return bugs[0]
+	}
+
+	// Low-severity bugs without reproducers are not reported individually.
+	client.ReportCrash(crash("INFO: task hung in a_first", "a.c"))
+	client.ReportCrash(crash("INFO: task hung in a_second", "a.c"))
+	client.ReportCrash(crash("INFO: task hung in a_second", "a.c"))
+	client.ReportCrash(crash("INFO: task hung in b_first", "b.c"))
+	c.expectNoEmail()
+	bugA1 := loadBug("INFO: task hung in a_first")
+	c.expectEQ(bugA1.ReportingMode, ReportingModeDigest)
+	page, err := c.GET("/bug?id=" + bugA1.keyHash())
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "only listed in the low-severity digests (task-hung)"))
+
+	// Other bugs and low-severity bugs that already have reproducers are reported as usual.
+	client.ReportCrash(crash("WARNING in a_regular", "a.c"))
+	client.pollEmailBug()
+	withRepro := testCrashWithRepro(build, 1)
+	withRepro.Title = "INFO: task hung in a_repro"
+	client.ReportCrash(withRepro)
+	client.pollEmailBug()
+	c.expectEQ(loadBug(withRepro.Title).ReportingMode, ReportingModeNormal)
+
+	// One digest per subsystem.
+	_, err = c.GET("/cron/low_severity_digests")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 2)
+	msgA, msgB := <-c.emailSink, <-c.emailSink
+	c.expectEQ(msgA.To, []string{"low-severity@syzkaller.com", "subsystemA@list.com"})
+	c.expectEQ(msgA.Subject, "[syzbot] weekly subsystem-reminders low-severity digest: subsystemA (2 bugs)")
+	c.expectTrue(strings.Contains(msgA.Body, `[new] INFO: task hung in a_second (2 crashes, since`))
+	c.expectTrue(strings.Contains(msgA.Body, bugLink(bugA1.keyHash())))
+	c.expectTrue(!strings.Contains(msgA.Body, "a_repro"))
+	c.expectTrue(!strings.Contains(msgA.Body, "a_regular"))
+	c.expectEQ(msgB.To, []string{"low-severity@syzkaller.com", "subsystemB@list.com"})
+	c.expectTrue(strings.Contains(msgB.Body, "INFO: task hung in b_first"))
+
+	// The digests are weekly.
+	c.advanceTime(24 * time.Hour)
+	_, err = c.GET("/cron/low_severity_digests")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 0)
+
+	// A reproducer promotes the bug to the individual reporting.
+	reproA1 := testCrashWithRepro(build, 1)
+	reproA1.Title = bugA1.Title
+	reproA1.GuiltyFiles = []string{"a.c"}
+	client.ReportCrash(reproA1)
+	msg := client.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Subject, bugA1.Title))
+	bugA1 = loadBug(bugA1.Title)
+	c.expectEQ(bugA1.ReportingMode, ReportingModePromoted)
+	c.expectEQ(bugA1.PromotedReason, "reproducer")
+
+	// So does an external discussion.
+	bugB1 := loadBug("INFO: task hung in b_first")
+	c.expectOK(client.SaveDiscussion(&dashapi.SaveDiscussionReq{
+		Discussion: &dashapi.Discussion{
+			ID:      "<b_first@discussion>",
+			Source:  dashapi.DiscussionLore,
+			Type:    dashapi.DiscussionReport,
+			Subject: "Re: INFO: task hung in b_first",
+			BugIDs:  []string{bugB1.Reporting[len(bugB1.Reporting)-1].ID},
+			Messages: []dashapi.DiscussionMessage{{
+				ID:       "<b_first@discussion>",
+				External: true,
+				Time:     timeNow(c.ctx),
+			}},
+		},
+	}))
+	msg = client.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Subject, bugB1.Title))
+	c.expectEQ(loadBug(bugB1.Title).PromotedReason, "discussion")
+
+	// The next digest lists the remaining bug and the promoted one.
+	c.advanceTime(7 * 24 * time.Hour)
+	_, err = c.GET("/cron/low_severity_digests")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 1)
+	msgA = <-c.emailSink
+	c.expectEQ(msgA.Subject, "[syzbot] weekly subsystem-reminders low-severity digest: subsystemA (1 bugs)")
+	c.expectTrue(strings.Contains(msgA.Body, "INFO: task hung in a_second (2 crashes"))
+	c.expectTrue(!strings.Contains(msgA.Body, "[new]"))
+	c.expectTrue(strings.Contains(msgA.Body, "promoted to individual reports"))
+	c.expectTrue(strings.Contains(msgA.Body, "INFO: task hung in a_first (got a reproducer)"))
+}
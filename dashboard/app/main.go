@@ -42,6 +42,33 @@ func initHTTPHandlers() {
 	http.Handle("/bug", handlerWrapper(handleBug))
 	http.Handle("/text", handlerWrapper(handleText))
 	http.Handle("/admin", handlerWrapper(handleAdmin))
+	http.Handle("/admin/discussion_export", handlerWrapper(handleDiscussionExport))
+	http.Handle("/admin/subsystems_dry_run", handlerWrapper(handleSubsystemsDryRun))
+	http.Handle("/admin/storage", handlerWrapper(handleAdminStorage))
+	http.Handle("/triage_inbox", handlerWrapper(handleTriageInbox))
+	http.Handle("/top_crashers", handlerWrapper(handleTopCrashers))
+	http.Handle("/feed", handlerWrapper(handleFeed))
+	http.Handle("/cve/", handlerWrapper(handleCVE))
+	http.Handle("/missing_backports", handlerWrapper(handleMissingBackports))
+	http.Handle("/fixed_between", handlerWrapper(handleFixedBetween))
+	http.Handle("/crash_diff", handlerWrapper(handleCrashDiff))
+	http.Handle("/crash_env", handlerWrapper(handleCrashEnv))
+	http.Handle("/jobs", handlerWrapper(handleWriteActions(handleJobQueue)))
+	http.Handle("/invalidations", handlerWrapper(handleWriteActions(handleInvalidations)))
+	http.Handle("/bulk_update", handlerWrapper(handleWriteAction(handleBulkUpdate)))
+	http.Handle("/minimize", handlerWrapper(handleWriteAction(handleMinimize)))
+	http.Handle("/minimize_config", handlerWrapper(handleWriteAction(handleMinimizeConfig)))
+	http.Handle("/focus", handlerWrapper(handleWriteAction(handleFocus)))
+	http.Handle("/watch", handlerWrapper(handleWriteAction(handleCommitWatch)))
+	http.Handle("/repros", handlerWrapper(handleWriteAction(handleBugRepros)))
+	http.Handle("/digests/subscribe", handlerWrapper(handleWriteAction(handleDigestSubscribe)))
+	http.Handle("/digests/confirm", handlerWrapper(handleWriteAction(handleDigestConfirm)))
+	http.Handle("/digests/unsubscribe", handlerWrapper(handleWriteAction(handleDigestUnsubscribe)))
+	// The shared pages are protected by the share link token instead of the access level.
+	http.Handle("/shared/bug", handleContext(handleRateLimit(handleShareToken(handleSharedBug))))
+	http.Handle("/shared/text", handleContext(handleRateLimit(handleShareToken(handleSharedText))))
+	http.Handle("/metrics", handleContext(handleMetrics))
+	http.HandleFunc("/tasks/replay_api", handleReplayAPI)
 	http.Handle("/x/.config", handlerWrapper(handleTextX(textKernelConfig)))
 	http.Handle("/x/log.txt", handlerWrapper(handleTextX(textCrashLog)))
 	http.Handle("/x/report.txt", handlerWrapper(handleTextX(textCrashReport)))
@@ -59,16 +86,39 @@ func initHTTPHandlers() {
 		http.Handle("/"+ns+"/graph/lifetimes", handlerWrapper(handleGraphLifetimes))
 		http.Handle("/"+ns+"/graph/fuzzing", handlerWrapper(handleGraphFuzzing))
 		http.Handle("/"+ns+"/graph/crashes", handlerWrapper(handleGraphCrashes))
+		http.Handle("/"+ns+"/fix_times", handlerWrapper(handleFixTimes))
 		http.Handle("/"+ns+"/repos", handlerWrapper(handleRepos))
+		http.Handle("/"+ns+"/build_failures", handlerWrapper(handleBuildFailures))
+		http.Handle("/"+ns+"/moderation", handlerWrapper(handleModerationQueue))
+		http.Handle("/"+ns+"/views", handlerWrapper(handleWriteActions(handleSavedViews, "apply")))
 		http.Handle("/"+ns+"/bug-stats", handlerWrapper(handleBugStats))
 		http.Handle("/"+ns+"/subsystems", handlerWrapper(handleSubsystemsList))
 		http.Handle("/"+ns+"/s/", handlerWrapper(handleSubsystemPage))
+		http.Handle("/"+ns+"/search", handlerWrapper(handleSearch))
 	}
+	// The cache only lives in memcache, so it's updated in the read-only mode as well.
 	http.HandleFunc("/cron/cache_update", cacheUpdate)
-	http.HandleFunc("/cron/deprecate_assets", handleDeprecateAssets)
-	http.HandleFunc("/cron/retest_repros", handleRetestRepros)
-	http.HandleFunc("/cron/refresh_subsystems", handleRefreshSubsystems)
-	http.HandleFunc("/cron/subsystem_reports", handleSubsystemReports)
+	http.HandleFunc("/cron/deprecate_assets", handleCron(handleDeprecateAssets))
+	http.HandleFunc("/cron/retest_repros", handleCron(handleRetestRepros))
+	http.HandleFunc("/cron/refresh_subsystems", handleCron(handleRefreshSubsystems))
+	http.HandleFunc("/cron/subsystem_reports", handleCron(handleSubsystemReports))
+	http.HandleFunc("/cron/check_discussions", handleCron(handleCheckDiscussions))
+	http.HandleFunc("/cron/export_discussions", handleCron(handleExportDiscussions))
+	http.HandleFunc("/cron/bootstrap_namespaces", handleCron(handleBootstrapNamespaces))
+	http.HandleFunc("/cron/delete_namespaces", handleCron(handleNamespaceDeletions))
+	http.HandleFunc("/cron/fold_summary_deltas", handleCron(handleFoldSummaryDeltas))
+	http.HandleFunc("/cron/crash_rate_alerts", handleCron(handleCrashRateAlerts))
+	http.HandleFunc("/cron/weekly_digests", handleCron(handleWeeklyDigests))
+	http.HandleFunc("/cron/low_severity_digests", handleCron(handleLowSeverityDigests))
+	http.HandleFunc("/cron/top_crashers", handleCron(handleTopCrashersSnapshots))
+	http.HandleFunc("/cron/fix_time_stats", handleCron(handleFixTimeStats))
+	http.HandleFunc("/cron/moderation_escalations", handleCron(handleModerationEscalations))
+	http.HandleFunc("/cron/focus_summaries", handleCron(handleFocusSummaries))
+	http.HandleFunc("/cron/fix_hysteresis", handleCron(handleFixHysteresis))
+	http.HandleFunc("/cron/test_on_timeouts", handleCron(handleTestOnTimeouts))
+	http.HandleFunc("/cron/reporting_breaker", handleCron(handleReportingBreaker))
+	http.HandleFunc("/cron/report_experiments", handleCron(handleReportExperiments))
+	http.HandleFunc("/cron/bug_listings", handleCron(handleBugListings))
 }
 
 type uiMainPage struct {
@@ -78,11 +128,13 @@ type uiMainPage struct {
 	Managers       *uiManagerList
 	BugFilter      *uiBugFilter
 	Groups         []*uiBugGroup
+	SavedViews     *uiSavedViews
 }
 
 type uiBugFilter struct {
-	Filter  *userBugFilter
-	DropURL func(string) string
+	Filter       *userBugFilter
+	DropURL      func(string) string
+	NoTaintedURL string
 }
 
 func makeUIBugFilter(c context.Context, filter *userBugFilter) *uiBugFilter {
@@ -92,18 +144,21 @@ func makeUIBugFilter(c context.Context, filter *userBugFilter) *uiBugFilter {
 		DropURL: func(name string) string {
 			return html.AmendURL(url, name, "")
 		},
+		NoTaintedURL: html.AmendURL(url, "no_tainted", "1"),
 	}
 }
 
 type uiManagerList struct {
-	RepoLink string
-	List     []*uiManager
+	RepoLink          string
+	BuildFailuresLink string
+	List              []*uiManager
 }
 
 func makeManagerList(managers []*uiManager, ns string) *uiManagerList {
 	return &uiManagerList{
-		RepoLink: fmt.Sprintf("/%s/repos", ns),
-		List:     managers,
+		RepoLink:          fmt.Sprintf("/%s/repos", ns),
+		BuildFailuresLink: fmt.Sprintf("/%s/build_failures", ns),
+		List:              managers,
 	}
 }
 
@@ -162,6 +217,8 @@ type uiSubsystemsPage struct {
 	Unclassified *uiSubsystem
 	SomeHidden   bool
 	ShowAllURL   string
+	// Set if maintainers may subscribe to weekly digests of the namespace bugs.
+	Digests bool
 }
 
 type uiSubsystem struct {
@@ -178,13 +235,26 @@ type uiSubsystemStats struct {
 }
 
 type uiAdminPage struct {
-	Header        *uiHeader
-	Log           []byte
-	Managers      *uiManagerList
-	RecentJobs    *uiJobList
-	PendingJobs   *uiJobList
-	RunningJobs   *uiJobList
-	MemcacheStats *memcache.Statistics
+	Header         *uiHeader
+	Log            []byte
+	Managers       *uiManagerList
+	RecentJobs     *uiJobList
+	PendingJobs    *uiJobList
+	RunningJobs    *uiJobList
+	MemcacheStats  *memcache.Statistics
+	Quotas         []*DiscussionQuota
+	Mismatches     []*DiscussionMismatch
+	Export         *uiDiscussionExport
+	Merges         []*uiDiscussionMerge
+	FixConflicts   []*uiFixConflictBug
+	Bootstraps     []*uiNamespaceBootstrap
+	Deletions      []*uiNamespaceDeletion
+	Quarantined    []*uiQuarantinedSender
+	NamespaceRoles []*uiNamespaceRole
+	CorpusImports  []*CorpusImport
+	Pauses         []*uiReportingPause
+	DataRaceDups   []*uiDataRaceDup
+	Experiments    []*ReportExperimentStats
 }
 
 type uiManager struct {
@@ -229,11 +299,36 @@ type uiCommit struct {
 }
 
 type uiBugDiscussion struct {
-	Subject  string
+	Subject    string
+	Link       string
+	TargetTree string
+	// Reason and ReasonInfo explain why the discussion is attached to the bug.
+	Reason     string
+	ReasonInfo string
+	Total      int
+	External   int
+	Last       time.Time
+}
+
+// uiDiscussionList is one page of bug discussions.
+// Filters and navigation are only displayed if the bug has more than one page of discussions.
+type uiDiscussionList struct {
+	Discussions []*uiBugDiscussion
+	Paginated   bool
+	Filters     []*uiDiscussionFilter
+	FirstLink   string
+	NextLink    string
+}
+
+type uiDiscussionFilter struct {
+	Name    string
+	Options []*uiDiscussionFilterOption
+}
+
+type uiDiscussionFilterOption struct {
+	Name     string
 	Link     string
-	Total    int
-	External int
-	Last     time.Time
+	Selected bool
 }
 
 type uiBugPage struct {
@@ -247,6 +342,39 @@ type uiBugPage struct {
 	Crashes       *uiCrashTable
 	TestPatchJobs *uiJobList
 	Subsystems    []*uiBugSubsystem
+	Upstream      *dashapi.UpstreamDiscussion
+	EmailReply    *uiEmailReply
+	GuiltyFile    *uiGuiltyFile
+	CommitWatch   *uiCommitWatch
+	Repro         *uiReproState
+	// E.g. "+3,812 similar crashes suppressed".
+	SuppressedCrashes string
+	AlsoSeenIn        []*uiSimilarBug
+	DupCandidates     []*uiSimilarBug
+	FixedTogether     []*uiSimilarBug
+	UpstreamFix       *uiUpstreamFix
+	CrashMatrix       *uiCrashMatrix
+	Observations      []*uiExternalObservation
+	FixConflicts      []*uiFixConflict
+	ShareLinks        *uiShareLinks
+	SyzkallerRange    *uiSyzkallerRange
+	Rename            *uiBugRename
+	FrameAliases      []string
+	PurgedCrashes     string
+	FixState          string
+	// The stacks of the sample KCSAN/KMSAN report.
+	SanitizerStacks *uiSanitizerStacks
+	CVEs            *uiBugCVEs
+	// Set for admins if the discussions dispute the bug.
+	ClearDisputeLink string
+	// Timeline is the history of the bug state changes (see bug_events.go).
+	Timeline []*uiBugEvent
+}
+
+// uiEmailReply describes how to join the email thread where the bug was reported.
+type uiEmailReply struct {
+	MailTo    string
+	SendEmail string
 }
 
 const (
@@ -254,6 +382,14 @@ const (
 	sectionJobList        = "job_list"
 	sectionCrashList      = "crash_list"
 	sectionDiscussionList = "discussion_list"
+	sectionConfigDrift    = "config_drift"
+	sectionGuiltyFiles    = "guilty_file_history"
+	sectionSubsystems     = "subsystem_history"
+	sectionBackports      = "backports"
+	sectionReproCoverage  = "repro_coverage"
+	sectionCrashMatrix    = "crash_matrix"
+	sectionBugRepros      = "bug_repros"
+	sectionBugTimeline    = "bug_timeline"
 )
 
 type uiCollapsible struct {
@@ -276,6 +412,7 @@ type uiBugGroup struct {
 	Bugs          []*uiBug
 	DispLastAct   bool
 	DispDiscuss   bool
+	DispReproRun  bool
 }
 
 type uiJobList struct {
@@ -308,6 +445,12 @@ type uiBug struct {
 	LastActivity   time.Time
 	Subsystems     []*uiBugSubsystem
 	Discussions    DiscussionSummary
+	Disputed       bool
+	Assignee       string
+	AssignedTime   time.Time
+	ReproRevoked   bool
+	LastReproRun   time.Time
+	CVEs           []string
 }
 
 type uiBugSubsystem struct {
@@ -320,25 +463,45 @@ type uiCrash struct {
 	Manager         string
 	Time            time.Time
 	Maintainers     string
+	GuiltyFile      string
 	LogLink         string
 	LogHasStrace    bool
 	ReportLink      string
+	ReportID        string
 	ReproSyzLink    string
 	ReproCLink      string
 	ReproIsRevoked  bool
 	MachineInfoLink string
-	Assets          []*uiAsset
+	// EnvLink is the link to the JSON description of the crash environment (the "repro bundle").
+	EnvLink string
+	// VMConfig is the formatted VM config of the manager, see vm_config.go.
+	VMConfig string
+	Assets   []*uiAsset
 	*uiBuild
+	maintainers []string
+	// vmcores are shown only to users with the namespace VMCoreAccessLevel (see showVMCores).
+	vmcores []*uiAsset
+	// KCSAN and KMSAN stacks (see sanitizer_stacks.go).
+	raceAccesses []string
+	kmsanOrigin  string
+	// ReproReliability is set if the repro was retested (see repro_reliability.go).
+	ReproReliability *uiReproReliability
+	// Taint are the kernel taint flags, TaintDescr is their description (see taint.go).
+	Taint      string
+	TaintDescr string
 }
 
 type uiAsset struct {
 	Title       string
 	DownloadURL string
+	Details     string
 }
 
 type uiCrashTable struct {
-	Crashes []*uiCrash
-	Caption string
+	Crashes    []*uiCrash
+	Caption    string
+	ShowGuilty bool
+	ShowDiff   bool
 }
 
 type uiJob struct {
@@ -369,21 +532,29 @@ type uiJob struct {
 	Commits          []*uiCommit // for inconclusive bisection
 	Crash            *uiCrash
 	Reported         bool
+	Confidence       string
+	ConfidenceNotes  []string
 }
 
 type userBugFilter struct {
-	Manager     string // show bugs that happened on the manager
-	OnlyManager string // show bugs that happened ONLY on the manager
-	Subsystem   string // only show bugs belonging to the subsystem
-	NoSubsystem bool
+	Manager      string // show bugs that happened on the manager
+	OnlyManager  string // show bugs that happened ONLY on the manager
+	Subsystem    string // only show bugs belonging to the subsystem
+	NoSubsystem  bool
+	Assignee     string // only show bugs claimed by the developer
+	ReproRevoked bool   // only show bugs whose reproducers no longer work
+	NoTainted    bool   // hide bugs that only happened on tainted kernels
 }
 
 func MakeBugFilter(r *http.Request) *userBugFilter {
 	return &userBugFilter{
-		Subsystem:   r.FormValue("subsystem"),
-		NoSubsystem: r.FormValue("no_subsystem") != "",
-		Manager:     r.FormValue("manager"),
-		OnlyManager: r.FormValue("only_manager"),
+		Subsystem:    r.FormValue("subsystem"),
+		NoSubsystem:  r.FormValue("no_subsystem") != "",
+		Manager:      r.FormValue("manager"),
+		OnlyManager:  r.FormValue("only_manager"),
+		Assignee:     r.FormValue("assignee"),
+		ReproRevoked: r.FormValue("repro_revoked") != "",
+		NoTainted:    r.FormValue("no_tainted") != "",
 	}
 }
 
@@ -418,6 +589,15 @@ func (filter *userBugFilter) MatchBug(bug *Bug) bool {
 	if filter.Subsystem != "" && !bug.hasSubsystem(filter.Subsystem) {
 		return false
 	}
+	if filter.Assignee != "" && bug.AssigneeEmail != email.CanonicalEmail(filter.Assignee) {
+		return false
+	}
+	if filter.ReproRevoked && !bug.ReproRevoked {
+		return false
+	}
+	if filter.NoTainted && bug.onlyTainted() {
+		return false
+	}
 	return true
 }
 
@@ -425,7 +605,8 @@ func (filter *userBugFilter) Any() bool {
 	if filter == nil {
 		return false
 	}
-	return filter.Subsystem != "" || filter.OnlyManager != "" || filter.Manager != "" || filter.NoSubsystem
+	return filter.Subsystem != "" || filter.OnlyManager != "" || filter.Manager != "" ||
+		filter.NoSubsystem || filter.Assignee != "" || filter.ReproRevoked || filter.NoTainted
 }
 
 // handleMain serves main page.
@@ -434,13 +615,17 @@ func handleMain(c context.Context, w http.ResponseWriter, r *http.Request) error
 	if err != nil {
 		return err
 	}
-	accessLevel := accessLevel(c, r)
+	accessLevel := namespaceAccessLevel(c, r, hdr.Namespace)
 	filter := MakeBugFilter(r)
 	managers, err := loadManagers(c, accessLevel, hdr.Namespace, filter)
 	if err != nil {
 		return err
 	}
-	groups, err := fetchNamespaceBugs(c, accessLevel, hdr.Namespace, filter)
+	groups, err := cachedNamespaceBugs(c, accessLevel, hdr.Namespace, filter)
+	if err != nil {
+		return err
+	}
+	savedViews, err := makeUISavedViews(c, r, hdr.Namespace)
 	if err != nil {
 		return err
 	}
@@ -450,6 +635,7 @@ func handleMain(c context.Context, w http.ResponseWriter, r *http.Request) error
 		} else {
 			group.DispLastAct = true
 		}
+		group.DispReproRun = true
 	}
 	data := &uiMainPage{
 		Header:         hdr,
@@ -458,6 +644,7 @@ func handleMain(c context.Context, w http.ResponseWriter, r *http.Request) error
 		Groups:         groups,
 		Managers:       makeManagerList(managers, hdr.Namespace),
 		BugFilter:      makeUIBugFilter(c, filter),
+		SavedViews:     savedViews,
 	}
 	return serveTemplate(w, "main.html", data)
 }
@@ -496,7 +683,7 @@ func handleSubsystemPage(c context.Context, w http.ResponseWriter, r *http.Reque
 	if subsystem == nil {
 		return fmt.Errorf("the subsystem is not found")
 	}
-	groups, err := fetchNamespaceBugs(c, accessLevel(c, r),
+	groups, err := cachedNamespaceBugs(c, namespaceAccessLevel(c, r, hdr.Namespace),
 		hdr.Namespace, &userBugFilter{
 			Subsystem: subsystem.Name,
 		})
@@ -534,7 +721,7 @@ func handleRepos(c context.Context, w http.ResponseWriter, r *http.Request) erro
 	if err != nil {
 		return err
 	}
-	repos, err := loadRepos(c, accessLevel(c, r), hdr.Namespace)
+	repos, err := loadRepos(c, namespaceAccessLevel(c, r, hdr.Namespace), hdr.Namespace)
 	if err != nil {
 		return err
 	}
@@ -554,13 +741,15 @@ type TerminalBug struct {
 }
 
 func handleTerminalBugList(c context.Context, w http.ResponseWriter, r *http.Request, typ *TerminalBug) error {
-	accessLevel := accessLevel(c, r)
 	hdr, err := commonHeader(c, r, w, "")
 	if err != nil {
 		return err
 	}
+	accessLevel := namespaceAccessLevel(c, r, hdr.Namespace)
 	hdr.Subpage = typ.Subpage
 	typ.Filter = MakeBugFilter(r)
+	// Fixed and invalid bugs are not retested, so the flag is meaningless for them.
+	typ.Filter.ReproRevoked = false
 	extraBugs := []*Bug{}
 	if typ.Status == BugStatusFixed {
 		// Mix in bugs that have pending fixes.
@@ -591,12 +780,70 @@ func handleAdmin(c context.Context, w http.ResponseWriter, r *http.Request) erro
 	if accessLevel != AccessAdmin {
 		return ErrAccess
 	}
-	switch action := r.FormValue("action"); action {
+	action := r.FormValue("action")
+	if action != "" && action != "memcache_flush" && action != "read_only" && isReadOnly(c) {
+		return ErrReadOnly
+	}
+	switch action {
 	case "":
+	case "read_only":
+		if err := handleReadOnlyAction(c, r); err != nil {
+			return err
+		}
 	case "memcache_flush":
 		if err := memcache.Flush(c); err != nil {
 			return fmt.Errorf("failed to flush memcache: %v", err)
 		}
+	case "export_discussions":
+		if err := startDiscussionExport(c); err != nil {
+			return err
+		}
+	case "find_discussion_merges":
+		if _, err := findDiscussionMergeCandidates(c); err != nil {
+			return err
+		}
+	case "set_guilty_file":
+		return handleSetGuiltyFile(c, r)
+	case "pin_fix_commit":
+		return handlePinFixCommit(c, r)
+	case "rename_bug":
+		return handleRenameBug(c, r)
+	case "clear_disputed":
+		return handleClearDisputed(c, r)
+	case "set_cves":
+		return handleSetBugCVEs(c, r)
+	case "share_bug":
+		return handleShareBug(c, r)
+	case "revoke_share_link":
+		return handleRevokeShareLink(c, r)
+	case "bootstrap_namespace":
+		if err := handleBootstrapNamespaceAction(c, r); err != nil {
+			return err
+		}
+	case "delete_namespace", "confirm_namespace_deletion":
+		if err := handleNamespaceDeletionAction(c, r, action == "confirm_namespace_deletion"); err != nil {
+			return err
+		}
+	case "release_email_sender":
+		if err := handleReleaseEmailSender(c, r); err != nil {
+			return err
+		}
+	case "import_corpus":
+		if err := handleImportCorpus(c, r); err != nil {
+			return err
+		}
+	case "grant_role", "revoke_role":
+		if err := handleNamespaceRoleAction(c, r, action == "grant_role"); err != nil {
+			return err
+		}
+	case "pause_reporting", "resume_reporting":
+		if err := handleReportingPauseAction(c, r, action == "pause_reporting"); err != nil {
+			return err
+		}
+	case "merge_discussions", "reject_discussion_merge":
+		if err := applyDiscussionMerge(c, r.FormValue("id"), action == "merge_discussions"); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("unknown action %q", action)
 	}
@@ -611,6 +858,19 @@ func handleAdmin(c context.Context, w http.ResponseWriter, r *http.Request) erro
 		recentJobs    []*uiJob
 		pendingJobs   []*uiJob
 		runningJobs   []*uiJob
+		quotas        []*DiscussionQuota
+		mismatches    []*DiscussionMismatch
+		export        *uiDiscussionExport
+		merges        []*uiDiscussionMerge
+		fixConflicts  []*uiFixConflictBug
+		bootstraps    []*uiNamespaceBootstrap
+		deletions     []*uiNamespaceDeletion
+		quarantined   []*uiQuarantinedSender
+		roles         []*uiNamespaceRole
+		corpusImports []*CorpusImport
+		pauses        []*uiReportingPause
+		dataRaceDups  []*uiDataRaceDup
+		experiments   []*ReportExperimentStats
 	)
 	g, _ := errgroup.WithContext(context.Background())
 	g.Go(func() error {
@@ -643,18 +903,96 @@ func handleAdmin(c context.Context, w http.ResponseWriter, r *http.Request) erro
 		runningJobs, err = loadRunningJobs(c)
 		return err
 	})
+	g.Go(func() error {
+		var err error
+		quotas, err = loadDiscussionQuotas(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		mismatches, err = loadDiscussionMismatches(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		export, err = loadDiscussionExportUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		merges, err = loadDiscussionMergesUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		fixConflicts, err = loadFixConflictBugs(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		bootstraps, err = loadNamespaceBootstrapsUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		deletions, err = loadNamespaceDeletionsUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		quarantined, err = loadQuarantinedSendersUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		roles, err = loadNamespaceRolesUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		corpusImports, err = loadCorpusImportsUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		pauses, err = loadReportingPausesUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		dataRaceDups, err = loadDataRaceDupsUI(c)
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		experiments, err = loadReportExperimentStats(c)
+		return err
+	})
 	err = g.Wait()
 	if err != nil {
 		return err
 	}
 	data := &uiAdminPage{
-		Header:        hdr,
-		Log:           errorLog,
-		Managers:      makeManagerList(managers, hdr.Namespace),
-		RecentJobs:    &uiJobList{Title: "Recent jobs:", Jobs: recentJobs},
-		RunningJobs:   &uiJobList{Title: "Running jobs:", Jobs: runningJobs},
-		PendingJobs:   &uiJobList{Title: "Pending jobs:", Jobs: pendingJobs},
-		MemcacheStats: memcacheStats,
+		Header:         hdr,
+		Log:            errorLog,
+		Managers:       makeManagerList(managers, hdr.Namespace),
+		RecentJobs:     &uiJobList{Title: "Recent jobs:", Jobs: recentJobs},
+		RunningJobs:    &uiJobList{Title: "Running jobs:", Jobs: runningJobs},
+		PendingJobs:    &uiJobList{Title: "Pending jobs:", Jobs: pendingJobs},
+		MemcacheStats:  memcacheStats,
+		Quotas:         quotas,
+		Mismatches:     mismatches,
+		Export:         export,
+		Merges:         merges,
+		FixConflicts:   fixConflicts,
+		Bootstraps:     bootstraps,
+		Deletions:      deletions,
+		Quarantined:    quarantined,
+		NamespaceRoles: roles,
+		CorpusImports:  corpusImports,
+		Pauses:         pauses,
+		DataRaceDups:   dataRaceDups,
+		Experiments:    experiments,
 	}
 	return serveTemplate(w, "admin.html", data)
 }
@@ -666,10 +1004,13 @@ func handleBug(c context.Context, w http.ResponseWriter, r *http.Request) error
 	if err != nil {
 		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
 	}
-	accessLevel := accessLevel(c, r)
-	if err := checkAccessLevel(c, r, bug.sanitizeAccess(accessLevel)); err != nil {
+	accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
+	if err := checkNamespaceAccessLevel(c, r, bug.Namespace, bug.sanitizeAccess(accessLevel)); err != nil {
 		return err
 	}
+	if r.FormValue("title") != "" {
+		return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+	}
 	hdr, err := commonHeader(c, r, w, bug.Namespace)
 	if err != nil {
 		return err
@@ -700,14 +1041,91 @@ func handleBug(c context.Context, w http.ResponseWriter, r *http.Request) error
 			})
 		}
 	}
+	regressionOf, err := loadRegressedBug(c, bug)
+	if err != nil {
+		return err
+	}
+	if regressionOf != nil && accessLevel >= regressionOf.sanitizeAccess(accessLevel) {
+		sections = append(sections, &uiCollapsible{
+			Title: "Regression of",
+			Show:  true,
+			Type:  sectionBugList,
+			Value: &uiBugGroup{
+				Now:        timeNow(c),
+				ShowStatus: true,
+				Bugs:       []*uiBug{createUIBug(c, regressionOf, state, managers)},
+			},
+		})
+	}
 	uiBug := createUIBug(c, bug, state, managers)
-	crashes, sampleReport, err := loadCrashesForBug(c, bug)
+	crashes, sampleReport, sampleBuild, err := loadCrashesForBug(c, bug)
 	if err != nil {
 		return err
 	}
+	showVMCores(crashes, bug.Namespace, accessLevel)
 	crashesTable := &uiCrashTable{
-		Crashes: crashes,
-		Caption: fmt.Sprintf("Crashes (%d)", bug.NumCrashes),
+		Crashes:    crashes,
+		Caption:    fmt.Sprintf("Crashes (%d)", bug.NumCrashes),
+		ShowGuilty: accessLevel >= AccessUser,
+	}
+	reports := 0
+	for _, crash := range crashes {
+		if crash.ReportID != "" {
+			reports++
+		}
+	}
+	crashesTable.ShowDiff = reports >= 2
+	crashMatrix, err := loadCrashMatrix(c, bug.key(c))
+	if err != nil {
+		return err
+	}
+	if crashMatrix != nil {
+		sections = append(sections, &uiCollapsible{
+			Title: fmt.Sprintf("Crashes by manager (%d)", len(crashMatrix.Rows)),
+			Type:  sectionCrashMatrix,
+			Value: crashMatrix,
+		})
+	}
+	var sampleCrash *uiCrash
+	if len(crashes) > 0 {
+		sampleCrash = crashes[0]
+	}
+	if accessLevel >= AccessUser && len(bug.GuiltyFileHistory) > 0 {
+		sections = append(sections, &uiCollapsible{
+			Title: fmt.Sprintf("Guilty file changes (%d)", len(bug.GuiltyFileHistory)),
+			Type:  sectionGuiltyFiles,
+			Value: makeGuiltyFileHistoryUI(bug),
+		})
+	}
+	regressions, err := loadRegressionsForBug(c, r, bug, state, managers)
+	if err != nil {
+		return err
+	}
+	if len(regressions.Bugs) > 0 {
+		sections = append(sections, &uiCollapsible{
+			Title: fmt.Sprintf("Regressions (%d)", len(regressions.Bugs)),
+			Show:  true,
+			Type:  sectionBugList,
+			Value: regressions,
+		})
+	}
+	if len(bug.SubsystemsHistory) > 0 {
+		sections = append(sections, &uiCollapsible{
+			Title: fmt.Sprintf("Subsystem label changes (%d)", len(bug.SubsystemsHistory)),
+			Type:  sectionSubsystems,
+			Value: makeSubsystemHistoryUI(bug, accessLevel),
+		})
+	}
+	timeline, err := loadBugTimelineUI(c, bug, accessLevel)
+	if err != nil {
+		return err
+	}
+	if len(timeline) > 0 {
+		sections = append(sections, &uiCollapsible{
+			Title: fmt.Sprintf("Timeline (%d)", len(timeline)),
+			Type:  sectionBugTimeline,
+			Value: timeline,
+		})
 	}
 	dups, err := loadDupsForBug(c, r, bug, state, managers)
 	if err != nil {
@@ -731,6 +1149,50 @@ func handleBug(c context.Context, w http.ResponseWriter, r *http.Request) error
 			Value: similar,
 		})
 	}
+	if sampleBuild != nil {
+		drift, err := loadConfigDrift(c, sampleBuild)
+		if err != nil {
+			return err
+		}
+		if drift != nil {
+			sections = append(sections, &uiCollapsible{
+				Title: fmt.Sprintf("Kernel config changes since the crash (%d)", drift.Total),
+				Type:  sectionConfigDrift,
+				Value: drift,
+			})
+		}
+	}
+	reproCoverage, err := loadReproCoverage(c, bug)
+	if err != nil {
+		return err
+	}
+	if reproCoverage != nil {
+		sections = append(sections, &uiCollapsible{
+			Title: fmt.Sprintf("Reproducer coverage (%d files)", len(reproCoverage.Files)),
+			Type:  sectionReproCoverage,
+			Value: reproCoverage,
+		})
+	}
+	repros, err := makeBugReprosUI(c, bug, accessLevel)
+	if err != nil {
+		return err
+	}
+	if repros != nil {
+		sections = append(sections, &uiCollapsible{
+			Title: fmt.Sprintf("Reproducers (%d)", len(repros.Repros)),
+			Type:  sectionBugRepros,
+			Value: repros,
+		})
+	}
+
+	if backports := makeBackportsUI(bug); backports != nil {
+		sections = append(sections, &uiCollapsible{
+			Title: "Backports",
+			Show:  true,
+			Type:  sectionBackports,
+			Value: backports,
+		})
+	}
 
 	var bisectCause *uiJob
 	if bug.BisectCause > BisectPending {
@@ -746,18 +1208,27 @@ func handleBug(c context.Context, w http.ResponseWriter, r *http.Request) error
 			return err
 		}
 	}
-	discussions, err := getBugDiscussionsUI(c, bug)
+	discussions, total, err := getBugDiscussionPageUI(c, r, bug)
 	if err != nil {
 		return err
 	}
-	if len(discussions) > 0 {
+	if total > 0 || discussions.Paginated {
 		sections = append(sections, &uiCollapsible{
-			Title: fmt.Sprintf("Discussions (%d)", len(discussions)),
+			Title: fmt.Sprintf("Discussions (%d)", total),
 			Show:  true,
 			Type:  sectionDiscussionList,
 			Value: discussions,
 		})
 	}
+	upstream, err := upstreamDiscussion(c, bug, accessLevel)
+	if err != nil {
+		return err
+	}
+	linkedBugs, err := loadLinkedSimilarBugs(c, bug, accessLevel)
+	if err != nil {
+		return err
+	}
+	alsoSeenIn, upstreamFix := makeSimilarBugsUI(bug, linkedBugs)
 	testPatchJobs, err := loadTestPatchJobs(c, bug)
 	if err != nil {
 		return err
@@ -773,14 +1244,55 @@ func handleBug(c context.Context, w http.ResponseWriter, r *http.Request) error
 		})
 	}
 	data := &uiBugPage{
-		Header:       hdr,
-		Now:          timeNow(c),
-		Bug:          uiBug,
-		BisectCause:  bisectCause,
-		BisectFix:    bisectFix,
-		Sections:     sections,
-		SampleReport: sampleReport,
-		Crashes:      crashesTable,
+		Header:            hdr,
+		Now:               timeNow(c),
+		Bug:               uiBug,
+		BisectCause:       bisectCause,
+		BisectFix:         bisectFix,
+		Sections:          sections,
+		SampleReport:      sampleReport,
+		SanitizerStacks:   makeSanitizerStacksUI(sampleCrash),
+		Crashes:           crashesTable,
+		Upstream:          upstream,
+		EmailReply:        makeEmailReplyUI(c, bug, accessLevel),
+		GuiltyFile:        makeGuiltyFileUI(c, bug, sampleCrash, accessLevel),
+		Repro:             makeReproStateUI(bug, accessLevel, timeNow(c)),
+		SuppressedCrashes: formatSuppressedCrashes(bug.SuppressedCrashes),
+		PurgedCrashes:     formatPurgedCrashes(bug),
+		AlsoSeenIn:        alsoSeenIn,
+		UpstreamFix:       upstreamFix,
+		CrashMatrix:       crashMatrix,
+		Observations:      makeExternalObservationsUI(bug),
+		Rename:            makeBugRenameUI(bug, accessLevel),
+		FrameAliases:      bug.FrameAliases,
+		CVEs:              makeBugCVEsUI(bug, accessLevel),
+		Timeline:          timeline,
+	}
+	if bug.Disputed && accessLevel >= AccessAdmin {
+		data.ClearDisputeLink = fmt.Sprintf("/admin?action=clear_disputed&id=%v", bug.keyHash())
+	}
+	if len(bug.Commits) != 0 && (bug.Status == BugStatusOpen || bug.Status == BugStatusFixed) {
+		data.FixState = bug.fixState(managers, timeNow(c)).String()
+	}
+	if data.SyzkallerRange, err = loadSyzkallerRangeUI(c, bug); err != nil {
+		return err
+	}
+	if data.CommitWatch, err = makeCommitWatchUI(c, bug, sampleCrash, accessLevel); err != nil {
+		return err
+	}
+	if bug.Status == BugStatusOpen {
+		if data.DupCandidates, err = makeDupCandidatesUI(c, bug, accessLevel); err != nil {
+			return err
+		}
+	}
+	if data.FixedTogether, err = makeFixedTogetherUI(c, bug, accessLevel); err != nil {
+		return err
+	}
+	if accessLevel >= AccessAdmin {
+		data.FixConflicts = makeFixConflictsUI(bug)
+		if data.ShareLinks, err = loadShareLinksUI(c, bug); err != nil {
+			return err
+		}
 	}
 	for _, entry := range bug.Tags.Subsystems {
 		data.Subsystems = append(data.Subsystems, makeBugSubsystemUI(c, bug, entry))
@@ -810,6 +1322,44 @@ func handleBug(c context.Context, w http.ResponseWriter, r *http.Request) error
 	return serveTemplate(w, "bug.html", data)
 }
 
+// makeEmailReplyUI returns the reply parameters for the latest email reporting
+// visible to the user, or nil if there's no known thread to reply to.
+func makeEmailReplyUI(c context.Context, bug *Bug, accessLevel AccessLevel) *uiEmailReply {
+	for i := len(bug.Reporting) - 1; i >= 0; i-- {
+		bugReporting := &bug.Reporting[i]
+		if bugReporting.Reported.IsZero() || bugReporting.Dummy || bugReporting.ReportMessageID == "" {
+			continue
+		}
+		reporting := config.Namespaces[bug.Namespace].ReportingByName(bugReporting.Name)
+		if reporting == nil || reporting.AccessLevel > accessLevel {
+			continue
+		}
+		cfg, ok := reporting.Config.(*EmailConfig)
+		if !ok {
+			continue
+		}
+		botEmail, err := email.AddAddrContext(ownEmail(c), bugReporting.ID)
+		if err != nil {
+			log.Errorf(c, "failed to build the bot address: %v", err)
+			return nil
+		}
+		to := []string{botEmail}
+		cc := []string{cfg.Email}
+		if bugReporting.CC != "" {
+			cc = email.MergeEmailLists(cc, strings.Split(bugReporting.CC, "|"))
+		}
+		subject := bug.displayTitle()
+		if cfg.SubjectPrefix != "" {
+			subject = cfg.SubjectPrefix + " " + subject
+		}
+		return &uiEmailReply{
+			MailTo:    mailtoLink(to, cc, subject, bugReporting.ReportMessageID),
+			SendEmail: gitSendEmailCommand(to, cc, bugReporting.ReportMessageID),
+		}
+	}
+	return nil
+}
+
 func makeBugSubsystemUI(c context.Context, bug *Bug, entry BugSubsystem) *uiBugSubsystem {
 	url := getCurrentURL(c)
 	// By default let's point to the subsystem's page.
@@ -825,26 +1375,152 @@ func makeBugSubsystemUI(c context.Context, bug *Bug, entry BugSubsystem) *uiBugS
 	}
 }
 
-func getBugDiscussionsUI(c context.Context, bug *Bug) ([]*uiBugDiscussion, error) {
-	// TODO: also include dup bug discussions.
+func makeUIBugDiscussions(bugKey *db.Key, discussions []*Discussion) []*uiBugDiscussion {
 	var list []*uiBugDiscussion
-	discussions, err := discussionsForBug(c, bug.key(c))
-	if err != nil {
-		return nil, err
-	}
 	for _, d := range discussions {
+		if d.Summary.AllMessages == 0 {
+			// E.g. the discussion only consists of auto-replies.
+			continue
+		}
+		reason := d.attachmentReason(bugKey.StringID())
 		list = append(list, &uiBugDiscussion{
-			Subject:  d.Subject,
-			Link:     d.link(),
-			Total:    d.Summary.AllMessages,
-			External: d.Summary.ExternalMessages,
-			Last:     d.Summary.LastMessage,
+			Subject:    d.Subject,
+			Link:       d.link(),
+			TargetTree: d.TargetTree,
+			Reason:     string(reason),
+			ReasonInfo: attachmentReasonInfo[reason],
+			Total:      d.Summary.AllMessages,
+			External:   d.Summary.ExternalMessages,
+			Last:       d.lastActivity(),
 		})
 	}
-	sort.SliceStable(list, func(i, j int) bool {
-		return list[i].Last.After(list[j].Last)
-	})
-	return list, nil
+	return list
+}
+
+var attachmentReasonInfo = map[dashapi.AttachmentReason]string{
+	dashapi.AttachUnknown:    "the discussion was attached before the reasons were recorded",
+	dashapi.AttachAddress:    "the bug address is among the recipients",
+	dashapi.AttachReportedBy: "the Reported-by tag mentions the bug",
+	dashapi.AttachBody:       "the bug address or link is mentioned in the message",
+	dashapi.AttachTitle:      "the subject matches the bug title",
+	dashapi.AttachAPI:        "the discussion was reported via API",
+}
+
+const discussionsPerPage = 20
+
+// getBugDiscussionPageUI returns the page of bug discussions requested by the form values
+// and the total number of matching discussions.
+func getBugDiscussionPageUI(c context.Context, r *http.Request, bug *Bug) (*uiDiscussionList, int, error) {
+	source, typ, cursor := r.FormValue("discussion_source"), r.FormValue("discussion_type"),
+		r.FormValue("discussion_cursor")
+	discussions, next, err := loadBugDiscussionPage(c, bug.key(c), source, typ, cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+	ret := &uiDiscussionList{
+		Discussions: makeUIBugDiscussions(bug.key(c), discussions),
+	}
+	if source == "" && typ == "" && cursor == "" && next == "" {
+		// Everything fits on one page, so there's no need to count separately.
+		return ret, len(ret.Discussions), nil
+	}
+	total, err := bugDiscussionsQuery(c, bug.key(c), source, typ).KeysOnly().Count(c)
+	if err != nil {
+		return nil, 0, err
+	}
+	baseURL := r.URL.String()
+	ret.Paginated = true
+	ret.FirstLink = html.AmendURL(baseURL, "discussion_cursor", "")
+	if next != "" {
+		ret.NextLink = html.AmendURL(baseURL, "discussion_cursor", next)
+	}
+	var sources, types []string
+	for name := range discussionSources {
+		sources = append(sources, string(name))
+	}
+	sort.Strings(sources)
+	for _, name := range []dashapi.DiscussionType{dashapi.DiscussionReport, dashapi.DiscussionPatch} {
+		types = append(types, string(name))
+	}
+	for _, filter := range []struct {
+		name    string
+		param   string
+		current string
+		values  []string
+	}{
+		{"source", "discussion_source", source, sources},
+		{"type", "discussion_type", typ, types},
+	} {
+		// Changing a filter starts from the first page.
+		filterURL := html.AmendURL(baseURL, "discussion_cursor", "")
+		ui := &uiDiscussionFilter{Name: filter.name}
+		ui.Options = append(ui.Options, &uiDiscussionFilterOption{
+			Name:     "all",
+			Link:     html.AmendURL(filterURL, filter.param, ""),
+			Selected: filter.current == "",
+		})
+		for _, value := range filter.values {
+			ui.Options = append(ui.Options, &uiDiscussionFilterOption{
+				Name:     value,
+				Link:     html.AmendURL(filterURL, filter.param, value),
+				Selected: filter.current == value,
+			})
+		}
+		ret.Filters = append(ret.Filters, ui)
+	}
+	return ret, total, nil
+}
+
+// bugDiscussionsQuery returns the bug discussions that are shown on the bug page ordered by the last activity.
+// Discussions that only consist of auto-replies have no activity and are skipped.
+func bugDiscussionsQuery(c context.Context, bugKey *db.Key, source, typ string) *db.Query {
+	query := db.NewQuery("Discussion").Filter("BugKeys=", bugKey.StringID())
+	if source != "" {
+		query = query.Filter("Source=", source)
+	}
+	if typ != "" {
+		query = query.Filter("Type=", typ)
+	}
+	return query.Filter("Summary.LastMessage>", time.Time{}).
+		Order("-Summary.LastMessage")
+}
+
+// loadBugDiscussionPage queries discussionsPerPage bug discussions ordered by the last activity.
+// It returns the cursor of the next page or an empty string if it's the last one.
+func loadBugDiscussionPage(c context.Context, bugKey *db.Key, source, typ, cursor string) (
+	[]*Discussion, string, error) {
+	// The key makes the order stable for discussions with the same last activity time.
+	query := bugDiscussionsQuery(c, bugKey, source, typ).
+		Order("__key__").
+		Limit(discussionsPerPage + 1)
+	if cursor != "" {
+		start, err := db.DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("bad discussion cursor: %v: %w", err, ErrClientBadRequest)
+		}
+		query = query.Start(start)
+	}
+	var discussions []*Discussion
+	iter := query.Run(c)
+	for len(discussions) < discussionsPerPage {
+		d := new(Discussion)
+		if _, err := iter.Next(d); err == db.Done {
+			return discussions, "", nil
+		} else if err != nil {
+			return nil, "", fmt.Errorf("failed to query discussions: %w", err)
+		}
+		discussions = append(discussions, d)
+	}
+	next, err := iter.Cursor()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get cursor: %w", err)
+	}
+	if _, err := iter.Next(new(Discussion)); err == db.Done {
+		return discussions, "", nil
+	} else if err != nil {
+		return nil, "", fmt.Errorf("failed to query discussions: %w", err)
+	}
+	return discussions, next.String(), nil
 }
 
 func handleBugStats(c context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -912,6 +1588,15 @@ func handleBugStats(c context.Context, w http.ResponseWriter, r *http.Request) e
 	}
 	// Print the results.
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(allReportings) > 1 {
+		var bugs []*Bug
+		for _, input := range inputs {
+			bugs = append(bugs, input.bug)
+		}
+		median, decisions := moderationDecisionStats(bugs, timeNow(c))
+		fmt.Fprintf(w, "Median time to moderation decision over the last %v days: %v (%v decisions)\n\n",
+			int(moderationDecisionStatsPeriod/(24*time.Hour)), median, decisions)
+	}
 	for _, report := range reports {
 		fmt.Fprintf(w, "%s\n==============\n", report.name)
 		wTab := tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.Debug)
@@ -956,7 +1641,19 @@ func findBugByID(c context.Context, r *http.Request) (*Bug, error) {
 		bug, _, err := findBugByReportingID(c, extID)
 		return bug, err
 	}
-	return nil, fmt.Errorf("mandatory parameter id/extid is missing")
+	if title := r.FormValue("title"); title != "" {
+		ns := r.FormValue("ns")
+		if config.Namespaces[ns] == nil {
+			return nil, fmt.Errorf("unknown namespace %q", ns)
+		}
+		// The title may be a former title of a renamed bug, findDupByTitle handles both.
+		bug, _, err := findDupByTitle(c, ns, title)
+		if err == nil && bug == nil {
+			err = fmt.Errorf("no bug titled %q", title)
+		}
+		return bug, err
+	}
+	return nil, fmt.Errorf("mandatory parameter id/extid/title is missing")
 }
 
 func getUIJob(c context.Context, bug *Bug, jobType JobType) (*uiJob, error) {
@@ -1013,6 +1710,7 @@ func handleSubsystemsList(c context.Context, w http.ResponseWriter, r *http.Requ
 		Unclassified: unclassified,
 		SomeHidden:   someHidden,
 		ShowAllURL:   html.AmendURL(getCurrentURL(c), "all", "true"),
+		Digests:      config.Namespaces[hdr.Namespace].Digests != nil,
 	})
 }
 
@@ -1050,7 +1748,7 @@ func handleTextImpl(c context.Context, w http.ResponseWriter, r *http.Request, t
 		}
 		id = xid
 	}
-	bug, crash, err := checkTextAccess(c, r, tag, id)
+	bug, crash, crashKey, err := checkTextAccess(c, r, tag, id)
 	if err != nil {
 		return err
 	}
@@ -1061,13 +1759,19 @@ func handleTextImpl(c context.Context, w http.ResponseWriter, r *http.Request, t
 		}
 		return err
 	}
-	if err := checkAccessLevel(c, r, config.Namespaces[ns].AccessLevel); err != nil {
+	if err := checkNamespaceAccessLevel(c, r, ns, config.Namespaces[ns].AccessLevel); err != nil {
 		return err
 	}
+	if tag == textCrashReport && r.FormValue("json") == "1" {
+		return serveStructuredReport(w, crash)
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	// Unfortunately filename does not work in chrome on linux due to:
 	// https://bugs.chromium.org/p/chromium/issues/detail?id=608342
 	w.Header().Set("Content-Disposition", "inline; filename="+textFilename(tag))
+	if crashKey != nil {
+		recordCrashAccess(c, crashKey)
+	}
 	augmentRepro(c, w, tag, bug, crash)
 	w.Write(data)
 	return nil
@@ -1173,6 +1877,10 @@ func fetchNamespaceBugs(c context.Context, accessLevel AccessLevel, ns string,
 		if !filter.MatchBug(bug) {
 			continue
 		}
+		if bug.InheritedFrom != "" && bug.NumCrashes == 0 {
+			// Inherited bugs are not interesting until they happen in this namespace.
+			continue
+		}
 		uiBug := createUIBug(c, bug, state, managers)
 		if len(uiBug.Commits) != 0 {
 			// Don't show "fix pending" bugs on the main page.
@@ -1322,6 +2030,8 @@ func applyBugFilter(query *db.Query, filter *userBugFilter) *db.Query {
 		query = query.Filter("Tags.Subsystems.Name=", subsystem)
 	} else if manager != "" {
 		query = query.Filter("HappenedOn=", manager)
+	} else if filter != nil && filter.ReproRevoked {
+		query = query.Filter("ReproRevoked=", true)
 	}
 	return query
 }
@@ -1338,7 +2048,7 @@ func loadDupsForBug(c context.Context, r *http.Request, bug *Bug, state *Reporti
 		return nil, err
 	}
 	var results []*uiBug
-	accessLevel := accessLevel(c, r)
+	accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
 	for _, dup := range dups {
 		if accessLevel < dup.sanitizeAccess(accessLevel) {
 			continue
@@ -1358,13 +2068,19 @@ func loadDupsForBug(c context.Context, r *http.Request, bug *Bug, state *Reporti
 func loadSimilarBugsUI(c context.Context, r *http.Request, bug *Bug, state *ReportingState) (*uiBugGroup, error) {
 	managers := make(map[string][]string)
 	accessLevel := accessLevel(c, r)
+	var roles map[string]AccessLevel
+	if accessLevel != AccessAdmin {
+		roles = userNamespaceRoles(c)
+	}
 	similarBugs, err := loadSimilarBugs(c, bug)
 	if err != nil {
 		return nil, err
 	}
 	var results []*uiBug
 	for _, similar := range similarBugs {
-		if accessLevel < similar.sanitizeAccess(accessLevel) {
+		// Similar bugs come from all namespaces.
+		level := withNamespaceRole(accessLevel, roles, similar.Namespace)
+		if level < similar.sanitizeAccess(level) {
 			continue
 		}
 		if managers[similar.Namespace] == nil {
@@ -1469,6 +2185,12 @@ func createUIBug(c context.Context, bug *Bug, state *ReportingState, managers []
 		NumManagers:    len(managers),
 		LastActivity:   bug.LastActivity,
 		Discussions:    bug.discussionSummary(),
+		Disputed:       bug.Disputed,
+		Assignee:       bug.AssigneeEmail,
+		AssignedTime:   bug.AssignedTime,
+		ReproRevoked:   bug.ReproRevoked,
+		LastReproRun:   bug.LastReproSuccess,
+		CVEs:           bug.CVEs,
 	}
 	for _, entry := range bug.Tags.Subsystems {
 		uiBug.Subsystems = append(uiBug.Subsystems, makeBugSubsystemUI(c, bug, entry))
@@ -1531,33 +2253,45 @@ func updateBugBadness(c context.Context, bug *uiBug) {
 	bug.NumCrashesBad = bug.NumCrashes >= 10000 && timeNow(c).Sub(bug.LastTime) < 24*time.Hour
 }
 
-func loadCrashesForBug(c context.Context, bug *Bug) ([]*uiCrash, template.HTML, error) {
+// loadCrashesForBug also returns the sample crash report and the build it happened on.
+func loadCrashesForBug(c context.Context, bug *Bug) ([]*uiCrash, template.HTML, *Build, error) {
 	bugKey := bug.key(c)
 	// We can have more than maxCrashes crashes, if we have lots of reproducers.
-	crashes, _, err := queryCrashesForBug(c, bugKey, 2*maxCrashes()+200)
+	crashes, keys, err := queryCrashesForBug(c, bugKey, 2*crashRetention(bug.Namespace).MaxCrashes+200)
 	if err != nil || len(crashes) == 0 {
-		return nil, "", err
+		return nil, "", nil, err
 	}
 	builds := make(map[string]*Build)
+	vmConfigs := make(map[int64]string)
 	var results []*uiCrash
-	for _, crash := range crashes {
+	for i, crash := range crashes {
 		build := builds[crash.BuildID]
 		if build == nil {
 			build, err = loadBuild(c, bug.Namespace, crash.BuildID)
 			if err != nil {
-				return nil, "", err
+				return nil, "", nil, err
 			}
 			builds[crash.BuildID] = build
 		}
-		results = append(results, makeUICrash(crash, build))
+		if _, ok := vmConfigs[build.VMConfig]; !ok {
+			vmConfig, err := loadVMConfig(c, build.VMConfig)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			vmConfigs[build.VMConfig] = formatVMConfig(vmConfig)
+		}
+		ui := makeUICrash(crash, build)
+		ui.EnvLink = crashEnvLink(bug, keys[i])
+		ui.VMConfig = vmConfigs[build.VMConfig]
+		results = append(results, ui)
 	}
 	sampleReport, _, err := getText(c, textCrashReport, crashes[0].Report)
 	if err != nil {
-		return nil, "", err
+		return nil, "", nil, err
 	}
 	sampleBuild := builds[crashes[0].BuildID]
 	linkifiedReport := linkifyReport(sampleReport, sampleBuild.KernelRepo, sampleBuild.KernelCommit)
-	return results, linkifiedReport, nil
+	return results, linkifiedReport, sampleBuild, nil
 }
 
 func linkifyReport(report []byte, repo, commit string) template.HTML {
@@ -1609,6 +2343,7 @@ func makeUICrash(crash *Crash, build *Build) *uiCrash {
 		Manager:         crash.Manager,
 		Time:            crash.Time,
 		Maintainers:     strings.Join(crash.Maintainers, ", "),
+		maintainers:     crash.Maintainers,
 		LogLink:         textLink(textCrashLog, crash.Log),
 		LogHasStrace:    dashapi.CrashFlags(crash.Flags)&dashapi.CrashUnderStrace > 0,
 		ReportLink:      textLink(textCrashReport, crash.Report),
@@ -1617,6 +2352,20 @@ func makeUICrash(crash *Crash, build *Build) *uiCrash {
 		ReproIsRevoked:  crash.ReproIsRevoked,
 		MachineInfoLink: textLink(textMachineInfo, crash.MachineInfo),
 		Assets:          uiAssets,
+		vmcores:         makeVMCoreAssetsUI(crash),
+		raceAccesses:    crash.ReportElements.RaceAccesses,
+		kmsanOrigin:     crash.ReportElements.KMSANOrigin,
+	}
+	ui.ReproReliability = makeReproReliabilityUI(crash)
+	if crash.Taint != "" {
+		ui.Taint = crash.Taint
+		ui.TaintDescr = describeTaint(crash.Taint)
+	}
+	if crash.Report != 0 {
+		ui.ReportID = strconv.FormatUint(uint64(crash.Report), 16)
+	}
+	if len(crash.ReportElements.GuiltyFiles) > 0 {
+		ui.GuiltyFile = crash.ReportElements.GuiltyFiles[0]
 	}
 	if build != nil {
 		ui.uiBuild = makeUIBuild(build)
@@ -1911,6 +2660,8 @@ func makeUIJob(job *Job, jobKey *db.Key, bug *Bug, crash *Crash, build *Build) *
 		LogLink:          textLink(textLog, job.Log),
 		ErrorLink:        textLink(textError, job.Error),
 		Reported:         job.Reported,
+		Confidence:       job.Confidence.String(),
+		ConfidenceNotes:  job.ConfidenceNotes,
 	}
 	if !job.Finished.IsZero() {
 		ui.Duration = job.Finished.Sub(job.LastStarted)
@@ -0,0 +1,297 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// The /metrics endpoint exposes the dashboard health counters in the Prometheus text format.
+// The counters are incremented in the memory of the instance that handles the request and
+// are periodically added to the MetricRollup entities by the same instance (on the next
+// increment after metricsFlushPeriod, or when the instance serves /metrics). The endpoint
+// reports the rollups plus the not yet flushed increments of the serving instance, so the
+// values lag behind by up to metricsFlushPeriod for the other instances, and the increments
+// of an instance that is shut down before a flush are lost. The gauges are computed
+// from the datastore on every scrape.
+
+const metricsFlushPeriod = time.Minute
+
+type metricDesc struct {
+	name string
+	help string
+}
+
+var (
+	metricEmailsProcessed = &metricDesc{"syzbot_emails_processed_total",
+		"Incoming emails processed."}
+	metricCrashesIngested = &metricDesc{"syzbot_crashes_ingested_total",
+		"Crashes reported by the managers."}
+	metricReportingEmails = &metricDesc{"syzbot_reporting_emails_sent_total",
+		"Bug reports and notifications sent by email."}
+	metricDiscussionMessages = &metricDesc{"syzbot_discussion_messages_total",
+		"New discussion messages recorded."}
+	metricTxRetries = &metricDesc{"syzbot_datastore_tx_retries_total",
+		"Retried datastore transactions."}
+	metricJobs = &metricDesc{"syzbot_jobs",
+		"Unfinished jobs."}
+)
+
+// counterMetrics are the metrics exported as counters, in the output order.
+var counterMetrics = []*metricDesc{
+	metricEmailsProcessed,
+	metricCrashesIngested,
+	metricReportingEmails,
+	metricDiscussionMessages,
+	metricTxRetries,
+}
+
+// MetricRollup is the flushed value of a counter.
+type MetricRollup struct {
+	Name    string
+	Label   string
+	Value   int64
+	Updated time.Time `datastore:",noindex"`
+}
+
+type metricKey struct {
+	name  string
+	label string // the namespace or another label value, may be empty
+}
+
+type metricsRegistry struct {
+	mu        sync.Mutex
+	pending   map[metricKey]int64
+	lastFlush time.Time
+}
+
+var metrics = newMetricsRegistry()
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{pending: make(map[metricKey]int64)}
+}
+
+// incMetric adds delta to the counter, label is usually the namespace.
+func incMetric(c context.Context, desc *metricDesc, label string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	metrics.add(metricKey{desc.name, label}, delta)
+	now := timeNow(c)
+	// In the read-only mode the increments are kept until the next flush.
+	if metrics.needFlush(now) && !isReadOnly(c) {
+		if err := metrics.flush(c, now); err != nil {
+			log.Errorf(c, "failed to flush metrics: %v", err)
+		}
+	}
+}
+
+func (mr *metricsRegistry) add(key metricKey, delta int64) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.pending[key] += delta
+}
+
+func (mr *metricsRegistry) needFlush(now time.Time) bool {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if now.Sub(mr.lastFlush) < metricsFlushPeriod {
+		return false
+	}
+	mr.lastFlush = now
+	return true
+}
+
+// take returns and resets the pending increments.
+func (mr *metricsRegistry) take() map[metricKey]int64 {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	pending := mr.pending
+	mr.pending = make(map[metricKey]int64)
+	return pending
+}
+
+// flush adds the pending increments to the rollups.
+// Increments that failed to be stored are kept for the next flush.
+func (mr *metricsRegistry) flush(c context.Context, now time.Time) error {
+	var lastErr error
+	for key, delta := range mr.take() {
+		if err := addMetricRollup(c, key, delta, now); err != nil {
+			mr.add(key, delta)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func metricRollupKey(c context.Context, key metricKey) *db.Key {
+	return db.NewKey(c, "MetricRollup", key.name+"|"+key.label, 0, nil)
+}
+
+func addMetricRollup(c context.Context, key metricKey, delta int64, now time.Time) error {
+	tx := func(c context.Context) error {
+		rollup := new(MetricRollup)
+		dbKey := metricRollupKey(c, key)
+		if err := db.Get(c, dbKey, rollup); err != nil && err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get metric: %w", err)
+		}
+		rollup.Name = key.name
+		rollup.Label = key.label
+		rollup.Value += delta
+		rollup.Updated = now
+		if _, err := db.Put(c, dbKey, rollup); err != nil {
+			return fmt.Errorf("failed to put metric: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+// countTxRetries wraps a transaction function and counts its retries.
+func countTxRetries(name string, tx func(context.Context) error) func(context.Context) error {
+	attempt := 0
+	return func(c context.Context) error {
+		attempt++
+		if attempt > 1 {
+			metrics.add(metricKey{metricTxRetries.name, name}, 1)
+		}
+		return tx(c)
+	}
+}
+
+type metricSample struct {
+	labels string
+	value  int64
+}
+
+// handleMetrics serves /metrics, it's available to admins and to the scrapers with MetricsToken.
+func handleMetrics(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if !metricsAuthorized(c, r) {
+		return ErrAccess
+	}
+	now := timeNow(c)
+	if err := metrics.flush(c, now); err != nil {
+		log.Errorf(c, "failed to flush metrics: %v", err)
+	}
+	var rollups []*MetricRollup
+	if _, err := db.NewQuery("MetricRollup").GetAll(c, &rollups); err != nil {
+		return fmt.Errorf("failed to query metrics: %w", err)
+	}
+	counters := make(map[string][]metricSample)
+	for _, rollup := range rollups {
+		counters[rollup.Name] = append(counters[rollup.Name], metricSample{
+			labels: counterLabels(rollup.Name, rollup.Label),
+			value:  rollup.Value,
+		})
+	}
+	// Unflushed increments of this instance (if the flush above failed).
+	for key, delta := range metrics.snapshot() {
+		counters[key.name] = append(counters[key.name], metricSample{
+			labels: counterLabels(key.name, key.label),
+			value:  delta,
+		})
+	}
+	jobs, err := jobQueueDepths(c)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, counters, jobs)
+	return nil
+}
+
+func metricsAuthorized(c context.Context, r *http.Request) bool {
+	if accessLevel(c, r) == AccessAdmin {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return config.MetricsToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(config.MetricsToken)) == 1
+}
+
+func (mr *metricsRegistry) snapshot() map[metricKey]int64 {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	ret := make(map[metricKey]int64)
+	for key, val := range mr.pending {
+		ret[key] = val
+	}
+	return ret
+}
+
+func counterLabels(name, label string) string {
+	if label == "" {
+		return ""
+	}
+	labelName := "namespace"
+	switch name {
+	case metricTxRetries.name:
+		labelName = "tx"
+	case metricDiscussionMessages.name:
+		labelName = "source"
+	}
+	return fmt.Sprintf("{%v=%q}", labelName, label)
+}
+
+// jobQueueDepths returns the unfinished job samples per namespace and state.
+func jobQueueDepths(c context.Context) ([]metricSample, error) {
+	var jobs []*Job
+	_, err := db.NewQuery("Job").
+		Filter("Finished=", time.Time{}).
+		GetAll(c, &jobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	depths := make(map[string]int64)
+	for _, job := range jobs {
+		state := "pending"
+		if job.IsRunning {
+			state = "running"
+		}
+		depths[fmt.Sprintf("{namespace=%q,state=%q}", job.Namespace, state)]++
+	}
+	var ret []metricSample
+	for labels, depth := range depths {
+		ret = append(ret, metricSample{labels, depth})
+	}
+	return ret, nil
+}
+
+func writeMetrics(w io.Writer, counters map[string][]metricSample, jobs []metricSample) {
+	fmt.Fprintf(w, "# The counters are summed over the dashboard instances, but the increments of\n"+
+		"# other instances are flushed every %v, so the values may lag behind a bit and\n"+
+		"# the increments of an instance shut down before a flush are lost.\n", metricsFlushPeriod)
+	for _, desc := range counterMetrics {
+		writeMetric(w, desc, "counter", counters[desc.name])
+	}
+	writeMetric(w, metricJobs, "gauge", jobs)
+}
+
+func writeMetric(w io.Writer, desc *metricDesc, typ string, samples []metricSample) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", desc.name, desc.help, desc.name, typ)
+	// The same labels may come both from a rollup and from the pending increments.
+	values := make(map[string]int64)
+	for _, sample := range samples {
+		values[sample.labels] += sample.value
+	}
+	var labels []string
+	for label := range values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Fprintf(w, "%v%v %v\n", desc.name, label, values[label])
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	buf := new(strings.Builder)
+	writeMetrics(buf, map[string][]metricSample{
+		metricCrashesIngested.name: {
+			{counterLabels(metricCrashesIngested.name, "ns2"), 5},
+			{counterLabels(metricCrashesIngested.name, "ns1"), 2},
+			// Rollup and pending increments of the same counter are summed.
+			{counterLabels(metricCrashesIngested.name, "ns1"), 1},
+		},
+		metricEmailsProcessed.name: {
+			{counterLabels(metricEmailsProcessed.name, ""), 10},
+		},
+		metricTxRetries.name: {
+			{counterLabels(metricTxRetries.name, "job_done"), 1},
+		},
+	}, []metricSample{
+		{`{namespace="ns1",state="pending"}`, 3},
+	})
+	want := `# HELP syzbot_emails_processed_total Incoming emails processed.
+# TYPE syzbot_emails_processed_total counter
+syzbot_emails_processed_total 10
+# HELP syzbot_crashes_ingested_total Crashes reported by the managers.
+# TYPE syzbot_crashes_ingested_total counter
+syzbot_crashes_ingested_total{namespace="ns1"} 3
+syzbot_crashes_ingested_total{namespace="ns2"} 5
+# HELP syzbot_reporting_emails_sent_total Bug reports and notifications sent by email.
+# TYPE syzbot_reporting_emails_sent_total counter
+# HELP syzbot_discussion_messages_total New discussion messages recorded.
+# TYPE syzbot_discussion_messages_total counter
+# HELP syzbot_datastore_tx_retries_total Retried datastore transactions.
+# TYPE syzbot_datastore_tx_retries_total counter
+syzbot_datastore_tx_retries_total{tx="job_done"} 1
+# HELP syzbot_jobs Unfinished jobs.
+# TYPE syzbot_jobs gauge
+syzbot_jobs{namespace="ns1",state="pending"} 3
+`
+	got := buf.String()
+	// Skip the caveat comment.
+	got = got[strings.Index(got, "# HELP"):]
+	if got != want {
+		t.Fatalf("got:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestCountTxRetries(t *testing.T) {
+	saved := metrics
+	defer func() { metrics = saved }()
+	metrics = newMetricsRegistry()
+	attempts := 0
+	tx := countTxRetries("test", func(c context.Context) error {
+		attempts++
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		tx(context.Background())
+	}
+	if attempts != 3 {
+		t.Fatalf("got %v attempts", attempts)
+	}
+	if got := metrics.snapshot()[metricKey{metricTxRetries.name, "test"}]; got != 2 {
+		t.Fatalf("got %v retries, want 2", got)
+	}
+	if len(metrics.take()) != 1 || len(metrics.snapshot()) != 0 {
+		t.Fatalf("take did not reset the pending increments")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	c.client.ReportCrash(testCrash(build, 2))
+	rep := c.client.pollBug()
+	c.client.pollBug()
+
+	c.expectOK(c.client.SaveDiscussion(&dashapi.SaveDiscussionReq{
+		Discussion: &dashapi.Discussion{
+			ID:      "123",
+			Source:  dashapi.DiscussionLore,
+			Type:    dashapi.DiscussionReport,
+			Subject: "Bug reported",
+			BugIDs:  []string{rep.ID},
+			Messages: []dashapi.DiscussionMessage{
+				{ID: "123", Time: timeNow(c.ctx)},
+				{ID: "456", Time: timeNow(c.ctx), External: true},
+			},
+		},
+	}))
+
+	// An email report and an incoming email.
+	client := c.publicClient
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	sender := c.pollEmailBug().Sender
+	c.incomingEmail(sender, "#syz invalid\n")
+	c.advanceTime(time.Hour)
+
+	_, err := c.AuthGET(AccessUser, "/metrics")
+	c.expectTrue(err != nil)
+	page, err := c.AuthGET(AccessAdmin, "/metrics")
+	c.expectOK(err)
+	t.Logf("%s", page)
+	// The counters of the other tests running in parallel may be flushed here as well.
+	for _, re := range []string{
+		`(?m)^syzbot_crashes_ingested_total\{namespace="test1"\} [1-9]`,
+		`(?m)^syzbot_crashes_ingested_total\{namespace="access-public-email"\} [1-9]`,
+		`(?m)^syzbot_discussion_messages_total\{source="lore"\} [1-9]`,
+		`(?m)^syzbot_emails_processed_total [1-9]`,
+		`(?m)^syzbot_reporting_emails_sent_total [1-9]`,
+		`(?m)^# TYPE syzbot_jobs gauge$`,
+	} {
+		if !regexp.MustCompile(re).Match(page) {
+			t.Errorf("no %q in the metrics", re)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Users may ask to minimize the reproducer of a bug once again (e.g. with "#syz minimize").
+// The request creates a JobMinimize job that syz-ci executes similarly to bisection jobs:
+// it reruns the reproduction and minimization procedure on the existing syz reproducer.
+// If the result is better than the current reproducer, it's saved as a new crash of the bug.
+
+// Minimization takes hours of VM time, so only one request per bug is accepted during this period.
+const minimizeCooldown = 3 * 24 * time.Hour
+
+type MinimizeDeniedError struct {
+	message string
+}
+
+func (e *MinimizeDeniedError) Error() string {
+	return e.message
+}
+
+// checkMinimizeRequest returns a non-empty reason if the bug can't be minimized now.
+func checkMinimizeRequest(bug *Bug, now time.Time) string {
+	switch {
+	case bug.Status != BugStatusOpen:
+		return "The bug is already closed."
+	case bug.ReproLevel == ReproLevelNone:
+		return "The bug has no reproducer to minimize."
+	case now.Sub(bug.MinimizeRequested) < minimizeCooldown:
+		return fmt.Sprintf("The reproducer minimization was already requested %v ago,"+
+			" the next request is possible in %v.",
+			now.Sub(bug.MinimizeRequested).Truncate(time.Minute),
+			bug.MinimizeRequested.Add(minimizeCooldown).Sub(now).Truncate(time.Minute))
+	}
+	return ""
+}
+
+func requestMinimization(c context.Context, bugKey *db.Key, user, link string) error {
+	bug := new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return fmt.Errorf("failed to get bug: %v", err)
+	}
+	now := timeNow(c)
+	if reason := checkMinimizeRequest(bug, now); reason != "" {
+		return &MinimizeDeniedError{reason}
+	}
+	crash, crashKey, err := findCrashForBug(c, bug)
+	if err != nil {
+		return err
+	}
+	if crash.ReproSyz == 0 {
+		return &MinimizeDeniedError{"The bug has no syz reproducer to minimize."}
+	}
+	build, err := loadBuild(c, bug.Namespace, crash.BuildID)
+	if err != nil {
+		return err
+	}
+	manager, _ := activeManager(crash.Manager, bug.Namespace)
+	job := &Job{
+		Type:         JobMinimize,
+		Created:      now,
+		User:         user,
+		Link:         link,
+		Namespace:    bug.Namespace,
+		Manager:      manager,
+		KernelRepo:   build.KernelRepo,
+		KernelBranch: build.KernelBranch,
+		BugTitle:     bug.displayTitle(),
+		CrashID:      crashKey.IntID(),
+		ReproLevel:   crash.reproLevel(),
+	}
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %v", err)
+		}
+		// Re-check in the transaction, we could have got 2 requests at the same time.
+		if reason := checkMinimizeRequest(bug, now); reason != "" {
+			return &MinimizeDeniedError{reason}
+		}
+		bug.MinimizeRequested = now
+		jobKey := db.NewIncompleteKey(c, "Job", bugKey)
+		jobKey, err := db.Put(c, jobKey, job)
+		if err != nil {
+			return fmt.Errorf("failed to put job: %v", err)
+		}
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %v", err)
+		}
+		return addCrashReference(c, job.CrashID, bugKey,
+			CrashReference{CrashReferenceJob, extJobID(jobKey), now})
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{XG: true, Attempts: 10})
+}
+
+// updateBugMinimization records the results of a minimization job, it's called in the doneJob transaction.
+func updateBugMinimization(c context.Context, job *Job, jobKey *db.Key, req *dashapi.JobDoneReq,
+	build *Build, now time.Time) error {
+	bug := new(Bug)
+	bugKey := jobKey.Parent()
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return fmt.Errorf("job %v: failed to get bug: %v", req.ID, err)
+	}
+	oldCrash := new(Crash)
+	if err := db.Get(c, db.NewKey(c, "Crash", "", job.CrashID, bugKey), oldCrash); err != nil {
+		return fmt.Errorf("job %v: failed to get crash: %v", req.ID, err)
+	}
+	level := ReproLevelNone
+	if len(req.ReproC) != 0 {
+		level = ReproLevelC
+	} else if len(req.ReproSyz) != 0 {
+		level = ReproLevelSyz
+	}
+	bug.NumRepro++
+	bug.LastReproTime = now
+	bug.LastReproManager = job.Manager
+	bug.LastReproOutcome = reproOutcomeForLevel(level)
+	if len(req.Error) != 0 {
+		bug.LastReproOutcome = ReproOutcomeError
+	}
+	if len(req.Error) == 0 && level != ReproLevelNone && build != nil {
+		oldRepro, _, err := getText(c, textReproSyz, oldCrash.ReproSyz)
+		if err != nil {
+			return err
+		}
+		if minimizationImproved(oldCrash.reproLevel(), level, len(oldRepro), len(req.ReproSyz)) {
+			if err := saveMinimizedCrash(c, bug, bugKey, oldCrash, build, req, now); err != nil {
+				return err
+			}
+			bug.LastReproSuccess = now
+			if bug.ReproLevel < level {
+				bug.ReproLevel = level
+			}
+			if bug.HeadReproLevel < level {
+				bug.HeadReproLevel = level
+			}
+			bug.updateReproRevoked()
+		}
+	}
+	if _, err := db.Put(c, bugKey, bug); err != nil {
+		return fmt.Errorf("failed to put bug: %v", err)
+	}
+	// The results are visible on the bug page, there's nothing to report.
+	job.Reported = true
+	return nil
+}
+
+// minimizationImproved checks whether the new reproducer is better than the old one:
+// either it has a higher repro level, or it is shorter.
+func minimizationImproved(oldLevel, newLevel dashapi.ReproLevel, oldLen, newLen int) bool {
+	return newLevel > oldLevel || newLevel == oldLevel && newLen < oldLen
+}
+
+func saveMinimizedCrash(c context.Context, bug *Bug, bugKey *db.Key, oldCrash *Crash, build *Build,
+	req *dashapi.JobDoneReq, now time.Time) error {
+	ns := bug.Namespace
+	crash := &Crash{
+		Title:          oldCrash.Title,
+		Manager:        build.Manager,
+		BuildID:        build.ID,
+		Time:           now,
+		Maintainers:    oldCrash.Maintainers,
+		Flags:          oldCrash.Flags,
+		ReportElements: oldCrash.ReportElements,
+		ReproOpts:      req.ReproOpts,
+	}
+	var err error
+	if crash.Log, crash.LogSize, err = putTextSize(c, ns, textCrashLog, req.CrashLog, false); err != nil {
+		return err
+	}
+	if crash.Report, err = putText(c, ns, textCrashReport, req.CrashReport, false); err != nil {
+		return err
+	}
+	if crash.ReproSyz, err = putText(c, ns, textReproSyz, req.ReproSyz, false); err != nil {
+		return err
+	}
+	if crash.ReproC, err = putText(c, ns, textReproC, req.ReproC, false); err != nil {
+		return err
+	}
+	crash.UpdateReportingPriority(build, bug)
+	if _, err := db.Put(c, db.NewIncompleteKey(c, "Crash", bugKey), crash); err != nil {
+		return fmt.Errorf("failed to put crash: %v", err)
+	}
+	return nil
+}
+
+// handleMinimize serves the "minimize" button on the bug page.
+func handleMinimize(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
+	if accessLevel < AccessUser {
+		return ErrAccess
+	}
+	if err := checkNamespaceAccessLevel(c, r, bug.Namespace, bug.sanitizeAccess(accessLevel)); err != nil {
+		return err
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	err = requestMinimization(c, bug.key(c), author, "")
+	if _, ok := err.(*MinimizeDeniedError); ok {
+		return fmt.Errorf("%v %w", err, ErrClientBadRequest)
+	} else if err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+type uiReproState struct {
+	BugID       string
+	Level       dashapi.ReproLevel
+	LastAttempt time.Time
+	Manager     string
+	Outcome     string
+	Requested   time.Time // set if a minimization request is not yet finished
+	CanMinimize bool
+	NextRequest time.Duration // set if minimization can't be requested due to the cooldown
+	// ParseError is set if the reproducer does not parse with the current descriptions.
+	ParseError string
+	// FocusUntil is set during the focused fuzzing of the bug (see focus.go).
+	FocusUntil time.Time
+	CanFocus   bool
+	// MinimizedConfig is the link to the minimized kernel config (see config_minimize.go),
+	// ConfigRequested is set if a config minimization request is not yet finished.
+	MinimizedConfig   string
+	ConfigRequested   time.Time
+	CanMinimizeConfig bool
+	// NoRepro is the number of developers who could not reproduce the bug (see norepro.go).
+	NoRepro int
+}
+
+func makeReproStateUI(bug *Bug, accessLevel AccessLevel, now time.Time) *uiReproState {
+	ui := &uiReproState{
+		BugID:       bug.keyHash(),
+		Level:       bug.ReproLevel,
+		LastAttempt: bug.LastReproTime,
+		Outcome:     string(bug.LastReproOutcome),
+	}
+	if accessLevel >= AccessUser {
+		ui.Manager = bug.LastReproManager
+	}
+	if bug.needsReproRegeneration() {
+		ui.ParseError = bug.ReproParseError
+	}
+	if bug.MinimizeRequested.After(bug.LastReproTime) {
+		ui.Requested = bug.MinimizeRequested
+	}
+	if accessLevel >= AccessUser {
+		if now.Sub(bug.MinimizeRequested) < minimizeCooldown {
+			ui.NextRequest = bug.MinimizeRequested.Add(minimizeCooldown).Sub(now)
+		}
+		ui.CanMinimize = checkMinimizeRequest(bug, now) == ""
+		ui.CanFocus = bug.ReproLevel != ReproLevelNone && checkFocusRequest(bug, now) == ""
+		ui.CanMinimizeConfig = checkConfigMinimizeRequest(bug, now) == ""
+	}
+	ui.MinimizedConfig = bug.MinimizedConfig
+	ui.NoRepro = len(bug.NoReproReports)
+	if bug.ConfigMinimizeRequested.After(bug.ConfigMinimizeFinished) {
+		ui.ConfigRequested = bug.ConfigMinimizeRequested
+	}
+	if bug.focused(now) {
+		ui.FocusUntil = bug.FocusUntil
+	}
+	return ui
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestCheckMinimizeRequest(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		bug    *Bug
+		denied bool
+	}{
+		{&Bug{Status: BugStatusOpen, ReproLevel: ReproLevelSyz}, false},
+		{&Bug{Status: BugStatusOpen, ReproLevel: ReproLevelC,
+			MinimizeRequested: now.Add(-minimizeCooldown)}, false},
+		{&Bug{Status: BugStatusOpen, ReproLevel: ReproLevelSyz,
+			MinimizeRequested: now.Add(-minimizeCooldown + time.Hour)}, true},
+		{&Bug{Status: BugStatusOpen, ReproLevel: ReproLevelNone}, true},
+		{&Bug{Status: BugStatusFixed, ReproLevel: ReproLevelSyz}, true},
+	}
+	for i, test := range tests {
+		if reason := checkMinimizeRequest(test.bug, now); (reason != "") != test.denied {
+			t.Errorf("test #%v: got %q, want denied=%v", i, reason, test.denied)
+		}
+	}
+	reason := checkMinimizeRequest(tests[2].bug, now)
+	if !strings.Contains(reason, "the next request is possible in 1h0m0s") {
+		t.Errorf("bad cooldown reason: %q", reason)
+	}
+}
+
+func TestMinimizationImproved(t *testing.T) {
+	tests := []struct {
+		oldLevel, newLevel dashapi.ReproLevel
+		oldLen, newLen     int
+		improved           bool
+	}{
+		{ReproLevelSyz, ReproLevelC, 100, 200, true},
+		{ReproLevelSyz, ReproLevelSyz, 300, 100, true},
+		{ReproLevelSyz, ReproLevelSyz, 100, 100, false},
+		{ReproLevelC, ReproLevelSyz, 300, 10, false},
+		{ReproLevelC, ReproLevelC, 300, 400, false},
+	}
+	for i, test := range tests {
+		got := minimizationImproved(test.oldLevel, test.newLevel, test.oldLen, test.newLen)
+		if got != test.improved {
+			t.Errorf("test #%v: got %v, want %v", i, got, test.improved)
+		}
+	}
+}
+
+func TestReproStateUI(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	bug := &Bug{
+		Namespace:         "test1",
+		Title:             "title1",
+		Status:            BugStatusOpen,
+		ReproLevel:        ReproLevelSyz,
+		LastReproTime:     now.Add(-48 * time.Hour),
+		LastReproManager:  "manager1",
+		LastReproOutcome:  ReproOutcomeSyz,
+		MinimizeRequested: now.Add(-time.Hour),
+	}
+	ui := makeReproStateUI(bug, AccessPublic, now)
+	if ui.Manager != "" || ui.CanMinimize || ui.NextRequest != 0 {
+		t.Errorf("private information is exposed: %+v", ui)
+	}
+	if ui.Outcome != "syz reproducer" || !ui.Requested.Equal(bug.MinimizeRequested) {
+		t.Errorf("bad public state: %+v", ui)
+	}
+	ui = makeReproStateUI(bug, AccessUser, now)
+	if ui.Manager != "manager1" || ui.CanMinimize || ui.NextRequest != minimizeCooldown-time.Hour {
+		t.Errorf("bad user state: %+v", ui)
+	}
+	ui = makeReproStateUI(bug, AccessUser, now.Add(minimizeCooldown))
+	if !ui.CanMinimize || ui.NextRequest != 0 {
+		t.Errorf("bad state after the cooldown: %+v", ui)
+	}
+	// The request has finished.
+	bug.LastReproTime = now
+	if ui := makeReproStateUI(bug, AccessUser, now); !ui.Requested.IsZero() {
+		t.Errorf("finished request is still shown: %+v", ui)
+	}
+}
+
+func TestMinimizeJob(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.makeClient(clientPublicEmail, keyPublicEmail, true)
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	crash.ReproOpts = []byte("repro opts")
+	crash.ReproSyz = []byte("getpid()\ngetpid()\nsyncfs(1)\n")
+	client.ReportCrash(crash)
+	sender := c.pollEmailBug().Sender
+	_, extID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	c.incomingEmail(sender, "#syz minimize\n", EmailOptFrom("dev@kernel.org"))
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "I've queued another attempt to minimize the reproducer."))
+
+	// The second request is denied due to the cooldown.
+	c.advanceTime(time.Hour)
+	c.incomingEmail(sender, "#syz minimize\n", EmailOptFrom("dev@kernel.org"))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "the next request is possible in 71h0m0s"))
+
+	// Minimization jobs are only given to managers that support them.
+	resp := client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{TestPatches: true})
+	c.expectEQ(resp.ID, "")
+	resp = client.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{Minimize: true})
+	c.expectNE(resp.ID, "")
+	c.expectEQ(resp.Type, dashapi.JobMinimize)
+	c.expectEQ(resp.ReproSyz, crash.ReproSyz)
+	c.expectEQ(resp.KernelCommit, build.KernelCommit)
+
+	page, err := c.AuthGET(AccessUser, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "minimization requested"))
+	c.expectTrue(!strings.Contains(string(page), "minimize again"))
+
+	jobBuild := testBuild(2)
+	jobBuild.ID = resp.ID
+	c.expectOK(client.JobDone(&dashapi.JobDoneReq{
+		ID:          resp.ID,
+		Build:       *jobBuild,
+		CrashTitle:  crash.Title,
+		CrashLog:    []byte("minimized log"),
+		CrashReport: []byte("minimized report"),
+		ReproOpts:   []byte("repro opts"),
+		ReproSyz:    []byte("syncfs(1)\n"),
+		ReproC:      []byte("int main() { syncfs(1); }"),
+	}))
+	bug, bestCrash, _ := c.loadBug(extID)
+	c.expectEQ(bug.ReproLevel, ReproLevelC)
+	c.expectEQ(bug.LastReproOutcome, ReproOutcomeC)
+	c.expectEQ(bug.LastReproManager, build.Manager)
+	c.expectNE(bestCrash.ReproC, int64(0))
+
+	// The better reproducer is reported.
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "syzbot has found a reproducer for the following issue"))
+
+	page, err = c.AuthGET(AccessUser, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "(C reproducer)"))
+	c.expectTrue(!strings.Contains(string(page), "minimization requested"))
+
+	// After the cooldown the request can be repeated from the bug page.
+	c.advanceTime(minimizeCooldown)
+	page, err = c.AuthGET(AccessUser, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "minimize again"))
+	_, err = c.AuthGET(AccessPublic, "/minimize?id="+bug.keyHash())
+	c.expectTrue(err != nil)
+	checkRedirect(c, AccessUser, "/minimize?id="+bug.keyHash(), bugLink(bug.keyHash()), http.StatusFound)
+	_, err = c.AuthGET(AccessUser, "/minimize?id="+bug.keyHash())
+	c.expectTrue(err != nil)
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	aemail "google.golang.org/appengine/v2/mail"
+)
+
+// Bugs in moderation reportings wait for a human decision: to upstream or to invalidate them.
+// Without a reminder some of them sit there for months. If a namespace has ModerationSLA,
+// the /ns/moderation page lists the bugs waiting for a decision with a green/yellow/red badge
+// depending on the time they've been waiting, and the namespace admins get a weekly email
+// with the bugs past the red threshold. The wait time is derived from the Reported time of the
+// current reporting, the time to decision is the time between Reported and Closed of a moderation
+// reporting; its median is shown on the bug stats page.
+
+const moderationDecisionStatsPeriod = 90 * 24 * time.Hour
+
+type moderationSLALevel string
+
+const (
+	moderationSLAGreen  moderationSLALevel = "green"
+	moderationSLAYellow moderationSLALevel = "yellow"
+	moderationSLARed    moderationSLALevel = "red"
+)
+
+func (cfg *ModerationSLAConfig) level(wait time.Duration) moderationSLALevel {
+	switch {
+	case wait >= cfg.Red:
+		return moderationSLARed
+	case wait >= cfg.Yellow:
+		return moderationSLAYellow
+	}
+	return moderationSLAGreen
+}
+
+// moderationWait returns the moderation reporting the open bug currently waits in, if any.
+func moderationWait(bug *Bug) (*BugReporting, *Reporting) {
+	if bug.Status != BugStatusOpen {
+		return nil, nil
+	}
+	for i := range bug.Reporting {
+		bugReporting := &bug.Reporting[i]
+		if !bugReporting.Closed.IsZero() {
+			continue
+		}
+		reporting := config.Namespaces[bug.Namespace].ReportingByName(bugReporting.Name)
+		if reporting == nil || !reporting.moderation || bugReporting.Reported.IsZero() {
+			return nil, nil
+		}
+		return bugReporting, reporting
+	}
+	return nil, nil
+}
+
+// moderationDecisions returns the times it took to take the decisions about the bug
+// in the moderation reportings. Only the decisions taken after since are considered.
+func moderationDecisions(bug *Bug, since time.Time) []time.Duration {
+	var ret []time.Duration
+	for i := range bug.Reporting {
+		bugReporting := &bug.Reporting[i]
+		if bugReporting.Dummy || bugReporting.Reported.IsZero() ||
+			bugReporting.Closed.IsZero() || bugReporting.Closed.Before(since) {
+			continue
+		}
+		reporting := config.Namespaces[bug.Namespace].ReportingByName(bugReporting.Name)
+		if reporting == nil || !reporting.moderation {
+			continue
+		}
+		ret = append(ret, bugReporting.Closed.Sub(bugReporting.Reported))
+	}
+	return ret
+}
+
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// moderationDecisionStats returns the median time to a moderation decision
+// over the last moderationDecisionStatsPeriod and the number of the decisions.
+func moderationDecisionStats(bugs []*Bug, now time.Time) (time.Duration, int) {
+	var decisions []time.Duration
+	for _, bug := range bugs {
+		decisions = append(decisions, moderationDecisions(bug, now.Add(-moderationDecisionStatsPeriod))...)
+	}
+	return medianDuration(decisions), len(decisions)
+}
+
+type uiModerationPage struct {
+	Header *uiHeader
+	Now    time.Time
+	Yellow time.Duration
+	Red    time.Duration
+	Bugs   []*uiModerationBug
+}
+
+type uiModerationBug struct {
+	Title     string
+	Link      string
+	Reporting string
+	Reported  time.Time
+	Wait      time.Duration
+	Level     moderationSLALevel
+}
+
+type moderationBug struct {
+	bug          *Bug
+	key          *db.Key
+	bugReporting *BugReporting
+	reporting    *Reporting
+	wait         time.Duration
+}
+
+// loadModerationQueue returns the bugs waiting for a moderation decision, the longest waiting first.
+func loadModerationQueue(c context.Context, ns string) ([]*moderationBug, error) {
+	bugs, keys, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("Status=", BugStatusOpen)
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := timeNow(c)
+	var ret []*moderationBug
+	for i, bug := range bugs {
+		bugReporting, reporting := moderationWait(bug)
+		if bugReporting == nil {
+			continue
+		}
+		ret = append(ret, &moderationBug{
+			bug:          bug,
+			key:          keys[i],
+			bugReporting: bugReporting,
+			reporting:    reporting,
+			wait:         now.Sub(bugReporting.Reported),
+		})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].wait > ret[j].wait
+	})
+	return ret, nil
+}
+
+func handleModerationQueue(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	hdr, err := commonHeader(c, r, w, "")
+	if err != nil {
+		return err
+	}
+	cfg := config.Namespaces[hdr.Namespace].ModerationSLA
+	if cfg == nil {
+		return fmt.Errorf("moderation SLA is not configured: %w", ErrClientNotFound)
+	}
+	queue, err := loadModerationQueue(c, hdr.Namespace)
+	if err != nil {
+		return err
+	}
+	accessLevel := namespaceAccessLevel(c, r, hdr.Namespace)
+	page := &uiModerationPage{
+		Header: hdr,
+		Now:    timeNow(c),
+		Yellow: cfg.Yellow,
+		Red:    cfg.Red,
+	}
+	for _, item := range queue {
+		if accessLevel < item.bug.sanitizeAccess(accessLevel) {
+			continue
+		}
+		page.Bugs = append(page.Bugs, &uiModerationBug{
+			Title:     item.bug.displayTitle(),
+			Link:      bugLink(item.key.StringID()),
+			Reporting: item.reporting.DisplayTitle,
+			Reported:  item.bugReporting.Reported,
+			Wait:      item.wait,
+			Level:     cfg.level(item.wait),
+		})
+	}
+	return serveTemplate(w, "moderation.html", page)
+}
+
+// handleModerationEscalations sends the weekly emails about the bugs past the red threshold.
+func handleModerationEscalations(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for ns, cfg := range config.Namespaces {
+		if cfg.ModerationSLA == nil || len(cfg.ModerationSLA.Emails) == 0 {
+			continue
+		}
+		if err := sendModerationEscalation(c, ns, cfg.ModerationSLA); err != nil {
+			log.Errorf(c, "failed to send moderation escalation for %v: %v", ns, err)
+		}
+	}
+}
+
+func sendModerationEscalation(c context.Context, ns string, cfg *ModerationSLAConfig) error {
+	queue, err := loadModerationQueue(c, ns)
+	if err != nil {
+		return err
+	}
+	body := new(strings.Builder)
+	count := 0
+	for _, item := range queue {
+		if cfg.level(item.wait) != moderationSLARed {
+			continue
+		}
+		count++
+		fmt.Fprintf(body, "%v\n  in %v for %v days\n  %v%v\n\n", item.bug.displayTitle(),
+			item.reporting.DisplayTitle, int(item.wait/(24*time.Hour)),
+			appURL(c), bugLink(item.key.StringID()))
+	}
+	if count == 0 {
+		return nil
+	}
+	fmt.Fprintf(body, "The full moderation queue: %v/%v/moderation\n", appURL(c), ns)
+	msg := &aemail.Message{
+		Sender: fromAddr(c),
+		To:     cfg.Emails,
+		Subject: fmt.Sprintf("[%v] %v %v waiting for a moderation decision for more than %v days",
+			ns, count, pluralize(int64(count), "bug is", "bugs are"), int(cfg.Red/(24*time.Hour))),
+		Body: body.String(),
+	}
+	log.Infof(c, "%v", msg.Subject)
+	return sendEmail(c, msg)
+}
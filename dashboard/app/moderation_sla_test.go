@@ -0,0 +1,113 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestModerationDecisionStats(t *testing.T) {
+	now := time.Date(2000, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	decided := func(reported, closed time.Duration) *Bug {
+		return &Bug{
+			Namespace: "test1",
+			Status:    BugStatusOpen,
+			Reporting: []BugReporting{
+				{Name: "reporting1", Reported: now.Add(-reported), Closed: now.Add(-closed)},
+				{Name: "reporting2", Reported: now.Add(-closed)},
+			},
+		}
+	}
+	bugs := []*Bug{
+		decided(10*day, 9*day),
+		decided(20*day, 10*day),
+		decided(40*day, 10*day),
+		// Decided too long ago.
+		decided(200*day, 100*day),
+		// Not decided yet.
+		{
+			Namespace: "test1",
+			Status:    BugStatusOpen,
+			Reporting: []BugReporting{
+				{Name: "reporting1", Reported: now.Add(-30 * day)},
+				{Name: "reporting2"},
+			},
+		},
+	}
+	median, count := moderationDecisionStats(bugs, now)
+	if median != 10*day || count != 3 {
+		t.Fatalf("got median %v over %v decisions", median, count)
+	}
+
+	bugReporting, reporting := moderationWait(bugs[4])
+	if bugReporting == nil || reporting.Name != "reporting1" {
+		t.Fatalf("the bug must wait in reporting1")
+	}
+	if bugReporting, _ := moderationWait(bugs[0]); bugReporting != nil {
+		t.Fatalf("the bug is not in moderation")
+	}
+
+	cfg := &ModerationSLAConfig{Yellow: 7 * day, Red: 14 * day}
+	for wait, want := range map[time.Duration]moderationSLALevel{
+		time.Hour:            moderationSLAGreen,
+		7*day - time.Second:  moderationSLAGreen,
+		7 * day:              moderationSLAYellow,
+		14*day - time.Second: moderationSLAYellow,
+		14 * day:             moderationSLARed,
+		100 * day:            moderationSLARed,
+	} {
+		if got := cfg.level(wait); got != want {
+			t.Errorf("wait %v: got %v, want %v", wait, got, want)
+		}
+	}
+}
+
+func TestModerationSLA(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	rep1 := c.client.pollBug()
+	c.advanceTime(8 * 24 * time.Hour)
+	c.client.ReportCrash(testCrash(build, 2))
+	c.client.pollBug()
+
+	page, err := c.AuthGET(AccessAdmin, "/test1/moderation")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(`<span class="sla sla-yellow">yellow</span>`)))
+	c.expectTrue(bytes.Contains(page, []byte(`<span class="sla sla-green">green</span>`)))
+
+	// Nothing is escalated until a bug is past the red threshold.
+	_, err = c.GET("/cron/moderation_escalations")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 0)
+
+	c.advanceTime(7 * 24 * time.Hour)
+	_, err = c.GET("/cron/moderation_escalations")
+	c.expectOK(err)
+	c.expectEQ(len(c.emailSink), 1)
+	msg := <-c.emailSink
+	c.expectEQ(msg.To, []string{"moderators@test.com"})
+	c.expectEQ(msg.Subject, "[test1] 1 bug is waiting for a moderation decision for more than 14 days")
+	c.expectTrue(strings.Contains(msg.Body, "title1\n  in reporting1 for 15 days\n"))
+	c.expectTrue(!strings.Contains(msg.Body, "title2"))
+
+	// Once the decision is taken, the bug leaves the queue and counts towards the stats.
+	c.client.updateBug(rep1.ID, dashapi.BugStatusUpstream, "")
+	page, err = c.AuthGET(AccessAdmin, "/test1/moderation")
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("title1")))
+	page, err = c.AuthGET(AccessAdmin, "/test1/bug-stats")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Median time to moderation decision over the last 90 days: "+
+		"360h0m0s (1 decisions)")))
+}
@@ -0,0 +1,291 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// A new namespace (e.g. for a new kernel tree) can be bootstrapped from an existing one.
+// The bootstrap seeds the new namespace with the open bugs of the source namespace that
+// were already known at the branch point. The seeded bugs are "inherited": crashes of the new
+// namespace are attached to them by their titles, but they are not reported until they get
+// a reproducer in the new namespace, see needReport.
+
+const (
+	namespaceBootstrapChunkSize  = 100
+	namespaceBootstrapTimeBudget = 5 * time.Minute
+)
+
+func handleBootstrapNamespaceAction(c context.Context, r *http.Request) error {
+	var branchPoint time.Time
+	if branch := r.FormValue("branch"); branch != "" {
+		var err error
+		branchPoint, err = time.Parse("2006-01-02", branch)
+		if err != nil {
+			return fmt.Errorf("%w: failed to parse branch point %q: %v", ErrClientBadRequest, branch, err)
+		}
+	}
+	author := ""
+	if u := user.Current(c); u != nil {
+		author = u.Email
+	}
+	return startNamespaceBootstrap(c, r.FormValue("from"), r.FormValue("to"), branchPoint, author)
+}
+
+// startNamespaceBootstrap creates a bootstrap manifest that is then processed by the cron job.
+// The zero branchPoint means that all open bugs of the source namespace are inherited.
+func startNamespaceBootstrap(c context.Context, source, target string, branchPoint time.Time, author string) error {
+	if config.Namespaces[source] == nil {
+		return fmt.Errorf("%w: unknown namespace %q", ErrClientBadRequest, source)
+	}
+	if config.Namespaces[target] == nil {
+		return fmt.Errorf("%w: unknown namespace %q", ErrClientBadRequest, target)
+	}
+	if source == target {
+		return fmt.Errorf("%w: can't bootstrap %q from itself", ErrClientBadRequest, target)
+	}
+	key := db.NewKey(c, "NamespaceBootstrap", target, 0, nil)
+	bootstrap := &NamespaceBootstrap{
+		Source:      source,
+		Target:      target,
+		BranchPoint: branchPoint,
+		User:        author,
+		Started:     timeNow(c),
+	}
+	tx := func(c context.Context) error {
+		prev := new(NamespaceBootstrap)
+		if err := db.Get(c, key, prev); err == nil {
+			if prev.Finished.IsZero() {
+				return fmt.Errorf("%w: %q is already being bootstrapped since %v",
+					ErrClientBadRequest, target, prev.Started)
+			}
+		} else if err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get the bootstrap: %w", err)
+		}
+		if _, err := db.Put(c, key, bootstrap); err != nil {
+			return fmt.Errorf("failed to save the bootstrap: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return err
+	}
+	log.Infof(c, "%v: bootstrap from %v started by %v", target, source, author)
+	return nil
+}
+
+func handleBootstrapNamespaces(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	var bootstraps []*NamespaceBootstrap
+	keys, err := db.NewQuery("NamespaceBootstrap").
+		Filter("Finished=", time.Time{}).
+		GetAll(c, &bootstraps)
+	if err != nil {
+		log.Errorf(c, "failed to query bootstraps: %v", err)
+		return
+	}
+	for start := time.Now(); len(keys) != 0 && time.Since(start) < namespaceBootstrapTimeBudget; {
+		more, err := bootstrapNamespaceChunk(c, keys[0], namespaceBootstrapChunkSize)
+		if err != nil {
+			log.Errorf(c, "%v: bootstrap failed: %v", keys[0].StringID(), err)
+			return
+		}
+		if !more {
+			keys = keys[1:]
+		}
+	}
+}
+
+// bootstrapNamespaceChunk continues the unfinished bootstrap from its cursor.
+// It returns whether there is more work to do.
+func bootstrapNamespaceChunk(c context.Context, key *db.Key, chunkSize int) (bool, error) {
+	bootstrap := new(NamespaceBootstrap)
+	if err := db.Get(c, key, bootstrap); err != nil {
+		return false, fmt.Errorf("failed to get the bootstrap: %w", err)
+	}
+	if !bootstrap.Finished.IsZero() {
+		return false, nil
+	}
+	query := db.NewQuery("Bug").
+		Filter("Namespace=", bootstrap.Source).
+		Filter("Status=", BugStatusOpen).
+		Limit(chunkSize)
+	if bootstrap.Cursor != "" {
+		cursor, err := db.DecodeCursor(bootstrap.Cursor)
+		if err != nil {
+			return false, fmt.Errorf("failed to decode cursor: %w", err)
+		}
+		query = query.Start(cursor)
+	}
+	count, seeded := 0, 0
+	iter := query.Run(c)
+	for {
+		bug := new(Bug)
+		_, err := iter.Next(bug)
+		if err == db.Done {
+			break
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch bugs: %w", err)
+		}
+		count++
+		if !bootstrap.inherits(bug) {
+			continue
+		}
+		created, err := seedInheritedBug(c, bootstrap.Target, bug)
+		if err != nil {
+			return false, err
+		}
+		if created {
+			seeded++
+		}
+	}
+	cursor, err := iter.Cursor()
+	if err != nil {
+		return false, fmt.Errorf("failed to get cursor: %w", err)
+	}
+	prevCursor := bootstrap.Cursor
+	tx := func(c context.Context) error {
+		if err := db.Get(c, key, bootstrap); err != nil {
+			return fmt.Errorf("failed to get the bootstrap: %w", err)
+		}
+		if bootstrap.Cursor != prevCursor {
+			return fmt.Errorf("the bootstrap was advanced concurrently")
+		}
+		bootstrap.Processed += count
+		bootstrap.Seeded += seeded
+		bootstrap.Cursor = cursor.String()
+		if count < chunkSize {
+			bootstrap.Finished = timeNow(c)
+		}
+		_, err := db.Put(c, key, bootstrap)
+		return err
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return false, err
+	}
+	return bootstrap.Finished.IsZero(), nil
+}
+
+// inherits returns whether the source namespace bug was already known at the branch point.
+func (bootstrap *NamespaceBootstrap) inherits(bug *Bug) bool {
+	if bug.NumCrashes == 0 {
+		// The bug was itself inherited and has never happened in the source namespace.
+		return false
+	}
+	return bootstrap.BranchPoint.IsZero() || bug.FirstTime.Before(bootstrap.BranchPoint)
+}
+
+// seedInheritedBug creates an inherited copy of the src bug in the target namespace,
+// unless there's already an active bug with the same title.
+func seedInheritedBug(c context.Context, target string, src *Bug) (bool, error) {
+	if bug, err := findExistingBugForCrash(c, target, []string{src.Title}); err != nil || bug != nil {
+		return false, err
+	}
+	now := timeNow(c)
+	var created *Bug
+	tx := func(c context.Context) error {
+		created = nil
+		for seq := int64(0); ; seq++ {
+			bug := new(Bug)
+			bugKey := db.NewKey(c, "Bug", bugKeyHash(target, src.Title, seq), 0, nil)
+			if err := db.Get(c, bugKey, bug); err != nil {
+				if err != db.ErrNoSuchEntity {
+					return fmt.Errorf("failed to get bug: %w", err)
+				}
+				bug = &Bug{
+					Namespace:      target,
+					Seq:            seq,
+					Title:          src.Title,
+					MergedTitles:   src.MergedTitles,
+					AltTitles:      src.AltTitles,
+					Status:         BugStatusOpen,
+					ReproLevel:     ReproLevelNone,
+					FirstTime:      now,
+					LastTime:       now,
+					SubsystemsTime: now,
+					InheritedFrom:  src.keyHash(),
+				}
+				if len(bug.MergedTitles) == 0 {
+					bug.MergedTitles = []string{src.Title}
+				}
+				if err := bug.updateReportings(config.Namespaces[target], now); err != nil {
+					return err
+				}
+				if _, err := db.Put(c, bugKey, bug); err != nil {
+					return fmt.Errorf("failed to put new bug: %w", err)
+				}
+				created = bug
+				return nil
+			}
+			canon, err := canonicalBug(c, bug)
+			if err != nil {
+				return err
+			}
+			if canon.Status == BugStatusOpen {
+				return nil
+			}
+		}
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{
+		XG:       true,
+		Attempts: 10,
+	}); err != nil {
+		return false, err
+	}
+	if created == nil {
+		return false, nil
+	}
+	forgetReportingIDs(c, created)
+	return true, nil
+}
+
+// waitsForLocalRepro returns whether the inherited bug is not yet known to happen in its own namespace.
+func (bug *Bug) waitsForLocalRepro() bool {
+	return bug.InheritedFrom != "" && bug.ReproLevel == ReproLevelNone
+}
+
+type uiNamespaceBootstrap struct {
+	Source      string
+	Target      string
+	BranchPoint time.Time
+	User        string
+	Started     time.Time
+	Finished    time.Time
+	Processed   int
+	Seeded      int
+}
+
+func loadNamespaceBootstrapsUI(c context.Context) ([]*uiNamespaceBootstrap, error) {
+	var bootstraps []*NamespaceBootstrap
+	_, err := db.NewQuery("NamespaceBootstrap").
+		Order("-Started").
+		GetAll(c, &bootstraps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bootstraps: %w", err)
+	}
+	var ret []*uiNamespaceBootstrap
+	for _, bootstrap := range bootstraps {
+		ret = append(ret, &uiNamespaceBootstrap{
+			Source:      bootstrap.Source,
+			Target:      bootstrap.Target,
+			BranchPoint: bootstrap.BranchPoint,
+			User:        bootstrap.User,
+			Started:     bootstrap.Started,
+			Finished:    bootstrap.Finished,
+			Processed:   bootstrap.Processed,
+			Seeded:      bootstrap.Seeded,
+		})
+	}
+	return ret, nil
+}
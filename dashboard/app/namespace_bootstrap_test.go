@@ -0,0 +1,88 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestNamespaceBootstrap(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build2 := testBuild(2)
+	c.client2.UploadBuild(build2)
+	crash1 := testCrash(build2, 1)
+	c.client2.ReportCrash(crash1)
+	c.client2.pollEmailBug()
+	c.client2.ReportCrash(testCrash(build2, 2))
+	c.client2.pollEmailBug()
+
+	// The bug is already known in the new namespace.
+	build1 := testBuild(1)
+	c.client.UploadBuild(build1)
+	c.client.ReportCrash(testCrash(build1, 2))
+	c.client.pollBug()
+
+	// The bug appeared after the branch point.
+	c.advanceTime(48 * time.Hour)
+	branch := timeNow(c.ctx).Format("2006-01-02")
+	c.client2.ReportCrash(testCrash(build2, 3))
+	c.client2.pollEmailBug()
+
+	_, err := c.AuthGET(AccessAdmin, "/admin?action=bootstrap_namespace&from=test2&to=test1&branch="+branch)
+	c.expectOK(err)
+	// Only one bootstrap of a namespace may run at a time.
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=bootstrap_namespace&from=test2&to=test1")
+	c.expectBadReqest(err)
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=bootstrap_namespace&from=test1&to=test1")
+	c.expectBadReqest(err)
+
+	key := db.NewKey(c.ctx, "NamespaceBootstrap", "test1", 0, nil)
+	chunks := 0
+	for more := true; more; chunks++ {
+		more, err = bootstrapNamespaceChunk(c.ctx, key, 1)
+		c.expectOK(err)
+	}
+	c.expectEQ(chunks, 4)
+	bootstraps, err := loadNamespaceBootstrapsUI(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(bootstraps), 1)
+	c.expectEQ(bootstraps[0].Processed, 3)
+	c.expectEQ(bootstraps[0].Seeded, 1)
+	c.expectTrue(!bootstraps[0].Finished.IsZero())
+
+	inherited := new(Bug)
+	c.expectOK(db.Get(c.ctx, db.NewKey(c.ctx, "Bug", bugKeyHash("test1", crash1.Title, 0), 0, nil), inherited))
+	c.expectEQ(inherited.Status, BugStatusOpen)
+	c.expectEQ(inherited.NumCrashes, int64(0))
+	c.expectTrue(inherited.InheritedFrom != "")
+
+	// Crashes are attached to the inherited bug, but it's not reported without a repro.
+	c.client.ReportCrash(testCrash(build1, 1))
+	c.client.pollBugs(0)
+	c.expectOK(db.Get(c.ctx, inherited.key(c.ctx), inherited))
+	c.expectEQ(inherited.NumCrashes, int64(1))
+
+	c.client.ReportCrash(testCrashWithRepro(build1, 1))
+	rep := c.client.pollBug()
+	c.expectEQ(rep.Title, crash1.Title)
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bug.keyHash(), inherited.keyHash())
+
+	// Restarting without the branch point only seeds the missing bugs.
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=bootstrap_namespace&from=test2&to=test1")
+	c.expectOK(err)
+	for more := true; more; {
+		more, err = bootstrapNamespaceChunk(c.ctx, key, 10)
+		c.expectOK(err)
+	}
+	bootstraps, err = loadNamespaceBootstrapsUI(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(bootstraps[0].Processed, 3)
+	c.expectEQ(bootstraps[0].Seeded, 1)
+}
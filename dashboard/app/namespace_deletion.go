@@ -0,0 +1,854 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Once a namespace is decommissioned (e.g. a partner stops using the instance), all its data
+// may need to be deleted. An admin requests the deletion on the admin page and then confirms it
+// with the generated token. The confirmed deletion is processed by the cron job in batches:
+// each phase deletes one entity kind (with all descendants, e.g. bug crashes and jobs) using
+// a query cursor, and the progress is saved in the NamespaceDeletion entity after each batch,
+// so the deletion continues where it stopped after any interruption.
+// Discussions that reference only the namespace bugs are deleted (together with the aliases
+// and the merge proposals that refer to them), others just lose the references.
+// The saved views of the namespace are removed from the views of all users.
+// The entities that refer to the bugs only by the bug key (see namespaceBugKinds) are deleted
+// together with the bugs.
+// The build and crash assets stop being listed as needed once the entities are deleted,
+// and the asset storage (pkg/asset) of syz-ci then removes the blobs.
+// Finally, the verification pass counts the entities that still reference the namespace
+// and the bug-keyed entities whose bugs no longer exist.
+// The deletion refuses to run if the namespace is not marked as Decommissioned.
+
+const (
+	namespaceDeletionBatchSize  = 20
+	namespaceDeletionTimeBudget = 5 * time.Minute
+	namespaceDeletionTokenTTL   = time.Hour
+)
+
+type namespaceDeletionKind struct {
+	name        string
+	field       string // the indexed field that holds the namespace
+	descendants bool   // whether the entities have children that need to be deleted as well
+}
+
+// namespaceDeletionKinds are the entity kinds that reference namespaces,
+// entities of all other kinds are either descendants of these or are not namespace-specific.
+var namespaceDeletionKinds = []namespaceDeletionKind{
+	{"Bug", "Namespace", true},
+	{"Build", "Namespace", false},
+	{"Manager", "Namespace", true},
+	{"Subsystem", "Namespace", true},
+	{"CommitWatch", "Namespace", false},
+	{"BugShareLink", "Namespace", false},
+	{"BulkBugUpdate", "Namespace", false},
+	{"Subscription", "Namespace", false},
+	{"PatchworkPoll", "Namespace", false},
+	{"NamespaceRole", "Namespace", false},
+	{"CorpusImport", "Namespace", false},
+	{"CorpusImport", "SourceNamespace", false},
+	{"ReportingPause", "Namespace", false},
+	{"BugListing", "Namespace", false},
+	{"TopCrashersSnapshot", "Namespace", false},
+	{"FixTimeStats", "Namespace", false},
+	{"ReportExperimentStats", "Namespace", false},
+	{"StorageUsage", "Namespace", false},
+	{"LowSeverityDigest", "Namespace", false},
+	{"NamespaceBootstrap", "Source", false},
+	{"NamespaceBootstrap", "Target", false},
+	{"EmailAttachment", "Namespace", false},
+	{textCrashLog, "Namespace", false},
+	{textCrashReport, "Namespace", false},
+	{textReproSyz, "Namespace", false},
+	{textReproC, "Namespace", false},
+	{textMachineInfo, "Namespace", false},
+	{textKernelConfig, "Namespace", false},
+	{textVMConfig, "Namespace", false},
+	{textPatch, "Namespace", false},
+	{textLog, "Namespace", false},
+	{textError, "Namespace", false},
+	{textDiscussionExport, "Namespace", false},
+}
+
+// namespaceBugKinds are the entity kinds that reference bugs by the bug key (the field),
+// but don't record the namespace.
+var namespaceBugKinds = []namespaceDeletionKind{
+	{"PendingSummaryDelta", "Bug", false},
+	{"DiscussionMismatch", "BugKey", false},
+}
+
+// namespaceDeletionBatch is the result of one deletion step.
+type namespaceDeletionBatch struct {
+	deleted  map[string]int
+	assets   int
+	detached int
+	cursor   string
+	done     bool
+}
+
+type namespaceDeletionPhase struct {
+	name string
+	run  func(c context.Context, ns, cursor string, batchSize int) (*namespaceDeletionBatch, error)
+}
+
+// namespaceDeletionPhases first delete the entities that refer to others (e.g. bugs refer
+// to builds and texts), so that the namespace stays consistent while the deletion is running.
+func namespaceDeletionPhases() []namespaceDeletionPhase {
+	var phases []namespaceDeletionPhase
+	for _, kind := range namespaceDeletionKinds {
+		kind := kind
+		name := kind.name
+		if kind.field != "Namespace" {
+			name += "." + kind.field
+		}
+		phases = append(phases, namespaceDeletionPhase{name, func(c context.Context, ns, cursor string,
+			batchSize int) (*namespaceDeletionBatch, error) {
+			return deleteNamespaceKind(c, kind, ns, cursor, batchSize)
+		}})
+	}
+	return append(phases,
+		namespaceDeletionPhase{"saved views", deleteNamespaceSavedViews},
+		namespaceDeletionPhase{"counters", deleteNamespaceCounters})
+}
+
+func handleNamespaceDeletionAction(c context.Context, r *http.Request, confirm bool) error {
+	by := "admin"
+	if u := user.Current(c); u != nil {
+		by = u.Email
+	}
+	if confirm {
+		return confirmNamespaceDeletion(c, r.FormValue("ns"), r.FormValue("token"), by)
+	}
+	_, err := requestNamespaceDeletion(c, r.FormValue("ns"), by)
+	return err
+}
+
+func namespaceDeletionKey(c context.Context, ns string) *db.Key {
+	return db.NewKey(c, "NamespaceDeletion", ns, 0, nil)
+}
+
+// requestNamespaceDeletion creates a new deletion of the namespace and returns the confirmation token.
+func requestNamespaceDeletion(c context.Context, ns, by string) (string, error) {
+	if cfg := config.Namespaces[ns]; cfg == nil {
+		return "", fmt.Errorf("%w: unknown namespace %q", ErrClientBadRequest, ns)
+	} else if !cfg.Decommissioned {
+		return "", fmt.Errorf("%w: namespace %q is not decommissioned", ErrClientBadRequest, ns)
+	}
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate the token: %w", err)
+	}
+	deletion := &NamespaceDeletion{
+		Namespace:   ns,
+		Token:       hex.EncodeToString(raw),
+		RequestedBy: by,
+		Requested:   timeNow(c),
+	}
+	key := namespaceDeletionKey(c, ns)
+	tx := func(c context.Context) error {
+		prev := new(NamespaceDeletion)
+		if err := db.Get(c, key, prev); err == nil {
+			if !prev.Confirmed.IsZero() && prev.Finished.IsZero() {
+				return fmt.Errorf("%w: %q is already being deleted since %v",
+					ErrClientBadRequest, ns, prev.Confirmed)
+			}
+		} else if err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get the deletion: %w", err)
+		}
+		if _, err := db.Put(c, key, deletion); err != nil {
+			return fmt.Errorf("failed to save the deletion: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return "", err
+	}
+	log.Warningf(c, "%v: deletion requested by %v", ns, by)
+	return deletion.Token, nil
+}
+
+func confirmNamespaceDeletion(c context.Context, ns, token, by string) error {
+	if cfg := config.Namespaces[ns]; cfg == nil || !cfg.Decommissioned {
+		return fmt.Errorf("%w: namespace %q is not decommissioned", ErrClientBadRequest, ns)
+	}
+	now := timeNow(c)
+	key := namespaceDeletionKey(c, ns)
+	tx := func(c context.Context) error {
+		deletion := new(NamespaceDeletion)
+		if err := db.Get(c, key, deletion); err == db.ErrNoSuchEntity {
+			return fmt.Errorf("%w: the deletion of %q was not requested", ErrClientBadRequest, ns)
+		} else if err != nil {
+			return fmt.Errorf("failed to get the deletion: %w", err)
+		}
+		if !deletion.Confirmed.IsZero() {
+			return fmt.Errorf("%w: the deletion of %q is already confirmed", ErrClientBadRequest, ns)
+		}
+		if token == "" || token != deletion.Token {
+			return fmt.Errorf("%w: wrong confirmation token", ErrClientBadRequest)
+		}
+		if now.Sub(deletion.Requested) > namespaceDeletionTokenTTL {
+			return fmt.Errorf("%w: the confirmation token has expired, request the deletion again",
+				ErrClientBadRequest)
+		}
+		deletion.Token = ""
+		deletion.ConfirmedBy = by
+		deletion.Confirmed = now
+		deletion.Updated = now
+		if _, err := db.Put(c, key, deletion); err != nil {
+			return fmt.Errorf("failed to save the deletion: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return err
+	}
+	log.Criticalf(c, "%v: deletion confirmed by %v", ns, by)
+	return nil
+}
+
+func handleNamespaceDeletions(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	keys, err := db.NewQuery("NamespaceDeletion").
+		Filter("Finished=", time.Time{}).
+		KeysOnly().
+		GetAll(c, nil)
+	if err != nil {
+		log.Errorf(c, "failed to query namespace deletions: %v", err)
+		return
+	}
+	for start := time.Now(); len(keys) != 0 && time.Since(start) < namespaceDeletionTimeBudget; {
+		more, err := namespaceDeletionStep(c, keys[0], namespaceDeletionBatchSize)
+		if err != nil {
+			log.Errorf(c, "%v: deletion failed: %v", keys[0].StringID(), err)
+		}
+		if !more || err != nil {
+			keys = keys[1:]
+		}
+	}
+}
+
+// namespaceDeletionStep processes the next batch of the confirmed deletion.
+// It returns whether there is more work to do.
+func namespaceDeletionStep(c context.Context, key *db.Key, batchSize int) (bool, error) {
+	deletion := new(NamespaceDeletion)
+	if err := db.Get(c, key, deletion); err != nil {
+		return false, fmt.Errorf("failed to get the deletion: %w", err)
+	}
+	if deletion.Confirmed.IsZero() || !deletion.Finished.IsZero() {
+		return false, nil
+	}
+	ns := deletion.Namespace
+	phases := namespaceDeletionPhases()
+	prevPhase, prevCursor := deletion.Phase, deletion.Cursor
+	update := func(fn func(deletion *NamespaceDeletion)) error {
+		tx := func(c context.Context) error {
+			if err := db.Get(c, key, deletion); err != nil {
+				return fmt.Errorf("failed to get the deletion: %w", err)
+			}
+			if deletion.Phase != prevPhase || deletion.Cursor != prevCursor {
+				return fmt.Errorf("the deletion was advanced concurrently")
+			}
+			fn(deletion)
+			deletion.Updated = timeNow(c)
+			_, err := db.Put(c, key, deletion)
+			return err
+		}
+		return db.RunInTransaction(c, tx, nil)
+	}
+	// A namespace may be also removed from the config once it's decommissioned.
+	if cfg := config.Namespaces[ns]; cfg != nil && !cfg.Decommissioned {
+		err := fmt.Errorf("namespace %q is not decommissioned", ns)
+		if updateErr := update(func(deletion *NamespaceDeletion) {
+			deletion.Error = err.Error()
+		}); updateErr != nil {
+			return false, updateErr
+		}
+		return false, err
+	}
+	if deletion.Phase >= len(phases) {
+		remaining, err := verifyNamespaceDeletion(c, ns)
+		if err != nil {
+			return false, err
+		}
+		if err := update(func(deletion *NamespaceDeletion) {
+			deletion.Remaining = remaining
+			deletion.Error = ""
+			deletion.Finished = timeNow(c)
+		}); err != nil {
+			return false, err
+		}
+		if len(remaining) != 0 {
+			log.Errorf(c, "%v: entities remain after the deletion: %+v", ns, remaining)
+		} else {
+			log.Infof(c, "%v: the deletion has finished", ns)
+		}
+		return false, nil
+	}
+	res, err := phases[deletion.Phase].run(c, ns, deletion.Cursor, batchSize)
+	if err != nil {
+		return false, fmt.Errorf("phase %v: %w", phases[deletion.Phase].name, err)
+	}
+	if err := update(func(deletion *NamespaceDeletion) {
+		for kind, count := range res.deleted {
+			deletion.Deleted = addNamespaceDeletionCount(deletion.Deleted, kind, count)
+		}
+		deletion.Assets += res.assets
+		deletion.Detached += res.detached
+		deletion.Error = ""
+		deletion.Cursor = res.cursor
+		if res.done {
+			deletion.Phase++
+			deletion.Cursor = ""
+		}
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func addNamespaceDeletionCount(counts []NamespaceDeletionCount, kind string, count int) []NamespaceDeletionCount {
+	for i := range counts {
+		if counts[i].Kind == kind {
+			counts[i].Count += count
+			return counts
+		}
+	}
+	counts = append(counts, NamespaceDeletionCount{kind, count})
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Kind < counts[j].Kind })
+	return counts
+}
+
+// deleteNamespaceKind deletes the next batch of the namespace entities of the kind.
+func deleteNamespaceKind(c context.Context, kind namespaceDeletionKind, ns, cursor string,
+	batchSize int) (*namespaceDeletionBatch, error) {
+	query := db.NewQuery(kind.name).
+		Filter(kind.field+"=", ns).
+		KeysOnly().
+		Limit(batchSize)
+	if cursor != "" {
+		cursor, err := db.DecodeCursor(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode cursor: %w", err)
+		}
+		query = query.Start(cursor)
+	}
+	var keys []*db.Key
+	iter := query.Run(c)
+	for {
+		key, err := iter.Next(nil)
+		if err == db.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %v: %w", kind.name, err)
+		}
+		keys = append(keys, key)
+	}
+	next, err := iter.Cursor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor: %w", err)
+	}
+	res := &namespaceDeletionBatch{
+		deleted: make(map[string]int),
+		cursor:  next.String(),
+		done:    len(keys) < batchSize,
+	}
+	var all []*db.Key
+	if kind.name == "Bug" {
+		for _, key := range keys {
+			if err := detachBugDiscussions(c, key, res); err != nil {
+				return nil, err
+			}
+			for _, bugKind := range namespaceBugKinds {
+				refs, err := db.NewQuery(bugKind.name).
+					Filter(bugKind.field+"=", key.StringID()).
+					KeysOnly().
+					GetAll(c, nil)
+				if err != nil {
+					return nil, fmt.Errorf("failed to query %v: %w", bugKind.name, err)
+				}
+				all = append(all, refs...)
+			}
+		}
+	}
+	for _, key := range keys {
+		if kind.descendants {
+			children, err := db.NewQuery("").
+				Ancestor(key).
+				KeysOnly().
+				GetAll(c, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to query descendants of %v: %w", key, err)
+			}
+			for _, child := range children {
+				if !child.Equal(key) {
+					all = append(all, child)
+				}
+			}
+		}
+		all = append(all, key)
+	}
+	if res.assets, err = countEntityAssets(c, all); err != nil {
+		return nil, err
+	}
+	if err := dropEntities(c, all, false); err != nil {
+		return nil, fmt.Errorf("failed to delete %v: %w", kind.name, err)
+	}
+	for _, key := range all {
+		res.deleted[key.Kind()]++
+	}
+	return res, nil
+}
+
+// detachBugDiscussions removes the bug from its discussions, the discussions
+// that are left without bugs are deleted.
+func detachBugDiscussions(c context.Context, bugKey *db.Key, res *namespaceDeletionBatch) error {
+	keys, err := db.NewQuery("Discussion").
+		Filter("BugKeys=", bugKey.StringID()).
+		KeysOnly().
+		GetAll(c, nil)
+	if err != nil {
+		return fmt.Errorf("failed to query discussions: %w", err)
+	}
+	for _, key := range keys {
+		deleted := false
+		d := new(Discussion)
+		tx := func(c context.Context) error {
+			if err := db.Get(c, key, d); err != nil {
+				return fmt.Errorf("failed to get discussion: %w", err)
+			}
+			d.detachBug(bugKey.StringID())
+			if deleted = len(d.BugKeys) == 0; deleted {
+				return db.Delete(c, key)
+			}
+			_, err := db.Put(c, key, d)
+			return err
+		}
+		if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+			return fmt.Errorf("failed to update discussion %v: %w", key.StringID(), err)
+		}
+		if !deleted {
+			res.detached++
+			continue
+		}
+		res.deleted["Discussion"]++
+		candidates, err := deleteDiscussionMergeCandidates(c, d.Source, d.ID)
+		if err != nil {
+			return err
+		}
+		res.deleted["DiscussionMergeCandidate"] += candidates
+		aliases, err := deleteDiscussionAliases(c, d.Source, d.ID, maxDiscussionAliasChain)
+		if err != nil {
+			return err
+		}
+		res.deleted["DiscussionAlias"] += aliases
+	}
+	return nil
+}
+
+// deleteDiscussionAliases deletes the aliases that lead to the discussion,
+// including the aliases of the discussions that were merged in several steps.
+func deleteDiscussionAliases(c context.Context, source, id string, depth int) (int, error) {
+	if depth == 0 {
+		return 0, nil
+	}
+	var aliases []*DiscussionAlias
+	keys, err := db.NewQuery("DiscussionAlias").
+		Filter("Source=", source).
+		Filter("TargetID=", id).
+		GetAll(c, &aliases)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query discussion aliases: %w", err)
+	}
+	if err := db.DeleteMulti(c, keys); err != nil {
+		return 0, fmt.Errorf("failed to delete discussion aliases: %w", err)
+	}
+	count := len(keys)
+	for _, alias := range aliases {
+		deleted, err := deleteDiscussionAliases(c, source, alias.ID, depth-1)
+		if err != nil {
+			return 0, err
+		}
+		count += deleted
+	}
+	return count, nil
+}
+
+// deleteDiscussionMergeCandidates deletes the merge proposals that involve the discussion.
+func deleteDiscussionMergeCandidates(c context.Context, source, id string) (int, error) {
+	var keys []*db.Key
+	for _, field := range []string{"FromID", "ToID"} {
+		fieldKeys, err := db.NewQuery("DiscussionMergeCandidate").
+			Filter("Source=", source).
+			Filter(field+"=", id).
+			KeysOnly().
+			GetAll(c, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to query merge candidates: %w", err)
+		}
+		keys = append(keys, fieldKeys...)
+	}
+	if err := db.DeleteMulti(c, keys); err != nil {
+		return 0, fmt.Errorf("failed to delete merge candidates: %w", err)
+	}
+	return len(keys), nil
+}
+
+// countEntityAssets returns the number of assets of the builds and crashes among the keys.
+func countEntityAssets(c context.Context, keys []*db.Key) (int, error) {
+	var buildKeys, crashKeys []*db.Key
+	for _, key := range keys {
+		switch key.Kind() {
+		case "Build":
+			buildKeys = append(buildKeys, key)
+		case "Crash":
+			crashKeys = append(crashKeys, key)
+		}
+	}
+	count := 0
+	builds := make([]*Build, len(buildKeys))
+	if err := db.GetMulti(c, buildKeys, builds); err != nil {
+		return 0, fmt.Errorf("failed to get builds: %w", err)
+	}
+	for _, build := range builds {
+		count += len(build.Assets)
+	}
+	crashes := make([]*Crash, len(crashKeys))
+	if err := db.GetMulti(c, crashKeys, crashes); err != nil {
+		return 0, fmt.Errorf("failed to get crashes: %w", err)
+	}
+	for _, crash := range crashes {
+		count += len(crash.Assets)
+	}
+	return count, nil
+}
+
+// deleteNamespaceSavedViews removes the namespace views from the next batch of the user views.
+func deleteNamespaceSavedViews(c context.Context, ns, cursor string, batchSize int) (*namespaceDeletionBatch, error) {
+	query := db.NewQuery("UserViews").
+		KeysOnly().
+		Limit(batchSize)
+	if cursor != "" {
+		cursor, err := db.DecodeCursor(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode cursor: %w", err)
+		}
+		query = query.Start(cursor)
+	}
+	var keys []*db.Key
+	iter := query.Run(c)
+	for {
+		key, err := iter.Next(nil)
+		if err == db.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query user views: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	next, err := iter.Cursor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor: %w", err)
+	}
+	removed := 0
+	for _, key := range keys {
+		count := 0
+		tx := func(c context.Context) error {
+			views := new(UserViews)
+			if err := db.Get(c, key, views); err != nil {
+				return fmt.Errorf("failed to get user views: %w", err)
+			}
+			var keep []SavedView
+			for _, view := range views.Views {
+				if view.Namespace != ns {
+					keep = append(keep, view)
+				}
+			}
+			if count = len(views.Views) - len(keep); count == 0 {
+				return nil
+			}
+			views.Views = keep
+			_, err := db.Put(c, key, views)
+			return err
+		}
+		if err := db.RunInTransaction(c, tx, nil); err != nil {
+			return nil, fmt.Errorf("failed to update views of %v: %w", key.StringID(), err)
+		}
+		removed += count
+	}
+	return &namespaceDeletionBatch{
+		deleted: map[string]int{"UserViews.Views": removed},
+		cursor:  next.String(),
+		done:    len(keys) < batchSize,
+	}, nil
+}
+
+// deleteNamespaceCounters drops the reporting quotas and the storage usage counters.
+func deleteNamespaceCounters(c context.Context, ns, cursor string, batchSize int) (*namespaceDeletionBatch, error) {
+	dropped, err := dropNamespaceReportingState(c, ns, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, typ := range storageTypes() {
+		for _, kind := range []string{"written", "freed"} {
+			if _, err := takeStorageCounter(c, storageCounterKey(kind, ns, typ)); err != nil {
+				return nil, fmt.Errorf("failed to drop storage counters: %w", err)
+			}
+		}
+	}
+	return &namespaceDeletionBatch{
+		deleted: map[string]int{"ReportingState.Entries": dropped},
+		done:    true,
+	}, nil
+}
+
+// verifyNamespaceDeletion returns the number of entities per kind that still reference the namespace.
+func verifyNamespaceDeletion(c context.Context, ns string) ([]NamespaceDeletionCount, error) {
+	var ret []NamespaceDeletionCount
+	for _, kind := range append(namespaceDeletionKinds, namespaceDeletionKind{"Job", "Namespace", false}) {
+		count, err := db.NewQuery(kind.name).
+			Filter(kind.field+"=", ns).
+			KeysOnly().
+			Count(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %v: %w", kind.name, err)
+		}
+		if count != 0 {
+			ret = addNamespaceDeletionCount(ret, kind.name, count)
+		}
+	}
+	// Once the bugs are deleted, it's not known which namespace they belonged to,
+	// so all entities that refer to non-existing bugs and discussions are counted.
+	for _, kind := range namespaceBugKinds {
+		count, err := countBugKindOrphans(c, kind)
+		if err != nil {
+			return nil, err
+		}
+		if count != 0 {
+			ret = addNamespaceDeletionCount(ret, kind.name, count)
+		}
+	}
+	count, err := countMergeCandidateOrphans(c)
+	if err != nil {
+		return nil, err
+	}
+	if count != 0 {
+		ret = addNamespaceDeletionCount(ret, "DiscussionMergeCandidate", count)
+	}
+	if count, err = countDiscussionAliasOrphans(c); err != nil {
+		return nil, err
+	}
+	if count != 0 {
+		ret = addNamespaceDeletionCount(ret, "DiscussionAlias", count)
+	}
+	var allViews []*UserViews
+	if _, err := db.NewQuery("UserViews").GetAll(c, &allViews); err != nil {
+		return nil, fmt.Errorf("failed to query user views: %w", err)
+	}
+	for _, views := range allViews {
+		for _, view := range views.Views {
+			if view.Namespace == ns {
+				ret = addNamespaceDeletionCount(ret, "UserViews.Views", 1)
+			}
+		}
+	}
+	state, err := loadReportingState(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, ent := range state.Entries {
+		if ent.Namespace == ns {
+			ret = addNamespaceDeletionCount(ret, "ReportingState.Entries", 1)
+		}
+	}
+	return ret, nil
+}
+
+// countBugKindOrphans returns the number of entities of the kind that refer to non-existing bugs.
+func countBugKindOrphans(c context.Context, kind namespaceDeletionKind) (int, error) {
+	var refs []db.PropertyList
+	_, err := db.NewQuery(kind.name).
+		Project(kind.field).
+		Distinct().
+		GetAll(c, &refs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %v: %w", kind.name, err)
+	}
+	var bugKeys []*db.Key
+	for _, props := range refs {
+		for _, prop := range props {
+			if id, ok := prop.Value.(string); ok && prop.Name == kind.field {
+				bugKeys = append(bugKeys, db.NewKey(c, "Bug", id, 0, nil))
+			}
+		}
+	}
+	missing, err := missingEntities(c, bugKeys)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, key := range missing {
+		count, err := db.NewQuery(kind.name).
+			Filter(kind.field+"=", key.StringID()).
+			KeysOnly().
+			Count(c)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count %v: %w", kind.name, err)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// countMergeCandidateOrphans returns the number of merge proposals that refer to non-existing discussions.
+func countMergeCandidateOrphans(c context.Context) (int, error) {
+	var candidates []*DiscussionMergeCandidate
+	if _, err := db.NewQuery("DiscussionMergeCandidate").GetAll(c, &candidates); err != nil {
+		return 0, fmt.Errorf("failed to query merge candidates: %w", err)
+	}
+	var keys []*db.Key
+	for _, dmc := range candidates {
+		keys = append(keys, discussionKey(c, dmc.Source, dmc.FromID), discussionKey(c, dmc.Source, dmc.ToID))
+	}
+	missing, err := missingEntities(c, keys)
+	if err != nil {
+		return 0, err
+	}
+	isMissing := map[string]bool{}
+	for _, key := range missing {
+		isMissing[key.StringID()] = true
+	}
+	count := 0
+	for i := range candidates {
+		if isMissing[keys[2*i].StringID()] || isMissing[keys[2*i+1].StringID()] {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// countDiscussionAliasOrphans returns the number of aliases that lead neither to a discussion nor to another alias.
+func countDiscussionAliasOrphans(c context.Context) (int, error) {
+	var aliases []*DiscussionAlias
+	if _, err := db.NewQuery("DiscussionAlias").GetAll(c, &aliases); err != nil {
+		return 0, fmt.Errorf("failed to query discussion aliases: %w", err)
+	}
+	var keys []*db.Key
+	for _, alias := range aliases {
+		keys = append(keys, discussionKey(c, alias.Source, alias.TargetID),
+			discussionAliasKey(c, alias.Source, alias.TargetID))
+	}
+	missing, err := missingEntities(c, keys)
+	if err != nil {
+		return 0, err
+	}
+	isMissing := map[string]bool{}
+	for _, key := range missing {
+		isMissing[key.String()] = true
+	}
+	count := 0
+	for i := range aliases {
+		if isMissing[keys[2*i].String()] && isMissing[keys[2*i+1].String()] {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// missingEntities returns the keys for which there are no entities.
+func missingEntities(c context.Context, keys []*db.Key) ([]*db.Key, error) {
+	var missing []*db.Key
+	for len(keys) != 0 {
+		batch := keys
+		if len(batch) > 500 {
+			batch = batch[:500]
+		}
+		keys = keys[len(batch):]
+		entities := make([]db.PropertyList, len(batch))
+		err := db.GetMulti(c, batch, entities)
+		if err == nil {
+			continue
+		}
+		var merr appengine.MultiError
+		if !errors.As(err, &merr) {
+			return nil, fmt.Errorf("failed to get entities: %w", err)
+		}
+		for i, err := range merr {
+			if err == db.ErrNoSuchEntity {
+				missing = append(missing, batch[i])
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to get entities: %w", err)
+			}
+		}
+	}
+	return missing, nil
+}
+
+type uiNamespaceDeletion struct {
+	Namespace   string
+	Token       string
+	RequestedBy string
+	Requested   time.Time
+	ConfirmedBy string
+	Confirmed   time.Time
+	Finished    time.Time
+	Updated     time.Time
+	Phase       string
+	Deleted     []NamespaceDeletionCount
+	Assets      int
+	Detached    int
+	Remaining   []NamespaceDeletionCount
+	Error       string
+}
+
+func loadNamespaceDeletionsUI(c context.Context) ([]*uiNamespaceDeletion, error) {
+	var deletions []*NamespaceDeletion
+	_, err := db.NewQuery("NamespaceDeletion").
+		Order("-Requested").
+		GetAll(c, &deletions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query namespace deletions: %w", err)
+	}
+	phases := namespaceDeletionPhases()
+	var ret []*uiNamespaceDeletion
+	for _, deletion := range deletions {
+		phase := "verification"
+		if deletion.Phase < len(phases) {
+			phase = phases[deletion.Phase].name
+		}
+		ret = append(ret, &uiNamespaceDeletion{
+			Namespace:   deletion.Namespace,
+			Token:       deletion.Token,
+			RequestedBy: deletion.RequestedBy,
+			Requested:   deletion.Requested,
+			ConfirmedBy: deletion.ConfirmedBy,
+			Confirmed:   deletion.Confirmed,
+			Finished:    deletion.Finished,
+			Updated:     deletion.Updated,
+			Phase:       fmt.Sprintf("%v/%v: %v", deletion.Phase+1, len(phases)+1, phase),
+			Deleted:     deletion.Deleted,
+			Assets:      deletion.Assets,
+			Detached:    deletion.Detached,
+			Remaining:   deletion.Remaining,
+			Error:       deletion.Error,
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestNamespaceDeletion(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	// The data of test1 must survive the deletion of test2.
+	build1 := testBuild(1)
+	c.client.UploadBuild(build1)
+	c.client.ReportCrash(testCrash(build1, 1))
+	rep1 := c.client.pollBug()
+
+	build2 := testBuild(2)
+	build2.Assets = []dashapi.NewAsset{{
+		Type:        dashapi.KernelObject,
+		DownloadURL: "http://google.com/test2-vmlinux",
+	}}
+	c.client2.UploadBuild(build2)
+	c.client2.ReportCrash(testCrashWithRepro(build2, 1))
+	_, extBugID, err := email.RemoveAddrContext(c.client2.pollEmailBug().Sender)
+	c.expectOK(err)
+	c.client2.ReportCrash(testCrash(build2, 2))
+	c.client2.pollEmailBug()
+	pollResp := c.client2.pollJobs(build2.Manager)
+	c.expectEQ(pollResp.Type, dashapi.JobBisectCause)
+
+	saveDiscussion := func(id string, bugIDs ...string) {
+		c.expectOK(c.client2.SaveDiscussion(&dashapi.SaveDiscussionReq{
+			Discussion: &dashapi.Discussion{
+				ID:      id,
+				Source:  dashapi.DiscussionLore,
+				Type:    dashapi.DiscussionPatch,
+				Subject: id,
+				BugIDs:  bugIDs,
+				Messages: []dashapi.DiscussionMessage{{
+					ID:       id,
+					External: true,
+					Time:     timeNow(c.ctx),
+				}},
+			},
+		}))
+	}
+	saveDiscussion("<shared@patch>", rep1.ID, extBugID)
+	saveDiscussion("<own@patch>", extBugID)
+
+	// The entities that refer to the bugs only by the bug key.
+	bug2, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	bugRefs := []struct {
+		key *db.Key
+		ent interface{}
+	}{
+		{db.NewIncompleteKey(c.ctx, "PendingSummaryDelta", nil), &PendingSummaryDelta{
+			Bug:     bug2.keyHash(),
+			Source:  string(dashapi.DiscussionLore),
+			Created: timeNow(c.ctx),
+		}},
+		{discussionMismatchKey(c.ctx, bug2.keyHash(), string(dashapi.DiscussionLore)), &DiscussionMismatch{
+			BugKey: bug2.keyHash(),
+			Source: string(dashapi.DiscussionLore),
+			Time:   timeNow(c.ctx),
+		}},
+	}
+	for _, ref := range bugRefs {
+		_, err := db.Put(c.ctx, ref.key, ref.ent)
+		c.expectOK(err)
+	}
+	candidate := &DiscussionMergeCandidate{
+		Source:  string(dashapi.DiscussionLore),
+		FromID:  "<own@patch>",
+		ToID:    "<shared@patch>",
+		Created: timeNow(c.ctx),
+	}
+	_, err = db.Put(c.ctx, candidate.key(c.ctx), candidate)
+	c.expectOK(err)
+	// The aliases of the deleted discussion, including a chain of merges, and of the surviving one.
+	for _, alias := range []*DiscussionAlias{
+		{Source: string(dashapi.DiscussionLore), ID: "<old@patch>", TargetID: "<own@patch>"},
+		{Source: string(dashapi.DiscussionLore), ID: "<older@patch>", TargetID: "<old@patch>"},
+		{Source: string(dashapi.DiscussionLore), ID: "<other@patch>", TargetID: "<shared@patch>"},
+	} {
+		_, err := db.Put(c.ctx, discussionAliasKey(c.ctx, alias.Source, alias.ID), alias)
+		c.expectOK(err)
+	}
+
+	// The entities that don't refer to the namespace bugs.
+	for _, bootstrap := range []*NamespaceBootstrap{
+		{Source: "test1", Target: "test2"},
+		{Source: "test2", Target: "test1"},
+	} {
+		_, err := db.Put(c.ctx, db.NewKey(c.ctx, "NamespaceBootstrap", bootstrap.Target, 0, nil), bootstrap)
+		c.expectOK(err)
+	}
+	for _, ns := range []string{"test1", "test2"} {
+		ref, truncated := storeEmailAttachment(c.ctx, "log.txt", strings.NewReader("a large log"))
+		c.expectTrue(!truncated)
+		setEmailAttachmentsNamespace(c.ctx, &email.Email{
+			Oversized: []email.OversizedAttachment{{Name: "log.txt", Ref: ref}},
+		}, ns)
+	}
+	viewsKey := userViewsKey(c.ctx, "user@foo.com")
+	_, err = db.Put(c.ctx, viewsKey, &UserViews{Views: []SavedView{
+		{Namespace: "test1", Name: "mine", Query: "assignee=user%40foo.com"},
+		{Namespace: "test2", Name: "mine", Query: "assignee=user%40foo.com"},
+	}})
+	c.expectOK(err)
+
+	// Active namespaces can't be deleted.
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=delete_namespace&ns=test2")
+	c.expectBadReqest(err)
+
+	config.Namespaces["test2"].Decommissioned = true
+	defer func() { config.Namespaces["test2"].Decommissioned = false }()
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=delete_namespace&ns=test2")
+	c.expectOK(err)
+	key := db.NewKey(c.ctx, "NamespaceDeletion", "test2", 0, nil)
+	deletion := new(NamespaceDeletion)
+	c.expectOK(db.Get(c.ctx, key, deletion))
+	c.expectNE(deletion.Token, "")
+	page, err := c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), deletion.Token))
+
+	// Nothing happens until the deletion is confirmed.
+	more, err := namespaceDeletionStep(c.ctx, key, 1)
+	c.expectOK(err)
+	c.expectTrue(!more)
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=confirm_namespace_deletion&ns=test2&token=wrong")
+	c.expectBadReqest(err)
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=confirm_namespace_deletion&ns=test2&token="+deletion.Token)
+	c.expectOK(err)
+
+	steps := 0
+	for more = true; more; steps++ {
+		more, err = namespaceDeletionStep(c.ctx, key, 1)
+		c.expectOK(err)
+		if steps == 3 {
+			// The deletion stops if the namespace is active again and then resumes from where it stopped.
+			config.Namespaces["test2"].Decommissioned = false
+			_, err = namespaceDeletionStep(c.ctx, key, 1)
+			c.expectTrue(err != nil)
+			page, err := c.AuthGET(AccessAdmin, "/admin")
+			c.expectOK(err)
+			c.expectTrue(strings.Contains(string(page), "is not decommissioned"))
+			config.Namespaces["test2"].Decommissioned = true
+		}
+	}
+	c.expectTrue(steps > len(namespaceDeletionPhases()))
+	c.expectOK(db.Get(c.ctx, key, deletion))
+	c.expectTrue(!deletion.Finished.IsZero())
+	c.expectEQ(deletion.Error, "")
+	c.expectEQ(len(deletion.Remaining), 0)
+	c.expectEQ(deletion.Assets, 1)
+	c.expectEQ(deletion.Detached, 1)
+	deleted := map[string]int{}
+	for _, item := range deletion.Deleted {
+		deleted[item.Kind] = item.Count
+	}
+	c.expectEQ(deleted["Bug"], 2)
+	c.expectEQ(deleted["Crash"], 2)
+	c.expectEQ(deleted["Job"], 1)
+	c.expectEQ(deleted["Build"], 1)
+	c.expectEQ(deleted["Manager"], 1)
+	c.expectEQ(deleted["Discussion"], 1)
+	c.expectEQ(deleted["PendingSummaryDelta"], 1)
+	c.expectEQ(deleted["DiscussionMismatch"], 1)
+	c.expectEQ(deleted["DiscussionMergeCandidate"], 1)
+	c.expectEQ(deleted["DiscussionAlias"], 2)
+	c.expectEQ(deleted["NamespaceBootstrap"], 2)
+	c.expectEQ(deleted["EmailAttachment"], 1)
+	c.expectEQ(deleted["UserViews.Views"], 1)
+
+	// Nothing of test2 is left.
+	for _, kind := range []string{"Bug", "Build", "Job", "Manager", textReproSyz, textCrashLog} {
+		count, err := db.NewQuery(kind).Filter("Namespace=", "test2").KeysOnly().Count(c.ctx)
+		c.expectOK(err)
+		c.expectEQ(count, 0)
+	}
+	for _, kind := range []string{"PendingSummaryDelta", "DiscussionMismatch", "DiscussionMergeCandidate"} {
+		count, err := db.NewQuery(kind).KeysOnly().Count(c.ctx)
+		c.expectOK(err)
+		c.expectEQ(count, 0)
+	}
+	needed, err := c.client.NeededAssetsList()
+	c.expectOK(err)
+	for _, url := range needed.DownloadURLs {
+		c.expectNE(url, build2.Assets[0].DownloadURL)
+	}
+	var discussions []*Discussion
+	_, err = db.NewQuery("Discussion").GetAll(c.ctx, &discussions)
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	c.expectEQ(discussions[0].ID, "<shared@patch>")
+	bug1, _, err := findBugByReportingID(c.ctx, rep1.ID)
+	c.expectOK(err)
+	c.expectEQ(discussions[0].BugKeys, []string{bug1.keyHash()})
+	var aliases []*DiscussionAlias
+	_, err = db.NewQuery("DiscussionAlias").GetAll(c.ctx, &aliases)
+	c.expectOK(err)
+	c.expectEQ(len(aliases), 1)
+	c.expectEQ(aliases[0].ID, "<other@patch>")
+	count, err := db.NewQuery("NamespaceBootstrap").KeysOnly().Count(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(count, 0)
+	var attachments []*EmailAttachment
+	_, err = db.NewQuery("EmailAttachment").GetAll(c.ctx, &attachments)
+	c.expectOK(err)
+	c.expectEQ(len(attachments), 1)
+	c.expectEQ(attachments[0].Namespace, "test1")
+	views, err := loadUserViews(c.ctx, "user@foo.com")
+	c.expectOK(err)
+	c.expectEQ(len(views.Views), 1)
+	c.expectEQ(views.Views[0].Namespace, "test1")
+
+	// A finished deletion can be requested again, e.g. if some data has appeared since then.
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=delete_namespace&ns=test2")
+	c.expectOK(err)
+}
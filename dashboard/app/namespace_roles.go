@@ -0,0 +1,201 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+	"google.golang.org/appengine/v2/user"
+)
+
+// The global access levels (see accessLevel) do not allow to let a partner team manage only
+// their own namespace. Global admins may bind users to the AccessUser or AccessAdmin role
+// within a single namespace on the admin page. The bindings are stored as NamespaceRole
+// entities and raise the access level of the user wherever the namespace is known from
+// the request (see namespaceAccessLevel): the namespace pages, the bug pages and actions,
+// job cancellation, invalidation reverts and bulk bug updates (/bulk_update).
+// The global admin actions are not affected.
+
+// NamespaceRole binds a user to a role within a namespace. The key is "namespace|email".
+type NamespaceRole struct {
+	Namespace string
+	Email     string
+	Role      AccessLevel
+	Granted   time.Time
+	GrantedBy string
+}
+
+func namespaceRoleKey(c context.Context, ns, email string) *db.Key {
+	return db.NewKey(c, "NamespaceRole", ns+"|"+email, 0, nil)
+}
+
+func namespaceRolesCacheKey(email string) string {
+	return "namespace-roles-" + email
+}
+
+// namespaceAccessLevel returns the access level of the current user within the namespace.
+func namespaceAccessLevel(c context.Context, r *http.Request, ns string) AccessLevel {
+	level := accessLevel(c, r)
+	if level == AccessAdmin || ns == "" {
+		return level
+	}
+	return withNamespaceRole(level, userNamespaceRoles(c), ns)
+}
+
+// withNamespaceRole raises the global access level to the role in the namespace.
+// It's used when the level is needed for several namespaces at once.
+func withNamespaceRole(level AccessLevel, roles map[string]AccessLevel, ns string) AccessLevel {
+	if role := roles[ns]; role > level {
+		return role
+	}
+	return level
+}
+
+func checkNamespaceAccessLevel(c context.Context, r *http.Request, ns string, level AccessLevel) error {
+	if namespaceAccessLevel(c, r, ns) >= level {
+		return nil
+	}
+	return checkAccessLevel(c, r, level)
+}
+
+// userNamespaceRoles returns the roles of the current user, namespace -> role.
+func userNamespaceRoles(c context.Context) map[string]AccessLevel {
+	u := user.Current(c)
+	if u == nil {
+		return nil
+	}
+	userEmail := email.CanonicalEmail(u.Email)
+	roles := make(map[string]AccessLevel)
+	if _, err := memcache.Gob.Get(c, namespaceRolesCacheKey(userEmail), &roles); err == nil {
+		return roles
+	} else if err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to get namespace roles from memcache: %v", err)
+	}
+	var bindings []*NamespaceRole
+	if _, err := db.NewQuery("NamespaceRole").Filter("Email=", userEmail).GetAll(c, &bindings); err != nil {
+		// Failing closed means falling back to the global access level.
+		log.Errorf(c, "failed to query namespace roles: %v", err)
+		return nil
+	}
+	for _, binding := range bindings {
+		roles[binding.Namespace] = binding.Role
+	}
+	item := &memcache.Item{
+		Key:        namespaceRolesCacheKey(userEmail),
+		Object:     roles,
+		Expiration: time.Hour,
+	}
+	if err := memcache.Gob.Set(c, item); err != nil {
+		log.Errorf(c, "failed to put namespace roles to memcache: %v", err)
+	}
+	return roles
+}
+
+func grantNamespaceRole(c context.Context, ns, userEmail string, role AccessLevel, admin string) error {
+	if config.Namespaces[ns] == nil {
+		return fmt.Errorf("%w: unknown namespace %q", ErrClientBadRequest, ns)
+	}
+	if role != AccessUser && role != AccessAdmin {
+		return fmt.Errorf("%w: bad role %v", ErrClientBadRequest, role)
+	}
+	userEmail = email.CanonicalEmail(userEmail)
+	if !strings.Contains(userEmail, "@") {
+		return fmt.Errorf("%w: bad email %q", ErrClientBadRequest, userEmail)
+	}
+	binding := &NamespaceRole{
+		Namespace: ns,
+		Email:     userEmail,
+		Role:      role,
+		Granted:   timeNow(c),
+		GrantedBy: admin,
+	}
+	if _, err := db.Put(c, namespaceRoleKey(c, ns, userEmail), binding); err != nil {
+		return fmt.Errorf("failed to put namespace role: %w", err)
+	}
+	log.Warningf(c, "%v granted %v role %v in %v", admin, userEmail, role, ns)
+	return dropNamespaceRolesCache(c, userEmail)
+}
+
+func revokeNamespaceRole(c context.Context, ns, userEmail, admin string) error {
+	userEmail = email.CanonicalEmail(userEmail)
+	if err := db.Delete(c, namespaceRoleKey(c, ns, userEmail)); err != nil && err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to delete namespace role: %w", err)
+	}
+	log.Warningf(c, "%v revoked the role of %v in %v", admin, userEmail, ns)
+	return dropNamespaceRolesCache(c, userEmail)
+}
+
+func dropNamespaceRolesCache(c context.Context, userEmail string) error {
+	if err := memcache.Delete(c, namespaceRolesCacheKey(userEmail)); err != nil && err != memcache.ErrCacheMiss {
+		return fmt.Errorf("failed to drop the namespace roles cache: %w", err)
+	}
+	return nil
+}
+
+// handleNamespaceRoleAction serves the grant_role and revoke_role actions of the admin page.
+func handleNamespaceRoleAction(c context.Context, r *http.Request, grant bool) error {
+	admin := ""
+	if u := user.Current(c); u != nil {
+		admin = u.Email
+	}
+	ns, userEmail := r.FormValue("ns"), r.FormValue("email")
+	if !grant {
+		return revokeNamespaceRole(c, ns, userEmail, admin)
+	}
+	var role AccessLevel
+	switch r.FormValue("role") {
+	case "user":
+		role = AccessUser
+	case "admin":
+		role = AccessAdmin
+	default:
+		return fmt.Errorf("%w: unknown role %q", ErrClientBadRequest, r.FormValue("role"))
+	}
+	return grantNamespaceRole(c, ns, userEmail, role, admin)
+}
+
+type uiNamespaceRole struct {
+	Namespace string
+	Email     string
+	Role      string
+	Granted   time.Time
+	GrantedBy string
+}
+
+func loadNamespaceRolesUI(c context.Context) ([]*uiNamespaceRole, error) {
+	var bindings []*NamespaceRole
+	if _, err := db.NewQuery("NamespaceRole").GetAll(c, &bindings); err != nil {
+		return nil, fmt.Errorf("failed to query namespace roles: %w", err)
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		if bindings[i].Namespace != bindings[j].Namespace {
+			return bindings[i].Namespace < bindings[j].Namespace
+		}
+		return bindings[i].Email < bindings[j].Email
+	})
+	var ret []*uiNamespaceRole
+	for _, binding := range bindings {
+		role := "user"
+		if binding.Role == AccessAdmin {
+			role = "admin"
+		}
+		ret = append(ret, &uiNamespaceRole{
+			Namespace: binding.Namespace,
+			Email:     binding.Email,
+			Role:      role,
+			Granted:   binding.Granted,
+			GrantedBy: binding.GrantedBy,
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestNamespaceRoles(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	bug, _, _ := c.loadBug(c.client.pollBug().ID)
+	bugURL := bugLink(bug.keyHash())
+
+	const partner = "partner@example.com"
+	allowed := func(err error) bool {
+		var httpErr HTTPError
+		return err == nil || errors.As(err, &httpErr) && httpErr.Code != http.StatusForbidden &&
+			httpErr.Code != http.StatusTemporaryRedirect
+	}
+	type action struct {
+		name  string
+		url   string
+		ns    string
+		level AccessLevel
+	}
+	var actions []action
+	for _, ns := range []string{"test1", "test2", "access-user"} {
+		actions = append(actions,
+			action{"namespace page", "/" + ns, ns, config.Namespaces[ns].AccessLevel},
+			action{"job queue", "/jobs?ns=" + ns, ns, config.Namespaces[ns].AccessLevel},
+			// The job and the bug do not exist, so the allowed actions fail with 400/404.
+			action{"job cancel", "/jobs?ns=" + ns + "&action=cancel&id=bad", ns, AccessAdmin},
+			action{"invalidations", "/invalidations?ns=" + ns, ns, AccessAdmin},
+			action{"invalidation revert", "/invalidations?ns=" + ns + "&action=revert&id=bad", ns, AccessAdmin},
+			action{"bulk update", "/bulk_update?ns=" + ns + "&action=invalidate&id=bad", ns, AccessAdmin},
+		)
+	}
+	actions = append(actions, action{"bug page", bugURL, "test1", AccessAdmin})
+	roles := map[string]AccessLevel{"": AccessPublic, "user": AccessUser, "admin": AccessAdmin}
+	for _, grantNs := range []string{"test1", "access-user"} {
+		for roleName, role := range roles {
+			if roleName != "" {
+				_, err := c.AuthGET(AccessAdmin, fmt.Sprintf("/admin?action=grant_role&ns=%v&email=%v&role=%v",
+					grantNs, partner, roleName))
+				c.expectOK(err)
+			}
+			for _, act := range actions {
+				level := AccessPublic
+				if act.ns == grantNs {
+					level = role
+				}
+				_, err := c.GETAs(partner, act.url)
+				if got, want := allowed(err), level >= act.level; got != want {
+					t.Errorf("role %q in %v: %v (%v): allowed=%v, want %v (%v)",
+						roleName, grantNs, act.name, act.url, got, want, err)
+				}
+			}
+			_, err := c.AuthGET(AccessAdmin, fmt.Sprintf("/admin?action=revoke_role&ns=%v&email=%v",
+				grantNs, partner))
+			c.expectOK(err)
+		}
+	}
+}
+
+func TestNamespaceRolesAdmin(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	// Only the global admins manage the roles.
+	_, err := c.AuthGET(AccessAdmin, "/admin?action=grant_role&ns=test1&email=Partner@Example.com&role=admin")
+	c.expectOK(err)
+	_, err = c.GETAs("partner@example.com", "/admin?action=grant_role&ns=test2&email=partner@example.com&role=admin")
+	c.expectForbidden(err)
+	_, err = c.GETAs("partner@example.com", "/admin")
+	c.expectForbidden(err)
+
+	page, err := c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("<td>partner@example.com</td>")))
+
+	// The role applies only to its namespace.
+	page, err = c.GETAs("partner@example.com", "/test1")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("test1")))
+	_, err = c.GETAs("partner@example.com", "/test2")
+	c.expectForbidden(err)
+
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=grant_role&ns=unknown&email=partner@example.com&role=admin")
+	c.expectBadReqest(err)
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=grant_role&ns=test1&email=partner@example.com&role=owner")
+	c.expectBadReqest(err)
+
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=revoke_role&ns=test1&email=partner@example.com")
+	c.expectOK(err)
+	_, err = c.GETAs("partner@example.com", "/test1")
+	c.expectForbidden(err)
+}
@@ -0,0 +1,206 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/vcs"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// Developers who can't reproduce a bug may say so with "#syz norepro [kernel-commit]",
+// optionally attaching the kernel config they used. The report is recorded in
+// Bug.NoReproReports and syzbot replies with a comparison of their environment and ours:
+// the significant config differences (see configDriftOptions), the distance between
+// the commits and the exact compiler, images and the repro bundle of the crash.
+// The number of developers who could not reproduce the bug is shown on the bug page,
+// and the reports make syzbot retry the reproduction sooner (see needReproForBug).
+
+// Only the latest reports are kept to limit the size of the bug entity.
+const maxNoReproReports = 10
+
+type NoReproReport struct {
+	Time   time.Time
+	User   string
+	Link   string
+	Commit string // the kernel commit the developer tested, if given
+	Config int64  // reference to the attached kernel config text entity, if any
+}
+
+// recordNoReproReport adds the report, the previous report of the same user is replaced.
+func recordNoReproReport(c context.Context, bugKey *db.Key, report NoReproReport) error {
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %v", err)
+		}
+		var reports []NoReproReport
+		for _, old := range bug.NoReproReports {
+			if old.User != report.User {
+				reports = append(reports, old)
+			}
+		}
+		reports = append(reports, report)
+		if len(reports) > maxNoReproReports {
+			reports = reports[len(reports)-maxNoReproReports:]
+		}
+		bug.NoReproReports = reports
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %v", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+// noReproSinceLastRepro says whether somebody could not reproduce the bug after
+// the last reproduction attempt.
+func (bug *Bug) noReproSinceLastRepro() bool {
+	for _, report := range bug.NoReproReports {
+		if report.Time.After(bug.LastReproTime) {
+			return true
+		}
+	}
+	return false
+}
+
+type uiNoReproComparison struct {
+	Reporters int
+	// The config diff is only set if the developer attached a config.
+	ConfigAttached bool
+	ConfigTotal    int
+	ConfigChanges  []*uiConfigChange
+	// Commit is the commit the developer tested, CommitDistance describes how it relates to ours.
+	Commit            string
+	CommitDistance    string
+	KernelRepo        string
+	KernelBranch      string
+	KernelCommit      string
+	KernelCommitTitle string
+	KernelConfigLink  string
+	CompilerID        string
+	SyzkallerCommit   string
+	EnvLink           string
+	Assets            []dashapi.Asset
+}
+
+// noReproComparison compares the environment of the developer with the build of the bug crash.
+func noReproComparison(c context.Context, bug *Bug, commit string, config []byte) (*uiNoReproComparison, error) {
+	crash, crashKey, err := findCrashForBug(c, bug)
+	if err != nil {
+		return nil, err
+	}
+	build, err := loadBuild(c, bug.Namespace, crash.BuildID)
+	if err != nil {
+		return nil, err
+	}
+	ret := &uiNoReproComparison{
+		Reporters:         len(bug.NoReproReports),
+		Commit:            commit,
+		KernelRepo:        build.KernelRepo,
+		KernelBranch:      build.KernelBranch,
+		KernelCommit:      build.KernelCommit,
+		KernelCommitTitle: build.KernelCommitTitle,
+		KernelConfigLink:  externalLink(c, textKernelConfig, build.KernelConfig),
+		CompilerID:        build.CompilerID,
+		SyzkallerCommit:   build.SyzkallerCommit,
+		EnvLink:           appURL(c) + crashEnvLink(bug, crashKey),
+		Assets:            createAssetList(build, crash),
+	}
+	if commit != "" {
+		theirDate, err := kernelCommitDate(c, bug.Namespace, commit)
+		if err != nil {
+			return nil, err
+		}
+		ret.CommitDistance = describeCommitDistance(commit, theirDate, build.KernelCommit, build.KernelCommitDate)
+	}
+	if len(config) != 0 {
+		ourConfig, _, err := getText(c, textKernelConfig, build.KernelConfig)
+		if err != nil {
+			return nil, err
+		}
+		diff, err := diffKernelConfigs(ourConfig, config)
+		if err != nil {
+			return nil, err
+		}
+		ret.ConfigAttached = true
+		ret.ConfigTotal = diff.Total
+		ret.ConfigChanges = diff.Changes
+	}
+	return ret, nil
+}
+
+// kernelCommitDate returns the date of the commit if syzbot has ever built it in the namespace.
+func kernelCommitDate(c context.Context, ns, commit string) (time.Time, error) {
+	var builds []*Build
+	_, err := db.NewQuery("Build").
+		Filter("KernelCommit=", commit).
+		Limit(100).
+		GetAll(c, &builds)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query builds: %w", err)
+	}
+	for _, build := range builds {
+		if build.Namespace == ns && !build.KernelCommitDate.IsZero() {
+			return build.KernelCommitDate, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// describeCommitDistance explains how the tested commit relates to the commit of our build.
+// Their date is zero if the commit is not known to syzbot.
+func describeCommitDistance(their string, theirDate time.Time, our string, ourDate time.Time) string {
+	if strings.HasPrefix(our, their) {
+		return "it's the same commit the bug was found on"
+	}
+	if theirDate.IsZero() || ourDate.IsZero() {
+		return "syzbot has never built this commit, so the distance is unknown"
+	}
+	days := int(theirDate.Sub(ourDate).Hours() / 24)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("it's %v days newer than the commit the bug was found on", days)
+	case days < 0:
+		return fmt.Sprintf("it's %v days older than the commit the bug was found on", -days)
+	default:
+		return "it's from the same day as the commit the bug was found on"
+	}
+}
+
+// noReproReply records the report of the developer and renders the comparison reply.
+func noReproReply(c context.Context, bug *Bug, bugKey *db.Key, report NoReproReport, config []byte) (string, error) {
+	if report.Commit != "" && !vcs.CheckCommitHash(report.Commit) {
+		return fmt.Sprintf("%q does not look like a commit hash.\n\n"+
+			"The format is: #syz norepro [kernel-commit-hash]", report.Commit), nil
+	}
+	if len(config) != 0 {
+		var err error
+		if report.Config, err = putText(c, bug.Namespace, textKernelConfig, config, true); err != nil {
+			return "", err
+		}
+	}
+	if err := recordNoReproReport(c, bugKey, report); err != nil {
+		return "", err
+	}
+	bug = new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		return "", fmt.Errorf("failed to get bug: %v", err)
+	}
+	args, err := noReproComparison(c, bug, report.Commit, config)
+	if err != nil {
+		return "", err
+	}
+	body := new(bytes.Buffer)
+	if err := mailTemplates.ExecuteTemplate(body, "mail_norepro.txt", args); err != nil {
+		return "", fmt.Errorf("failed to execute mail_norepro.txt template: %w", err)
+	}
+	return body.String(), nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestDescribeCommitDistance(t *testing.T) {
+	ourDate := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	const our = "1d2b1cba9a6b0e2b1d64c7be6e6ea7d2d5b7e4c1"
+	tests := []struct {
+		their     string
+		theirDate time.Time
+		result    string
+	}{
+		{"1d2b1cba9a6b", time.Time{}, "it's the same commit the bug was found on"},
+		{"aaaaaaaaaaaa", time.Time{}, "syzbot has never built this commit, so the distance is unknown"},
+		{"aaaaaaaaaaaa", ourDate.Add(72 * time.Hour), "it's 3 days newer than the commit the bug was found on"},
+		{"aaaaaaaaaaaa", ourDate.Add(-48 * time.Hour), "it's 2 days older than the commit the bug was found on"},
+		{"aaaaaaaaaaaa", ourDate.Add(time.Hour), "it's from the same day as the commit the bug was found on"},
+	}
+	for i, test := range tests {
+		got := describeCommitDistance(test.their, test.theirDate, our, ourDate)
+		if got != test.result {
+			t.Errorf("test #%v: got %q, want %q", i, got, test.result)
+		}
+	}
+}
+
+func TestNoReproCommand(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	build.KernelConfig = []byte("CONFIG_DEBUG_KERNEL=y\nCONFIG_KCOV=y\nCONFIG_KASAN=y\n")
+	client.UploadBuild(build)
+	client.ReportCrash(testCrashWithRepro(build, 1))
+	sender := c.pollEmailBug().Sender
+	_, extID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+	bug, _, _ := c.loadBug(extID)
+	c.expectTrue(!bug.noReproSinceLastRepro())
+
+	var options strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&options, "CONFIG_OPTION_%v=y\n", i)
+	}
+	config := options.String() + "CONFIG_DEBUG_KERNEL=y\nCONFIG_KCOV=y\n# CONFIG_KASAN is not set\n"
+	c.incomingEmail(sender, "#syz norepro "+build.KernelCommit[:12]+"\n",
+		EmailOptFrom("dev1@kernel.org"), EmailOptAttachment(config))
+	reply := c.pollEmailBug()
+	c.expectEQ(reply.To, []string{"dev1@kernel.org"})
+	c.expectTrue(strings.Contains(reply.Body, "it's the same commit the bug was found on"))
+	c.expectTrue(strings.Contains(reply.Body, "Your config differs in 21 options"))
+	c.expectTrue(strings.Contains(reply.Body, "CONFIG_KASAN: y -> not set (ours -> yours)"))
+	c.expectTrue(strings.Contains(reply.Body, "repro bundle:"))
+
+	// The second report of the same developer replaces the first one.
+	c.incomingEmail(sender, "#syz norepro\n", EmailOptFrom("dev1@kernel.org"), EmailOptMessageID(2))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "If you attach your kernel config"))
+	c.incomingEmail(sender, "#syz norepro\n", EmailOptFrom("dev2@kernel.org"), EmailOptMessageID(3))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "2 developers could not reproduce the bug so far."))
+
+	c.incomingEmail(sender, "#syz norepro not-a-commit\n", EmailOptFrom("dev3@kernel.org"),
+		EmailOptMessageID(4))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "does not look like a commit hash"))
+
+	bug, _, _ = c.loadBug(extID)
+	c.expectEQ(len(bug.NoReproReports), 2)
+	c.expectTrue(bug.noReproSinceLastRepro())
+	page, err := c.AuthGET(AccessPublic, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "2 developers could not reproduce"))
+}
@@ -0,0 +1,505 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Patchwork patch states that we care about.
+// Once a series reaches one of the final states, it's no longer refreshed.
+const (
+	patchStateAccepted   = "accepted"
+	patchStateRejected   = "rejected"
+	patchStateSuperseded = "superseded"
+)
+
+const (
+	// How far back we look for new series when a project is polled for the first time.
+	patchworkInitialPeriod = 7 * 24 * time.Hour
+	// Series that were not updated for that long are no longer refreshed.
+	patchworkRefreshPeriod = 90 * 24 * time.Hour
+)
+
+func initPatchwork() {
+	http.HandleFunc("/cron/patchwork_poll", handleCron(handlePatchworkPoll))
+}
+
+func handlePatchworkPoll(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for ns, cfg := range config.Namespaces {
+		for i := range cfg.Patchwork {
+			pw := &cfg.Patchwork[i]
+			if err := pollPatchworkProject(c, ns, pw); err != nil {
+				log.Errorf(c, "patchwork: %v %v/%v failed: %v", ns, pw.URL, pw.Project, err)
+			}
+		}
+	}
+}
+
+// pollPatchworkProject looks for new series that mention bugs of the namespace
+// and refreshes the series that we already track.
+func pollPatchworkProject(c context.Context, ns string, cfg *PatchworkConfig) error {
+	client := newPatchworkClient(c, cfg)
+	key := patchworkPollKey(c, ns, cfg)
+	state := new(PatchworkPoll)
+	if err := db.Get(c, key, state); err != nil && err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to get PatchworkPoll: %w", err)
+	}
+	now := timeNow(c)
+	since := state.LastPoll
+	if since.IsZero() {
+		since = now.Add(-patchworkInitialPeriod)
+	}
+	// Series may appear in the API with some delay, so poll with an overlap.
+	series, err := client.Series(cfg.Project, since.Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("failed to query series: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, s := range series {
+		seen[patchworkSeriesID(cfg, s.ID)] = true
+		if err := updatePatchworkSeries(c, ns, cfg, client, s, false); err != nil {
+			return err
+		}
+	}
+	tracked, err := loadPatchworkDiscussions(c, cfg)
+	if err != nil {
+		return err
+	}
+	for _, d := range tracked {
+		if seen[d.ID] || patchworkFinalState(d.PatchState) {
+			continue
+		}
+		id, err := parsePatchworkSeriesID(d.ID)
+		if err != nil {
+			log.Errorf(c, "patchwork: %v", err)
+			continue
+		}
+		// One broken series must not prevent the rest of the project from being polled.
+		s, err := client.SeriesByID(id)
+		if err != nil {
+			log.Errorf(c, "patchwork: failed to query series %v: %v", d.ID, err)
+			continue
+		}
+		if err := updatePatchworkSeries(c, ns, cfg, client, s, true); err != nil {
+			log.Errorf(c, "patchwork: failed to update series %v: %v", d.ID, err)
+			continue
+		}
+	}
+	state.Namespace = ns
+	state.URL = cfg.URL
+	state.Project = cfg.Project
+	state.LastPoll = now
+	if _, err := db.Put(c, key, state); err != nil {
+		return fmt.Errorf("failed to put PatchworkPoll: %w", err)
+	}
+	return nil
+}
+
+// loadPatchworkDiscussions returns the recently active discussions that came from the Patchwork instance.
+func loadPatchworkDiscussions(c context.Context, cfg *PatchworkConfig) ([]*Discussion, error) {
+	var discussions []*Discussion
+	_, err := db.NewQuery("Discussion").
+		Filter("Source=", dashapi.DiscussionPatchwork).
+		Filter("Summary.LastMessage>", timeNow(c).Add(-patchworkRefreshPeriod)).
+		GetAll(c, &discussions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query discussions: %w", err)
+	}
+	prefix := patchworkInstance(cfg) + "/"
+	var ret []*Discussion
+	for _, d := range discussions {
+		if strings.HasPrefix(d.ID, prefix) {
+			ret = append(ret, d)
+		}
+	}
+	return ret, nil
+}
+
+// updatePatchworkSeries saves the series as a discussion if it refers to any bugs of the namespace.
+// If tracked is set, the series is saved even if no bugs are mentioned anymore.
+func updatePatchworkSeries(c context.Context, ns string, cfg *PatchworkConfig, client patchworkClient,
+	series *patchworkSeries, tracked bool) error {
+	var messages []*patchworkMessage
+	var contents []string
+	if series.CoverLetter != nil {
+		cover, err := client.Cover(series.CoverLetter.ID)
+		if err != nil {
+			return fmt.Errorf("failed to query cover %v: %w", series.CoverLetter.ID, err)
+		}
+		messages = append(messages, cover)
+		contents = append(contents, cover.Content)
+	}
+	var patches []*patchworkMessage
+	for _, ref := range series.Patches {
+		patch, err := client.Patch(ref.ID)
+		if err != nil {
+			return fmt.Errorf("failed to query patch %v: %w", ref.ID, err)
+		}
+		patches = append(patches, patch)
+		contents = append(contents, patch.Content)
+	}
+	bugIDs := patchworkBugIDs(c, ns, contents)
+	if len(bugIDs) == 0 && !tracked {
+		return nil
+	}
+	for _, patch := range patches {
+		messages = append(messages, patch)
+		comments, err := client.Comments(patch.ID)
+		if err != nil {
+			return fmt.Errorf("failed to query comments of patch %v: %w", patch.ID, err)
+		}
+		messages = append(messages, comments...)
+	}
+	own := ownEmailSet(c)
+	update := &dashapi.Discussion{
+		ID:         patchworkSeriesID(cfg, series.ID),
+		Source:     dashapi.DiscussionPatchwork,
+		Type:       dashapi.DiscussionPatch,
+		Subject:    series.Name,
+		BugIDs:     bugIDs,
+		BugReasons: map[string]dashapi.AttachmentReason{},
+	}
+	// Series are only matched to bugs by the Reported-by tags.
+	for _, id := range bugIDs {
+		update.BugReasons[id] = dashapi.AttachReportedBy
+	}
+	for _, msg := range messages {
+		if msg.MsgID == "" {
+			continue
+		}
+		update.Messages = append(update.Messages, dashapi.DiscussionMessage{
+			ID:       msg.MsgID,
+			External: !own[email.CanonicalEmail(msg.Submitter.Email)],
+			Time:     msg.Date.Time,
+			Author:   msg.Submitter.Email,
+		})
+	}
+	// Save the messages in batches, the state is recorded together with the last one.
+	all := update.Messages
+	for len(all) > dashapi.MaxDiscussionMessages {
+		batch := *update
+		batch.Messages = all[:dashapi.MaxDiscussionMessages]
+		if err := mergeDiscussion(c, &batch); err != nil {
+			return err
+		}
+		all = all[dashapi.MaxDiscussionMessages:]
+	}
+	update.Messages = all
+	update.PatchState = patchworkSeriesState(patches)
+	return mergeDiscussion(c, update)
+}
+
+var reportedByRe = regexp.MustCompile(`(?im)^\s*Reported-by:\s*(.+)$`)
+
+// patchworkBugIDs extracts the IDs of the namespace's bugs from the Reported-by tags.
+func patchworkBugIDs(c context.Context, ns string, contents []string) []string {
+	own := ownEmailSet(c)
+	var ret []string
+	for _, content := range contents {
+		for _, match := range reportedByRe.FindAllStringSubmatch(content, -1) {
+			addr := strings.TrimSpace(match[1])
+			_, bugID, err := email.RemoveAddrContext(addr)
+			if err != nil || bugID == "" || !own[email.CanonicalEmail(addr)] {
+				continue
+			}
+			bug, _, err := findBugByReportingID(c, bugID)
+			if err != nil {
+				// The tag may refer to a bug in another instance.
+				log.Infof(c, "patchwork: %v", err)
+				continue
+			}
+			if bug.Namespace == ns {
+				ret = append(ret, bugID)
+			}
+		}
+	}
+	return unique(ret)
+}
+
+func ownEmailSet(c context.Context) map[string]bool {
+	ret := map[string]bool{}
+	for _, addr := range ownEmails(c) {
+		ret[email.CanonicalEmail(addr)] = true
+	}
+	return ret
+}
+
+// patchworkSeriesState returns the state of the first patch that is not yet accepted.
+// The series is only considered accepted once all its patches are.
+func patchworkSeriesState(patches []*patchworkMessage) string {
+	state := ""
+	for _, patch := range patches {
+		if patch.State != patchStateAccepted {
+			return patch.State
+		}
+		state = patch.State
+	}
+	return state
+}
+
+func patchworkFinalState(state string) bool {
+	return state == patchStateAccepted || state == patchStateRejected || state == patchStateSuperseded
+}
+
+func patchworkInstance(cfg *PatchworkConfig) string {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		// The URL is verified during config checking.
+		panic(err)
+	}
+	return u.Host
+}
+
+func patchworkSeriesID(cfg *PatchworkConfig, id int64) string {
+	return fmt.Sprintf("%v/%v", patchworkInstance(cfg), id)
+}
+
+func parsePatchworkSeriesID(id string) (int64, error) {
+	pos := strings.LastIndexByte(id, '/')
+	if pos == -1 {
+		return 0, fmt.Errorf("bad patchwork series ID %q", id)
+	}
+	ret, err := strconv.ParseInt(id[pos+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad patchwork series ID %q: %w", id, err)
+	}
+	return ret, nil
+}
+
+type patchworkDiscussionSource struct{}
+
+// Link returns the web page of the series in the configured project of the Patchwork instance.
+func (patchworkDiscussionSource) Link(id string) string {
+	pos := strings.LastIndexByte(id, '/')
+	if pos == -1 {
+		return ""
+	}
+	cfg := findPatchworkConfig(id[:pos])
+	if cfg == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v/project/%v/list/?series=%v",
+		strings.TrimSuffix(cfg.URL, "/"), url.PathEscape(cfg.Project), id[pos+1:])
+}
+
+// findPatchworkConfig returns the configured project of the Patchwork instance.
+// If there are several, the one of the alphabetically first namespace is used.
+func findPatchworkConfig(instance string) *PatchworkConfig {
+	var namespaces []string
+	for ns := range config.Namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		for i := range config.Namespaces[ns].Patchwork {
+			if cfg := &config.Namespaces[ns].Patchwork[i]; patchworkInstance(cfg) == instance {
+				return cfg
+			}
+		}
+	}
+	return nil
+}
+
+func (patchworkDiscussionSource) NormalizeID(id string) string {
+	return strings.TrimSpace(id)
+}
+
+func (patchworkDiscussionSource) ValidateConfig(cfg *DiscussionEmailConfig) error {
+	return fmt.Errorf("patchwork series are not received over email")
+}
+
+// patchworkClient is the part of the Patchwork REST API that is used by the poller.
+type patchworkClient interface {
+	// Series returns the series of the project that were submitted after since.
+	Series(project string, since time.Time) ([]*patchworkSeries, error)
+	SeriesByID(id int64) (*patchworkSeries, error)
+	Cover(id int64) (*patchworkMessage, error)
+	Patch(id int64) (*patchworkMessage, error)
+	// Comments returns the comments to the patch.
+	Comments(patchID int64) ([]*patchworkMessage, error)
+}
+
+type patchworkSeries struct {
+	ID          int64          `json:"id"`
+	Name        string         `json:"name"`
+	CoverLetter *patchworkRef  `json:"cover_letter"`
+	Patches     []patchworkRef `json:"patches"`
+}
+
+type patchworkRef struct {
+	ID int64 `json:"id"`
+}
+
+// patchworkMessage is a cover letter, a patch or a comment.
+type patchworkMessage struct {
+	ID        int64           `json:"id"`
+	MsgID     string          `json:"msgid"`
+	Date      patchworkTime   `json:"date"`
+	Submitter patchworkPerson `json:"submitter"`
+	Content   string          `json:"content"`
+	State     string          `json:"state"` // only set for patches
+}
+
+type patchworkPerson struct {
+	Email string `json:"email"`
+}
+
+// patchworkTime is a timestamp in the Patchwork API format (UTC without a time zone).
+type patchworkTime struct {
+	time.Time
+}
+
+const patchworkTimeFormat = "2006-01-02T15:04:05"
+
+func (t *patchworkTime) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(patchworkTimeFormat, str)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+var newPatchworkClient = func(c context.Context, cfg *PatchworkConfig) patchworkClient {
+	return &patchworkHTTPClient{
+		ctx:  c,
+		base: strings.TrimSuffix(cfg.URL, "/") + "/api/",
+	}
+}
+
+type patchworkHTTPClient struct {
+	ctx  context.Context
+	base string
+}
+
+func (pw *patchworkHTTPClient) Series(project string, since time.Time) ([]*patchworkSeries, error) {
+	params := url.Values{
+		"project": {project},
+		"since":   {since.UTC().Format(patchworkTimeFormat)},
+	}
+	var ret []*patchworkSeries
+	err := pw.list("series/", params, func(data json.RawMessage) error {
+		s := new(patchworkSeries)
+		ret = append(ret, s)
+		return json.Unmarshal(data, s)
+	})
+	return ret, err
+}
+
+func (pw *patchworkHTTPClient) SeriesByID(id int64) (*patchworkSeries, error) {
+	ret := new(patchworkSeries)
+	return ret, pw.get(fmt.Sprintf("%vseries/%v/", pw.base, id), ret)
+}
+
+func (pw *patchworkHTTPClient) Cover(id int64) (*patchworkMessage, error) {
+	ret := new(patchworkMessage)
+	return ret, pw.get(fmt.Sprintf("%vcovers/%v/", pw.base, id), ret)
+}
+
+func (pw *patchworkHTTPClient) Patch(id int64) (*patchworkMessage, error) {
+	ret := new(patchworkMessage)
+	return ret, pw.get(fmt.Sprintf("%vpatches/%v/", pw.base, id), ret)
+}
+
+func (pw *patchworkHTTPClient) Comments(patchID int64) ([]*patchworkMessage, error) {
+	var ret []*patchworkMessage
+	err := pw.list(fmt.Sprintf("patches/%v/comments/", patchID), nil, func(data json.RawMessage) error {
+		msg := new(patchworkMessage)
+		ret = append(ret, msg)
+		return json.Unmarshal(data, msg)
+	})
+	return ret, err
+}
+
+// Don't let a runaway pagination exhaust the request deadline.
+const patchworkMaxPages = 20
+
+// list fetches all pages of a list API endpoint and calls cb for each item.
+func (pw *patchworkHTTPClient) list(path string, params url.Values, cb func(json.RawMessage) error) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("per_page", "100")
+	next := pw.base + path + "?" + params.Encode()
+	for page := 0; next != "" && page < patchworkMaxPages; page++ {
+		var items []json.RawMessage
+		resp, err := pw.do(next)
+		if err != nil {
+			return err
+		}
+		next = patchworkNextPage(resp.Header.Get("Link"))
+		err = json.NewDecoder(resp.Body).Decode(&items)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse the response: %w", err)
+		}
+		for _, item := range items {
+			if err := cb(item); err != nil {
+				return fmt.Errorf("failed to parse the response: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (pw *patchworkHTTPClient) get(addr string, result interface{}) error {
+	resp, err := pw.do(addr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse the response: %w", err)
+	}
+	return nil
+}
+
+func (pw *patchworkHTTPClient) do(addr string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(pw.ctx, "GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v: %v %s", addr, resp.Status, body)
+	}
+	return resp, nil
+}
+
+var patchworkNextRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// patchworkNextPage extracts the next page URL from the Link header.
+func patchworkNextPage(link string) string {
+	if match := patchworkNextRe.FindStringSubmatch(link); match != nil {
+		return match[1]
+	}
+	return ""
+}
@@ -0,0 +1,260 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestPatchworkPoll(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+	reportedBy, err := email.AddAddrContext(ownEmail(c.ctx), extBugID)
+	c.expectOK(err)
+
+	pw := c.patchwork
+	pw.addSeries(1, "[PATCH] fix the bug", &patchworkMessage{
+		MsgID:     "<patch-1@kernel.org>",
+		Date:      patchworkTime{c.mockedTime},
+		Submitter: patchworkPerson{Email: "dev@kernel.org"},
+		Content:   "Fix the bug.\n\nReported-by: " + reportedBy + "\nSigned-off-by: Dev <dev@kernel.org>\n",
+		State:     "new",
+	})
+	// The series does not mention any of our bugs.
+	pw.addSeries(2, "[PATCH] unrelated", &patchworkMessage{
+		MsgID:     "<patch-2@kernel.org>",
+		Date:      patchworkTime{c.mockedTime},
+		Submitter: patchworkPerson{Email: "dev@kernel.org"},
+		Content:   "Reported-by: someone@kernel.org\n",
+		State:     "new",
+	})
+	pw.addComment(1, &patchworkMessage{
+		MsgID:     "<comment-1@kernel.org>",
+		Date:      patchworkTime{c.mockedTime},
+		Submitter: patchworkPerson{Email: "maintainer@kernel.org"},
+	})
+
+	_, err = c.GET("/cron/patchwork_poll")
+	c.expectOK(err)
+	_, bugKey, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	discussions, err := discussionsForBug(c.ctx, bugKey)
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	d := discussions[0]
+	c.expectEQ(d.ID, "patchwork.test.org/1")
+	c.expectEQ(d.Source, string(dashapi.DiscussionPatchwork))
+	c.expectEQ(d.Type, string(dashapi.DiscussionPatch))
+	c.expectEQ(d.Subject, "[PATCH] fix the bug")
+	c.expectEQ(d.PatchState, "new")
+	c.expectEQ(d.Summary.AllMessages, 2)
+	c.expectEQ(d.link(), "https://patchwork.test.org/project/test/list/?series=1")
+	c.expectDiscussionSummary(extBugID, DiscussionSummary{
+		AllMessages:      2,
+		ExternalMessages: 2,
+		LastMessage:      c.mockedTime,
+		LastPatchMessage: c.mockedTime,
+	})
+
+	// The series is accepted later on.
+	c.advanceTime(time.Hour)
+	pw.setState(1, patchStateAccepted)
+	_, err = c.GET("/cron/patchwork_poll")
+	c.expectOK(err)
+	c.expectOK(db.Get(c.ctx, d.key(c.ctx), d))
+	c.expectEQ(d.PatchState, patchStateAccepted)
+	c.expectEQ(d.Summary.AllMessages, 2)
+	bug, _, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	c.expectEQ(bug.discussionSummary().LastPatchAccepted, c.mockedTime)
+}
+
+func TestPatchworkPollBrokenSeries(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+	reportedBy, err := email.AddAddrContext(ownEmail(c.ctx), extBugID)
+	c.expectOK(err)
+
+	pw := c.patchwork
+	for id := int64(1); id <= 2; id++ {
+		pw.addSeries(id, fmt.Sprintf("[PATCH v%v] fix the bug", id), &patchworkMessage{
+			MsgID:     fmt.Sprintf("<patch-%v@kernel.org>", id),
+			Date:      patchworkTime{c.mockedTime},
+			Submitter: patchworkPerson{Email: "dev@kernel.org"},
+			Content:   "Reported-by: " + reportedBy + "\n",
+			State:     "new",
+		})
+	}
+	_, err = c.GET("/cron/patchwork_poll")
+	c.expectOK(err)
+
+	// The second series can no longer be queried, but the rest of the project is still polled.
+	c.advanceTime(time.Hour)
+	pw.removeSeries(2)
+	pw.setState(1, patchStateAccepted)
+	_, err = c.GET("/cron/patchwork_poll")
+	c.expectOK(err)
+	d := new(Discussion)
+	c.expectOK(db.Get(c.ctx, discussionKey(c.ctx, string(dashapi.DiscussionPatchwork), "patchwork.test.org/1"), d))
+	c.expectEQ(d.PatchState, patchStateAccepted)
+	state := new(PatchworkPoll)
+	cfg := &config.Namespaces["access-public-email"].Patchwork[0]
+	c.expectOK(db.Get(c.ctx, patchworkPollKey(c.ctx, "access-public-email", cfg), state))
+	c.expectEQ(state.LastPoll, c.mockedTime)
+}
+
+func TestPatchworkSeriesState(t *testing.T) {
+	patches := func(states ...string) []*patchworkMessage {
+		var ret []*patchworkMessage
+		for _, state := range states {
+			ret = append(ret, &patchworkMessage{State: state})
+		}
+		return ret
+	}
+	tests := []struct {
+		patches []*patchworkMessage
+		state   string
+	}{
+		{patches(), ""},
+		{patches("new"), "new"},
+		{patches("accepted", "accepted"), "accepted"},
+		{patches("accepted", "under-review", "new"), "under-review"},
+	}
+	for _, test := range tests {
+		if got := patchworkSeriesState(test.patches); got != test.state {
+			t.Errorf("got %q, want %q", got, test.state)
+		}
+	}
+}
+
+func TestPatchworkAPIParsing(t *testing.T) {
+	msg := new(patchworkMessage)
+	err := json.Unmarshal([]byte(`{"id": 10, "msgid": "<a@b>", "date": "2023-01-02T03:04:05",
+		"submitter": {"id": 1, "email": "dev@kernel.org"}, "state": "accepted"}`), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC); !msg.Date.Equal(want) {
+		t.Errorf("got %v, want %v", msg.Date, want)
+	}
+	if msg.MsgID != "<a@b>" || msg.Submitter.Email != "dev@kernel.org" || msg.State != "accepted" {
+		t.Errorf("bad parsing result: %+v", msg)
+	}
+	next := patchworkNextPage(`<https://pw.org/api/series/?page=3>; rel="next", ` +
+		`<https://pw.org/api/series/?page=1>; rel="prev"`)
+	if next != "https://pw.org/api/series/?page=3" {
+		t.Errorf("bad next page: %q", next)
+	}
+	if next := patchworkNextPage(`<https://pw.org/api/series/?page=1>; rel="prev"`); next != "" {
+		t.Errorf("bad next page: %q", next)
+	}
+}
+
+// testPatchwork is an in-memory patchworkClient.
+type testPatchwork struct {
+	mu       sync.Mutex
+	series   map[int64]*patchworkSeries
+	patches  map[int64]*patchworkMessage
+	comments map[int64][]*patchworkMessage
+}
+
+func newTestPatchwork() *testPatchwork {
+	return &testPatchwork{
+		series:   map[int64]*patchworkSeries{},
+		patches:  map[int64]*patchworkMessage{},
+		comments: map[int64][]*patchworkMessage{},
+	}
+}
+
+// addSeries adds a single-patch series, the patch gets the same ID as the series.
+func (pw *testPatchwork) addSeries(id int64, name string, patch *patchworkMessage) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	patch.ID = id
+	pw.series[id] = &patchworkSeries{
+		ID:      id,
+		Name:    name,
+		Patches: []patchworkRef{{ID: id}},
+	}
+	pw.patches[id] = patch
+}
+
+func (pw *testPatchwork) removeSeries(id int64) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	delete(pw.series, id)
+}
+
+func (pw *testPatchwork) addComment(patchID int64, comment *patchworkMessage) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.comments[patchID] = append(pw.comments[patchID], comment)
+}
+
+func (pw *testPatchwork) setState(patchID int64, state string) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.patches[patchID].State = state
+}
+
+func (pw *testPatchwork) Series(project string, since time.Time) ([]*patchworkSeries, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	var ret []*patchworkSeries
+	for _, s := range pw.series {
+		if pw.patches[s.Patches[0].ID].Date.After(since) {
+			ret = append(ret, s)
+		}
+	}
+	return ret, nil
+}
+
+func (pw *testPatchwork) SeriesByID(id int64) (*patchworkSeries, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if s := pw.series[id]; s != nil {
+		return s, nil
+	}
+	return nil, fmt.Errorf("no series %v", id)
+}
+
+func (pw *testPatchwork) Cover(id int64) (*patchworkMessage, error) {
+	return nil, fmt.Errorf("no cover %v", id)
+}
+
+func (pw *testPatchwork) Patch(id int64) (*patchworkMessage, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if p := pw.patches[id]; p != nil {
+		ret := *p
+		return &ret, nil
+	}
+	return nil, fmt.Errorf("no patch %v", id)
+}
+
+func (pw *testPatchwork) Comments(patchID int64) ([]*patchworkMessage, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.comments[patchID], nil
+}
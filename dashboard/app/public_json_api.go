@@ -3,12 +3,41 @@
 
 package main
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // publicApiBugDescription is used to serve the /bug HTTP requests
 // and provide JSON description of the BUG. Backward compatible.
 type PublicAPIBugDescription struct {
 	Version int                         `json:"version"`
 	Title   string                      `json:"title,omitempty"`
 	Crashes []PublicAPICrashDescription `json:"crashes,omitempty"`
+	// CrashesByManager is the crash matrix of the bug.
+	CrashesByManager []PublicAPIManagerCrashes `json:"crashes-by-manager,omitempty"`
+	CVEs             []string                  `json:"cves,omitempty"`
+	// Timeline lists the bug state changes in the chronological order.
+	Timeline []PublicAPIBugEvent `json:"timeline,omitempty"`
+}
+
+type PublicAPIBugEvent struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Actor      string    `json:"actor"`
+	User       string    `json:"user,omitempty"`
+	Cause      string    `json:"cause,omitempty"`
+	Reporting  string    `json:"reporting,omitempty"`
+	Details    string    `json:"details,omitempty"`
+	Backfilled bool      `json:"backfilled,omitempty"`
+}
+
+type PublicAPIManagerCrashes struct {
+	Manager   string `json:"manager"`
+	Arch      string `json:"arch,omitempty"`
+	LastWeek  int    `json:"last-week"`
+	LastMonth int    `json:"last-month"`
+	Total     int64  `json:"total"`
 }
 
 type PublicAPICrashDescription struct {
@@ -25,9 +54,10 @@ type PublicAPICrashDescription struct {
 
 func GetExtAPIDescrForBugPage(bugPage *uiBugPage) *PublicAPIBugDescription {
 	crash := bugPage.Crashes.Crashes[0]
-	return &PublicAPIBugDescription{
+	ret := &PublicAPIBugDescription{
 		Version: 1,
 		Title:   bugPage.Bug.Title,
+		CVEs:    bugPage.Bug.CVEs,
 		Crashes: []PublicAPICrashDescription{{
 			SyzReproducer:      crash.ReproSyzLink,
 			CReproducer:        crash.ReproCLink,
@@ -40,4 +70,125 @@ func GetExtAPIDescrForBugPage(bugPage *uiBugPage) *PublicAPIBugDescription {
 			// TODO: add the Architecture
 		}},
 	}
+	if bugPage.CrashMatrix != nil {
+		for _, row := range bugPage.CrashMatrix.Rows {
+			ret.CrashesByManager = append(ret.CrashesByManager, PublicAPIManagerCrashes{
+				Manager:   row.Manager,
+				Arch:      row.Arch,
+				LastWeek:  row.LastWeek,
+				LastMonth: row.LastMonth,
+				Total:     row.Total,
+			})
+		}
+	}
+	for _, event := range bugPage.Timeline {
+		ret.Timeline = append(ret.Timeline, PublicAPIBugEvent{
+			Time:       event.Time,
+			Type:       string(event.Type),
+			Actor:      string(event.Actor),
+			User:       event.User,
+			Cause:      event.Cause,
+			Reporting:  event.Reporting,
+			Details:    event.Details,
+			Backfilled: event.Backfilled,
+		})
+	}
+	return ret
+}
+
+// PublicAPIFixedBugs is the JSON version of the /fixed_between page.
+type PublicAPIFixedBugs struct {
+	Version   int              `json:"version"`
+	Namespace string           `json:"namespace"`
+	From      string           `json:"from"`
+	To        string           `json:"to"`
+	Bugs      []PublicAPIFixed `json:"bugs"`
+}
+
+type PublicAPIFixed struct {
+	Title string `json:"title"`
+	Link  string `json:"link"`
+	// Fixes are the fix commits released in the range.
+	Fixes []PublicAPIFixCommit `json:"fixes"`
+	// Other are the fix commits released outside of the range or not released yet.
+	Other []PublicAPIFixCommit `json:"other-fixes,omitempty"`
+	CVEs  []string             `json:"cves,omitempty"`
+}
+
+type PublicAPIFixCommit struct {
+	Title   string `json:"title"`
+	Hash    string `json:"hash,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Release string `json:"release,omitempty"`
+}
+
+func makePublicAPIFixedBugs(baseURL, ns string, page *uiFixedBetweenPage) *PublicAPIFixedBugs {
+	ret := &PublicAPIFixedBugs{
+		Version:   1,
+		Namespace: ns,
+		From:      page.From,
+		To:        page.To,
+		Bugs:      []PublicAPIFixed{},
+	}
+	commits := func(list []*uiFixCommit) []PublicAPIFixCommit {
+		var ret []PublicAPIFixCommit
+		for _, com := range list {
+			ret = append(ret, PublicAPIFixCommit{
+				Title:   com.Title,
+				Hash:    com.Hash,
+				Link:    com.Link,
+				Release: com.Release,
+			})
+		}
+		return ret
+	}
+	for _, bug := range page.Bugs {
+		ret.Bugs = append(ret.Bugs, PublicAPIFixed{
+			Title: bug.Title,
+			Link:  baseURL + bug.Link,
+			Fixes: commits(bug.Fixes),
+			Other: commits(bug.Other),
+			CVEs:  bug.CVEs,
+		})
+	}
+	return ret
+}
+
+// PublicAPICrashEnvironment describes everything that is needed to reproduce a crash.
+type PublicAPICrashEnvironment struct {
+	Version           int              `json:"version"`
+	Title             string           `json:"title"`
+	Manager           string           `json:"manager"`
+	Time              time.Time        `json:"time"`
+	KernelRepo        string           `json:"kernel-repo"`
+	KernelBranch      string           `json:"kernel-branch,omitempty"`
+	KernelCommit      string           `json:"kernel-commit"`
+	KernelCommitTitle string           `json:"kernel-commit-title,omitempty"`
+	KernelCommitLink  string           `json:"kernel-commit-link,omitempty"`
+	KernelConfig      string           `json:"kernel-config,omitempty"`
+	SyzkallerCommit   string           `json:"syzkaller-commit"`
+	Compiler          string           `json:"compiler,omitempty"`
+	OS                string           `json:"os"`
+	Arch              string           `json:"arch"`
+	VMArch            string           `json:"vm-arch,omitempty"`
+	MachineInfo       string           `json:"machine-info,omitempty"`
+	Log               string           `json:"log,omitempty"`
+	Report            string           `json:"report,omitempty"`
+	ReproOpts         string           `json:"repro-opts,omitempty"`
+	SyzReproducer     string           `json:"syz-reproducer,omitempty"`
+	CReproducer       string           `json:"c-reproducer,omitempty"`
+	ReproIsRevoked    bool             `json:"repro-is-revoked,omitempty"`
+	Assets            []PublicAPIAsset `json:"assets,omitempty"`
+	VM                *PublicAPIVM     `json:"vm,omitempty"`
+}
+
+type PublicAPIVM struct {
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+type PublicAPIAsset struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
 }
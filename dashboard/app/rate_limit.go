@@ -0,0 +1,269 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Scrapers may hammer the public pages and the JSON exports and degrade the latency for everyone.
+// If RateLimits are configured, requests of not logged in users are limited per IP with token buckets
+// (separate for each endpoint class) and authenticated dashapi clients are limited per client name.
+// The buckets are stored in memcache, so the limits are shared by all instances. Additionally,
+// every instance remembers the recently rejected keys, so that a scraper that keeps sending requests
+// after a 429 response does not cause memcache traffic. If memcache is unavailable, requests are
+// let through: rate limiting must not make the dashboard unavailable.
+
+// ErrRateLimited is returned by the API handlers if the client exceeded its quota.
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+}
+
+func (err *ErrRateLimited) Error() string {
+	return fmt.Sprintf("too many requests, retry after %v", err.RetryAfter)
+}
+
+// rateBucket is the stored token bucket state.
+type rateBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// take consumes one token from the bucket. It returns 0 if the request is allowed
+// and the time after which the next token is available otherwise.
+func (b *rateBucket) take(limit RateLimit, now time.Time) time.Duration {
+	rate := float64(limit.PerMinute) / 60 // tokens per second
+	burst := float64(limit.Burst)
+	if b.Updated.IsZero() {
+		b.Tokens = burst
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+elapsed.Seconds()*rate)
+	}
+	b.Updated = now
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - b.Tokens) / rate * float64(time.Second)))
+}
+
+type rateLimitStore interface {
+	// update atomically applies fn to the bucket stored under the key.
+	update(c context.Context, key string, expiration time.Duration, fn func(*rateBucket)) error
+}
+
+type memcacheRateLimitStore struct{}
+
+func (memcacheRateLimitStore) update(c context.Context, key string, expiration time.Duration,
+	fn func(*rateBucket)) error {
+	const attempts = 3
+	var err error
+	for i := 0; i < attempts; i++ {
+		bucket := new(rateBucket)
+		var item *memcache.Item
+		item, err = memcache.Gob.Get(c, key, bucket)
+		if err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
+		fn(bucket)
+		if item == nil {
+			item = &memcache.Item{Key: key}
+		}
+		item.Object = bucket
+		item.Expiration = expiration
+		if err == memcache.ErrCacheMiss {
+			err = memcache.Gob.Add(c, item)
+		} else {
+			err = memcache.Gob.CompareAndSwap(c, item)
+		}
+		if err != memcache.ErrNotStored && err != memcache.ErrCASConflict {
+			return err
+		}
+	}
+	return err
+}
+
+// rateLimitCacheSize is the max number of rejected keys remembered by an instance.
+const rateLimitCacheSize = 10000
+
+type rateLimiter struct {
+	cfg       *RateLimitConfig
+	allowlist []*net.IPNet
+	store     rateLimitStore
+	// The hooks below are replaced in tests.
+	now           func(c context.Context) time.Time
+	authenticated func(c context.Context) bool
+	errorf        func(c context.Context, format string, args ...interface{})
+
+	mu       sync.Mutex
+	rejected map[string]time.Time
+}
+
+// publicRateLimiter is initialized together with the HTTP handlers.
+var publicRateLimiter *rateLimiter
+
+func newRateLimiter(cfg *RateLimitConfig, store rateLimitStore) *rateLimiter {
+	if cfg == nil {
+		return nil
+	}
+	rl := &rateLimiter{
+		cfg:   cfg,
+		store: store,
+		now:   timeNow,
+		authenticated: func(c context.Context) bool {
+			return user.Current(c) != nil
+		},
+		errorf:   log.Errorf,
+		rejected: make(map[string]time.Time),
+	}
+	for _, addr := range cfg.Allowlist {
+		rl.allowlist = append(rl.allowlist, parseIPNet(addr))
+	}
+	return rl
+}
+
+// parseIPNet accepts both single addresses and CIDR ranges.
+func parseIPNet(addr string) *net.IPNet {
+	if _, ipNet, err := net.ParseCIDR(addr); err == nil {
+		return ipNet
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil
+	}
+	bits := 8 * len(ip)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+// handleRateLimit limits the requests of not logged in users.
+func handleRateLimit(fn contextHandler) contextHandler {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) error {
+		return publicRateLimiter.handle(fn)(c, w, r)
+	}
+}
+
+func (rl *rateLimiter) handle(fn contextHandler) contextHandler {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) error {
+		if rl == nil {
+			return fn(c, w, r)
+		}
+		class := rateLimitClass(r)
+		limit, ok := rl.cfg.Classes[class]
+		ip := requestIP(r)
+		if !ok || rl.allowlisted(ip) || rl.authenticated(c) {
+			return fn(c, w, r)
+		}
+		if retry := rl.take(c, fmt.Sprintf("ratelimit-%v-%v", class, ip), limit); retry != 0 {
+			writeTooManyRequests(w, retry)
+			return nil
+		}
+		return fn(c, w, r)
+	}
+}
+
+// checkClient enforces the quota of an authenticated API client.
+func (rl *rateLimiter) checkClient(c context.Context, client string) error {
+	if rl == nil {
+		return nil
+	}
+	limit, ok := rl.cfg.APIClients[client]
+	if !ok {
+		if rl.cfg.APIDefault == nil {
+			return nil
+		}
+		limit = *rl.cfg.APIDefault
+	}
+	if retry := rl.take(c, "ratelimit-api-"+client, limit); retry != 0 {
+		return &ErrRateLimited{RetryAfter: retry}
+	}
+	return nil
+}
+
+// take returns the time to wait before the next request, or 0 if the request is allowed.
+func (rl *rateLimiter) take(c context.Context, key string, limit RateLimit) time.Duration {
+	now := rl.now(c)
+	rl.mu.Lock()
+	until, rejected := rl.rejected[key]
+	rl.mu.Unlock()
+	if rejected && now.Before(until) {
+		return until.Sub(now)
+	}
+	var retry time.Duration
+	// The bucket is full again after this period, so there's no point in storing it longer.
+	expiration := time.Duration(float64(limit.Burst)/float64(limit.PerMinute)*float64(time.Minute)) +
+		time.Minute
+	err := rl.store.update(c, key, expiration, func(bucket *rateBucket) {
+		retry = bucket.take(limit, now)
+	})
+	if err != nil {
+		// Fail open.
+		rl.errorf(c, "rate limiting of %v failed: %v", key, err)
+		return 0
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if retry == 0 {
+		delete(rl.rejected, key)
+		return 0
+	}
+	if len(rl.rejected) >= rateLimitCacheSize {
+		rl.rejected = make(map[string]time.Time)
+	}
+	rl.rejected[key] = now.Add(retry)
+	return retry
+}
+
+func (rl *rateLimiter) allowlisted(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, ipNet := range rl.allowlist {
+		if ipNet.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func rateLimitClass(r *http.Request) RateLimitClass {
+	switch {
+	case isJSONRequested(r):
+		return RateLimitJSON
+	case r.URL.Path == "/text" || r.URL.Path == "/shared/text" || strings.HasPrefix(r.URL.Path, "/x/"):
+		return RateLimitText
+	}
+	return RateLimitPages
+}
+
+func requestIP(r *http.Request) string {
+	// App Engine passes the client address in this header.
+	if ip := r.Header.Get("X-Appengine-User-Ip"); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retry time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(retry.Seconds()))))
+	http.Error(w, "429 Too Many Requests", http.StatusTooManyRequests)
+}
@@ -0,0 +1,211 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type testRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]rateBucket
+	updates int
+	broken  bool
+}
+
+func (store *testRateLimitStore) update(c context.Context, key string, expiration time.Duration,
+	fn func(*rateBucket)) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.updates++
+	if store.broken {
+		return errors.New("memcache is down")
+	}
+	bucket := store.buckets[key]
+	fn(&bucket)
+	store.buckets[key] = bucket
+	return nil
+}
+
+type rateLimitTest struct {
+	t      *testing.T
+	now    time.Time
+	user   bool
+	store  *testRateLimitStore
+	rl     *rateLimiter
+	served int
+	errors int
+}
+
+func newRateLimitTest(t *testing.T, cfg *RateLimitConfig) *rateLimitTest {
+	checkRateLimits(cfg, map[string]bool{"ci": true, "ci2": true})
+	test := &rateLimitTest{
+		t:     t,
+		now:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		store: &testRateLimitStore{buckets: make(map[string]rateBucket)},
+	}
+	test.rl = newRateLimiter(cfg, test.store)
+	test.rl.now = func(c context.Context) time.Time { return test.now }
+	test.rl.authenticated = func(c context.Context) bool { return test.user }
+	test.rl.errorf = func(c context.Context, format string, args ...interface{}) { test.errors++ }
+	return test
+}
+
+// get returns the response status and the Retry-After header.
+func (test *rateLimitTest) get(ip, url string) (int, string) {
+	handler := test.rl.handle(func(c context.Context, w http.ResponseWriter, r *http.Request) error {
+		test.served++
+		return nil
+	})
+	r := httptest.NewRequest("GET", url, nil)
+	r.Header.Set("X-Appengine-User-Ip", ip)
+	w := httptest.NewRecorder()
+	if err := handler(context.Background(), w, r); err != nil {
+		test.t.Fatal(err)
+	}
+	return w.Code, w.Header().Get("Retry-After")
+}
+
+func (test *rateLimitTest) expect(ip, url string, status int, retryAfter string) {
+	test.t.Helper()
+	gotStatus, gotRetry := test.get(ip, url)
+	if gotStatus != status || gotRetry != retryAfter {
+		test.t.Fatalf("%v %v: got %v (Retry-After %q), want %v (Retry-After %q)",
+			ip, url, gotStatus, gotRetry, status, retryAfter)
+	}
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	test := newRateLimitTest(t, &RateLimitConfig{
+		Classes: map[RateLimitClass]RateLimit{
+			RateLimitPages: {PerMinute: 6, Burst: 3},
+			RateLimitJSON:  {PerMinute: 1},
+		},
+	})
+	for i := 0; i < 3; i++ {
+		test.expect("1.1.1.1", "/upstream", http.StatusOK, "")
+	}
+	test.expect("1.1.1.1", "/upstream", http.StatusTooManyRequests, "10")
+	// Other IPs and other classes have own buckets, texts are not limited at all.
+	test.expect("2.2.2.2", "/upstream", http.StatusOK, "")
+	test.expect("1.1.1.1", "/upstream?json=1", http.StatusOK, "")
+	test.expect("1.1.1.1", "/upstream?json=1", http.StatusTooManyRequests, "60")
+	test.expect("1.1.1.1", "/text?tag=CrashLog&x=1", http.StatusOK, "")
+
+	// The rejected IP is remembered by the instance and does not cause memcache traffic.
+	updates := test.store.updates
+	test.now = test.now.Add(5 * time.Second)
+	test.expect("1.1.1.1", "/upstream", http.StatusTooManyRequests, "5")
+	if test.store.updates != updates {
+		t.Fatalf("rejected request went to memcache")
+	}
+	// The tokens come back with time, but the burst is limited.
+	test.now = test.now.Add(5 * time.Second)
+	test.expect("1.1.1.1", "/upstream", http.StatusOK, "")
+	test.expect("1.1.1.1", "/upstream", http.StatusTooManyRequests, "10")
+	test.now = test.now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		test.expect("1.1.1.1", "/upstream", http.StatusOK, "")
+	}
+	test.expect("1.1.1.1", "/upstream", http.StatusTooManyRequests, "10")
+	if test.served != 10 {
+		t.Fatalf("served %v requests, want 10", test.served)
+	}
+}
+
+func TestRateLimitExceptions(t *testing.T) {
+	test := newRateLimitTest(t, &RateLimitConfig{
+		Classes: map[RateLimitClass]RateLimit{
+			RateLimitPages: {PerMinute: 1},
+		},
+		Allowlist: []string{"10.0.0.0/8", "2001:db8::1"},
+	})
+	for i := 0; i < 5; i++ {
+		test.expect("10.1.2.3", "/upstream", http.StatusOK, "")
+		test.expect("2001:db8::1", "/upstream", http.StatusOK, "")
+	}
+	test.expect("2001:db8::2", "/upstream", http.StatusOK, "")
+	test.expect("2001:db8::2", "/upstream", http.StatusTooManyRequests, "60")
+	// Logged in users are not limited.
+	test.user = true
+	test.expect("2001:db8::2", "/upstream", http.StatusOK, "")
+}
+
+func TestRateLimitMemcacheOutage(t *testing.T) {
+	test := newRateLimitTest(t, &RateLimitConfig{
+		Classes: map[RateLimitClass]RateLimit{
+			RateLimitPages: {PerMinute: 1},
+		},
+		APIDefault: &RateLimit{PerMinute: 1},
+	})
+	test.store.broken = true
+	for i := 0; i < 10; i++ {
+		test.expect("1.1.1.1", "/upstream", http.StatusOK, "")
+		if err := test.rl.checkClient(context.Background(), "ci"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if test.errors != 20 {
+		t.Fatalf("got %v errors, want 20", test.errors)
+	}
+	test.store.broken = false
+	test.expect("1.1.1.1", "/upstream", http.StatusOK, "")
+	test.expect("1.1.1.1", "/upstream", http.StatusTooManyRequests, "60")
+}
+
+func TestRateLimitAPIClients(t *testing.T) {
+	test := newRateLimitTest(t, &RateLimitConfig{
+		APIClients: map[string]RateLimit{
+			"ci": {PerMinute: 60, Burst: 100},
+		},
+	})
+	c := context.Background()
+	for i := 0; i < 100; i++ {
+		if err := test.rl.checkClient(c, "ci"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := test.rl.checkClient(c, "ci")
+	var rateErr *ErrRateLimited
+	if !errors.As(err, &rateErr) || rateErr.RetryAfter != time.Second {
+		t.Fatalf("got %v, want rate limit error", err)
+	}
+	// Clients without a quota are not limited if there is no default one.
+	for i := 0; i < 200; i++ {
+		if err := test.rl.checkClient(c, "ci2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Public pages are not limited if there are no limits for them.
+	test.expect("1.1.1.1", "/upstream", http.StatusOK, "")
+}
+
+func TestCheckRateLimits(t *testing.T) {
+	tests := []*RateLimitConfig{
+		{Classes: map[RateLimitClass]RateLimit{"foo": {PerMinute: 1}}},
+		{Classes: map[RateLimitClass]RateLimit{RateLimitText: {}}},
+		{Allowlist: []string{"1.2.3.4/64"}},
+		{APIClients: map[string]RateLimit{"unknown": {PerMinute: 1}}},
+		{APIDefault: &RateLimit{PerMinute: 1, Burst: -1}},
+	}
+	for i, cfg := range tests {
+		failed := func() (failed bool) {
+			defer func() {
+				failed = recover() != nil
+			}()
+			checkRateLimits(cfg, map[string]bool{"ci": true})
+			return false
+		}()
+		if !failed {
+			t.Errorf("#%v: bad config was accepted", i)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+	"google.golang.org/appengine/v2/taskqueue"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Admins can put the dashboard into the read-only mode for datastore maintenance windows.
+// In this mode the pages are rendered as usual (with a banner), but nothing is written:
+//   - best-effort writes (access counters, metrics flushes) are skipped;
+//   - UI actions and API calls that can be retried by the caller fail with ErrReadOnly;
+//   - crash uploads and other required API writes (see apiReadOnlyPolicies) and the incoming
+//     emails are queued onto the read-only-replay queue and replayed once the mode is turned off;
+//   - cron jobs do nothing, so e.g. the new reports are sent after the mode is off.
+// The flag is stored in the ReadOnlyMode entity and is cached in memcache, so that it can be
+// checked on every request. If both memcache and datastore are unavailable, the mode is assumed off.
+
+const (
+	readOnlyQueueName     = "read-only-replay"
+	readOnlyCacheKey      = "read-only-mode"
+	readOnlyCacheDuration = time.Minute
+)
+
+// ReadOnlyMode is the global read-only flag, there's only one entity of this kind.
+type ReadOnlyMode struct {
+	Enabled bool
+	Reason  string
+	SetBy   string
+	Time    time.Time
+}
+
+func readOnlyKey(c context.Context) *db.Key {
+	return db.NewKey(c, "ReadOnlyMode", "global", 0, nil)
+}
+
+// loadReadOnlyMode returns the current state of the read-only flag, it never fails.
+func loadReadOnlyMode(c context.Context) *ReadOnlyMode {
+	mode := new(ReadOnlyMode)
+	if _, err := memcache.Gob.Get(c, readOnlyCacheKey, mode); err == nil {
+		return mode
+	} else if err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to get the read-only mode from memcache: %v", err)
+	}
+	if err := db.Get(c, readOnlyKey(c), mode); err != nil && err != db.ErrNoSuchEntity {
+		log.Errorf(c, "failed to get the read-only mode: %v", err)
+		return new(ReadOnlyMode)
+	}
+	item := &memcache.Item{
+		Key:        readOnlyCacheKey,
+		Object:     mode,
+		Expiration: readOnlyCacheDuration,
+	}
+	if err := memcache.Gob.Set(c, item); err != nil {
+		log.Errorf(c, "failed to cache the read-only mode: %v", err)
+	}
+	return mode
+}
+
+func isReadOnly(c context.Context) bool {
+	return loadReadOnlyMode(c).Enabled
+}
+
+// setReadOnlyMode is the only write that is allowed in the read-only mode.
+func setReadOnlyMode(c context.Context, enabled bool, reason string) error {
+	mode := &ReadOnlyMode{
+		Enabled: enabled,
+		Reason:  reason,
+		Time:    timeNow(c),
+	}
+	if u := user.Current(c); u != nil {
+		mode.SetBy = u.Email
+	}
+	if _, err := db.Put(c, readOnlyKey(c), mode); err != nil {
+		return fmt.Errorf("failed to put the read-only mode: %w", err)
+	}
+	// The cached value has no expiration, so that the mode is in effect even if datastore
+	// becomes completely unavailable.
+	if err := memcache.Gob.Set(c, &memcache.Item{Key: readOnlyCacheKey, Object: mode}); err != nil {
+		return fmt.Errorf("failed to cache the read-only mode: %w", err)
+	}
+	return nil
+}
+
+func handleReadOnlyAction(c context.Context, r *http.Request) error {
+	enable := r.FormValue("enable") == "1"
+	if enable && r.FormValue("reason") == "" {
+		return fmt.Errorf("the read-only mode needs a reason: %w", ErrClientBadRequest)
+	}
+	return setReadOnlyMode(c, enable, r.FormValue("reason"))
+}
+
+// handleWriteAction wraps UI handlers that only exist to modify the state.
+func handleWriteAction(fn contextHandler) contextHandler {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) error {
+		if isReadOnly(c) {
+			return ErrReadOnly
+		}
+		return fn(c, w, r)
+	}
+}
+
+// handleWriteActions wraps UI handlers that render a page, but modify the state if given an action.
+func handleWriteActions(fn contextHandler, readActions ...string) contextHandler {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) error {
+		if action := r.FormValue("action"); action != "" && !stringInList(readActions, action) && isReadOnly(c) {
+			return ErrReadOnly
+		}
+		return fn(c, w, r)
+	}
+}
+
+// handleCron wraps the cron handlers, they are skipped in the read-only mode.
+func handleCron(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := appengine.NewContext(r)
+		if isReadOnly(c) {
+			log.Infof(c, "skipping %v in the read-only mode", r.URL.Path)
+			return
+		}
+		fn(w, r)
+	}
+}
+
+type readOnlyPolicy int
+
+const (
+	// The method does not write anything, it works as usual.
+	readOnlyAllow readOnlyPolicy = iota
+	// The method is skipped with an empty reply, the caller will poll again later.
+	readOnlySkip
+	// The request is queued and replayed later, the caller gets an empty reply.
+	readOnlyQueued
+	// The request fails with ErrReadOnly and the caller needs to retry it.
+	readOnlyReject
+)
+
+// apiReadOnlyPolicies define what happens with the API calls in the read-only mode.
+// The methods that are not listed here are rejected.
+var apiReadOnlyPolicies = map[string]readOnlyPolicy{
+	"log_error":             readOnlyAllow,
+	"builder_poll":          readOnlyAllow,
+	"need_repro":            readOnlyAllow,
+	"commit_poll":           readOnlyAllow,
+	"bug_list":              readOnlyAllow,
+	"load_bug":              readOnlyAllow,
+	"load_full_bug":         readOnlyAllow,
+	"load_bisections":       readOnlyAllow,
+	"needed_assets":         readOnlyAllow,
+	"reporting_poll_closed": readOnlyAllow,
+	// The polled reports and jobs would be lost since their results can't be recorded.
+	"reporting_poll_bugs":   readOnlySkip,
+	"reporting_poll_notifs": readOnlySkip,
+	"job_poll":              readOnlySkip,
+	"manager_stats":         readOnlySkip,
+	// The managers and the CI don't retry these.
+	"upload_build":                readOnlyQueued,
+	"report_build_error":          readOnlyQueued,
+	"report_crash":                readOnlyQueued,
+	"report_failed_repro":         readOnlyQueued,
+	"manager_descriptions":        readOnlyQueued,
+	"upload_commits":              readOnlyQueued,
+	"add_build_assets":            readOnlyQueued,
+	"upload_backports":            readOnlyQueued,
+	"upload_releases":             readOnlyQueued,
+	"upload_watch_results":        readOnlyQueued,
+	"report_external_observation": readOnlyQueued,
+	"job_done":                    readOnlyQueued,
+	"save_discussion":             readOnlyQueued,
+	"report_discussion":           readOnlyQueued,
+	// The queued report_corpus gets an empty reply, so no imports are handed out meanwhile.
+	"report_corpus":      readOnlyQueued,
+	"corpus_import_done": readOnlyQueued,
+}
+
+// apiReadOnly handles the API call in the read-only mode, it returns false if the call must proceed.
+func apiReadOnly(c context.Context, ns, method, payload string) (bool, error) {
+	if !isReadOnly(c) {
+		return false, nil
+	}
+	policy, ok := apiReadOnlyPolicies[method]
+	if !ok {
+		policy = readOnlyReject
+	}
+	switch policy {
+	case readOnlyAllow:
+		return false, nil
+	case readOnlySkip:
+		return true, nil
+	case readOnlyQueued:
+		params := url.Values{
+			"ns":      {ns},
+			"method":  {method},
+			"payload": {payload},
+		}
+		task := taskqueue.NewPOSTTask("/tasks/replay_api", params)
+		if err := addReadOnlyTask(c, task); err != nil {
+			return true, err
+		}
+		log.Infof(c, "queued api %q in the read-only mode", method)
+		return true, nil
+	default:
+		return true, ErrReadOnly
+	}
+}
+
+// handleReplayAPI executes the API calls queued in the read-only mode.
+func handleReplayAPI(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	if isReadOnly(c) {
+		// The task queue will retry the task later.
+		http.Error(w, ErrReadOnly.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	ns, method := r.PostFormValue("ns"), r.PostFormValue("method")
+	payload, err := ungzipPayload(r.PostFormValue("payload"))
+	if err == nil {
+		if handler := apiHandlers[method]; handler != nil {
+			_, err = handler(c, r, payload)
+		} else if nsHandler := apiNamespaceHandlers[method]; nsHandler != nil && ns != "" {
+			_, err = nsHandler(c, ns, r, payload)
+		} else {
+			err = fmt.Errorf("unknown api method %q", method)
+		}
+	}
+	if err != nil {
+		log.Errorf(c, "failed to replay api %q: %v", method, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Infof(c, "replayed api %q", method)
+}
+
+// queueReadOnlyRequest queues the raw request body to be posted to the path after the read-only mode.
+// It returns false if the request must be handled now.
+func queueReadOnlyRequest(c context.Context, w http.ResponseWriter, r *http.Request, path string, body []byte) bool {
+	if !isReadOnly(c) {
+		return false
+	}
+	if fromTaskQueue(r) {
+		// The task queue will retry the task later.
+		http.Error(w, ErrReadOnly.Error(), http.StatusServiceUnavailable)
+		return true
+	}
+	task := &taskqueue.Task{
+		Path:    path,
+		Payload: body,
+		Method:  "POST",
+	}
+	if err := addReadOnlyTask(c, task); err != nil {
+		log.Errorf(c, "failed to queue %v: %v", r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	log.Infof(c, "queued %v in the read-only mode", r.URL.Path)
+	return true
+}
+
+// App Engine strips this header from the external requests.
+func fromTaskQueue(r *http.Request) bool {
+	return r.Header.Get("X-AppEngine-QueueName") != ""
+}
+
+var readOnlyTasksKey = "tasks queued in the read-only mode"
+
+// contextWithReadOnlyTasks makes addReadOnlyTask pass the tasks to the callback instead of the queue.
+func contextWithReadOnlyTasks(c context.Context, add func(*taskqueue.Task)) context.Context {
+	return context.WithValue(c, &readOnlyTasksKey, add)
+}
+
+func addReadOnlyTask(c context.Context, task *taskqueue.Task) error {
+	if add, ok := c.Value(&readOnlyTasksKey).(func(*taskqueue.Task)); ok {
+		add(task)
+		return nil
+	}
+	if _, err := taskqueue.Add(c, task, readOnlyQueueName); err != nil {
+		return fmt.Errorf("failed to queue the task: %w", err)
+	}
+	return nil
+}
+
+type uiReadOnlyBanner struct {
+	Reason string
+	Since  time.Time
+}
+
+func makeReadOnlyBanner(c context.Context) *uiReadOnlyBanner {
+	mode := loadReadOnlyMode(c)
+	if !mode.Enabled {
+		return nil
+	}
+	return &uiReadOnlyBanner{
+		Reason: mode.Reason,
+		Since:  mode.Time,
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/aetest"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/taskqueue"
+	"google.golang.org/appengine/v2/user"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	var tasks []*taskqueue.Task
+	c.transformContext = func(c context.Context) context.Context {
+		return contextWithReadOnlyTasks(c, func(task *taskqueue.Task) {
+			tasks = append(tasks, task)
+		})
+	}
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	crash1 := testCrash(build, 1)
+	client.ReportCrash(crash1)
+	sender := c.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+
+	checkResponseStatusCode(c, AccessAdmin, "/admin?action=read_only&enable=1", http.StatusBadRequest)
+	_, err = c.GET("/admin?action=read_only&enable=1&reason=datastore+migration")
+	c.expectOK(err)
+
+	// The new crash and the email are queued, not lost.
+	crash2 := testCrash(build, 2)
+	client.ReportCrash(crash2)
+	c.incomingEmail(sender, "#syz invalid")
+	c.expectEQ(len(tasks), 2)
+	c.expectEQ(countBugs(c), 1)
+	bug1, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug1.Status, BugStatusOpen)
+
+	// The pages are still rendered, but the actions fail.
+	page, err := c.AuthGET(AccessPublic, "/access-public-email")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "The dashboard is in read-only mode"))
+	c.expectTrue(strings.Contains(string(page), "datastore migration"))
+	checkResponseStatusCode(c, AccessUser, "/minimize?id="+bug1.keyHash(), http.StatusServiceUnavailable)
+	_, err = c.GET("/admin?action=memcache_flush")
+	c.expectOK(err)
+	checkResponseStatusCode(c, AccessAdmin, "/admin?action=rename_bug", http.StatusServiceUnavailable)
+
+	// The tasks are retried until the mode is off.
+	for _, task := range tasks {
+		c.expectEQ(c.runTask(task), http.StatusServiceUnavailable)
+	}
+	_, err = c.GET("/admin?action=read_only&enable=0")
+	c.expectOK(err)
+	for _, task := range tasks {
+		c.expectEQ(c.runTask(task), http.StatusOK)
+	}
+	c.expectEQ(countBugs(c), 2)
+	bug1, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug1.Status, BugStatusInvalid)
+	page, err = c.AuthGET(AccessPublic, "/access-public-email")
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), "read-only mode"))
+}
+
+func countBugs(c *Ctx) int {
+	count, err := db.NewQuery("Bug").Count(c.ctx)
+	c.expectOK(err)
+	return count
+}
+
+// runTask executes the task like the task queue does and returns the HTTP status.
+func (c *Ctx) runTask(task *taskqueue.Task) int {
+	r, err := c.inst.NewRequest(task.Method, task.Path, bytes.NewReader(task.Payload))
+	c.expectOK(err)
+	for key, val := range task.Header {
+		r.Header[key] = val
+	}
+	r.Header.Set("X-AppEngine-QueueName", readOnlyQueueName)
+	r = registerRequest(r, c)
+	r = r.WithContext(c.transformContext(r.Context()))
+	aetest.Login(&user.User{Email: "user@syzkaller.com", AuthDomain: "gmail.com", Admin: true}, r)
+	w := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(w, r)
+	return w.Code
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// If a fixed bug crashes again on a kernel that already contains the fix, the new bug
+// is linked to the old one with RegressionOf, so that the context of the old bug is not lost.
+
+// findRegressedBug returns the latest bug with the title if the crashed build contains its fix.
+func findRegressedBug(c context.Context, ns, title string, build *Build) (*Bug, error) {
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("Title=", title).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	var latest *Bug
+	for _, bug := range bugs {
+		if latest == nil || bug.Seq > latest.Seq {
+			latest = bug
+		}
+	}
+	if latest == nil || !buildContainsFix(latest, build) {
+		return nil, nil
+	}
+	return latest, nil
+}
+
+// buildContainsFix checks whether the build already contained the fix of the bug.
+// PatchedOn lists the managers whose builds had all fix commits, and builds of a manager
+// only move forward, so all builds of such managers uploaded after the bug was closed contain the fix.
+func buildContainsFix(bug *Bug, build *Build) bool {
+	return bug.Status == BugStatusFixed &&
+		stringInList(bug.PatchedOn, build.Manager) &&
+		!build.Time.Before(bug.Closed)
+}
+
+func loadRegressedBug(c context.Context, bug *Bug) (*Bug, error) {
+	if bug.RegressionOf == "" {
+		return nil, nil
+	}
+	old := new(Bug)
+	if err := db.Get(c, db.NewKey(c, "Bug", bug.RegressionOf, 0, nil), old); err != nil {
+		return nil, fmt.Errorf("failed to get bug %v: %w", bug.RegressionOf, err)
+	}
+	return old, nil
+}
+
+// bugRegression returns the information about the bug that this bug is a regression of.
+func bugRegression(c context.Context, bug *Bug, accessLevel AccessLevel) (*dashapi.BugRegression, error) {
+	old, err := loadRegressedBug(c, bug)
+	if err != nil || old == nil || accessLevel < old.sanitizeAccess(accessLevel) {
+		return nil, err
+	}
+	ret := &dashapi.BugRegression{
+		Title: old.displayTitle(),
+		Link:  appURL(c) + bugLink(old.keyHash()),
+	}
+	for i, title := range old.Commits {
+		ret.FixCommits = append(ret.FixCommits, dashapi.Commit{
+			Title: title,
+			Hash:  old.getCommitInfo(i).Hash,
+		})
+	}
+	return ret, nil
+}
+
+func loadRegressionsForBug(c context.Context, r *http.Request, bug *Bug, state *ReportingState,
+	managers []string) (*uiBugGroup, error) {
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("RegressionOf=", bug.keyHash()).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	var results []*uiBug
+	accessLevel := namespaceAccessLevel(c, r, bug.Namespace)
+	for _, regression := range bugs {
+		if accessLevel < regression.sanitizeAccess(accessLevel) {
+			continue
+		}
+		results = append(results, createUIBug(c, regression, state, managers))
+	}
+	return &uiBugGroup{
+		Now:        timeNow(c),
+		Caption:    "regressions",
+		ShowStatus: true,
+		Bugs:       results,
+	}, nil
+}
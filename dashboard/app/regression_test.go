@@ -0,0 +1,141 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestBuildContainsFix(t *testing.T) {
+	closed := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	bug := &Bug{
+		Status:    BugStatusFixed,
+		Closed:    closed,
+		PatchedOn: []string{"manager1", "manager2"},
+	}
+	tests := []struct {
+		build    *Build
+		status   int
+		contains bool
+	}{
+		{&Build{Manager: "manager1", Time: closed}, BugStatusFixed, true},
+		{&Build{Manager: "manager2", Time: closed.Add(time.Hour)}, BugStatusFixed, true},
+		// The build was uploaded before the fix reached all managers.
+		{&Build{Manager: "manager1", Time: closed.Add(-time.Hour)}, BugStatusFixed, false},
+		// A new manager that has never reported the fix commits.
+		{&Build{Manager: "manager3", Time: closed.Add(time.Hour)}, BugStatusFixed, false},
+		{&Build{Manager: "manager1", Time: closed.Add(time.Hour)}, BugStatusInvalid, false},
+	}
+	for i, test := range tests {
+		bug.Status = test.status
+		if got := buildContainsFix(bug, test.build); got != test.contains {
+			t.Errorf("test #%v: got %v, want %v", i, got, test.contains)
+		}
+	}
+}
+
+func TestRegressionTemplate(t *testing.T) {
+	body := new(bytes.Buffer)
+	err := mailTemplates.ExecuteTemplate(body, "mail_bug.txt", &dashapi.BugReport{
+		First: true,
+		Link:  "https://testapp.appspot.com/bug?extid=abcd",
+		RegressionOf: &dashapi.BugRegression{
+			Title: "WARNING in foo",
+			Link:  "https://testapp.appspot.com/bug?id=1234",
+			FixCommits: []dashapi.Commit{
+				{Hash: "1234567890abcdef", Title: "foo: fix the crash"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+The issue looks like a regression: it happened on a kernel that contains
+the fix of a previously reported issue with the same title.
+previously fixed by commit 1234567890ab ("foo: fix the crash")
+report: https://testapp.appspot.com/bug?id=1234
+`
+	if !strings.Contains(body.String(), want) {
+		t.Fatalf("no regression info in:\n%s", body.String())
+	}
+}
+
+func TestRegressionOfFixedBug(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+
+	build2 := testBuild(1)
+	build2.ID = "build1-fixed"
+	build2.FixCommits = []dashapi.Commit{{Title: "foo: fix1", BugIDs: []string{rep.ID}}}
+	c.client.UploadBuild(build2)
+	c.expectOK(c.client.UploadCommits([]dashapi.Commit{{Hash: "hash1", Title: "foo: fix1"}}))
+	oldBug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(oldBug.Status, BugStatusFixed)
+
+	// The same crash on the kernel with the fix.
+	c.advanceTime(time.Hour)
+	c.client.ReportCrash(testCrash(build2, 1))
+	rep2 := c.client.pollBug()
+	c.expectNE(rep2.ID, rep.ID)
+	c.expectEQ(rep2.RegressionOf, &dashapi.BugRegression{
+		Title: oldBug.displayTitle(),
+		Link:  appURL(c.ctx) + bugLink(oldBug.keyHash()),
+		FixCommits: []dashapi.Commit{
+			{Title: "foo: fix1", Hash: "hash1"},
+		},
+	})
+	newBug, _, _ := c.loadBug(rep2.ID)
+	c.expectEQ(newBug.RegressionOf, oldBug.keyHash())
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Regressions (1)")))
+	page, err = c.AuthGET(AccessAdmin, "/bug?extid="+rep2.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Regression of")))
+}
+
+func TestRegressionFixNotInBuild(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+
+	c.advanceTime(time.Hour)
+	build2 := testBuild(1)
+	build2.ID = "build1-fixed"
+	build2.FixCommits = []dashapi.Commit{{Title: "foo: fix1", BugIDs: []string{rep.ID}}}
+	c.client.UploadBuild(build2)
+	oldBug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(oldBug.Status, BugStatusFixed)
+
+	// The crash still comes from the old build that doesn't have the fix,
+	// so the title collision is not a regression.
+	c.client.ReportCrash(crash)
+	rep2 := c.client.pollBug()
+	c.expectNE(rep2.ID, rep.ID)
+	c.expectTrue(rep2.RegressionOf == nil)
+	newBug, _, _ := c.loadBug(rep2.ID)
+	c.expectEQ(newBug.RegressionOf, "")
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("Regressions (")))
+}
@@ -0,0 +1,284 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/vcs"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// For namespaces with TrackReleases, syz-ci looks up the first release tag of the main repo
+// that contains each fix commit during commit polling. The releases are cached in Bug.CommitInfo
+// and make it possible to list the bugs fixed between two releases.
+
+const (
+	// How often the releases of the fix commits of a bug are looked up.
+	releaseCheckPeriod = 24 * time.Hour
+	// Releases of fixes of bugs that were closed longer ago are no longer looked up.
+	releaseTrackingPeriod = 365 * 24 * time.Hour
+	// How many bugs are checked per commit poll.
+	releasePollBugs = 30
+)
+
+// releasePolls returns the fix commits whose releases need to be looked up.
+func releasePolls(c context.Context, ns string) ([]dashapi.Commit, error) {
+	if !config.Namespaces[ns].TrackReleases {
+		return nil, nil
+	}
+	var bugs []*Bug
+	keys, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("Status=", BugStatusFixed).
+		Filter("ReleasesDone=", false).
+		Filter("ReleasesChecked<", timeNow(c).Add(-releaseCheckPeriod)).
+		Order("ReleasesChecked").
+		Limit(releasePollBugs).
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	var ret []dashapi.Commit
+	seen := map[string]bool{}
+	for i, bug := range bugs {
+		polls := bug.releasePolls()
+		if len(polls) == 0 {
+			// The hashes of the commits are not known yet, don't let the bug block the queue.
+			if err := updateBugReleases(c, keys[i], nil); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, com := range polls {
+			if !seen[com.Hash] {
+				seen[com.Hash] = true
+				ret = append(ret, com)
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Title < ret[j].Title
+	})
+	return ret, nil
+}
+
+func (bug *Bug) releasePolls() []dashapi.Commit {
+	var ret []dashapi.Commit
+	for i, title := range bug.Commits {
+		info := bug.getCommitInfo(i)
+		if info.Hash != "" && info.Release == "" {
+			ret = append(ret, dashapi.Commit{Title: title, Hash: info.Hash})
+		}
+	}
+	return ret
+}
+
+func apiUploadReleases(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	req := new(dashapi.ReleaseResultReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	if !config.Namespaces[ns].TrackReleases {
+		return nil, fmt.Errorf("namespace %v does not track releases", ns)
+	}
+	updates := map[string][]dashapi.ReleaseResult{}
+	var keys []*db.Key
+	for _, res := range req.Results {
+		if res.Release != "" && vcs.ReleaseTagOrder(res.Release) == 0 {
+			return nil, fmt.Errorf("bad release tag %q", res.Release)
+		}
+		bugKeys, err := db.NewQuery("Bug").
+			Filter("Namespace=", ns).
+			Filter("Commits=", res.Title).
+			KeysOnly().
+			GetAll(c, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query bugs: %w", err)
+		}
+		for _, key := range bugKeys {
+			if updates[key.StringID()] == nil {
+				keys = append(keys, key)
+			}
+			updates[key.StringID()] = append(updates[key.StringID()], res)
+		}
+	}
+	for _, key := range keys {
+		if err := updateBugReleases(c, key, updates[key.StringID()]); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func updateBugReleases(c context.Context, bugKey *db.Key, results []dashapi.ReleaseResult) error {
+	now := timeNow(c)
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		for _, res := range results {
+			bug.setCommitRelease(res.Title, res.Hash, res.Release)
+		}
+		bug.ReleasesChecked = now
+		bug.ReleasesDone = bug.releasedFixes() == len(bug.Commits) ||
+			now.Sub(bug.Closed) > releaseTrackingPeriod
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+func (bug *Bug) setCommitRelease(title, hash, release string) {
+	for i, commit := range bug.Commits {
+		// The result may be stale if the commit info has changed since the poll.
+		if commit == title && i < len(bug.CommitInfo) && bug.CommitInfo[i].Hash == hash {
+			bug.CommitInfo[i].Release = release
+		}
+	}
+}
+
+// releasedFixes returns the number of fix commits with known releases.
+func (bug *Bug) releasedFixes() int {
+	ret := 0
+	for i := range bug.Commits {
+		if bug.getCommitInfo(i).Release != "" {
+			ret++
+		}
+	}
+	return ret
+}
+
+type uiFixedBetweenPage struct {
+	Header *uiHeader
+	From   string
+	To     string
+	Bugs   []*uiFixedBug
+}
+
+type uiFixedBug struct {
+	Title  string
+	Link   string
+	Closed time.Time
+	// Fixes are the fix commits that were released in the range.
+	Fixes []*uiFixCommit
+	// Other are the remaining fix commits, released outside of the range or not released yet.
+	Other []*uiFixCommit
+	CVEs  []string
+}
+
+type uiFixCommit struct {
+	Title   string
+	Hash    string
+	Link    string
+	Release string
+}
+
+// fixedBetween selects the bugs with fix commits that were first released after the from tag
+// and no later than the to tag (e.g. from=v6.6 to=v6.7 selects the fixes in v6.7-rc1..v6.7).
+func fixedBetween(bugs []*Bug, from, to string, mainRepo string) []*uiFixedBug {
+	fromOrder, toOrder := vcs.ReleaseTagOrder(from), vcs.ReleaseTagOrder(to)
+	var ret []*uiFixedBug
+	for _, bug := range bugs {
+		item := &uiFixedBug{
+			Title:  bug.displayTitle(),
+			Link:   bugLink(bug.keyHash()),
+			Closed: bug.Closed,
+			CVEs:   bug.CVEs,
+		}
+		for i, title := range bug.Commits {
+			info := bug.getCommitInfo(i)
+			com := &uiFixCommit{
+				Title:   title,
+				Hash:    info.Hash,
+				Link:    vcs.CommitLink(mainRepo, info.Hash),
+				Release: info.Release,
+			}
+			if order := vcs.ReleaseTagOrder(info.Release); order > fromOrder && order <= toOrder {
+				item.Fixes = append(item.Fixes, com)
+			} else {
+				item.Other = append(item.Other, com)
+			}
+		}
+		if len(item.Fixes) != 0 {
+			ret = append(ret, item)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Fixes[0].Release != ret[j].Fixes[0].Release {
+			return vcs.ReleaseTagOrder(ret[i].Fixes[0].Release) < vcs.ReleaseTagOrder(ret[j].Fixes[0].Release)
+		}
+		return ret[i].Title < ret[j].Title
+	})
+	return ret
+}
+
+// handleFixedBetween lists the bugs whose fixes were released between two releases of the main repo.
+func handleFixedBetween(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns := r.FormValue("ns")
+	if ns == "" {
+		ns = config.DefaultNamespace
+	}
+	hdr, err := commonHeader(c, r, w, ns)
+	if err != nil {
+		return err
+	}
+	cfg := config.Namespaces[hdr.Namespace]
+	if !cfg.TrackReleases {
+		return fmt.Errorf("releases are not tracked in %v: %w", hdr.Namespace, ErrClientNotFound)
+	}
+	page := &uiFixedBetweenPage{
+		Header: hdr,
+		From:   r.FormValue("from"),
+		To:     r.FormValue("to"),
+	}
+	if page.From == "" && page.To == "" && !isJSONRequested(r) {
+		return serveTemplate(w, "fixed_between.html", page)
+	}
+	fromOrder, toOrder := vcs.ReleaseTagOrder(page.From), vcs.ReleaseTagOrder(page.To)
+	if fromOrder == 0 || toOrder == 0 {
+		return fmt.Errorf("%w: from and to must be release tags (e.g. v6.6)", ErrClientBadRequest)
+	}
+	if fromOrder >= toOrder {
+		return fmt.Errorf("%w: %v is not older than %v", ErrClientBadRequest, page.From, page.To)
+	}
+	bugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", hdr.Namespace).
+			Filter("Status=", BugStatusFixed)
+	})
+	if err != nil {
+		return err
+	}
+	accessLevel := namespaceAccessLevel(c, r, hdr.Namespace)
+	var visible []*Bug
+	for _, bug := range bugs {
+		if accessLevel >= bug.sanitizeAccess(accessLevel) {
+			visible = append(visible, bug)
+		}
+	}
+	page.Bugs = fixedBetween(visible, page.From, page.To, cfg.Repos[0].URL)
+	if isJSONRequested(r) {
+		return writeJSONFixedBetween(w, appURL(c), hdr.Namespace, page)
+	}
+	return serveTemplate(w, "fixed_between.html", page)
+}
+
+func writeJSONFixedBetween(w http.ResponseWriter, baseURL, ns string, page *uiFixedBetweenPage) error {
+	data, err := json.MarshalIndent(makePublicAPIFixedBugs(baseURL, ns, page), "", "\t")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestFixedBetween(t *testing.T) {
+	makeBug := func(title string, releases ...string) *Bug {
+		bug := &Bug{Namespace: "test1", Title: title, Status: BugStatusFixed}
+		for i, release := range releases {
+			bug.Commits = append(bug.Commits, title+": fix"+string(rune('1'+i)))
+			bug.CommitInfo = append(bug.CommitInfo, Commit{Hash: "hash" + title, Release: release})
+		}
+		return bug
+	}
+	bugs := []*Bug{
+		makeBug("before", "v6.6"),
+		makeBug("rc", "v6.7-rc3"),
+		makeBug("release", "v6.7"),
+		makeBug("rc1", "v6.7-rc1"),
+		makeBug("after", "v6.8-rc1"),
+		makeBug("unreleased", ""),
+		makeBug("partial", "v6.7-rc2", "", "v6.5"),
+		makeBug("unknown"),
+	}
+	type result struct {
+		Title string
+		Fixes []string
+		Other []string
+	}
+	var got []result
+	for _, bug := range fixedBetween(bugs, "v6.6", "v6.7", "git://syzkaller.org/repo.git") {
+		res := result{Title: bug.Title}
+		for _, com := range bug.Fixes {
+			res.Fixes = append(res.Fixes, com.Release)
+		}
+		for _, com := range bug.Other {
+			res.Other = append(res.Other, com.Release)
+		}
+		got = append(got, res)
+	}
+	want := []result{
+		{Title: "rc1", Fixes: []string{"v6.7-rc1"}},
+		{Title: "partial", Fixes: []string{"v6.7-rc2"}, Other: []string{"", "v6.5"}},
+		{Title: "rc", Fixes: []string{"v6.7-rc3"}},
+		{Title: "release", Fixes: []string{"v6.7"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestFixedBetweenPage(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+
+	build.FixCommits = []dashapi.Commit{
+		{Title: "foo: fix1", BugIDs: []string{rep.ID}},
+		{Title: "foo: fix2", BugIDs: []string{rep.ID}},
+	}
+	c.client.UploadBuild(build)
+	c.expectOK(c.client.UploadCommits([]dashapi.Commit{
+		{Hash: "hash1", Title: "foo: fix1"},
+		{Hash: "hash2", Title: "foo: fix2"},
+	}))
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bug.Status, BugStatusFixed)
+
+	resp, err := c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(resp.Releases, []dashapi.Commit{
+		{Title: "foo: fix1", Hash: "hash1"},
+		{Title: "foo: fix2", Hash: "hash2"},
+	})
+	c.expectOK(c.client.UploadReleases([]dashapi.ReleaseResult{
+		{Title: "foo: fix1", Hash: "hash1", Release: "v6.7-rc2"},
+		{Title: "foo: fix2", Hash: "hash2"},
+	}))
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectTrue(!bug.ReleasesDone)
+
+	// Only the unreleased commit is looked up again, once the check period passes.
+	resp, err = c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(len(resp.Releases), 0)
+	c.advanceTime(releaseCheckPeriod + time.Hour)
+	resp, err = c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(resp.Releases, []dashapi.Commit{{Title: "foo: fix2", Hash: "hash2"}})
+
+	page, err := c.AuthGET(AccessAdmin, "/fixed_between?ns=test1&from=v6.6&to=v6.7")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), crash.Title))
+	c.expectTrue(strings.Contains(string(page), "not released yet"))
+	page, err = c.AuthGET(AccessAdmin, "/fixed_between?ns=test1&from=v6.7&to=v6.8&json=1")
+	c.expectOK(err)
+	res := new(PublicAPIFixedBugs)
+	c.expectOK(json.Unmarshal(page, res))
+	c.expectEQ(len(res.Bugs), 0)
+
+	c.expectOK(c.client.UploadReleases([]dashapi.ReleaseResult{
+		{Title: "foo: fix2", Hash: "hash2", Release: "v6.8-rc1"},
+	}))
+	bug, _, _ = c.loadBug(rep.ID)
+	c.expectTrue(bug.ReleasesDone)
+	page, err = c.AuthGET(AccessAdmin, "/fixed_between?ns=test1&from=v6.7&to=v6.8&json=1")
+	c.expectOK(err)
+	c.expectOK(json.Unmarshal(page, res))
+	c.expectEQ(len(res.Bugs), 1)
+	c.expectEQ(res.Bugs[0].Title, crash.Title)
+	c.expectEQ(len(res.Bugs[0].Fixes), 1)
+	c.expectEQ(res.Bugs[0].Fixes[0].Hash, "hash2")
+	c.expectEQ(res.Bugs[0].Fixes[0].Release, "v6.8-rc1")
+	c.expectEQ(res.Bugs[0].Other[0].Release, "v6.7-rc2")
+
+	_, err = c.AuthGET(AccessAdmin, "/fixed_between?ns=test1&from=v6.8&to=v6.7")
+	c.expectBadReqest(err)
+	_, err = c.AuthGET(AccessAdmin, "/fixed_between?ns=test1&from=foo&to=v6.7")
+	c.expectBadReqest(err)
+	// Namespaces without release tracking have no such page.
+	_, err = c.AuthGET(AccessAdmin, "/fixed_between?ns=test2&from=v6.6&to=v6.7")
+	c.expectTrue(err != nil)
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/pkg/osutil"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+var flagUpdate = flag.Bool("update", false, "update the golden files of the tests")
+
+// TestDiscussionReplay runs the messages of testdata/replay/*.mbox through the incoming mail
+// handler of the lore discussion address and compares the resulting discussions and bug counters
+// with the corresponding .golden files. Run with -update to regenerate the golden files.
+func TestDiscussionReplay(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "replay", "*.mbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no mbox files found")
+	}
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			c := NewCtx(t)
+			defer c.Close()
+
+			data, err := os.ReadFile(file)
+			c.expectOK(err)
+			got := replayMbox(c, data)
+			golden := strings.TrimSuffix(file, ".mbox") + ".golden"
+			if *flagUpdate {
+				c.expectOK(osutil.WriteFile(golden, []byte(got)))
+				return
+			}
+			want, err := os.ReadFile(golden)
+			c.expectOK(err)
+			if diff := cmp.Diff(string(want), got); diff != "" {
+				t.Fatalf("replay result mismatch (-want +got), run with -update if it's expected:\n%s", diff)
+			}
+		})
+	}
+}
+
+// The bug hashes in the mbox files are made up, the messages refer to the production instance.
+var replayHashRe = regexp.MustCompile(`syzbot\+([0-9a-f]{20})@syzkaller\.appspotmail\.com|extid=([0-9a-f]{20})`)
+
+// replayMbox creates a bug for each hash mentioned in the mbox, delivers all messages
+// and returns the summary of the resulting state.
+func replayMbox(c *Ctx, data []byte) string {
+	messages := splitMbox(data)
+	hashMap := map[string]bool{}
+	for _, msg := range messages {
+		for _, match := range replayHashRe.FindAllStringSubmatch(msg, -1) {
+			hashMap[match[1]+match[2]] = true
+		}
+	}
+	var hashes []string
+	for hash := range hashMap {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	bugIDs := map[string]string{}
+	bugHashes := map[string]string{}
+	for i, hash := range hashes {
+		client.ReportCrash(testCrash(build, i+1))
+		bugIDs[hash] = c.pollEmailExtID()
+		_, bugKey, err := findBugByReportingID(c.ctx, bugIDs[hash])
+		c.expectOK(err)
+		bugHashes[bugKey.StringID()] = hash
+	}
+
+	ownDomain := ownEmail(c.ctx)[strings.IndexByte(ownEmail(c.ctx), '@'):]
+	for _, msg := range messages {
+		msg = strings.ReplaceAll(msg, "@syzkaller.appspotmail.com", ownDomain)
+		msg = strings.ReplaceAll(msg, "https://syzkaller.appspot.com", appURL(c.ctx))
+		for hash, id := range bugIDs {
+			msg = strings.ReplaceAll(msg, hash, id)
+		}
+		_, err := c.POST("/_ah/mail/lore@email.com", msg)
+		c.expectOK(err)
+	}
+	return replaySummary(c, hashes, bugIDs, bugHashes)
+}
+
+// splitMbox splits the mbox file into individual messages.
+func splitMbox(data []byte) []string {
+	var messages []string
+	var cur []string
+	flush := func() {
+		if len(cur) != 0 {
+			messages = append(messages, strings.TrimRight(strings.Join(cur, "\n"), "\n")+"\n")
+		}
+		cur = nil
+	}
+	prevEmpty := true
+	for _, line := range strings.Split(string(data), "\n") {
+		if prevEmpty && strings.HasPrefix(line, "From ") {
+			flush()
+			prevEmpty = false
+			continue
+		}
+		prevEmpty = line == ""
+		// Lines that start with "From " are escaped in the mbox format.
+		if strings.HasPrefix(line, ">From ") {
+			line = line[1:]
+		}
+		cur = append(cur, line)
+	}
+	flush()
+	return messages
+}
+
+func replaySummary(c *Ctx, hashes []string, bugIDs, bugHashes map[string]string) string {
+	var discussions []*Discussion
+	_, err := db.NewQuery("Discussion").GetAll(c.ctx, &discussions)
+	c.expectOK(err)
+	sort.Slice(discussions, func(i, j int) bool {
+		if discussions[i].Source != discussions[j].Source {
+			return discussions[i].Source < discussions[j].Source
+		}
+		return discussions[i].ID < discussions[j].ID
+	})
+	out := new(bytes.Buffer)
+	for _, d := range discussions {
+		fmt.Fprintf(out, "discussion %v %v\n", d.Source, d.ID)
+		fmt.Fprintf(out, "\ttype: %v\n", d.Type)
+		fmt.Fprintf(out, "\tsubject: %v\n", d.Subject)
+		if d.TargetTree != "" {
+			fmt.Fprintf(out, "\ttarget tree: %v\n", d.TargetTree)
+		}
+		var bugs []string
+		for _, key := range d.BugKeys {
+			bugs = append(bugs, fmt.Sprintf("%v (%v)", bugHashes[key], d.attachmentReason(key)))
+		}
+		sort.Strings(bugs)
+		fmt.Fprintf(out, "\tbugs: %v\n", strings.Join(bugs, ", "))
+		autoReplies := 0
+		for _, m := range d.Messages {
+			if m.AutoReply {
+				autoReplies++
+			}
+		}
+		fmt.Fprintf(out, "\tmessages: %v stored, %v auto-replies, %v counted, %v external, last %v\n",
+			len(d.Messages), autoReplies, d.Summary.AllMessages, d.Summary.ExternalMessages,
+			formatReplayTime(d.Summary.LastMessage))
+	}
+	for _, hash := range hashes {
+		bug, _, err := findBugByReportingID(c.ctx, bugIDs[hash])
+		c.expectOK(err)
+		summary := bug.discussionSummary()
+		fmt.Fprintf(out, "bug %v\n", hash)
+		fmt.Fprintf(out, "\tmessages: %v counted, %v external, last %v, last patch %v\n",
+			summary.AllMessages, summary.ExternalMessages,
+			formatReplayTime(summary.LastMessage), formatReplayTime(summary.LastPatchMessage))
+	}
+	return out.String()
+}
+
+func formatReplayTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+func TestSplitMbox(t *testing.T) {
+	messages := splitMbox([]byte(`From a@b Wed Mar  1 10:00:00 2023
+Subject: first
+
+>From the beginning.
+
+From c@d Wed Mar  1 11:00:00 2023
+Subject: second
+
+Hello
+`))
+	want := []string{
+		"Subject: first\n\nFrom the beginning.\n",
+		"Subject: second\n\nHello\n",
+	}
+	if diff := cmp.Diff(want, messages); diff != "" {
+		t.Fatal(diff)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Report experiments measure how the content of the reports affects the reactions to them
+// (e.g. whether including the reproducer into the email makes people respond faster).
+// ReportExperimentConfig defines variants of the report content with a percentage split.
+// The variant of a bug is derived from the hash of the bug key, so it's stable, and it's
+// recorded in BugReporting.Experiment/Variant once the bug is reported, so that the later
+// reports of the bug (e.g. with a reproducer) use the same variant even if the split changes.
+// The daily handleReportExperiments job correlates the variants with the time to the first
+// external reply in the bug discussions and the time to the fix, the results are shown
+// on the admin page.
+
+// reportVariantBucket returns a number in [0, 100) that is stable for the bug and the experiment.
+func reportVariantBucket(experiment, bugHash string) int {
+	h := fnv.New32a()
+	h.Write([]byte(experiment + "|" + bugHash))
+	return int(h.Sum32() % 100)
+}
+
+func (cfg *ReportExperimentConfig) assign(bugHash string) *ReportVariant {
+	bucket := reportVariantBucket(cfg.Name, bugHash)
+	for i := range cfg.Variants {
+		variant := &cfg.Variants[i]
+		if bucket < variant.Percent {
+			return variant
+		}
+		bucket -= variant.Percent
+	}
+	return nil
+}
+
+func (cfg *ReportExperimentConfig) variant(name string) *ReportVariant {
+	for i := range cfg.Variants {
+		if cfg.Variants[i].Name == name {
+			return &cfg.Variants[i]
+		}
+	}
+	return nil
+}
+
+// bugReportVariant returns the report variant of the bug in the reporting, if any.
+// Bugs that were already reported before the experiment started don't take part in it.
+func bugReportVariant(bug *Bug, bugReporting *BugReporting) *ReportVariant {
+	cfg := config.Namespaces[bug.Namespace].ReportExperiment
+	if cfg == nil {
+		return nil
+	}
+	if bugReporting.Experiment != "" {
+		if bugReporting.Experiment != cfg.Name {
+			return nil
+		}
+		return cfg.variant(bugReporting.Variant)
+	}
+	if !bugReporting.Reported.IsZero() {
+		return nil
+	}
+	return cfg.assign(bug.keyHash())
+}
+
+// recordReportVariant is called when the bug is reported for the first time in the reporting.
+func recordReportVariant(bug *Bug, bugReporting *BugReporting) {
+	variant := bugReportVariant(bug, bugReporting)
+	if variant == nil || bugReporting.Experiment != "" {
+		return
+	}
+	bugReporting.Experiment = config.Namespaces[bug.Namespace].ReportExperiment.Name
+	bugReporting.Variant = variant.Name
+}
+
+// ReportExperimentStats are the results of the experiment of a namespace, the key is the namespace name.
+type ReportExperimentStats struct {
+	Namespace  string
+	Experiment string
+	Updated    time.Time
+	Variants   []ReportVariantStats `datastore:",noindex"`
+}
+
+type ReportVariantStats struct {
+	Variant string
+	Bugs    int
+	// The number of bugs that got an external reply and the median time to the first reply.
+	Responded      int
+	MedianResponse time.Duration
+	// The number of fixed bugs and the median time from the report to the fix.
+	Fixed     int
+	MedianFix time.Duration
+}
+
+// reportExperimentSample describes the outcome of a single bug report.
+type reportExperimentSample struct {
+	Variant       string
+	Reported      time.Time
+	FirstResponse time.Time // zero if there were no external replies
+	Fixed         time.Time // zero if the bug is not fixed
+}
+
+func aggregateReportExperiment(cfg *ReportExperimentConfig, samples []*reportExperimentSample) []ReportVariantStats {
+	var ret []ReportVariantStats
+	for _, variant := range cfg.Variants {
+		stats := ReportVariantStats{Variant: variant.Name}
+		var responses, fixes []time.Duration
+		for _, sample := range samples {
+			if sample.Variant != variant.Name {
+				continue
+			}
+			stats.Bugs++
+			if !sample.FirstResponse.IsZero() {
+				responses = append(responses, sample.FirstResponse.Sub(sample.Reported))
+			}
+			if !sample.Fixed.IsZero() {
+				fixes = append(fixes, sample.Fixed.Sub(sample.Reported))
+			}
+		}
+		stats.Responded, stats.MedianResponse = len(responses), medianDuration(responses)
+		stats.Fixed, stats.MedianFix = len(fixes), medianDuration(fixes)
+		ret = append(ret, stats)
+	}
+	return ret
+}
+
+func handleReportExperiments(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for ns, cfg := range config.Namespaces {
+		if cfg.ReportExperiment == nil || cfg.Decommissioned {
+			continue
+		}
+		if err := updateReportExperimentStats(c, ns, cfg.ReportExperiment); err != nil {
+			log.Errorf(c, "%v: failed to update the report experiment stats: %v", ns, err)
+		}
+	}
+}
+
+func updateReportExperimentStats(c context.Context, ns string, cfg *ReportExperimentConfig) error {
+	bugs, keys, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("Reporting.Experiment=", cfg.Name)
+	})
+	if err != nil {
+		return err
+	}
+	var samples []*reportExperimentSample
+	for i, bug := range bugs {
+		sample, err := makeReportExperimentSample(c, cfg, bug, keys[i])
+		if err != nil {
+			return err
+		}
+		if sample != nil {
+			samples = append(samples, sample)
+		}
+	}
+	stats := &ReportExperimentStats{
+		Namespace:  ns,
+		Experiment: cfg.Name,
+		Updated:    timeNow(c),
+		Variants:   aggregateReportExperiment(cfg, samples),
+	}
+	if _, err := db.Put(c, reportExperimentStatsKey(c, ns), stats); err != nil {
+		return fmt.Errorf("failed to save the report experiment stats: %w", err)
+	}
+	return nil
+}
+
+func makeReportExperimentSample(c context.Context, cfg *ReportExperimentConfig, bug *Bug,
+	bugKey *db.Key) (*reportExperimentSample, error) {
+	var sample *reportExperimentSample
+	for _, bugReporting := range bug.Reporting {
+		if bugReporting.Experiment == cfg.Name && !bugReporting.Reported.IsZero() {
+			sample = &reportExperimentSample{
+				Variant:  bugReporting.Variant,
+				Reported: bugReporting.Reported,
+			}
+			break
+		}
+	}
+	if sample == nil {
+		return nil, nil
+	}
+	if bug.Status == BugStatusFixed {
+		sample.Fixed = bug.Closed
+	}
+	discussions, err := discussionsForBug(c, bugKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query discussions: %w", err)
+	}
+	for _, d := range discussions {
+		for _, msg := range d.Messages {
+			if !msg.External || msg.AutoReply || msg.Time.Before(sample.Reported) {
+				continue
+			}
+			if sample.FirstResponse.IsZero() || msg.Time.Before(sample.FirstResponse) {
+				sample.FirstResponse = msg.Time
+			}
+		}
+	}
+	return sample, nil
+}
+
+func reportExperimentStatsKey(c context.Context, ns string) *db.Key {
+	return db.NewKey(c, "ReportExperimentStats", ns, 0, nil)
+}
+
+func loadReportExperimentStats(c context.Context) ([]*ReportExperimentStats, error) {
+	var ret []*ReportExperimentStats
+	for ns, cfg := range config.Namespaces {
+		if cfg.ReportExperiment == nil || cfg.Decommissioned {
+			continue
+		}
+		stats := new(ReportExperimentStats)
+		if err := db.Get(c, reportExperimentStatsKey(c, ns), stats); err != nil {
+			if err == db.ErrNoSuchEntity {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get the report experiment stats: %w", err)
+		}
+		ret = append(ret, stats)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Namespace < ret[j].Namespace
+	})
+	return ret, nil
+}
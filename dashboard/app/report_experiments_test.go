@@ -0,0 +1,168 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestReportVariantAssignment(t *testing.T) {
+	cfg := &ReportExperimentConfig{
+		Name: "inline-repro",
+		Variants: []ReportVariant{
+			{Name: "link", Percent: 70},
+			{Name: "inline", Percent: 30, InlineRepro: true},
+		},
+	}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		hash := fmt.Sprintf("%016x", i*7919)
+		variant := cfg.assign(hash)
+		if variant == nil {
+			t.Fatalf("no variant for %v", hash)
+		}
+		// The assignment is deterministic.
+		if again := cfg.assign(hash); again != variant {
+			t.Fatalf("%v: got %v, then %v", hash, variant.Name, again.Name)
+		}
+		counts[variant.Name]++
+	}
+	if counts["link"] < 600 || counts["link"] > 800 {
+		t.Fatalf("bad split: %v", counts)
+	}
+}
+
+func TestBugReportVariantStability(t *testing.T) {
+	ns := "test1"
+	cfg := &ReportExperimentConfig{
+		Name: "inline-repro",
+		Variants: []ReportVariant{
+			{Name: "link", Percent: 50},
+			{Name: "inline", Percent: 50, InlineRepro: true},
+		},
+	}
+	config.Namespaces[ns].ReportExperiment = cfg
+	defer func() {
+		config.Namespaces[ns].ReportExperiment = nil
+	}()
+	bug := &Bug{Namespace: ns, Title: "title1", Reporting: []BugReporting{{Name: "reporting1"}}}
+	bugReporting := &bug.Reporting[0]
+	variant := bugReportVariant(bug, bugReporting)
+	if variant == nil {
+		t.Fatalf("no variant")
+	}
+	recordReportVariant(bug, bugReporting)
+	bugReporting.Reported = time.Now()
+	if bugReporting.Experiment != cfg.Name || bugReporting.Variant != variant.Name {
+		t.Fatalf("recorded %v/%v", bugReporting.Experiment, bugReporting.Variant)
+	}
+	// The bug keeps the variant when the split changes.
+	cfg.Variants[0].Percent, cfg.Variants[1].Percent = 100, 0
+	if got := bugReportVariant(bug, bugReporting); got.Name != variant.Name {
+		t.Fatalf("the variant changed from %v to %v", variant.Name, got.Name)
+	}
+	// The bugs reported before the experiment don't take part in it.
+	old := &Bug{Namespace: ns, Title: "title2", Reporting: []BugReporting{{Name: "reporting1", Reported: time.Now()}}}
+	if got := bugReportVariant(old, &old.Reporting[0]); got != nil {
+		t.Fatalf("an old bug got variant %v", got.Name)
+	}
+	// A new experiment does not change the reported bugs.
+	cfg.Name = "another"
+	if got := bugReportVariant(bug, bugReporting); got != nil {
+		t.Fatalf("the bug got variant %v of the new experiment", got.Name)
+	}
+}
+
+func TestAggregateReportExperiment(t *testing.T) {
+	cfg := &ReportExperimentConfig{
+		Name: "inline-repro",
+		Variants: []ReportVariant{
+			{Name: "link", Percent: 50},
+			{Name: "inline", Percent: 50, InlineRepro: true},
+		},
+	}
+	reported := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(variant string, response, fix time.Duration) *reportExperimentSample {
+		ret := &reportExperimentSample{Variant: variant, Reported: reported}
+		if response != 0 {
+			ret.FirstResponse = reported.Add(response)
+		}
+		if fix != 0 {
+			ret.Fixed = reported.Add(fix)
+		}
+		return ret
+	}
+	const day = 24 * time.Hour
+	samples := []*reportExperimentSample{
+		sample("link", 3*day, 0),
+		sample("link", 0, 0),
+		sample("link", 1*day, 20*day),
+		sample("inline", 2*time.Hour, 5*day),
+		sample("inline", 0, 0),
+		sample("unknown", day, day),
+	}
+	want := []ReportVariantStats{
+		{Variant: "link", Bugs: 3, Responded: 2, MedianResponse: 3 * day, Fixed: 1, MedianFix: 20 * day},
+		{Variant: "inline", Bugs: 2, Responded: 1, MedianResponse: 2 * time.Hour, Fixed: 1, MedianFix: 5 * day},
+	}
+	if diff := cmp.Diff(want, aggregateReportExperiment(cfg, samples)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestReportExperimentEmails(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	cfg := &ReportExperimentConfig{
+		Name:     "inline-repro",
+		Variants: []ReportVariant{{Name: "inline", Percent: 100, InlineRepro: true}},
+	}
+	config.Namespaces["test2"].ReportExperiment = cfg
+	defer func() {
+		config.Namespaces["test2"].ReportExperiment = nil
+	}()
+
+	build := testBuild(1)
+	c.client2.UploadBuild(build)
+	crash := testCrashWithRepro(build, 1)
+	c.client2.ReportCrash(crash)
+	msg := c.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Body, "C reproducer:\n\nint main() { return 1; }"))
+	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.Reporting[0].Experiment, "inline-repro")
+	c.expectEQ(bug.Reporting[0].Variant, "inline")
+
+	// Someone replies to the report.
+	c.advanceTime(time.Hour)
+	c.expectOK(c.client2.SaveDiscussion(&dashapi.SaveDiscussionReq{
+		Discussion: &dashapi.Discussion{
+			ID:      "123",
+			Source:  dashapi.DiscussionLore,
+			Type:    dashapi.DiscussionReport,
+			Subject: msg.Subject,
+			BugIDs:  []string{extBugID},
+			Messages: []dashapi.DiscussionMessage{
+				{ID: "123", External: true, Time: timeNow(c.ctx)},
+			},
+		},
+	}))
+	_, err = c.GET("/cron/report_experiments")
+	c.expectOK(err)
+	stats, err := loadReportExperimentStats(c.ctx)
+	c.expectOK(err)
+	c.expectEQ(len(stats), 1)
+	c.expectEQ(stats[0].Variants[0].Bugs, 1)
+	c.expectEQ(stats[0].Variants[0].Responded, 1)
+	c.expectEQ(stats[0].Variants[0].MedianResponse, time.Hour)
+}
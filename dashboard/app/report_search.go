@@ -0,0 +1,256 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// Bug titles mention only one function, so to find e.g. all bugs involving some lock or
+// subsystem function, the /ns/search page searches the keywords of the crash reports.
+// The keywords (Bug.Keywords) are the function names and the source file basenames
+// of the top call trace frames of the representative crash, in the order of the frames.
+// They are extracted when the first crash and the first reproducer of the bug are saved,
+// the older bugs can be updated with backfillReportKeywords.
+// A search returns the bugs that have all the query tokens, the bugs that have them
+// closer to the top of the stack go first.
+
+const (
+	keywordFrames    = 30
+	maxKeywords      = 100
+	maxSearchTokens  = 3
+	maxSearchResults = 100
+)
+
+var frameFileRe = regexp.MustCompile(`\s([a-zA-Z0-9_./-]+\.[a-zA-Z]+):[0-9]+`)
+
+// reportKeywords returns the search keywords of the crash report.
+func reportKeywords(report []byte) []string {
+	var keywords []string
+	add := func(keyword string) {
+		keyword = strings.ToLower(keyword)
+		if keyword != "" && len(keywords) < maxKeywords && !stringInList(keywords, keyword) {
+			keywords = append(keywords, keyword)
+		}
+	}
+	frames := 0
+	inTrace := false
+	for _, line := range strings.Split(string(report), "\n") {
+		if frames >= keywordFrames {
+			break
+		}
+		if !inTrace {
+			inTrace = strings.Contains(strings.ToLower(line), "call trace:")
+			continue
+		}
+		match := callTraceFrameRe.FindStringSubmatch(line)
+		if match == nil || match[1] != "" || reportingFrameRe.MatchString(match[2]) {
+			continue
+		}
+		frames++
+		add(normalizeFrame(match[2]))
+		if file := frameFileRe.FindStringSubmatch(line); file != nil {
+			add(path.Base(file[1]))
+		}
+	}
+	return keywords
+}
+
+// parseSearchQuery splits the query into keywords, paths are reduced to the basenames.
+func parseSearchQuery(query string) ([]string, error) {
+	var tokens []string
+	for _, token := range strings.Fields(strings.ToLower(query)) {
+		token = path.Base(token)
+		if !stringInList(tokens, token) {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty search query", ErrClientBadRequest)
+	}
+	if len(tokens) > maxSearchTokens {
+		return nil, fmt.Errorf("%w: at most %v search tokens are supported", ErrClientBadRequest, maxSearchTokens)
+	}
+	return tokens, nil
+}
+
+// keywordsScore returns the sum of the positions of the tokens in the keywords,
+// or -1 if some of the tokens are missing.
+func keywordsScore(keywords, tokens []string) int {
+	score := 0
+	for _, token := range tokens {
+		pos := -1
+		for i, keyword := range keywords {
+			if keyword == token {
+				pos = i
+				break
+			}
+		}
+		if pos == -1 {
+			return -1
+		}
+		score += pos
+	}
+	return score
+}
+
+// rankSearchResults returns the bugs that match all tokens, the best matches first.
+// For the same match positions, the open and the most frequently crashing bugs go first.
+func rankSearchResults(bugs []*Bug, tokens []string) []*Bug {
+	var ret []*Bug
+	scores := make(map[*Bug]int)
+	for _, bug := range bugs {
+		score := keywordsScore(bug.Keywords, tokens)
+		if score < 0 {
+			continue
+		}
+		scores[bug] = score
+		ret = append(ret, bug)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if scores[a] != scores[b] {
+			return scores[a] < scores[b]
+		}
+		if (a.Status == BugStatusOpen) != (b.Status == BugStatusOpen) {
+			return a.Status == BugStatusOpen
+		}
+		if a.NumCrashes != b.NumCrashes {
+			return a.NumCrashes > b.NumCrashes
+		}
+		return a.LastTime.After(b.LastTime)
+	})
+	if len(ret) > maxSearchResults {
+		ret = ret[:maxSearchResults]
+	}
+	return ret
+}
+
+type uiSearchPage struct {
+	Header *uiHeader
+	Query  string
+	Bugs   *uiBugGroup
+}
+
+func handleSearch(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	hdr, err := commonHeader(c, r, w, "")
+	if err != nil {
+		return err
+	}
+	hdr.Subpage = "/search"
+	page := &uiSearchPage{
+		Header: hdr,
+		Query:  r.FormValue("q"),
+	}
+	if page.Query != "" {
+		tokens, err := parseSearchQuery(page.Query)
+		if err != nil {
+			return err
+		}
+		page.Bugs, err = searchBugs(c, namespaceAccessLevel(c, r, hdr.Namespace), hdr.Namespace, tokens)
+		if err != nil {
+			return err
+		}
+	}
+	return serveTemplate(w, "search.html", page)
+}
+
+func searchBugs(c context.Context, accessLevel AccessLevel, ns string, tokens []string) (*uiBugGroup, error) {
+	var bugs []*Bug
+	var err error
+	if cve := strings.ToUpper(tokens[0]); len(tokens) == 1 && cveRe.MatchString(cve) {
+		bugs, err = loadBugsByCVE(c, ns, cve)
+	} else {
+		// Datastore can't rank, so we query by one token and check the rest in memory.
+		bugs, _, err = loadAllBugs(c, func(query *db.Query) *db.Query {
+			return query.Filter("Namespace=", ns).
+				Filter("Keywords=", tokens[0])
+		})
+		bugs = rankSearchResults(bugs, tokens)
+	}
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadReportingState(c)
+	if err != nil {
+		return nil, err
+	}
+	managers, err := managerList(c, ns)
+	if err != nil {
+		return nil, err
+	}
+	group := &uiBugGroup{
+		Now:        timeNow(c),
+		Caption:    "matching bugs",
+		Namespace:  ns,
+		ShowStatus: true,
+	}
+	for _, bug := range bugs {
+		if accessLevel < bug.sanitizeAccess(accessLevel) {
+			continue
+		}
+		group.Bugs = append(group.Bugs, createUIBug(c, bug, state, managers))
+	}
+	return group, nil
+}
+
+// backfillReportKeywords extracts the search keywords of the bugs that crashed recently,
+// but have no keywords yet.
+// This functionality is intentionally not connected to any handler.
+func backfillReportKeywords(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if accessLevel(c, r) != AccessAdmin {
+		return fmt.Errorf("admin only")
+	}
+	var bugs []*Bug
+	keys, err := db.NewQuery("Bug").
+		Filter("LastTime>", timeNow(c).Add(-90*24*time.Hour)).
+		GetAll(c, &bugs)
+	if err != nil {
+		return err
+	}
+	updated := 0
+	for i, bug := range bugs {
+		if len(bug.Keywords) != 0 {
+			continue
+		}
+		crash, _, err := findCrashForBug(c, bug)
+		if err != nil {
+			continue
+		}
+		report, _, err := getText(c, textCrashReport, crash.Report)
+		if err != nil {
+			return err
+		}
+		keywords := reportKeywords(report)
+		if len(keywords) == 0 {
+			continue
+		}
+		tx := func(c context.Context) error {
+			bug := new(Bug)
+			if err := db.Get(c, keys[i], bug); err != nil {
+				return err
+			}
+			if len(bug.Keywords) == 0 {
+				bug.Keywords = keywords
+			}
+			_, err := db.Put(c, keys[i], bug)
+			return err
+		}
+		if err := db.RunInTransaction(c, tx, nil); err != nil {
+			return err
+		}
+		updated++
+	}
+	fmt.Fprintf(w, "updated %v bugs\n", updated)
+	return nil
+}
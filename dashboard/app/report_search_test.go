@@ -0,0 +1,115 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportKeywords(t *testing.T) {
+	keywords := reportKeywords([]byte(similarTestReport))
+	expect := []string{"foo_inner", "foo.c", "foo_bar", "baz", "baz.c", "qux", "qux.c"}
+	if fmt.Sprint(keywords) != fmt.Sprint(expect) {
+		t.Fatalf("got %q, want %q", keywords, expect)
+	}
+	if keywords := reportKeywords([]byte("general protection fault in foo+0x1/0x2\n")); len(keywords) != 0 {
+		t.Fatalf("got keywords without a call trace: %q", keywords)
+	}
+	// The keywords are capped.
+	report := "Call Trace:\n"
+	for i := 0; i < 100; i++ {
+		report += fmt.Sprintf(" func%v+0x1/0x2 dir/file%v.c:1\n", i, i)
+	}
+	keywords = reportKeywords([]byte(report))
+	if len(keywords) != 2*keywordFrames {
+		t.Fatalf("got %v keywords, want %v", len(keywords), 2*keywordFrames)
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tokens, err := parseSearchQuery(" Foo_Bar  net/foo.c foo_bar ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tokens) != fmt.Sprint([]string{"foo_bar", "foo.c"}) {
+		t.Fatalf("got %q", tokens)
+	}
+	if _, err := parseSearchQuery("  "); err == nil {
+		t.Fatalf("no error for an empty query")
+	}
+	if _, err := parseSearchQuery("a b c d"); err == nil {
+		t.Fatalf("no error for too many tokens")
+	}
+}
+
+func TestRankSearchResults(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	bugs := []*Bug{
+		{Title: "no match", Keywords: []string{"foo", "bar"}, Status: BugStatusOpen},
+		{Title: "deep", Keywords: []string{"a", "b", "c", "lock", "d", "foo.c"}, Status: BugStatusOpen},
+		{Title: "top fixed", Keywords: []string{"lock", "foo.c"}, Status: BugStatusFixed, NumCrashes: 100},
+		{Title: "top rare", Keywords: []string{"lock", "foo.c"}, Status: BugStatusOpen, NumCrashes: 1},
+		{Title: "top old", Keywords: []string{"lock", "foo.c"}, Status: BugStatusOpen, NumCrashes: 10,
+			LastTime: now},
+		{Title: "top new", Keywords: []string{"lock", "foo.c"}, Status: BugStatusOpen, NumCrashes: 10,
+			LastTime: now.Add(time.Hour)},
+		{Title: "reversed", Keywords: []string{"foo.c", "lock"}, Status: BugStatusOpen},
+	}
+	var titles []string
+	for _, bug := range rankSearchResults(bugs, []string{"lock", "foo.c"}) {
+		titles = append(titles, bug.Title)
+	}
+	// The order of the tokens does not matter, the fixed bugs go after the open ones.
+	expect := []string{"top new", "top old", "top rare", "reversed", "top fixed", "deep"}
+	if fmt.Sprint(titles) != fmt.Sprint(expect) {
+		t.Fatalf("got %q, want %q", titles, expect)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash1 := testCrash(build, 1)
+	crash1.Report = []byte(similarTestReport)
+	c.client.ReportCrash(crash1)
+	rep1 := c.client.pollBug()
+	crash2 := testCrash(build, 2)
+	crash2.Report = []byte(strings.Replace(similarTestReport, "qux", "other", -1))
+	c.client.ReportCrash(crash2)
+	c.client.pollBug()
+	bug1, _, _ := c.loadBug(rep1.ID)
+	c.expectEQ(bug1.Keywords, []string{"foo_inner", "foo.c", "foo_bar", "baz", "baz.c", "qux", "qux.c"})
+
+	page, err := c.AuthGET(AccessUser, "/test1/search?q=baz+net/foo.c")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(crash1.Title)))
+	c.expectTrue(bytes.Contains(page, []byte(crash2.Title)))
+
+	page, err = c.AuthGET(AccessUser, "/test1/search?q=QUX+baz")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(crash1.Title)))
+	c.expectTrue(!bytes.Contains(page, []byte(crash2.Title)))
+
+	page, err = c.AuthGET(AccessUser, "/test1/search?q=missing")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("No bugs match the query.")))
+
+	_, err = c.AuthGET(AccessUser, "/test1/search?q=a+b+c+d")
+	c.expectBadReqest(err)
+
+	// The keywords are updated once the bug gets a reproducer.
+	crash3 := testCrash(build, 1)
+	crash3.Report = []byte(strings.Replace(similarTestReport, "qux", "repro", -1))
+	crash3.ReproSyz = []byte("getpid()")
+	c.client.ReportCrash(crash3)
+	bug1, _, _ = c.loadBug(rep1.ID)
+	c.expectTrue(stringInList(bug1.Keywords, "repro"))
+}
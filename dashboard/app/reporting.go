@@ -51,6 +51,7 @@ func reportingPollBugs(c context.Context, typ string) []*dashapi.BugReport {
 	}
 	log.Infof(c, "fetched %v bugs", len(bugs))
 	sort.Sort(bugReportSorter(bugs))
+	sortQueuedReports(bugs)
 	var reports []*dashapi.BugReport
 	for _, bug := range bugs {
 		rep, err := handleReportBug(c, typ, state, bug)
@@ -69,6 +70,9 @@ func reportingPollBugs(c context.Context, typ string) []*dashapi.BugReport {
 			break
 		}
 	}
+	if err := queueWindowReports(c, state.windowQueued); err != nil {
+		log.Errorf(c, "failed to queue the reports: %v", err)
+	}
 	return reports
 }
 
@@ -124,6 +128,11 @@ func needReport(c context.Context, typ string, state *ReportingState, bug *Bug)
 		reporting, bugReporting = nil, nil
 		return
 	}
+	if bug.waitsForLocalRepro() {
+		status = fmt.Sprintf("%v: inherited, waiting for a repro", reporting.DisplayTitle)
+		reporting, bugReporting = nil, nil
+		return
+	}
 	if !cfg.MailWithoutReport && !bug.HasReport {
 		status = fmt.Sprintf("%v: no report", reporting.DisplayTitle)
 		reporting, bugReporting = nil, nil
@@ -134,6 +143,27 @@ func needReport(c context.Context, typ string, state *ReportingState, bug *Bug)
 		reporting, bugReporting = nil, nil
 		return
 	}
+	if digest := lowSeverityStatus(bug); digest != "" {
+		status = fmt.Sprintf("%v: %v", reporting.DisplayTitle, digest)
+		reporting, bugReporting = nil, nil
+		return
+	}
+	if paused := reportingPauseStatus(c, bug); paused != "" {
+		status = fmt.Sprintf("%v: %v", reporting.DisplayTitle, paused)
+		reporting, bugReporting = nil, nil
+		return
+	}
+	if bugReporting.Reported.IsZero() {
+		if opens := reportingWindowOpens(c, bug); !opens.IsZero() {
+			status = fmt.Sprintf("%v: queued until the reporting window opens on %v",
+				reporting.DisplayTitle, html.FormatTime(opens))
+			if bugReporting.Queued.IsZero() {
+				state.windowQueued = append(state.windowQueued, bug)
+			}
+			reporting, bugReporting = nil, nil
+			return
+		}
+	}
 
 	// Limit number of reports sent per day,
 	// but don't limit sending repros to already reported bugs.
@@ -214,7 +244,7 @@ func handleReportNotif(c context.Context, typ string, bug *Bug) (*dashapi.BugNot
 	if len(bug.Commits) == 0 &&
 		bug.canBeObsoleted() &&
 		timeSince(c, bug.LastActivity) > notifyResendPeriod &&
-		timeSince(c, bug.LastTime) > bug.obsoletePeriod() {
+		timeSince(c, bug.lastCrashTime()) > bug.obsoletePeriod() {
 		log.Infof(c, "%v: obsoleting: %v", bug.Namespace, bug.Title)
 		why := bugObsoletionReason(bug)
 		return createNotification(c, dashapi.BugNotifObsoleted, false, string(why), bug, reporting, bugReporting)
@@ -227,6 +257,18 @@ func handleReportNotif(c context.Context, typ string, bug *Bug) (*dashapi.BugNot
 		commits := strings.Join(bug.Commits, "\n")
 		return createNotification(c, dashapi.BugNotifBadCommit, true, commits, bug, reporting, bugReporting)
 	}
+	if bug.needsRenameNotification(bugReporting) {
+		log.Infof(c, "%v: renamed: %v", bug.Namespace, bug.Title)
+		return createNotification(c, dashapi.BugNotifRenamed, false,
+			bug.lastRename().From, bug, reporting, bugReporting)
+	}
+	if cfg, ok := reporting.Config.(*EmailConfig); ok {
+		if lists := cfg.newSubsystemLists(bug, bugReporting); len(lists) != 0 {
+			log.Infof(c, "%v: notifying %v: %v", bug.Namespace, lists, bug.Title)
+			return createNotification(c, dashapi.BugNotifSubsystemLists, false,
+				strings.Join(lists, "|"), bug, reporting, bugReporting)
+		}
+	}
 	return nil, nil
 }
 
@@ -325,7 +367,7 @@ func createNotification(c context.Context, typ dashapi.BugNotif, public bool, te
 		CC:        kernelRepo.CC.Always,
 	}
 	if public {
-		notif.Maintainers = append(crash.Maintainers, kernelRepo.CC.Maintainers...)
+		notif.Maintainers = append(crashMaintainers(c, bug, crash), kernelRepo.CC.Maintainers...)
 	}
 	if (public || reporting.moderation) && bugReporting.CC != "" {
 		notif.CC = append(notif.CC, strings.Split(bugReporting.CC, "|")...)
@@ -471,7 +513,7 @@ func crashBugReport(c context.Context, bug *Bug, crash *Crash, crashKey *db.Key,
 		Report:          report,
 		ReportLink:      externalLink(c, textCrashReport, crash.Report),
 		CC:              kernelRepo.CC.Always,
-		Maintainers:     append(crash.Maintainers, kernelRepo.CC.Maintainers...),
+		Maintainers:     append(crashMaintainers(c, bug, crash), kernelRepo.CC.Maintainers...),
 		ReproC:          reproC,
 		ReproCLink:      externalLink(c, textReproC, crash.ReproC),
 		ReproSyz:        reproSyz,
@@ -484,11 +526,14 @@ func crashBugReport(c context.Context, bug *Bug, crash *Crash, crashKey *db.Key,
 		NumCrashes:      bug.NumCrashes,
 		HappenedOn:      managersToRepos(c, bug.Namespace, bug.HappenedOn),
 		Assets:          assetList,
-		ReportElements:  &dashapi.ReportElements{GuiltyFiles: crash.ReportElements.GuiltyFiles},
+		ReportElements:  &dashapi.ReportElements{GuiltyFiles: bug.guiltyFiles(crash)},
 	}
 	if bugReporting.CC != "" {
 		rep.CC = append(rep.CC, strings.Split(bugReporting.CC, "|")...)
 	}
+	if cfg, ok := reporting.Config.(*EmailConfig); ok {
+		rep.CC = append(rep.CC, cfg.bugSubsystemLists(bug)...)
+	}
 	if build.Type == BuildFailed {
 		rep.Maintainers = append(rep.Maintainers, kernelRepo.CC.BuildMaintainers...)
 	}
@@ -499,9 +544,26 @@ func crashBugReport(c context.Context, bug *Bug, crash *Crash, crashKey *db.Key,
 			rep.Maintainers = append(rep.Maintainers, mgr.CC.BuildMaintainers...)
 		}
 	}
+	rep.UpstreamDiscussion, err = upstreamDiscussion(c, bug, reporting.AccessLevel)
+	if err != nil {
+		// It's only supplementary information, so don't fail the whole report.
+		log.Errorf(c, "failed to query upstream discussions for %q: %v", bug.Title, err)
+	}
+	rep.RegressionOf, err = bugRegression(c, bug, reporting.AccessLevel)
+	if err != nil {
+		log.Errorf(c, "failed to query the regressed bug for %q: %v", bug.Title, err)
+	}
+	rep.DupCandidates, err = bugDupCandidates(c, bug, reporting.AccessLevel)
+	if err != nil {
+		log.Errorf(c, "failed to query dup candidates for %q: %v", bug.Title, err)
+	}
 	if err := fillBugReport(c, rep, bug, bugReporting, build); err != nil {
 		return nil, err
 	}
+	if variant := bugReportVariant(bug, bugReporting); variant != nil {
+		rep.Variant = config.Namespaces[bug.Namespace].ReportExperiment.Name + "/" + variant.Name
+		rep.InlineRepro = variant.InlineRepro
+	}
 	return rep, nil
 }
 
@@ -775,6 +837,9 @@ func incomingCommandImpl(c context.Context, cmd *dashapi.BugUpdate) (bool, strin
 	if err != nil {
 		return false, internalError, err
 	}
+	if ok {
+		invalidateBugLists(c, bug.Namespace)
+	}
 	return ok, reply, nil
 }
 
@@ -880,6 +945,9 @@ func incomingCommandTx(c context.Context, now time.Time, cmd *dashapi.BugUpdate,
 	if _, err := db.Put(c, bugKey, bug); err != nil {
 		return false, internalError, fmt.Errorf("failed to put bug: %v", err)
 	}
+	if err := saveBugEvents(c, bugKey, bug); err != nil {
+		return false, internalError, err
+	}
 	if err := saveReportingState(c, state); err != nil {
 		return false, internalError, err
 	}
@@ -903,6 +971,13 @@ func incomingCommandUpdate(c context.Context, now time.Time, cmd *dashapi.BugUpd
 		(bug.Status == BugStatusOpen || bug.Status == BugStatusDup) {
 		sort.Strings(cmd.FixCommits)
 		if !reflect.DeepEqual(bug.Commits, cmd.FixCommits) {
+			event := bugUpdateEvent(cmd, BugEventFixAttached, now, bugReporting.Name)
+			event.Details = fixCommitsDetails(cmd.FixCommits)
+			if len(cmd.FixCommits) == 0 {
+				event.Type = BugEventFixRemoved
+				event.Details = fixCommitsDetails(bug.Commits)
+			}
+			bug.recordEvent(event)
 			bug.updateCommits(cmd.FixCommits, now)
 		}
 	}
@@ -943,6 +1018,10 @@ func incomingCommandUpdate(c context.Context, now time.Time, cmd *dashapi.BugUpd
 	if cmd.Status != dashapi.BugStatusOpen || !cmd.OnHold {
 		bugReporting.OnHold = time.Time{}
 	}
+	if cmd.Notification && bug.lastRename() != nil {
+		// All notifications are sent with the current title.
+		bugReporting.RenameNotified = now
+	}
 	bug.LastActivity = now
 	return true, "", nil
 }
@@ -951,11 +1030,16 @@ func incomingCommandCmd(c context.Context, now time.Time, cmd *dashapi.BugUpdate
 	bugReporting *BugReporting, final bool, stateEnt *ReportingStateEntry) (bool, string, error) {
 	switch cmd.Status {
 	case dashapi.BugStatusOpen:
+		if bug.Status == BugStatusDup {
+			bug.recordEvent(bugUpdateEvent(cmd, BugEventReopened, now, bugReporting.Name))
+		}
 		bug.Status = BugStatusOpen
 		bug.Closed = time.Time{}
 		if bugReporting.Reported.IsZero() {
+			recordReportVariant(bug, bugReporting)
 			bugReporting.Reported = now
 			stateEnt.Sent++ // sending repro does not count against the quota
+			bug.recordEvent(bugUpdateEvent(cmd, BugEventReported, now, bugReporting.Name))
 		}
 		if bugReporting.OnHold.IsZero() && cmd.OnHold {
 			bugReporting.OnHold = now
@@ -988,15 +1072,26 @@ func incomingCommandCmd(c context.Context, now time.Time, cmd *dashapi.BugUpdate
 		bug.Closed = time.Time{}
 		bugReporting.Closed = now
 		bugReporting.Auto = cmd.Notification
+		bug.recordEvent(bugUpdateEvent(cmd, BugEventUpstreamed, now, bugReporting.Name))
 	case dashapi.BugStatusInvalid:
 		bug.Closed = now
 		bug.Status = BugStatusInvalid
 		bugReporting.Closed = now
 		bugReporting.Auto = cmd.Notification
+		bug.recordInvalidation(now, bugReporting.Name, cmd.User, cmd.InvalidReason)
+		event := bugUpdateEvent(cmd, invalidationEventType(cmd.StatusReason), now, bugReporting.Name)
+		event.Details = cmd.InvalidReason
+		if event.Details == "" {
+			event.Details = string(cmd.StatusReason)
+		}
+		bug.recordEvent(event)
 	case dashapi.BugStatusDup:
 		bug.Status = BugStatusDup
 		bug.Closed = now
 		bug.DupOf = dup.keyHash()
+		event := bugUpdateEvent(cmd, BugEventDup, now, bugReporting.Name)
+		event.Details = dup.displayTitle()
+		bug.recordEvent(event)
 	case dashapi.BugStatusUpdate:
 		// Just update Link, Commits, etc below.
 	case dashapi.BugStatusUnCC:
@@ -1050,6 +1145,12 @@ func checkBugStatus(c context.Context, cmd *dashapi.BugUpdate, bug *Bug, bugRepo
 }
 
 func findBugByReportingID(c context.Context, id string) (*Bug, *db.Key, error) {
+	if bug, bugKey, found := lookupCachedReportingID(c, id); found {
+		if bug == nil {
+			return nil, nil, fmt.Errorf("failed to find bug by reporting id %q", id)
+		}
+		return bug, bugKey, nil
+	}
 	var bugs []*Bug
 	keys, err := db.NewQuery("Bug").
 		Filter("Reporting.ID=", id).
@@ -1059,11 +1160,13 @@ func findBugByReportingID(c context.Context, id string) (*Bug, *db.Key, error) {
 		return nil, nil, fmt.Errorf("failed to fetch bugs: %v", err)
 	}
 	if len(bugs) == 0 {
+		cacheReportingID(c, id, nil)
 		return nil, nil, fmt.Errorf("failed to find bug by reporting id %q", id)
 	}
 	if len(bugs) > 1 {
 		return nil, nil, fmt.Errorf("multiple bugs for reporting id %q", id)
 	}
+	cacheReportingID(c, id, keys[0])
 	return bugs[0], keys[0], nil
 }
 
@@ -1077,7 +1180,9 @@ func findDupByTitle(c context.Context, ns, title string) (*Bug, *db.Key, error)
 	bug := new(Bug)
 	if err := db.Get(c, bugKey, bug); err != nil {
 		if err == db.ErrNoSuchEntity {
-			return nil, nil, nil // This is not really an error, we should notify the user instead.
+			// The bug may have been renamed. If it's not found either,
+			// this is not really an error, we should notify the user instead.
+			return findRenamedBug(c, ns, title, seq)
 		}
 		return nil, nil, fmt.Errorf("failed to get dup: %v", err)
 	}
@@ -1345,6 +1450,24 @@ func loadFullBugInfo(c context.Context, bug *Bug, bugKey *db.Key,
 		}
 		ret.Crashes = append(ret.Crashes, rep)
 	}
+	// Query discussions.
+	discussions, err := discussionsForBug(c, bugKey)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(discussions, func(i, j int) bool {
+		return discussions[i].Summary.LastMessage.After(discussions[j].Summary.LastMessage)
+	})
+	for _, d := range discussions {
+		ret.Discussions = append(ret.Discussions, &dashapi.BugDiscussion{
+			Source:      dashapi.DiscussionSource(d.Source),
+			Type:        dashapi.DiscussionType(d.Type),
+			Subject:     d.Subject,
+			Link:        d.link(),
+			Reason:      d.attachmentReason(bugKey.StringID()),
+			LastMessage: d.Summary.LastMessage,
+		})
+	}
 	return ret, nil
 }
 
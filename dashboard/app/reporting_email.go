@@ -11,7 +11,9 @@ import (
 	"io"
 	"net/http"
 	"net/mail"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,8 +34,10 @@ import (
 // Email reporting interface.
 
 func initEmailReporting() {
-	http.HandleFunc("/cron/email_poll", handleEmailPoll)
+	http.HandleFunc("/cron/email_poll", handleCron(handleEmailPoll))
 	http.HandleFunc("/_ah/mail/", handleIncomingMail)
+	// The emails received in the read-only mode.
+	http.HandleFunc("/tasks/replay_mail/", handleIncomingMail)
 	http.HandleFunc("/_ah/bounce", handleEmailBounce)
 
 	mailingLists = make(map[string]bool)
@@ -76,6 +80,9 @@ type EmailConfig struct {
 	MailMaintainers    bool
 	DefaultMaintainers []string
 	SubjectPrefix      string
+	// SubsystemLists maps subsystem names to extra recipients of the reports about their bugs.
+	// If a bug gets assigned to such a subsystem after it was reported, the lists get a follow-up.
+	SubsystemLists map[string][]string
 }
 
 func (cfg *EmailConfig) Type() string {
@@ -97,9 +104,47 @@ func (cfg *EmailConfig) Validate() error {
 	if cfg.SubjectPrefix != strings.TrimSpace(cfg.SubjectPrefix) {
 		return fmt.Errorf("email config: subject prefix %q contains leading/trailing spaces", cfg.SubjectPrefix)
 	}
+	for name, lists := range cfg.SubsystemLists {
+		for _, email := range lists {
+			if _, err := mail.ParseAddress(email); err != nil {
+				return fmt.Errorf("subsystem %v: bad email address %q: %v", name, email, err)
+			}
+		}
+	}
 	return nil
 }
 
+// subsystemLists returns the deduplicated extra recipients for a bug with the given subsystems.
+func (cfg *EmailConfig) subsystemLists(subsystems []string) []string {
+	var lists [][]string
+	for _, name := range subsystems {
+		lists = append(lists, cfg.SubsystemLists[name])
+	}
+	return email.MergeEmailLists(lists...)
+}
+
+func (cfg *EmailConfig) bugSubsystemLists(bug *Bug) []string {
+	var names []string
+	for _, item := range bug.Tags.Subsystems {
+		names = append(names, item.Name)
+	}
+	return cfg.subsystemLists(names)
+}
+
+// newSubsystemLists returns the subsystem lists that have not seen the bug yet.
+// The lists that got the report are remembered in the reporting CC list, so each list
+// is notified at most once even if the subsystems change back and forth.
+func (cfg *EmailConfig) newSubsystemLists(bug *Bug, bugReporting *BugReporting) []string {
+	known := email.MergeEmailLists(strings.Split(bugReporting.CC, "|"), bug.UNCC)
+	var ret []string
+	for _, list := range cfg.bugSubsystemLists(bug) {
+		if !stringInList(known, list) {
+			ret = append(ret, list)
+		}
+	}
+	return ret
+}
+
 // handleEmailPoll is called by cron and sends emails for new bugs, if any.
 func handleEmailPoll(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
@@ -165,6 +210,16 @@ func emailSendBugReport(c context.Context, rep *dashapi.BugReport) error {
 	} else if len(rep.ReproSyz) != 0 {
 		cmd.ReproLevel = dashapi.ReproLevelSyz
 	}
+	// Remember the subsystem lists that got the report, so that they are not notified again.
+	var subsystems []string
+	for _, item := range rep.Subsystems {
+		subsystems = append(subsystems, item.Name)
+	}
+	for _, list := range cfg.subsystemLists(subsystems) {
+		if stringInList(rep.CC, list) {
+			cmd.CC = append(cmd.CC, list)
+		}
+	}
 	ok, reason, err := incomingCommand(c, cmd)
 	if !ok || err != nil {
 		return fmt.Errorf("failed to update reported bug: ok=%v reason=%v err=%v", ok, reason, err)
@@ -205,6 +260,7 @@ func emailPollNotifications(c context.Context) error {
 func emailSendBugNotif(c context.Context, notif *dashapi.BugNotification) error {
 	status, body := dashapi.BugStatusOpen, ""
 	var statusReason dashapi.BugStatusReason
+	var lists []string
 	switch notif.Type {
 	case dashapi.BugNotifUpstream:
 		body = "Sending this report to the next reporting stage."
@@ -224,6 +280,13 @@ func emailSendBugNotif(c context.Context, notif *dashapi.BugNotification) error
 			body += "Crashes did not happen for a while, no reproducer and no activity."
 		}
 		status = dashapi.BugStatusInvalid
+	case dashapi.BugNotifSubsystemLists:
+		lists = strings.Split(notif.Text, "|")
+		body = fmt.Sprintf("Now also notifying %v\nas the bug was assigned to the corresponding subsystems.",
+			strings.Join(lists, ", "))
+	case dashapi.BugNotifRenamed:
+		body = fmt.Sprintf("This bug was renamed from:\n\n%v\n\nto:\n\n%v\n\n"+
+			"New crashes with the former title are still attributed to this bug.", notif.Text, notif.Title)
 
 	default:
 		return fmt.Errorf("bad notification type %v", notif.Type)
@@ -232,7 +295,7 @@ func emailSendBugNotif(c context.Context, notif *dashapi.BugNotification) error
 	if err := json.Unmarshal(notif.Config, cfg); err != nil {
 		return fmt.Errorf("failed to unmarshal email config: %v", err)
 	}
-	to := email.MergeEmailLists([]string{cfg.Email}, notif.CC)
+	to := email.MergeEmailLists([]string{cfg.Email}, notif.CC, lists)
 	if cfg.MailMaintainers && notif.Public {
 		to = email.MergeEmailLists(to, notif.Maintainers, cfg.DefaultMaintainers)
 	}
@@ -248,6 +311,7 @@ func emailSendBugNotif(c context.Context, notif *dashapi.BugNotification) error
 		ID:           notif.ID,
 		Status:       status,
 		StatusReason: statusReason,
+		CC:           lists,
 		Notification: true,
 	}
 	ok, reason, err := incomingCommand(c, cmd)
@@ -363,6 +427,12 @@ func emailListReport(c context.Context, rep *dashapi.BugListReport, cfg *EmailCo
 		}
 		fmt.Fprintf(w, "%d\t%s\t%s\n", bug.Hits, repro, bug.Title)
 		fmt.Fprintf(w, "\t\t%s\n", bug.Link)
+		if bug.Assignee != "" {
+			fmt.Fprintf(w, "\t\tclaimed by %s\n", bug.Assignee)
+		}
+		if bug.MinimizedConfig != "" {
+			fmt.Fprintf(w, "\t\tminimized config: %s\n", bug.MinimizedConfig)
+		}
 	}
 	w.Flush()
 	args.Table = b.String()
@@ -437,9 +507,23 @@ func handleIncomingMail(w http.ResponseWriter, r *http.Request) {
 		source = item.Source
 		break
 	}
-	msg, err := email.Parse(r.Body, ownEmails(c), ownMailingLists(), []string{
+	var body io.Reader = r.Body
+	if isReadOnly(c) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Errorf(c, "failed to read email body: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if queueReadOnlyRequest(c, w, r, "/tasks/replay_mail/"+myEmail, data) {
+			return
+		}
+		body = bytes.NewReader(data)
+	}
+	// The email is parsed as a stream, see email_attachments.go.
+	msg, err := email.ParseWithLimits(body, ownEmails(c), ownMailingLists(), []string{
 		appURL(c),
-	})
+	}, incomingEmailLimitsFor(c))
 	if err != nil {
 		// Malformed emails constantly appear from spammers.
 		// But we have not seen errors parsing legit emails.
@@ -448,6 +532,9 @@ func handleIncomingMail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Infof(c, "received email at %q, source %q", myEmail, source)
+	if quarantineEmail(c, msg) {
+		return
+	}
 	if source == dashapi.NoDiscussion {
 		err = processIncomingEmail(c, msg)
 	} else {
@@ -456,6 +543,7 @@ func handleIncomingMail(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Errorf(c, "email processing failed: %s", err)
 	}
+	incMetric(c, metricEmailsProcessed, "", 1)
 }
 
 // nolint: gocyclo
@@ -475,6 +563,9 @@ func processIncomingEmail(c context.Context, msg *email.Email) error {
 	if bugInfo == nil && bugListInfo == nil {
 		return nil // error was already logged
 	}
+	if bugInfo != nil {
+		setEmailAttachmentsNamespace(c, msg, bugInfo.bug.Namespace)
+	}
 	// A mailing list can send us a duplicate email, to not process/reply
 	// to such duplicate emails, we ignore emails coming from our mailing lists.
 	fromMailingList := msg.MailingList != ""
@@ -494,10 +585,37 @@ func processIncomingEmail(c context.Context, msg *email.Email) error {
 		incomingBugListEmail(c, bugListInfo, msg)
 		return nil
 	}
-	if msg.Command == email.CmdTest {
+	if msg.Command == email.CmdTest || msg.Command == email.CmdTestOn {
 		return handleTestCommand(c, bugInfo, msg)
 	} else if msg.Command == email.CmdSet {
 		return handleSetCommand(c, bugInfo, msg)
+	} else if msg.Command == email.CmdAssign || msg.Command == email.CmdUnAssign {
+		return handleAssignCommand(c, bugInfo, msg)
+	} else if msg.Command == email.CmdSetGuilty {
+		return handleSetGuiltyCommand(c, bugInfo, msg)
+	} else if msg.Command == email.CmdMinimize {
+		return handleMinimizeCommand(c, bugInfo, msg)
+	} else if msg.Command == email.CmdMinimizeConfig {
+		return handleMinimizeConfigCommand(c, bugInfo, msg)
+	} else if msg.Command == email.CmdNoRepro {
+		return handleNoReproCommand(c, bugInfo, msg)
+	} else if msg.Command == email.CmdFocus {
+		return handleFocusCommand(c, bugInfo, msg)
+	} else if msg.Command == email.CmdRetestBisect {
+		return handleRetestBisectCommand(c, bugInfo, msg)
+	}
+	if msg.Author == ownEmail(c) && msg.InReplyTo == "" && bugInfo.bugReporting.ReportMessageID == "" {
+		if err := recordReportMessageID(c, bugInfo.bugKey, bugInfo.bugReporting.ID, msg.MessageID); err != nil {
+			log.Errorf(c, "failed to record the report message id: %v", err)
+		}
+	}
+	if msg.Command == email.CmdNone && msg.Author != ownEmail(c) && bugInfo.bug.Status == BugStatusOpen &&
+		bugInfo.bug.AssigneeEmail == "" && isClaimMessage(discussionExcerpt(msg.Body)) {
+		// This is a softer form of "#syz assign", so we don't reply to such messages.
+		// Unlike the command, it never takes the bug away from the current assignee.
+		if err := claimUnassignedBug(c, bugInfo.bugKey, msg.Author); err != nil {
+			log.Errorf(c, "failed to assign the bug: %v", err)
+		}
 	}
 	cmd := &dashapi.BugUpdate{
 		Status: emailCmdToStatus[msg.Command],
@@ -505,10 +623,17 @@ func processIncomingEmail(c context.Context, msg *email.Email) error {
 		ExtID:  msg.MessageID,
 		Link:   msg.Link,
 		CC:     msg.Cc,
+		User:   msg.Author,
 	}
 	bugID := bugInfo.bugReporting.ID
 	switch msg.Command {
-	case email.CmdNone, email.CmdUpstream, email.CmdInvalid, email.CmdUnDup:
+	case email.CmdNone, email.CmdUpstream, email.CmdUnDup:
+	case email.CmdInvalid:
+		cmd.InvalidReason = msg.CommandArgs
+		if cmd.InvalidReason == "" &&
+			config.Namespaces[bugInfo.bug.Namespace].InvalidReason == InvalidReasonReject {
+			return replyTo(c, msg, bugID, "The bug was not invalidated, please "+invalidReasonRequest)
+		}
 	case email.CmdFix:
 		if msg.CommandArgs == "" {
 			return replyTo(c, msg, bugID, "no commit title")
@@ -538,6 +663,13 @@ func processIncomingEmail(c context.Context, msg *email.Email) error {
 	if !ok && reply != "" {
 		return replyTo(c, msg, bugID, reply)
 	}
+	if ok && cmd.Status == dashapi.BugStatusInvalid && cmd.InvalidReason == "" &&
+		config.Namespaces[bugInfo.bug.Namespace].InvalidReason == InvalidReasonWarn {
+		warning := "The bug was invalidated, but next time please " + invalidReasonRequest
+		if err := replyTo(c, msg, bugID, warning); err != nil {
+			return err
+		}
+	}
 	if !mailingListInCC && msg.Command != email.CmdNone && msg.Command != email.CmdUnCC {
 		warnMailingListInCC(c, msg, bugID, mailingList)
 	}
@@ -570,22 +702,147 @@ func processDiscussionEmail(c context.Context, msg *email.Email, source dashapi.
 		log.Infof(c, "filtered all extIDs out")
 		return nil
 	}
+	reasons := map[string]dashapi.AttachmentReason{}
+	for _, id := range extIDs {
+		reasons[id] = emailAttachmentReason(msg, id)
+	}
+	excerpt := discussionExcerpt(msg.Body)
+	external := ownEmail(c) != msg.Author
+	targetTree := ""
+	if dType == dashapi.DiscussionPatch {
+		targetTree = kernelTreeHints().extract(msg.Subject, msg.Body, msg.Cc)
+	}
 	err := saveDiscussionMessage(c, &newDiscussionMessage{
-		id:        msg.MessageID,
-		subject:   msg.Subject,
-		msgSource: source,
-		msgType:   dType,
-		bugIDs:    extIDs,
-		inReplyTo: msg.InReplyTo,
-		external:  ownEmail(c) != msg.Author,
-		time:      msg.Date,
+		id:         msg.MessageID,
+		subject:    msg.Subject,
+		msgSource:  source,
+		msgType:    dType,
+		bugIDs:     extIDs,
+		bugReasons: reasons,
+		parentIDs:  msg.Parents(),
+		external:   external,
+		autoReply:  msg.AutoReply,
+		excerpt:    excerpt,
+		author:     msg.Author,
+		time:       msg.Date,
+		targetTree: targetTree,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to save in discussions: %v", err)
 	}
+	// If several bugs are discussed at once, it's not clear which reproducer is requested.
+	if external && !msg.AutoReply && len(extIDs) == 1 && isReproRequest(excerpt) {
+		if err := handleReproRequest(c, msg, source, extIDs[0]); err != nil {
+			log.Errorf(c, "failed to handle repro request: %v", err)
+		}
+	}
+	if dType == dashapi.DiscussionPatch && source == dashapi.DiscussionLore &&
+		external && !msg.AutoReply && len(extIDs) == 1 {
+		if err := autoTestPatch(c, msg, extIDs[0]); err != nil {
+			log.Errorf(c, "failed to auto-test the patch: %v", err)
+		}
+	}
 	return nil
 }
 
+// emailAttachmentReason tells how the bug ID was found in the message.
+func emailAttachmentReason(msg *email.Email, bugID string) dashapi.AttachmentReason {
+	if !stringInList(msg.BodyBugIDs, bugID) {
+		return dashapi.AttachAddress
+	}
+	for _, match := range reportedByRe.FindAllStringSubmatch(msg.Body, -1) {
+		if strings.Contains(match[1], bugID) {
+			return dashapi.AttachReportedBy
+		}
+	}
+	return dashapi.AttachBody
+}
+
+// handleReproRequest either sends the reproducer to the discussion (at most once per discussion)
+// or, if the bug has no reproducer yet, marks the bug as being in need of one.
+func handleReproRequest(c context.Context, msg *email.Email, source dashapi.DiscussionSource,
+	bugID string) error {
+	bug, bugKey, err := findBugByReportingID(c, bugID)
+	if err != nil {
+		return err
+	}
+	if bug.ReproLevel == ReproLevelNone {
+		if bug.NeedsRepro {
+			return nil
+		}
+		tx := func(c context.Context) error {
+			bug := new(Bug)
+			if err := db.Get(c, bugKey, bug); err != nil {
+				return fmt.Errorf("failed to get bug: %w", err)
+			}
+			bug.NeedsRepro = true
+			if _, err := db.Put(c, bugKey, bug); err != nil {
+				return fmt.Errorf("failed to put bug: %w", err)
+			}
+			return nil
+		}
+		return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+	}
+	nsConfig := config.Namespaces[bug.Namespace]
+	if !nsConfig.ReplyToReproRequests {
+		return nil
+	}
+	// Don't leak reproducers of bugs that are not yet public.
+	bugReporting, _ := bugReportingByID(bug, bugID)
+	if reporting := nsConfig.ReportingByName(bugReporting.Name); reporting == nil ||
+		reporting.AccessLevel != AccessPublic {
+		return nil
+	}
+	d, err := discussionByMessageID(c, source, discussionSources[source].NormalizeID(msg.MessageID))
+	if err != nil {
+		return fmt.Errorf("failed to find the discussion: %w", err)
+	}
+	sent := false
+	tx := func(c context.Context) error {
+		if err := db.Get(c, d.key(c), d); err != nil {
+			return fmt.Errorf("failed to get discussion: %w", err)
+		}
+		if !d.ReproSentTime.IsZero() {
+			sent = true
+			return nil
+		}
+		d.ReproSentTime = timeNow(c)
+		if _, err := db.Put(c, d.key(c), d); err != nil {
+			return fmt.Errorf("failed to put discussion: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	if sent {
+		return nil
+	}
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return err
+	}
+	build, err := loadBuild(c, bug.Namespace, crash.BuildID)
+	if err != nil {
+		return err
+	}
+	reply := new(bytes.Buffer)
+	fmt.Fprintf(reply, "The bug has a reproducer.\n\n")
+	if crash.ReproSyz != 0 {
+		fmt.Fprintf(reply, "syz repro:      %v\n", externalLink(c, textReproSyz, crash.ReproSyz))
+	}
+	if crash.ReproC != 0 {
+		fmt.Fprintf(reply, "C reproducer:   %v\n", externalLink(c, textReproC, crash.ReproC))
+	}
+	fmt.Fprintf(reply, "kernel config:  %v\n", externalLink(c, textKernelConfig, build.KernelConfig))
+	fmt.Fprintf(reply, "dashboard link: %v/bug?extid=%v\n", appURL(c), bugID)
+	return replyTo(c, msg, bugID, reply.String())
+}
+
+// The example is indented to not be mistaken for a command.
+const invalidReasonRequest = "give the reason why the bug is invalid " +
+	"on the same line as the command, e.g.:\n\n  #syz invalid: the crash is caused by a broken test setup\n"
+
 var emailCmdToStatus = map[email.Command]dashapi.BugStatus{
 	email.CmdNone:     dashapi.BugStatusUpdate,
 	email.CmdUpstream: dashapi.BugStatusUpstream,
@@ -598,8 +855,32 @@ var emailCmdToStatus = map[email.Command]dashapi.BugStatus{
 }
 
 func handleTestCommand(c context.Context, info *bugInfoResult, msg *email.Email) error {
-	args := strings.Split(msg.CommandArgs, " ")
-	if len(args) != 2 {
+	args, reproID := extractTestRepro(strings.Split(msg.CommandArgs, " "))
+	testOn := ""
+	if msg.Command == email.CmdTestOn {
+		if msg.CommandArgs == "" {
+			args = nil
+		}
+		if len(args) != 1 && len(args) != 3 {
+			return replyTo(c, msg, info.bugReporting.ID,
+				fmt.Sprintf("want a manager or an arch and optionally 2 args (repo, branch), got %v args",
+					len(args)))
+		}
+		testOn, args = args[0], args[1:]
+		if len(args) == 0 {
+			repo, branch, err := bugTestTree(c, info.bug)
+			if err != nil {
+				return err
+			}
+			args = []string{repo, branch}
+		}
+	}
+	series := strings.HasPrefix(args[0], email.LoreLinkPrefix)
+	if series && len(args) != 1 && len(args) != 3 {
+		return replyTo(c, msg, info.bugReporting.ID,
+			fmt.Sprintf("want a lore link and optionally 2 args (repo, branch), got %v args", len(args)))
+	}
+	if !series && len(args) != 2 {
 		return replyTo(c, msg, info.bugReporting.ID,
 			fmt.Sprintf("want 2 args (repo, branch), got %v", len(args)))
 	}
@@ -607,11 +888,51 @@ func handleTestCommand(c context.Context, info *bugInfoResult, msg *email.Email)
 		log.Warningf(c, "%v: bug is not AccessPublic, patch testing request is denied", info.bug.Title)
 		return nil
 	}
+	patch := msg.Patch
+	if oversized := msg.OversizedPatch(); patch == "" && !series && oversized != nil {
+		if oversized.Truncated {
+			return replyTo(c, msg, info.bugReporting.ID,
+				fmt.Sprintf("The attached patch %q is too large (%v bytes) and was truncated.\n"+
+					"Please send a smaller patch, or push the change to a git tree and test it "+
+					"with \"#syz test: <repo> <branch>\".", oversized.Name, oversized.Size))
+		}
+		data, err := loadEmailAttachment(c, oversized.Ref)
+		if err != nil {
+			return err
+		}
+		patch = email.ParsePatch(data)
+	}
+	if series {
+		loreSeries, err := loadLoreSeries(c, args[0])
+		if err != nil {
+			return replyTo(c, msg, info.bugReporting.ID, err.Error())
+		}
+		log.Infof(c, "testing %v patches from %v", loreSeries.Patches, args[0])
+		patch = loreSeries.Patch
+		args = args[1:]
+		if len(args) == 0 {
+			repo, branch, err := bugTestTree(c, info.bug)
+			if err != nil {
+				return err
+			}
+			args = []string{repo, branch}
+		}
+	}
 	reply := ""
 	err := handleTestRequest(c, &testReqArgs{
 		bug: info.bug, bugKey: info.bugKey, bugReporting: info.bugReporting,
 		user: msg.Author, extID: msg.MessageID, link: msg.Link,
-		patch: []byte(msg.Patch), repo: args[0], branch: args[1], jobCC: msg.Cc})
+		patch: []byte(patch), config: []byte(msg.Config), repo: args[0], branch: args[1], jobCC: msg.Cc,
+		testOn: testOn, reproID: reproID})
+	if err == nil && msg.Config != "" {
+		warning, err := testConfigWarning(c, info.bug, args[0], args[1], []byte(msg.Config))
+		if err != nil {
+			log.Errorf(c, "failed to check the test config: %v", err)
+		} else if warning != "" {
+			// The job is already scheduled, the warning is only a heads-up.
+			return replyTo(c, msg, info.bugReporting.ID, warning)
+		}
+	}
 	if err != nil {
 		switch e := err.(type) {
 		case *TestRequestDeniedError:
@@ -632,6 +953,60 @@ func handleTestCommand(c context.Context, info *bugInfoResult, msg *email.Email)
 	return nil
 }
 
+// bugTestTree returns the tree the bug was found on.
+func bugTestTree(c context.Context, bug *Bug) (string, string, error) {
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find a crash: %w", err)
+	}
+	build, err := loadBuild(c, bug.Namespace, crash.BuildID)
+	if err != nil {
+		return "", "", err
+	}
+	return build.KernelRepo, build.KernelBranch, nil
+}
+
+type uiTestConfigWarning struct {
+	Missing        []string
+	TreeDiffers    bool
+	OrigRepo       string
+	OrigBranch     string
+	OrigConfigLink string
+}
+
+// testConfigWarning checks the custom config of the test request against the config
+// the bug was found with and returns the warning to reply with, if any options are missing.
+func testConfigWarning(c context.Context, bug *Bug, repo, branch string, config []byte) (string, error) {
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return "", fmt.Errorf("failed to find a crash: %w", err)
+	}
+	build, err := loadBuild(c, bug.Namespace, crash.BuildID)
+	if err != nil {
+		return "", err
+	}
+	origConfig, _, err := getText(c, textKernelConfig, build.KernelConfig)
+	if err != nil {
+		return "", err
+	}
+	missing, err := missingTestConfigOptions(config, origConfig)
+	if err != nil || len(missing) == 0 {
+		return "", err
+	}
+	args := &uiTestConfigWarning{
+		Missing:        missing,
+		TreeDiffers:    repo != build.KernelRepo || branch != build.KernelBranch,
+		OrigRepo:       build.KernelRepo,
+		OrigBranch:     build.KernelBranch,
+		OrigConfigLink: externalLink(c, textKernelConfig, build.KernelConfig),
+	}
+	body := new(bytes.Buffer)
+	if err := mailTemplates.ExecuteTemplate(body, "mail_test_config.txt", args); err != nil {
+		return "", fmt.Errorf("failed to execute mail_test_config.txt template: %w", err)
+	}
+	return body.String(), nil
+}
+
 var (
 	// The format is `#syz set KEY: value(s)`. We also tolerate `#syz set KEY value(s)`.
 	setCmdRe           = regexp.MustCompile(`^(\w+):?\s*(.*?)\s*$`)
@@ -658,7 +1033,13 @@ func handleSetCommand(c context.Context, info *bugInfoResult, msg *email.Email)
 			fmt.Sprintf(cmdParseFailureFmt, subsystemsURL))
 	}
 	cmd, args := match[1], match[2]
-	// Now we only support setting bug's subsystems.
+	if cmd == "cve" || cmd == "cves" {
+		return handleSetCVECommand(c, info, msg, args)
+	}
+	if cmd == "repro" {
+		return handleSetReproCommand(c, info, msg, args)
+	}
+	// Otherwise we only support setting bug's subsystems.
 	// Also let's tolerate both subsystem spellings.
 	if cmd != "subsystem" && cmd != "subsystems" {
 		return replyTo(c, msg, info.bugReporting.ID,
@@ -693,6 +1074,225 @@ func handleSetCommand(c context.Context, info *bugInfoResult, msg *email.Email)
 		"Thank you!\n\nI've successfully updated the bug's subsystems.")
 }
 
+var claimRe = regexp.MustCompile(`(?im)^\s*i(?:'ll| will) take (?:this|it)(?: one)?\s*[.!]?\s*$`)
+
+// isClaimMessage returns true if the sender announces that they are going to work on the bug.
+// The phrase must be the whole line, so that e.g. "I'll take this into account" does not match.
+func isClaimMessage(excerpt string) bool {
+	return claimRe.MatchString(excerpt)
+}
+
+func handleAssignCommand(c context.Context, info *bugInfoResult, msg *email.Email) error {
+	bugID := info.bugReporting.ID
+	assignee := ""
+	if msg.Command == email.CmdAssign {
+		if info.bug.Status != BugStatusOpen {
+			return replyTo(c, msg, bugID, "The bug is already closed.")
+		}
+		assignee = msg.Author
+	}
+	if err := updateBugAssignee(c, info.bugKey, assignee); err != nil {
+		log.Errorf(c, "failed to update the bug assignee: %s", err)
+		return replyTo(c, msg, bugID, "I've failed to update the assignee due to an internal error.\n")
+	}
+	if err := saveCommandInDiscussion(c, msg, info); err != nil {
+		log.Errorf(c, "failed to save the command in discussions: %v", err)
+	}
+	// All the replies below will only be sent to the initiator and the mailing list.
+	msg.Cc = []string{info.reporting.Config.(*EmailConfig).Email}
+	if assignee == "" {
+		return replyTo(c, msg, bugID, "Thank you!\n\nThe bug is no longer assigned to anyone.")
+	}
+	return replyTo(c, msg, bugID, fmt.Sprintf("Thank you!\n\nThe bug is now assigned to %v.", assignee))
+}
+
+func handleSetGuiltyCommand(c context.Context, info *bugInfoResult, msg *email.Email) error {
+	bugID := info.bugReporting.ID
+	file := msg.CommandArgs
+	if file == "" {
+		return replyTo(c, msg, bugID, "Please specify the guilty file, e.g. \"#syz set-guilty mm/slub.c\".")
+	}
+	if err := validateGuiltyFile(file); err != nil {
+		return replyTo(c, msg, bugID, fmt.Sprintf("%v.", err))
+	}
+	// All the replies below will only be sent to the initiator and the mailing list.
+	msg.Cc = []string{info.reporting.Config.(*EmailConfig).Email}
+	if err := setBugGuiltyFile(c, info.bugKey, file, msg.Author); err != nil {
+		log.Errorf(c, "failed to set the guilty file: %s", err)
+		return replyTo(c, msg, bugID, "I've failed to update the guilty file due to an internal error.\n")
+	}
+	return replyTo(c, msg, bugID, fmt.Sprintf("Thank you!\n\nThe guilty file of the bug is now %v.", file))
+}
+
+func handleMinimizeCommand(c context.Context, info *bugInfoResult, msg *email.Email) error {
+	bugID := info.bugReporting.ID
+	// All the replies below will only be sent to the initiator and the mailing list.
+	msg.Cc = []string{info.reporting.Config.(*EmailConfig).Email}
+	err := requestMinimization(c, info.bugKey, msg.Author, msg.Link)
+	if denied, ok := err.(*MinimizeDeniedError); ok {
+		return replyTo(c, msg, bugID, denied.Error())
+	} else if err != nil {
+		log.Errorf(c, "failed to request minimization: %s", err)
+		return replyTo(c, msg, bugID, "I've failed to queue the minimization due to an internal error.\n")
+	}
+	return replyTo(c, msg, bugID, "Thank you!\n\nI've queued another attempt to minimize the reproducer.\n"+
+		"The result will be shown on the bug page.")
+}
+
+func handleMinimizeConfigCommand(c context.Context, info *bugInfoResult, msg *email.Email) error {
+	bugID := info.bugReporting.ID
+	msg.Cc = []string{info.reporting.Config.(*EmailConfig).Email}
+	err := requestConfigMinimization(c, info.bugKey, msg.Author, msg.Link)
+	if denied, ok := err.(*ConfigMinimizeDeniedError); ok {
+		return replyTo(c, msg, bugID, denied.Error())
+	} else if err != nil {
+		log.Errorf(c, "failed to request config minimization: %s", err)
+		return replyTo(c, msg, bugID, "I've failed to queue the config minimization due to an internal error.\n")
+	}
+	return replyTo(c, msg, bugID, "Thank you!\n\nI've queued the minimization of the kernel config.\n"+
+		"The minimized config will be linked on the bug page.")
+}
+
+func handleNoReproCommand(c context.Context, info *bugInfoResult, msg *email.Email) error {
+	bugID := info.bugReporting.ID
+	report := NoReproReport{
+		Time:   timeNow(c),
+		User:   msg.Author,
+		Link:   msg.Link,
+		Commit: strings.TrimSpace(msg.CommandArgs),
+	}
+	reply, err := noReproReply(c, info.bug, info.bugKey, report, []byte(msg.Config))
+	if err != nil {
+		log.Errorf(c, "failed to record the norepro report: %s", err)
+		return replyTo(c, msg, bugID, "I've failed to record the report due to an internal error.\n")
+	}
+	return replyTo(c, msg, bugID, reply)
+}
+
+func handleFocusCommand(c context.Context, info *bugInfoResult, msg *email.Email) error {
+	bugID := info.bugReporting.ID
+	msg.Cc = []string{info.reporting.Config.(*EmailConfig).Email}
+	until, err := requestFocus(c, info.bugKey, &BugFocus{
+		User:        msg.Author,
+		Link:        msg.Link,
+		MessageID:   msg.MessageID,
+		Subject:     msg.Subject,
+		ReportingID: bugID,
+		CC:          msg.Cc[0],
+	})
+	if denied, ok := err.(*FocusDeniedError); ok {
+		return replyTo(c, msg, bugID, denied.Error())
+	} else if err != nil {
+		log.Errorf(c, "failed to request focus: %s", err)
+		return replyTo(c, msg, bugID, "I've failed to schedule the focused fuzzing due to an internal error.\n")
+	}
+	return replyTo(c, msg, bugID, fmt.Sprintf("Thank you!\n\nThe fuzzing instances will focus on the reproducer"+
+		" of this bug until %v.\nI will reply with the results once the time is over.",
+		until.Format("2006/01/02 15:04 MST")))
+}
+
+func updateBugAssignee(c context.Context, bugKey *db.Key, assignee string) error {
+	now := timeNow(c)
+	ns := ""
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %v", err)
+		}
+		ns = bug.Namespace
+		bug.setAssignee(assignee, now)
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %v", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	invalidateBugLists(c, ns)
+	return nil
+}
+
+// claimUnassignedBug assigns the bug to assignee unless someone has already claimed it.
+func claimUnassignedBug(c context.Context, bugKey *db.Key, assignee string) error {
+	now := timeNow(c)
+	ns := ""
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		ns = ""
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %v", err)
+		}
+		if bug.AssigneeEmail != "" {
+			return nil
+		}
+		ns = bug.Namespace
+		bug.setAssignee(assignee, now)
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %v", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	if ns != "" {
+		invalidateBugLists(c, ns)
+	}
+	return nil
+}
+
+// recordReportMessageID remembers the Message-ID of our report for the bug reporting.
+func recordReportMessageID(c context.Context, bugKey *db.Key, bugID, messageID string) error {
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %v", err)
+		}
+		bugReporting, _ := bugReportingByID(bug, bugID)
+		if bugReporting == nil || bugReporting.ReportMessageID != "" {
+			return nil
+		}
+		bugReporting.ReportMessageID = messageID
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %v", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+// saveCommandInDiscussion records a command sent directly to the bot in the discussion it replies to.
+// If the mailing list copy of the message reaches us as well, it's deduplicated by the message ID.
+func saveCommandInDiscussion(c context.Context, msg *email.Email, info *bugInfoResult) error {
+	parentIDs := msg.Parents()
+	if len(parentIDs) == 0 {
+		return nil
+	}
+	for source := range discussionSources {
+		d, err := discussionByParents(c, source, parentIDs)
+		if err != nil {
+			continue
+		}
+		return saveDiscussionMessage(c, &newDiscussionMessage{
+			id:        msg.MessageID,
+			subject:   msg.Subject,
+			msgSource: source,
+			msgType:   dashapi.DiscussionType(d.Type),
+			bugIDs:    []string{info.bugReporting.ID},
+			bugReasons: map[string]dashapi.AttachmentReason{
+				info.bugReporting.ID: info.reason,
+			},
+			parentIDs: parentIDs,
+			external:  true,
+			excerpt:   discussionExcerpt(msg.Body),
+			author:    msg.Author,
+			time:      msg.Date,
+		})
+	}
+	return nil
+}
+
 func handleEmailBounce(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 	body, err := io.ReadAll(r.Body)
@@ -783,6 +1383,8 @@ type bugInfoResult struct {
 	bugKey       *db.Key
 	bugReporting *BugReporting
 	reporting    *Reporting
+	// reason tells how the bug was determined from the message.
+	reason dashapi.AttachmentReason
 }
 
 func loadBugInfo(c context.Context, msg *email.Email) *bugInfoResult {
@@ -854,7 +1456,7 @@ func loadBugInfo(c context.Context, msg *email.Email) *bugInfoResult {
 			bug.Namespace, bugReporting.Name, reporting.Config.Type())
 		return nil
 	}
-	return &bugInfoResult{bug, bugKey, bugReporting, reporting}
+	return &bugInfoResult{bug, bugKey, bugReporting, reporting, emailAttachmentReason(msg, bugID)}
 }
 
 func ownMailingLists() []string {
@@ -895,7 +1497,7 @@ func matchBugFromList(c context.Context, sender, subject string) (*bugInfoResult
 	if err != nil {
 		return nil, err
 	}
-	// Query all bugs with this title.
+	// Query all bugs with this title, the old threads of renamed bugs have their former titles.
 	var bugs []*Bug
 	bugKeys, err := db.NewQuery("Bug").
 		Filter("Title=", title).
@@ -903,6 +1505,14 @@ func matchBugFromList(c context.Context, sender, subject string) (*bugInfoResult
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch bugs: %v", err)
 	}
+	var renamed []*Bug
+	renamedKeys, err := db.NewQuery("Bug").
+		Filter("FormerTitles=", title).
+		GetAll(c, &renamed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch bugs: %v", err)
+	}
+	bugs, bugKeys = append(bugs, renamed...), append(bugKeys, renamedKeys...)
 	// Filter the bugs by the email.
 	candidates := []*bugInfoResult{}
 	for i, bug := range bugs {
@@ -938,6 +1548,7 @@ func matchBugFromList(c context.Context, sender, subject string) (*bugInfoResult
 		candidates = append(candidates, &bugInfoResult{
 			bug: bug, bugKey: bugKeys[i],
 			bugReporting: bugReporting, reporting: reporting,
+			reason: dashapi.AttachTitle,
 		})
 	}
 	if len(candidates) > 1 {
@@ -974,7 +1585,8 @@ func (p *subjectTitleParser) parseTitle(subject string) (string, int, error) {
 
 func (p *subjectTitleParser) prepareRegexps() {
 	p.ready.Do(func() {
-		stripPrefixes := []string{`R[eE]:`}
+		// Replies to forwards may have long chains of prefixes, e.g. "Re: Fwd: Re: [syzbot] ...".
+		stripPrefixes := []string{`R[eE]:`, `(?i:fwd?):`}
 		for _, ns := range config.Namespaces {
 			for _, rep := range ns.Reporting {
 				emailConfig, ok := rep.Config.(*EmailConfig)
@@ -1029,7 +1641,11 @@ func sendMailText(c context.Context, cfg *EmailConfig, subject, from string, to
 		msg.Headers = mail.Header{"In-Reply-To": []string{replyTo}}
 		msg.Subject = replySubject(msg.Subject)
 	}
-	return sendEmail(c, msg)
+	if err := sendEmail(c, msg); err != nil {
+		return err
+	}
+	incMetric(c, metricReportingEmails, "", 1)
+	return nil
 }
 
 func replyTo(c context.Context, msg *email.Email, bugID, reply string) error {
@@ -1066,6 +1682,315 @@ func replySubject(subject string) string {
 	return subject
 }
 
+// announceLandedFix replies to the latest patch discussion of the just fixed bug.
+// The reply is sent at most once per discussion and is recorded as a bot message.
+func announceLandedFix(c context.Context, bug *Bug, manager string) error {
+	return announceLandedFixes(c, []*Bug{bug}, manager)
+}
+
+// announceLandedFixes is like announceLandedFix, but the bugs whose latest patch discussion
+// is the same thread (e.g. the bugs fixed by one patch series) get a single combined reply.
+func announceLandedFixes(c context.Context, bugs []*Bug, manager string) error {
+	var firstErr error
+	fail := func(err error) {
+		log.Errorf(c, "failed to announce the fix: %v", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	var groups [][]*landedFixTarget
+	threads := map[string]int{}
+	for _, bug := range bugs {
+		target, err := findLandedFixTarget(c, bug)
+		if err != nil {
+			fail(fmt.Errorf("bug %q: %w", bug.Title, err))
+			continue
+		}
+		if target == nil {
+			continue
+		}
+		if i, ok := threads[target.patch.ID]; ok {
+			groups[i] = append(groups[i], target)
+			continue
+		}
+		threads[target.patch.ID] = len(groups)
+		groups = append(groups, []*landedFixTarget{target})
+	}
+	for _, group := range groups {
+		if err := sendLandedFixAnnouncement(c, group, manager); err != nil {
+			fail(err)
+		}
+	}
+	return firstErr
+}
+
+// landedFixTarget is the patch discussion to announce the fix of the bug in.
+type landedFixTarget struct {
+	bug          *Bug
+	bugReporting *BugReporting
+	cfg          *EmailConfig
+	patch        *Discussion
+	last         *DiscussionMessage
+	participants []string
+}
+
+// findLandedFixTarget returns nil if there's no discussion to announce the fix in.
+func findLandedFixTarget(c context.Context, bug *Bug) (*landedFixTarget, error) {
+	nsConfig := config.Namespaces[bug.Namespace]
+	if !nsConfig.AnnounceLandedFixes {
+		return nil, nil
+	}
+	bugReporting := lastReportedReporting(bug)
+	if bugReporting == nil {
+		return nil, nil
+	}
+	reporting := nsConfig.ReportingByName(bugReporting.Name)
+	if reporting == nil {
+		return nil, nil
+	}
+	cfg, ok := reporting.Config.(*EmailConfig)
+	if !ok {
+		return nil, nil
+	}
+	discussions, err := discussionsForBug(c, bug.key(c))
+	if err != nil {
+		return nil, err
+	}
+	var patch *Discussion
+	var last *DiscussionMessage
+	for _, d := range discussions {
+		// Only lore discussions consist of emails that we can reply to.
+		if d.Type != string(dashapi.DiscussionPatch) || d.Source != string(dashapi.DiscussionLore) {
+			continue
+		}
+		if m := lastThreadMessage(d); m != nil && (last == nil || last.orderTime().Before(m.orderTime())) {
+			patch, last = d, m
+		}
+	}
+	if patch == nil {
+		return nil, nil
+	}
+	if _, ok := patch.messageIDs()[fixLandedMessageID(bugReporting.ID)]; ok {
+		return nil, nil
+	}
+	return &landedFixTarget{
+		bug:          bug,
+		bugReporting: bugReporting,
+		cfg:          cfg,
+		patch:        patch,
+		last:         last,
+		participants: patchDiscussionParticipants(discussions),
+	}, nil
+}
+
+// sendLandedFixAnnouncement sends one reply about all the bugs discussed in the same thread.
+func sendLandedFixAnnouncement(c context.Context, targets []*landedFixTarget, manager string) error {
+	first := targets[0]
+	build, err := lastManagerBuild(c, first.bug.Namespace, manager)
+	if err != nil {
+		return err
+	}
+	args := &uiFixLanded{
+		Tree: kernelRepoInfo(build).Alias,
+		Link: fmt.Sprintf("%v/bug?extid=%v", appURL(c), first.bugReporting.ID),
+	}
+	discussion := &dashapi.Discussion{
+		ID:         first.patch.ID,
+		Source:     dashapi.DiscussionLore,
+		Type:       dashapi.DiscussionPatch,
+		BugReasons: map[string]dashapi.AttachmentReason{},
+	}
+	var to, participants []string
+	seenCommits := map[string]bool{}
+	// The last message of the thread may differ between the bugs if some of them
+	// are not yet attached to the newest messages.
+	last := first.last
+	for _, target := range targets {
+		bug, bugReporting := target.bug, target.bugReporting
+		for i, title := range bug.Commits {
+			if seenCommits[title] {
+				continue
+			}
+			seenCommits[title] = true
+			args.Commits = append(args.Commits, &uiCommit{
+				Hash:  bug.getCommitInfo(i).Hash,
+				Title: title,
+			})
+		}
+		if len(targets) > 1 {
+			args.Bugs = append(args.Bugs, &uiFixLandedBug{
+				Title: bug.displayTitle(),
+				Link:  fmt.Sprintf("%v/bug?extid=%v", appURL(c), bugReporting.ID),
+			})
+		}
+		// The announcement is sent from the first bug address.
+		discussion.BugIDs = append(discussion.BugIDs, bugReporting.ID)
+		discussion.BugReasons[bugReporting.ID] = dashapi.AttachAddress
+		discussion.Messages = append(discussion.Messages, dashapi.DiscussionMessage{
+			ID:   fixLandedMessageID(bugReporting.ID),
+			Time: timeNow(c),
+		})
+		to = email.MergeEmailLists(to, []string{target.cfg.Email})
+		if bugReporting.CC != "" {
+			to = email.MergeEmailLists(to, strings.Split(bugReporting.CC, "|"))
+		}
+		participants = append(participants, target.participants...)
+		if last.orderTime().Before(target.last.orderTime()) {
+			last = target.last
+		}
+	}
+	body := new(bytes.Buffer)
+	if err := mailTemplates.ExecuteTemplate(body, "mail_fix_landed.txt", args); err != nil {
+		return fmt.Errorf("failed to execute mail_fix_landed.txt template: %v", err)
+	}
+	// Record the reply first, so that we don't spam in case of errors.
+	if err := mergeDiscussion(c, discussion); err != nil {
+		return err
+	}
+	from, err := email.AddAddrContext(fromAddr(c), first.bugReporting.ID)
+	if err != nil {
+		return err
+	}
+	cc := fixLandedCC(to, participants,
+		append(append([]string{}, config.DoNotContact...), ownEmails(c)...), maxFixLandedParticipants)
+	// The patch subject must be kept as is, so no SubjectPrefix.
+	return sendEmail(c, &aemail.Message{
+		Sender:  from,
+		To:      to,
+		Cc:      cc,
+		Subject: replySubject(first.patch.Subject),
+		Body:    body.String(),
+		Headers: mail.Header{"In-Reply-To": []string{last.ID}},
+	})
+}
+
+// Up to that many discussion participants are CCed on the fix landed announcement.
+const maxFixLandedParticipants = 10
+
+// patchDiscussionParticipants returns the external authors of the patch discussions, most recent first.
+func patchDiscussionParticipants(discussions []*Discussion) []string {
+	var messages []*DiscussionMessage
+	for _, d := range discussions {
+		if d.Type != string(dashapi.DiscussionPatch) {
+			continue
+		}
+		for i := range d.Messages {
+			if m := &d.Messages[i]; m.External && !m.AutoReply && m.Author != "" {
+				messages = append(messages, m)
+			}
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].orderTime().After(messages[j].orderTime())
+	})
+	var ret []string
+	for _, m := range messages {
+		ret = append(ret, m.Author)
+	}
+	return ret
+}
+
+// fixLandedCC selects up to limit participants for the CC list in the order they are given.
+// Malformed addresses, the existing recipients and those in doNotContact are skipped.
+func fixLandedCC(to, participants, doNotContact []string, limit int) []string {
+	skip := map[string]bool{}
+	for _, addr := range append(append([]string{}, to...), doNotContact...) {
+		skip[email.CanonicalEmail(addr)] = true
+	}
+	var cc []string
+	for _, addr := range participants {
+		parsed, err := mail.ParseAddress(addr)
+		if err != nil {
+			continue
+		}
+		canonical := email.CanonicalEmail(parsed.Address)
+		if skip[canonical] {
+			continue
+		}
+		skip[canonical] = true
+		cc = append(cc, parsed.Address)
+		if len(cc) == limit {
+			break
+		}
+	}
+	return cc
+}
+
+type uiFixLanded struct {
+	Tree    string
+	Commits []*uiCommit
+	Link    string
+	// Bugs are only set if the announcement is about several bugs.
+	Bugs []*uiFixLandedBug
+}
+
+type uiFixLandedBug struct {
+	Title string
+	Link  string
+}
+
+// fixLandedMessageID is the ID under which our fix announcement is recorded in the discussion.
+// App Engine does not let us set Message-ID of outgoing emails, so it's a synthetic one.
+func fixLandedMessageID(bugID string) string {
+	return fmt.Sprintf("<fix-landed.%v@syzbot>", bugID)
+}
+
+func isFixLandedMessageID(id string) bool {
+	return strings.HasPrefix(id, "<fix-landed.") && strings.HasSuffix(id, "@syzbot>")
+}
+
+// lastThreadMessage returns the most recent message of the thread that can be replied to.
+// Our own announcements are skipped, as their Message-IDs don't exist outside of the dashboard.
+func lastThreadMessage(d *Discussion) *DiscussionMessage {
+	for i := len(d.Messages) - 1; i >= 0; i-- {
+		if m := &d.Messages[i]; !m.AutoReply && !isFixLandedMessageID(m.ID) {
+			return m
+		}
+	}
+	return nil
+}
+
+// mailtoLink generates a mailto: URI (RFC 6068) for a reply into an existing email thread.
+func mailtoLink(to, cc []string, subject, inReplyTo string) string {
+	escape := func(s string) string {
+		// QueryEscape encodes spaces as '+', but mail clients expect %20.
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	var addrs []string
+	for _, addr := range to {
+		addrs = append(addrs, escape(addr))
+	}
+	link := "mailto:" + strings.Join(addrs, ",")
+	var params []string
+	if len(cc) != 0 {
+		params = append(params, "cc="+escape(strings.Join(cc, ",")))
+	}
+	params = append(params, "subject="+escape(replySubject(subject)))
+	if inReplyTo != "" {
+		params = append(params, "In-Reply-To="+escape(inReplyTo))
+	}
+	return link + "?" + strings.Join(params, "&")
+}
+
+// gitSendEmailCommand generates a git send-email invocation that sends patches
+// as replies into an existing email thread.
+func gitSendEmailCommand(to, cc []string, inReplyTo string) string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	args := []string{"git send-email"}
+	if inReplyTo != "" {
+		args = append(args, "--in-reply-to="+quote(inReplyTo))
+	}
+	for _, addr := range to {
+		args = append(args, "--to="+quote(addr))
+	}
+	for _, addr := range cc {
+		args = append(args, "--cc="+quote(addr))
+	}
+	return strings.Join(append(args, "0001-*.patch"), " ")
+}
+
 func ownEmail(c context.Context) string {
 	if config.OwnEmailAddress != "" {
 		return config.OwnEmailAddress
@@ -0,0 +1,109 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+// Every incoming email, API call and bug page resolves a reporting ID with
+// findBugByReportingID, which is a non-ancestor query over all bugs.
+// The resolved bug keys are cached in memcache for reportingIDCacheTTL.
+// Unknown IDs (e.g. replies to old or foreign threads) are cached for reportingIDMissTTL.
+// A cached key is only a hint: the bug is always re-read and must still carry the reporting ID,
+// otherwise the entry is dropped and the query is repeated. So stale entries can't make us
+// act on (and reveal) the wrong bug. Reporting IDs are only assigned by updateReportings,
+// so the callers that store bugs with new IDs call forgetReportingIDs to drop the cached misses.
+
+const (
+	reportingIDCacheTTL = time.Hour
+	reportingIDMissTTL  = time.Minute
+)
+
+func reportingIDCacheKey(id string) string {
+	return "bug-reporting-id-" + id
+}
+
+// cachedReportingID returns the cached bug key hash for the reporting ID.
+// The hash is empty if the ID is known to match no bugs.
+func cachedReportingID(c context.Context, id string) (string, bool) {
+	item, err := memcache.Get(c, reportingIDCacheKey(id))
+	if err != nil {
+		if err != memcache.ErrCacheMiss {
+			log.Errorf(c, "failed to get reporting id %q from memcache: %v", id, err)
+		}
+		return "", false
+	}
+	return string(item.Value), true
+}
+
+func cacheReportingID(c context.Context, id string, bugKey *db.Key) {
+	item := &memcache.Item{
+		Key:        reportingIDCacheKey(id),
+		Expiration: reportingIDMissTTL,
+	}
+	if bugKey != nil {
+		item.Value = []byte(bugKey.StringID())
+		item.Expiration = reportingIDCacheTTL
+	}
+	if err := memcache.Set(c, item); err != nil {
+		log.Errorf(c, "failed to cache reporting id %q: %v", id, err)
+	}
+}
+
+// forgetReportingIDs drops the cached entries for all reporting IDs of the bug.
+// It must be called after a bug with new reporting IDs is stored.
+func forgetReportingIDs(c context.Context, bug *Bug) {
+	var keys []string
+	for _, rep := range bug.Reporting {
+		keys = append(keys, reportingIDCacheKey(rep.ID))
+	}
+	err := memcache.DeleteMulti(c, keys)
+	var merr appengine.MultiError
+	if errors.As(err, &merr) {
+		for _, err := range merr {
+			if err != nil && err != memcache.ErrCacheMiss {
+				log.Errorf(c, "failed to forget reporting ids of %v: %v", bug.keyHash(), err)
+				return
+			}
+		}
+	} else if err != nil {
+		log.Errorf(c, "failed to forget reporting ids of %v: %v", bug.keyHash(), err)
+	}
+}
+
+// lookupCachedReportingID resolves the reporting ID through the cache.
+// If found is false, the cache knows nothing valid about the ID.
+func lookupCachedReportingID(c context.Context, id string) (bug *Bug, bugKey *db.Key, found bool) {
+	hash, ok := cachedReportingID(c, id)
+	if !ok {
+		return nil, nil, false
+	}
+	if hash == "" {
+		return nil, nil, true
+	}
+	bugKey = db.NewKey(c, "Bug", hash, 0, nil)
+	bug = new(Bug)
+	if err := db.Get(c, bugKey, bug); err != nil {
+		if err != db.ErrNoSuchEntity {
+			log.Errorf(c, "failed to get cached bug %v: %v", hash, err)
+		}
+		return nil, nil, false
+	}
+	if rep, _ := bugReportingByID(bug, id); rep == nil {
+		log.Errorf(c, "cached bug %v does not have reporting id %q", hash, id)
+		if err := memcache.Delete(c, reportingIDCacheKey(id)); err != nil && err != memcache.ErrCacheMiss {
+			log.Errorf(c, "failed to forget reporting id %q: %v", id, err)
+		}
+		return nil, nil, false
+	}
+	return bug, bugKey, true
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReportingIDCache(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	rep1 := c.client.pollBug()
+
+	// The first lookup populates the cache, the second one is served from it.
+	_, ok := cachedReportingID(c.ctx, rep1.ID)
+	c.expectTrue(!ok)
+	bug1, bugKey1, err := findBugByReportingID(c.ctx, rep1.ID)
+	c.expectOK(err)
+	hash, ok := cachedReportingID(c.ctx, rep1.ID)
+	c.expectTrue(ok)
+	c.expectEQ(hash, bug1.keyHash())
+	bug, bugKey, err := findBugByReportingID(c.ctx, rep1.ID)
+	c.expectOK(err)
+	c.expectEQ(bug.Title, "title1")
+	c.expectTrue(bugKey.Equal(bugKey1))
+
+	// Unknown IDs are remembered as misses.
+	_, _, err = findBugByReportingID(c.ctx, "nonexistent")
+	c.expectTrue(err != nil)
+	hash, ok = cachedReportingID(c.ctx, "nonexistent")
+	c.expectTrue(ok)
+	c.expectEQ(hash, "")
+	_, _, err = findBugByReportingID(c.ctx, "nonexistent")
+	c.expectTrue(err != nil)
+
+	// A cached miss is dropped once a bug with the ID is created.
+	id2 := bugReportingHash(bugKeyHash("test1", "title2", 0), "reporting1")
+	_, _, err = findBugByReportingID(c.ctx, id2)
+	c.expectTrue(err != nil)
+	c.client.ReportCrash(testCrash(build, 2))
+	rep2 := c.client.pollBug()
+	c.expectEQ(rep2.ID, id2)
+	bug2, bugKey2, err := findBugByReportingID(c.ctx, rep2.ID)
+	c.expectOK(err)
+	c.expectEQ(bug2.Title, "title2")
+
+	// A stale entry pointing to another bug is not trusted.
+	cacheReportingID(c.ctx, rep2.ID, bugKey1)
+	bug, bugKey, err = findBugByReportingID(c.ctx, rep2.ID)
+	c.expectOK(err)
+	c.expectEQ(bug.Title, "title2")
+	c.expectTrue(bugKey.Equal(bugKey2))
+	hash, _ = cachedReportingID(c.ctx, rep2.ID)
+	c.expectEQ(hash, bug2.keyHash())
+
+	// The same holds for the pages that resolve external IDs.
+	cacheReportingID(c.ctx, rep2.ID, bugKey1)
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep2.ID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "title2"))
+	c.expectTrue(!strings.Contains(string(page), "title1"))
+}
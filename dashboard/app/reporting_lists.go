@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
 	"github.com/google/syzkaller/pkg/hash"
 	"golang.org/x/net/context"
 	"google.golang.org/appengine/v2"
@@ -258,6 +259,14 @@ func querySubsystemReport(c context.Context, subsystem *Subsystem, reporting *Re
 			// Don't take bugs which are too new -- they're still fresh in memory.
 			continue
 		}
+		if bug.Disputed {
+			// Developers doubt that it's a real bug, it needs a human review instead.
+			continue
+		}
+		if !bug.discussionSummary().LastPatchAccepted.IsZero() {
+			// The fix is already accepted by the maintainers, it just hasn't reached the trees yet.
+			continue
+		}
 		if bug.ReproLevel == dashapi.ReproLevelNone {
 			noRepro = append(noRepro, bug)
 		} else {
@@ -438,7 +447,13 @@ func reportingBugListReport(c context.Context, subsystemReport *SubsystemReport,
 				Link:       fmt.Sprintf("%v/bug?extid=%v", appURL(c), bugReporting.ID),
 				ReproLevel: bug.ReproLevel,
 				Hits:       bug.NumCrashes,
+				Assignee:   bug.AssigneeEmail,
+
+				MinimizedConfig: bug.MinimizedConfig,
 			})
+			if bug.AssigneeEmail != "" {
+				ret.Maintainers = email.MergeEmailLists(ret.Maintainers, []string{bug.AssigneeEmail})
+			}
 		}
 		return ret, nil
 	}
@@ -0,0 +1,422 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	aemail "google.golang.org/appengine/v2/mail"
+	"google.golang.org/appengine/v2/memcache"
+	"google.golang.org/appengine/v2/user"
+)
+
+// When the tested tree is broken (boot failures, lots of unrelated crashes), syzbot reports
+// plenty of junk that is invalidated later. For namespaces with ReportingBreakerConfig,
+// the hourly handleReportingBreaker job pauses the reporting of bugs that were never reported
+// if there are too many new bugs or most of the managers fail to build the kernel, and
+// resumes it once the rates are back to normal. Admins may also pause and resume the reporting
+// manually on the admin page, manual pauses are only lifted manually.
+// Crashes are still recorded during the pause. The bugs created during the pause are not
+// reported individually: after the pause they are listed in a single digest email
+// (see flushPausedReports) and marked with Bug.PauseDigest.
+
+const (
+	// The number of the previous days the new bug rate is compared with.
+	reportingBreakerDays          = 14
+	reportingPauseCacheDuration   = time.Minute
+	reportingPauseDigestMaxTitles = 100
+)
+
+// ReportingPause is the reporting state of a namespace, the key is the namespace name.
+type ReportingPause struct {
+	Namespace string
+	Paused    bool
+	// Manual pauses are set by admins and are not lifted automatically.
+	Manual  bool
+	Reason  string
+	SetBy   string
+	Since   time.Time
+	Resumed time.Time
+	// Flushed is set once the digest of the bugs created during the pause was sent.
+	Flushed time.Time
+}
+
+func reportingPauseKey(c context.Context, ns string) *db.Key {
+	return db.NewKey(c, "ReportingPause", ns, 0, nil)
+}
+
+func reportingPauseCacheKey(ns string) string {
+	return "reporting-pause-" + ns
+}
+
+// loadReportingPause returns the reporting state of the namespace, it's cached as
+// it's checked for every new bug on every reporting poll.
+func loadReportingPause(c context.Context, ns string) (*ReportingPause, error) {
+	pause := new(ReportingPause)
+	if _, err := memcache.Gob.Get(c, reportingPauseCacheKey(ns), pause); err == nil {
+		return pause, nil
+	} else if err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to get the reporting pause from memcache: %v", err)
+	}
+	if err := db.Get(c, reportingPauseKey(c, ns), pause); err != nil && err != db.ErrNoSuchEntity {
+		return nil, fmt.Errorf("failed to get the reporting pause: %w", err)
+	}
+	pause.Namespace = ns
+	item := &memcache.Item{
+		Key:        reportingPauseCacheKey(ns),
+		Object:     pause,
+		Expiration: reportingPauseCacheDuration,
+	}
+	if err := memcache.Gob.Set(c, item); err != nil {
+		log.Errorf(c, "failed to cache the reporting pause: %v", err)
+	}
+	return pause, nil
+}
+
+func updateReportingPause(c context.Context, ns string, fn func(pause *ReportingPause) error) error {
+	tx := func(c context.Context) error {
+		pause := new(ReportingPause)
+		key := reportingPauseKey(c, ns)
+		if err := db.Get(c, key, pause); err != nil && err != db.ErrNoSuchEntity {
+			return fmt.Errorf("failed to get the reporting pause: %w", err)
+		}
+		pause.Namespace = ns
+		if err := fn(pause); err != nil {
+			return err
+		}
+		if _, err := db.Put(c, key, pause); err != nil {
+			return fmt.Errorf("failed to put the reporting pause: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return err
+	}
+	if err := memcache.Delete(c, reportingPauseCacheKey(ns)); err != nil && err != memcache.ErrCacheMiss {
+		log.Errorf(c, "failed to drop the cached reporting pause: %v", err)
+	}
+	return nil
+}
+
+// reportingPauseStatus returns why the bug is not reported because of a reporting pause, if it's not.
+// Only the bugs that were never reported are affected.
+func reportingPauseStatus(c context.Context, bug *Bug) string {
+	if config.Namespaces[bug.Namespace].ReportingBreaker == nil || bugWasReported(bug) {
+		return ""
+	}
+	if !bug.PauseDigest.IsZero() {
+		return "reported in the digest of the reporting pause"
+	}
+	pause, err := loadReportingPause(c, bug.Namespace)
+	if err != nil {
+		log.Errorf(c, "%v", err)
+		return ""
+	}
+	if pause.Paused {
+		return "reporting is paused (" + pause.Reason + ")"
+	}
+	return ""
+}
+
+// reportingBreakerReason returns why the reporting must be paused, or an empty string.
+// newBugs are the numbers of new bugs per day, the last one is for the last 24 hours.
+func reportingBreakerReason(cfg *ReportingBreakerConfig, newBugs []int, managers []*Manager,
+	now time.Time) string {
+	if len(newBugs) != 0 {
+		last := newBugs[len(newBugs)-1]
+		baseline := append([]int{}, newBugs[:len(newBugs)-1]...)
+		sort.Ints(baseline)
+		median := 0
+		if len(baseline) != 0 {
+			median = baseline[len(baseline)/2]
+		}
+		if last >= cfg.MinNewBugs && float64(last) > float64(median)*cfg.NewBugsRatio {
+			return fmt.Sprintf("%v new bugs during the last day, usually there are about %v", last, median)
+		}
+	}
+	failing := 0
+	for _, mgr := range managers {
+		if !mgr.FailedBuildSince.IsZero() && now.Sub(mgr.FailedBuildSince) >= cfg.BuildFailurePeriod {
+			failing++
+		}
+	}
+	if failing != 0 && failing*2 > len(managers) {
+		return fmt.Sprintf("%v out of %v managers have been failing to build the kernel for %v",
+			failing, len(managers), cfg.BuildFailurePeriod)
+	}
+	return ""
+}
+
+// newBugsPerDay returns the numbers of bugs created in the namespace during the last
+// reportingBreakerDays+1 days, the last number is for the last 24 hours.
+func newBugsPerDay(c context.Context, ns string, now time.Time) ([]int, error) {
+	const day = 24 * time.Hour
+	start := now.Add(-(reportingBreakerDays + 1) * day)
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("FirstTime>", start).
+		Project("FirstTime").
+		GetAll(c, &bugs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bugs: %w", err)
+	}
+	counts := make([]int, reportingBreakerDays+1)
+	for _, bug := range bugs {
+		if idx := int(bug.FirstTime.Sub(start) / day); idx >= 0 && idx < len(counts) {
+			counts[idx]++
+		}
+	}
+	return counts, nil
+}
+
+func handleReportingBreaker(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	for ns, cfg := range config.Namespaces {
+		if cfg.ReportingBreaker == nil || cfg.Decommissioned {
+			continue
+		}
+		if err := checkReportingPause(c, ns, cfg.ReportingBreaker); err != nil {
+			log.Errorf(c, "%v: failed to check the reporting pause: %v", ns, err)
+		}
+	}
+}
+
+func checkReportingPause(c context.Context, ns string, cfg *ReportingBreakerConfig) error {
+	now := timeNow(c)
+	newBugs, err := newBugsPerDay(c, ns, now)
+	if err != nil {
+		return err
+	}
+	managers, _, err := loadAllManagers(c, ns)
+	if err != nil {
+		return err
+	}
+	reason := reportingBreakerReason(cfg, newBugs, managers, now)
+	pause, err := loadReportingPause(c, ns)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !pause.Paused && reason != "":
+		return pauseReporting(c, ns, reason, "")
+	case pause.Paused && !pause.Manual && reason == "":
+		if err := resumeReporting(c, ns, ""); err != nil {
+			return err
+		}
+	}
+	return flushPausedReports(c, ns)
+}
+
+func pauseReporting(c context.Context, ns, reason, by string) error {
+	now := timeNow(c)
+	err := updateReportingPause(c, ns, func(pause *ReportingPause) error {
+		if pause.Paused {
+			return fmt.Errorf("%w: the reporting is already paused", ErrClientBadRequest)
+		}
+		if !pause.Resumed.IsZero() && pause.Flushed.IsZero() {
+			// The bugs of the previous pause are reported in the digest of this one.
+			now = pause.Since
+		}
+		*pause = ReportingPause{
+			Namespace: ns,
+			Paused:    true,
+			Manual:    by != "",
+			Reason:    reason,
+			SetBy:     by,
+			Since:     now,
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Warningf(c, "%v: paused the reporting: %v", ns, reason)
+	body := fmt.Sprintf("The reporting of new bugs in namespace %v was paused: %v.\n"+
+		"The crashes are still recorded, the bugs found during the pause will be listed in one digest\n"+
+		"once the reporting is resumed.\n\nTo resume the reporting: %v/admin\n", ns, reason, appURL(c))
+	return notifyReportingBreakerAdmins(c, ns, fmt.Sprintf("[%v] reporting is paused", ns), body)
+}
+
+func resumeReporting(c context.Context, ns, by string) error {
+	err := updateReportingPause(c, ns, func(pause *ReportingPause) error {
+		if !pause.Paused {
+			return fmt.Errorf("%w: the reporting is not paused", ErrClientBadRequest)
+		}
+		pause.Paused = false
+		pause.Resumed = timeNow(c)
+		if by != "" {
+			pause.SetBy = by
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof(c, "%v: resumed the reporting", ns)
+	body := fmt.Sprintf("The reporting of new bugs in namespace %v was resumed.\n", ns)
+	return notifyReportingBreakerAdmins(c, ns, fmt.Sprintf("[%v] reporting is resumed", ns), body)
+}
+
+func notifyReportingBreakerAdmins(c context.Context, ns, subject, body string) error {
+	msg := &aemail.Message{
+		Sender:  fromAddr(c),
+		To:      config.Namespaces[ns].ReportingBreaker.Emails,
+		Subject: subject,
+		Body:    body,
+	}
+	return sendEmail(c, msg)
+}
+
+// flushPausedReports sends the digest of the bugs that were created during the last pause.
+func flushPausedReports(c context.Context, ns string) error {
+	pause, err := loadReportingPause(c, ns)
+	if err != nil {
+		return err
+	}
+	if pause.Paused || pause.Resumed.IsZero() || !pause.Flushed.IsZero() {
+		return nil
+	}
+	var bugs []*Bug
+	keys, err := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Filter("FirstTime>=", pause.Since).
+		GetAll(c, &bugs)
+	if err != nil {
+		return fmt.Errorf("failed to query bugs: %w", err)
+	}
+	var digestBugs []*Bug
+	var digestKeys []*db.Key
+	for i, bug := range bugs {
+		if bug.Status != BugStatusOpen || bug.FirstTime.After(pause.Resumed) ||
+			!bug.PauseDigest.IsZero() || bugWasReported(bug) {
+			continue
+		}
+		digestBugs = append(digestBugs, bug)
+		digestKeys = append(digestKeys, keys[i])
+	}
+	if len(digestBugs) != 0 {
+		if err := sendPauseDigest(c, ns, pause, digestBugs); err != nil {
+			return err
+		}
+		now := timeNow(c)
+		if err := updateBugBatch(c, digestKeys, func(bug *Bug) {
+			bug.PauseDigest = now
+		}); err != nil {
+			return err
+		}
+	}
+	return updateReportingPause(c, ns, func(pause *ReportingPause) error {
+		pause.Flushed = timeNow(c)
+		return nil
+	})
+}
+
+func bugWasReported(bug *Bug) bool {
+	for i := range bug.Reporting {
+		if !bug.Reporting[i].Reported.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// sendPauseDigest sends the digest to the first reporting of the namespace if it's an email one,
+// and to the namespace admins otherwise.
+func sendPauseDigest(c context.Context, ns string, pause *ReportingPause, bugs []*Bug) error {
+	cfg := config.Namespaces[ns]
+	to := cfg.ReportingBreaker.Emails
+	if emailCfg, ok := cfg.Reporting[0].Config.(*EmailConfig); ok {
+		to = []string{emailCfg.Email}
+	}
+	sort.Slice(bugs, func(i, j int) bool {
+		return bugs[i].NumCrashes > bugs[j].NumCrashes
+	})
+	body := new(strings.Builder)
+	fmt.Fprintf(body, "The reporting of new bugs in namespace %v was paused from %v to %v:\n%v.\n\n"+
+		"The following %v bugs were found during the pause. Many of them may be caused\n"+
+		"by the broken tree, so they are not reported individually:\n\n",
+		ns, pause.Since.Format(time.RFC822), pause.Resumed.Format(time.RFC822), pause.Reason, len(bugs))
+	for i, bug := range bugs {
+		if i == reportingPauseDigestMaxTitles {
+			fmt.Fprintf(body, "and %v more: %v/%v\n", len(bugs)-i, appURL(c), ns)
+			break
+		}
+		fmt.Fprintf(body, "%v (%v crashes)\n%v%v\n\n", bug.displayTitle(), bug.NumCrashes,
+			appURL(c), bugLink(bug.keyHash()))
+	}
+	msg := &aemail.Message{
+		Sender:  fromAddr(c),
+		To:      to,
+		Subject: fmt.Sprintf("[%v] %v bugs found while the reporting was paused", ns, len(bugs)),
+		Body:    body.String(),
+	}
+	return sendEmail(c, msg)
+}
+
+func handleReportingPauseAction(c context.Context, r *http.Request, pause bool) error {
+	ns := r.FormValue("ns")
+	if cfg := config.Namespaces[ns]; cfg == nil || cfg.ReportingBreaker == nil {
+		return fmt.Errorf("%w: namespace %q has no reporting breaker", ErrClientBadRequest, ns)
+	}
+	by := "admin"
+	if u := user.Current(c); u != nil {
+		by = u.Email
+	}
+	if !pause {
+		if err := resumeReporting(c, ns, by); err != nil {
+			return err
+		}
+		return flushPausedReports(c, ns)
+	}
+	reason := r.FormValue("reason")
+	if reason == "" {
+		return fmt.Errorf("%w: the pause needs a reason", ErrClientBadRequest)
+	}
+	return pauseReporting(c, ns, reason, by)
+}
+
+type uiReportingPause struct {
+	Namespace string
+	Paused    bool
+	Manual    bool
+	Reason    string
+	SetBy     string
+	Since     time.Time
+	Resumed   time.Time
+}
+
+func loadReportingPausesUI(c context.Context) ([]*uiReportingPause, error) {
+	var ret []*uiReportingPause
+	for ns, cfg := range config.Namespaces {
+		if cfg.ReportingBreaker == nil || cfg.Decommissioned {
+			continue
+		}
+		pause, err := loadReportingPause(c, ns)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &uiReportingPause{
+			Namespace: ns,
+			Paused:    pause.Paused,
+			Manual:    pause.Manual,
+			Reason:    pause.Reason,
+			SetBy:     pause.SetBy,
+			Since:     pause.Since,
+			Resumed:   pause.Resumed,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Namespace < ret[j].Namespace
+	})
+	return ret, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportingBreakerReason(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	cfg := &ReportingBreakerConfig{
+		MinNewBugs:         10,
+		NewBugsRatio:       5,
+		BuildFailurePeriod: 24 * time.Hour,
+	}
+	failing := &Manager{FailedBuildSince: now.Add(-48 * time.Hour)}
+	recent := &Manager{FailedBuildSince: now.Add(-time.Hour)}
+	healthy := &Manager{}
+	tests := []struct {
+		newBugs  []int
+		managers []*Manager
+		reason   string
+	}{
+		{[]int{1, 2, 3, 2, 5}, []*Manager{healthy}, ""},
+		{[]int{0, 0, 0, 9}, nil, ""},
+		{[]int{0, 1, 0, 10}, nil, "10 new bugs during the last day, usually there are about 0"},
+		{[]int{2, 3, 2, 20, 15}, nil, ""},
+		{[]int{2, 3, 2, 1, 16}, nil, "16 new bugs during the last day, usually there are about 2"},
+		{nil, []*Manager{failing, recent, healthy}, ""},
+		{nil, []*Manager{failing, failing, healthy},
+			"2 out of 3 managers have been failing to build the kernel for 24h0m0s"},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got := reportingBreakerReason(cfg, test.newBugs, test.managers, now)
+			if got != test.reason {
+				t.Fatalf("got %q, want %q", got, test.reason)
+			}
+		})
+	}
+}
+
+func TestReportingPause(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	config.Namespaces["test1"].ReportingBreaker = &ReportingBreakerConfig{
+		Emails:             []string{"admins@test.com"},
+		MinNewBugs:         3,
+		NewBugsRatio:       5,
+		BuildFailurePeriod: 24 * time.Hour,
+	}
+	defer func() {
+		config.Namespaces["test1"].ReportingBreaker = nil
+	}()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	for i := 0; i < 3; i++ {
+		c.client.ReportCrash(testCrash(build, i+1))
+	}
+	_, err := c.GET("/cron/reporting_breaker")
+	c.expectOK(err)
+	msg := c.pollEmailBug()
+	c.expectEQ(msg.To, []string{"admins@test.com"})
+	c.expectTrue(strings.Contains(msg.Body, "3 new bugs during the last day"))
+	// The bugs are held, but the crashes are still recorded.
+	c.client.pollBugs(0)
+	c.client.ReportCrash(testCrash(build, 1))
+
+	// The rate gets back to normal, the reporting is resumed and the held bugs go into the digest.
+	c.advanceTime(48 * time.Hour)
+	_, err = c.GET("/cron/reporting_breaker")
+	c.expectOK(err)
+	msg = c.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Subject, "reporting is resumed"))
+	msg = c.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Subject, "3 bugs found while the reporting was paused"))
+	c.expectTrue(strings.Contains(msg.Body, "title1 (2 crashes)"))
+	c.expectNoEmail()
+	c.client.pollBugs(0)
+
+	// The new bugs are reported as usual.
+	c.client.ReportCrash(testCrash(build, 4))
+	c.client.pollBugs(1)
+
+	// Manual pauses are not lifted automatically.
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=pause_reporting&ns=test1&reason=testing")
+	c.expectOK(err)
+	c.pollEmailBug()
+	c.client.ReportCrash(testCrash(build, 5))
+	_, err = c.GET("/cron/reporting_breaker")
+	c.expectOK(err)
+	c.expectNoEmail()
+	c.client.pollBugs(0)
+	_, err = c.AuthGET(AccessAdmin, "/admin?action=resume_reporting&ns=test1")
+	c.expectOK(err)
+	c.pollEmailBug()
+	msg = c.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Subject, "1 bugs found while the reporting was paused"))
+}
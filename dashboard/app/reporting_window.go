@@ -0,0 +1,121 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// Reports sent on Saturday night are buried under other emails by Monday. For namespaces with
+// ReportingWindowConfig, bugs are reported to each reporting for the first time only during
+// the window (e.g. on workdays from 9 to 17). Bugs that become ready to be reported outside
+// of the window are queued: BugReporting.Queued records when it happened. Once the window opens,
+// the queued bugs are reported by the usual reporting polls before the other bugs, in the order
+// they were queued, so the per-poll batches and the daily limits of the reportings still apply.
+// Bugs of the urgent crash types that have reproducers are not delayed.
+
+// reportingWindowOpens returns when the reporting window of the bug namespace opens next,
+// or zero time if the bug may be reported now.
+func reportingWindowOpens(c context.Context, bug *Bug) time.Time {
+	cfg := config.Namespaces[bug.Namespace].ReportingWindow
+	if cfg == nil || cfg.urgent(bug) {
+		return time.Time{}
+	}
+	return cfg.nextOpen(timeNow(c))
+}
+
+func (cfg *ReportingWindowConfig) urgent(bug *Bug) bool {
+	if bug.ReproLevel == ReproLevelNone {
+		return false
+	}
+	for _, prefix := range cfg.UrgentCrashTypes {
+		if strings.HasPrefix(bug.Title, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpen returns the start of the next window, or zero time if the window is open at now.
+func (cfg *ReportingWindowConfig) nextOpen(now time.Time) time.Time {
+	loc := cfg.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	for day := 0; day < 8; day++ {
+		date := local.AddDate(0, 0, day)
+		if !cfg.openOn(date.Weekday()) {
+			continue
+		}
+		start := time.Date(date.Year(), date.Month(), date.Day(), cfg.StartHour, 0, 0, 0, loc)
+		end := time.Date(date.Year(), date.Month(), date.Day(), cfg.EndHour, 0, 0, 0, loc)
+		if day == 0 && !local.Before(start) && local.Before(end) {
+			return time.Time{}
+		}
+		if start.After(local) {
+			return start
+		}
+	}
+	// Only possible if the window is open on no days.
+	return time.Time{}
+}
+
+func (cfg *ReportingWindowConfig) openOn(day time.Weekday) bool {
+	for _, open := range cfg.Days {
+		if open == day {
+			return true
+		}
+	}
+	return false
+}
+
+// bugQueuedTime returns when the bug was queued for its current reporting, if it was.
+func bugQueuedTime(bug *Bug) time.Time {
+	for i := range bug.Reporting {
+		bugReporting := &bug.Reporting[i]
+		if bugReporting.Closed.IsZero() && bugReporting.Reported.IsZero() && !bugReporting.Queued.IsZero() {
+			return bugReporting.Queued
+		}
+	}
+	return time.Time{}
+}
+
+// sortQueuedReports moves the queued bugs to the front in the order they were queued,
+// the order of the other bugs is preserved.
+func sortQueuedReports(bugs []*Bug) {
+	sort.SliceStable(bugs, func(i, j int) bool {
+		qi, qj := bugQueuedTime(bugs[i]), bugQueuedTime(bugs[j])
+		if qi.IsZero() || qj.IsZero() {
+			return !qi.IsZero() && qj.IsZero()
+		}
+		return qi.Before(qj)
+	})
+}
+
+// queueWindowReports marks the current reportings of the bugs held by the reporting window as queued.
+func queueWindowReports(c context.Context, bugs []*Bug) error {
+	if len(bugs) == 0 {
+		return nil
+	}
+	now := timeNow(c)
+	var keys []*db.Key
+	for _, bug := range bugs {
+		keys = append(keys, bug.key(c))
+	}
+	return updateBugBatch(c, keys, func(bug *Bug) {
+		_, bugReporting, _, _, err := currentReporting(c, bug)
+		if err != nil || bugReporting == nil {
+			return
+		}
+		if bugReporting.Reported.IsZero() && bugReporting.Queued.IsZero() {
+			bugReporting.Queued = now
+		}
+	})
+}
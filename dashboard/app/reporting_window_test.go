@@ -0,0 +1,120 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestReportingWindowNextOpen(t *testing.T) {
+	cfg := &ReportingWindowConfig{}
+	checkReportingWindow("test", cfg)
+	// 2023-06-02 is a Friday.
+	date := func(day, hour, minute int) time.Time {
+		return time.Date(2023, time.June, day, hour, minute, 0, 0, time.UTC)
+	}
+	monday := date(5, 9, 0)
+	tests := []struct {
+		now  time.Time
+		open time.Time
+	}{
+		{date(2, 8, 59), date(2, 9, 0)},
+		{date(2, 9, 0), time.Time{}},
+		{date(2, 16, 59), time.Time{}},
+		{date(2, 17, 0), monday},
+		{date(3, 12, 0), monday},
+		{date(4, 23, 59), monday},
+		{date(5, 0, 0), monday},
+		{date(5, 9, 0), time.Time{}},
+		{date(1, 20, 0), date(2, 9, 0)},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if got := cfg.nextOpen(test.now); !got.Equal(test.open) {
+				t.Fatalf("%v: got %v, want %v", test.now, got, test.open)
+			}
+		})
+	}
+}
+
+func TestReportingWindowTimeZone(t *testing.T) {
+	cfg := &ReportingWindowConfig{
+		TimeZone:  "America/New_York",
+		Days:      []time.Weekday{time.Saturday},
+		StartHour: 22,
+		EndHour:   24,
+	}
+	checkReportingWindow("test", cfg)
+	// 2023-06-03 22:00 EDT is 2023-06-04 02:00 UTC.
+	now := time.Date(2023, time.June, 4, 1, 0, 0, 0, time.UTC)
+	want := time.Date(2023, time.June, 4, 2, 0, 0, 0, time.UTC)
+	if got := cfg.nextOpen(now); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got := cfg.nextOpen(now.Add(2 * time.Hour)); !got.IsZero() {
+		t.Fatalf("the window must be open, got %v", got)
+	}
+}
+
+func TestReportingWindow(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	cfg := &ReportingWindowConfig{
+		UrgentCrashTypes: []string{"KASAN: use-after-free"},
+	}
+	checkReportingWindow("test1", cfg)
+	config.Namespaces["test1"].ReportingWindow = cfg
+	defer func() {
+		config.Namespaces["test1"].ReportingWindow = nil
+	}()
+
+	// The mocked time starts on Saturday, 2000-01-01, the window opens on Monday at 9:00.
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	for i := 1; i <= 4; i++ {
+		c.client.ReportCrash(testCrash(build, i))
+		c.advanceTime(time.Minute)
+	}
+	urgent := testCrashWithRepro(build, 5)
+	urgent.Title = "KASAN: use-after-free Read in foo"
+	c.client.ReportCrash(urgent)
+	// Urgent bugs need a reproducer.
+	noRepro := testCrash(build, 6)
+	noRepro.Title = "KASAN: use-after-free Write in bar"
+	c.client.ReportCrash(noRepro)
+
+	reports := c.client.pollBugs(1)
+	c.expectEQ(reports[0].Title, urgent.Title)
+	c.client.pollBugs(0)
+	var bugs []*Bug
+	_, err := db.NewQuery("Bug").Filter("Title=", "title1").GetAll(c.ctx, &bugs)
+	c.expectOK(err)
+	c.expectEQ(bugs[0].Reporting[0].Queued, c.mockedTime)
+
+	// A bug with a repro that is ready when the window opens goes after the queued ones.
+	c.advanceTime(2*24*time.Hour + 9*time.Hour - 4*time.Minute)
+	c.client.ReportCrash(testCrashWithRepro(build, 7))
+	reports = c.client.pollBugs(3)
+	titles := []string{reports[0].Title, reports[1].Title, reports[2].Title}
+	c.expectEQ(titles, []string{"title1", "title2", "title3"})
+	// The daily limit still applies.
+	c.client.pollBugs(0)
+
+	c.advanceTime(24 * time.Hour)
+	reports = c.client.pollBugs(3)
+	titles = []string{reports[0].Title, reports[1].Title, reports[2].Title}
+	c.expectEQ(titles, []string{"title4", noRepro.Title, "title7"})
+
+	// Repros of already reported bugs are not delayed.
+	c.advanceTime(9 * time.Hour)
+	c.client.ReportCrash(testCrashWithRepro(build, 1))
+	reports = c.client.pollBugs(1)
+	c.expectEQ(reports[0].Title, "title1")
+	c.expectTrue(len(reports[0].ReproC) != 0)
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Managers send a summary of the code reached by the reproducer along with the repro crash.
+// Only the head of the summary is stored in the crash and shown on the bug page,
+// the full summary is available as a ReproCoverage crash asset.
+const (
+	maxReproCoverageFiles = 20
+	maxReproCoverageFuncs = 10
+	maxReproCoverageSize  = 8 << 10
+)
+
+type uiReproCoverage struct {
+	Manager   string
+	CoverLink string // the coverage report of the manager
+	FullLink  string // the full coverage summary of the reproducer
+	Files     []*uiCoveredFile
+}
+
+type uiCoveredFile struct {
+	*reproCoveredFile
+	Link string
+}
+
+// reproCoveredFile is the stored form of dashapi.CoveredFile.
+type reproCoveredFile struct {
+	File      string
+	Functions []string
+	MoreFuncs bool `json:",omitempty"`
+}
+
+// encodeReproCoverage returns the capped JSON-encoded summary for the Crash entity.
+func encodeReproCoverage(c context.Context, files []dashapi.CoveredFile) []byte {
+	if len(files) > maxReproCoverageFiles {
+		files = files[:maxReproCoverageFiles]
+	}
+	var capped []*reproCoveredFile
+	for _, file := range files {
+		stored := &reproCoveredFile{
+			File:      file.File,
+			Functions: file.Functions,
+		}
+		if len(stored.Functions) > maxReproCoverageFuncs {
+			stored.Functions = stored.Functions[:maxReproCoverageFuncs]
+			stored.MoreFuncs = true
+		}
+		capped = append(capped, stored)
+	}
+	for len(capped) != 0 {
+		data, err := json.Marshal(capped)
+		if err != nil {
+			log.Errorf(c, "failed to marshal repro coverage: %v", err)
+			return nil
+		}
+		if len(data) <= maxReproCoverageSize {
+			return data
+		}
+		capped = capped[:len(capped)-1]
+	}
+	return nil
+}
+
+func loadReproCoverage(c context.Context, bug *Bug) (*uiReproCoverage, error) {
+	if bug.ReproLevel == ReproLevelNone {
+		return nil, nil
+	}
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return nil, err
+	}
+	if len(crash.ReproCoverage) == 0 {
+		return nil, nil
+	}
+	var files []*reproCoveredFile
+	if err := json.Unmarshal(crash.ReproCoverage, &files); err != nil {
+		log.Errorf(c, "bug %v: failed to unmarshal repro coverage: %v", bug.keyHash(), err)
+		return nil, nil
+	}
+	ret := &uiReproCoverage{
+		Manager: crash.Manager,
+	}
+	for _, asset := range crash.Assets {
+		if asset.Type == dashapi.ReproCoverage {
+			ret.FullLink = asset.DownloadURL
+		}
+	}
+	const coverPeriod = time.Hour * 24 * 7
+	coverAssets, err := queryLatestManagerAssets(c, bug.Namespace, dashapi.HTMLCoverageReport, coverPeriod)
+	if err != nil {
+		return nil, err
+	}
+	if asset, ok := coverAssets[crash.Manager]; ok {
+		ret.CoverLink = asset.DownloadURL
+	} else if config.CoverPath != "" {
+		ret.CoverLink = config.CoverPath + crash.Manager + ".html"
+	}
+	for _, file := range files {
+		ui := &uiCoveredFile{
+			reproCoveredFile: file,
+		}
+		if ret.CoverLink != "" {
+			// The HTML coverage report opens the file given in the fragment.
+			ui.Link = ret.CoverLink + "#" + file.File
+		}
+		ret.Files = append(ret.Files, ui)
+	}
+	return ret, nil
+}
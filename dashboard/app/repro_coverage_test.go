@@ -0,0 +1,95 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestEncodeReproCoverage(t *testing.T) {
+	var files []dashapi.CoveredFile
+	for i := 0; i < maxReproCoverageFiles+5; i++ {
+		file := dashapi.CoveredFile{File: fmt.Sprintf("fs/file%v.c", i)}
+		for j := 0; j < maxReproCoverageFuncs+i; j++ {
+			file.Functions = append(file.Functions, fmt.Sprintf("function_with_a_long_name_%v_%v", i, j))
+		}
+		files = append(files, file)
+	}
+	data := encodeReproCoverage(nil, files)
+	if len(data) > maxReproCoverageSize {
+		t.Fatalf("encoded coverage is too big: %v", len(data))
+	}
+	var stored []*reproCoveredFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) == 0 || len(stored) > maxReproCoverageFiles {
+		t.Fatalf("got %v files", len(stored))
+	}
+	for i, file := range stored {
+		if file.File != files[i].File {
+			t.Errorf("#%v: got file %v, want %v", i, file.File, files[i].File)
+		}
+		if len(file.Functions) != maxReproCoverageFuncs || file.MoreFuncs != (i > 0) {
+			t.Errorf("#%v: got %v functions, more %v", i, len(file.Functions), file.MoreFuncs)
+		}
+	}
+	if data := encodeReproCoverage(nil, nil); data != nil {
+		t.Errorf("got %q for no coverage", data)
+	}
+}
+
+func TestReproCoverage(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client2.UploadBuild(build)
+	c.expectOK(c.client2.AddBuildAssets(&dashapi.AddBuildAssetsReq{
+		BuildID: build.ID,
+		Assets: []dashapi.NewAsset{
+			{
+				Type:        dashapi.HTMLCoverageReport,
+				DownloadURL: "http://google.com/coverage.html",
+			},
+		},
+	}))
+	crash := testCrashWithRepro(build, 1)
+	crash.Assets = []dashapi.NewAsset{
+		{
+			Type:        dashapi.ReproCoverage,
+			DownloadURL: "http://google.com/repro_coverage.txt",
+		},
+	}
+	crash.ReproCoverage = []dashapi.CoveredFile{
+		{File: "fs/ext4/inode.c", Functions: []string{"ext4_iget", "ext4_write_begin"}},
+		{File: "mm/filemap.c", Functions: []string{"filemap_fault"}},
+	}
+	c.client2.ReportCrash(crash)
+	extBugID := c.pollEmailExtID()
+	bug, _, _ := c.loadBug(extBugID)
+
+	cover, err := loadReproCoverage(c.ctx, bug)
+	c.expectOK(err)
+	c.expectEQ(cover.Manager, build.Manager)
+	c.expectEQ(cover.CoverLink, "http://google.com/coverage.html")
+	c.expectEQ(cover.FullLink, "http://google.com/repro_coverage.txt")
+	c.expectEQ(len(cover.Files), 2)
+	c.expectEQ(cover.Files[0].Link, "http://google.com/coverage.html#fs/ext4/inode.c")
+	c.expectEQ(cover.Files[1].Functions, []string{"filemap_fault"})
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Reproducer coverage (2 files)")))
+	c.expectTrue(bytes.Contains(page, []byte("ext4_iget, ext4_write_begin")))
+
+	// The coverage summary is not a reportable asset.
+	_, dbCrash, dbBuild := c.loadBug(extBugID)
+	c.expectEQ(len(createAssetList(dbBuild, dbCrash)), 0)
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Syscall descriptions change over time and old syz reproducers may stop parsing.
+// Before running a job, syz-ci checks the reproducer and, if it no longer parses,
+// migrates it to the current descriptions (see migrateRepro in syz-ci). The migrated
+// reproducer is stored next to the original one and is used by the subsequent jobs.
+// If the reproducer can't be migrated, the bug page says that it needs regeneration
+// and the managers are asked to find a new reproducer (see needReproForBug).
+
+// loadJobReproSyz is like loadReproSyz, but prefers the migrated reproducer.
+func loadJobReproSyz(c context.Context, crash *Crash) ([]byte, error) {
+	if crash.ReproSyzMigrated == 0 {
+		return loadReproSyz(c, crash)
+	}
+	migrated := *crash
+	migrated.ReproSyz = crash.ReproSyzMigrated
+	return loadReproSyz(c, &migrated)
+}
+
+// recordReproMigration saves the results of the reproducer check done by a job.
+func recordReproMigration(c context.Context, job *Job, jobKey *db.Key, req *dashapi.JobDoneReq) error {
+	bugKey := jobKey.Parent()
+	if len(req.ReproSyzMigrated) != 0 && job.CrashID != 0 {
+		migrated, err := putText(c, job.Namespace, textReproSyz, req.ReproSyzMigrated, false)
+		if err != nil {
+			return err
+		}
+		crashKey := db.NewKey(c, "Crash", "", job.CrashID, bugKey)
+		tx := func(c context.Context) error {
+			crash := new(Crash)
+			if err := db.Get(c, crashKey, crash); err != nil {
+				return fmt.Errorf("failed to get crash: %w", err)
+			}
+			crash.ReproSyzMigrated = migrated
+			if _, err := db.Put(c, crashKey, crash); err != nil {
+				return fmt.Errorf("failed to put crash: %w", err)
+			}
+			return nil
+		}
+		if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+			return err
+		}
+		log.Infof(c, "job %v: migrated the syz reproducer of crash %v", req.ID, job.CrashID)
+	}
+	if req.ReproParseError != "" {
+		now := timeNow(c)
+		tx := func(c context.Context) error {
+			bug := new(Bug)
+			if err := db.Get(c, bugKey, bug); err != nil {
+				return fmt.Errorf("failed to get bug: %w", err)
+			}
+			bug.ReproParseError = req.ReproParseError
+			bug.ReproParseFailed = now
+			if _, err := db.Put(c, bugKey, bug); err != nil {
+				return fmt.Errorf("failed to put bug: %w", err)
+			}
+			return nil
+		}
+		if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+			return err
+		}
+		log.Warningf(c, "job %v: the syz reproducer of bug %v does not parse: %v",
+			req.ID, bugKey.StringID(), req.ReproParseError)
+	}
+	return nil
+}
+
+// needsReproRegeneration says whether the bug reproducer could not be parsed
+// and no new reproducer was attempted since then.
+func (bug *Bug) needsReproRegeneration() bool {
+	return !bug.ReproParseFailed.IsZero() && !bug.LastReproTime.After(bug.ReproParseFailed)
+}
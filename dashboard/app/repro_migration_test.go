@@ -0,0 +1,73 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestReproMigration(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	crash.ReproOpts = []byte("repro opts")
+	crash.ReproSyz = []byte("old syz")
+	client.ReportCrash(crash)
+
+	// The bisection job found out that the reproducer needs migration.
+	resp := client.pollJobs(build.Manager)
+	c.expectEQ(resp.Type, dashapi.JobBisectCause)
+	c.expectTrue(bytes.Contains(resp.ReproSyz, []byte("old syz")))
+	client.expectOK(client.JobDone(&dashapi.JobDoneReq{
+		ID:               resp.ID,
+		Error:            []byte("bisection failed"),
+		ReproSyzMigrated: []byte("migrated syz"),
+	}))
+	_, _, dbCrash := c.loadJob(resp.ID)
+	c.expectNE(dbCrash.ReproSyzMigrated, int64(0))
+
+	// The next jobs get the migrated reproducer.
+	sender := c.pollEmailBug().Sender
+	_, extBugID, err := email.RemoveAddrContext(sender)
+	c.expectOK(err)
+	c.incomingEmail(sender, "#syz test: git://git.git/git.git kernel-branch\n"+sampleGitPatch,
+		EmailOptFrom("test@requester.com"))
+	resp = client.pollJobs(build.Manager)
+	c.expectEQ(resp.Type, dashapi.JobTestPatch)
+	c.expectTrue(bytes.Contains(resp.ReproSyz, []byte("migrated syz")))
+	c.expectTrue(!bytes.Contains(resp.ReproSyz, []byte("old syz")))
+
+	// The reproducer could not be parsed at all.
+	client.expectOK(client.JobDone(&dashapi.JobDoneReq{
+		ID:              resp.ID,
+		Error:           []byte("failed to parse program"),
+		ReproParseError: "unknown syscall foo",
+	}))
+	c.pollEmailBug()
+	bug, _, _ := c.loadBug(extBugID)
+	c.expectEQ(bug.ReproParseError, "unknown syscall foo")
+	c.expectTrue(needReproForBug(c.ctx, bug))
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("reproducer needs regeneration")))
+
+	// A new reproducer resets the state.
+	crash.ReproSyz = []byte("new syz")
+	client.ReportCrash(crash)
+	bug, _, _ = c.loadBug(extBugID)
+	c.expectEQ(bug.ReproParseError, "")
+	c.expectTrue(!bug.needsReproRegeneration())
+	page, err = c.AuthGET(AccessAdmin, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("reproducer needs regeneration")))
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Repro retest jobs run the reproducer on several VMs and report how many of the runs
+// crashed (dashapi.JobDoneReq.ReproAttempts/ReproSuccesses). The counts are accumulated
+// in the Crash entity, the older measurements decay with reproReliabilityHalfLife,
+// so that the score follows the recent kernel behavior. The score is shown next to
+// the repro links on the bug page and the bisections prefer the more reliable repros.
+
+const (
+	reproReliabilityHalfLife = 60 * 24 * time.Hour
+	// The score of the repros that were never measured, it's somewhere in the middle,
+	// so that the repros known to be reliable are preferred, and the flaky ones are not.
+	reproReliabilityUnknown = 0.5
+)
+
+func (crash *Crash) addReproRuns(attempts, successes int, now time.Time) {
+	if attempts <= 0 {
+		return
+	}
+	if !crash.ReproMeasured.IsZero() {
+		decay := math.Pow(0.5, float64(now.Sub(crash.ReproMeasured))/float64(reproReliabilityHalfLife))
+		crash.ReproAttempts *= decay
+		crash.ReproSuccesses *= decay
+	}
+	if successes > attempts {
+		successes = attempts
+	}
+	crash.ReproAttempts += float64(attempts)
+	crash.ReproSuccesses += float64(successes)
+	crash.ReproMeasured = now
+}
+
+// reproReliability returns the share of the runs that reproduced the crash,
+// the second value is false if the repro was never measured.
+func (crash *Crash) reproReliability() (float64, bool) {
+	if crash.ReproAttempts <= 0 {
+		return 0, false
+	}
+	return crash.ReproSuccesses / crash.ReproAttempts, true
+}
+
+func (crash *Crash) reproReliabilityScore() float64 {
+	if score, ok := crash.reproReliability(); ok {
+		return score
+	}
+	return reproReliabilityUnknown
+}
+
+// reproReliabilityOrder returns the indices of the crashes with the more reliable repros first,
+// otherwise the order is preserved.
+func reproReliabilityOrder(crashes []*Crash) []int {
+	order := make([]int, len(crashes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return crashes[order[i]].reproReliabilityScore() > crashes[order[j]].reproReliabilityScore()
+	})
+	return order
+}
+
+type uiReproReliability struct {
+	Percent  int
+	Verified time.Time
+}
+
+func makeReproReliabilityUI(crash *Crash) *uiReproReliability {
+	score, ok := crash.reproReliability()
+	if !ok {
+		return nil
+	}
+	return &uiReproReliability{
+		Percent:  int(math.Round(score * 100)),
+		Verified: crash.ReproMeasured,
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestAddReproRuns(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	crash := new(Crash)
+	if _, ok := crash.reproReliability(); ok {
+		t.Fatalf("unmeasured repro has reliability")
+	}
+	crash.addReproRuns(0, 0, now)
+	if _, ok := crash.reproReliability(); ok {
+		t.Fatalf("no runs, but the repro has reliability")
+	}
+	crash.addReproRuns(4, 4, now)
+	if score, _ := crash.reproReliability(); score != 1 {
+		t.Fatalf("got %v, want 1", score)
+	}
+	// The old runs weigh half as much after the half-life period.
+	crash.addReproRuns(4, 0, now.Add(reproReliabilityHalfLife))
+	if score, _ := crash.reproReliability(); score != 2.0/6 {
+		t.Fatalf("got %v, want %v", score, 2.0/6)
+	}
+	if !crash.ReproMeasured.Equal(now.Add(reproReliabilityHalfLife)) {
+		t.Fatalf("bad measurement time %v", crash.ReproMeasured)
+	}
+	// The old runs are eventually forgotten.
+	crash.addReproRuns(5, 5, now.Add(20*reproReliabilityHalfLife))
+	if score, _ := crash.reproReliability(); score < 0.999 {
+		t.Fatalf("got %v, want ~1", score)
+	}
+}
+
+func TestReproReliabilityOrder(t *testing.T) {
+	crash := func(attempts, successes float64) *Crash {
+		return &Crash{ReproAttempts: attempts, ReproSuccesses: successes}
+	}
+	crashes := []*Crash{crash(10, 1), crash(0, 0), crash(10, 9), crash(0, 0), crash(10, 5)}
+	// Unmeasured repros go between the reliable and the flaky ones.
+	if diff := cmp.Diff([]int{2, 1, 3, 4, 0}, reproReliabilityOrder(crashes)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestReproReliabilityUI(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	build.KernelRepo = "git://mygit.com/git.git"
+	build.KernelBranch = "main"
+	c.client2.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.ReproOpts = []byte("repro opts")
+	crash.ReproSyz = []byte("repro syz")
+	c.client2.ReportCrash(crash)
+	_, extBugID, err := email.RemoveAddrContext(c.pollEmailBug().Sender)
+	c.expectOK(err)
+
+	c.advanceTime(config.Obsoleting.ReproRetestPeriod + time.Hour)
+	c.updRetestReproJobs()
+	resp := c.client2.pollSpecificJobs(build.Manager, dashapi.ManagerJobs{TestPatches: true})
+	c.expectEQ(resp.Type, dashapi.JobTestPatch)
+	c.client2.expectOK(c.client2.JobDone(&dashapi.JobDoneReq{
+		ID:             resp.ID,
+		CrashTitle:     crash.Title,
+		CrashLog:       []byte("test crash log"),
+		CrashReport:    []byte("test crash report"),
+		ReproAttempts:  5,
+		ReproSuccesses: 4,
+	}))
+
+	_, dbCrash, _ := c.loadBug(extBugID)
+	c.expectEQ(dbCrash.ReproAttempts, 5.0)
+	c.expectEQ(dbCrash.ReproSuccesses, 4.0)
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "reproduces ~80% of runs"))
+}
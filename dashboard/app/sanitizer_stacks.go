@@ -0,0 +1,98 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/google/syzkaller/pkg/report"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// KCSAN and KMSAN reports have more than one interesting stack: a data race is described
+// by the two racing accesses, and an uninit value use by the use and the origin of the value.
+// The stacks are extracted when a crash is saved (CrashReportElements) and are displayed
+// separately on the bug page. The KMSAN origin is also a part of Bug.TopFrames (see topFrames).
+// pkg/report orders the functions of the data race titles, so the symmetric races
+// ("A / B" and "B / A") are now the same bug. The bugs created before that may still be
+// duplicated, such open pairs are suggested as dups on the admin page.
+
+func extractSanitizerStacks(elements *CrashReportElements, rep []byte) {
+	for _, access := range report.DataRaceAccesses(rep) {
+		elements.RaceAccesses = append(elements.RaceAccesses, string(access))
+	}
+	elements.KMSANOrigin = string(report.KMSANOrigin(rep))
+}
+
+type uiSanitizerStacks struct {
+	RaceAccesses []string
+	KMSANOrigin  string
+}
+
+func makeSanitizerStacksUI(crash *uiCrash) *uiSanitizerStacks {
+	if crash == nil || len(crash.raceAccesses) == 0 && crash.kmsanOrigin == "" {
+		return nil
+	}
+	return &uiSanitizerStacks{
+		RaceAccesses: crash.raceAccesses,
+		KMSANOrigin:  crash.kmsanOrigin,
+	}
+}
+
+type uiDataRaceDup struct {
+	Namespace string
+	Title     string
+	Link      string
+	DupTitle  string
+	DupLink   string
+}
+
+// loadDataRaceDupsUI returns the open data race bugs that only differ in the order of the functions.
+func loadDataRaceDupsUI(c context.Context) ([]*uiDataRaceDup, error) {
+	var ret []*uiDataRaceDup
+	for ns, cfg := range config.Namespaces {
+		if cfg.Decommissioned {
+			continue
+		}
+		bugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+			return query.Filter("Namespace=", ns).
+				Filter("Status=", BugStatusOpen)
+		})
+		if err != nil {
+			return nil, err
+		}
+		races := make(map[string][]*Bug)
+		for _, bug := range bugs {
+			canonical, mirrored := report.CanonicalDataRaceTitle(bug.Title)
+			if mirrored != "" {
+				races[canonical] = append(races[canonical], bug)
+			}
+		}
+		for _, group := range races {
+			sort.Slice(group, func(i, j int) bool {
+				return group[i].FirstTime.Before(group[j].FirstTime)
+			})
+			for _, bug := range group[1:] {
+				if bug.Title == group[0].Title {
+					continue
+				}
+				ret = append(ret, &uiDataRaceDup{
+					Namespace: ns,
+					Title:     bug.displayTitle(),
+					Link:      bugLink(bug.keyHash()),
+					DupTitle:  group[0].displayTitle(),
+					DupLink:   bugLink(group[0].keyHash()),
+				})
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
+		}
+		return ret[i].Title < ret[j].Title
+	})
+	return ret, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testDataRaceReport = `BUG: KCSAN: data-race in bar / foo
+
+read to 0xffffffff85a7f140 of 8 bytes by task 1082 on cpu 7:
+ foo+0x57/0xe0
+ foo_caller+0x28e/0x510
+
+write to 0xffffffff85a7f140 of 8 bytes by interrupt on cpu 4:
+ bar+0x4f/0xa0
+ bar_caller+0x6c/0x90
+
+Reported by Kernel Concurrency Sanitizer on:
+`
+
+func TestSanitizerStacks(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.Title = "KCSAN: data-race in bar / foo"
+	crash.Report = []byte(testDataRaceReport)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+
+	_, dbCrash, _ := c.loadBug(rep.ID)
+	c.expectEQ(dbCrash.ReportElements.RaceAccesses, []string{
+		"read to 0xffffffff85a7f140 of 8 bytes by task 1082 on cpu 7:\n foo+0x57/0xe0\n foo_caller+0x28e/0x510\n",
+		"write to 0xffffffff85a7f140 of 8 bytes by interrupt on cpu 4:\n bar+0x4f/0xa0\n bar_caller+0x6c/0x90\n",
+	})
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Racing accesses:")))
+
+	// The same race reported with the other function order before the titles were canonicalized.
+	crash2 := testCrash(build, 2)
+	crash2.Title = "KCSAN: data-race in foo / bar"
+	crash2.Report = []byte(testDataRaceReport)
+	c.client.ReportCrash(crash2)
+	c.client.pollBug()
+	page, err = c.AuthGET(AccessAdmin, "/admin")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Suggested data race dups")))
+	c.expectTrue(bytes.Contains(page, []byte(crash2.Title)))
+}
@@ -0,0 +1,226 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Logged in users may save the bug list filters they use often under a name and switch
+// between them on the namespace page. A view is just the stored query parameters of
+// the main page, applying a view redirects to the main page with these parameters.
+// All views of a user are stored in a single UserViews entity keyed by the user email.
+
+const maxSavedViewsPerUser = 20
+
+// bugFilterParams are the query parameters understood by MakeBugFilter.
+// Only these are stored in the views. Unknown parameters of old views (e.g. after a filter
+// was renamed) are dropped when the view is applied.
+var bugFilterParams = []string{
+	"subsystem",
+	"no_subsystem",
+	"manager",
+	"only_manager",
+	"assignee",
+	"repro_revoked",
+	"no_tainted",
+}
+
+type UserViews struct {
+	Views []SavedView `datastore:",noindex"`
+}
+
+type SavedView struct {
+	Namespace string
+	Name      string
+	Query     string
+}
+
+type uiSavedViews struct {
+	Namespace string
+	Views     []*uiSavedView
+	// Params is the filter of the current page, it's what is saved as a new view.
+	Params []uiViewParam
+	Full   bool
+}
+
+type uiViewParam struct {
+	Name  string
+	Value string
+}
+
+type uiSavedView struct {
+	Name    string
+	Current bool
+}
+
+func userViewsKey(c context.Context, email string) *db.Key {
+	return db.NewKey(c, "UserViews", email, 0, nil)
+}
+
+func loadUserViews(c context.Context, email string) (*UserViews, error) {
+	views := new(UserViews)
+	if err := db.Get(c, userViewsKey(c, email), views); err != nil && err != db.ErrNoSuchEntity {
+		return nil, fmt.Errorf("failed to get user views: %w", err)
+	}
+	return views, nil
+}
+
+// sanitizeViewQuery keeps only the known filter parameters in the canonical order.
+func sanitizeViewQuery(values url.Values) string {
+	ret := url.Values{}
+	for _, param := range bugFilterParams {
+		if val := values.Get(param); val != "" {
+			ret.Set(param, val)
+		}
+	}
+	return ret.Encode()
+}
+
+// makeUISavedViews returns nil for anonymous users.
+func makeUISavedViews(c context.Context, r *http.Request, ns string) (*uiSavedViews, error) {
+	u := user.Current(c)
+	if u == nil {
+		return nil, nil
+	}
+	views, err := loadUserViews(c, u.Email)
+	if err != nil {
+		return nil, err
+	}
+	query := sanitizeViewQuery(r.URL.Query())
+	ret := &uiSavedViews{
+		Namespace: ns,
+	}
+	for _, param := range bugFilterParams {
+		if val := r.URL.Query().Get(param); val != "" {
+			ret.Params = append(ret.Params, uiViewParam{param, val})
+		}
+	}
+	for _, view := range views.Views {
+		if view.Namespace != ns {
+			continue
+		}
+		ret.Views = append(ret.Views, &uiSavedView{
+			Name:    view.Name,
+			Current: query != "" && sanitizeViewQuery(parseViewQuery(view.Query)) == query,
+		})
+	}
+	ret.Full = len(views.Views) >= maxSavedViewsPerUser
+	sort.Slice(ret.Views, func(i, j int) bool {
+		return ret.Views[i].Name < ret.Views[j].Name
+	})
+	return ret, nil
+}
+
+func parseViewQuery(query string) url.Values {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		// A broken view is just an empty filter.
+		return url.Values{}
+	}
+	return values
+}
+
+func viewLink(ns, query string) string {
+	if query == "" {
+		return "/" + ns
+	}
+	return "/" + ns + "?" + query
+}
+
+// handleSavedViews saves, deletes and applies the views of the current user.
+func handleSavedViews(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	hdr, err := commonHeader(c, r, w, "")
+	if err != nil {
+		return err
+	}
+	ns := hdr.Namespace
+	u := user.Current(c)
+	if u == nil {
+		return ErrAccess
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	switch action := r.FormValue("action"); action {
+	case "apply":
+		views, err := loadUserViews(c, u.Email)
+		if err != nil {
+			return err
+		}
+		for _, view := range views.Views {
+			if view.Namespace == ns && view.Name == name {
+				return ErrRedirect{fmt.Errorf("%v", viewLink(ns, sanitizeViewQuery(parseViewQuery(view.Query))))}
+			}
+		}
+		return fmt.Errorf("no view %q: %w", name, ErrClientNotFound)
+	case "save", "delete":
+		query := sanitizeViewQuery(r.URL.Query())
+		if action == "save" && (name == "" || query == "") {
+			return fmt.Errorf("the view needs a name and a filter: %w", ErrClientBadRequest)
+		}
+		err := updateUserViews(c, u.Email, func(views *UserViews) error {
+			return views.update(ns, name, query, action == "delete")
+		})
+		if err != nil {
+			return err
+		}
+		if action == "delete" {
+			query = ""
+		}
+		return ErrRedirect{fmt.Errorf("%v", viewLink(ns, query))}
+	default:
+		return fmt.Errorf("unknown action %q: %w", action, ErrClientBadRequest)
+	}
+}
+
+func updateUserViews(c context.Context, email string, fn func(*UserViews) error) error {
+	tx := func(c context.Context) error {
+		views, err := loadUserViews(c, email)
+		if err != nil {
+			return err
+		}
+		if err := fn(views); err != nil {
+			return err
+		}
+		if _, err := db.Put(c, userViewsKey(c, email), views); err != nil {
+			return fmt.Errorf("failed to put user views: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+// update adds, replaces or deletes the view with the name.
+func (views *UserViews) update(ns, name, query string, remove bool) error {
+	for i, view := range views.Views {
+		if view.Namespace != ns || view.Name != name {
+			continue
+		}
+		if remove {
+			views.Views = append(views.Views[:i], views.Views[i+1:]...)
+		} else {
+			views.Views[i].Query = query
+		}
+		return nil
+	}
+	if remove {
+		return fmt.Errorf("no view %q: %w", name, ErrClientNotFound)
+	}
+	if len(views.Views) >= maxSavedViewsPerUser {
+		return fmt.Errorf("at most %v views can be saved: %w", maxSavedViewsPerUser, ErrClientBadRequest)
+	}
+	views.Views = append(views.Views, SavedView{
+		Namespace: ns,
+		Name:      name,
+		Query:     query,
+	})
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeViewQuery(t *testing.T) {
+	values, err := url.ParseQuery("manager=mgr&old_filter=1&subsystem=mm&action=save&name=foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sanitizeViewQuery(values), "manager=mgr&subsystem=mm"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	views := new(UserViews)
+	for i := 0; i < maxSavedViewsPerUser; i++ {
+		if err := views.update("ns", fmt.Sprint(i), "subsystem=mm", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Existing views may be updated, but no new views may be added.
+	if err := views.update("ns", "0", "manager=mgr", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := views.update("ns", "new", "manager=mgr", false); err == nil {
+		t.Fatal("the view limit is not enforced")
+	}
+	if err := views.update("ns", "0", "", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := views.update("ns", "new", "manager=mgr", false); err != nil {
+		t.Fatal(err)
+	}
+	if len(views.Views) != maxSavedViewsPerUser {
+		t.Fatalf("got %v views", len(views.Views))
+	}
+}
+
+func TestSavedViews(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	// Anonymous users can't save views.
+	_, err := c.AuthGET(AccessPublic, "/test1/views?action=save&name=mm&subsystem=mm")
+	c.expectTrue(err != nil)
+	page, err := c.AuthGET(AccessUser, "/test1")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Saved views:"))
+	c.expectTrue(!strings.Contains(string(page), "save the current filter"))
+
+	page, err = c.AuthGET(AccessUser, "/test1?subsystem=mm")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "save the current filter"))
+	checkRedirect(c, AccessUser, "/test1/views?action=save&name=mm&subsystem=mm&unknown=1",
+		"/test1?subsystem=mm", http.StatusFound)
+	checkRedirect(c, AccessUser, "/test1/views?action=save&name=revoked&repro_revoked=1",
+		"/test1?repro_revoked=1", http.StatusFound)
+
+	// The views are per namespace.
+	page, err = c.AuthGET(AccessUser, "/test2")
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), `<option value="mm"`))
+	page, err = c.AuthGET(AccessUser, "/test1?subsystem=mm")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), `<option value="mm" selected>mm</option>`))
+	c.expectTrue(strings.Contains(string(page), `<option value="revoked">revoked</option>`))
+
+	checkRedirect(c, AccessUser, "/test1/views?action=apply&name=revoked",
+		"/test1?repro_revoked=1", http.StatusFound)
+	checkResponseStatusCode(c, AccessUser, "/test1/views?action=apply&name=unknown", http.StatusNotFound)
+
+	checkRedirect(c, AccessUser, "/test1/views?action=delete&name=mm", "/test1", http.StatusFound)
+	page, err = c.AuthGET(AccessUser, "/test1")
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), `<option value="mm"`))
+}
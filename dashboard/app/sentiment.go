@@ -0,0 +1,76 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Sentiment of an external discussion message towards the validity of the bug.
+const (
+	sentimentNeutral   = ""
+	sentimentDisputed  = "disputed"
+	sentimentConfirmed = "confirmed"
+)
+
+// sentimentPhrases maps lower-case phrases to the sentiment they express.
+// Matching is done on message excerpts, so quoted text is not taken into account.
+// Phrases only match whole words, e.g. "not a bug" does not match "not a bugfix".
+var sentimentPhrases = []struct {
+	phrase    string
+	sentiment string
+}{
+	{"not a real bug", sentimentDisputed},
+	{"not a bug", sentimentDisputed},
+	{"don't think this is a bug", sentimentDisputed},
+	{"not a kernel bug", sentimentDisputed},
+	{"false positive", sentimentDisputed},
+	{"works as intended", sentimentDisputed},
+	{"working as intended", sentimentDisputed},
+	{"expected behavior", sentimentDisputed},
+	{"expected behaviour", sentimentDisputed},
+	{"abuses root", sentimentDisputed},
+	{"requires root", sentimentDisputed},
+	{"needs root", sentimentDisputed},
+	{"user error", sentimentDisputed},
+	{"not a security issue", sentimentDisputed},
+	{"invalid report", sentimentDisputed},
+	{"can be ignored", sentimentDisputed},
+	{"i can reproduce", sentimentConfirmed},
+	{"i was able to reproduce", sentimentConfirmed},
+	{"reproduced it", sentimentConfirmed},
+	{"good catch", sentimentConfirmed},
+	{"indeed a bug", sentimentConfirmed},
+	{"confirmed the bug", sentimentConfirmed},
+	{"i'll send a fix", sentimentConfirmed},
+	{"i will send a fix", sentimentConfirmed},
+	{"i'll send a patch", sentimentConfirmed},
+	{"i will send a patch", sentimentConfirmed},
+}
+
+var sentimentRes = func() []*regexp.Regexp {
+	var ret []*regexp.Regexp
+	for _, item := range sentimentPhrases {
+		ret = append(ret, regexp.MustCompile(`\b`+regexp.QuoteMeta(item.phrase)+`\b`))
+	}
+	return ret
+}()
+
+// classifySentiment determines whether the excerpt disputes or confirms the bug.
+// Disputing phrases take precedence since they are a stronger signal.
+func classifySentiment(excerpt string) string {
+	text := strings.Join(strings.Fields(strings.ToLower(excerpt)), " ")
+	ret := sentimentNeutral
+	for i, item := range sentimentPhrases {
+		if !sentimentRes[i].MatchString(text) {
+			continue
+		}
+		if item.sentiment == sentimentDisputed {
+			return sentimentDisputed
+		}
+		ret = item.sentiment
+	}
+	return ret
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSentimentPhrases(t *testing.T) {
+	for _, item := range sentimentPhrases {
+		item := item
+		t.Run(item.phrase, func(t *testing.T) {
+			excerpt := "Hi,\n\nI think that " + strings.ToUpper(item.phrase[:1]) + item.phrase[1:] + ".\n\nThanks"
+			if got := classifySentiment(excerpt); got != item.sentiment {
+				t.Fatalf("got %q, want %q", got, item.sentiment)
+			}
+		})
+	}
+}
+
+func TestClassifySentiment(t *testing.T) {
+	tests := []struct {
+		excerpt   string
+		sentiment string
+	}{
+		{"Thanks for the report, looking into it.", sentimentNeutral},
+		{"", sentimentNeutral},
+		{"This is\nnot a real\nbug.", sentimentDisputed},
+		{"Good catch, but it's a false positive.", sentimentDisputed},
+		{"I can't reproduce it.", sentimentNeutral},
+		{"I can reproduce it locally, will send a fix.", sentimentConfirmed},
+		{"It's not a bugfix, but a cleanup.", sentimentNeutral},
+		{"That's not a bug!", sentimentDisputed},
+		{"The test requires rootfs changes.", sentimentNeutral},
+		{"It requires root.", sentimentDisputed},
+		{"Thanks, good catches all around.", sentimentNeutral},
+		{"Not a false positives detector.", sentimentNeutral},
+		{"A good catch\nindeed.", sentimentConfirmed},
+	}
+	for i, test := range tests {
+		if got := classifySentiment(test.excerpt); got != test.sentiment {
+			t.Errorf("test #%d: got %q, want %q", i, got, test.sentiment)
+		}
+	}
+}
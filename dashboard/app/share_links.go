@@ -0,0 +1,357 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/user"
+)
+
+// Admins may share a bug that is not yet public (e.g. one in the moderation stage) with a person
+// who has no access to the dashboard. A share link contains a signed token that gives read-only access
+// to a single bug page and the crash texts referenced from it. The token is only checked by the /shared/
+// handlers, so it does not grant access to any other pages. Every link has an audit record (BugShareLink)
+// and can be revoked before it expires.
+
+const defaultShareLinkValidity = 7 * 24 * time.Hour
+
+func shareLinkConfig(ns string) *ShareLinkConfig {
+	if cfg := config.Namespaces[ns]; cfg != nil {
+		return cfg.ShareLinks
+	}
+	return nil
+}
+
+func shareLinkToken(secret, id string, link *BugShareLink) string {
+	return id + "." + digestToken(secret, "share", id, link.BugID, fmt.Sprint(link.Expires.Unix()))
+}
+
+func shareLinkURL(c context.Context, token string) string {
+	return appURL(c) + "/shared/bug?" + url.Values{"token": {token}}.Encode()
+}
+
+func shareLinkAuthor(c context.Context) string {
+	if u := user.Current(c); u != nil {
+		return u.Email
+	}
+	return ""
+}
+
+func handleShareBug(c context.Context, r *http.Request) error {
+	bug, err := findBugByID(c, r)
+	if err != nil {
+		return fmt.Errorf("%v, %w", err, ErrClientNotFound)
+	}
+	validity := defaultShareLinkValidity
+	if days := r.FormValue("days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("bad validity period %q: %w", days, ErrClientBadRequest)
+		}
+		validity = time.Duration(n) * 24 * time.Hour
+	}
+	if _, err := createShareLink(c, bug, validity, shareLinkAuthor(c)); err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(bug.keyHash()))}
+}
+
+// createShareLink generates a new share link for the bug and returns its token.
+func createShareLink(c context.Context, bug *Bug, validity time.Duration, author string) (string, error) {
+	cfg := shareLinkConfig(bug.Namespace)
+	if cfg == nil {
+		return "", fmt.Errorf("share links are not enabled in %v: %w", bug.Namespace, ErrClientBadRequest)
+	}
+	if validity > cfg.MaxValidity {
+		return "", fmt.Errorf("share links can't be valid for more than %v: %w",
+			cfg.MaxValidity, ErrClientBadRequest)
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate link id: %w", err)
+	}
+	id := hex.EncodeToString(raw)
+	now := timeNow(c)
+	link := &BugShareLink{
+		Namespace: bug.Namespace,
+		BugID:     bug.keyHash(),
+		User:      author,
+		Created:   now,
+		Expires:   now.Add(validity),
+	}
+	if _, err := db.Put(c, db.NewKey(c, "BugShareLink", id, 0, nil), link); err != nil {
+		return "", fmt.Errorf("failed to save the share link: %w", err)
+	}
+	log.Infof(c, "bug %v: share link %v generated by %v", link.BugID, id, author)
+	return shareLinkToken(cfg.Secret, id, link), nil
+}
+
+func handleRevokeShareLink(c context.Context, r *http.Request) error {
+	id := r.FormValue("link")
+	link, err := revokeShareLink(c, id, shareLinkAuthor(c))
+	if err != nil {
+		return err
+	}
+	return ErrRedirect{fmt.Errorf("%v", bugLink(link.BugID))}
+}
+
+func revokeShareLink(c context.Context, id, author string) (*BugShareLink, error) {
+	key := db.NewKey(c, "BugShareLink", id, 0, nil)
+	link := new(BugShareLink)
+	tx := func(c context.Context) error {
+		if err := db.Get(c, key, link); err != nil {
+			if err == db.ErrNoSuchEntity {
+				return fmt.Errorf("share link %q: %w", id, ErrClientNotFound)
+			}
+			return fmt.Errorf("failed to get the share link: %w", err)
+		}
+		if !link.Revoked.IsZero() {
+			return nil
+		}
+		link.Revoked = timeNow(c)
+		link.RevokedBy = author
+		if _, err := db.Put(c, key, link); err != nil {
+			return fmt.Errorf("failed to put the share link: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return nil, err
+	}
+	log.Infof(c, "bug %v: share link %v revoked by %v", link.BugID, id, author)
+	return link, nil
+}
+
+// sharedBug is the bug accessed via a share link.
+type sharedBug struct {
+	token string
+	link  *BugShareLink
+	bug   *Bug
+}
+
+type sharedHandler func(c context.Context, w http.ResponseWriter, r *http.Request, shared *sharedBug) error
+
+// handleShareToken serves the request only if it carries a valid share link token.
+// It replaces handleAuth for the /shared/ pages: the token holders don't need any other access.
+func handleShareToken(fn sharedHandler) contextHandler {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) error {
+		shared, err := checkShareToken(c, r.FormValue("token"))
+		if err != nil {
+			return err
+		}
+		return fn(c, w, r, shared)
+	}
+}
+
+// checkShareToken verifies the token, records the access and returns the shared bug.
+func checkShareToken(c context.Context, token string) (*sharedBug, error) {
+	id, _, _ := strings.Cut(token, ".")
+	if id == "" {
+		return nil, fmt.Errorf("no share link token: %w", ErrClientBadRequest)
+	}
+	key := db.NewKey(c, "BugShareLink", id, 0, nil)
+	link := new(BugShareLink)
+	if err := db.Get(c, key, link); err != nil {
+		if err == db.ErrNoSuchEntity {
+			return nil, fmt.Errorf("unknown share link: %w", ErrClientNotFound)
+		}
+		return nil, fmt.Errorf("failed to get the share link: %w", err)
+	}
+	cfg := shareLinkConfig(link.Namespace)
+	if cfg == nil || !checkDigestToken(cfg.Secret, token, shareLinkToken(cfg.Secret, id, link)) {
+		return nil, fmt.Errorf("unknown share link: %w", ErrClientNotFound)
+	}
+	if !link.Revoked.IsZero() {
+		return nil, fmt.Errorf("this share link was revoked on %v: %w",
+			link.Revoked.Format(time.RFC822), ErrClientGone)
+	}
+	now := timeNow(c)
+	if !now.Before(link.Expires) {
+		return nil, fmt.Errorf("this share link expired on %v, ask the person who shared it with you"+
+			" for a new one: %w", link.Expires.Format(time.RFC822), ErrClientGone)
+	}
+	bug := new(Bug)
+	if err := db.Get(c, db.NewKey(c, "Bug", link.BugID, 0, nil), bug); err != nil {
+		return nil, fmt.Errorf("failed to get bug: %w", err)
+	}
+	if isReadOnly(c) {
+		// The access is not recorded, it's only an audit counter.
+		return &sharedBug{token, link, bug}, nil
+	}
+	tx := func(c context.Context) error {
+		if err := db.Get(c, key, link); err != nil {
+			return fmt.Errorf("failed to get the share link: %w", err)
+		}
+		link.Accesses++
+		link.LastAccess = now
+		_, err := db.Put(c, key, link)
+		return err
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		// Don't deny access just because of the audit contention.
+		log.Errorf(c, "failed to record share link access: %v", err)
+	}
+	return &sharedBug{token, link, bug}, nil
+}
+
+type uiSharedBugPage struct {
+	Header       *uiHeader
+	Now          time.Time
+	Title        string
+	Status       string
+	FirstTime    time.Time
+	LastTime     time.Time
+	NumCrashes   int64
+	Expires      time.Time
+	SampleReport template.HTML
+	Crashes      *uiCrashTable
+}
+
+func handleSharedBug(c context.Context, w http.ResponseWriter, r *http.Request, shared *sharedBug) error {
+	bug := shared.bug
+	crashes, sampleReport, _, err := loadSharedCrashes(c, bug, shared.token)
+	if err != nil {
+		return err
+	}
+	return serveTemplate(w, "shared_bug.html", &uiSharedBugPage{
+		Header:       commonHeaderRaw(c, r),
+		Now:          timeNow(c),
+		Title:        bug.displayTitle(),
+		Status:       similarBugStatus(bug),
+		FirstTime:    bug.FirstTime,
+		LastTime:     bug.LastTime,
+		NumCrashes:   bug.NumCrashes,
+		Expires:      shared.link.Expires,
+		SampleReport: sampleReport,
+		Crashes: &uiCrashTable{
+			Crashes: crashes,
+			Caption: fmt.Sprintf("Crashes (%d)", bug.NumCrashes),
+		},
+	})
+}
+
+func handleSharedText(c context.Context, w http.ResponseWriter, r *http.Request, shared *sharedBug) error {
+	tag := r.FormValue("tag")
+	id, err := strconv.ParseUint(r.FormValue("x"), 16, 64)
+	if err != nil || id == 0 {
+		return fmt.Errorf("failed to parse text id: %v: %w", err, ErrClientBadRequest)
+	}
+	_, _, allowed, err := loadSharedCrashes(c, shared.bug, shared.token)
+	if err != nil {
+		return err
+	}
+	// Only the texts linked from the shared bug page are accessible.
+	if !allowed[textLink(tag, int64(id))] {
+		return fmt.Errorf("the text is not a part of the shared bug: %w", ErrClientNotFound)
+	}
+	data, _, err := getText(c, tag, int64(id))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename="+textFilename(tag))
+	w.Write(data)
+	return nil
+}
+
+// loadSharedCrashes returns the crashes of the shared bug with the text links rewritten to go
+// through the share link, and the set of the original text links.
+func loadSharedCrashes(c context.Context, bug *Bug, token string) (
+	[]*uiCrash, template.HTML, map[string]bool, error) {
+	crashes, sampleReport, _, err := loadCrashesForBug(c, bug)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	allowed := map[string]bool{}
+	rewrite := func(link *string) {
+		if *link == "" {
+			return
+		}
+		allowed[*link] = true
+		*link = "/shared/text?" + url.Values{"token": {token}}.Encode() + "&" + strings.TrimPrefix(*link, "/text?")
+	}
+	for _, crash := range crashes {
+		for _, link := range []*string{&crash.LogLink, &crash.ReportLink, &crash.ReproSyzLink,
+			&crash.ReproCLink, &crash.MachineInfoLink} {
+			rewrite(link)
+		}
+		if crash.uiBuild != nil {
+			rewrite(&crash.KernelConfigLink)
+		}
+		// The repro bundle is served by a different page.
+		crash.EnvLink = ""
+	}
+	return crashes, sampleReport, allowed, nil
+}
+
+type uiShareLinks struct {
+	BugID       string
+	MaxValidity time.Duration
+	Links       []*uiShareLink
+}
+
+type uiShareLink struct {
+	ID         string
+	URL        string
+	User       string
+	Created    time.Time
+	Expires    time.Time
+	Revoked    time.Time
+	RevokedBy  string
+	Accesses   int64
+	LastAccess time.Time
+	Active     bool
+}
+
+// loadShareLinksUI returns the share links of the bug for the admins, or nil if they are not enabled.
+func loadShareLinksUI(c context.Context, bug *Bug) (*uiShareLinks, error) {
+	cfg := shareLinkConfig(bug.Namespace)
+	if cfg == nil {
+		return nil, nil
+	}
+	var links []*BugShareLink
+	keys, err := db.NewQuery("BugShareLink").
+		Filter("BugID=", bug.keyHash()).
+		GetAll(c, &links)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share links: %w", err)
+	}
+	ret := &uiShareLinks{
+		BugID:       bug.keyHash(),
+		MaxValidity: cfg.MaxValidity,
+	}
+	now := timeNow(c)
+	for i, link := range links {
+		id := keys[i].StringID()
+		ret.Links = append(ret.Links, &uiShareLink{
+			ID:         id,
+			URL:        shareLinkURL(c, shareLinkToken(cfg.Secret, id, link)),
+			User:       link.User,
+			Created:    link.Created,
+			Expires:    link.Expires,
+			Revoked:    link.Revoked,
+			RevokedBy:  link.RevokedBy,
+			Accesses:   link.Accesses,
+			LastAccess: link.LastAccess,
+			Active:     link.Revoked.IsZero() && now.Before(link.Expires),
+		})
+	}
+	sort.Slice(ret.Links, func(i, j int) bool {
+		return ret.Links[i].Created.After(ret.Links[j].Created)
+	})
+	return ret, nil
+}
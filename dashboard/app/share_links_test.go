@@ -0,0 +1,93 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareLinks(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	rep1 := c.client.pollBug()
+	c.client.ReportCrash(testCrash(build, 2))
+	rep2 := c.client.pollBug()
+	bug1, _, _ := c.loadBug(rep1.ID)
+	bug2, _, _ := c.loadBug(rep2.ID)
+
+	// Only admins can share bugs.
+	checkResponseStatusCode(c, AccessUser, "/admin?action=share_bug&id="+bug1.keyHash(), http.StatusForbidden)
+	_, err := c.AuthGET(AccessAdmin, "/admin?action=share_bug&id="+bug1.keyHash()+"&days=1000")
+	c.expectBadReqest(err)
+	checkRedirect(c, AccessAdmin, "/admin?action=share_bug&id="+bug1.keyHash()+"&days=2",
+		"/bug?id="+bug1.keyHash(), http.StatusFound)
+	links, err := loadShareLinksUI(c.ctx, bug1)
+	c.expectOK(err)
+	c.expectEQ(len(links.Links), 1)
+	link := links.Links[0]
+	c.expectEQ(link.User, "user@syzkaller.com")
+	c.expectTrue(link.Active)
+	shareURL, err := url.Parse(link.URL)
+	c.expectOK(err)
+	token := shareURL.Query().Get("token")
+
+	page, err := c.AuthGET(AccessPublic, "/shared/bug?token="+url.QueryEscape(token))
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte(bug1.Title)))
+	textLinks := regexp.MustCompile(`/shared/text\?[^"]+`).FindAll(page, -1)
+	c.expectEQ(len(textLinks), 3)
+	for _, textLink := range textLinks {
+		_, err := c.AuthGET(AccessPublic, html.UnescapeString(string(textLink)))
+		c.expectOK(err)
+	}
+
+	// The token does not give access to any other pages.
+	checkResponseStatusCode(c, AccessPublic, "/bug?id="+bug1.keyHash()+"&token="+url.QueryEscape(token),
+		http.StatusTemporaryRedirect)
+	_, crash2, _ := c.loadBugInfo(bug2)
+	checkResponseStatusCode(c, AccessPublic, "/shared/text?token="+url.QueryEscape(token)+
+		"&"+strings.TrimPrefix(textLink(textCrashLog, crash2.Log), "/text?"), http.StatusNotFound)
+	tampered := strings.Replace(token, ".", "."+strings.Repeat("0", 4), 1)
+	checkResponseStatusCode(c, AccessPublic, "/shared/bug?token="+url.QueryEscape(tampered), http.StatusNotFound)
+	checkResponseStatusCode(c, AccessPublic, "/shared/bug?token=unknown.link", http.StatusNotFound)
+
+	links, err = loadShareLinksUI(c.ctx, bug1)
+	c.expectOK(err)
+	c.expectEQ(links.Links[0].Accesses, int64(1+len(textLinks)))
+
+	// The link expires.
+	c.advanceTime(3 * 24 * time.Hour)
+	_, err = c.AuthGET(AccessPublic, "/shared/bug?token="+url.QueryEscape(token))
+	c.expectEQ(err.(HTTPError).Code, http.StatusGone)
+	c.expectTrue(strings.Contains(err.(HTTPError).Body, "this share link expired"))
+	checkResponseStatusCode(c, AccessPublic, html.UnescapeString(string(textLinks[0])), http.StatusGone)
+
+	// A revoked link stops working.
+	token, err = createShareLink(c.ctx, bug1, 24*time.Hour, "")
+	c.expectOK(err)
+	_, err = c.AuthGET(AccessPublic, "/shared/bug?token="+url.QueryEscape(token))
+	c.expectOK(err)
+	id, _, _ := strings.Cut(token, ".")
+	checkRedirect(c, AccessAdmin, "/admin?action=revoke_share_link&link="+id,
+		"/bug?id="+bug1.keyHash(), http.StatusFound)
+	_, err = c.AuthGET(AccessPublic, "/shared/bug?token="+url.QueryEscape(token))
+	c.expectEQ(err.(HTTPError).Code, http.StatusGone)
+	c.expectTrue(strings.Contains(err.(HTTPError).Body, "this share link was revoked"))
+
+	page, err = c.AuthGET(AccessAdmin, "/bug?id="+bug1.keyHash())
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("revoked by user@syzkaller.com")))
+	c.expectTrue(bytes.Contains(page, []byte("create share link")))
+}
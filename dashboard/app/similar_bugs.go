@@ -0,0 +1,244 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/report"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// The same crash is often reported both upstream and in several downstream namespaces.
+// Bugs from different namespaces of the same SimilarityDomain that share a title and
+// the top frames of the call trace are linked with each other (see Bug.SimilarBugs).
+// The links are maintained incrementally: a bug is matched against the other bugs with
+// the same titles once its top frames become known and every time it gets a new title.
+
+// similarFrames is the number of the top call trace frames that must match.
+const similarFrames = 3
+
+var (
+	callTraceFrameRe = regexp.MustCompile(`^\s*(?:\[<[0-9a-f]+>\]\s*)?(\?\s+)?([a-zA-Z0-9_.]+)` +
+		`(?:\+0x[0-9a-f]+/0x[0-9a-f]+|\s.*\[inline\])`)
+	// Frames of the crash reporting machinery that precede the actually interesting ones.
+	reportingFrameRe = regexp.MustCompile(`^(?:__)?(?:dump_stack|show_stack|print_|kasan_|kmsan_|ubsan_|` +
+		`__kasan|warn_|__warn|report_bug|handle_bug|exc_invalid_op|asm_exc_|panic|check_panic|` +
+		`print_address_description|print_report|__asan_|__msan_|check_memory_region|warn_slowpath)`)
+)
+
+// topFrames returns the top frames of the first call trace in the report.
+// For KMSAN reports they are followed by the top frames of the origin stack (prefixed with "origin:"),
+// as the same uninit value use with different origins is usually a different bug.
+func topFrames(rep []byte) []string {
+	frames := callTraceFrames(rep, true)
+	if origin := report.KMSANOrigin(rep); origin != nil {
+		// Skip the "Uninit was created at:" line.
+		origin = origin[bytes.IndexByte(origin, '\n')+1:]
+		for _, frame := range stackFrames(origin, true, true) {
+			frames = append(frames, "origin:"+frame)
+		}
+	}
+	return frames
+}
+
+// callTraceFrames returns the top frames of the first call trace in the report,
+// the inlined frames are skipped unless inline is set.
+// KMSAN reports have no "Call Trace:" line, their stack follows the title line.
+func callTraceFrames(report []byte, inline bool) []string {
+	return stackFrames(report, false, inline)
+}
+
+func stackFrames(report []byte, inTrace, inline bool) []string {
+	var frames []string
+	s := bufio.NewScanner(bytes.NewReader(report))
+	for s.Scan() && len(frames) < similarFrames {
+		line := s.Text()
+		if !inTrace {
+			inTrace = strings.Contains(strings.ToLower(line), "call trace:") ||
+				strings.HasPrefix(line, "BUG: KMSAN:")
+			continue
+		}
+		if strings.HasSuffix(line, " created at:") {
+			// The KMSAN origin stack.
+			break
+		}
+		match := callTraceFrameRe.FindStringSubmatch(line)
+		// Frames prefixed with "?" are unreliable.
+		if match == nil || match[1] != "" || reportingFrameRe.MatchString(match[2]) ||
+			!inline && strings.HasSuffix(line, "[inline]") {
+			continue
+		}
+		frames = append(frames, match[2])
+	}
+	return frames
+}
+
+// similarCrashes checks whether the bugs from different namespaces are the same crash.
+func similarCrashes(a, b *Bug) bool {
+	if a.Namespace == b.Namespace || len(a.TopFrames) == 0 || len(b.TopFrames) == 0 ||
+		config.Namespaces[a.Namespace].SimilarityDomain != config.Namespaces[b.Namespace].SimilarityDomain {
+		return false
+	}
+	titleMatch := false
+	for _, title := range a.AltTitles {
+		if stringInList(b.AltTitles, title) {
+			titleMatch = true
+			break
+		}
+	}
+	if !titleMatch {
+		return false
+	}
+	n := len(a.TopFrames)
+	if len(b.TopFrames) < n {
+		n = len(b.TopFrames)
+	}
+	for i := 0; i < n; i++ {
+		if a.TopFrames[i] != b.TopFrames[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// linkSimilarBugs links the bug with the similar bugs from other namespaces, the lookup
+// is limited to the bugs that share one of the bug titles.
+func linkSimilarBugs(c context.Context, bug *Bug) error {
+	candidates, err := loadSimilarBugs(c, bug)
+	if err != nil {
+		return fmt.Errorf("failed to query similar bugs: %w", err)
+	}
+	for _, other := range candidates {
+		if stringInList(bug.SimilarBugs, other.keyHash()) || !similarCrashes(bug, other) {
+			continue
+		}
+		log.Infof(c, "%v: %q is similar to %q in %v", bug.Namespace, bug.Title, other.Title, other.Namespace)
+		if err := addSimilarBugLink(c, bug.key(c), other.keyHash()); err != nil {
+			return err
+		}
+		if err := addSimilarBugLink(c, other.key(c), bug.keyHash()); err != nil {
+			return err
+		}
+		bug.SimilarBugs = append(bug.SimilarBugs, other.keyHash())
+	}
+	return nil
+}
+
+func addSimilarBugLink(c context.Context, bugKey *db.Key, similar string) error {
+	tx := func(c context.Context) error {
+		bug := new(Bug)
+		if err := db.Get(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to get bug: %w", err)
+		}
+		if stringInList(bug.SimilarBugs, similar) {
+			return nil
+		}
+		bug.SimilarBugs = append(bug.SimilarBugs, similar)
+		if _, err := db.Put(c, bugKey, bug); err != nil {
+			return fmt.Errorf("failed to put bug: %w", err)
+		}
+		return nil
+	}
+	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+}
+
+type uiSimilarBug struct {
+	Namespace string
+	Title     string
+	Link      string
+	Status    string
+}
+
+// uiUpstreamFix is an advisory about a fix of the upstream counterpart of a downstream bug.
+type uiUpstreamFix struct {
+	Namespace string
+	Link      string
+	Commits   []string
+}
+
+// loadLinkedSimilarBugs returns the linked similar bugs that are visible at the access level.
+func loadLinkedSimilarBugs(c context.Context, bug *Bug, accessLevel AccessLevel) ([]*Bug, error) {
+	if len(bug.SimilarBugs) == 0 {
+		return nil, nil
+	}
+	var keys []*db.Key
+	for _, id := range bug.SimilarBugs {
+		keys = append(keys, db.NewKey(c, "Bug", id, 0, nil))
+	}
+	bugs := make([]*Bug, len(keys))
+	if err := db.GetMulti(c, keys, bugs); err != nil {
+		var merr appengine.MultiError
+		if !errors.As(err, &merr) {
+			return nil, fmt.Errorf("failed to get similar bugs: %w", err)
+		}
+		for i, err := range merr {
+			if err == db.ErrNoSuchEntity {
+				// The linked bugs may be deleted together with their namespaces.
+				bugs[i] = nil
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to get similar bugs: %w", err)
+			}
+		}
+	}
+	var ret []*Bug
+	for _, other := range bugs {
+		if other == nil || config.Namespaces[other.Namespace] == nil ||
+			accessLevel < config.Namespaces[other.Namespace].AccessLevel ||
+			accessLevel < other.sanitizeAccess(accessLevel) {
+			continue
+		}
+		ret = append(ret, other)
+	}
+	return ret, nil
+}
+
+func makeSimilarBugsUI(bug *Bug, similar []*Bug) ([]*uiSimilarBug, *uiUpstreamFix) {
+	var ret []*uiSimilarBug
+	var fix *uiUpstreamFix
+	upstreamNs := config.Namespaces[bug.Namespace].UpstreamNamespace
+	for _, other := range similar {
+		ret = append(ret, &uiSimilarBug{
+			Namespace: other.Namespace,
+			Title:     other.displayTitle(),
+			Link:      bugLink(other.keyHash()),
+			Status:    similarBugStatus(other),
+		})
+		if fix == nil && other.Namespace == upstreamNs && other.Status == BugStatusFixed &&
+			len(other.Commits) != 0 && bug.Status == BugStatusOpen && len(bug.Commits) == 0 {
+			fix = &uiUpstreamFix{
+				Namespace: other.Namespace,
+				Link:      bugLink(other.keyHash()),
+				Commits:   other.Commits,
+			}
+		}
+	}
+	return ret, fix
+}
+
+func similarBugStatus(bug *Bug) string {
+	switch bug.Status {
+	case BugStatusOpen:
+		if len(bug.Commits) != 0 {
+			return "fix pending"
+		}
+		return "open"
+	case BugStatusFixed:
+		return "fixed"
+	case BugStatusInvalid:
+		return "invalid"
+	case BugStatusDup:
+		return "duplicate"
+	default:
+		return fmt.Sprintf("unknown (%v)", bug.Status)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+const similarTestReport = `BUG: KASAN: use-after-free in foo_bar+0x12/0x340 net/foo.c:12
+Read of size 8 at addr ffff88801234abcd by task syz-executor.3/5123
+
+Call Trace:
+ <TASK>
+ __dump_stack lib/dump_stack.c:88 [inline]
+ dump_stack_lvl+0x1e3/0x2cb lib/dump_stack.c:106
+ print_address_description mm/kasan/report.c:351 [inline]
+ print_report+0x163/0x540 mm/kasan/report.c:462
+ kasan_report+0x175/0x1b0 mm/kasan/report.c:572
+ foo_inner net/foo.c:10 [inline]
+ foo_bar+0x12/0x340 net/foo.c:12
+ ? unreliable_frame+0x1/0x2
+ baz+0x10/0x20 net/baz.c:5
+ qux+0x1/0x2 net/qux.c:1
+ </TASK>
+`
+
+func TestTopFrames(t *testing.T) {
+	tests := []struct {
+		report string
+		frames []string
+	}{
+		{
+			report: similarTestReport,
+			frames: []string{"foo_inner", "foo_bar", "baz"},
+		},
+		{
+			report: `WARNING: CPU: 0 PID: 1 at kernel/foo.c:1 foo+0x1/0x2
+Call Trace:
+ [<ffffffff81234567>] bar+0x10/0x20
+ [<ffffffff81234568>] ? unreliable+0x1/0x2
+ [<ffffffff81234569>] baz+0x30/0x40
+`,
+			frames: []string{"bar", "baz"},
+		},
+		{
+			// There's no call trace.
+			report: "general protection fault in foo+0x1/0x2\n",
+		},
+		{
+			report: `BUG: KMSAN: uninit-value in foo+0x1/0x2
+ foo+0x1/0x2
+ bar+0x10/0x20
+
+Uninit was created at:
+ __kmalloc+0x1/0x2
+ alloc_skb+0x10/0x20
+ baz_write+0x30/0x40
+ vfs_write+0x50/0x60
+`,
+			frames: []string{"foo", "bar", "origin:__kmalloc", "origin:alloc_skb", "origin:baz_write"},
+		},
+	}
+	for i, test := range tests {
+		if diff := cmp.Diff(test.frames, topFrames([]byte(test.report))); diff != "" {
+			t.Errorf("test #%v: %s", i, diff)
+		}
+	}
+}
+
+func TestSimilarCrashes(t *testing.T) {
+	bug := func(ns string, titles []string, frames ...string) *Bug {
+		return &Bug{Namespace: ns, Title: titles[0], AltTitles: titles, TopFrames: frames}
+	}
+	upstream := bug("access-public-email", []string{"title1", "title2"}, "foo", "bar", "baz")
+	tests := []struct {
+		other   *Bug
+		similar bool
+	}{
+		{bug("downstream", []string{"title1"}, "foo", "bar", "baz"), true},
+		{bug("downstream", []string{"title3", "title2"}, "foo", "bar"), true},
+		{bug("downstream", []string{"title1"}, "foo", "qux", "baz"), false},
+		{bug("downstream", []string{"title3"}, "foo", "bar", "baz"), false},
+		{bug("downstream", []string{"title1"}), false},
+		// The same namespace.
+		{bug("access-public-email", []string{"title1"}, "foo", "bar", "baz"), false},
+		// A different similarity domain.
+		{bug("test1", []string{"title1"}, "foo", "bar", "baz"), false},
+	}
+	for i, test := range tests {
+		if got := similarCrashes(upstream, test.other); got != test.similar {
+			t.Errorf("test #%v: got %v, want %v", i, got, test.similar)
+		}
+		if got := similarCrashes(test.other, upstream); got != test.similar {
+			t.Errorf("test #%v (reversed): got %v, want %v", i, got, test.similar)
+		}
+	}
+}
+
+func TestSimilarBugLinks(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	upstreamClient := c.publicClient
+	downstreamClient := c.makeClient(clientDownstream, keyDownstream, true)
+
+	build := testBuild(1)
+	upstreamClient.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.Report = []byte(similarTestReport)
+	upstreamClient.ReportCrash(crash)
+	msg := upstreamClient.pollEmailBug()
+	_, upstreamID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+
+	// The same crash happens downstream, the bug gets the matching title and stack only later.
+	build2 := testBuild(2)
+	downstreamClient.UploadBuild(build2)
+	downstreamClient.ReportCrash(testCrash(build2, 2))
+	crash2 := testCrash(build2, 1)
+	crash2.Title = "title2"
+	crash2.AltTitles = []string{crash.Title}
+	crash2.Report = []byte(similarTestReport)
+	downstreamClient.ReportCrash(crash2)
+	// An unrelated bug with the same stack.
+	crash3 := testCrash(build2, 3)
+	crash3.Report = []byte(similarTestReport)
+	downstreamClient.ReportCrash(crash3)
+
+	upstreamBug, _, _ := c.loadBug(upstreamID)
+	c.expectEQ(upstreamBug.TopFrames, []string{"foo_inner", "foo_bar", "baz"})
+	downstreamBug, _, _ := c.loadBugByHash(bugKeyHash("downstream", "title2", 0))
+	other, _, _ := c.loadBugByHash(bugKeyHash("downstream", "title3", 0))
+	c.expectEQ(upstreamBug.SimilarBugs, []string{downstreamBug.keyHash()})
+	c.expectEQ(downstreamBug.SimilarBugs, []string{upstreamBug.keyHash()})
+	c.expectEQ(len(other.SimilarBugs), 0)
+
+	page, err := c.AuthGET(AccessPublic, "/bug?id="+upstreamBug.keyHash())
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Also seen in:"))
+	c.expectTrue(strings.Contains(string(page), "downstream</a> (open)"))
+
+	// Once the bug is fixed upstream, the downstream bug gets an advisory.
+	build.FixCommits = []dashapi.Commit{{Title: "foo: fix the crash", BugIDs: []string{upstreamID}}}
+	upstreamClient.UploadBuild(build)
+	upstreamBug, _, _ = c.loadBug(upstreamID)
+	c.expectEQ(upstreamBug.Status, BugStatusFixed)
+	page, err = c.AuthGET(AccessPublic, "/bug?id="+downstreamBug.keyHash())
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "access-public-email</a> (fixed)"))
+	c.expectTrue(strings.Contains(string(page), "Fixed upstream"))
+	c.expectTrue(strings.Contains(string(page), "foo: fix the crash"))
+	page, err = c.AuthGET(AccessPublic, "/bug?id="+other.keyHash())
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), "Fixed upstream"))
+}
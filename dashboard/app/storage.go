@@ -0,0 +1,453 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/asset"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+	"google.golang.org/appengine/v2/memcache"
+)
+
+// Per-namespace storage accounting.
+// The upload paths count the bytes written per text entity kind and asset type in memcache
+// counters (a datastore write per upload would cause contention), and the deprecate_assets
+// cron folds the counters into StorageUsage entities. The numbers are approximate: memcache
+// may lose the counters and not all deletions are accounted.
+// If a namespace stores more than its StorageQuota, the cron evicts the oldest non-essential
+// crash logs ahead of the normal schedule.
+
+// StorageUsage is the accumulated storage usage of a namespace, the key is the namespace name.
+type StorageUsage struct {
+	Namespace string
+	Types     []StorageTypeUsage `datastore:",noindex"`
+	Updated   time.Time
+	// EvictionCursor is the position of the eviction scan over the namespace bugs.
+	EvictionCursor string `datastore:",noindex"`
+}
+
+type StorageTypeUsage struct {
+	Type    string // text entity kind or asset type
+	Written int64
+	Freed   int64
+}
+
+const (
+	// The number of bugs whose crashes are inspected per namespace during one cron run.
+	storageEvictionBugs = 50
+	// The maximum number of crash logs evicted per namespace during one cron run.
+	storageEvictionLimit = 200
+)
+
+func storageTypes() []string {
+	ret := []string{textCrashLog, textCrashReport, textReproSyz, textReproC, textMachineInfo,
+		textKernelConfig, textPatch, textLog, textError, textDiscussionExport}
+	for _, typ := range asset.AllTypes() {
+		ret = append(ret, string(typ))
+	}
+	return ret
+}
+
+func storageCounterKey(kind, ns, typ string) string {
+	return fmt.Sprintf("storage-%v-%v-%v", kind, ns, typ)
+}
+
+func recordStorageWrite(c context.Context, ns, typ string, size int64) {
+	countStorage(c, storageCounterKey("written", ns, typ), size)
+}
+
+func recordStorageFree(c context.Context, ns, typ string, size int64) {
+	countStorage(c, storageCounterKey("freed", ns, typ), size)
+}
+
+func recordAssetWrites(c context.Context, ns string, assets []dashapi.NewAsset) {
+	for _, a := range assets {
+		recordStorageWrite(c, ns, string(a.Type), a.Size)
+	}
+}
+
+func countStorage(c context.Context, key string, size int64) {
+	if size == 0 {
+		return
+	}
+	if _, err := memcache.Increment(c, key, size, 0); err != nil {
+		log.Errorf(c, "failed to count storage: %v", err)
+	}
+}
+
+// takeStorageCounter returns the current value of the counter and subtracts it from the counter.
+func takeStorageCounter(c context.Context, key string) (int64, error) {
+	item, err := memcache.Get(c, key)
+	if err == memcache.ErrCacheMiss {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseInt(string(item.Value), 10, 64)
+	if err != nil || value == 0 {
+		return 0, err
+	}
+	if _, err := memcache.Increment(c, key, -value, 0); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (usage *StorageUsage) add(typ string, written, freed int64) {
+	for i := range usage.Types {
+		if usage.Types[i].Type == typ {
+			usage.Types[i].Written += written
+			usage.Types[i].Freed += freed
+			return
+		}
+	}
+	usage.Types = append(usage.Types, StorageTypeUsage{typ, written, freed})
+	sort.Slice(usage.Types, func(i, j int) bool { return usage.Types[i].Type < usage.Types[j].Type })
+}
+
+func (item *StorageTypeUsage) used() int64 {
+	if item.Freed > item.Written {
+		return 0
+	}
+	return item.Written - item.Freed
+}
+
+func (usage *StorageUsage) used() int64 {
+	ret := int64(0)
+	for i := range usage.Types {
+		ret += usage.Types[i].used()
+	}
+	return ret
+}
+
+func storageUsageKey(c context.Context, ns string) *db.Key {
+	return db.NewKey(c, "StorageUsage", ns, 0, nil)
+}
+
+func loadStorageUsage(c context.Context, ns string) (*StorageUsage, error) {
+	usage := &StorageUsage{Namespace: ns}
+	if err := db.Get(c, storageUsageKey(c, ns), usage); err != nil && err != db.ErrNoSuchEntity {
+		return nil, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	return usage, nil
+}
+
+// updateStorageUsage applies fn to the StorageUsage entity of the namespace.
+func updateStorageUsage(c context.Context, ns string, fn func(usage *StorageUsage)) (*StorageUsage, error) {
+	var ret *StorageUsage
+	tx := func(c context.Context) error {
+		usage, err := loadStorageUsage(c, ns)
+		if err != nil {
+			return err
+		}
+		fn(usage)
+		usage.Updated = timeNow(c)
+		if _, err := db.Put(c, storageUsageKey(c, ns), usage); err != nil {
+			return fmt.Errorf("failed to put storage usage: %w", err)
+		}
+		ret = usage
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// foldStorageCounters moves the memcache counters of the namespace into its StorageUsage.
+func foldStorageCounters(c context.Context, ns string) (*StorageUsage, error) {
+	delta := &StorageUsage{}
+	for _, typ := range storageTypes() {
+		written, err := takeStorageCounter(c, storageCounterKey("written", ns, typ))
+		if err != nil {
+			return nil, err
+		}
+		freed, err := takeStorageCounter(c, storageCounterKey("freed", ns, typ))
+		if err != nil {
+			return nil, err
+		}
+		if written != 0 || freed != 0 {
+			delta.add(typ, written, freed)
+		}
+	}
+	return updateStorageUsage(c, ns, func(usage *StorageUsage) {
+		for _, item := range delta.Types {
+			usage.add(item.Type, item.Written, item.Freed)
+		}
+	})
+}
+
+// checkStorageQuotas is called by the deprecate_assets cron.
+func checkStorageQuotas(c context.Context) {
+	for ns, cfg := range config.Namespaces {
+		usage, err := foldStorageCounters(c, ns)
+		if err != nil {
+			log.Errorf(c, "failed to update storage usage of %v: %v", ns, err)
+			continue
+		}
+		if cfg.StorageQuota == 0 || usage.used() <= cfg.StorageQuota {
+			continue
+		}
+		if err := evictNamespaceStorage(c, ns, usage, usage.used()-cfg.StorageQuota); err != nil {
+			log.Errorf(c, "failed to evict storage of %v: %v", ns, err)
+		}
+	}
+}
+
+// storageItem describes a piece of stored data that could be evicted.
+type storageItem struct {
+	Type    string
+	Size    int64
+	Created time.Time
+	// Essential items are never evicted.
+	Essential bool
+	HasRepro  bool
+
+	crashKey *db.Key
+}
+
+// storageEvictionClass returns the order in which the items are evicted, or -1 if the item must be kept.
+func storageEvictionClass(item *storageItem) int {
+	if item.Essential || item.Size == 0 || item.Type != textCrashLog {
+		return -1
+	}
+	// Logs of crashes without reproducers are the least useful.
+	if !item.HasRepro {
+		return 0
+	}
+	return 1
+}
+
+// selectStorageEvictions returns the items that need to be evicted to free at least excess bytes
+// (or all evictable items if they are not enough). The items are evicted class by class,
+// the oldest first.
+func selectStorageEvictions(items []*storageItem, excess int64, limit int) []*storageItem {
+	var candidates []*storageItem
+	for _, item := range items {
+		if storageEvictionClass(item) >= 0 {
+			candidates = append(candidates, item)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ci, cj := storageEvictionClass(candidates[i]), storageEvictionClass(candidates[j])
+		if ci != cj {
+			return ci < cj
+		}
+		return candidates[i].Created.Before(candidates[j].Created)
+	})
+	var ret []*storageItem
+	for _, item := range candidates {
+		if excess <= 0 || len(ret) == limit {
+			break
+		}
+		ret = append(ret, item)
+		excess -= item.Size
+	}
+	return ret
+}
+
+// crashStorageItems describes the crash logs of a bug. The logs of the reported crashes
+// and of the latest crash are essential.
+func crashStorageItems(crashes []*Crash, keys []*db.Key) []*storageItem {
+	latest := -1
+	for i, crash := range crashes {
+		if latest == -1 || crash.Time.After(crashes[latest].Time) {
+			latest = i
+		}
+	}
+	var ret []*storageItem
+	for i, crash := range crashes {
+		if crash.Log == 0 {
+			continue
+		}
+		ret = append(ret, &storageItem{
+			Type:      textCrashLog,
+			Size:      crash.LogSize,
+			Created:   crash.Time,
+			Essential: i == latest || !crash.Reported.IsZero(),
+			HasRepro:  crash.ReproSyz != 0 || crash.ReproC != 0,
+			crashKey:  keys[i],
+		})
+	}
+	return ret
+}
+
+func evictNamespaceStorage(c context.Context, ns string, usage *StorageUsage, excess int64) error {
+	query := db.NewQuery("Bug").
+		Filter("Namespace=", ns).
+		Order("LastTime").
+		KeysOnly().
+		Limit(storageEvictionBugs)
+	if usage.EvictionCursor != "" {
+		cursor, err := db.DecodeCursor(usage.EvictionCursor)
+		if err != nil {
+			return fmt.Errorf("failed to decode cursor: %w", err)
+		}
+		query = query.Start(cursor)
+	}
+	var bugKeys []*db.Key
+	iter := query.Run(c)
+	for {
+		key, err := iter.Next(nil)
+		if err == db.Done {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to query bugs: %w", err)
+		}
+		bugKeys = append(bugKeys, key)
+	}
+	// Once all bugs are inspected, start from the oldest ones once again.
+	nextCursor := ""
+	if len(bugKeys) == storageEvictionBugs {
+		cursor, err := iter.Cursor()
+		if err != nil {
+			return fmt.Errorf("failed to get cursor: %w", err)
+		}
+		nextCursor = cursor.String()
+	}
+	var items []*storageItem
+	for _, bugKey := range bugKeys {
+		var crashes []*Crash
+		keys, err := db.NewQuery("Crash").
+			Ancestor(bugKey).
+			GetAll(c, &crashes)
+		if err != nil {
+			return fmt.Errorf("failed to query crashes: %w", err)
+		}
+		items = append(items, crashStorageItems(crashes, keys)...)
+	}
+	freed := int64(0)
+	evicted := selectStorageEvictions(items, excess, storageEvictionLimit)
+	for _, item := range evicted {
+		size, err := evictCrashLog(c, item.crashKey)
+		if err != nil {
+			log.Errorf(c, "failed to evict crash log: %v", err)
+			continue
+		}
+		freed += size
+	}
+	log.Infof(c, "%v: evicted %v crash logs, %v bytes", ns, len(evicted), freed)
+	_, err := updateStorageUsage(c, ns, func(usage *StorageUsage) {
+		usage.add(textCrashLog, 0, freed)
+		usage.EvictionCursor = nextCursor
+	})
+	return err
+}
+
+// evictCrashLog deletes the log of the crash and returns the number of freed bytes.
+func evictCrashLog(c context.Context, crashKey *db.Key) (int64, error) {
+	freed := int64(0)
+	tx := func(c context.Context) error {
+		crash := new(Crash)
+		if err := db.Get(c, crashKey, crash); err != nil {
+			return fmt.Errorf("failed to get crash: %w", err)
+		}
+		if crash.Log == 0 {
+			return nil
+		}
+		if err := db.Delete(c, db.NewKey(c, textCrashLog, "", crash.Log, nil)); err != nil {
+			return fmt.Errorf("failed to delete crash log: %w", err)
+		}
+		freed = crash.LogSize
+		crash.Log = 0
+		crash.LogSize = 0
+		if _, err := db.Put(c, crashKey, crash); err != nil {
+			return fmt.Errorf("failed to put crash: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{XG: true, Attempts: 10}); err != nil {
+		return 0, err
+	}
+	return freed, nil
+}
+
+type uiStoragePage struct {
+	Header     *uiHeader
+	Namespaces []*uiStorageNamespace
+}
+
+type uiStorageNamespace struct {
+	Name    string
+	Quota   string
+	Used    string
+	Over    bool
+	Updated time.Time
+	Types   []*uiStorageType
+}
+
+type uiStorageType struct {
+	Type    string
+	Written string
+	Freed   string
+	Used    string
+}
+
+// handleAdminStorage shows the per-namespace storage usage.
+func handleAdminStorage(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if accessLevel(c, r) != AccessAdmin {
+		return ErrAccess
+	}
+	hdr, err := commonHeader(c, r, w, "")
+	if err != nil {
+		return err
+	}
+	var namespaces []string
+	for ns := range config.Namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	page := &uiStoragePage{Header: hdr}
+	for _, ns := range namespaces {
+		usage, err := loadStorageUsage(c, ns)
+		if err != nil {
+			return err
+		}
+		page.Namespaces = append(page.Namespaces, makeStorageNamespaceUI(usage, config.Namespaces[ns].StorageQuota))
+	}
+	return serveTemplate(w, "storage.html", page)
+}
+
+func makeStorageNamespaceUI(usage *StorageUsage, quota int64) *uiStorageNamespace {
+	ret := &uiStorageNamespace{
+		Name:    usage.Namespace,
+		Used:    formatBytes(usage.used()),
+		Over:    quota != 0 && usage.used() > quota,
+		Updated: usage.Updated,
+	}
+	if quota != 0 {
+		ret.Quota = formatBytes(quota)
+	}
+	for i := range usage.Types {
+		item := &usage.Types[i]
+		ret.Types = append(ret.Types, &uiStorageType{
+			Type:    item.Type,
+			Written: formatBytes(item.Written),
+			Freed:   formatBytes(item.Freed),
+			Used:    formatBytes(item.used()),
+		})
+	}
+	return ret
+}
+
+func formatBytes(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%v B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestSelectStorageEvictions(t *testing.T) {
+	start := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	item := func(name string, days int, size int64, hasRepro, essential bool) *storageItem {
+		return &storageItem{
+			Type:      name,
+			Size:      size,
+			Created:   start.Add(time.Duration(days) * 24 * time.Hour),
+			HasRepro:  hasRepro,
+			Essential: essential,
+		}
+	}
+	items := []*storageItem{
+		item(textCrashLog, 5, 100, true, false),
+		item(textCrashLog, 3, 100, false, false),
+		item(textCrashLog, 1, 100, false, true),
+		item(textCrashLog, 4, 100, false, false),
+		item(textCrashLog, 0, 100, true, false),
+		item(textCrashLog, 2, 0, false, false),
+		item(textReproC, 0, 100, false, false),
+		item("mount_image", 0, 1000, false, false),
+	}
+	days := func(items []*storageItem) []int {
+		var ret []int
+		for _, item := range items {
+			ret = append(ret, int(item.Created.Sub(start)/(24*time.Hour)))
+		}
+		return ret
+	}
+	tests := []struct {
+		excess int64
+		limit  int
+		want   []int
+	}{
+		{0, 10, nil},
+		{1, 10, []int{3}},
+		{150, 10, []int{3, 4}},
+		{250, 10, []int{3, 4, 0}},
+		{250, 2, []int{3, 4}},
+		// Essential logs, empty logs and other types are never evicted.
+		{10000, 10, []int{3, 4, 0, 5}},
+	}
+	for _, test := range tests {
+		got := days(selectStorageEvictions(items, test.excess, test.limit))
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("excess %v, limit %v: %s", test.excess, test.limit, diff)
+		}
+	}
+}
+
+func TestStorageUsage(t *testing.T) {
+	usage := &StorageUsage{}
+	usage.add(textCrashLog, 100, 0)
+	usage.add(textCrashReport, 10, 0)
+	usage.add(textCrashLog, 50, 30)
+	usage.add(textReproC, 0, 20)
+	if got, want := usage.used(), int64(130); got != want {
+		t.Fatalf("used %v, want %v", got, want)
+	}
+	want := []StorageTypeUsage{
+		{textCrashLog, 150, 30},
+		{textCrashReport, 10, 0},
+		{textReproC, 0, 20},
+	}
+	if diff := cmp.Diff(want, usage.Types); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KiB",
+		1536:            "1.5 KiB",
+		5 << 30:         "5.0 GiB",
+		3<<40 + 512<<30: "3.5 TiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("%v: got %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestStorageQuota(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.makeClient(clientAdmin, keyAdmin, true)
+	build := testBuild(1)
+	client.UploadBuild(build)
+	// Incompressible logs of ~2KB each, the quota is 3000 bytes.
+	rnd := rand.New(rand.NewSource(0))
+	for i := 0; i < 3; i++ {
+		crash := testCrash(build, 1)
+		crash.Log = make([]byte, 2000)
+		rnd.Read(crash.Log)
+		client.ReportCrash(crash)
+		c.advanceTime(time.Hour)
+	}
+	_, err := c.GET("/cron/deprecate_assets")
+	c.expectOK(err)
+
+	var crashes []*Crash
+	_, err = db.NewQuery("Crash").Order("Time").GetAll(c.ctx, &crashes)
+	c.expectOK(err)
+	c.expectEQ(len(crashes), 3)
+	// The two oldest logs are evicted, the latest one is kept.
+	c.expectEQ(crashes[0].Log, int64(0))
+	c.expectEQ(crashes[1].Log, int64(0))
+	c.expectNE(crashes[2].Log, int64(0))
+	c.expectTrue(crashes[2].LogSize > 2000)
+
+	usage, err := loadStorageUsage(c.ctx, "access-admin")
+	c.expectOK(err)
+	c.expectTrue(usage.used() < 3000)
+
+	page, err := c.AuthGET(AccessAdmin, "/admin/storage")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("access-admin")))
+	_, err = c.AuthGET(AccessUser, "/admin/storage")
+	c.expectForbidden(err)
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Managers send a machine-readable version of the crash report (see report.Structured),
+// it's served instead of the report text for /text?tag=CrashReport&json=1 requests.
+
+const maxStructuredReportSize = 32 << 10
+
+func encodeStructuredReport(c context.Context, rep *dashapi.StructuredReport) []byte {
+	if rep == nil {
+		return nil
+	}
+	data, err := json.Marshal(rep)
+	if err != nil {
+		log.Errorf(c, "failed to marshal structured report: %v", err)
+		return nil
+	}
+	if len(data) > maxStructuredReportSize {
+		log.Errorf(c, "structured report is too large: %v", len(data))
+		return nil
+	}
+	return data
+}
+
+func serveStructuredReport(w http.ResponseWriter, crash *Crash) error {
+	// Reports of jobs and old crashes have no structured version.
+	if crash == nil || len(crash.ReportElements.Structured) == 0 {
+		return fmt.Errorf("no structured report: %w", ErrClientNotFound)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(crash.ReportElements.Structured)
+	return err
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestStructuredReport(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	crash := testCrash(build, 1)
+	crash.Structured = &dashapi.StructuredReport{
+		Title: crash.Title,
+		Type:  "UNKNOWN",
+		Frames: []dashapi.StackFrame{
+			{Function: "ext4_iget", File: "fs/ext4/inode.c", Line: 4890},
+			{Function: "__ext4_iget", File: "fs/ext4/inode.c", Line: 4700, Inline: true},
+		},
+		Syscalls: []string{"openat", "mount$ext4"},
+	}
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+	_, dbCrash, _ := c.loadBug(rep.ID)
+
+	url := fmt.Sprintf("/text?tag=CrashReport&x=%x", dbCrash.Report)
+	text, err := c.AuthGET(AccessAdmin, url)
+	c.expectOK(err)
+	c.expectEQ(string(text), string(crash.Report))
+
+	data, err := c.AuthGET(AccessAdmin, url+"&json=1")
+	c.expectOK(err)
+	got := new(dashapi.StructuredReport)
+	c.expectOK(json.Unmarshal(data, got))
+	c.expectEQ(got, crash.Structured)
+
+	// Crashes reported by old managers have no structured reports.
+	crash2 := testCrash(build, 2)
+	c.client.ReportCrash(crash2)
+	rep2 := c.client.pollBug()
+	_, dbCrash2, _ := c.loadBug(rep2.ID)
+	_, err = c.AuthGET(AccessAdmin, fmt.Sprintf("/text?tag=CrashReport&x=%x&json=1", dbCrash2.Report))
+	c.expectFailureStatus(err, http.StatusNotFound)
+}
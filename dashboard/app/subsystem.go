@@ -4,9 +4,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"reflect"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/google/syzkaller/pkg/subsystem"
@@ -42,7 +45,11 @@ func reassignBugSubsystems(c context.Context, ns string, count int) error {
 			if err != nil {
 				return fmt.Errorf("failed to infer subsystems: %w", err)
 			}
-			err = updateBugSubsystems(c, bugKey, list, autoInference(rev))
+			cause := subsystemCauseRefresh
+			if bugs[i].SubsystemsRev < rev {
+				cause = subsystemCauseRules
+			}
+			err = updateBugSubsystems(c, bugKey, list, autoInference{rev, cause})
 		}
 		if err != nil {
 			return fmt.Errorf("failed to save subsystems: %w", err)
@@ -98,7 +105,10 @@ func checkOutdatedSubsystems(c context.Context, service *subsystem.Service, bug
 }
 
 type (
-	autoInference  int
+	autoInference struct {
+		rev   int
+		cause subsystemChangeCause
+	}
 	userAssignment string
 	updateRevision int
 )
@@ -106,15 +116,17 @@ type (
 func updateBugSubsystems(c context.Context, bugKey *db.Key,
 	list []*subsystem.Subsystem, info interface{}) error {
 	now := timeNow(c)
+	ns := ""
 	tx := func(c context.Context) error {
 		bug := new(Bug)
 		if err := db.Get(c, bugKey, bug); err != nil {
 			return fmt.Errorf("failed to get bug: %v", err)
 		}
+		ns = bug.Namespace
 		switch v := info.(type) {
 		case autoInference:
 			logSubsystemChange(c, bug, list)
-			bug.SetAutoSubsystems(list, now, int(v))
+			bug.SetAutoSubsystems(list, now, v.rev, v.cause)
 		case userAssignment:
 			bug.SetUserSubsystems(list, now, string(v))
 		case updateRevision:
@@ -124,9 +136,13 @@ func updateBugSubsystems(c context.Context, bugKey *db.Key,
 		if _, err := db.Put(c, bugKey, bug); err != nil {
 			return fmt.Errorf("failed to put bug: %v", err)
 		}
-		return nil
+		return saveBugEvents(c, bugKey, bug)
 	}
-	return db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10})
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return err
+	}
+	invalidateBugLists(c, ns)
+	return nil
 }
 
 func logSubsystemChange(c context.Context, bug *Bug, new []*subsystem.Subsystem) {
@@ -166,9 +182,9 @@ func inferSubsystems(c context.Context, bug *Bug, bugKey *db.Key) ([]*subsystem.
 	crashes := []*subsystem.Crash{}
 	for i, dbCrash := range dbCrashes {
 		crash := &subsystem.Crash{}
-		if len(dbCrash.ReportElements.GuiltyFiles) > 0 {
+		if guiltyFiles := bug.guiltyFiles(dbCrash); len(guiltyFiles) > 0 {
 			// For now we anyway only store one.
-			crash.GuiltyPath = dbCrash.ReportElements.GuiltyFiles[0]
+			crash.GuiltyPath = guiltyFiles[0]
 		}
 		if dbCrash.ReproSyz != 0 {
 			crash.SyzRepro, _, err = getText(c, textReproSyz, dbCrash.ReproSyz)
@@ -182,6 +198,127 @@ func inferSubsystems(c context.Context, bug *Bug, bugKey *db.Key) ([]*subsystem.
 	return service.Extract(crashes), nil
 }
 
+type uiSubsystemChange struct {
+	Time      time.Time
+	Subsystem string
+	Removed   bool
+	Cause     string
+	User      string
+}
+
+func makeSubsystemHistoryUI(bug *Bug, accessLevel AccessLevel) []*uiSubsystemChange {
+	var ret []*uiSubsystemChange
+	for i := len(bug.SubsystemsHistory) - 1; i >= 0; i-- {
+		item := bug.SubsystemsHistory[i]
+		ui := &uiSubsystemChange{
+			Time:      item.Time,
+			Subsystem: item.Subsystem,
+			Removed:   item.Removed,
+			Cause:     string(item.Cause),
+		}
+		if accessLevel >= AccessUser {
+			ui.User = item.User
+		}
+		ret = append(ret, ui)
+	}
+	return ret
+}
+
+// subsystemsDryRun is the result of evaluating the current subsystem rules against a single crash.
+type subsystemsDryRun struct {
+	Namespace  string
+	Revision   int
+	Bug        string
+	GuiltyFile string
+	HasRepro   bool
+	// Matches lists every rule that matches the crash.
+	Matches []subsystemRuleMatch
+	// Inferred are the subsystems that the inference would assign based on this crash alone.
+	Inferred []string
+	// Current are the subsystems the bug has now.
+	Current []string
+}
+
+type subsystemRuleMatch struct {
+	Subsystem     string
+	IncludeRegexp string `json:",omitempty"`
+	ExcludeRegexp string `json:",omitempty"`
+	Syscall       string `json:",omitempty"`
+}
+
+// handleSubsystemsDryRun shows which subsystem rules match the crash with the given report,
+// this allows to validate rule changes before deployment.
+func handleSubsystemsDryRun(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	if accessLevel(c, r) != AccessAdmin {
+		return ErrAccess
+	}
+	id, err := strconv.ParseUint(r.FormValue("x"), 16, 64)
+	if err != nil || id == 0 {
+		return fmt.Errorf("failed to parse report id: %v: %w", err, ErrClientBadRequest)
+	}
+	bug, crash, _, err := checkCrashTextAccess(c, r, "Report", int64(id))
+	if err != nil {
+		return err
+	}
+	res, err := subsystemsDryRunForCrash(c, bug, crash)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(res, "", "\t")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	return err
+}
+
+func subsystemsDryRunForCrash(c context.Context, bug *Bug, dbCrash *Crash) (*subsystemsDryRun, error) {
+	service := getSubsystemService(c, bug.Namespace)
+	if service == nil {
+		return nil, fmt.Errorf("%v has no subsystems: %w", bug.Namespace, ErrClientBadRequest)
+	}
+	crash := &subsystem.Crash{}
+	if guiltyFiles := bug.guiltyFiles(dbCrash); len(guiltyFiles) > 0 {
+		crash.GuiltyPath = guiltyFiles[0]
+	}
+	if dbCrash.ReproSyz != 0 {
+		var err error
+		crash.SyzRepro, _, err = getText(c, textReproSyz, dbCrash.ReproSyz)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load syz repro: %w", err)
+		}
+	}
+	ret := &subsystemsDryRun{
+		Namespace:  bug.Namespace,
+		Revision:   getSubsystemRevision(c, bug.Namespace),
+		Bug:        bug.displayTitle(),
+		GuiltyFile: crash.GuiltyPath,
+		HasRepro:   len(crash.SyzRepro) != 0,
+		Inferred:   []string{},
+		Current:    []string{},
+	}
+	for _, match := range service.MatchRules(crash) {
+		item := subsystemRuleMatch{
+			Subsystem: match.Subsystem.Name,
+			Syscall:   match.Syscall,
+		}
+		if match.PathRule != nil {
+			item.IncludeRegexp = match.PathRule.IncludeRegexp
+			item.ExcludeRegexp = match.PathRule.ExcludeRegexp
+		}
+		ret.Matches = append(ret.Matches, item)
+	}
+	for _, item := range service.Extract([]*subsystem.Crash{crash}) {
+		ret.Inferred = append(ret.Inferred, item.Name)
+	}
+	sort.Strings(ret.Inferred)
+	for _, item := range bug.Tags.Subsystems {
+		ret.Current = append(ret.Current, item.Name)
+	}
+	return ret, nil
+}
+
 // subsystemMaintainers queries the list of emails to send the bug to.
 func subsystemMaintainers(c context.Context, ns, subsystemName string) []string {
 	service := getSubsystemService(c, ns)
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
@@ -111,6 +112,107 @@ func TestOpenBugRevRefresh(t *testing.T) {
 	expectSubsystems(t, client, extID, "first")
 }
 
+func TestSubsystemsHistory(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.client
+	ns := subsystemTestNs
+
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	first := &subsystem.Subsystem{
+		Name:      "first",
+		PathRules: []subsystem.PathRule{{IncludeRegexp: `test\.c`}},
+	}
+	c.setSubsystems(ns, []*subsystem.Subsystem{first}, 1)
+	crash := testCrash(build, 1)
+	crash.GuiltyFiles = []string{"test.c"}
+	client.ReportCrash(crash)
+	rep := client.pollBug()
+	extID := rep.ID
+	expectSubsystems(t, client, extID, "first")
+
+	// The rules change, "second" replaces "first".
+	c.advanceTime(time.Hour)
+	second := &subsystem.Subsystem{
+		Name: "second",
+		PathRules: []subsystem.PathRule{
+			{IncludeRegexp: `test\.c`},
+			{IncludeRegexp: `other\.c`},
+		},
+	}
+	c.setSubsystems(ns, []*subsystem.Subsystem{second}, 2)
+	_, err := c.AuthGET(AccessUser, "/cron/refresh_subsystems")
+	c.expectOK(err)
+	expectSubsystems(t, client, extID, "second")
+
+	bug, dbCrash, _ := c.loadBug(extID)
+	var changes []string
+	for _, item := range bug.SubsystemsHistory {
+		changes = append(changes, fmt.Sprintf("%v %v %v", item.Subsystem, item.Removed, item.Cause))
+	}
+	assert.Equal(t, []string{
+		"first false new crash",
+		"second false rule update",
+		"first true rule update",
+	}, changes)
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+extID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "Subsystem label changes (3)"))
+	c.expectTrue(strings.Contains(string(page), "rule update"))
+
+	url := fmt.Sprintf("/admin/subsystems_dry_run?x=%x", dbCrash.Report)
+	data, err := c.AuthGET(AccessAdmin, url)
+	c.expectOK(err)
+	res := new(subsystemsDryRun)
+	c.expectOK(json.Unmarshal(data, res))
+	assert.Equal(t, &subsystemsDryRun{
+		Namespace:  ns,
+		Revision:   2,
+		Bug:        crash.Title,
+		GuiltyFile: "test.c",
+		Matches: []subsystemRuleMatch{
+			{Subsystem: "second", IncludeRegexp: `test\.c`},
+		},
+		Inferred: []string{"second"},
+		Current:  []string{"second"},
+	}, res)
+
+	_, err = c.AuthGET(AccessUser, url)
+	c.expectTrue(err != nil)
+}
+
+func TestSubsystemsHistoryTrim(t *testing.T) {
+	bug := &Bug{}
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	a := &subsystem.Subsystem{Name: "a"}
+	b := &subsystem.Subsystem{Name: "b"}
+	for i := 0; i < maxSubsystemsHistory; i++ {
+		bug.SetAutoSubsystems([]*subsystem.Subsystem{a}, now, 1, subsystemCauseRules)
+		bug.SetAutoSubsystems(nil, now, 1, subsystemCauseRules)
+	}
+	bug.SetUserSubsystems([]*subsystem.Subsystem{a, b}, now, "user@kernel.org")
+	assert.Len(t, bug.SubsystemsHistory, maxSubsystemsHistory)
+	last := bug.SubsystemsHistory[len(bug.SubsystemsHistory)-2:]
+	assert.Equal(t, []BugSubsystemChange{
+		{Time: now, Subsystem: "a", Cause: subsystemCauseUser, User: "user@kernel.org"},
+		{Time: now, Subsystem: "b", Cause: subsystemCauseUser, User: "user@kernel.org"},
+	}, last)
+
+	// Re-setting the same subsystems does not produce new records.
+	bug.SetAutoSubsystems([]*subsystem.Subsystem{b, a}, now, 2, subsystemCauseRefresh)
+	assert.Equal(t, last, bug.SubsystemsHistory[len(bug.SubsystemsHistory)-2:])
+
+	ui := makeSubsystemHistoryUI(bug, AccessPublic)
+	assert.Equal(t, "b", ui[0].Subsystem)
+	assert.Equal(t, "", ui[0].User)
+	ui = makeSubsystemHistoryUI(bug, AccessUser)
+	assert.Equal(t, "user@kernel.org", ui[0].User)
+}
+
 func TestClosedBugSubsystemRefresh(t *testing.T) {
 	c := NewCtx(t)
 	defer c.Close()
@@ -572,3 +674,45 @@ syzbot engineers can be reached at syzkaller@googlegroups.com.
 	c.expectNE(reply.Sender, secondReply.Sender)
 	c.expectTrue(strings.Contains(secondReply.Body, `7       Yes   WARNING: has repro 6`))
 }
+
+func TestSubsystemReminderAssignee(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.makeClient(clientSubsystemRemind, keySubsystemRemind, true)
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	aFirst := testCrash(build, 1)
+	aFirst.Title = `WARNING: a first`
+	aFirst.GuiltyFiles = []string{"a.c"}
+	client.ReportCrash(aFirst)
+	sender := client.pollEmailBug().Sender
+	c.advanceTime(time.Hour)
+
+	aSecond := testCrash(build, 1)
+	aSecond.Title = `WARNING: a second`
+	aSecond.GuiltyFiles = []string{"a.c"}
+	client.ReportCrash(aSecond)
+	client.pollEmailBug()
+	c.advanceTime(time.Hour)
+
+	c.incomingEmail(sender, "#syz assign\n", EmailOptFrom("dev@kernel.org"))
+	client.pollEmailBug()
+
+	c.advanceTime(time.Hour * 24 * 14)
+	client.ReportCrash(aFirst)
+	client.ReportCrash(aSecond)
+
+	_, err := c.GET("/cron/subsystem_reports")
+	c.expectOK(err)
+	replyA := client.pollEmailBug()
+	c.expectEQ(replyA.Subject, "[moderation] Monthly subsystemA report")
+	c.expectEQ(strings.Contains(replyA.Body, "claimed by dev@kernel.org"), true)
+
+	c.incomingEmail(replyA.Sender, "#syz upstream\n")
+	reply := client.pollEmailBug()
+	c.expectEQ(reply.Subject, "[syzbot] Monthly subsystemA report")
+	c.expectEQ(reply.To, []string{"bugs@syzkaller.com", "dev@kernel.org",
+		"subsystemA@list.com", "subsystemA@person.com"})
+}
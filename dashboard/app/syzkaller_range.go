@@ -0,0 +1,267 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/vcs"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// When a bug stops happening, it's either fixed in the kernel or the fuzzer no longer triggers it
+// (e.g. the descriptions of the involved syscalls were changed). To tell these apart, we remember
+// the range of syzkaller revisions the bug was observed with, and managers report the syscall
+// descriptions of the syzkaller revision they run. For the bugs that are about to be obsoleted
+// the bug page checks whether the reproducer syscalls are still present in the descriptions.
+
+// SyzkallerRange is the range of syzkaller revisions ordered by the commit date.
+type SyzkallerRange struct {
+	First     string
+	FirstDate time.Time
+	Last      string
+	LastDate  time.Time
+}
+
+func (r *SyzkallerRange) add(commit string, date time.Time) {
+	if commit == "" {
+		return
+	}
+	if r.First == "" || date.Before(r.FirstDate) {
+		r.First, r.FirstDate = commit, date
+	}
+	if r.Last == "" || !date.Before(r.LastDate) {
+		r.Last, r.LastDate = commit, date
+	}
+}
+
+func apiManagerDescriptions(c context.Context, ns string, r *http.Request, payload []byte) (interface{}, error) {
+	req := new(dashapi.ManagerDescriptionsReq)
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	if req.Name == "" || req.SyzkallerCommit == "" || len(req.SyzkallerCommit) > MaxStringLen {
+		return nil, fmt.Errorf("bad manager %q or syzkaller commit %q", req.Name, req.SyzkallerCommit)
+	}
+	if len(req.Syscalls) == 0 {
+		return nil, fmt.Errorf("no syscalls")
+	}
+	syscalls := append([]string{}, req.Syscalls...)
+	sort.Strings(syscalls)
+	descHash := hash.String([]byte(strings.Join(syscalls, "\n")))
+	now := timeNow(c)
+	tx := func(c context.Context) error {
+		mgr, err := loadManager(c, ns, req.Name)
+		if err != nil {
+			return err
+		}
+		if mgr.DescriptionsHash == descHash {
+			return nil
+		}
+		mgr.DescriptionsHash = descHash
+		if _, err := db.Put(c, mgr.key(c), mgr); err != nil {
+			return fmt.Errorf("failed to put manager: %w", err)
+		}
+		desc := &ManagerDescriptions{
+			SyzkallerCommit: req.SyzkallerCommit,
+			Time:            now,
+			Syscalls:        syscalls,
+		}
+		descKey := db.NewKey(c, "ManagerDescriptions", req.SyzkallerCommit, 0, mgr.key(c))
+		if _, err := db.Put(c, descKey, desc); err != nil {
+			return fmt.Errorf("failed to put descriptions: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, &db.TransactionOptions{Attempts: 10}); err != nil {
+		return nil, fmt.Errorf("failed to save descriptions: %w", err)
+	}
+	return nil, nil
+}
+
+// loadManagerDescriptions returns the descriptions history of the manager sorted by time.
+func loadManagerDescriptions(c context.Context, ns, name string) ([]*ManagerDescriptions, error) {
+	var history []*ManagerDescriptions
+	_, err := db.NewQuery("ManagerDescriptions").
+		Ancestor(mgrKey(c, ns, name)).
+		GetAll(c, &history)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query manager descriptions: %w", err)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	return history, nil
+}
+
+// reproSyscalls returns the unique syscalls of a syz reproducer in the order of appearance.
+func reproSyscalls(repro []byte) []string {
+	var calls []string
+	dedup := map[string]bool{}
+	for _, line := range bytes.Split(repro, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if pos := bytes.Index(line, []byte(" = ")); pos != -1 {
+			line = line[pos+3:]
+		}
+		end := bytes.IndexByte(line, '(')
+		if end <= 0 {
+			continue
+		}
+		call := string(line[:end])
+		if !dedup[call] {
+			dedup[call] = true
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+type descriptionsChange struct {
+	Syscall string
+	// Commit is the first syzkaller revision without the syscall,
+	// it's empty if the syscall was not present in any of the known revisions.
+	Commit string
+}
+
+// checkReproDescriptions returns the calls that are missing in the latest descriptions
+// of the (time-sorted) history.
+func checkReproDescriptions(calls []string, history []*ManagerDescriptions) []descriptionsChange {
+	if len(history) == 0 {
+		return nil
+	}
+	sets := make([]map[string]bool, len(history))
+	for i, desc := range history {
+		sets[i] = map[string]bool{}
+		for _, call := range desc.Syscalls {
+			sets[i][call] = true
+		}
+	}
+	var ret []descriptionsChange
+	for _, call := range calls {
+		last := len(history) - 1
+		if sets[last][call] {
+			continue
+		}
+		change := descriptionsChange{Syscall: call}
+		for i := last - 1; i >= 0; i-- {
+			if sets[i][call] {
+				change.Commit = history[i+1].SyzkallerCommit
+				break
+			}
+		}
+		ret = append(ret, change)
+	}
+	return ret
+}
+
+// obsoleteCandidate returns true for the bugs that have been obsoleted or will be soon.
+func (bug *Bug) obsoleteCandidate(now time.Time) bool {
+	switch bug.Status {
+	case BugStatusOpen:
+		return len(bug.Commits) == 0 && bug.canBeObsoleted() &&
+			now.Sub(bug.lastCrashTime()) > bug.obsoletePeriod()/2
+	case BugStatusInvalid:
+		return bug.StatusReason == dashapi.InvalidatedByNoActivity ||
+			bug.StatusReason == dashapi.InvalidatedByRevokedRepro
+	}
+	return false
+}
+
+type uiSyzkallerRange struct {
+	First   *uiSyzkallerCommit // nil if it's the same as Last
+	Last    *uiSyzkallerCommit
+	Current []*uiSyzkallerCommit // what the managers of the bug run now
+	Changes []*uiDescriptionsChange
+	// Checked is set if the reproducer syscalls were checked against the descriptions.
+	Checked bool
+}
+
+type uiSyzkallerCommit struct {
+	Hash string
+	Link string
+}
+
+type uiDescriptionsChange struct {
+	Syscall string
+	Commit  *uiSyzkallerCommit
+}
+
+func makeSyzkallerCommitUI(commit string) *uiSyzkallerCommit {
+	return &uiSyzkallerCommit{
+		Hash: commit,
+		Link: vcs.CommitLink(vcs.SyzkallerRepo, commit),
+	}
+}
+
+func loadSyzkallerRangeUI(c context.Context, bug *Bug) (*uiSyzkallerRange, error) {
+	if bug.SyzkallerRange.Last == "" || !bug.obsoleteCandidate(timeNow(c)) {
+		return nil, nil
+	}
+	ret := &uiSyzkallerRange{
+		Last: makeSyzkallerCommitUI(bug.SyzkallerRange.Last),
+	}
+	if bug.SyzkallerRange.First != bug.SyzkallerRange.Last {
+		ret.First = makeSyzkallerCommitUI(bug.SyzkallerRange.First)
+	}
+	current := map[string]bool{}
+	for _, name := range bug.HappenedOn {
+		mgr, err := loadManager(c, bug.Namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if mgr.CurrentBuild == "" {
+			continue
+		}
+		build, err := loadBuild(c, bug.Namespace, mgr.CurrentBuild)
+		if err != nil {
+			return nil, err
+		}
+		if commit := build.SyzkallerCommit; commit != bug.SyzkallerRange.Last && !current[commit] {
+			current[commit] = true
+			ret.Current = append(ret.Current, makeSyzkallerCommitUI(commit))
+		}
+	}
+	if bug.ReproLevel == ReproLevelNone {
+		return ret, nil
+	}
+	crash, _, err := findCrashForBug(c, bug)
+	if err != nil {
+		return nil, err
+	}
+	if crash.ReproSyz == 0 {
+		return ret, nil
+	}
+	repro, _, err := getText(c, textReproSyz, crash.ReproSyz)
+	if err != nil {
+		return nil, err
+	}
+	history, err := loadManagerDescriptions(c, bug.Namespace, crash.Manager)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return ret, nil
+	}
+	ret.Checked = true
+	for _, change := range checkReproDescriptions(reproSyscalls(repro), history) {
+		uiChange := &uiDescriptionsChange{Syscall: change.Syscall}
+		if change.Commit != "" {
+			uiChange.Commit = makeSyzkallerCommitUI(change.Commit)
+		}
+		ret.Changes = append(ret.Changes, uiChange)
+	}
+	return ret, nil
+}
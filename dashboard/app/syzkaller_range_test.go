@@ -0,0 +1,113 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/dashboard/dashapi"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+func TestSyzkallerRangeAdd(t *testing.T) {
+	date := time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC)
+	var r SyzkallerRange
+	r.add("b", date)
+	r.add("a", date.Add(-time.Hour))
+	r.add("c", date.Add(time.Hour))
+	r.add("b", date)
+	r.add("", date.Add(2*time.Hour))
+	if r.First != "a" || r.Last != "c" {
+		t.Errorf("got range %v..%v", r.First, r.Last)
+	}
+}
+
+func TestReproSyscalls(t *testing.T) {
+	repro := []byte(`# {Threaded:false Repeat:true}
+r0 = openat$kvm(0xffffffffffffff9c, &(0x7f0000000000), 0x0, 0x0)
+ioctl$KVM_CREATE_VM(r0, 0xae01, 0x0)
+
+ioctl$KVM_CREATE_VM(r0, 0xae01, 0x1)
+syz_emit_ethernet(0x0, 0x0, 0x0)
+`)
+	want := []string{"openat$kvm", "ioctl$KVM_CREATE_VM", "syz_emit_ethernet"}
+	if diff := cmp.Diff(want, reproSyscalls(repro)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCheckReproDescriptions(t *testing.T) {
+	history := []*ManagerDescriptions{
+		{SyzkallerCommit: "rev1", Syscalls: []string{"open", "ioctl$FOO", "ioctl$BAR"}},
+		{SyzkallerCommit: "rev2", Syscalls: []string{"open", "ioctl$FOO"}},
+		{SyzkallerCommit: "rev3", Syscalls: []string{"open"}},
+	}
+	calls := []string{"open", "ioctl$FOO", "ioctl$BAR", "ioctl$BAZ"}
+	want := []descriptionsChange{
+		{Syscall: "ioctl$FOO", Commit: "rev3"},
+		{Syscall: "ioctl$BAR", Commit: "rev2"},
+		{Syscall: "ioctl$BAZ"},
+	}
+	if diff := cmp.Diff(want, checkReproDescriptions(calls, history)); diff != "" {
+		t.Error(diff)
+	}
+	if changes := checkReproDescriptions(calls, nil); changes != nil {
+		t.Errorf("got changes without descriptions: %v", changes)
+	}
+}
+
+func TestSyzkallerRangeNote(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.expectOK(c.client.UploadManagerDescriptions(&dashapi.ManagerDescriptionsReq{
+		Name:            build.Manager,
+		SyzkallerCommit: build.SyzkallerCommit,
+		Syscalls:        []string{"syncfs", "open"},
+	}))
+	c.client.ReportCrash(testCrashWithRepro(build, 1))
+	rep := c.client.pollBug()
+
+	bug, _, _ := c.loadBug(rep.ID)
+	c.expectEQ(bug.SyzkallerRange.First, build.SyzkallerCommit)
+	c.expectEQ(bug.SyzkallerRange.Last, build.SyzkallerCommit)
+	// The note is only shown for the bugs that stopped happening.
+	page, err := c.AuthGET(AccessAdmin, bugLink(bug.keyHash()))
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(page, []byte("Crashes stopped")))
+
+	build2 := testBuild(2)
+	build2.Manager = build.Manager
+	c.client.UploadBuild(build2)
+	c.expectOK(c.client.UploadManagerDescriptions(&dashapi.ManagerDescriptionsReq{
+		Name:            build.Manager,
+		SyzkallerCommit: build2.SyzkallerCommit,
+		Syscalls:        []string{"open"},
+	}))
+	// The same descriptions don't produce a new revision.
+	c.expectOK(c.client.UploadManagerDescriptions(&dashapi.ManagerDescriptionsReq{
+		Name:            build.Manager,
+		SyzkallerCommit: "syzkaller_commit3",
+		Syscalls:        []string{"open"},
+	}))
+	history, err := loadManagerDescriptions(c.ctx, "test1", build.Manager)
+	c.expectOK(err)
+	c.expectEQ(len(history), 2)
+
+	bug.Status = BugStatusInvalid
+	bug.StatusReason = dashapi.InvalidatedByRevokedRepro
+	_, err = db.Put(c.ctx, bug.key(c.ctx), bug)
+	c.expectOK(err)
+	page, err = c.AuthGET(AccessAdmin, bugLink(bug.keyHash()))
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("Crashes stopped: last crash with syzkaller")))
+	c.expectTrue(bytes.Contains(page, []byte("managers now run")))
+	c.expectTrue(bytes.Contains(page, []byte(`descriptions for <span class="mono">syncfs</span> changed in`)))
+	c.expectTrue(bytes.Contains(page, []byte("/commit/"+build2.SyzkallerCommit)))
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Crashes on already tainted kernels (e.g. after an earlier WARNING, or with an out-of-tree module)
+// are less trustworthy. The taint flags are parsed from the report when a crash is saved (Crash.Taint)
+// and are shown next to the crash title. Bug.NumTaintedCrashes counts the crashes that happened
+// on tainted kernels, it's maintained together with NumCrashes, so the bugs that were only seen
+// on tainted kernels can be filtered out of the bug lists (userBugFilter.NoTainted).
+// The counter is only maintained since the flags are parsed, the older crashes are considered untainted.
+
+var taintFlagNames = map[rune]string{
+	'P': "proprietary module",
+	'F': "force-loaded module",
+	'S': "out-of-spec system",
+	'R': "force-unloaded module",
+	'M': "machine check",
+	'B': "bad page",
+	'U': "taint requested by user",
+	'D': "died recently",
+	'A': "ACPI table overridden",
+	'W': "warning",
+	'C': "staging driver",
+	'I': "firmware bug workaround",
+	'O': "out-of-tree module",
+	'E': "unsigned module",
+	'L': "soft lockup",
+	'K': "live patched",
+	'X': "auxiliary",
+	'T': "struct randomization",
+	'N': "in-kernel test",
+}
+
+// onlyTainted returns whether all known crashes of the bug happened on tainted kernels.
+func (bug *Bug) onlyTainted() bool {
+	return bug.NumTaintedCrashes > 0 && bug.NumTaintedCrashes >= bug.NumCrashes
+}
+
+// describeTaint returns a human-readable description of the taint flags (e.g. "W: warning").
+func describeTaint(flags string) string {
+	var descr []string
+	for _, flag := range flags {
+		name := taintFlagNames[flag]
+		if name == "" {
+			name = "unknown"
+		}
+		descr = append(descr, fmt.Sprintf("%c: %v", flag, name))
+	}
+	return strings.Join(descr, ", ")
+}
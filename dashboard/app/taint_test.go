@@ -0,0 +1,70 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestDescribeTaint(t *testing.T) {
+	c := func(flags, descr string) {
+		if got := describeTaint(flags); got != descr {
+			t.Errorf("%q: got %q, want %q", flags, got, descr)
+		}
+	}
+	c("", "")
+	c("W", "W: warning")
+	c("BO", "B: bad page, O: out-of-tree module")
+	c("Z", "Z: unknown")
+}
+
+func TestTaintedCrashes(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	tainted := "CPU: 0 PID: 1 Comm: syz-executor Tainted: G        W  O      6.3.0-syzkaller #0\n"
+	untainted := "CPU: 0 PID: 1 Comm: syz-executor Not tainted 6.3.0-syzkaller #0\n"
+
+	crash1 := testCrash(build, 1)
+	crash1.Report = []byte(tainted)
+	c.client.ReportCrash(crash1)
+	_, extBugID1, err := email.RemoveAddrContext(c.pollEmailBug().Sender)
+	c.expectOK(err)
+	crash2 := testCrash(build, 2)
+	crash2.Report = []byte(untainted)
+	c.client.ReportCrash(crash2)
+	_, extBugID2, err := email.RemoveAddrContext(c.pollEmailBug().Sender)
+	c.expectOK(err)
+	crash2.Report = []byte(tainted)
+	c.client.ReportCrash(crash2)
+
+	bug1, dbCrash1, _ := c.loadBug(extBugID1)
+	c.expectEQ(dbCrash1.Taint, "WO")
+	c.expectEQ(bug1.NumTaintedCrashes, int64(1))
+	c.expectTrue(bug1.onlyTainted())
+	bug2, _, _ := c.loadBug(extBugID2)
+	c.expectEQ(bug2.NumCrashes, int64(2))
+	c.expectEQ(bug2.NumTaintedCrashes, int64(1))
+	c.expectTrue(!bug2.onlyTainted())
+
+	page, err := c.AuthGET(AccessAdmin, "/test1")
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), crash1.Title))
+	c.expectTrue(strings.Contains(string(page), "no_tainted=1"))
+	page, err = c.AuthGET(AccessAdmin, "/test1?no_tainted=1")
+	c.expectOK(err)
+	c.expectTrue(!strings.Contains(string(page), crash1.Title))
+	c.expectTrue(strings.Contains(string(page), crash2.Title))
+	c.expectTrue(strings.Contains(string(page), "NoTainted=true"))
+
+	page, err = c.AuthGET(AccessAdmin, "/bug?extid="+extBugID1)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "[tainted: WO]"))
+	c.expectTrue(strings.Contains(string(page), "W: warning, O: out-of-tree module"))
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// Trees that patches commonly target, in addition to the aliases of the configured repos.
+var commonKernelTrees = []string{
+	"net", "net-next", "bpf", "bpf-next", "linux-next",
+	"mm-unstable", "mm-stable", "mm-hotfixes-unstable", "mm-hotfixes-stable", "mm-nonmm-unstable",
+	"tip", "rcu", "kvm", "vfs", "block", "sound", "char-misc", "usb-next", "usb-linus",
+}
+
+// treeHints recognizes mentions of kernel trees in patch messages.
+type treeHints struct {
+	trees map[string]bool
+	// lists maps mailing lists to the tree that their patches usually target.
+	lists  map[string]string
+	phrase *regexp.Regexp
+}
+
+func newTreeHints(trees []string, lists map[string]string) *treeHints {
+	h := &treeHints{
+		trees: map[string]bool{},
+		lists: map[string]string{},
+	}
+	var names []string
+	for _, tree := range trees {
+		tree = strings.ToLower(tree)
+		if tree == "" || h.trees[tree] {
+			continue
+		}
+		h.trees[tree] = true
+		names = append(names, regexp.QuoteMeta(tree))
+	}
+	for list, tree := range lists {
+		h.lists[email.CanonicalEmail(list)] = strings.ToLower(tree)
+	}
+	// Longer names go first, so that "net-next" is not recognized as "net".
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	if len(names) != 0 {
+		h.phrase = regexp.MustCompile(`(?:^|[^\w-])(applies|applied|apply|based|rebased|targets|targeting|` +
+			`against|on top of|for)\s+(?:(?:to|on|against|on top of)\s+)?(?:the\s+)?(` +
+			strings.Join(names, "|") + `)(?:[^\w-]|$)(\s*(?:tree|branch))?`)
+	}
+	return h
+}
+
+var (
+	subjectTagsRe = regexp.MustCompile(`\[([^\]]*)\]`)
+	baseCommitRe  = regexp.MustCompile(`^base-commit:\s*(\S+)`)
+)
+
+// extract returns the tree that the patch message targets or an empty string.
+// In the order of preference, it looks at the subject tags (e.g. "[PATCH net-next v2]"),
+// the base-commit trailer, phrases like "applies to mm-unstable" and the mailing lists
+// the message was sent to.
+func (h *treeHints) extract(subject, body string, lists []string) string {
+	for _, tags := range subjectTagsRe.FindAllStringSubmatch(subject, -1) {
+		for _, tag := range strings.FieldsFunc(strings.ToLower(tags[1]), func(r rune) bool {
+			return r == ' ' || r == ',' || r == '\t'
+		}) {
+			if h.trees[tag] {
+				return tag
+			}
+		}
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.ToLower(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ">") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for _, line := range lines {
+		match := baseCommitRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		// Usually it's just a commit hash, but some people refer to the branch.
+		tree, _, _ := strings.Cut(match[1], "/")
+		if h.trees[tree] {
+			return tree
+		}
+	}
+	if h.phrase != nil {
+		for _, line := range lines {
+			for _, match := range h.phrase.FindAllStringSubmatch(line, -1) {
+				// "for" is too common to be followed by a tree name just by chance
+				// unless the name is distinctive enough or explicitly called a tree.
+				if match[1] == "for" && !strings.Contains(match[2], "-") && match[3] == "" {
+					continue
+				}
+				return match[2]
+			}
+		}
+	}
+	for _, list := range lists {
+		if tree := h.lists[email.CanonicalEmail(list)]; tree != "" {
+			return tree
+		}
+	}
+	return ""
+}
+
+// guessTargetTree looks for tree hints in a discussion update that came without one.
+// Only the subject and message excerpts are available there.
+func guessTargetTree(update *dashapi.Discussion) string {
+	var excerpts []string
+	for _, m := range update.Messages {
+		excerpts = append(excerpts, m.Excerpt)
+	}
+	return kernelTreeHints().extract(update.Subject, strings.Join(excerpts, "\n"), nil)
+}
+
+// Only patch discussions active within this period are considered for commit poll hints.
+const targetTreePeriod = 30 * 24 * time.Hour
+
+// recentTargetTrees counts the target trees of the recently active patch discussions.
+func recentTargetTrees(c context.Context) (map[string]int, error) {
+	var discussions []*Discussion
+	_, err := db.NewQuery("Discussion").
+		Filter("Type=", dashapi.DiscussionPatch).
+		Filter("Summary.LastMessage>", timeNow(c).Add(-targetTreePeriod)).
+		Project("TargetTree").
+		GetAll(c, &discussions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query discussions: %w", err)
+	}
+	ret := map[string]int{}
+	for _, d := range discussions {
+		if d.TargetTree != "" {
+			ret[d.TargetTree]++
+		}
+	}
+	return ret, nil
+}
+
+var (
+	kernelTreeHintsOnce sync.Once
+	kernelTreeHintsVal  *treeHints
+)
+
+// kernelTreeHints returns the hints for the installed config.
+func kernelTreeHints() *treeHints {
+	kernelTreeHintsOnce.Do(func() {
+		kernelTreeHintsVal = configTreeHints()
+	})
+	return kernelTreeHintsVal
+}
+
+// configTreeHints recognizes the common trees and the aliases of all configured repos.
+func configTreeHints() *treeHints {
+	trees := append([]string{}, commonKernelTrees...)
+	listTrees := map[string][]string{}
+	for _, ns := range config.Namespaces {
+		for _, repo := range ns.Repos {
+			if repo.Alias == "" {
+				continue
+			}
+			trees = append(trees, repo.Alias)
+			for _, list := range repo.PatchLists {
+				list = email.CanonicalEmail(list)
+				listTrees[list] = append(listTrees[list], strings.ToLower(repo.Alias))
+			}
+		}
+	}
+	lists := map[string]string{}
+	for list, aliases := range listTrees {
+		// Several trees may accept patches via the same list, then the list tells nothing.
+		if aliases = unique(aliases); len(aliases) == 1 {
+			lists[list] = aliases[0]
+		}
+	}
+	return newTreeHints(trees, lists)
+}
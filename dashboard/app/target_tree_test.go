@@ -0,0 +1,186 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestTreeHints(t *testing.T) {
+	hints := newTreeHints(append([]string{"upstream"}, commonKernelTrees...), map[string]string{
+		"linux-mm@kvack.org": "MM-Unstable",
+	})
+	tests := []struct {
+		name    string
+		subject string
+		body    string
+		lists   []string
+		tree    string
+	}{
+		{
+			name:    "subject tag",
+			subject: "[PATCH net-next v2 1/3] net: sched: fix use-after-free in tc_new_tfilter",
+			tree:    "net-next",
+		},
+		{
+			name:    "subject short tag",
+			subject: "Re: [PATCH net] ipv6: fix a null-ptr-deref in rt6_uncached_list_flush_dev",
+			tree:    "net",
+		},
+		{
+			name:    "subject tag with comma",
+			subject: "[PATCH bpf-next,v3] bpf: check the map key size",
+			tree:    "bpf-next",
+		},
+		{
+			name:    "subject without tree",
+			subject: "[PATCH v3 2/2] ext4: fix the crash",
+			body:    "Reported-by: syzbot+1234@syzkaller.appspotmail.com\n",
+			tree:    "",
+		},
+		{
+			name:    "rfc subject",
+			subject: "[RFC PATCH] mm: fix the crash",
+			body:    "This is for review only.\n",
+			tree:    "",
+		},
+		{
+			name:    "applies to",
+			subject: "[PATCH] mm/khugepaged: fix the crash",
+			body:    "Hi Andrew,\n\nThe patch applies to mm-unstable.\n",
+			tree:    "mm-unstable",
+		},
+		{
+			name:    "based on",
+			subject: "[PATCH v2] fs: fix the crash",
+			body:    "Changes in v2:\n - Rebased on top of linux-next.\n",
+			tree:    "linux-next",
+		},
+		{
+			name:    "for tree",
+			subject: "[PATCH] kvm: x86: fix the warning",
+			body:    "Paolo, this is a fix for the kvm tree.\n",
+			tree:    "kvm",
+		},
+		{
+			name:    "queue for",
+			subject: "Re: [PATCH] mm: fix the crash",
+			body:    "Thanks, I'll queue this for mm-hotfixes-unstable.\n",
+			tree:    "mm-hotfixes-unstable",
+		},
+		{
+			name:    "ambiguous for",
+			subject: "[PATCH] block: fix the crash",
+			body:    "This is needed for block devices with zero size.\n",
+			tree:    "",
+		},
+		{
+			name:    "quoted",
+			subject: "Re: [PATCH] mm: fix the crash",
+			body:    "> This applies to mm-unstable.\n\nLooks good.\n",
+			tree:    "",
+		},
+		{
+			name:    "not a tree suffix",
+			subject: "[PATCH] net: fix the crash",
+			body:    "This applies to net-foo.\nIt's based on net.\n",
+			tree:    "net",
+		},
+		{
+			name:    "base-commit hash",
+			subject: "[PATCH] fs: fix the crash",
+			body:    "---\nbase-commit: 0123456789abcdef0123456789abcdef01234567\n",
+			tree:    "",
+		},
+		{
+			name:    "base-commit branch",
+			subject: "[PATCH] fs: fix the crash",
+			body:    "---\nbase-commit: linux-next/master\n",
+			tree:    "linux-next",
+		},
+		{
+			name:    "list",
+			subject: "[PATCH] mm: fix the crash",
+			lists:   []string{"linux-kernel@vger.kernel.org", "Linux MM <Linux-MM@kvack.org>"},
+			tree:    "mm-unstable",
+		},
+		{
+			name:    "subject over list",
+			subject: "[PATCH mm-stable] mm: fix the crash",
+			lists:   []string{"linux-mm@kvack.org"},
+			tree:    "mm-stable",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if tree := hints.extract(test.subject, test.body, test.lists); tree != test.tree {
+				t.Fatalf("got %q, want %q", tree, test.tree)
+			}
+		})
+	}
+}
+
+func TestDiscussionTargetTree(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	client.ReportCrash(testCrash(build, 1))
+	extBugID := c.pollEmailExtID()
+
+	thread := c.incomingThread("[PATCH net-next v2] net: fix the crash", extBugID)
+	thread.reply("dev@kernel.org", "The fix.")
+	// Later hints do not override the first one.
+	thread.reply("maintainer@kernel.org", "This is rather for net.")
+	_, bugKey, err := findBugByReportingID(c.ctx, extBugID)
+	c.expectOK(err)
+	discussions, err := discussionsForBug(c.ctx, bugKey)
+	c.expectOK(err)
+	c.expectEQ(len(discussions), 1)
+	c.expectEQ(discussions[0].TargetTree, "net-next")
+	page, err := c.AuthGET(AccessPublic, "/bug?extid="+extBugID)
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("<td>net-next</td>")))
+
+	// The namespace has no net-next repo.
+	resp, err := client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(len(resp.HintedRepos), 0)
+}
+
+func TestCommitPollHintedRepos(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	rep := c.client.pollBug()
+
+	resp, err := c.client.CommitPoll()
+	c.expectOK(err)
+	c.expectEQ(len(resp.HintedRepos), 0)
+
+	c.expectOK(c.client.ReportDiscussion(&dashapi.Discussion{
+		ID:      "<patch@kernel.org>",
+		Source:  dashapi.DiscussionLore,
+		Type:    dashapi.DiscussionPatch,
+		Subject: "[PATCH repo10alias] foo: fix the crash",
+		BugIDs:  []string{rep.ID},
+		Messages: []dashapi.DiscussionMessage{
+			{ID: "<patch@kernel.org>", External: true, Time: timeNow(c.ctx)},
+		},
+	}))
+	resp, err = c.client.CommitPoll()
+	c.expectOK(err)
+	// The main repo is always polled first, so it's never among the hints.
+	repo := testConfig.Namespaces["test1"].Repos[1]
+	c.expectEQ(resp.HintedRepos, []dashapi.Repo{{URL: repo.URL, Branch: repo.Branch}})
+}
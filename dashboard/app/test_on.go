@@ -0,0 +1,146 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Some crashes reproduce only on a specific instance type, while patch testing jobs are normally
+// executed by the manager that found the crash. "#syz test-on <manager|arch> [repo branch]" restricts
+// the job to the given manager or to the managers of the given arch (Job.TestOn/TestOnManagers).
+// The job is tested on the latest build of the manager that claims it, and the result email
+// mentions that manager. If none of the managers polls for jobs for testOnTimeout,
+// the job is finished with an error, which is reported like any other job result.
+
+const testOnTimeout = 24 * time.Hour
+
+// testOnManagers returns the active managers of the namespace that satisfy the test-on constraint,
+// the most recently alive ones first.
+func testOnManagers(c context.Context, ns, target string) ([]string, error) {
+	managers, _, err := loadAllManagers(c, ns)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*Manager
+	for _, mgr := range managers {
+		if mgr.Name != target {
+			if mgr.CurrentBuild == "" {
+				continue
+			}
+			build, err := loadBuild(c, ns, mgr.CurrentBuild)
+			if err != nil {
+				return nil, err
+			}
+			if build.Arch != target {
+				continue
+			}
+		}
+		ret = append(ret, mgr)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].LastAlive.After(ret[j].LastAlive)
+	})
+	var names []string
+	for _, mgr := range ret {
+		names = append(names, mgr.Name)
+	}
+	return names, nil
+}
+
+// pickTestOnManager returns the first of the job managers that can test patches,
+// or an empty string if none of them polls for jobs.
+func pickTestOnManager(job *Job, managers map[string]dashapi.ManagerJobs) string {
+	for _, name := range job.TestOnManagers {
+		if managers[name].TestPatches {
+			return name
+		}
+	}
+	return ""
+}
+
+func handleTestOnTimeouts(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	if err := finishStuckTestOnJobs(c); err != nil {
+		log.Errorf(c, "failed to finish test-on jobs: %v", err)
+	}
+}
+
+func finishStuckTestOnJobs(c context.Context) error {
+	var jobs []*Job
+	keys, err := db.NewQuery("Job").
+		Filter("Finished=", time.Time{}).
+		Filter("IsRunning=", false).
+		GetAll(c, &jobs)
+	if err != nil {
+		return fmt.Errorf("failed to query jobs: %w", err)
+	}
+	now := timeNow(c)
+	for i, job := range jobs {
+		if job.TestOn == "" {
+			continue
+		}
+		lastAlive := job.Created
+		for _, name := range job.TestOnManagers {
+			mgr, err := loadManager(c, job.Namespace, name)
+			if err != nil {
+				return err
+			}
+			if mgr.LastAlive.After(lastAlive) {
+				lastAlive = mgr.LastAlive
+			}
+		}
+		if now.Sub(lastAlive) < testOnTimeout {
+			continue
+		}
+		if err := finishTestOnJob(c, job, keys[i], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func finishTestOnJob(c context.Context, job *Job, jobKey *db.Key, now time.Time) error {
+	build, err := lastManagerBuild(c, job.Namespace, job.Manager)
+	if err != nil {
+		return err
+	}
+	errorText := fmt.Sprintf("The job was waiting for %v, but %v has been offline for more than %v.",
+		job.TestOn, job.Manager, testOnTimeout)
+	errorID, err := putText(c, job.Namespace, textError, []byte(errorText), false)
+	if err != nil {
+		return err
+	}
+	tx := func(c context.Context) error {
+		job := new(Job)
+		if err := db.Get(c, jobKey, job); err != nil {
+			return fmt.Errorf("failed to get job: %w", err)
+		}
+		if !job.Finished.IsZero() || job.IsRunning {
+			return nil
+		}
+		job.Finished = now
+		job.BuildID = build.ID
+		job.Error = errorID
+		job.TestOnTimedOut = true
+		if _, err := db.Put(c, jobKey, job); err != nil {
+			return fmt.Errorf("failed to put job: %w", err)
+		}
+		return nil
+	}
+	if err := db.RunInTransaction(c, tx, nil); err != nil {
+		return err
+	}
+	log.Infof(c, "job %v: %v", extJobID(jobKey), errorText)
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+func TestPickTestOnManager(t *testing.T) {
+	job := &Job{TestOnManagers: []string{"arm1", "arm2"}}
+	tests := []struct {
+		managers map[string]dashapi.ManagerJobs
+		picked   string
+	}{
+		{map[string]dashapi.ManagerJobs{"amd": {TestPatches: true}}, ""},
+		{map[string]dashapi.ManagerJobs{"arm1": {BisectCause: true}}, ""},
+		{map[string]dashapi.ManagerJobs{"arm2": {TestPatches: true}}, "arm2"},
+		{map[string]dashapi.ManagerJobs{"arm1": {TestPatches: true}, "arm2": {TestPatches: true}}, "arm1"},
+	}
+	for i, test := range tests {
+		if got := pickTestOnManager(job, test.managers); got != test.picked {
+			t.Errorf("test #%v: got %q, want %q", i, got, test.picked)
+		}
+	}
+}
+
+func TestTestOnJob(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+	build := testBuild(1)
+	client.UploadBuild(build)
+	armBuild := testBuild(2)
+	armBuild.Arch = targets.ARM64
+	client.UploadBuild(armBuild)
+
+	crash := testCrash(build, 1)
+	crash.ReproSyz = []byte("repro syz")
+	client.ReportCrash(crash)
+	client.pollAndFailBisectJob(build.Manager)
+	sender := c.pollEmailBug().Sender
+
+	c.incomingEmail(sender, "#syz test-on riscv64 git://mygit.com/git.git master\n", EmailOptMessageID(1))
+	reply := c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, `"riscv64" is neither a manager nor an arch`))
+	c.incomingEmail(sender, "#syz test-on arm64 git://mygit.com/git.git\n", EmailOptMessageID(2))
+	reply = c.pollEmailBug()
+	c.expectTrue(strings.Contains(reply.Body, "want a manager or an arch and optionally 2 args"))
+
+	// The job is held for the arm64 manager.
+	c.incomingEmail(sender, "#syz test-on arm64 git://mygit.com/git.git master\n", EmailOptMessageID(3))
+	c.expectNoEmail()
+	pollResp := client.pollJobs(build.Manager)
+	c.expectEQ(pollResp.ID, "")
+	pollResp = client.pollJobs(armBuild.Manager)
+	c.expectNE(pollResp.ID, "")
+	c.expectEQ(pollResp.Type, dashapi.JobTestPatch)
+	c.expectEQ(pollResp.Manager, armBuild.Manager)
+	c.expectEQ(pollResp.KernelConfig, armBuild.KernelConfig)
+	c.expectEQ(pollResp.KernelRepo, "git://mygit.com/git.git")
+	testBuild := testBuild(3)
+	testBuild.Manager = armBuild.Manager
+	client.JobDone(&dashapi.JobDoneReq{
+		ID:    pollResp.ID,
+		Build: *testBuild,
+	})
+	msg := c.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Body, "did not trigger any issue"))
+	c.expectTrue(strings.Contains(msg.Body, "manager:        "+armBuild.Manager+"\n"))
+
+	// Nobody takes the job, so it times out.
+	c.incomingEmail(sender, "#syz test-on "+armBuild.Manager+"\n", EmailOptMessageID(4))
+	c.expectNoEmail()
+	c.advanceTime(testOnTimeout - time.Hour)
+	_, err := c.GET("/cron/test_on_timeouts")
+	c.expectOK(err)
+	c.expectNoEmail()
+	c.advanceTime(2 * time.Hour)
+	_, err = c.GET("/cron/test_on_timeouts")
+	c.expectOK(err)
+	msg = c.pollEmailBug()
+	c.expectTrue(strings.Contains(msg.Body, "syzbot could not test the proposed patch"))
+	c.expectTrue(strings.Contains(msg.Body, "has been offline for more than 24h0m0s"))
+	pollResp = client.pollJobs(armBuild.Manager)
+	c.expectEQ(pollResp.ID, "")
+}
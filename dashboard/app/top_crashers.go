@@ -0,0 +1,328 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/v2"
+	db "google.golang.org/appengine/v2/datastore"
+	"google.golang.org/appengine/v2/log"
+)
+
+// Every week we take a snapshot of the most frequently crashing open bugs of each namespace.
+// The ranking is based on the per-bug daily crash counters (Bug.DailyStats), so it does not need
+// to scan Crash entities. The /top_crashers page shows the ranking and its movement vs the previous week.
+
+const (
+	topCrashersCount     = 20
+	topCrashersPeriod    = 7 * 24 * time.Hour
+	topCrashersRetention = 365 * 24 * time.Hour
+)
+
+func topCrashersKey(c context.Context, ns string, date int) *db.Key {
+	return db.NewKey(c, "TopCrashersSnapshot", fmt.Sprintf("%v-%v", ns, date), 0, nil)
+}
+
+func handleTopCrashersSnapshots(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	now := timeNow(c)
+	for ns, cfg := range config.Namespaces {
+		if cfg.Decommissioned {
+			continue
+		}
+		if err := takeTopCrashersSnapshot(c, ns, now); err != nil {
+			log.Errorf(c, "failed to take top crashers snapshot in %v: %v", ns, err)
+		}
+	}
+	if err := purgeTopCrashersSnapshots(c, now.Add(-topCrashersRetention)); err != nil {
+		log.Errorf(c, "%v", err)
+	}
+}
+
+func takeTopCrashersSnapshot(c context.Context, ns string, now time.Time) error {
+	date := timeDate(now)
+	key := topCrashersKey(c, ns, date)
+	if err := db.Get(c, key, new(TopCrashersSnapshot)); err == nil {
+		return nil
+	} else if err != db.ErrNoSuchEntity {
+		return fmt.Errorf("failed to get the snapshot: %w", err)
+	}
+	bugs, _, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("Status=", BugStatusOpen)
+	})
+	if err != nil {
+		return err
+	}
+	snapshot := &TopCrashersSnapshot{
+		Namespace: ns,
+		Date:      date,
+		Entries:   rankTopCrashers(bugs, dateTime(date)),
+	}
+	if _, err := db.Put(c, key, snapshot); err != nil {
+		return fmt.Errorf("failed to save the snapshot: %w", err)
+	}
+	return nil
+}
+
+// rankTopCrashers returns the bugs with the most crashes during the week preceding the day start.
+func rankTopCrashers(bugs []*Bug, dayStart time.Time) []TopCrasher {
+	var ret []TopCrasher
+	for _, bug := range bugs {
+		crashes := weeklyCrashes(bug, dayStart)
+		if crashes == 0 {
+			continue
+		}
+		ret = append(ret, TopCrasher{
+			BugID:   bug.keyHash(),
+			Title:   bug.displayTitle(),
+			Crashes: crashes,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Crashes != ret[j].Crashes {
+			return ret[i].Crashes > ret[j].Crashes
+		}
+		return ret[i].Title < ret[j].Title
+	})
+	if len(ret) > topCrashersCount {
+		ret = ret[:topCrashersCount]
+	}
+	return ret
+}
+
+// weeklyCrashes returns the number of crashes of the bug during the week preceding the day start.
+func weeklyCrashes(bug *Bug, dayStart time.Time) int64 {
+	crashes := int64(0)
+	for _, stats := range bug.dailyStatsTail(dayStart.Add(-topCrashersPeriod)) {
+		if stats.Date < timeDate(dayStart) {
+			crashes += int64(stats.CrashCount)
+		}
+	}
+	return crashes
+}
+
+func purgeTopCrashersSnapshots(c context.Context, before time.Time) error {
+	keys, err := db.NewQuery("TopCrashersSnapshot").
+		Filter("Date<", timeDate(before)).
+		KeysOnly().
+		GetAll(c, nil)
+	if err != nil {
+		return fmt.Errorf("failed to query old snapshots: %w", err)
+	}
+	if err := db.DeleteMulti(c, keys); err != nil {
+		return fmt.Errorf("failed to delete old snapshots: %w", err)
+	}
+	return nil
+}
+
+type uiTopCrashersPage struct {
+	Header    *uiHeader
+	Now       time.Time
+	Date      time.Time
+	PrevDate  time.Time
+	Crashers  []*uiTopCrasher
+	Snapshots []*uiTopCrashersSnapshot
+	CSVLink   string
+}
+
+type uiTopCrasher struct {
+	Rank int
+	// Movement is the change of the rank since the previous week, positive values mean going up.
+	Movement       int
+	New            bool
+	Arrow          string // e.g. "▲3"
+	Title          string
+	Link           string
+	Crashes        int64
+	PrevCrashes    int64
+	FirstTime      time.Time
+	ReproLevel     dashapi.ReproLevel
+	LastDiscussion time.Time
+	bugID          string
+}
+
+type uiTopCrashersSnapshot struct {
+	Date     time.Time
+	Link     string
+	Selected bool
+}
+
+func handleTopCrashers(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns := r.FormValue("ns")
+	if ns == "" {
+		ns = config.DefaultNamespace
+	}
+	hdr, err := commonHeader(c, r, w, ns)
+	if err != nil {
+		return err
+	}
+	snapshots, err := loadTopCrashersSnapshots(c, hdr.Namespace)
+	if err != nil {
+		return err
+	}
+	page := &uiTopCrashersPage{
+		Header: hdr,
+		Now:    timeNow(c),
+	}
+	if len(snapshots) != 0 {
+		pos := len(snapshots) - 1
+		if date := r.FormValue("date"); date != "" {
+			for pos = len(snapshots) - 1; pos >= 0; pos-- {
+				if strconv.Itoa(snapshots[pos].Date) == date {
+					break
+				}
+			}
+			if pos < 0 {
+				return fmt.Errorf("%w: no snapshot for %v", ErrClientNotFound, date)
+			}
+		}
+		var prev *TopCrashersSnapshot
+		if pos > 0 {
+			prev = snapshots[pos-1]
+			page.PrevDate = dateTime(prev.Date)
+		}
+		cur := snapshots[pos]
+		page.Date = dateTime(cur.Date)
+		page.CSVLink = fmt.Sprintf("/top_crashers?ns=%v&date=%v&format=csv", hdr.Namespace, cur.Date)
+		page.Crashers, err = loadTopCrashersUI(c, namespaceAccessLevel(c, r, hdr.Namespace),
+			makeTopCrashersUI(cur, prev), page.Date)
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			page.Snapshots = append(page.Snapshots, &uiTopCrashersSnapshot{
+				Date:     dateTime(snapshot.Date),
+				Link:     fmt.Sprintf("/top_crashers?ns=%v&date=%v", hdr.Namespace, snapshot.Date),
+				Selected: snapshot == cur,
+			})
+		}
+	}
+	if r.FormValue("format") == "csv" {
+		return writeTopCrashersCSV(c, w, page)
+	}
+	return serveTemplate(w, "top_crashers.html", page)
+}
+
+// loadTopCrashersSnapshots returns the snapshots of the namespace sorted by date.
+func loadTopCrashersSnapshots(c context.Context, ns string) ([]*TopCrashersSnapshot, error) {
+	var snapshots []*TopCrashersSnapshot
+	_, err := db.NewQuery("TopCrashersSnapshot").
+		Filter("Namespace=", ns).
+		GetAll(c, &snapshots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top crashers snapshots: %w", err)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Date < snapshots[j].Date
+	})
+	return snapshots, nil
+}
+
+// makeTopCrashersUI computes the movement of the ranking since the previous snapshot (if any).
+func makeTopCrashersUI(cur, prev *TopCrashersSnapshot) []*uiTopCrasher {
+	prevRanks := map[string]int{}
+	if prev != nil {
+		for i, entry := range prev.Entries {
+			prevRanks[entry.BugID] = i + 1
+		}
+	}
+	var ret []*uiTopCrasher
+	for i, entry := range cur.Entries {
+		crasher := &uiTopCrasher{
+			Rank:    i + 1,
+			Title:   entry.Title,
+			Link:    bugLink(entry.BugID),
+			Crashes: entry.Crashes,
+			bugID:   entry.BugID,
+		}
+		if prevRank, ok := prevRanks[entry.BugID]; ok {
+			crasher.Movement = prevRank - crasher.Rank
+		} else {
+			crasher.New = prev != nil
+		}
+		switch {
+		case crasher.New:
+			crasher.Arrow = "new"
+		case crasher.Movement > 0:
+			crasher.Arrow = fmt.Sprintf("▲%v", crasher.Movement)
+		case crasher.Movement < 0:
+			crasher.Arrow = fmt.Sprintf("▼%v", -crasher.Movement)
+		}
+		ret = append(ret, crasher)
+	}
+	return ret
+}
+
+// loadTopCrashersUI fills in the current state of the ranked bugs and drops the inaccessible ones.
+// The crashes of the previous week are taken from the bug counters since the bug might have not been
+// in the previous top.
+func loadTopCrashersUI(c context.Context, accessLevel AccessLevel, crashers []*uiTopCrasher,
+	dayStart time.Time) ([]*uiTopCrasher, error) {
+	var keys []*db.Key
+	for _, crasher := range crashers {
+		keys = append(keys, db.NewKey(c, "Bug", crasher.bugID, 0, nil))
+	}
+	bugs := make([]*Bug, len(keys))
+	if err := db.GetMulti(c, keys, bugs); err != nil {
+		return nil, fmt.Errorf("failed to fetch bugs: %w", err)
+	}
+	var ret []*uiTopCrasher
+	for i, crasher := range crashers {
+		bug := bugs[i]
+		if accessLevel < bug.sanitizeAccess(accessLevel) {
+			continue
+		}
+		crasher.PrevCrashes = weeklyCrashes(bug, dayStart.Add(-topCrashersPeriod))
+		crasher.FirstTime = bug.FirstTime
+		crasher.ReproLevel = bug.ReproLevel
+		crasher.LastDiscussion = bug.LastDiscussionActivity
+		ret = append(ret, crasher)
+	}
+	return ret, nil
+}
+
+func writeTopCrashersCSV(c context.Context, w http.ResponseWriter, page *uiTopCrashersPage) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=top_crashers_%v_%v.csv",
+		page.Header.Namespace, page.Date.Format("20060102")))
+	reproNames := map[dashapi.ReproLevel]string{
+		ReproLevelSyz: "syz",
+		ReproLevelC:   "C",
+	}
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"rank", "movement", "title", "crashes", "prev crashes",
+		"first crash", "repro", "last discussion", "link"})
+	for _, crasher := range page.Crashers {
+		movement := strconv.Itoa(crasher.Movement)
+		if crasher.New {
+			movement = "new"
+		}
+		lastDiscussion := ""
+		if !crasher.LastDiscussion.IsZero() {
+			lastDiscussion = crasher.LastDiscussion.Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			strconv.Itoa(crasher.Rank),
+			movement,
+			crasher.Title,
+			strconv.FormatInt(crasher.Crashes, 10),
+			strconv.FormatInt(crasher.PrevCrashes, 10),
+			crasher.FirstTime.Format(time.RFC3339),
+			reproNames[crasher.ReproLevel],
+			lastDiscussion,
+			appURL(c) + crasher.Link,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRankTopCrashers(t *testing.T) {
+	now := time.Date(2023, time.March, 6, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	var bugs []*Bug
+	for i := 0; i < topCrashersCount+5; i++ {
+		bug := &Bug{Namespace: "test1", Title: fmt.Sprintf("title%02d", i)}
+		// Crashes outside of the week don't count.
+		bug.DailyStats = append(bug.DailyStats, BugDailyStats{timeDate(now.Add(-8 * day)), 1000})
+		bug.DailyStats = append(bug.DailyStats, BugDailyStats{timeDate(now.Add(-7 * day)), i})
+		bug.DailyStats = append(bug.DailyStats, BugDailyStats{timeDate(now.Add(-1 * day)), i})
+		bug.DailyStats = append(bug.DailyStats, BugDailyStats{timeDate(now), 1000})
+		bugs = append(bugs, bug)
+	}
+	ranking := rankTopCrashers(bugs, now)
+	if len(ranking) != topCrashersCount {
+		t.Fatalf("got %v entries", len(ranking))
+	}
+	for i, entry := range ranking {
+		n := topCrashersCount + 4 - i
+		if entry.Title != fmt.Sprintf("title%02d", n) || entry.Crashes != int64(2*n) {
+			t.Errorf("entry #%v: %+v", i, entry)
+		}
+	}
+
+	prev := &TopCrashersSnapshot{Entries: []TopCrasher{ranking[2], ranking[0]}}
+	cur := &TopCrashersSnapshot{Entries: ranking[:3]}
+	crashers := makeTopCrashersUI(cur, prev)
+	for i, want := range []string{"▲1", "new", "▼2"} {
+		if crashers[i].Arrow != want {
+			t.Errorf("crasher #%v: got %q, want %q", i, crashers[i].Arrow, want)
+		}
+	}
+	// Nothing is new in the first snapshot.
+	crashers = makeTopCrashersUI(cur, nil)
+	if crashers[0].New || crashers[0].Arrow != "" {
+		t.Errorf("bad first snapshot movement: %+v", crashers[0])
+	}
+}
+
+func TestTopCrashers(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	c.client.UploadBuild(build)
+	c.client.ReportCrash(testCrash(build, 1))
+	c.client.ReportCrash(testCrash(build, 2))
+	c.client.ReportCrash(testCrash(build, 2))
+	c.client.pollBugs(2)
+
+	c.advanceTime(24 * time.Hour)
+	_, err := c.GET("/cron/top_crashers")
+	c.expectOK(err)
+	snapshots, err := loadTopCrashersSnapshots(c.ctx, "test1")
+	c.expectOK(err)
+	c.expectEQ(len(snapshots), 1)
+	c.expectEQ(len(snapshots[0].Entries), 2)
+	c.expectEQ(snapshots[0].Entries[0].Title, "title2")
+	// The snapshot is taken only once a day.
+	_, err = c.GET("/cron/top_crashers")
+	c.expectOK(err)
+
+	c.advanceTime(6 * 24 * time.Hour)
+	for i := 0; i < 3; i++ {
+		c.client.ReportCrash(testCrash(build, 1))
+	}
+	c.advanceTime(24 * time.Hour)
+	_, err = c.GET("/cron/top_crashers")
+	c.expectOK(err)
+	snapshots, err = loadTopCrashersSnapshots(c.ctx, "test1")
+	c.expectOK(err)
+	c.expectEQ(len(snapshots), 2)
+	c.expectEQ(len(snapshots[1].Entries), 1)
+	c.expectEQ(snapshots[1].Entries[0].Crashes, int64(3))
+
+	page, err := c.AuthGET(AccessAdmin, "/top_crashers?ns=test1")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(page, []byte("▲1")))
+	csv, err := c.AuthGET(AccessAdmin, fmt.Sprintf("/top_crashers?ns=test1&date=%v&format=csv",
+		snapshots[0].Date))
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(csv, []byte("rank,movement,title")))
+	c.expectTrue(bytes.Contains(csv, []byte("\n1,0,title2,2,0,")))
+	checkResponseStatusCode(c, AccessAdmin, "/top_crashers?ns=test1&date=20000101", http.StatusNotFound)
+
+	// Old snapshots are eventually deleted.
+	c.advanceTime(topCrashersRetention + 24*time.Hour)
+	_, err = c.GET("/cron/top_crashers")
+	c.expectOK(err)
+	snapshots, err = loadTopCrashersSnapshots(c.ctx, "test1")
+	c.expectOK(err)
+	c.expectEQ(len(snapshots), 1)
+}
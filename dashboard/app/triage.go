@@ -0,0 +1,137 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	db "google.golang.org/appengine/v2/datastore"
+)
+
+// Only bugs with discussion activity within this period are considered for the triage inbox.
+const triageInboxPeriod = 30 * 24 * time.Hour
+
+type uiTriageInboxPage struct {
+	Header *uiHeader
+	Now    time.Time
+	Items  []*uiTriageInboxItem
+}
+
+type uiTriageInboxItem struct {
+	Title          string
+	Link           string
+	Subject        string
+	DiscussionLink string
+	Last           time.Time
+	Excerpt        string
+	Reason         string
+}
+
+// handleTriageInbox lists the bugs whose discussions are likely waiting for a reaction from syzbot.
+func handleTriageInbox(c context.Context, w http.ResponseWriter, r *http.Request) error {
+	ns := r.FormValue("ns")
+	if ns == "" {
+		ns = config.DefaultNamespace
+	}
+	hdr, err := commonHeader(c, r, w, ns)
+	if err != nil {
+		return err
+	}
+	items, err := loadTriageInbox(c, namespaceAccessLevel(c, r, hdr.Namespace), hdr.Namespace)
+	if err != nil {
+		return err
+	}
+	return serveTemplate(w, "triage_inbox.html", &uiTriageInboxPage{
+		Header: hdr,
+		Now:    timeNow(c),
+		Items:  items,
+	})
+}
+
+func loadTriageInbox(c context.Context, accessLevel AccessLevel, ns string) ([]*uiTriageInboxItem, error) {
+	since := timeNow(c).Add(-triageInboxPeriod)
+	bugs, keys, err := loadAllBugs(c, func(query *db.Query) *db.Query {
+		return query.Filter("Namespace=", ns).
+			Filter("Status=", BugStatusOpen).
+			Filter("LastDiscussionActivity>", since)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []*uiTriageInboxItem
+	for i, bug := range bugs {
+		if accessLevel < bug.sanitizeAccess(accessLevel) {
+			continue
+		}
+		discussions, err := discussionsForBug(c, keys[i])
+		if err != nil {
+			return nil, err
+		}
+		var latest *Discussion
+		var last *DiscussionMessage
+		for _, d := range discussions {
+			if m := d.lastMessage(); m != nil && (last == nil || last.orderTime().Before(m.orderTime())) {
+				latest, last = d, m
+			}
+		}
+		if latest == nil {
+			continue
+		}
+		reason := needsBotAction(last, latest.LastExcerpt)
+		if reason == "" {
+			continue
+		}
+		items = append(items, &uiTriageInboxItem{
+			Title:          bug.displayTitle(),
+			Link:           bugLink(keys[i].StringID()),
+			Subject:        latest.Subject,
+			DiscussionLink: latest.link(),
+			Last:           last.Time,
+			Excerpt:        latest.LastExcerpt,
+			Reason:         reason,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Last.After(items[j].Last)
+	})
+	return items, nil
+}
+
+var (
+	botCommandLineRe = regexp.MustCompile(`^#syz[\s:-]`)
+	// Reported-by:, Tested-by: and similar tags mention syzbot, but are not addressed to it.
+	commitTagLineRe = regexp.MustCompile(`^[A-Za-z-]+-by:`)
+)
+
+// needsBotAction decides whether the last message in a discussion awaits a reaction from syzbot.
+// It returns a human-readable reason or an empty string.
+// The last message must be external (that also means there was no bot reply since then)
+// and must either contain a command-looking line or mention syzbot.
+func needsBotAction(last *DiscussionMessage, excerpt string) string {
+	if last == nil || !last.External {
+		return ""
+	}
+	mentioned := false
+	for _, line := range strings.Split(excerpt, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		if botCommandLineRe.MatchString(line + " ") {
+			return "unanswered command"
+		}
+		if !commitTagLineRe.MatchString(line) && strings.Contains(strings.ToLower(line), "syzbot") {
+			mentioned = true
+		}
+	}
+	if mentioned {
+		return "mentions syzbot"
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestNeedsBotAction(t *testing.T) {
+	external := &DiscussionMessage{External: true}
+	tests := []struct {
+		last    *DiscussionMessage
+		excerpt string
+		reason  string
+	}{
+		{
+			last:    nil,
+			excerpt: "#syz test",
+		},
+		{
+			// Syzbot has already replied.
+			last:    &DiscussionMessage{External: false},
+			excerpt: "#syz test",
+		},
+		{
+			last:    external,
+			excerpt: "Hi,\n\n#syz test: git://repo.git master\n",
+			reason:  "unanswered command",
+		},
+		{
+			last:    external,
+			excerpt: "#syz invalid",
+			reason:  "unanswered command",
+		},
+		{
+			last:    external,
+			excerpt: "Hi,\n\nSyzbot, could you please retest it?",
+			reason:  "mentions syzbot",
+		},
+		{
+			last:    external,
+			excerpt: "> #syz test\n> syzbot\nThe fix looks good.",
+		},
+		{
+			last:    external,
+			excerpt: "Reported-by: syzbot+1234@syzkaller.appspotmail.com\nSigned-off-by: A <a@a.com>",
+		},
+		{
+			last:    external,
+			excerpt: "#syzkaller is an interesting project",
+		},
+		{
+			last:    external,
+			excerpt: "I'll take a look.",
+		},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got := needsBotAction(test.last, test.excerpt)
+			if got != test.reason {
+				t.Fatalf("got %q, want %q", got, test.reason)
+			}
+		})
+	}
+}
+
+func TestDiscussionExcerpt(t *testing.T) {
+	body := "Hi,\r\n\r\nOn Mon, 1 Jan 2023 syzbot wrote:\r\n> quoted line\r\n>> another one\r\n\r\n#syz test\r\n"
+	if got, want := discussionExcerpt(body), "Hi,\n\n\n#syz test"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestTriageInbox(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	client := c.publicClient
+
+	build := testBuild(1)
+	client.UploadBuild(build)
+
+	crash := testCrash(build, 1)
+	client.ReportCrash(crash)
+	msg := client.pollEmailBug()
+	_, extBugID, err := email.RemoveAddrContext(msg.Sender)
+	c.expectOK(err)
+	c.expectOK(saveDiscussionMessage(c.ctx, &newDiscussionMessage{
+		id:        "<1234>",
+		subject:   "Bug reported",
+		msgSource: dashapi.DiscussionLore,
+		msgType:   dashapi.DiscussionReport,
+		bugIDs:    []string{extBugID},
+		time:      timeNow(c.ctx),
+	}))
+
+	// The bot's own message does not need any action.
+	body, err := c.GET("/triage_inbox?ns=access-public-email")
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(body, []byte(crash.Title)))
+
+	c.advanceTime(time.Hour)
+	c.expectOK(saveDiscussionMessage(c.ctx, &newDiscussionMessage{
+		id:        "<2345>",
+		msgSource: dashapi.DiscussionLore,
+		bugIDs:    []string{extBugID},
+		parentIDs: []string{"<1234>"},
+		external:  true,
+		excerpt:   "syzbot, is it still happening?",
+		time:      timeNow(c.ctx),
+	}))
+	body, err = c.GET("/triage_inbox?ns=access-public-email")
+	c.expectOK(err)
+	c.expectTrue(bytes.Contains(body, []byte(crash.Title)))
+	c.expectTrue(bytes.Contains(body, []byte("mentions syzbot")))
+
+	// A discussion that has been inactive for too long is not considered.
+	c.advanceTime(triageInboxPeriod + time.Hour)
+	body, err = c.GET("/triage_inbox?ns=access-public-email")
+	c.expectOK(err)
+	c.expectTrue(!bytes.Contains(body, []byte(crash.Title)))
+}
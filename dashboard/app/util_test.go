@@ -44,6 +44,10 @@ type Ctx struct {
 	client           *apiClient
 	client2          *apiClient
 	publicClient     *apiClient
+	emailSeq         int
+	patchwork        *testPatchwork
+	// loreMessages are the raw messages returned by the mocked lore archive, by Message-ID.
+	loreMessages map[string]string
 }
 
 var skipDevAppserverTests = func() bool {
@@ -75,6 +79,8 @@ func NewCtx(t *testing.T) *Ctx {
 		mockedTime:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
 		emailSink:        make(chan *aemail.Message, 100),
 		transformContext: func(c context.Context) context.Context { return c },
+		patchwork:        newTestPatchwork(),
+		loreMessages:     map[string]string{},
 	}
 	c.client = c.makeClient(client1, password1, true)
 	c.client2 = c.makeClient(client2, password2, true)
@@ -254,6 +260,32 @@ func (c *Ctx) ContentType(url string) (string, error) {
 }
 
 func (c *Ctx) httpRequest(method, url, body string, access AccessLevel) (*httptest.ResponseRecorder, error) {
+	var u *user.User
+	if access == AccessAdmin || access == AccessUser {
+		u = &user.User{
+			Email:      "user@syzkaller.com",
+			AuthDomain: "gmail.com",
+		}
+		if access == AccessAdmin {
+			u.Admin = true
+		}
+	}
+	return c.httpRequestAs(method, url, body, u)
+}
+
+// GETAs sends HTTP GET request to the app on behalf of a non-admin user with the given email.
+func (c *Ctx) GETAs(email, url string) ([]byte, error) {
+	w, err := c.httpRequestAs("GET", url, "", &user.User{
+		Email:      email,
+		AuthDomain: "gmail.com",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w.Body.Bytes(), nil
+}
+
+func (c *Ctx) httpRequestAs(method, url, body string, u *user.User) (*httptest.ResponseRecorder, error) {
 	c.t.Logf("%v: %v", method, url)
 	r, err := c.inst.NewRequest(method, url, strings.NewReader(body))
 	if err != nil {
@@ -261,15 +293,8 @@ func (c *Ctx) httpRequest(method, url, body string, access AccessLevel) (*httpte
 	}
 	r = registerRequest(r, c)
 	r = r.WithContext(c.transformContext(r.Context()))
-	if access == AccessAdmin || access == AccessUser {
-		user := &user.User{
-			Email:      "user@syzkaller.com",
-			AuthDomain: "gmail.com",
-		}
-		if access == AccessAdmin {
-			user.Admin = true
-		}
-		aetest.Login(user, r)
+	if u != nil {
+		aetest.Login(u, r)
 	}
 	w := httptest.NewRecorder()
 	http.DefaultServeMux.ServeHTTP(w, r)
@@ -494,6 +519,12 @@ func (client *apiClient) pollJobs(manager string) *dashapi.JobPollResp {
 	})
 }
 
+func (client *apiClient) uploadManagerStats(req *dashapi.ManagerStatsReq) *dashapi.ManagerStatsResp {
+	resp, err := client.UploadManagerStatsWithFocus(req)
+	client.expectOK(err)
+	return resp
+}
+
 func (client *apiClient) pollAndFailBisectJob(manager string) {
 	resp := client.pollJobs(manager)
 	client.expectNE(resp.ID, "")
@@ -512,6 +543,8 @@ type (
 	EmailOptOrigFrom  string
 	EmailOptCC        []string
 	EmailOptSender    string
+	// EmailOptAttachment attaches a text file to the email.
+	EmailOptAttachment string
 )
 
 func (c *Ctx) incomingEmail(to, body string, opts ...interface{}) {
@@ -521,8 +554,15 @@ func (c *Ctx) incomingEmail(to, body string, opts ...interface{}) {
 	cc := []string{"test@syzkaller.com", "bugs@syzkaller.com", "bugs2@syzkaller.com"}
 	sender := ""
 	origFrom := ""
+	inReplyTo := ""
+	attachment := ""
+	headers := ""
 	for _, o := range opts {
 		switch opt := o.(type) {
+		case EmailOptHeader:
+			headers += "\n" + string(opt)
+		case EmailOptAttachment:
+			attachment = string(opt)
 		case EmailOptMessageID:
 			id = int(opt)
 		case EmailOptSubject:
@@ -535,27 +575,131 @@ func (c *Ctx) incomingEmail(to, body string, opts ...interface{}) {
 			cc = []string(opt)
 		case EmailOptOrigFrom:
 			origFrom = fmt.Sprintf("\nX-Original-From: %v", string(opt))
+		case EmailOptInReplyTo:
+			inReplyTo = fmt.Sprintf("\nIn-Reply-To: %v", string(opt))
 		}
 	}
 	if sender == "" {
 		sender = from
 	}
+	contentType := "text/plain"
+	if attachment != "" {
+		const boundary = "attachment-boundary"
+		contentType = fmt.Sprintf("multipart/mixed; boundary=%q", boundary)
+		body = fmt.Sprintf("--%[1]v\nContent-Type: text/plain\n\n%[2]v\n--%[1]v\n"+
+			"Content-Type: text/plain\nContent-Disposition: attachment; filename=\"file.txt\"\n\n%[3]v\n--%[1]v--",
+			boundary, body, attachment)
+	}
 	email := fmt.Sprintf(`Sender: %v
 Date: Tue, 15 Aug 2017 14:59:00 -0700
 Message-ID: <%v>
 Subject: %v
 From: %v
 Cc: %v
-To: %v%v
-Content-Type: text/plain
+To: %v%v%v%v
+Content-Type: %v
 
 %v
-`, sender, id, subject, from, strings.Join(cc, ","), to, origFrom, body)
+`, sender, id, subject, from, strings.Join(cc, ","), to, origFrom, inReplyTo, headers, contentType, body)
 	log.Infof(c.ctx, "sending %s", email)
 	_, err := c.POST("/_ah/mail/email@server.com", email)
 	c.expectOK(err)
 }
 
+// EmailOptInReplyTo overrides the parent of the next message in a test thread.
+type EmailOptInReplyTo string
+
+// EmailOptReferences overrides the References header of the next message in a test thread.
+type EmailOptReferences string
+
+// EmailOptHeader adds a raw header line to the next message in a test thread.
+type EmailOptHeader string
+
+// testThread simulates a mailing list thread that Cc's syzbot about a bug.
+type testThread struct {
+	c       *Ctx
+	subject string
+	// botEmail is the bug's own reporting address, messages from it are not external.
+	botEmail string
+	refs     []string
+	lastRaw  string
+}
+
+// incomingThread starts a new thread about the bug identified by its reporting ID.
+// No messages are sent until the first reply() call.
+func (c *Ctx) incomingThread(subject, bugID string) *testThread {
+	botEmail, err := email.AddAddrContext(ownEmail(c.ctx), bugID)
+	c.expectOK(err)
+	return &testThread{
+		c:        c,
+		subject:  subject,
+		botEmail: botEmail,
+	}
+}
+
+// reply sends the next message of the thread through the incoming mail handler of
+// the lore discussion address and returns the Message-ID of the new message.
+// By default the message replies to the previous one.
+func (t *testThread) reply(from, body string, opts ...interface{}) string {
+	t.c.emailSeq++
+	id := fmt.Sprintf("<thread-%v@test.com>", t.c.emailSeq)
+	inReplyTo := ""
+	if len(t.refs) > 0 {
+		inReplyTo = t.refs[len(t.refs)-1]
+	}
+	references := ""
+	extra := ""
+	for _, o := range opts {
+		switch opt := o.(type) {
+		case EmailOptInReplyTo:
+			inReplyTo = string(opt)
+		case EmailOptReferences:
+			references = string(opt)
+		case EmailOptHeader:
+			extra += string(opt) + "\n"
+		}
+	}
+	subject := t.subject
+	threading := ""
+	if inReplyTo != "" {
+		subject = "Re: " + subject
+		if references == "" {
+			references = strings.Join(append(t.refs, inReplyTo), " ")
+		}
+		threading = fmt.Sprintf("In-Reply-To: %v\nReferences: %v\n", inReplyTo, references)
+	}
+	t.refs = append(t.refs, id)
+	t.lastRaw = fmt.Sprintf(`Date: %v
+Message-ID: %v
+Subject: %v
+From: %v
+To: %v
+Cc: lore@email.com, linux-kernel@vger.kernel.org
+List-Id: <linux-kernel.vger.kernel.org>
+%v%vContent-Type: text/plain
+
+%v
+`, timeNow(t.c.ctx).Format(time.RFC1123Z), id, subject, from, t.botEmail, threading, extra, body)
+	t.redeliver()
+	return id
+}
+
+// redeliver sends the last message of the thread once again.
+func (t *testThread) redeliver() {
+	log.Infof(t.c.ctx, "sending %s", t.lastRaw)
+	_, err := t.c.POST("/_ah/mail/lore@email.com", t.lastRaw)
+	t.c.expectOK(err)
+}
+
+func (c *Ctx) expectDiscussionSummary(bugID string, want DiscussionSummary) {
+	c.t.Helper()
+	bug, _, err := findBugByReportingID(c.ctx, bugID)
+	c.expectOK(err)
+	if diff := cmp.Diff(want, bug.discussionSummary()); diff != "" {
+		c.t.Fatalf("discussion summary mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func initMocks() {
 	// Mock time as some functionality relies on real time.
 	timeNow = func(c context.Context) time.Time {
@@ -565,6 +709,31 @@ func initMocks() {
 		getRequestContext(c).emailSink <- msg
 		return nil
 	}
+	newPatchworkClient = func(c context.Context, cfg *PatchworkConfig) patchworkClient {
+		return getRequestContext(c).patchwork
+	}
+	fetchLoreMessage = func(c context.Context, msgID string) ([]byte, error) {
+		raw, ok := getRequestContext(c).loreMessages[msgID]
+		if !ok {
+			return nil, fmt.Errorf("%v is not in the archive", msgID)
+		}
+		return []byte(raw), nil
+	}
+	fetchLoreThread = func(c context.Context, msgID string) ([]byte, error) {
+		// The mocked archive is a single big thread.
+		messages := getRequestContext(c).loreMessages
+		if _, ok := messages[msgID]; !ok {
+			return nil, fmt.Errorf("%v is not in the archive", msgID)
+		}
+		mbox := new(bytes.Buffer)
+		for _, raw := range messages {
+			fmt.Fprintf(mbox, "From mboxrd@z Thu Jan  1 00:00:00 1970\n%v\n", raw)
+		}
+		return mbox.Bytes(), nil
+	}
+	signCorpusURL = func(c context.Context, bucket, object, method string, expires time.Time) (string, error) {
+		return fmt.Sprintf("https://storage.googleapis.com/%v/%v?method=%v", bucket, object, method), nil
+	}
 	maxCrashes = func() int {
 		// dev_appserver is very slow, so let's make tests smaller.
 		const maxCrashesDuringTest = 20
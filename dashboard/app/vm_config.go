@@ -0,0 +1,72 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+	"golang.org/x/net/context"
+)
+
+// Hardware-dependent bugs (KVM, drivers) can't be reproduced without the VM configuration.
+// syz-ci uploads the VM config of the manager (the VM type and the "vm" section of
+// the manager config) with every build. The configs rarely change, so they are stored
+// as deduplicated VMConfig texts referenced from Build.VMConfig. The config is shown
+// on the crash rows of the bug page and is included in the repro bundle.
+
+// putVMConfig stores the VM config and returns the reference to the text entity (0 if there's no config).
+func putVMConfig(c context.Context, ns string, cfg *dashapi.VMConfig) (int64, error) {
+	if cfg == nil || cfg.Type == "" {
+		return 0, nil
+	}
+	if len(cfg.Type) > MaxStringLen {
+		return 0, fmt.Errorf("Build.VMConfig.Type is too long (%v)", len(cfg.Type))
+	}
+	// Compact the JSON so that formatting differences do not create new entities.
+	vm := new(bytes.Buffer)
+	if len(cfg.Config) != 0 {
+		if err := json.Compact(vm, cfg.Config); err != nil {
+			return 0, fmt.Errorf("bad Build.VMConfig.Config: %w", err)
+		}
+	}
+	data, err := json.Marshal(&dashapi.VMConfig{
+		Type:   cfg.Type,
+		Config: vm.Bytes(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return putText(c, ns, textVMConfig, data, true)
+}
+
+func loadVMConfig(c context.Context, id int64) (*dashapi.VMConfig, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	data, _, err := getText(c, textVMConfig, id)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(dashapi.VMConfig)
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse VM config %v: %w", id, err)
+	}
+	return cfg, nil
+}
+
+// formatVMConfig returns the human-readable VM config for the bug page.
+func formatVMConfig(cfg *dashapi.VMConfig) string {
+	if cfg == nil {
+		return ""
+	}
+	vm := new(bytes.Buffer)
+	if len(cfg.Config) == 0 || json.Indent(vm, cfg.Config, "", "  ") != nil {
+		vm.Reset()
+		vm.Write(cfg.Config)
+	}
+	return fmt.Sprintf("type: %v\n%s", cfg.Type, vm.Bytes())
+}
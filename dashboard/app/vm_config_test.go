@@ -0,0 +1,104 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+func TestVMConfigDedup(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build1 := testBuild(1)
+	build1.VMConfig = &dashapi.VMConfig{
+		Type:   "qemu",
+		Config: []byte(`{"count": 2, "cpu": 2, "mem": 2048, "qemu_args": "-enable-kvm -cpu host,migratable=off"}`),
+	}
+	c.client.UploadBuild(build1)
+	// The same config formatted differently.
+	build2 := testBuild(2)
+	build2.VMConfig = &dashapi.VMConfig{
+		Type: "qemu",
+		Config: []byte(`{
+			"count": 2,
+			"cpu": 2,
+			"mem": 2048,
+			"qemu_args": "-enable-kvm -cpu host,migratable=off"
+		}`),
+	}
+	c.client.UploadBuild(build2)
+	build3 := testBuild(3)
+	build3.VMConfig = &dashapi.VMConfig{
+		Type:   "qemu",
+		Config: []byte(`{"count": 2, "cpu": 4, "mem": 4096}`),
+	}
+	c.client.UploadBuild(build3)
+	// Older syz-ci versions do not upload the config.
+	build4 := testBuild(4)
+	c.client.UploadBuild(build4)
+
+	load := func(build *dashapi.Build) *Build {
+		ret, err := loadBuild(c.ctx, "test1", build.ID)
+		c.expectOK(err)
+		return ret
+	}
+	c.expectNE(load(build1).VMConfig, int64(0))
+	c.expectEQ(load(build1).VMConfig, load(build2).VMConfig)
+	c.expectNE(load(build1).VMConfig, load(build3).VMConfig)
+	c.expectEQ(load(build4).VMConfig, int64(0))
+
+	vmConfig, err := loadVMConfig(c.ctx, load(build3).VMConfig)
+	c.expectOK(err)
+	c.expectEQ(vmConfig.Type, "qemu")
+	c.expectEQ(string(vmConfig.Config), `{"count":2,"cpu":4,"mem":4096}`)
+}
+
+func TestVMConfigRendering(t *testing.T) {
+	c := NewCtx(t)
+	defer c.Close()
+
+	build := testBuild(1)
+	build.VMConfig = &dashapi.VMConfig{
+		Type:   "qemu",
+		Config: []byte(`{"count": 2, "cpu": 2, "mem": 2048, "qemu_args": "-enable-kvm"}`),
+	}
+	c.client.UploadBuild(build)
+	crash := testCrashWithRepro(build, 1)
+	c.client.ReportCrash(crash)
+	rep := c.client.pollBug()
+
+	page, err := c.AuthGET(AccessAdmin, "/bug?extid="+rep.ID)
+	c.expectOK(err)
+	c.expectTrue(strings.Contains(string(page), "<summary>vm config</summary>"))
+	c.expectTrue(strings.Contains(html.UnescapeString(string(page)), `"qemu_args": "-enable-kvm"`))
+
+	link := html.UnescapeString(crashEnvLinkRe.FindString(string(page)))
+	reply, err := c.AuthGET(AccessAdmin, link)
+	c.expectOK(err)
+	env := new(PublicAPICrashEnvironment)
+	c.expectOK(json.Unmarshal(reply, env))
+	c.expectEQ(env.VM.Type, "qemu")
+	c.expectEQ(string(env.VM.Config), `{"count":2,"cpu":2,"mem":2048,"qemu_args":"-enable-kvm"}`)
+}
+
+func TestFormatVMConfig(t *testing.T) {
+	got := formatVMConfig(&dashapi.VMConfig{Type: "gce", Config: []byte(`{"count":2,"machine_type":"e2-standard-2"}`)})
+	want := `type: gce
+{
+  "count": 2,
+  "machine_type": "e2-standard-2"
+}`
+	if got != want {
+		t.Fatalf("got:\n%v\nwant:\n%v", got, want)
+	}
+	if got := formatVMConfig(nil); got != "" {
+		t.Fatalf("got %q for no config", got)
+	}
+}
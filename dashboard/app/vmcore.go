@@ -0,0 +1,53 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+// For some crashes the VM captures an excerpt of the kernel crash dump (vmcore), which is
+// uploaded as a crash asset. The dumps may contain arbitrary kernel memory contents, so they
+// are never reported and are only listed on the bug page for users with the namespace
+// VMCoreAccessLevel (admins by default). They are also big, so they are deleted after
+// vmcoreRetention even if the bug is still open.
+
+const vmcoreRetention = 14 * 24 * time.Hour
+
+func vmcoreExpiry(asset *Asset) time.Time {
+	return asset.CreateDate.Add(vmcoreRetention)
+}
+
+func makeVMCoreAssetsUI(crash *Crash) []*uiAsset {
+	var ret []*uiAsset
+	for i := range crash.Assets {
+		asset := &crash.Assets[i]
+		if asset.Type != dashapi.VMCoreExcerpt {
+			continue
+		}
+		details := fmt.Sprintf("kept until %v", vmcoreExpiry(asset).Format("2006/01/02"))
+		if asset.Size != 0 {
+			details = formatBytes(asset.Size) + ", " + details
+		}
+		ret = append(ret, &uiAsset{
+			Title:       "vmcore excerpt",
+			DownloadURL: asset.DownloadURL,
+			Details:     details,
+		})
+	}
+	return ret
+}
+
+// showVMCores adds the vmcore excerpts to the crash assets if the user may see them.
+func showVMCores(crashes []*uiCrash, ns string, accessLevel AccessLevel) {
+	if accessLevel < config.Namespaces[ns].VMCoreAccessLevel {
+		return
+	}
+	for _, crash := range crashes {
+		crash.Assets = append(crash.Assets, crash.vmcores...)
+	}
+}
@@ -102,6 +102,13 @@ type Build struct {
 	Commits             []string // see BuilderPoll
 	FixCommits          []Commit
 	Assets              []NewAsset
+	VMConfig            *VMConfig
+}
+
+// VMConfig is the snapshot of the VM configuration the manager runs the kernel with.
+type VMConfig struct {
+	Type   string          // VM type, e.g. "qemu" or "gce"
+	Config json.RawMessage // the "vm" section of the manager config (qemu args, cpu, memory, etc)
 }
 
 type Commit struct {
@@ -113,6 +120,8 @@ type Commit struct {
 	Recipients Recipients
 	BugIDs     []string // ID's extracted from Reported-by tags
 	Date       time.Time
+	// ConflictingHashes are the hashes of the commits with the same title in the other repos.
+	ConflictingHashes []string
 }
 
 func (dash *Dashboard) UploadBuild(build *Build) error {
@@ -165,9 +174,11 @@ type JobPollReq struct {
 }
 
 type ManagerJobs struct {
-	TestPatches bool
-	BisectCause bool
-	BisectFix   bool
+	TestPatches    bool
+	BisectCause    bool
+	BisectFix      bool
+	Minimize       bool
+	MinimizeConfig bool
 }
 
 type JobPollResp struct {
@@ -185,6 +196,11 @@ type JobPollResp struct {
 	ReproOpts         []byte
 	ReproSyz          []byte
 	ReproC            []byte
+	// BuildOnly is set for cause bisections of kernel build failures.
+	BuildOnly bool
+	// BisectTestRepeats is the number of test rounds per commit for bisections (0 means the default),
+	// it's set for the bisections requested with "#syz retest-bisect".
+	BisectTestRepeats int
 }
 
 type JobDoneReq struct {
@@ -204,6 +220,34 @@ type JobDoneReq struct {
 	// If there are more than 1: suspected commits due to skips (broken build/boot).
 	Commits []Commit
 	Flags   JobDoneFlags
+	// Reproducer minimization results (empty if the reproducer did not work).
+	ReproOpts []byte
+	ReproSyz  []byte
+	ReproC    []byte
+	// Set if the syz reproducer did not parse with the current descriptions,
+	// but was migrated to them (the job used the migrated version).
+	ReproSyzMigrated []byte
+	// Set if the syz reproducer could not be parsed even after a migration.
+	ReproParseError string
+	// The assets produced by the job (e.g. the minimized kernel config).
+	Assets []NewAsset
+	// The number of the test runs that executed the reproducer and the number of them that crashed.
+	ReproAttempts  int
+	ReproSuccesses int
+	// The test results of the commits tested during bisection.
+	Revisions []BisectRevision
+	// GuiltyFile is the guilty file of the crash, and TouchesGuiltyFile is set if
+	// the single bisection commit changes files in its directory.
+	GuiltyFile        string
+	TouchesGuiltyFile bool
+}
+
+type BisectRevision struct {
+	Commit  string
+	Runs    int
+	Crashes int
+	Errors  int  // boot and infrastructure errors
+	Skipped bool // the commit could not be tested
 }
 
 type JobType int
@@ -212,6 +256,8 @@ const (
 	JobTestPatch JobType = iota
 	JobBisectCause
 	JobBisectFix
+	JobMinimize
+	JobMinimizeConfig
 )
 
 type JobDoneFlags int64
@@ -249,7 +295,74 @@ func (dash *Dashboard) ReportBuildError(req *BuildErrorReq) error {
 type CommitPollResp struct {
 	ReportEmail string
 	Repos       []Repo
+	// HintedRepos are the repos from Repos (except the first one) that the recent
+	// patch discussions target. They are worth polling first.
+	HintedRepos []Repo
 	Commits     []string
+	// Backports lists the fix commits to look for in the stable branches of the namespace.
+	Backports []BackportPoll
+	// Releases lists the fix commits whose first release in the main repo needs to be looked up.
+	// Only Hash and Title are set.
+	Releases []Commit
+	// Watches lists the paths of the main repo that users want to be notified about.
+	Watches []WatchPoll
+}
+
+type BackportPoll struct {
+	Repo Repo
+	// Only Hash and Title are set, Hash is empty if the commit info is not known yet.
+	Commits []Commit
+}
+
+type BackportResultReq struct {
+	Results []BackportResult
+}
+
+type BackportResult struct {
+	Repo Repo
+	// Found are the backports, Title is the title of the upstream commit
+	// and Hash is the hash of the backport.
+	Found []Commit
+	// Missing are the titles of the upstream commits that have not been backported.
+	Missing []string
+}
+
+type ReleaseResultReq struct {
+	Results []ReleaseResult
+}
+
+type ReleaseResult struct {
+	Title string
+	Hash  string
+	// Release is the first release tag of the main repo that contains the commit,
+	// it's empty if the commit has not been released yet.
+	Release string
+}
+
+type WatchPoll struct {
+	ID    string // bug ID
+	Paths []string
+	// LastCommit is the main repo commit up to which the paths were already checked.
+	// If it's empty, the watch is new and only the cursor needs to be set.
+	LastCommit string
+}
+
+type WatchResultReq struct {
+	Results []WatchResult
+}
+
+type WatchResult struct {
+	ID string
+	// LastCommit is the new cursor, the HEAD of the main repo at the time of the poll.
+	LastCommit string
+	Changes    []WatchChange
+}
+
+type WatchChange struct {
+	Path string
+	// The new commits that change the path, the newest first.
+	// Only Hash, Title, Author and Date are set.
+	Commits []Commit
 }
 
 type CommitPollResultReq struct {
@@ -274,6 +387,27 @@ func (dash *Dashboard) UploadCommits(commits []Commit) error {
 	return dash.Query("upload_commits", &CommitPollResultReq{commits}, nil)
 }
 
+func (dash *Dashboard) UploadBackports(results []BackportResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	return dash.Query("upload_backports", &BackportResultReq{results}, nil)
+}
+
+func (dash *Dashboard) UploadReleases(results []ReleaseResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	return dash.Query("upload_releases", &ReleaseResultReq{results}, nil)
+}
+
+func (dash *Dashboard) UploadWatchResults(results []WatchResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	return dash.Query("upload_watch_results", &WatchResultReq{results}, nil)
+}
+
 type CrashFlags int64
 
 const (
@@ -299,6 +433,36 @@ type Crash struct {
 	ReproOpts []byte
 	ReproSyz  []byte
 	ReproC    []byte
+	// Summary of the kernel code reached by the reproducer, the most covered files first.
+	// The full summary is uploaded as a ReproCoverage asset.
+	ReproCoverage []CoveredFile
+	// Machine-readable version of Report.
+	Structured *StructuredReport
+}
+
+// StructuredReport is produced by the report parser for tools that would otherwise parse the report text.
+// It's served to users as JSON, so the JSON field names must be kept stable.
+type StructuredReport struct {
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+	Corrupted bool   `json:"corrupted"`
+	// Frames is the first stack trace of the report, the innermost frame first.
+	Frames []StackFrame `json:"frames,omitempty"`
+	// Syscalls are the calls of the programs executed right before the crash.
+	Syscalls []string `json:"syscalls,omitempty"`
+}
+
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Inline   bool   `json:"inline,omitempty"`
+}
+
+// CoveredFile lists the functions of a kernel source file that were reached by a reproducer.
+type CoveredFile struct {
+	File      string
+	Functions []string
 }
 
 type ReportCrashResp struct {
@@ -407,11 +571,24 @@ type BugReport struct {
 	ErrorLink      string
 	ErrorTruncated bool // full Error text is too large and was truncated
 	PatchLink      string
+	AutoTest       bool   // the patch was tested without a test request
+	TestManager    string // the manager that executed the "#syz test-on" job
+	TestOnTimeout  bool   // none of the "#syz test-on" managers took the job
 	BisectCause    *BisectResult
 	BisectFix      *BisectResult
 	Assets         []Asset
 	Subsystems     []BugSubsystem
 	ReportElements *ReportElements
+	// The latest discussion of the same bug in the upstream namespace, if any.
+	UpstreamDiscussion *UpstreamDiscussion
+	// The fixed bug that this bug is a regression of, if any.
+	RegressionOf *BugRegression
+	// Open bugs that this bug may be a duplicate of.
+	DupCandidates []BugLink
+	// The report experiment variant ("experiment/variant") the bug is reported with, if any.
+	Variant string
+	// InlineRepro asks to include the reproducer into the report instead of only linking it.
+	InlineRepro bool
 }
 
 type ReportElements struct {
@@ -441,6 +618,9 @@ const (
 	KernelImage        AssetType = "kernel_image"
 	HTMLCoverageReport AssetType = "html_coverage_report"
 	MountInRepro       AssetType = "mount_in_repro"
+	ReproCoverage      AssetType = "repro_coverage"
+	VMCoreExcerpt      AssetType = "vmcore_excerpt"
+	MinimizedConfig    AssetType = "minimized_config"
 )
 
 type BisectResult struct {
@@ -450,6 +630,10 @@ type BisectResult struct {
 	CrashLogLink    string
 	CrashReportLink string
 	Fix             bool
+	// Confidence is "high", "medium" or "low" (empty if unknown),
+	// ConfidenceNotes are the reasons of the lower confidence.
+	Confidence      string
+	ConfidenceNotes []string
 }
 
 type BugListReport struct {
@@ -477,6 +661,9 @@ type BugListItem struct {
 	Link       string
 	ReproLevel ReproLevel
 	Hits       int64
+	Assignee   string // the developer who claimed the bug, if any
+	// MinimizedConfig is the link to the minimized kernel config that reproduces the bug, if any.
+	MinimizedConfig string
 }
 
 type BugListUpdate struct {
@@ -509,6 +696,8 @@ type BugUpdate struct {
 	ResetFixCommits bool     // Remove all commits (empty FixCommits means leave intact).
 	FixCommits      []string // Titles of commits that fix this bug.
 	CC              []string // Additional emails to add to CC list in future emails.
+	User            string   // Who requested the update, if it comes from a person.
+	InvalidReason   string   // Why the bug is invalid, as explained by the user.
 
 	CrashID int64 // This is a deprecated field, left here for backward compatibility.
 
@@ -527,6 +716,34 @@ type BugUpdateReply struct {
 	Text  string
 }
 
+// BulkBugUpdateReq asks to apply the same action to several bugs of the namespace at once.
+type BulkBugUpdateReq struct {
+	IDs    []string // bug reporting IDs
+	Action BulkBugAction
+	User   string // who requested the update, only recorded in the audit log as is
+	DryRun bool   // only check what would happen, don't change anything
+}
+
+type BulkBugAction string
+
+const (
+	BulkBugInvalidate BulkBugAction = "invalidate"
+	BulkBugObsolete   BulkBugAction = "obsolete"
+	BulkBugUpstream   BulkBugAction = "upstream"
+)
+
+// MaxBulkBugUpdate is the maximum number of bugs in a single BulkBugUpdateReq.
+const MaxBulkBugUpdate = 100
+
+type BulkBugUpdateResp struct {
+	Results []BugUpdateResult
+}
+
+type BugUpdateResult struct {
+	ID string
+	BugUpdateReply
+}
+
 type PollBugsRequest struct {
 	Type string
 }
@@ -573,8 +790,9 @@ type PollClosedResponse struct {
 type DiscussionSource string
 
 const (
-	NoDiscussion   DiscussionSource = ""
-	DiscussionLore DiscussionSource = "lore"
+	NoDiscussion        DiscussionSource = ""
+	DiscussionLore      DiscussionSource = "lore"
+	DiscussionPatchwork DiscussionSource = "patchwork"
 )
 
 type DiscussionType string
@@ -584,6 +802,18 @@ const (
 	DiscussionPatch  DiscussionType = "patch"
 )
 
+// AttachmentReason tells why a discussion is attached to a bug.
+type AttachmentReason string
+
+const (
+	AttachUnknown    AttachmentReason = "unknown"     // attached before the reasons were recorded
+	AttachAddress    AttachmentReason = "address"     // the bug address is among the recipients
+	AttachReportedBy AttachmentReason = "reported-by" // the Reported-by tag mentions the bug
+	AttachBody       AttachmentReason = "body"        // the bug address or link is in the message body
+	AttachTitle      AttachmentReason = "title"       // the subject matches the bug title
+	AttachAPI        AttachmentReason = "api"         // reported via API without a specific reason
+)
+
 type Discussion struct {
 	ID       string
 	Source   DiscussionSource
@@ -591,12 +821,39 @@ type Discussion struct {
 	Subject  string
 	BugIDs   []string
 	Messages []DiscussionMessage
+	// BugReasons optionally maps BugIDs to the reasons they were attached for (AttachAPI by default).
+	BugReasons map[string]AttachmentReason
+	// PatchState is the optional state of the patch in a patch tracking system (e.g. "accepted").
+	PatchState string
+	// TargetTree is the optional alias of the kernel tree the patch targets (e.g. "net-next").
+	TargetTree string
 }
 
 type DiscussionMessage struct {
-	ID       string
-	External bool // true if the message is not from the bot itself
-	Time     time.Time
+	ID        string
+	External  bool // true if the message is not from the bot itself
+	Time      time.Time
+	AutoReply bool   // true if the message was generated by an auto-responder
+	Excerpt   string // optional short text of the message w/o quoted parts
+	Author    string // optional sender address, fully stored only for patch discussions
+}
+
+type UpstreamDiscussion struct {
+	Link         string
+	Messages     int
+	LastActivity time.Time
+}
+
+// BugRegression describes a fixed bug that crashed again on a kernel containing the fix.
+type BugRegression struct {
+	Title      string
+	Link       string
+	FixCommits []Commit // only Title and Hash are set
+}
+
+type BugLink struct {
+	Title string
+	Link  string
 }
 
 type SaveDiscussionReq struct {
@@ -608,6 +865,16 @@ func (dash *Dashboard) SaveDiscussion(req *SaveDiscussionReq) error {
 	return dash.Query("save_discussion", req, nil)
 }
 
+// MaxDiscussionMessages is the maximum number of messages that can be saved in one call.
+const MaxDiscussionMessages = 100
+
+// ReportDiscussion saves a discussion that did not come from emails (e.g. a code review).
+// Unlike SaveDiscussion, the update is validated and all bug IDs must refer
+// to existing bugs of the client's namespace.
+func (dash *Dashboard) ReportDiscussion(d *Discussion) error {
+	return dash.Query("report_discussion", d, nil)
+}
+
 type TestPatchRequest struct {
 	BugID  string
 	Link   string
@@ -662,6 +929,27 @@ func (dash *Dashboard) ReportingUpdate(upd *BugUpdate) (*BugUpdateReply, error)
 	return resp, nil
 }
 
+// BulkUpdateBugs applies the action to all the bugs, MaxBulkBugUpdate bugs at a time.
+// The results are returned in the order of req.IDs.
+func (dash *Dashboard) BulkUpdateBugs(req *BulkBugUpdateReq) (*BulkBugUpdateResp, error) {
+	ret := new(BulkBugUpdateResp)
+	for ids := req.IDs; len(ids) != 0; {
+		batch := ids
+		if len(batch) > MaxBulkBugUpdate {
+			batch = batch[:MaxBulkBugUpdate]
+		}
+		ids = ids[len(batch):]
+		batchReq := *req
+		batchReq.IDs = batch
+		resp := new(BulkBugUpdateResp)
+		if err := dash.Query("bulk_update_bugs", &batchReq, resp); err != nil {
+			return nil, err
+		}
+		ret.Results = append(ret.Results, resp.Results...)
+	}
+	return ret, nil
+}
+
 func (dash *Dashboard) NewTestJob(upd *TestPatchRequest) (*TestPatchReply, error) {
 	resp := new(TestPatchReply)
 	if err := dash.Query("new_test_job", upd, resp); err != nil {
@@ -688,10 +976,43 @@ type ManagerStatsReq struct {
 	Execs             uint64
 }
 
+type ManagerStatsResp struct {
+	// Bugs the manager should focus fuzzing on (see "#syz focus").
+	Focus []FocusProgram
+}
+
+// FocusProgram is a program whose mutations the manager should prioritize until the deadline.
+type FocusProgram struct {
+	BugID string
+	Title string
+	Prog  []byte
+	Until time.Time
+}
+
 func (dash *Dashboard) UploadManagerStats(req *ManagerStatsReq) error {
 	return dash.Query("manager_stats", req, nil)
 }
 
+// UploadManagerStatsWithFocus is UploadManagerStats that also returns the bugs to focus on.
+func (dash *Dashboard) UploadManagerStatsWithFocus(req *ManagerStatsReq) (*ManagerStatsResp, error) {
+	resp := new(ManagerStatsResp)
+	err := dash.Query("manager_stats", req, resp)
+	return resp, err
+}
+
+// ManagerDescriptionsReq lists the syscall descriptions of the syzkaller revision the manager runs.
+// The dashboard uses it to find out whether reproducers of the bugs that stopped happening
+// still use valid syscalls.
+type ManagerDescriptionsReq struct {
+	Name            string
+	SyzkallerCommit string
+	Syscalls        []string
+}
+
+func (dash *Dashboard) UploadManagerDescriptions(req *ManagerDescriptionsReq) error {
+	return dash.Query("manager_descriptions", req, nil)
+}
+
 // Asset lifetime:
 // 1. syz-ci uploads it to GCS and reports to the dashboard via add_build_asset.
 // 2. dashboard periodically checks if the asset is still needed.
@@ -700,6 +1021,8 @@ func (dash *Dashboard) UploadManagerStats(req *ManagerStatsReq) error {
 type NewAsset struct {
 	DownloadURL string
 	Type        AssetType
+	// Size is the uncompressed size of the uploaded file, 0 if it's not known.
+	Size int64
 }
 
 type AddBuildAssetsReq struct {
@@ -742,6 +1065,64 @@ func (dash *Dashboard) LoadBug(id string) (*BugReport, error) {
 	return resp, err
 }
 
+// ExternalObservationReq tells that an existing bug is also observed by an external CI system.
+type ExternalObservationReq struct {
+	BugID        string // as in LoadBugReq
+	KernelCommit string
+	Count        int
+	LastSeen     time.Time
+	// ReporterTag identifies the external CI system on the bug page.
+	ReporterTag string
+}
+
+func (dash *Dashboard) ReportExternalObservation(req *ExternalObservationReq) error {
+	return dash.Query("report_external_observation", req, nil)
+}
+
+// CorpusReportReq describes the current corpus of a manager.
+// Managers send it periodically to take part in corpus transfers between managers.
+type CorpusReportReq struct {
+	Manager  string
+	Digest   string // identifies the contents of the corpus
+	Programs int
+	// Exported is CorpusReportResp.ExportDigest once the corpus is uploaded to the ExportURL.
+	Exported string
+}
+
+type CorpusReportResp struct {
+	// If set, the manager should upload its corpus.db with a PUT request to ExportURL
+	// and report ExportDigest in the next CorpusReportReq.Exported.
+	ExportURL    string
+	ExportDigest string
+	// If set, the manager should download the corpus, add the programs to its corpus
+	// and report the result with CorpusImportDone.
+	Import *CorpusImport
+}
+
+type CorpusImport struct {
+	ID     string
+	Source string // namespace/manager
+	URL    string
+	Digest string
+}
+
+type CorpusImportDoneReq struct {
+	ID       string // as in CorpusImport
+	Manager  string
+	Imported int // the number of the new programs
+	Error    string
+}
+
+func (dash *Dashboard) ReportCorpus(req *CorpusReportReq) (*CorpusReportResp, error) {
+	resp := new(CorpusReportResp)
+	err := dash.Query("report_corpus", req, resp)
+	return resp, err
+}
+
+func (dash *Dashboard) CorpusImportDone(req *CorpusImportDoneReq) error {
+	return dash.Query("corpus_import_done", req, nil)
+}
+
 type LoadFullBugReq struct {
 	BugID string
 }
@@ -751,6 +1132,16 @@ type FullBugInfo struct {
 	BisectCause *BugReport
 	BisectFix   *BugReport
 	Crashes     []*BugReport
+	Discussions []*BugDiscussion
+}
+
+type BugDiscussion struct {
+	Source      DiscussionSource
+	Type        DiscussionType
+	Subject     string
+	Link        string
+	Reason      AttachmentReason
+	LastMessage time.Time
 }
 
 type SimilarBugInfo struct {
@@ -769,6 +1160,44 @@ func (dash *Dashboard) LoadFullBug(req *LoadFullBugReq) (*FullBugInfo, error) {
 	return resp, err
 }
 
+type LoadBisectionsReq struct {
+	Namespace string
+	Since     time.Time // only return bisections that finished after this time
+	Cursor    string    // LoadBisectionsResp.Cursor of the previous page
+}
+
+type LoadBisectionsResp struct {
+	Bisections []*BisectionResult
+	Cursor     string // empty if this is the last page
+}
+
+// BisectionResult is a finished cause or fix bisection of a bug.
+type BisectionResult struct {
+	BugID    string
+	BugTitle string
+	Type     ReportType // ReportBisectCause or ReportBisectFix
+	// A single commit if the bisection was successful, several commits if it had to skip
+	// some commits (e.g. due to broken builds) and ended up with a range of suspects.
+	// No commits means the bug still happens on HEAD (fix bisection) or already happened
+	// on the oldest tested release (cause bisection).
+	Commits         []Commit
+	Flags           JobDoneFlags
+	CrashReportLink string // report of the crash that was bisected
+	Finished        time.Time
+}
+
+// LoadBisections returns finished bisections ordered by the finish time, a page at a time.
+func (dash *Dashboard) LoadBisections(ns string, since time.Time, cursor string) (*LoadBisectionsResp, error) {
+	req := &LoadBisectionsReq{
+		Namespace: ns,
+		Since:     since,
+		Cursor:    cursor,
+	}
+	resp := new(LoadBisectionsResp)
+	err := dash.Query("load_bisections", req, resp)
+	return resp, err
+}
+
 type UpdateReportReq struct {
 	BugID       string
 	CrashID     int64
@@ -811,6 +1240,12 @@ const (
 	BugNotifObsoleted
 	// Bug fixing commit can't be discovered (wrong commit title).
 	BugNotifBadCommit
+	// Bug was assigned to subsystems whose mailing lists have not seen it yet.
+	// Text is the |-delimited list of the new recipients.
+	// If the action succeeds, reporting sends BugStatusOpen update with the recipients in CC.
+	BugNotifSubsystemLists
+	// Bug was renamed by an admin. Text is the former title of the bug.
+	BugNotifRenamed
 )
 
 const (
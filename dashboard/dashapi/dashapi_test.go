@@ -0,0 +1,189 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package dashapi
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReportDiscussion(t *testing.T) {
+	d := &Discussion{
+		ID:      "review-1",
+		Source:  DiscussionLore,
+		Type:    DiscussionPatch,
+		Subject: "A fix",
+		BugIDs:  []string{"abcd"},
+		Messages: []DiscussionMessage{
+			{ID: "review-1", External: true, Time: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	var got *Discussion
+	doer := func(r *http.Request) (*http.Response, error) {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		if method := r.PostForm.Get("method"); method != "report_discussion" {
+			return nil, fmt.Errorf("unexpected method %q", method)
+		}
+		gz, err := gzip.NewReader(strings.NewReader(r.PostForm.Get("payload")))
+		if err != nil {
+			return nil, err
+		}
+		got = new(Discussion)
+		if err := json.NewDecoder(gz).Decode(got); err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+	dash, err := NewCustom("client", "http://dashboard", "key", http.NewRequest, doer, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dash.ReportDiscussion(d); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(d, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestReportDiscussionError(t *testing.T) {
+	doer := func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Status:     "500 Internal Server Error",
+			StatusCode: http.StatusInternalServerError,
+			Body:       io.NopCloser(strings.NewReader("unknown bug ID")),
+		}, nil
+	}
+	dash, err := NewCustom("client", "http://dashboard", "key", http.NewRequest, doer, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dash.ReportDiscussion(&Discussion{ID: "1"})
+	if err == nil || !strings.Contains(err.Error(), "unknown bug ID") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
+
+func TestCorpusTransferHandshake(t *testing.T) {
+	// A fake dashboard that transfers the corpus of "source" to "target".
+	exported := ""
+	imported := -1
+	serve := func(method string, payload []byte) (interface{}, error) {
+		switch method {
+		case "report_corpus":
+			req := new(CorpusReportReq)
+			if err := json.Unmarshal(payload, req); err != nil {
+				return nil, err
+			}
+			resp := new(CorpusReportResp)
+			switch {
+			case req.Manager == "source" && req.Exported != "":
+				exported = req.Exported
+			case req.Manager == "source":
+				resp.ExportURL = "https://storage/corpus/source/" + req.Digest
+				resp.ExportDigest = req.Digest
+			case req.Manager == "target" && exported != "":
+				resp.Import = &CorpusImport{
+					ID:     "1",
+					Source: "ns/source",
+					URL:    "https://storage/corpus/source/" + exported,
+					Digest: exported,
+				}
+			}
+			return resp, nil
+		case "corpus_import_done":
+			req := new(CorpusImportDoneReq)
+			if err := json.Unmarshal(payload, req); err != nil {
+				return nil, err
+			}
+			if req.ID != "1" || req.Manager != "target" {
+				return nil, fmt.Errorf("unexpected import %+v", req)
+			}
+			imported = req.Imported
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unexpected method %q", method)
+	}
+	doer := func(r *http.Request) (*http.Response, error) {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(strings.NewReader(r.PostForm.Get("payload")))
+		if err != nil {
+			return nil, err
+		}
+		payload, err := io.ReadAll(gz)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := serve(r.PostForm.Get("method"), payload)
+		if err != nil {
+			return &http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Body:       io.NopCloser(strings.NewReader(err.Error())),
+			}, nil
+		}
+		data, err := json.Marshal(reply)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(string(data))),
+		}, nil
+	}
+	dash, err := NewCustom("client", "http://dashboard", "key", http.NewRequest, doer, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing to import before the source has uploaded its corpus.
+	resp, err := dash.ReportCorpus(&CorpusReportReq{Manager: "target", Digest: "t1", Programs: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&CorpusReportResp{}, resp); diff != "" {
+		t.Fatal(diff)
+	}
+	resp, err = dash.ReportCorpus(&CorpusReportReq{Manager: "source", Digest: "s1", Programs: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ExportURL != "https://storage/corpus/source/s1" || resp.ExportDigest != "s1" {
+		t.Fatalf("unexpected export request %+v", resp)
+	}
+	_, err = dash.ReportCorpus(&CorpusReportReq{Manager: "source", Digest: "s1", Programs: 100,
+		Exported: resp.ExportDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = dash.ReportCorpus(&CorpusReportReq{Manager: "target", Digest: "t1", Programs: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CorpusImport{ID: "1", Source: "ns/source", URL: "https://storage/corpus/source/s1", Digest: "s1"}
+	if diff := cmp.Diff(want, resp.Import); diff != "" {
+		t.Fatal(diff)
+	}
+	if err := dash.CorpusImportDone(&CorpusImportDoneReq{ID: resp.Import.ID, Manager: "target",
+		Imported: 90}); err != nil {
+		t.Fatal(err)
+	}
+	if imported != 90 {
+		t.Fatalf("imported %v programs, want 90", imported)
+	}
+}
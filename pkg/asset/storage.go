@@ -96,16 +96,16 @@ func (storage *Storage) assetPath(name string, extra *ExtraUploadArg) string {
 }
 
 func (storage *Storage) uploadFileStream(reader io.Reader, assetType dashapi.AssetType,
-	name string, extra *ExtraUploadArg) (string, error) {
+	name string, extra *ExtraUploadArg) (string, int64, error) {
 	if name == "" {
-		return "", fmt.Errorf("file name is not specified")
+		return "", 0, fmt.Errorf("file name is not specified")
 	}
 	typeDescr := GetTypeDescription(assetType)
 	if typeDescr == nil {
-		return "", fmt.Errorf("asset type %s is unknown", assetType)
+		return "", 0, fmt.Errorf("asset type %s is unknown", assetType)
 	}
 	if !storage.AssetTypeEnabled(assetType) {
-		return "", fmt.Errorf("not allowed to upload an asset of type %s: %w",
+		return "", 0, fmt.Errorf("not allowed to upload an asset of type %s: %w",
 			assetType, ErrAssetTypeDisabled)
 	}
 	path := storage.assetPath(name, extra)
@@ -122,33 +122,43 @@ func (storage *Storage) uploadFileStream(reader io.Reader, assetType dashapi.Ass
 	if typeDescr.customCompressor != nil {
 		compressor = typeDescr.customCompressor
 	}
+	if typeDescr.MaxSize != 0 {
+		reader = io.LimitReader(reader, typeDescr.MaxSize+1)
+	}
 	res, err := compressor(req, storage.backend.upload)
+	var written int64
 	if existsErr, ok := err.(*FileExistsError); ok {
 		storage.tracer.Log("asset %s already exists", path)
 		if extra == nil || !extra.SkipIfExists {
-			return "", err
+			return "", 0, err
 		}
 		// Let's just return the download URL.
-		return storage.backend.downloadURL(existsErr.Path, storage.cfg.PublicAccess)
+		url, err := storage.backend.downloadURL(existsErr.Path, storage.cfg.PublicAccess)
+		return url, 0, err
 	} else if err != nil {
-		return "", fmt.Errorf("failed to query writer: %w", err)
+		return "", 0, fmt.Errorf("failed to query writer: %w", err)
 	} else {
-		written, err := io.Copy(res.writer, reader)
+		written, err = io.Copy(res.writer, reader)
 		if err != nil {
 			more := ""
 			closeErr := res.writer.Close()
 			if exiterr, ok := closeErr.(*exec.ExitError); ok {
 				more = fmt.Sprintf(", process state '%s'", exiterr.ProcessState)
 			}
-			return "", fmt.Errorf("failed to redirect byte stream: copied %d bytes, error %w%s",
+			return "", 0, fmt.Errorf("failed to redirect byte stream: copied %d bytes, error %w%s",
 				written, err, more)
 		}
 		err = res.writer.Close()
 		if err != nil {
-			return "", fmt.Errorf("failed to close writer: %w", err)
+			return "", 0, fmt.Errorf("failed to close writer: %w", err)
+		}
+		if typeDescr.MaxSize != 0 && written > typeDescr.MaxSize {
+			// The truncated file is not reported and will be deleted as not needed.
+			return "", 0, fmt.Errorf("the %v asset is bigger than %v bytes", assetType, typeDescr.MaxSize)
 		}
 	}
-	return storage.backend.downloadURL(res.path, storage.cfg.PublicAccess)
+	url, err := storage.backend.downloadURL(res.path, storage.cfg.PublicAccess)
+	return url, written, err
 }
 
 func (storage *Storage) UploadBuildAsset(reader io.Reader, fileName string, assetType dashapi.AssetType,
@@ -164,13 +174,14 @@ func (storage *Storage) UploadBuildAsset(reader io.Reader, fileName string, asse
 		strings.TrimSuffix(baseName, fileExt),
 		commit,
 		fileExt)
-	url, err := storage.uploadFileStream(reader, assetType, name, extra)
+	url, size, err := storage.uploadFileStream(reader, assetType, name, extra)
 	if err != nil {
 		return dashapi.NewAsset{}, err
 	}
 	return dashapi.NewAsset{
 		Type:        assetType,
 		DownloadURL: url,
+		Size:        size,
 	}, nil
 }
 func (storage *Storage) ReportBuildAssets(build *dashapi.Build, assets ...dashapi.NewAsset) error {
@@ -184,13 +195,14 @@ func (storage *Storage) ReportBuildAssets(build *dashapi.Build, assets ...dashap
 
 func (storage *Storage) UploadCrashAsset(reader io.Reader, fileName string, assetType dashapi.AssetType,
 	extra *ExtraUploadArg) (dashapi.NewAsset, error) {
-	url, err := storage.uploadFileStream(reader, assetType, fileName, extra)
+	url, size, err := storage.uploadFileStream(reader, assetType, fileName, extra)
 	if err != nil {
 		return dashapi.NewAsset{}, err
 	}
 	return dashapi.NewAsset{
 		Type:        assetType,
 		DownloadURL: url,
+		Size:        size,
 	}, nil
 }
 
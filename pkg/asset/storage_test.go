@@ -351,3 +351,38 @@ func TestUploadSameContent(t *testing.T) {
 			asset.DownloadURL, assetTwo.DownloadURL)
 	}
 }
+
+func TestUploadSizeLimit(t *testing.T) {
+	dashMock := newDashMock()
+	storage, be := makeStorage(t, dashMock.getDashapi())
+	var file *uploadedFile
+	be.objectUpload = collectBytes(&file)
+	maxSize := GetTypeDescription(dashapi.VMCoreExcerpt).MaxSize
+
+	small := bytes.Repeat([]byte{0xaa}, 1000)
+	asset, err := storage.UploadCrashAsset(bytes.NewReader(small), "vmcore", dashapi.VMCoreExcerpt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Size != int64(len(small)) {
+		t.Fatalf("got size %v, want %v", asset.Size, len(small))
+	}
+	if err := validateXz(file, small); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = storage.UploadCrashAsset(io.LimitReader(zeroReader{}, maxSize+1), "vmcore",
+		dashapi.VMCoreExcerpt, nil)
+	if err == nil || !strings.Contains(err.Error(), "is bigger than") {
+		t.Fatalf("expected a size error, got %v", err)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -4,6 +4,8 @@
 package asset
 
 import (
+	"sort"
+
 	"github.com/google/syzkaller/dashboard/dashapi"
 	"github.com/google/syzkaller/sys/targets"
 )
@@ -15,6 +17,7 @@ type TypeDescription struct {
 	ContentEncoding   string
 	ReportingPrio     int // the smaller, the higher the asset is on the list during reporting
 	NoReporting       bool
+	MaxSize           int64 // the max uncompressed size, 0 means no limit
 	customCompressor  Compressor
 	preserveExtension bool
 }
@@ -57,6 +60,26 @@ var assetTypes = map[dashapi.AssetType]*TypeDescription{
 		// the omnipresent gzip compression.
 		customCompressor: gzipCompressor,
 	},
+	dashapi.ReproCoverage: {
+		GetTitle:         constTitle("repro coverage"),
+		ContentType:      "text/plain",
+		ContentEncoding:  "gzip",
+		NoReporting:      true,
+		customCompressor: gzipCompressor,
+	},
+	dashapi.VMCoreExcerpt: {
+		GetTitle: constTitle("vmcore excerpt"),
+		// Crash dumps contain kernel memory contents, they must never get into public reports.
+		NoReporting: true,
+		MaxSize:     64 << 20,
+	},
+	dashapi.MinimizedConfig: {
+		GetTitle:         constTitle("minimized config"),
+		ReportingPrio:    6,
+		ContentType:      "text/plain",
+		ContentEncoding:  "gzip",
+		customCompressor: gzipCompressor,
+	},
 }
 
 type QueryTypeTitle func(*targets.Target) string
@@ -70,3 +93,13 @@ func constTitle(title string) QueryTypeTitle {
 func GetTypeDescription(assetType dashapi.AssetType) *TypeDescription {
 	return assetTypes[assetType]
 }
+
+// AllTypes returns all known asset types in a stable order.
+func AllTypes() []dashapi.AssetType {
+	var ret []dashapi.AssetType
+	for typ := range assetTypes {
+		ret = append(ret, typ)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
@@ -6,6 +6,7 @@ package bisect
 import (
 	"fmt"
 	"os"
+	"path"
 	"time"
 
 	"github.com/google/syzkaller/pkg/build"
@@ -33,6 +34,15 @@ type Config struct {
 	Manager         *mgrconfig.Config
 	BuildSemaphore  *instance.Semaphore
 	TestSemaphore   *instance.Semaphore
+	// BuildOnly bisects a kernel build failure instead of a crash:
+	// the commits that fail to build are bad, the reproducer is not used.
+	BuildOnly bool
+	// ConfigOnly only minimizes the kernel config against Kernel.BaselineConfig
+	// on the original commit, no commits are bisected. Result.Config is the minimized config.
+	ConfigOnly bool
+	// TestRepeats is the number of test rounds per commit (0 means 1). More rounds make
+	// the verdicts for flaky reproducers more reliable at the cost of the bisection time.
+	TestRepeats int
 }
 
 type KernelConfig struct {
@@ -79,6 +89,8 @@ type env struct {
 	buildTime    time.Duration
 	testTime     time.Duration
 	flaky        bool
+	origRep      *report.Report
+	revisions    []Revision
 }
 
 const MaxNumTests = 20 // number of tests we do per commit
@@ -102,6 +114,10 @@ const MaxNumTests = 20 // number of tests we do per commit
 //   - Commit points to the oldest/latest commit where crash happens.
 //
 // 4. Config contains kernel config used for bisection.
+//
+// 5. Revisions contains the test results of all tested commits in the order of testing.
+//   - if bisection is conclusive, GuiltyFile is the guilty file of the crash (if known)
+//     and TouchesGuiltyFile says if the commit changes files in the guilty file directory
 type Result struct {
 	Commits    []*vcs.Commit
 	Report     *report.Report
@@ -109,6 +125,19 @@ type Result struct {
 	Config     []byte
 	NoopChange bool
 	IsRelease  bool
+	Revisions  []Revision
+	GuiltyFile string
+	// TouchesGuiltyFile is set if the single commit changes a file in the directory of GuiltyFile.
+	TouchesGuiltyFile bool
+}
+
+// Revision is the test result of a single commit.
+type Revision struct {
+	Commit  string
+	Runs    int  // the number of test runs
+	Crashes int  // the number of runs that crashed
+	Errors  int  // the number of runs that failed to boot or hit an infrastructure error
+	Skipped bool // the commit got the skip verdict (e.g. it failed to build)
 }
 
 // Run does the bisection and returns either the Result,
@@ -141,6 +170,9 @@ func runImpl(cfg *Config, repo vcs.Repo, inst instance.Env) (*Result, error) {
 	if !ok && len(cfg.Kernel.BaselineConfig) != 0 {
 		return nil, fmt.Errorf("config minimization is not implemented for %v", cfg.Manager.TargetOS)
 	}
+	if cfg.ConfigOnly && len(cfg.Kernel.BaselineConfig) == 0 {
+		return nil, fmt.Errorf("config minimization requires a baseline config")
+	}
 	env := &env{
 		cfg:       cfg,
 		repo:      repo,
@@ -160,13 +192,18 @@ func runImpl(cfg *Config, repo vcs.Repo, inst instance.Env) (*Result, error) {
 		hostname = "unnamed host"
 	}
 	env.log("%s starts bisection %s", hostname, env.startTime.String())
-	if cfg.Fix {
+	if cfg.ConfigOnly {
+		env.log("minimizing kernel config on %v", cfg.Kernel.Commit)
+	} else if cfg.Fix {
 		env.log("bisecting fixing commit since %v", cfg.Kernel.Commit)
 	} else {
 		env.log("bisecting cause commit starting from %v", cfg.Kernel.Commit)
 	}
 	start := time.Now()
 	res, err := env.bisect()
+	if res != nil {
+		res.Revisions = env.revisions
+	}
 	if env.flaky {
 		env.log("Reproducer flagged being flaky")
 	}
@@ -176,6 +213,9 @@ func runImpl(cfg *Config, repo vcs.Repo, inst instance.Env) (*Result, error) {
 		env.log("error: %v", err)
 		return nil, err
 	}
+	if cfg.ConfigOnly {
+		return res, nil
+	}
 	if len(res.Commits) == 0 {
 		if cfg.Fix {
 			env.log("the crash still happens on HEAD")
@@ -204,9 +244,32 @@ func runImpl(cfg *Config, repo vcs.Repo, inst instance.Env) (*Result, error) {
 	if res.Report != nil {
 		env.log("crash: %v\n%s", res.Report.Title, res.Report.Report)
 	}
+	env.checkGuiltyFile(res, com)
 	return res, nil
 }
 
+// checkGuiltyFile checks whether the culprit commit is related to the guilty file of the crash,
+// an unrelated culprit is a sign of a wrong bisection result.
+func (env *env) checkGuiltyFile(res *Result, com *vcs.Commit) {
+	for _, rep := range []*report.Report{env.origRep, res.Report} {
+		if rep != nil && rep.GuiltyFile != "" {
+			res.GuiltyFile = rep.GuiltyFile
+			break
+		}
+	}
+	if res.GuiltyFile == "" || len(com.Parents) == 0 {
+		return
+	}
+	dir := path.Dir(res.GuiltyFile)
+	commits, err := env.repo.CommitsTouching(com.Parents[0], com.Hash, dir, 1)
+	if err != nil {
+		env.log("failed to check the files of the commit: %v", err)
+		return
+	}
+	res.TouchesGuiltyFile = len(commits) != 0
+	env.log("guilty file: %v, the commit changes %v: %v", res.GuiltyFile, dir, res.TouchesGuiltyFile)
+}
+
 func (env *env) bisect() (*Result, error) {
 	err := env.bisecter.PrepareBisect()
 	if err != nil {
@@ -218,9 +281,11 @@ func (env *env) bisect() (*Result, error) {
 		cfg.Manager.Type, cfg.Manager.KernelSrc); err != nil {
 		return nil, fmt.Errorf("kernel clean failed: %v", err)
 	}
-	env.log("building syzkaller on %v", cfg.Syzkaller.Commit)
-	if _, err := env.inst.BuildSyzkaller(cfg.Syzkaller.Repo, cfg.Syzkaller.Commit); err != nil {
-		return nil, err
+	if !cfg.BuildOnly {
+		env.log("building syzkaller on %v", cfg.Syzkaller.Commit)
+		if _, err := env.inst.BuildSyzkaller(cfg.Syzkaller.Repo, cfg.Syzkaller.Commit); err != nil {
+			return nil, err
+		}
 	}
 
 	cfg.Kernel.Commit, err = env.identifyRewrittenCommit()
@@ -242,7 +307,7 @@ func (env *env) bisect() (*Result, error) {
 		return nil, fmt.Errorf("the crash wasn't reproduced on the original commit")
 	}
 
-	if len(cfg.Kernel.BaselineConfig) != 0 {
+	if len(cfg.Kernel.BaselineConfig) != 0 && !cfg.BuildOnly {
 		testRes1, err := env.minimizeConfig()
 		if err != nil {
 			return nil, err
@@ -250,6 +315,12 @@ func (env *env) bisect() (*Result, error) {
 		if testRes1 != nil {
 			testRes = testRes1
 		}
+		// The config minimization tests are not bisection revisions.
+		env.revisions = []Revision{testRes.revision()}
+	}
+	env.origRep = testRes.rep
+	if cfg.ConfigOnly {
+		return &Result{Report: testRes.rep, Commit: com, Config: env.kernelConfig}, nil
 	}
 
 	bad, good, rep1, results1, err := env.commitRange()
@@ -461,6 +532,19 @@ type testResult struct {
 	com        *vcs.Commit
 	rep        *report.Report
 	kernelSign string
+	runs       int
+	crashes    int
+	errors     int
+}
+
+func (res *testResult) revision() Revision {
+	return Revision{
+		Commit:  res.com.Hash,
+		Runs:    res.runs,
+		Crashes: res.crashes,
+		Errors:  res.errors,
+		Skipped: res.verdict == vcs.BisectSkip,
+	}
 }
 
 func (env *env) build() (*vcs.Commit, string, error) {
@@ -503,6 +587,14 @@ func (env *env) build() (*vcs.Commit, string, error) {
 // Note: When this function returns an error, the bisection it was called from is aborted.
 // Hence recoverable errors must be handled and the callers must treat testResult with care.
 func (env *env) test() (*testResult, error) {
+	res, err := env.testCommit()
+	if err == nil {
+		env.revisions = append(env.revisions, res.revision())
+	}
+	return res, err
+}
+
+func (env *env) testCommit() (*testResult, error) {
 	cfg := env.cfg
 	if cfg.Timeout != 0 && time.Since(env.startTime) > cfg.Timeout {
 		return nil, fmt.Errorf("bisection is taking too long (>%v), aborting", cfg.Timeout)
@@ -517,6 +609,17 @@ func (env *env) test() (*testResult, error) {
 		// This is not recoverable, as the caller must know which commit to skip.
 		return res, fmt.Errorf("couldn't get repo HEAD: %v", err)
 	}
+	if verr, ok := err.(*build.KernelError); ok && cfg.BuildOnly {
+		env.log("%s", verr.Report)
+		env.saveDebugFile(current.Hash, 0, verr.Output)
+		res.verdict = vcs.BisectBad
+		res.rep = &report.Report{
+			Title:  "kernel build error",
+			Report: verr.Report,
+			Output: verr.Output,
+		}
+		return res, nil
+	}
 	if err != nil {
 		if verr, ok := err.(*osutil.VerboseError); ok {
 			env.log("%v", verr.Title)
@@ -529,6 +632,10 @@ func (env *env) test() (*testResult, error) {
 		}
 		return res, nil
 	}
+	if cfg.BuildOnly {
+		res.verdict = vcs.BisectGood
+		return res, nil
+	}
 
 	numTests := MaxNumTests / 2
 	if env.flaky || env.numTests == 0 {
@@ -540,14 +647,20 @@ func (env *env) test() (*testResult, error) {
 
 	testStart := time.Now()
 
-	results, err := env.inst.Test(numTests, cfg.Repro.Syz, cfg.Repro.Opts, cfg.Repro.C)
-	env.testTime += time.Since(testStart)
-	if err != nil {
-		env.log("failed: %v", err)
-		return res, nil
+	var results []instance.EnvTestResult
+	for i := 0; i == 0 || i < cfg.TestRepeats; i++ {
+		roundResults, err := env.inst.Test(numTests, cfg.Repro.Syz, cfg.Repro.Opts, cfg.Repro.C)
+		if err != nil {
+			env.testTime += time.Since(testStart)
+			env.log("failed: %v", err)
+			return res, nil
+		}
+		results = append(results, roundResults...)
 	}
+	env.testTime += time.Since(testStart)
 	bad, good, rep := env.processResults(current, results)
 	res.rep = rep
+	res.runs, res.crashes, res.errors = len(results), bad, len(results)-good-bad
 	res.verdict = vcs.BisectSkip
 	if bad != 0 {
 		res.verdict = vcs.BisectBad
@@ -44,6 +44,9 @@ func (env *testEnv) BuildKernel(buildCfg *instance.BuildKernelConfig) (string, b
 	if env.config == "baseline-fails" {
 		return "", details, fmt.Errorf("failure")
 	}
+	if env.test.buildOnly && commit >= env.test.culprit {
+		return "", details, &build.KernelError{Report: []byte("error: build broken")}
+	}
 	return "", details, nil
 }
 
@@ -118,8 +121,11 @@ func testBisection(t *testing.T, baseDir string, test BisectionTest) {
 		t.Fatal(err)
 	}
 	cfg := &Config{
-		Fix:   test.fix,
-		Trace: &debugtracer.TestTracer{T: t},
+		Fix:         test.fix,
+		BuildOnly:   test.buildOnly,
+		ConfigOnly:  test.configOnly,
+		TestRepeats: test.testRepeats,
+		Trace:       &debugtracer.TestTracer{T: t},
 		Manager: &mgrconfig.Config{
 			Derived: mgrconfig.Derived{
 				TargetOS:     targets.TestOS,
@@ -190,12 +196,22 @@ func checkBisectionResult(t *testing.T, test BisectionTest, res *Result) {
 		t.Fatalf("expected resulting config: %q got %q",
 			test.resultingConfig, res.Config)
 	}
+	if len(res.Revisions) == 0 {
+		t.Fatalf("no tested revisions")
+	}
+	for _, rev := range res.Revisions {
+		if test.testRepeats != 0 && rev.Runs%test.testRepeats != 0 {
+			t.Fatalf("revision %v: %v runs with %v test repeats", rev.Commit, rev.Runs, test.testRepeats)
+		}
+	}
 }
 
 type BisectionTest struct {
 	// input environment
 	name        string
 	fix         bool
+	buildOnly   bool
+	configOnly  bool
 	startCommit int
 	brokenStart int
 	brokenEnd   int
@@ -208,6 +224,7 @@ type BisectionTest struct {
 	noopChange   bool
 	isRelease    bool
 	flaky        bool
+	testRepeats  int
 	commitLen    int
 	oldestLatest int
 	// input and output
@@ -217,6 +234,24 @@ type BisectionTest struct {
 }
 
 var bisectionTests = []BisectionTest{
+	// Tests that build-only bisection finds the commit that broke the build.
+	{
+		name:        "cause-build-only",
+		buildOnly:   true,
+		startCommit: 905,
+		commitLen:   1,
+		expectRep:   true,
+		culprit:     602,
+	},
+	// Tests that bisection with several test rounds per commit returns the correct cause commit.
+	{
+		name:        "cause-test-repeats",
+		startCommit: 905,
+		testRepeats: 3,
+		commitLen:   1,
+		expectRep:   true,
+		culprit:     602,
+	},
 	// Tests that bisection returns the correct cause commit.
 	{
 		name:        "cause-finds-cause",
@@ -297,6 +332,36 @@ var bisectionTests = []BisectionTest{
 		baselineConfig:  "minimize-succeeds",
 		resultingConfig: "new-minimized-config",
 	},
+	// Tests that config-only minimization does not bisect commits.
+	{
+		name:            "config-only-minimize-succeeds",
+		configOnly:      true,
+		startCommit:     905,
+		commitLen:       0,
+		expectRep:       true,
+		culprit:         602,
+		oldestLatest:    905,
+		baselineConfig:  "minimize-succeeds",
+		resultingConfig: "new-minimized-config",
+	},
+	{
+		name:            "config-only-baseline-repro",
+		configOnly:      true,
+		startCommit:     905,
+		commitLen:       0,
+		expectRep:       true,
+		culprit:         602,
+		oldestLatest:    905,
+		baselineConfig:  "baseline-repro",
+		resultingConfig: "baseline-repro",
+	},
+	{
+		name:        "config-only-no-baseline",
+		configOnly:  true,
+		startCommit: 905,
+		culprit:     602,
+		expectErr:   true,
+	},
 	// Tests that cause bisection returns error when crash does not reproduce
 	// on the original commit.
 	{
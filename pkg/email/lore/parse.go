@@ -87,10 +87,17 @@ func (c *parseCtx) first(msg *email.Email) *email.Email {
 		if msg.InReplyTo == "" {
 			return msg
 		}
-		msg = c.messages[msg.InReplyTo]
-		if msg == nil {
+		var parent *email.Email
+		// Skip the parents we don't know, e.g. forwarded copies of thread messages.
+		for _, id := range msg.Parents() {
+			if parent = c.messages[id]; parent != nil {
+				break
+			}
+		}
+		if parent == nil {
 			// Probably we just didn't load the message.
 			return nil
 		}
+		msg = parent
 	}
 }
@@ -44,6 +44,18 @@ In-Reply-To: <A-Child-1>
 
 
 Some reply (2)`,
+		// A reply to a forward of <A-Base> that we have not seen.
+		`Date: Sun, 7 May 2017 19:56:30 -0700
+Subject: Re: Fwd: Thread A
+Message-ID: <A-Child-2>
+From: UserD <d@user.com>
+To: UserA <a@user.com>
+Content-Type: text/plain
+In-Reply-To: <A-Forward>
+References: <A-Base> <A-Forward>
+
+
+Some reply to the forward`,
 		// <Bug> with two children: <Bug-Reply1>, <Bug-Reply2>.
 		`Date: Sun, 7 May 2017 19:57:00 -0700
 Subject: [syzbot] Some bug
@@ -117,6 +129,16 @@ Patch`,
 					InReplyTo: "<A-Child-1>",
 					Command:   email.CmdNone,
 				},
+				{
+					MessageID:  "<A-Child-2>",
+					Subject:    "Re: Fwd: Thread A",
+					Date:       time.Date(2017, time.May, 7, 19, 56, 30, 0, zone),
+					Author:     "d@user.com",
+					Cc:         []string{"a@user.com", "d@user.com"},
+					InReplyTo:  "<A-Forward>",
+					References: []string{"<A-Base>", "<A-Forward>"},
+					Command:    email.CmdNone,
+				},
 			},
 		},
 		"<Bug>": {
@@ -0,0 +1,144 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package lore
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/email"
+)
+
+// Series is a patch series reconstructed from the messages of a thread.
+type Series struct {
+	Version int
+	Total   int
+	Patches []*email.Email // ordered by the patch number
+	Missing []int          // numbers of the patches that were not found
+}
+
+// E.g. "[PATCH v2 03/10]" or "[RFC PATCH net-next 1/2]".
+var seriesSubjectRe = regexp.MustCompile(`^\s*\[([^\]]*?)\s*\b(\d+)/(\d+)\s*\]`)
+var seriesVersionRe = regexp.MustCompile(`\bv(\d+)\b`)
+
+// seriesPosition extracts the version (1 by default), the number and the total number of patches
+// from the subject of a series message. It returns ok=false for replies and unnumbered messages.
+func seriesPosition(subject string) (version, num, total int, ok bool) {
+	match := seriesSubjectRe.FindStringSubmatch(subject)
+	if match == nil {
+		return
+	}
+	version = 1
+	if ver := seriesVersionRe.FindStringSubmatch(match[1]); ver != nil {
+		version, _ = strconv.Atoi(ver[1])
+	}
+	num, _ = strconv.Atoi(match[2])
+	total, _ = strconv.Atoi(match[3])
+	ok = total != 0 && num <= total
+	return
+}
+
+// PatchSeries reconstructs the patch series the msgID message belongs to.
+// The message may be the cover letter or any of the patches. Other versions
+// of the series and the replies in the same thread are ignored.
+func PatchSeries(msgs []*email.Email, msgID string) (*Series, error) {
+	var target *email.Email
+	for _, msg := range msgs {
+		if msg.MessageID == msgID {
+			target = msg
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("message %v was not found", msgID)
+	}
+	version, _, total, ok := seriesPosition(target.Subject)
+	if !ok {
+		if target.Patch == "" {
+			return nil, fmt.Errorf("message %v does not contain a patch", msgID)
+		}
+		return &Series{Version: 1, Total: 1, Patches: []*email.Email{target}}, nil
+	}
+	byNum := map[int]*email.Email{}
+	for _, msg := range msgs {
+		msgVersion, num, msgTotal, ok := seriesPosition(msg.Subject)
+		if !ok || msgVersion != version || msgTotal != total || num == 0 || msg.Patch == "" {
+			continue
+		}
+		// If the patch was resent, take the first copy.
+		if prev := byNum[num]; prev == nil || msg.Date.Before(prev.Date) {
+			byNum[num] = msg
+		}
+	}
+	if len(byNum) == 0 {
+		return nil, fmt.Errorf("no patches of the series were found")
+	}
+	series := &Series{Version: version, Total: total}
+	for num := 1; num <= total; num++ {
+		if msg := byNum[num]; msg != nil {
+			series.Patches = append(series.Patches, msg)
+		} else {
+			series.Missing = append(series.Missing, num)
+		}
+	}
+	return series, nil
+}
+
+// Diff returns the patches of the series concatenated in order.
+// Each diff is preceded by the subject of its message, the patch utility ignores such lines,
+// but it makes it easy to find out which of the patches did not apply.
+func (s *Series) Diff() string {
+	var diff strings.Builder
+	for _, msg := range s.Patches {
+		fmt.Fprintf(&diff, "%v\n\n%v", msg.Subject, msg.Patch)
+	}
+	return diff.String()
+}
+
+// MessageIDFromLink extracts the Message-ID from a link to a lore message or thread,
+// e.g. https://lore.kernel.org/r/<msgid> or https://lore.kernel.org/linux-mm/<msgid>/T/#u.
+func MessageIDFromLink(link string) (string, error) {
+	if !strings.HasPrefix(link, email.LoreLinkPrefix) {
+		return "", fmt.Errorf("%q is not a lore link", link)
+	}
+	parts := strings.Split(strings.TrimPrefix(link, email.LoreLinkPrefix), "/")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("%q does not reference a message", link)
+	}
+	id, err := url.PathUnescape(parts[1])
+	if err != nil || !strings.Contains(id, "@") || strings.ContainsAny(id, "<> ") {
+		return "", fmt.Errorf("%q does not reference a message", link)
+	}
+	return "<" + id + ">", nil
+}
+
+var mboxFromRe = regexp.MustCompile(`^>+From `)
+
+// SplitMbox splits an mboxrd archive (as served by public-inbox) into individual messages.
+func SplitMbox(data []byte) [][]byte {
+	var messages []*bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("From ")) {
+			messages = append(messages, new(bytes.Buffer))
+			continue
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		if mboxFromRe.Match(line) {
+			// Undo the mboxrd quoting.
+			line = line[1:]
+		}
+		messages[len(messages)-1].Write(line)
+	}
+	var ret [][]byte
+	for _, msg := range messages {
+		ret = append(ret, msg.Bytes())
+	}
+	return ret
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package lore
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/pkg/email"
+)
+
+func TestSeriesPosition(t *testing.T) {
+	tests := []struct {
+		subject string
+		version int
+		num     int
+		total   int
+		ok      bool
+	}{
+		{"[PATCH 1/2] mm: fix a bug", 1, 1, 2, true},
+		{"[PATCH v3 02/10] mm: fix a bug", 3, 2, 10, true},
+		{"[RFC PATCH net-next v2 0/3] net: a series", 2, 0, 3, true},
+		{"[PATCH] mm: fix a bug", 0, 0, 0, false},
+		{"Re: [PATCH 1/2] mm: fix a bug", 0, 0, 0, false},
+		{"[PATCH 3/2] mm: fix a bug", 1, 3, 2, false},
+	}
+	for _, test := range tests {
+		version, num, total, ok := seriesPosition(test.subject)
+		if ok != test.ok || ok && (version != test.version || num != test.num || total != test.total) {
+			t.Errorf("%q: got %v %v/%v ok=%v, want %v %v/%v ok=%v", test.subject,
+				version, num, total, ok, test.version, test.num, test.total, test.ok)
+		}
+	}
+}
+
+func TestPatchSeries(t *testing.T) {
+	date := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	msg := func(id, subject, patch string, minutes int) *email.Email {
+		return &email.Email{
+			MessageID: id,
+			Subject:   subject,
+			Patch:     patch,
+			Date:      date.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+	thread := []*email.Email{
+		msg("<v1-0>", "[PATCH 0/3] a series", "", 0),
+		msg("<v1-3>", "[PATCH 3/3] third", "diff3", 3),
+		msg("<v1-1>", "[PATCH 1/3] first", "diff1", 1),
+		msg("<v1-2>", "[PATCH 2/3] second", "diff2", 2),
+		msg("<v1-2-re>", "Re: [PATCH 2/3] second", "quoted diff2", 10),
+		msg("<v2-1>", "[PATCH v2 1/2] first", "diff1-v2", 20),
+		msg("<v2-1-resend>", "[PATCH v2 1/2] first", "diff1-v2-resend", 30),
+		msg("<single>", "[PATCH] fix", "single diff", 40),
+		msg("<no-patch>", "a question", "", 50),
+	}
+	tests := []struct {
+		msgID   string
+		patches []string
+		version int
+		total   int
+		missing []int
+		err     string
+	}{
+		{
+			msgID:   "<v1-0>",
+			patches: []string{"<v1-1>", "<v1-2>", "<v1-3>"},
+			version: 1,
+			total:   3,
+		},
+		{
+			// Any patch of the series brings the whole series.
+			msgID:   "<v1-2>",
+			patches: []string{"<v1-1>", "<v1-2>", "<v1-3>"},
+			version: 1,
+			total:   3,
+		},
+		{
+			// The earliest copy of a resent patch is taken.
+			msgID:   "<v2-1-resend>",
+			patches: []string{"<v2-1>"},
+			version: 2,
+			total:   2,
+			missing: []int{2},
+		},
+		{
+			msgID:   "<single>",
+			patches: []string{"<single>"},
+			version: 1,
+			total:   1,
+		},
+		{
+			msgID: "<no-patch>",
+			err:   "does not contain a patch",
+		},
+		{
+			msgID: "<unknown>",
+			err:   "was not found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.msgID, func(t *testing.T) {
+			series, err := PatchSeries(thread, test.msgID)
+			if err != nil {
+				if test.err == "" || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if test.err != "" {
+				t.Fatalf("expected error %q", test.err)
+			}
+			var ids []string
+			for _, patch := range series.Patches {
+				ids = append(ids, patch.MessageID)
+			}
+			if diff := cmp.Diff(test.patches, ids); diff != "" {
+				t.Errorf("patches: %s", diff)
+			}
+			if series.Version != test.version || series.Total != test.total {
+				t.Errorf("got v%v of %v patches, want v%v of %v", series.Version, series.Total,
+					test.version, test.total)
+			}
+			if diff := cmp.Diff(test.missing, series.Missing); diff != "" {
+				t.Errorf("missing: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSeriesDiff(t *testing.T) {
+	series := &Series{Patches: []*email.Email{
+		{Subject: "[PATCH 1/2] first", Patch: "diff1\n"},
+		{Subject: "[PATCH 2/2] second", Patch: "diff2\n"},
+	}}
+	want := "[PATCH 1/2] first\n\ndiff1\n[PATCH 2/2] second\n\ndiff2\n"
+	if got := series.Diff(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplitMbox(t *testing.T) {
+	var mbox strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&mbox, "From mboxrd@z Thu Jan  1 00:00:00 1970\n"+
+			"Subject: message %v\n\n>From here on\n>>From there\n", i)
+	}
+	messages := SplitMbox([]byte(mbox.String()))
+	if len(messages) != 3 {
+		t.Fatalf("got %v messages", len(messages))
+	}
+	want := "Subject: message 1\n\nFrom here on\n>From there\n"
+	if got := string(messages[1]); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMessageIDFromLink(t *testing.T) {
+	tests := []struct {
+		link  string
+		msgID string
+	}{
+		{"https://lore.kernel.org/r/20230301-fix-v1-1@kernel.org", "<20230301-fix-v1-1@kernel.org>"},
+		{"https://lore.kernel.org/all/abc@def.com/", "<abc@def.com>"},
+		{"https://lore.kernel.org/linux-mm/abc%40def.com/T/#u", "<abc@def.com>"},
+		{"https://lore.kernel.org/linux-mm/", ""},
+		{"https://lore.kernel.org/r/not-a-message-id", ""},
+		{"https://groups.google.com/d/msgid/syzkaller/abc@def.com", ""},
+	}
+	for _, test := range tests {
+		msgID, err := MessageIDFromLink(test.link)
+		if msgID != test.msgID || (err == nil) != (test.msgID != "") {
+			t.Errorf("%q: got %q, %v, want %q", test.link, msgID, err, test.msgID)
+		}
+	}
+}
@@ -4,6 +4,7 @@
 package email
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"net/mail"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -20,8 +22,10 @@ import (
 
 type Email struct {
 	BugIDs      []string
+	BodyBugIDs  []string // BugIDs only mentioned in the body, but not in the addresses
 	MessageID   string
 	InReplyTo   string
+	References  []string // message IDs from the References header, the oldest first
 	Date        time.Time
 	Link        string
 	Subject     string
@@ -30,9 +34,45 @@ type Email struct {
 	Cc          []string
 	Body        string  // text/plain part
 	Patch       string  // attached patch, if any
+	Config      string  // attached kernel config, if any
 	Command     Command // command to bot
 	CommandStr  string  // string representation of the command
 	CommandArgs string  // arguments for the command
+	AutoReply   bool    // the message was generated by an auto-responder
+	// BodyTruncated is set if the text/plain part exceeded Limits.MaxBody.
+	BodyTruncated bool
+	// Oversized are the attachments that exceeded Limits.MaxAttachment.
+	Oversized []OversizedAttachment
+	// Attachments are the other attachments that fit into Limits.MaxAttachment,
+	// i.e. not the ones returned as Patch and Config.
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// Limits restrict the amount of email data that is kept in memory, zero values mean no limits.
+type Limits struct {
+	// Only the first MaxBody bytes of the text/plain part are kept.
+	MaxBody int
+	// Attachments larger than MaxAttachment are not kept in memory, they are listed in Email.Oversized.
+	MaxAttachment int
+	// If set, Store is given the oversized attachments, it must consume the whole reader
+	// and return a reference to the stored data. truncated is set if only a part was stored.
+	Store func(name string, r io.Reader) (ref string, truncated bool)
+}
+
+// OversizedAttachment is an attachment that exceeded Limits.MaxAttachment.
+type OversizedAttachment struct {
+	Name string
+	Size int64
+	// Ref is the reference returned by Limits.Store, it's empty if the attachment was not stored.
+	Ref       string
+	Truncated bool
+	// Patch is set if the attachment looks like a patch.
+	Patch bool
 }
 
 type Command int
@@ -50,10 +90,24 @@ const (
 	CmdUnCC
 	CmdSet
 	CmdRegenerate
+	CmdAssign
+	CmdUnAssign
+	CmdSetGuilty
+	CmdMinimize
+	CmdFocus
+	CmdMinimizeConfig
+	CmdNoRepro
+	CmdTestOn
+	CmdRetestBisect
 
 	cmdTest5
 )
 
+var messageIDRe = regexp.MustCompile(`<[^<>\s]+>`)
+
+// LoreLinkPrefix is the prefix of links to the lore.kernel.org archive messages.
+const LoreLinkPrefix = "https://lore.kernel.org/"
+
 var groupsLinkRe = regexp.MustCompile("\nTo view this discussion on the web visit" +
 	" (https://groups\\.google\\.com/.*?)\\.(?:\r)?\n")
 
@@ -69,6 +123,13 @@ func prepareEmails(list []string) map[string]bool {
 }
 
 func Parse(r io.Reader, ownEmails, goodLists, domains []string) (*Email, error) {
+	return ParseWithLimits(r, ownEmails, goodLists, domains, Limits{})
+}
+
+// ParseWithLimits is like Parse, but the MIME parts are streamed and the large ones are not kept in memory.
+// The text/plain part is extracted regardless of the size and the position of the attachments,
+// so that the commands are not lost.
+func ParseWithLimits(r io.Reader, ownEmails, goodLists, domains []string, limits Limits) (*Email, error) {
 	msg, err := mail.ReadMessage(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read email: %v", err)
@@ -123,27 +184,53 @@ func Parse(r io.Reader, ownEmails, goodLists, domains []string) (*Email, error)
 		sender = senders[0].Address
 	}
 
-	body, attachments, err := parseBody(msg.Body, msg.Header)
-	if err != nil {
+	parser := &bodyParser{limits: limits}
+	if err := parser.parse(msg.Body, msg.Header); err != nil {
 		return nil, err
 	}
+	body, attachments := parser.body, parser.attachments
 	bodyStr := string(body)
 	subject := msg.Header.Get("Subject")
 	cmd := CmdNone
-	patch, cmdStr, cmdArgs := "", "", ""
+	patch, config, cmdStr, cmdArgs := "", "", "", ""
+	var other []Attachment
 	if !fromMe {
-		for _, a := range attachments {
-			patch = ParsePatch(a)
+		patchIdx, configIdx := -1, -1
+		for i, a := range attachments {
+			patch = ParsePatch(a.Data)
 			if patch != "" {
+				patchIdx = i
 				break
 			}
 		}
 		if patch == "" {
 			patch = ParsePatch(body)
 		}
+		for i, a := range attachments {
+			if IsKernelConfig(a.Data) {
+				config = string(a.Data)
+				configIdx = i
+				break
+			}
+		}
+		for i, a := range attachments {
+			if i != patchIdx && i != configIdx {
+				other = append(other, a)
+			}
+		}
 		cmd, cmdStr, cmdArgs = extractCommand(subject + "\n" + bodyStr)
 	}
-	bugIDs = append(bugIDs, extractBodyBugIDs(bodyStr, ownAddrs, domains)...)
+	headerBugIDs := map[string]bool{}
+	for _, id := range bugIDs {
+		headerBugIDs[id] = true
+	}
+	var bodyBugIDs []string
+	for _, id := range extractBodyBugIDs(bodyStr, ownAddrs, domains) {
+		bugIDs = append(bugIDs, id)
+		if !headerBugIDs[id] {
+			bodyBugIDs = append(bodyBugIDs, id)
+		}
+	}
 
 	link := ""
 	if match := groupsLinkRe.FindStringSubmatchIndex(bodyStr); match != nil {
@@ -168,8 +255,10 @@ func Parse(r io.Reader, ownEmails, goodLists, domains []string) (*Email, error)
 	date, _ := mail.ParseDate(msg.Header.Get("Date"))
 	email := &Email{
 		BugIDs:      dedupBugIDs(bugIDs),
+		BodyBugIDs:  dedupBugIDs(bodyBugIDs),
 		MessageID:   msg.Header.Get("Message-ID"),
 		InReplyTo:   msg.Header.Get("In-Reply-To"),
+		References:  messageIDRe.FindAllString(msg.Header.Get("References"), -1),
 		Date:        date,
 		Link:        link,
 		Author:      author,
@@ -178,13 +267,76 @@ func Parse(r io.Reader, ownEmails, goodLists, domains []string) (*Email, error)
 		Cc:          ccList,
 		Body:        bodyStr,
 		Patch:       patch,
+		Config:      config,
 		Command:     cmd,
 		CommandStr:  cmdStr,
 		CommandArgs: cmdArgs,
+		AutoReply:   isAutoReply(msg.Header, subject),
+
+		BodyTruncated: parser.bodyTruncated,
+		Oversized:     parser.oversized,
+		Attachments:   other,
 	}
 	return email, nil
 }
 
+// OversizedPatch returns the oversized attachment that looks like a patch, if any.
+func (email *Email) OversizedPatch() *OversizedAttachment {
+	for i := range email.Oversized {
+		if email.Oversized[i].Patch {
+			return &email.Oversized[i]
+		}
+	}
+	return nil
+}
+
+// Parents returns the IDs of the messages the email replies to, the closest first.
+// The farther ones matter when the closest parents are unknown to us,
+// e.g. when someone replies to a forwarded copy of our message.
+func (email *Email) Parents() []string {
+	var ret []string
+	if email.InReplyTo != "" {
+		ret = append(ret, email.InReplyTo)
+	}
+	for i := len(email.References) - 1; i >= 0; i-- {
+		if id := email.References[i]; id != email.InReplyTo {
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
+
+var kernelConfigLineRe = regexp.MustCompile(`(?m)^(?:CONFIG_[A-Za-z0-9_]+=|# CONFIG_[A-Za-z0-9_]+ is not set$)`)
+
+// IsKernelConfig checks whether the attachment looks like a kernel .config file.
+func IsKernelConfig(data []byte) bool {
+	// Patches to Kconfig files and defconfigs also mention a few options.
+	const minOptions = 20
+	return ParsePatch(data) == "" && len(kernelConfigLineRe.FindAllIndex(data, minOptions)) == minOptions
+}
+
+var autoReplySubjectRe = regexp.MustCompile(`(?i)^\s*(?:automatic reply|auto[- ]?reply|` +
+	`auto[- ]?response|out of (?:the )?office)\b`)
+
+// isAutoReply detects vacation responders and other automatically generated messages.
+func isAutoReply(header mail.Header, subject string) bool {
+	// See RFC 3834.
+	if val := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted"))); val != "" && val != "no" {
+		return true
+	}
+	if header.Get("X-Autoreply") != "" || header.Get("X-Autorespond") != "" {
+		return true
+	}
+	// Mailing lists also tend to set "Precedence: bulk", so only trust it for direct emails.
+	switch strings.ToLower(strings.TrimSpace(header.Get("Precedence"))) {
+	case "bulk", "junk", "auto_reply":
+		if header.Get("List-Id") == "" {
+			return true
+		}
+	}
+	return autoReplySubjectRe.MatchString(subject)
+}
+
 // AddAddrContext embeds context into local part of the provided email address using '+'.
 // Returns the resulting email address.
 func AddAddrContext(email, context string) (string, error) {
@@ -280,15 +432,24 @@ func extractCommand(body string) (cmd Command, str, args string) {
 	// We try hard to restore what was there before.
 	// For "test:" command we know that there must be 2 tokens without spaces.
 	// For "fix:"/"dup:" we need a whole non-empty line of text.
+	// For "invalid" the optional reason must be on the same line,
+	// the same goes for the optional kernel commit of "norepro".
 	switch cmd {
 	case CmdTest:
-		args = extractArgsTokens(body[cmdPos+cmdEnd:], 2)
+		args = extractTestArgs(body[cmdPos+cmdEnd:])
+	case CmdSetGuilty:
+		args = extractArgsTokens(body[cmdPos+cmdEnd:], 1)
 	case CmdSet:
 		args = extractArgsLine(body[cmdPos+cmdEnd:])
 	case cmdTest5:
 		args = extractArgsTokens(body[cmdPos+cmdEnd:], 5)
 	case CmdFix, CmdDup:
 		args = extractArgsLine(body[cmdPos+cmdEnd:])
+	case CmdInvalid, CmdNoRepro:
+		args = extractArgsSameLine(body[cmdPos+cmdEnd:])
+	case CmdTestOn:
+		// The tree is optional, so everything must be on the same line.
+		args = extractArgsTokens(extractArgsSameLine(body[cmdPos+cmdEnd:]), 3)
 	}
 	return
 }
@@ -311,7 +472,7 @@ func strToCmd(str string) Command {
 		return CmdUnDup
 	case "test", "test:":
 		return CmdTest
-	case "invalid":
+	case "invalid", "invalid:":
 		return CmdInvalid
 	case "uncc", "uncc:":
 		return CmdUnCC
@@ -319,6 +480,24 @@ func strToCmd(str string) Command {
 		return CmdSet
 	case "regenerate":
 		return CmdRegenerate
+	case "assign":
+		return CmdAssign
+	case "unassign":
+		return CmdUnAssign
+	case "set-guilty":
+		return CmdSetGuilty
+	case "minimize":
+		return CmdMinimize
+	case "focus":
+		return CmdFocus
+	case "minimize-config":
+		return CmdMinimizeConfig
+	case "norepro":
+		return CmdNoRepro
+	case "test-on":
+		return CmdTestOn
+	case "retest-bisect":
+		return CmdRetestBisect
 	case "test_5_arg_cmd":
 		return cmdTest5
 	}
@@ -347,6 +526,15 @@ func extractArgsTokens(body string, num int) string {
 	return strings.TrimSpace(strings.Join(args, " "))
 }
 
+// extractTestArgs extracts either "repo branch" or "lore-link [repo branch]" test arguments.
+// The latter must be on a single line since the tree is optional.
+func extractTestArgs(body string) string {
+	if line := extractArgsLine(body); strings.HasPrefix(line, LoreLinkPrefix) {
+		return extractArgsTokens(line, 3)
+	}
+	return extractArgsTokens(body, 2)
+}
+
 func extractArgsLine(body string) string {
 	pos := 0
 	for pos < len(body) && (body[pos] == ' ' || body[pos] == '\t' ||
@@ -360,7 +548,22 @@ func extractArgsLine(body string) string {
 	return strings.TrimSpace(body[pos : pos+lineEnd])
 }
 
-func parseBody(r io.Reader, headers mail.Header) ([]byte, [][]byte, error) {
+func extractArgsSameLine(body string) string {
+	if lineEnd := strings.IndexAny(body, "\r\n"); lineEnd != -1 {
+		body = body[:lineEnd]
+	}
+	return strings.TrimSpace(body)
+}
+
+type bodyParser struct {
+	limits        Limits
+	body          []byte
+	bodyTruncated bool
+	attachments   []Attachment
+	oversized     []OversizedAttachment
+}
+
+func (p *bodyParser) parse(r io.Reader, headers mail.Header) error {
 	// git-send-email sends emails without Content-Type, let's assume it's text.
 	mediaType := "text/plain"
 	var params map[string]string
@@ -368,7 +571,7 @@ func parseBody(r io.Reader, headers mail.Header) ([]byte, [][]byte, error) {
 		var err error
 		mediaType, params, err = mime.ParseMediaType(headers.Get("Content-Type"))
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse email header 'Content-Type': %v", err)
+			return fmt.Errorf("failed to parse email header 'Content-Type': %v", err)
 		}
 	}
 	switch strings.ToLower(headers.Get("Content-Transfer-Encoding")) {
@@ -377,46 +580,98 @@ func parseBody(r io.Reader, headers mail.Header) ([]byte, [][]byte, error) {
 	case "base64":
 		r = base64.NewDecoder(base64.StdEncoding, r)
 	}
-	disp, _, _ := mime.ParseMediaType(headers.Get("Content-Disposition"))
+	disp, dispParams, _ := mime.ParseMediaType(headers.Get("Content-Disposition"))
 	if disp == "attachment" {
-		attachment, err := io.ReadAll(r)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read email body: %v", err)
+		name := dispParams["filename"]
+		if name == "" {
+			name = params["name"]
 		}
-		return nil, [][]byte{attachment}, nil
+		return p.attachment(r, name)
 	}
 	if mediaType == "text/plain" {
-		body, err := io.ReadAll(r)
+		if p.body != nil {
+			// Only the first text part is the body, the rest is skipped without reading.
+			return nil
+		}
+		body, truncated, err := readLimited(r, p.limits.MaxBody)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read email body: %v", err)
+			return fmt.Errorf("failed to read email body: %v", err)
 		}
-		return body, nil, nil
+		p.body, p.bodyTruncated = body, truncated
+		return nil
 	}
 	if !strings.HasPrefix(mediaType, "multipart/") {
-		return nil, nil, nil
+		return nil
 	}
-	var body []byte
-	var attachments [][]byte
 	mr := multipart.NewReader(r, params["boundary"])
 	for {
-		p, err := mr.NextPart()
+		part, err := mr.NextPart()
 		if err == io.EOF {
-			return body, attachments, nil
+			return nil
 		}
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse MIME parts: %v", err)
+			return fmt.Errorf("failed to parse MIME parts: %v", err)
 		}
-		body1, attachments1, err1 := parseBody(p, mail.Header(p.Header))
-		if err1 != nil {
-			return nil, nil, err1
+		if err := p.parse(part, mail.Header(part.Header)); err != nil {
+			return err
 		}
-		if body == nil {
-			body = body1
-		}
-		attachments = append(attachments, attachments1...)
 	}
 }
 
+func (p *bodyParser) attachment(r io.Reader, name string) error {
+	data, truncated, err := readLimited(r, p.limits.MaxAttachment)
+	if err != nil {
+		return fmt.Errorf("failed to read email attachment: %v", err)
+	}
+	if !truncated {
+		p.attachments = append(p.attachments, Attachment{Name: name, Data: data})
+		return nil
+	}
+	oversized := OversizedAttachment{
+		Name:      name,
+		Truncated: true,
+		Patch:     strings.HasSuffix(name, ".patch") || strings.HasSuffix(name, ".diff") || ParsePatch(data) != "",
+	}
+	// The prefix was already read, the rest is streamed.
+	rest := &countingReader{r: io.MultiReader(bytes.NewReader(data), r)}
+	if p.limits.Store != nil {
+		oversized.Ref, oversized.Truncated = p.limits.Store(name, rest)
+	}
+	if _, err := io.Copy(io.Discard, rest); err != nil {
+		return fmt.Errorf("failed to read email attachment: %v", err)
+	}
+	oversized.Size = rest.n
+	p.oversized = append(p.oversized, oversized)
+	return nil
+}
+
+// readLimited reads at most limit bytes (0 means no limit), and returns whether there was more data.
+func readLimited(r io.Reader, limit int) ([]byte, bool, error) {
+	if limit == 0 {
+		data, err := io.ReadAll(r)
+		return data, false, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > limit {
+		return data[:limit], true, nil
+	}
+	return data, false, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
 func extractBodyBugIDs(body string, ownEmailMap map[string]bool, domains []string) []string {
 	// Let's build a regular expression.
 	var rb strings.Builder
@@ -437,6 +692,14 @@ func extractBodyBugIDs(body string, ownEmailMap map[string]bool, domains []strin
 		rb.WriteString(`([\w]+)`)
 	}
 	rg := regexp.MustCompile(rb.String())
+	// Forwarded and quoted messages may contain our addresses and links in the percent-encoded form,
+	// e.g. Outlook rewrites all links to go through its "safe links" redirector.
+	if strings.Contains(body, "%") {
+		body += "\n" + percentEncodedRe.ReplaceAllStringFunc(body, func(code string) string {
+			b, _ := strconv.ParseUint(code[1:], 16, 8)
+			return string([]byte{byte(b)})
+		})
+	}
 	ids := []string{}
 	for _, match := range rg.FindAllStringSubmatch(body, -1) {
 		// Take all non-empty group matches.
@@ -450,6 +713,8 @@ func extractBodyBugIDs(body string, ownEmailMap map[string]bool, domains []strin
 	return ids
 }
 
+var percentEncodedRe = regexp.MustCompile(`%[0-9a-fA-F]{2}`)
+
 func dedupBugIDs(list []string) []string {
 	// We should preserve the original order of IDs.
 	var ret []string
@@ -5,6 +5,7 @@ package email
 
 import (
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
@@ -118,6 +119,25 @@ func TestCanonicalEmail(t *testing.T) {
 	}
 }
 
+func TestIsKernelConfig(t *testing.T) {
+	config := new(strings.Builder)
+	config.WriteString("#\n# Automatically generated file; DO NOT EDIT.\n#\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(config, "CONFIG_OPTION_%v=y\n# CONFIG_OTHER_%v is not set\n", i, i)
+	}
+	if !IsKernelConfig([]byte(config.String())) {
+		t.Errorf("the config is not recognized")
+	}
+	if IsKernelConfig([]byte("CONFIG_KASAN=y\nCONFIG_KCOV=y\n")) {
+		t.Errorf("a short fragment is recognized as a config")
+	}
+	patch := "--- a/arch/x86/configs/x86_64_defconfig\n+++ b/arch/x86/configs/x86_64_defconfig\n" +
+		"@@ -1,40 +1,40 @@\n" + config.String()
+	if IsKernelConfig([]byte(patch)) {
+		t.Errorf("a defconfig patch is recognized as a config")
+	}
+}
+
 func TestParse(t *testing.T) {
 	for i, test := range parseTests {
 		body := func(t *testing.T, test ParseTest) {
@@ -141,12 +161,227 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseForwards(t *testing.T) {
+	type Test struct {
+		email      string
+		bugIDs     []string
+		bodyBugIDs []string
+		parents    []string
+	}
+	tests := []Test{
+		// A reply to a Gmail forward of the report, the forwarded copy is unknown to us.
+		{
+			email: `Date: Mon, 8 May 2017 11:00:00 -0700
+Message-ID: <CAreply@mail.gmail.com>
+In-Reply-To: <CAforward@mail.gmail.com>
+References: <000000000000report@google.com> <CAforward@mail.gmail.com>
+Subject: Re: Fwd: [syzbot] KASAN: use-after-free Read in foo
+From: Alice <alice@example.com>
+To: Bob <bob@example.com>
+Cc: list@googlegroups.com
+Content-Type: text/plain; charset="UTF-8"
+
+I'll take a look.
+
+On Mon, May 8, 2017 at 10:00 AM Bob <bob@example.com> wrote:
+>
+> ---------- Forwarded message ---------
+> From: syzbot <foo+4564456@bar.com>
+> Date: Sun, May 7, 2017 at 7:54 PM
+> Subject: [syzbot] KASAN: use-after-free Read in foo
+> To: <linux-kernel@vger.kernel.org>
+>
+> Hello,
+>
+> syzbot found the following issue on:
+`,
+			bugIDs:     []string{"4564456"},
+			bodyBugIDs: []string{"4564456"},
+			parents:    []string{"<CAforward@mail.gmail.com>", "<000000000000report@google.com>"},
+		},
+		// A reply to an Outlook forward with a base64-encoded body and rewritten links.
+		{
+			email: `Date: Mon, 8 May 2017 11:00:00 -0700
+Message-ID: <DM6PR11MB0002@DM6PR11MB0002.namprd11.prod.outlook.com>
+In-Reply-To: <DM6PR11MB0001@DM6PR11MB0001.namprd11.prod.outlook.com>
+References: <000000000000report@google.com>
+ <DM6PR11MB0001@DM6PR11MB0001.namprd11.prod.outlook.com>
+Subject: RE: FW: [syzbot] KASAN: use-after-free Read in foo
+From: Carol <carol@example.com>
+To: Bob <bob@example.com>
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="_000_DM6PR11MB0002_"
+
+--_000_DM6PR11MB0002_
+Content-Type: text/plain; charset="utf-8"
+Content-Transfer-Encoding: base64
+
+VGhhbmtzLCBJIHdpbGwgZml4IGl0Lg0KDQpfX19fX19fX19fX19fX19fX19fX19fX19fX19fX19f
+Xw0KRnJvbTogQm9iIDxib2JAZXhhbXBsZS5jb20+DQpTZW50OiBNb25kYXksIE1heSA4LCAyMDE3
+IDEwOjAwIEFNDQpUbzogQ2Fyb2wgPGNhcm9sQGV4YW1wbGUuY29tPg0KU3ViamVjdDogRlc6IFtz
+eXpib3RdIEtBU0FOOiB1c2UtYWZ0ZXItZnJlZSBSZWFkIGluIGZvbw0KDQpIZWxsbywNCg0Kc3l6
+Ym90IGZvdW5kIHRoZSBmb2xsb3dpbmcgaXNzdWUgb246DQoNCmRhc2hib2FyZCBsaW5rOiBodHRw
+czovL25hbTEyLnNhZmVsaW5rcy5wcm90ZWN0aW9uLm91dGxvb2suY29tLz91cmw9aHR0cHMlM0El
+MkYlMkZiYXIuY29tJTJGYnVnJTNGZXh0aWQlM0Q3ODkwYWJjJmRhdGE9MDUlN0MwMQ0K
+
+--_000_DM6PR11MB0002_
+Content-Type: text/html; charset="utf-8"
+Content-Transfer-Encoding: base64
+
+PGh0bWw+PC9odG1sPg==
+
+--_000_DM6PR11MB0002_--
+`,
+			bugIDs:     []string{"7890abc"},
+			bodyBugIDs: []string{"7890abc"},
+			parents: []string{"<DM6PR11MB0001@DM6PR11MB0001.namprd11.prod.outlook.com>",
+				"<000000000000report@google.com>"},
+		},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			email, err := Parse(strings.NewReader(test.email),
+				[]string{"bot <foo@bar.com>"},
+				[]string{"list@googlegroups.com"},
+				[]string{"bar.com"},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.bugIDs, email.BugIDs); diff != "" {
+				t.Errorf("bug IDs: %v", diff)
+			}
+			if diff := cmp.Diff(test.bodyBugIDs, email.BodyBugIDs); diff != "" {
+				t.Errorf("body bug IDs: %v", diff)
+			}
+			if diff := cmp.Diff(test.parents, email.Parents()); diff != "" {
+				t.Errorf("parents: %v", diff)
+			}
+		})
+	}
+}
+
+func TestParseWithLimits(t *testing.T) {
+	// Multi-megabyte attachments before and after the text part, the command must not be lost.
+	patch := "diff --git a/foo.c b/foo.c\n--- a/foo.c\n+++ b/foo.c\n@@ -1,1 +1,1 @@\n" +
+		strings.Repeat("+ int x = 0;\n", 300000)
+	log := strings.Repeat("some log line\n", 110000)
+	msg := `Date: Mon, 8 May 2017 11:00:00 -0700
+Message-ID: <123>
+Subject: test subject
+From: Bob <bob@example.com>
+To: syzbot <foo+4564456@bar.com>
+Content-Type: multipart/mixed; boundary="001a114ce0b01684a6054f0d8b81"
+
+--001a114ce0b01684a6054f0d8b81
+Content-Type: text/plain; charset="UTF-8"
+Content-Disposition: attachment; filename="console.log"
+
+` + log + `
+--001a114ce0b01684a6054f0d8b81
+Content-Type: text/plain; charset="UTF-8"
+
+#syz test: git://git.git/git.git master
+--001a114ce0b01684a6054f0d8b81
+Content-Type: text/x-patch; charset="US-ASCII"; name="fix.txt"
+Content-Disposition: attachment
+
+` + patch + `
+--001a114ce0b01684a6054f0d8b81--`
+	var stored []string
+	limits := Limits{
+		MaxBody:       1 << 10,
+		MaxAttachment: 1 << 20,
+		Store: func(name string, r io.Reader) (string, bool) {
+			data, err := io.ReadAll(io.LimitReader(r, 2<<20))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored = append(stored, name)
+			// Pretend that only 2MB fit into the storage.
+			return fmt.Sprintf("ref%v", len(stored)), len(data) == 2<<20
+		},
+	}
+	email, err := ParseWithLimits(strings.NewReader(msg), []string{"bot <foo@bar.com>"}, nil,
+		[]string{"bar.com"}, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Command != CmdTest || email.CommandArgs != "git://git.git/git.git master" {
+		t.Fatalf("bad command: %v %q", email.Command, email.CommandArgs)
+	}
+	if email.BodyTruncated || email.Patch != "" {
+		t.Fatalf("body truncated %v, patch %q", email.BodyTruncated, email.Patch)
+	}
+	// The last new line belongs to the MIME boundary.
+	want := []OversizedAttachment{
+		{Name: "console.log", Size: int64(len(log) - 1), Ref: "ref1"},
+		{Name: "fix.txt", Size: int64(len(patch) - 1), Ref: "ref2", Truncated: true, Patch: true},
+	}
+	if diff := cmp.Diff(want, email.Oversized); diff != "" {
+		t.Fatal(diff)
+	}
+	if email.OversizedPatch() != &email.Oversized[1] {
+		t.Fatalf("bad oversized patch")
+	}
+
+	// Without a store the attachments are just skipped, and the body is truncated.
+	msg = strings.Replace(msg, "#syz test", strings.Repeat("long line\n", 200)+"#syz test", 1)
+	email, err = ParseWithLimits(strings.NewReader(msg), []string{"bot <foo@bar.com>"}, nil,
+		[]string{"bar.com"}, Limits{MaxBody: 1 << 10, MaxAttachment: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !email.BodyTruncated || len(email.Body) != 1<<10 || len(email.Oversized) != 2 ||
+		email.Oversized[0].Ref != "" || !email.Oversized[1].Truncated {
+		t.Fatalf("bad parsed email: truncated %v, body %v, oversized %+v",
+			email.BodyTruncated, len(email.Body), email.Oversized)
+	}
+
+	// Small attachments are kept in memory.
+	email, err = ParseWithLimits(strings.NewReader(msg), []string{"bot <foo@bar.com>"}, nil,
+		[]string{"bar.com"}, Limits{MaxAttachment: 10 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(email.Oversized) != 0 || email.Patch == "" || email.Command != CmdTest {
+		t.Fatalf("bad parsed email: oversized %+v, command %v", email.Oversized, email.Command)
+	}
+	// The patch is not repeated in the other attachments.
+	if len(email.Attachments) != 1 || email.Attachments[0].Name != "console.log" ||
+		string(email.Attachments[0].Data) != log {
+		t.Fatalf("bad attachments: %v", len(email.Attachments))
+	}
+}
+
 var extractCommandTests = []struct {
 	body string
 	cmd  Command
 	str  string
 	args string
 }{
+	{
+		body: `#syz invalid  the report is caused by a broken test setup
+line 2
+`,
+		cmd:  CmdInvalid,
+		str:  "invalid",
+		args: "the report is caused by a broken test setup",
+	},
+	{
+		body: `#syz invalid: a false positive of the lockdep annotation`,
+		cmd:  CmdInvalid,
+		str:  "invalid:",
+		args: "a false positive of the lockdep annotation",
+	},
+	{
+		body: `#syz invalid
+the reason is only on the next line
+`,
+		cmd:  CmdInvalid,
+		str:  "invalid",
+		args: "",
+	},
 	{
 		body: `Hello,
 
@@ -225,6 +460,24 @@ locking/core
 		str:  "test:",
 		args: "git://git.kernel.org/pub/scm/linux/kernel/git/tip/tip.git locking/core",
 	},
+	{
+		body: `
+#syz test https://lore.kernel.org/r/abc@def.com
+Some text.
+`,
+		cmd:  CmdTest,
+		str:  "test",
+		args: "https://lore.kernel.org/r/abc@def.com",
+	},
+	{
+		body: `
+#syz test:
+https://lore.kernel.org/r/abc@def.com git://repo branch
+`,
+		cmd:  CmdTest,
+		str:  "test:",
+		args: "https://lore.kernel.org/r/abc@def.com git://repo branch",
+	},
 	{
 		body: `#syz test: repo 	commit`,
 		cmd:  CmdTest,
@@ -339,6 +592,68 @@ baz
 		str:  "set",
 		args: "subsystems: net, fs",
 	},
+	{
+		body: `
+#syz assign
+`,
+		cmd: CmdAssign,
+		str: "assign",
+	},
+	{
+		body: `#syz unassign`,
+		cmd:  CmdUnAssign,
+		str:  "unassign",
+	},
+	{
+		body: `
+#syz set-guilty mm/slub.c
+`,
+		cmd:  CmdSetGuilty,
+		str:  "set-guilty",
+		args: "mm/slub.c",
+	},
+	{
+		body: `#syz minimize`,
+		cmd:  CmdMinimize,
+		str:  "minimize",
+	},
+	{
+		body: `#syz focus`,
+		cmd:  CmdFocus,
+		str:  "focus",
+	},
+	{
+		body: `#syz minimize-config`,
+		cmd:  CmdMinimizeConfig,
+		str:  "minimize-config",
+	},
+	{
+		body: `#syz norepro 1d2b1cba9a6b`,
+		cmd:  CmdNoRepro,
+		str:  "norepro",
+		args: "1d2b1cba9a6b",
+	},
+	{
+		body: `#syz retest-bisect`,
+		cmd:  CmdRetestBisect,
+		str:  "retest-bisect",
+	},
+	{
+		body: `#syz test-on arm64  git://repo  branch`,
+		cmd:  CmdTestOn,
+		str:  "test-on",
+		args: "arm64 git://repo branch",
+	},
+	{
+		body: `
+#syz test-on ci-qemu-gce
+
+diff --git a/foo.c b/foo.c
+`,
+		cmd:  CmdTestOn,
+		str:  "test-on",
+		args: "ci-qemu-gce",
+	},
 }
 
 type ParseTest struct {
@@ -828,12 +1143,13 @@ Content-Transfer-Encoding: quoted-printable
 
 Reported-by: syzbot <foo+223c7461c58c58a4cb10@bar.com>
 `, Email{
-		BugIDs:    []string{"223c7461c58c58a4cb10"},
-		MessageID: "<1250334f-7220-2bff-5d87-b87573758d81@bar.com>",
-		Date:      time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
-		Subject:   "[PATCH] Some patch",
-		Author:    "bar@foo.com",
-		Cc:        []string{"bar@foo.com", "someone@foo.com"},
+		BugIDs:     []string{"223c7461c58c58a4cb10"},
+		BodyBugIDs: []string{"223c7461c58c58a4cb10"},
+		MessageID:  "<1250334f-7220-2bff-5d87-b87573758d81@bar.com>",
+		Date:       time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
+		Subject:    "[PATCH] Some patch",
+		Author:     "bar@foo.com",
+		Cc:         []string{"bar@foo.com", "someone@foo.com"},
 		Body: `Reported-by: syzbot <foo+223c7461c58c58a4cb10@bar.com>
 `,
 		Command: CmdNone,
@@ -850,12 +1166,13 @@ Content-Language: en-US
 
 Link: https://bar.com/bug?extid=223c7461c58c58a4cb10@bar.com
 `, Email{
-		BugIDs:    []string{"223c7461c58c58a4cb10"},
-		MessageID: "<1250334f-7220-2bff-5d87-b87573758d81@bar.com>",
-		Date:      time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
-		Subject:   "[PATCH] Some patch",
-		Author:    "bar@foo.com",
-		Cc:        []string{"bar@foo.com", "someone@foo.com"},
+		BugIDs:     []string{"223c7461c58c58a4cb10"},
+		BodyBugIDs: []string{"223c7461c58c58a4cb10"},
+		MessageID:  "<1250334f-7220-2bff-5d87-b87573758d81@bar.com>",
+		Date:       time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
+		Subject:    "[PATCH] Some patch",
+		Author:     "bar@foo.com",
+		Cc:         []string{"bar@foo.com", "someone@foo.com"},
 		Body: `Link: https://bar.com/bug?extid=223c7461c58c58a4cb10@bar.com
 `,
 		Command: CmdNone,
@@ -875,12 +1192,13 @@ Content-Transfer-Encoding: quoted-printable
 Reported-by: syzbot <foo+223c7461c58c58a4cb10@bar.com>
 Reported-by: syzbot <foo+9909090909090909@bar.com>
 `, Email{
-		BugIDs:    []string{"223c7461c58c58a4cb10", "9909090909090909"},
-		MessageID: "<1250334f-7220-2bff-5d87-b87573758d81@bar.com>",
-		Date:      time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
-		Subject:   "[PATCH] Some patch",
-		Author:    "bar@foo.com",
-		Cc:        []string{"bar@foo.com", "someone@foo.com"},
+		BugIDs:     []string{"223c7461c58c58a4cb10", "9909090909090909"},
+		BodyBugIDs: []string{"223c7461c58c58a4cb10", "9909090909090909"},
+		MessageID:  "<1250334f-7220-2bff-5d87-b87573758d81@bar.com>",
+		Date:       time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
+		Subject:    "[PATCH] Some patch",
+		Author:     "bar@foo.com",
+		Cc:         []string{"bar@foo.com", "someone@foo.com"},
 		Body: `Reported-by: syzbot <foo+223c7461c58c58a4cb10@bar.com>
 Reported-by: syzbot <foo+9909090909090909@bar.com>
 `,
@@ -900,14 +1218,84 @@ Content-Transfer-Encoding: quoted-printable
 Reported-by: syzbot <foo+223c7461c58c58a4cb10@bar.com>
 `, Email{
 		// First come BugIDs from header, then from the body.
-		BugIDs:    []string{"9909090909090909", "223c7461c58c58a4cb10"},
-		MessageID: "<1250334f-7220-2bff-5d87-b87573758d81@bar.com>",
-		Date:      time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
-		Subject:   "[PATCH] Some patch",
-		Author:    "bar@foo.com",
-		Cc:        []string{"bar@foo.com", "someone@foo.com"},
+		BugIDs:     []string{"9909090909090909", "223c7461c58c58a4cb10"},
+		BodyBugIDs: []string{"223c7461c58c58a4cb10"},
+		MessageID:  "<1250334f-7220-2bff-5d87-b87573758d81@bar.com>",
+		Date:       time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
+		Subject:    "[PATCH] Some patch",
+		Author:     "bar@foo.com",
+		Cc:         []string{"bar@foo.com", "someone@foo.com"},
 		Body: `Reported-by: syzbot <foo+223c7461c58c58a4cb10@bar.com>
 `,
 		Command: CmdNone,
 	}},
+
+	// Exchange out-of-office reply.
+	{`Date: Sun, 7 May 2017 19:54:00 -0700
+Message-ID: <AM0PR04MB5812@AM0PR04MB5812.eurprd04.prod.outlook.com>
+Subject: Automatic reply: [syzbot] KASAN: use-after-free Read in foo
+From: Bob <bob@example.com>
+To: syzbot <foo+4564456@bar.com>
+Auto-Submitted: auto-generated
+X-Auto-Response-Suppress: All
+X-MS-Exchange-Inbox-Rules-Loop: bob@example.com
+Content-Type: text/plain; charset="UTF-8"
+
+I am out of office until Monday.`,
+		Email{
+			BugIDs:    []string{"4564456"},
+			MessageID: "<AM0PR04MB5812@AM0PR04MB5812.eurprd04.prod.outlook.com>",
+			Date:      time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
+			Subject:   "Automatic reply: [syzbot] KASAN: use-after-free Read in foo",
+			Author:    "bob@example.com",
+			Cc:        []string{"bob@example.com"},
+			Body:      "I am out of office until Monday.",
+			Command:   CmdNone,
+			AutoReply: true,
+		}},
+
+	// Gmail vacation responder (the subject is set by the user).
+	{`Date: Sun, 7 May 2017 19:54:00 -0700
+Message-ID: <CAHk-vacation@mail.gmail.com>
+Subject: On vacation
+From: Bob <bob@example.com>
+To: syzbot <foo+4564456@bar.com>
+Auto-Submitted: auto-replied
+Precedence: bulk
+Content-Type: text/plain; charset="UTF-8"
+
+Back next week.`,
+		Email{
+			BugIDs:    []string{"4564456"},
+			MessageID: "<CAHk-vacation@mail.gmail.com>",
+			Date:      time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
+			Subject:   "On vacation",
+			Author:    "bob@example.com",
+			Cc:        []string{"bob@example.com"},
+			Body:      "Back next week.",
+			Command:   CmdNone,
+			AutoReply: true,
+		}},
+
+	// A regular message that came via a mailing list with "Precedence: bulk".
+	{`Date: Sun, 7 May 2017 19:54:00 -0700
+Message-ID: <123>
+Subject: Re: [syzbot] KASAN: use-after-free Read in foo
+From: Bob <bob@example.com>
+To: syzbot <foo+4564456@bar.com>
+Precedence: bulk
+List-Id: <linux-kernel.vger.kernel.org>
+Content-Type: text/plain; charset="UTF-8"
+
+Looking into it.`,
+		Email{
+			BugIDs:    []string{"4564456"},
+			MessageID: "<123>",
+			Date:      time.Date(2017, time.May, 7, 19, 54, 0, 0, parseTestZone),
+			Subject:   "Re: [syzbot] KASAN: use-after-free Read in foo",
+			Author:    "bob@example.com",
+			Cc:        []string{"bob@example.com"},
+			Body:      "Looking into it.",
+			Command:   CmdNone,
+		}},
 }
@@ -10,14 +10,16 @@ import (
 	"strings"
 )
 
-func ParsePatch(message []byte) (diff string) {
+func ParsePatch(message []byte) string {
 	s := bufio.NewScanner(bytes.NewReader(message))
+	// Patches can be large, so avoid quadratic string concatenation.
+	diff := new(strings.Builder)
 	diffStarted := false
 	for s.Scan() {
 		ln := s.Text()
 		if lineMatchesDiffStart(ln) {
 			diffStarted = true
-			diff += ln + "\n"
+			diff.WriteString(ln + "\n")
 			continue
 		}
 		if diffStarted {
@@ -28,7 +30,7 @@ func ParsePatch(message []byte) (diff string) {
 			if strings.HasPrefix(ln, " ") || strings.HasPrefix(ln, "+") ||
 				strings.HasPrefix(ln, "-") || strings.HasPrefix(ln, "@") ||
 				strings.HasPrefix(ln, "================") {
-				diff += ln + "\n"
+				diff.WriteString(ln + "\n")
 				continue
 			}
 		}
@@ -38,12 +40,11 @@ func ParsePatch(message []byte) (diff string) {
 		// It's a problem of the incoming patch, rather than anything else.
 		// Anyway, if a patch contains too long lines, we're probably not
 		// interested in it, so let's pretent we didn't see it.
-		diff = ""
-		return
+		return ""
 	} else if err != nil {
 		panic("error while scanning from memory: " + err.Error())
 	}
-	return
+	return diff.String()
 }
 
 var diffRegexps = []*regexp.Regexp{
@@ -0,0 +1,128 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+type DiffOp int
+
+const (
+	DiffEqual DiffOp = iota
+	DiffRemoved
+	DiffAdded
+)
+
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+type ReportDiff struct {
+	Lines []DiffLine
+	// Similarity is the share of the normalized lines that are present in both reports (0..1).
+	Similarity float64
+	// Truncated is set if the reports were too long and only their beginnings were compared.
+	Truncated bool
+}
+
+// MaxDiffLines is the maximum number of normalized lines of each report that DiffReports compares.
+const MaxDiffLines = 1000
+
+var (
+	diffConsolePrefixRe = regexp.MustCompile(`^(?:\<[0-9]+\>)?\[ *[0-9]+\.[0-9]+\](?:\[ *(?:C|T)[0-9]+\])? ?`)
+	diffTaskRe          = regexp.MustCompile(`\[ *(?:C|T)[0-9]+\]`)
+)
+
+// NormalizeReport returns the lines of the crash report with the parts that differ
+// between crashes of the same bug (console prefixes, addresses, function offsets,
+// task, CPU and line numbers, questionable frames, whitespace) normalized or removed.
+func NormalizeReport(report []byte) []string {
+	var lines []string
+	for s := bufio.NewScanner(bytes.NewReader(report)); s.Scan(); {
+		line := diffConsolePrefixRe.ReplaceAllString(s.Text(), "")
+		line = diffTaskRe.ReplaceAllString(line, "")
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" || strings.HasPrefix(line, "? ") {
+			continue
+		}
+		lines = append(lines, replaceTable(dynamicTitleReplacement, line))
+	}
+	return lines
+}
+
+// DiffReports computes a line diff of the normalized reports a and b.
+func DiffReports(a, b []byte) *ReportDiff {
+	diff := &ReportDiff{}
+	linesA, linesB := NormalizeReport(a), NormalizeReport(b)
+	if len(linesA) > MaxDiffLines {
+		linesA = linesA[:MaxDiffLines]
+		diff.Truncated = true
+	}
+	if len(linesB) > MaxDiffLines {
+		linesB = linesB[:MaxDiffLines]
+		diff.Truncated = true
+	}
+	diff.Lines = diffLines(linesA, linesB)
+	if len(linesA)+len(linesB) == 0 {
+		diff.Similarity = 1
+		return diff
+	}
+	equal := 0
+	for _, line := range diff.Lines {
+		if line.Op == DiffEqual {
+			equal++
+		}
+	}
+	diff.Similarity = float64(2*equal) / float64(len(linesA)+len(linesB))
+	return diff
+}
+
+// diffLines produces the diff based on the longest common subsequence of the lines.
+func diffLines(a, b []string) []DiffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ret []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ret = append(ret, DiffLine{DiffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ret = append(ret, DiffLine{DiffRemoved, a[i]})
+			i++
+		default:
+			ret = append(ret, DiffLine{DiffAdded, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ret = append(ret, DiffLine{DiffRemoved, a[i]})
+	}
+	for ; j < len(b); j++ {
+		ret = append(ret, DiffLine{DiffAdded, b[j]})
+	}
+	return ret
+}
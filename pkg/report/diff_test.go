@@ -0,0 +1,137 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+func TestNormalizeReport(t *testing.T) {
+	tests := []struct {
+		report string
+		lines  []string
+	}{
+		{
+			report: `
+[  560.713151][ T1194] WARNING: CPU: 2 PID: 1194 at net/xfrm/xfrm_state.c:2381 xfrm_state_fini+0x440/0x5c0
+[  560.719962][ T1194]  dump_stack+0x1db/0x2d0
+[  560.720753][ T1194]  ? dump_stack_print_info.cold+0x20/0x20
+[  560.736699][ T1194] RSP: 0018:ffff888068c37718 EFLAGS: 00010293
+`,
+			lines: []string{
+				"WARNING: CPU: NUM PID: NUM at net/xfrm/xfrm_state.c:LINE xfrm_state_fini",
+				"dump_stack",
+				"RSP: NUM:ADDR EFLAGS: ADDR",
+			},
+		},
+		{
+			report: `
+[   12.345678] BUG: KASAN: use-after-free in foo+0x12/0x34 net/core/sock.c:123
+  <IRQ>  [<ffffffff816efb87>] _sched_show_task+0x31a/0x325
+Comm: syz-executor.3 Not tainted
+`,
+			lines: []string{
+				"BUG: KASAN: use-after-free in foo net/core/sock.c:LINE",
+				"<IRQ> [<ADDR>] _sched_show_task",
+				"Comm: syz-executor Not tainted",
+			},
+		},
+	}
+	for i, test := range tests {
+		lines := NormalizeReport([]byte(test.report))
+		if diff := cmp.Diff(test.lines, lines); diff != "" {
+			t.Errorf("test #%v: wrong lines:\n%v", i, diff)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	diff := diffLines([]string{"a", "b", "c", "d"}, []string{"a", "c", "e", "d"})
+	expected := []DiffLine{
+		{DiffEqual, "a"},
+		{DiffRemoved, "b"},
+		{DiffEqual, "c"},
+		{DiffAdded, "e"},
+		{DiffEqual, "d"},
+	}
+	if diff := cmp.Diff(expected, diff); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestDiffReports(t *testing.T) {
+	cfg := &mgrconfig.Config{
+		Derived: mgrconfig.Derived{
+			TargetOS:   targets.Linux,
+			TargetArch: targets.AMD64,
+			SysTarget:  targets.Get(targets.Linux, targets.AMD64),
+		},
+	}
+	reporter, err := NewReporter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func(file string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata", "linux", "report", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Skip the test header.
+		data = data[bytes.Index(data, []byte("\n\n"))+2:]
+		rep := reporter.Parse(data)
+		if rep == nil {
+			t.Fatalf("no report in %v", file)
+		}
+		return rep.Report
+	}
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		// The same crash.
+		{a: "345", b: "345", min: 1, max: 1},
+		// WARNING in xfrm_state_fini intermixed with other output.
+		{a: "345", b: "346", min: 0.9, max: 1},
+		{a: "345", b: "348", min: 0.8, max: 0.9},
+		// INFO: task hung in rtnl_lock with different stacks.
+		{a: "131", b: "134", min: 0.7, max: 0.8},
+		// Different bugs.
+		{a: "345", b: "131", min: 0, max: 0.1},
+		{a: "345", b: "436", min: 0, max: 0.2},
+	}
+	for _, test := range tests {
+		diff := DiffReports(load(test.a), load(test.b))
+		if diff.Similarity < test.min || diff.Similarity > test.max {
+			t.Errorf("%v vs %v: similarity %.3f, expected [%v, %v]",
+				test.a, test.b, diff.Similarity, test.min, test.max)
+		}
+		if diff.Truncated {
+			t.Errorf("%v vs %v: the diff is truncated", test.a, test.b)
+		}
+		if test.a == test.b {
+			for _, line := range diff.Lines {
+				if line.Op != DiffEqual {
+					t.Errorf("%v vs %v: unexpected diff line %+v", test.a, test.b, line)
+				}
+			}
+		}
+	}
+}
+
+func TestDiffReportsTruncated(t *testing.T) {
+	report := strings.Repeat("foo\n", MaxDiffLines+10)
+	diff := DiffReports([]byte(report), []byte(report))
+	if !diff.Truncated || diff.Similarity != 1 || len(diff.Lines) != MaxDiffLines {
+		t.Fatalf("unexpected diff: truncated=%v similarity=%v lines=%v",
+			diff.Truncated, diff.Similarity, len(diff.Lines))
+	}
+}
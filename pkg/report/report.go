@@ -210,6 +210,10 @@ func (reporter *Reporter) ParseFrom(output []byte, minReportPos int) *Report {
 	for i, title := range rep.AltTitles {
 		rep.AltTitles[i] = sanitizeTitle(replaceTable(dynamicTitleReplacement, title))
 	}
+	if title, mirrored := CanonicalDataRaceTitle(rep.Title); mirrored != "" {
+		rep.Title = title
+		rep.AltTitles = append(rep.AltTitles, mirrored)
+	}
 	rep.Suppressed = matchesAny(rep.Output, reporter.suppressions)
 	if bytes.Contains(rep.Output, gceConsoleHangup) {
 		rep.Corrupted = true
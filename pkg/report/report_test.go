@@ -44,6 +44,10 @@ type ParseTest struct {
 }
 
 func testParseFile(t *testing.T, reporter *Reporter, fn string) {
+	testParseImpl(t, reporter, readParseTest(t, fn))
+}
+
+func readParseTest(t *testing.T, fn string) *ParseTest {
 	data, err := os.ReadFile(fn)
 	if err != nil {
 		t.Fatal(err)
@@ -90,7 +94,7 @@ func testParseFile(t *testing.T, reporter *Reporter, fn string) {
 	if len(test.Log) == 0 {
 		t.Fatalf("can't find log in input file")
 	}
-	testParseImpl(t, reporter, test)
+	return test
 }
 
 func parseHeaderLine(t *testing.T, test *ParseTest, ln string) {
@@ -0,0 +1,90 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+const dataRaceTitlePrefix = dataRacePrefix + " in "
+
+// CanonicalDataRaceTitle orders the functions of the KCSAN data-race titles, so that
+// the symmetric races ("A / B" and "B / A") get the same title.
+// The title with the other order is returned as well, it matches the older bugs.
+func CanonicalDataRaceTitle(title string) (canonical, mirrored string) {
+	if !strings.HasPrefix(title, dataRaceTitlePrefix) {
+		return title, ""
+	}
+	funcs := strings.Split(title[len(dataRaceTitlePrefix):], " / ")
+	if len(funcs) != 2 || funcs[0] == funcs[1] {
+		return title, ""
+	}
+	if funcs[0] > funcs[1] {
+		funcs[0], funcs[1] = funcs[1], funcs[0]
+	}
+	return dataRaceTitlePrefix + funcs[0] + " / " + funcs[1],
+		dataRaceTitlePrefix + funcs[1] + " / " + funcs[0]
+}
+
+var (
+	dataRaceAccessRe = regexp.MustCompile(`^(?:read|write|read-write)(?: \([a-z]+\))* to 0x[0-9a-f]+ ` +
+		`of [0-9]+ bytes by .*:$`)
+	kmsanOriginRe = regexp.MustCompile(`^(?:Uninit was created at:|Local variable .* created at:)`)
+)
+
+// DataRaceAccesses returns the two racing accesses of a KCSAN data-race report,
+// each one is the access description followed by its stack.
+// Returns nil if the report does not describe both accesses.
+func DataRaceAccesses(report []byte) [][]byte {
+	var accesses [][]byte
+	var cur []byte
+	s := bufio.NewScanner(bytes.NewReader(report))
+	for s.Scan() {
+		line := bytes.TrimRight(s.Bytes(), " ")
+		switch {
+		case dataRaceAccessRe.Match(line):
+			if cur != nil {
+				accesses = append(accesses, cur)
+			}
+			cur = append(append([]byte{}, line...), '\n')
+		case cur == nil:
+		case len(line) == 0:
+			accesses = append(accesses, cur)
+			cur = nil
+		default:
+			cur = append(append(cur, line...), '\n')
+		}
+	}
+	if cur != nil {
+		accesses = append(accesses, cur)
+	}
+	if len(accesses) != 2 {
+		return nil
+	}
+	return accesses
+}
+
+// KMSANOrigin returns the origin section of a KMSAN report (where the uninit value was created),
+// or nil if there's none.
+func KMSANOrigin(report []byte) []byte {
+	var origin []byte
+	s := bufio.NewScanner(bytes.NewReader(report))
+	for s.Scan() {
+		line := bytes.TrimRight(s.Bytes(), " ")
+		if origin == nil {
+			if kmsanOriginRe.Match(line) {
+				origin = append(append([]byte{}, line...), '\n')
+			}
+			continue
+		}
+		if len(line) == 0 {
+			break
+		}
+		origin = append(append(origin, line...), '\n')
+	}
+	return origin
+}
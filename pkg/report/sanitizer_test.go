@@ -0,0 +1,101 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/syzkaller/sys/targets"
+)
+
+func TestCanonicalDataRaceTitle(t *testing.T) {
+	tests := []struct {
+		title     string
+		canonical string
+		mirrored  string
+	}{
+		{
+			"KCSAN: data-race in foo / bar",
+			"KCSAN: data-race in bar / foo",
+			"KCSAN: data-race in foo / bar",
+		},
+		{
+			"KCSAN: data-race in bar / foo",
+			"KCSAN: data-race in bar / foo",
+			"KCSAN: data-race in foo / bar",
+		},
+		{"KCSAN: data-race in foo / foo", "KCSAN: data-race in foo / foo", ""},
+		{"KCSAN: data-race in foo", "KCSAN: data-race in foo", ""},
+		{"KASAN: use-after-free Read in foo / bar", "KASAN: use-after-free Read in foo / bar", ""},
+	}
+	for _, test := range tests {
+		canonical, mirrored := CanonicalDataRaceTitle(test.title)
+		if canonical != test.canonical || mirrored != test.mirrored {
+			t.Errorf("%q: got %q/%q, want %q/%q", test.title, canonical, mirrored,
+				test.canonical, test.mirrored)
+		}
+	}
+}
+
+func parseTestReport(t *testing.T, name string) *Report {
+	reporter, _ := prepareLinuxReporter(t, targets.AMD64)
+	test := readParseTest(t, filepath.Join("testdata", "linux", "report", name))
+	rep := reporter.Parse(test.Log)
+	if rep == nil {
+		t.Fatalf("%v: found no report", name)
+	}
+	return rep
+}
+
+func TestDataRaceAccesses(t *testing.T) {
+	tests := []struct {
+		file     string
+		accesses []string
+	}{
+		{"427", []string{
+			"read to 0xffffffff85a7f140 of 8 bytes by task 1082 on cpu 7:\n find_next_bit+0x57/0xe0\n",
+			"write to 0xffffffff85a7f140 of 8 bytes by interrupt on cpu 4:\n rcu_report_exp_cpu_mult+0x4f/0xa0\n",
+		}},
+		// The symmetric race: the same title, but the accesses are in the reported order.
+		{"694", []string{
+			"write to 0xffffffff85a7f140 of 8 bytes by interrupt on cpu 4:\n rcu_report_exp_cpu_mult+0x4f/0xa0\n",
+			"read to 0xffffffff85a7f140 of 8 bytes by task 1082 on cpu 7:\n find_next_bit+0x57/0xe0\n",
+		}},
+		// Race at unknown origin has only one stack.
+		{"428", nil},
+		{"636", nil},
+	}
+	for _, test := range tests {
+		rep := parseTestReport(t, test.file)
+		accesses := DataRaceAccesses(rep.Report)
+		if len(accesses) != len(test.accesses) {
+			t.Fatalf("%v: got %v accesses, want %v:\n%q", test.file, len(accesses), len(test.accesses), accesses)
+		}
+		for i, access := range accesses {
+			if !bytes.HasPrefix(access, []byte(test.accesses[i])) {
+				t.Errorf("%v: access #%v:\n%s\nwant prefix:\n%s", test.file, i, access, test.accesses[i])
+			}
+		}
+	}
+}
+
+func TestKMSANOrigin(t *testing.T) {
+	tests := []struct {
+		file   string
+		origin string
+	}{
+		{"632", "Uninit was created at:\n(stack is not available)\n"},
+		{"636", "Uninit was created at:\n __kmalloc_node_track_caller+0xe0c/0x1510\n __alloc_skb+0x545/0xf90\n"},
+		{"427", ""},
+	}
+	for _, test := range tests {
+		rep := parseTestReport(t, test.file)
+		origin := KMSANOrigin(rep.Report)
+		if !bytes.HasPrefix(origin, []byte(test.origin)) || (test.origin == "") != (origin == nil) {
+			t.Errorf("%v: got origin:\n%s\nwant prefix:\n%s", test.file, origin, test.origin)
+		}
+	}
+}
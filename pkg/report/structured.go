@@ -0,0 +1,124 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+
+	"github.com/google/syzkaller/dashboard/dashapi"
+)
+
+const (
+	maxStructuredFrames   = 64
+	maxStructuredPrograms = 10
+	maxStructuredSyscalls = 100
+)
+
+var (
+	// Matches both symbolized and raw frames, e.g.:
+	//  __mutex_lock+0xa44/0x1350 kernel/locking/mutex.c:747
+	//  __dump_stack lib/dump_stack.c:88 [inline]
+	//  [<ffffffff8146b6d5>] dump_stack+0x12/0x34
+	stackFrameRe = regexp.MustCompile(`^\s*(?:\[<[0-9a-f]+>\]\s*)?([a-zA-Z0-9_.$]+)` +
+		`(?:(\+0x[0-9a-f]+/0x[0-9a-f]+)(?:\s+\[[a-zA-Z0-9_]+\])?)?` +
+		`(?:\s+([a-zA-Z0-9_\-./]+\.[a-zA-Z]+):([0-9]+))?(\s+\[inline\])?\s*$`)
+	stackMarkerRe  = regexp.MustCompile(`^\s*(?:</?[A-Z]+>|\?\s.*)$`)
+	executingRe    = regexp.MustCompile(`executing program [0-9]+:?$`)
+	programCallRe  = regexp.MustCompile(`^(?:r[0-9]+ = )?([a-zA-Z0-9_$]+)\(`)
+	callTraceStart = []byte("Call Trace:")
+)
+
+// Structured returns a machine-readable summary of the report: the crash type, the first stack trace
+// and the syscalls of the programs that were executed before the crash.
+// Stack frames are only recognized in the Linux format.
+func (rep *Report) Structured() *dashapi.StructuredReport {
+	return &dashapi.StructuredReport{
+		Title:     rep.Title,
+		Type:      rep.Type.String(),
+		Corrupted: rep.Corrupted,
+		Frames:    extractStackFrames(rep.Report),
+		Syscalls:  extractSyscalls(rep.Output, rep.StartPos),
+	}
+}
+
+func extractStackFrames(report []byte) []dashapi.StackFrame {
+	// Prefer the explicit call trace over the frames in the register dump.
+	if pos := bytes.Index(report, callTraceStart); pos != -1 {
+		report = report[pos+len(callTraceStart):]
+	}
+	var frames []dashapi.StackFrame
+	s := bufio.NewScanner(bytes.NewReader(report))
+	s.Buffer(nil, len(report)+1)
+	for s.Scan() {
+		line := s.Bytes()
+		if stackMarkerRe.Match(line) {
+			// Stack boundaries (<IRQ>, <TASK>) and unreliable frames.
+			continue
+		}
+		match := stackFrameRe.FindSubmatch(line)
+		if match == nil || len(match[2]) == 0 && len(match[3]) == 0 {
+			if len(frames) != 0 {
+				break
+			}
+			continue
+		}
+		frame := dashapi.StackFrame{
+			Function: string(match[1]),
+			File:     string(match[3]),
+			Inline:   len(match[5]) != 0,
+		}
+		frame.Line, _ = strconv.Atoi(string(match[4]))
+		frames = append(frames, frame)
+		if len(frames) == maxStructuredFrames {
+			break
+		}
+	}
+	return frames
+}
+
+// extractSyscalls returns the unique syscalls of the last programs in the output before the crash.
+func extractSyscalls(output []byte, crashPos int) []string {
+	if crashPos > 0 && crashPos <= len(output) {
+		output = output[:crashPos]
+	}
+	var programs [][]string
+	inProgram := false
+	s := bufio.NewScanner(bytes.NewReader(output))
+	s.Buffer(nil, len(output)+1)
+	for s.Scan() {
+		line := s.Bytes()
+		if executingRe.Match(line) {
+			programs = append(programs, nil)
+			inProgram = true
+			continue
+		}
+		if !inProgram {
+			continue
+		}
+		match := programCallRe.FindSubmatch(line)
+		if match == nil {
+			inProgram = false
+			continue
+		}
+		programs[len(programs)-1] = append(programs[len(programs)-1], string(match[1]))
+	}
+	if len(programs) > maxStructuredPrograms {
+		programs = programs[len(programs)-maxStructuredPrograms:]
+	}
+	var calls []string
+	seen := make(map[string]bool)
+	for _, prog := range programs {
+		for _, call := range prog {
+			if seen[call] || len(calls) == maxStructuredSyscalls {
+				continue
+			}
+			seen[call] = true
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
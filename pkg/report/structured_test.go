@@ -0,0 +1,84 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+// The golden files in testdata/linux/structured are named after the reports in testdata/linux/report.
+func TestStructured(t *testing.T) {
+	reporter, _ := prepareLinuxReporter(t, "amd64")
+	for _, file := range readDir(t, filepath.Join("testdata", "linux", "structured")) {
+		file := file
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			test := readParseTest(t, filepath.Join("testdata", "linux", "report", name))
+			rep := reporter.Parse(test.Log)
+			if rep == nil {
+				t.Fatalf("no report found")
+			}
+			result, err := json.MarshalIndent(rep.Structured(), "", "\t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, '\n')
+			if *flagUpdate {
+				osutil.WriteFile(file, result)
+			}
+			want, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(want, result) {
+				t.Fatalf("want:\n%s\ngot:\n%s", want, result)
+			}
+		})
+	}
+}
+
+func TestStructuredCorpus(t *testing.T) {
+	forEachFile(t, "report", func(t *testing.T, reporter *Reporter, fn string) {
+		rep := reporter.Parse(readParseTest(t, fn).Log)
+		if rep == nil {
+			return
+		}
+		structured := rep.Structured()
+		if len(structured.Frames) > maxStructuredFrames || len(structured.Syscalls) > maxStructuredSyscalls {
+			t.Fatalf("too many frames/syscalls: %v/%v", len(structured.Frames), len(structured.Syscalls))
+		}
+		for _, frame := range structured.Frames {
+			if frame.Function == "" || frame.Line < 0 || frame.Line != 0 && frame.File == "" {
+				t.Fatalf("bad frame: %+v", frame)
+			}
+		}
+	})
+}
+
+func TestExtractSyscalls(t *testing.T) {
+	output := []byte(`2017/11/27 07:13:57 executing program 2:
+mmap(&(0x7f0000000000/0xfff000)=nil, 0xfff000, 0x3, 0x32, 0xffffffffffffffff, 0x0)
+r0 = socket$inet(0x2, 0x1, 0x0)
+[   57.123456] some kernel message(with parens)
+open(&(0x7f0000000000)='./file0\x00', 0x0, 0x0)
+2017/11/27 07:13:58 executing program 1:
+r0 = socket$inet(0x2, 0x1, 0x0)
+close(r0)
+BUG: unable to handle kernel paging request
+write(r0, 0x0, 0x0)
+`)
+	crashPos := bytes.Index(output, []byte("BUG:"))
+	got := extractSyscalls(output, crashPos)
+	want := []string{"mmap", "socket$inet", "close"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
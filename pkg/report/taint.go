@@ -0,0 +1,51 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+var (
+	taintedRe    = regexp.MustCompile(`\b(?:Not tainted|Tainted: ([^\n]*))`)
+	taintFlagsRe = regexp.MustCompile(`^[A-Z]+$`)
+	// Newer kernels also print the flags as "Tainted: [W]=WARN, [O]=OOT_MODULE".
+	taintNamedFlagRe = regexp.MustCompile(`\[([A-Z])\]=`)
+)
+
+// TaintFlags returns the kernel taint flags from the first "Tainted:"/"Not tainted" line of a Linux report
+// (e.g. "WO" for "CPU: 0 PID: 1 Comm: a Tainted: G        W  O      6.3.0 #0").
+// The later lines are ignored, they are usually tainted by the crash itself (e.g. 'D' after an oops).
+// The 'G' flag only means that no proprietary modules were loaded, so it's not returned.
+// Returns an empty string if the kernel was not tainted or the report does not say.
+func TaintFlags(report []byte) string {
+	match := taintedRe.FindSubmatch(report)
+	if match == nil || match[1] == nil {
+		return ""
+	}
+	flags := ""
+	add := func(flag rune) {
+		if flag != 'G' && !strings.ContainsRune(flags, flag) {
+			flags += string(flag)
+		}
+	}
+	if named := taintNamedFlagRe.FindAllSubmatch(match[1], -1); named != nil {
+		for _, flag := range named {
+			add(rune(flag[1][0]))
+		}
+		return flags
+	}
+	for _, token := range bytes.Fields(match[1]) {
+		if !taintFlagsRe.Match(token) {
+			// That's the kernel version.
+			break
+		}
+		for _, flag := range string(token) {
+			add(flag)
+		}
+	}
+	return flags
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package report
+
+import (
+	"testing"
+)
+
+func TestTaintFlags(t *testing.T) {
+	tests := []struct {
+		report string
+		flags  string
+	}{
+		{"CPU: 0 PID: 1 Comm: syz-executor Not tainted 6.3.0-syzkaller #0\n", ""},
+		{"CPU: 0 PID: 1 Comm: syz-executor Tainted: G        W          6.3.0-syzkaller #0\n", "W"},
+		{"CPU: 0 PID: 1 Comm: syz-executor Tainted: G    B   W  O      6.3.0-syzkaller #0\n", "BWO"},
+		{"CPU: 0 PID: 1 Comm: syz-executor Tainted: P           O      6.3.0 #0\n", "PO"},
+		{"CPU: 0 PID: 1 Comm: syz-executor Tainted: G    BU         3.18.0 #78\n", "BU"},
+		{"BUG: KASAN: use-after-free in foo\nTainted: G    B          ): kasan: bad access detected\n", "B"},
+		{"CPU: 1 UID: 0 PID: 5 Comm: kworker Tainted: G        W          6.12.0 #0\n" +
+			"Tainted: [W]=WARN, [O]=OOT_MODULE\n", "W"},
+		{"Tainted: [W]=WARN, [O]=OOT_MODULE\n", "WO"},
+		// Only the first line counts, the later ones may be tainted by the crash itself.
+		{"CPU: 0 PID: 1 Comm: a Not tainted 6.3.0 #0\nCPU: 0 PID: 1 Comm: a Tainted: G      D    6.3.0 #0\n", ""},
+		{"general protection fault: 0000 [#1] SMP KASAN\n", ""},
+	}
+	for i, test := range tests {
+		if flags := TaintFlags([]byte(test.report)); flags != test.flags {
+			t.Errorf("test #%v: got %q, want %q", i, flags, test.flags)
+		}
+	}
+}
+
+func TestTaintFlagsInReports(t *testing.T) {
+	tests := []struct {
+		file  string
+		flags string
+	}{
+		{"0", ""},
+		{"45", "BU"},
+		{"316", "W"},
+		// The report is not tainted, the later 'D' and 'L' flags are caused by the crash.
+		{"479", ""},
+		{"503", ""},
+	}
+	for _, test := range tests {
+		rep := parseTestReport(t, test.file)
+		if flags := TaintFlags(rep.Report); flags != test.flags {
+			t.Errorf("%v: got %q, want %q", test.file, flags, test.flags)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package subsystem
+
+import (
+	"sort"
+
+	"github.com/google/syzkaller/prog"
+)
+
+// RuleMatch is a single subsystem rule that matches a crash.
+type RuleMatch struct {
+	Subsystem *Subsystem
+	// PathRule is set if the rule matches the guilty path of the crash.
+	PathRule *PathRule
+	// Syscall is set if the reproducer of the crash calls a syscall of the subsystem.
+	Syscall string
+}
+
+// MatchRules evaluates all subsystem rules against the crash.
+// Unlike Extract, it neither votes nor drops parent subsystems, so the result shows
+// exactly which rules are responsible for the inferred subsystems.
+func (s *Service) MatchRules(crash *Crash) []RuleMatch {
+	var calls map[string]struct{}
+	if len(crash.SyzRepro) != 0 {
+		calls, _, _ = prog.CallSet(crash.SyzRepro)
+	}
+	list := s.List()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	var ret []RuleMatch
+	for _, item := range list {
+		if crash.GuiltyPath != "" {
+			for i := range item.PathRules {
+				rule := &item.PathRules[i]
+				if buildMatch(*rule, item).matches(crash.GuiltyPath) {
+					ret = append(ret, RuleMatch{Subsystem: item, PathRule: rule})
+				}
+			}
+		}
+		for _, call := range item.Syscalls {
+			if _, ok := calls[call]; ok {
+				ret = append(ret, RuleMatch{Subsystem: item, Syscall: call})
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package subsystem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRules(t *testing.T) {
+	fs := &Subsystem{
+		Name: "fs",
+		PathRules: []PathRule{
+			{IncludeRegexp: `^fs/.*$`, ExcludeRegexp: `^fs/ext4/.*$`},
+			{IncludeRegexp: `^include/linux/fs\.h$`},
+		},
+	}
+	ext4 := &Subsystem{
+		Name:      "ext4",
+		PathRules: []PathRule{{IncludeRegexp: `^fs/ext4/.*$`}},
+		Syscalls:  []string{"syz_mount_image$ext4"},
+		Parents:   []*Subsystem{fs},
+	}
+	mm := &Subsystem{
+		Name:      "mm",
+		PathRules: []PathRule{{IncludeRegexp: `^mm/.*$|^include/linux/fs\.h$`}},
+	}
+	service := MustMakeService([]*Subsystem{fs, ext4, mm})
+	tests := []struct {
+		name  string
+		crash *Crash
+		want  []RuleMatch
+	}{
+		{
+			name:  `No rules match`,
+			crash: &Crash{GuiltyPath: "net/socket.c"},
+		},
+		{
+			name:  `Exclude regexps are respected`,
+			crash: &Crash{GuiltyPath: "fs/ext4/inode.c"},
+			want: []RuleMatch{
+				{Subsystem: ext4, PathRule: &ext4.PathRules[0]},
+			},
+		},
+		{
+			name:  `Parents are not dropped`,
+			crash: &Crash{GuiltyPath: "fs/ext4/inode.c", SyzRepro: []byte("syz_mount_image$ext4()\n")},
+			want: []RuleMatch{
+				{Subsystem: ext4, PathRule: &ext4.PathRules[0]},
+				{Subsystem: ext4, Syscall: "syz_mount_image$ext4"},
+			},
+		},
+		{
+			name:  `All matching subsystems are reported`,
+			crash: &Crash{GuiltyPath: "include/linux/fs.h"},
+			want: []RuleMatch{
+				{Subsystem: fs, PathRule: &fs.PathRules[1]},
+				{Subsystem: mm, PathRule: &mm.PathRules[0]},
+			},
+		},
+		{
+			name:  `Only the reproducer`,
+			crash: &Crash{SyzRepro: []byte("openat()\nsyz_mount_image$ext4()\n")},
+			want: []RuleMatch{
+				{Subsystem: ext4, Syscall: "syz_mount_image$ext4"},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, service.MatchRules(test.crash))
+		})
+	}
+}
@@ -50,17 +50,20 @@ func (p *PathMatcher) register(item *Subsystem) {
 func (p *PathMatcher) Match(path string) []*Subsystem {
 	ret := []*Subsystem{}
 	for _, m := range p.matches {
-		if m.exclude != nil && m.exclude.MatchString(path) {
-			continue
+		if m.matches(path) {
+			ret = append(ret, m.object)
 		}
-		if m.include != nil && !m.include.MatchString(path) {
-			continue
-		}
-		ret = append(ret, m.object)
 	}
 	return ret
 }
 
+func (m *match) matches(path string) bool {
+	if m.exclude != nil && m.exclude.MatchString(path) {
+		return false
+	}
+	return m.include == nil || m.include.MatchString(path)
+}
+
 func buildMatch(rule PathRule, item *Subsystem) *match {
 	m := &match{object: item}
 	if rule.IncludeRegexp != "" {
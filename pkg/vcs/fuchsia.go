@@ -80,6 +80,10 @@ func (ctx *fuchsia) GetCommitsByTitles(titles []string) ([]*Commit, []string, er
 	return ctx.repo.GetCommitsByTitles(titles)
 }
 
+func (ctx *fuchsia) GetBackports(upstream []*Commit) (map[string]*Commit, error) {
+	return ctx.repo.GetBackports(upstream)
+}
+
 func (ctx *fuchsia) ListRecentCommits(baseCommit string) ([]string, error) {
 	return ctx.repo.ListRecentCommits(baseCommit)
 }
@@ -92,6 +96,10 @@ func (ctx *fuchsia) ReleaseTag(commit string) (string, error) {
 	return "", fmt.Errorf("not implemented for fuchsia")
 }
 
+func (ctx *fuchsia) FirstReleaseTag(commit string) (string, error) {
+	return "", fmt.Errorf("not implemented for fuchsia")
+}
+
 func (ctx *fuchsia) Contains(commit string) (bool, error) {
 	return false, fmt.Errorf("not implemented for fuchsia")
 }
@@ -100,6 +108,10 @@ func (ctx *fuchsia) ListCommitHashes(base string) ([]string, error) {
 	return ctx.repo.ListCommitHashes(base)
 }
 
+func (ctx *fuchsia) CommitsTouching(from, to, path string, maxCommits int) ([]*Commit, error) {
+	return nil, fmt.Errorf("not implemented for fuchsia")
+}
+
 func (ctx *fuchsia) Object(name, commit string) ([]byte, error) {
 	return ctx.repo.Object(name, commit)
 }
@@ -246,6 +246,12 @@ func gitParseCommit(output, user, domain []byte, ignoreCC map[string]bool) (*Com
 	recipients := make(map[string]bool)
 	recipients[strings.ToLower(string(lines[2]))] = true
 	var tags []string
+	upstream := ""
+	for _, line := range lines[7:] {
+		if match := upstreamCommitRe.FindSubmatch(line); match != nil && upstream == "" {
+			upstream = string(match[1]) + string(match[2])
+		}
+	}
 	// Use summary line + all description lines.
 	for _, line := range append([][]byte{lines[1]}, lines[7:]...) {
 		if user != nil {
@@ -300,6 +306,7 @@ func gitParseCommit(output, user, domain []byte, ignoreCC map[string]bool) (*Com
 		Parents:    parents,
 		Recipients: sortedRecipients,
 		Tags:       tags,
+		Upstream:   upstream,
 		Date:       date,
 		CommitDate: commitDate,
 	}
@@ -347,6 +354,54 @@ func (git *git) GetCommitsByTitles(titles []string) ([]*Commit, []string, error)
 	return results, missing, nil
 }
 
+func (git *git) GetBackports(upstream []*Commit) (map[string]*Commit, error) {
+	var greps []string
+	for _, com := range upstream {
+		greps = append(greps, CanonicalizeCommit(com.Title))
+		if len(com.Hash) >= 12 {
+			// Backports may refer to the upstream commit by an abbreviated hash.
+			greps = append(greps, com.Hash[:12])
+		}
+	}
+	since := time.Now().Add(-time.Hour * 24 * 365 * fetchCommitsMaxAgeInYears).Format("01-02-2006")
+	commits, err := git.fetchCommits(since, "HEAD", "", "", greps, true)
+	if err != nil {
+		return nil, err
+	}
+	return matchBackports(upstream, commits), nil
+}
+
+// matchBackports matches the commits of a stable branch (the most recent first) with the upstream
+// commits. A reference to the upstream hash takes precedence over the title match, since
+// backports sometimes get their titles adjusted and unrelated commits may share the title.
+func matchBackports(upstream, commits []*Commit) map[string]*Commit {
+	ret := make(map[string]*Commit)
+	for _, com := range commits {
+		if com.Upstream == "" {
+			continue
+		}
+		for _, orig := range upstream {
+			if ret[orig.Title] == nil && orig.Hash != "" &&
+				(strings.HasPrefix(orig.Hash, com.Upstream) || strings.HasPrefix(com.Upstream, orig.Hash)) {
+				ret[orig.Title] = com
+			}
+		}
+	}
+	titles := make(map[string]string)
+	for _, orig := range upstream {
+		if ret[orig.Title] == nil {
+			titles[CanonicalizeCommit(orig.Title)] = orig.Title
+		}
+	}
+	for _, com := range commits {
+		if orig := titles[CanonicalizeCommit(com.Title)]; orig != "" {
+			delete(titles, CanonicalizeCommit(com.Title))
+			ret[orig] = com
+		}
+	}
+	return ret
+}
+
 func (git *git) ListRecentCommits(baseCommit string) ([]string, error) {
 	// On upstream kernel this produces ~11MB of output.
 	// Somewhat inefficient to collect whole output in a slice
@@ -366,6 +421,22 @@ func (git *git) ListCommitHashes(baseCommit string) ([]string, error) {
 	return strings.Split(string(output), "\n"), nil
 }
 
+func (git *git) CommitsTouching(from, to, path string, maxCommits int) ([]*Commit, error) {
+	output, err := git.git("log", "--format=%H", "-n", fmt.Sprint(maxCommits), from+".."+to, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*Commit
+	for _, hash := range strings.Fields(string(output)) {
+		com, err := git.getCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, com)
+	}
+	return ret, nil
+}
+
 func (git *git) ExtractFixTagsFromCommits(baseCommit, email string) ([]*Commit, error) {
 	user, domain, err := splitEmail(email)
 	if err != nil {
@@ -549,6 +620,18 @@ func (git *git) ReleaseTag(commit string) (string, error) {
 	return tags[0], nil
 }
 
+func (git *git) FirstReleaseTag(commit string) (string, error) {
+	output, err := git.git("tag", "--list", "--contains", commit, "v*.*")
+	if err != nil {
+		return "", err
+	}
+	tags := gitParseReleaseTags(output, true)
+	if len(tags) == 0 {
+		return "", nil
+	}
+	return tags[len(tags)-1], nil
+}
+
 func (git *git) previousReleaseTags(commit string, self, onlyTop, includeRC bool) ([]string, error) {
 	var tags []string
 	if self {
@@ -12,6 +12,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/syzkaller/pkg/debugtracer"
+	"github.com/google/syzkaller/pkg/osutil"
 )
 
 func init() {
@@ -411,3 +412,90 @@ func TestBisect(t *testing.T) {
 		}
 	}
 }
+
+func TestFirstReleaseTag(t *testing.T) {
+	t.Parallel()
+	repo := MakeTestRepo(t, t.TempDir())
+	if !repo.SupportsBisection() {
+		t.Skip("git binary is too old")
+	}
+	released := repo.CommitChange("released")
+	repo.SetTag("v6.6-rc1")
+	repo.CommitChange("other")
+	repo.SetTag("v6.6")
+	repo.SetTag("v6.6.1")
+	unreleased := repo.CommitChange("unreleased")
+	repo.SetTag("not-a-release")
+	for commit, want := range map[string]string{
+		released.Hash:   "v6.6-rc1",
+		unreleased.Hash: "",
+	} {
+		got, err := repo.repo.FirstReleaseTag(commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%v: got %q, want %q", commit, got, want)
+		}
+	}
+}
+
+func TestCommitsTouching(t *testing.T) {
+	t.Parallel()
+	repo := MakeTestRepo(t, t.TempDir())
+	commitFiles := func(title string, files ...string) *Commit {
+		for _, file := range files {
+			file := filepath.Join(repo.Dir, filepath.FromSlash(file))
+			if err := osutil.MkdirAll(filepath.Dir(file)); err != nil {
+				t.Fatal(err)
+			}
+			if err := osutil.WriteFile(file, []byte(title)); err != nil {
+				t.Fatal(err)
+			}
+			repo.Git("add", file)
+		}
+		return repo.CommitChange(title)
+	}
+	base := commitFiles("initial", "fs/ext4/inode.c", "fs/ext4/super.c", "mm/slab.c")
+	inode1 := commitFiles("ext4: fix inode", "fs/ext4/inode.c")
+	commitFiles("mm: fix slab", "mm/slab.c")
+	both := commitFiles("treewide: cleanup", "fs/ext4/inode.c", "mm/slab.c")
+	commitFiles("ext4: fix super", "fs/ext4/super.c")
+	head := commitFiles("ext4: fix inode again", "fs/ext4/inode.c")
+
+	titles := func(commits []*Commit) []string {
+		var ret []string
+		for _, com := range commits {
+			ret = append(ret, com.Title)
+		}
+		return ret
+	}
+	tests := []struct {
+		from string
+		path string
+		max  int
+		want []string
+	}{
+		{base.Hash, "fs/ext4/inode.c", 10, []string{"ext4: fix inode again", "treewide: cleanup", "ext4: fix inode"}},
+		{base.Hash, "fs/ext4/inode.c", 2, []string{"ext4: fix inode again", "treewide: cleanup"}},
+		// The commits before the cursor are not returned again.
+		{inode1.Hash, "fs/ext4/inode.c", 10, []string{"ext4: fix inode again", "treewide: cleanup"}},
+		{both.Hash, "mm/slab.c", 10, nil},
+		{base.Hash, "fs/ext4", 10, []string{"ext4: fix inode again", "ext4: fix super",
+			"treewide: cleanup", "ext4: fix inode"}},
+		{head.Hash, "fs/ext4/inode.c", 10, nil},
+	}
+	for _, test := range tests {
+		commits, err := repo.repo.CommitsTouching(test.from, head.Hash, test.path, test.max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.want, titles(commits)); diff != "" {
+			t.Errorf("%v since %v:\n%v", test.path, test.from, diff)
+		}
+	}
+	if _, err := repo.repo.CommitsTouching("0123456789012345678901234567890123456789", head.Hash,
+		"fs/ext4/inode.c", 10); err == nil {
+		t.Errorf("no error for an unknown commit")
+	}
+}
@@ -213,6 +213,124 @@ func TestGetCommitsByTitles(t *testing.T) {
 	}
 }
 
+func TestGetCommitsByTitlesRevert(t *testing.T) {
+	repo := MakeTestRepo(t, t.TempDir())
+	// The fix is reverted, then re-applied. Only the re-applied commit must be returned,
+	// and the revert must not be mistaken for the fix.
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "net: fix foo")
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "Revert \"net: fix foo\"")
+	revert, _ := repo.repo.HeadCommit()
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "net: fix foo")
+	reapplied, _ := repo.repo.HeadCommit()
+	results, missing, err := repo.repo.GetCommitsByTitles([]string{"net: fix foo", revert.Title})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 || len(results) != 2 {
+		t.Fatalf("got %v results, missing %v", len(results), missing)
+	}
+	for _, com := range results {
+		want := reapplied.Hash
+		if com.Title == revert.Title {
+			want = revert.Hash
+		}
+		if com.Hash != want {
+			t.Errorf("commit %q: got %v, want %v", com.Title, com.Hash, want)
+		}
+	}
+}
+
+func TestUpstreamCommitParse(t *testing.T) {
+	tests := map[string]string{
+		"commit 0123456789abcdef0123456789abcdef01234567 upstream.":    "0123456789abcdef0123456789abcdef01234567",
+		"commit 0123456789abcdef0123456789abcdef01234567 upstream":     "0123456789abcdef0123456789abcdef01234567",
+		"[ Upstream commit 0123456789abcdef0123456789abcdef01234567 ]": "0123456789abcdef0123456789abcdef01234567",
+		"[Upstream commit 0123456789ab]":                               "0123456789ab",
+		"Since commit 0123456789ab (\"foo\") upstream.":                "",
+		"commit 0123 upstream.":                                        "",
+	}
+	for line, want := range tests {
+		input := "2075b16e32c26e4031b9fd3cbe26c54676a8fcb5\nfoo: fix bar\nfoo@bar.com\nFoo Bar\n" +
+			"Fri May 11 16:02:14 2018 -0700\n78eb0c6356cda285c6ee6e29bea0c0188368103e\n" +
+			"Fri May 11 17:28:45 2018 -0700\n" + line + "\n\nSigned-off-by: Foo Bar <foo@bar.com>\n"
+		com, err := gitParseCommit([]byte(input), nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if com.Upstream != want {
+			t.Errorf("%q: got upstream %q, want %q", line, com.Upstream, want)
+		}
+	}
+}
+
+func TestMatchBackports(t *testing.T) {
+	upstream := []*Commit{
+		{Hash: "1111111111111111111111111111111111111111", Title: "foo: fix a"},
+		{Hash: "2222222222222222222222222222222222222222", Title: "foo: fix b"},
+		{Hash: "3333333333333333333333333333333333333333", Title: "foo: fix c"},
+		{Title: "foo: fix d"},
+	}
+	commits := []*Commit{
+		// The title was adjusted during backporting.
+		{Hash: "aaa", Title: "foo: fix a (5.15 backport)", Upstream: "111111111111"},
+		// The same title, but a different upstream commit.
+		{Hash: "bbb1", Title: "foo: fix b", Upstream: "4444444444444444444444444444444444444444"},
+		{Hash: "bbb2", Title: "foo: fix b", Upstream: "2222222222222222222222222222222222222222"},
+		{Hash: "ddd2", Title: "BACKPORT: foo: fix d"},
+		{Hash: "ddd1", Title: "foo: fix d"},
+	}
+	got := map[string]string{}
+	for title, com := range matchBackports(upstream, commits) {
+		got[title] = com.Hash
+	}
+	want := map[string]string{
+		"foo: fix a": "aaa",
+		"foo: fix b": "bbb2",
+		"foo: fix d": "ddd2",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestGetBackports(t *testing.T) {
+	baseDir := t.TempDir()
+	repo := MakeTestRepo(t, baseDir)
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "initial")
+	repo.Git("branch", "stable")
+	repo.Git("checkout", "-b", "upstream")
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "foo: fix a")
+	fixA, _ := repo.repo.HeadCommit()
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "foo: fix b")
+	fixB, _ := repo.repo.HeadCommit()
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "foo: fix c")
+	fixC, _ := repo.repo.HeadCommit()
+
+	repo.Git("checkout", "stable")
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "foo: fix a for stable",
+		"-m", "commit "+fixA.Hash+" upstream.")
+	backportA, _ := repo.repo.HeadCommit()
+	repo.Git("commit", "--no-edit", "--allow-empty", "-m", "foo: fix b")
+	backportB, _ := repo.repo.HeadCommit()
+
+	backports, err := repo.repo.GetBackports([]*Commit{fixA, fixB, fixC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backports) != 2 {
+		t.Fatalf("expected 2 backports, got %+v", backports)
+	}
+	if backports[fixA.Title].Hash != backportA.Hash {
+		t.Errorf("wrong backport of %q: %v", fixA.Title, backports[fixA.Title].Hash)
+	}
+	if backports[fixA.Title].Upstream != fixA.Hash {
+		t.Errorf("wrong upstream commit of %q: %v", fixA.Title, backports[fixA.Title].Upstream)
+	}
+	if backports[fixB.Title].Hash != backportB.Hash {
+		t.Errorf("wrong backport of %q: %v", fixB.Title, backports[fixB.Title].Hash)
+	}
+}
+
 func TestContains(t *testing.T) {
 	baseDir := t.TempDir()
 	repo := MakeTestRepo(t, baseDir)
@@ -46,6 +46,11 @@ type Repo interface {
 	// Returns list of commits and titles of commits that are not found.
 	GetCommitsByTitles(titles []string) ([]*Commit, []string, error)
 
+	// GetBackports finds backports of the upstream commits (only Hash and Title are used)
+	// in the checked out branch. A backport either has the same title or refers to the upstream
+	// commit hash as stable trees do. Returns the backports keyed by the upstream commit titles.
+	GetBackports(upstream []*Commit) (map[string]*Commit, error)
+
 	// ListRecentCommits returns list of recent commit titles starting from baseCommit.
 	ListRecentCommits(baseCommit string) ([]string, error)
 
@@ -57,6 +62,10 @@ type Repo interface {
 	// ReleaseTag returns the latest release tag that is reachable from the given commit.
 	ReleaseTag(commit string) (string, error)
 
+	// FirstReleaseTag returns the earliest release tag (including release candidates) that contains
+	// the given commit, or an empty string if the commit has not been released yet.
+	FirstReleaseTag(commit string) (string, error)
+
 	// Returns true if the current tree contains the specified commit.
 	// Remote is not fetched and only commits reachable from the checked out HEAD are searched
 	// (e.g. do CheckoutBranch before).
@@ -65,6 +74,10 @@ type Repo interface {
 	// ListCommitHashes lists all commit hashes reachable from baseCommit.
 	ListCommitHashes(baseCommit string) ([]string, error)
 
+	// CommitsTouching returns the commits in the from..to range that change the path
+	// (a file or a directory), the newest first. At most maxCommits commits are returned.
+	CommitsTouching(from, to, path string, maxCommits int) ([]*Commit, error)
+
 	// Object returns the contents of a git repository object at the particular moment in history.
 	Object(name, commit string) ([]byte, error)
 }
@@ -105,6 +118,8 @@ type Commit struct {
 	Recipients Recipients
 	Tags       []string
 	Parents    []string
+	// Upstream is the hash of the original commit if this commit is a stable tree backport.
+	Upstream   string
 	Date       time.Time
 	CommitDate time.Time
 }
@@ -272,6 +287,12 @@ func runSandboxed(dir, command string, args ...string) ([]byte, error) {
 	return osutil.Run(time.Hour, cmd)
 }
 
+// ReleaseTagOrder returns a number that orders the release tags (e.g. v6.7-rc1 < v6.7 < v6.7.1),
+// or 0 if the tag is not a release tag.
+func ReleaseTagOrder(tag string) uint64 {
+	return gitReleaseTagToInt(tag, true)
+}
+
 var (
 	// nolint: lll
 	gitLocalRepoRe = regexp.MustCompile(`^file:///[a-zA-Z0-9-_./~]+(/)?$`)
@@ -282,6 +303,9 @@ var (
 	gitBranchRe  = regexp.MustCompile("^[a-zA-Z0-9-_/.]{2,200}$")
 	gitHashRe    = regexp.MustCompile("^[a-f0-9]{8,40}$")
 	releaseTagRe = regexp.MustCompile(`^v([0-9]+).([0-9]+)(?:-rc([0-9]+))?(?:\.([0-9]+))?$`)
+	// Stable trees refer to the original commit as "commit X upstream." or "[ Upstream commit X ]".
+	upstreamCommitRe = regexp.MustCompile(`^\s*(?:commit ([0-9a-f]{12,40}) upstream\.?|` +
+		`\[\s*[Uu]pstream commit ([0-9a-f]{12,40})\s*\])\s*$`)
 	// CC: is intentionally not on this list, see #1441.
 	ccRes = []*regexp.Regexp{
 		regexp.MustCompile(`^Reviewed\-.*: (.*)$`),
@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -16,13 +17,16 @@ import (
 	"github.com/google/syzkaller/dashboard/dashapi"
 	"github.com/google/syzkaller/pkg/bisect"
 	"github.com/google/syzkaller/pkg/build"
+	"github.com/google/syzkaller/pkg/csource"
 	"github.com/google/syzkaller/pkg/debugtracer"
 	"github.com/google/syzkaller/pkg/instance"
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/mgrconfig"
 	"github.com/google/syzkaller/pkg/osutil"
 	"github.com/google/syzkaller/pkg/report"
+	"github.com/google/syzkaller/pkg/repro"
 	"github.com/google/syzkaller/pkg/vcs"
+	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/vm"
 )
 
@@ -204,7 +208,9 @@ func (jp *JobProcessor) pollManagerCommits(mgr *Manager) error {
 		return fmt.Errorf("no repos")
 	}
 	commits := make(map[string]*vcs.Commit)
-	for i, repo := range resp.Repos {
+	// The hashes of the requested commits in all repos.
+	infoHashes := make(map[string][]string)
+	for i, repo := range commitPollRepos(resp) {
 		if brokenRepo(repo.URL) {
 			continue
 		}
@@ -227,7 +233,9 @@ func (jp *JobProcessor) pollManagerCommits(mgr *Manager) error {
 				}
 			}
 		}
-		if i == 0 && len(resp.Commits) != 0 {
+		if len(resp.Commits) != 0 {
+			// Fix commits are looked up in all repos to detect titles that match different commits
+			// (e.g. the original commit and its re-application after a revert).
 			commits1, err := jp.getCommitInfo(mgr, repo.URL, repo.Branch, resp.Commits)
 			if err != nil {
 				jp.Errorf("failed to poll %v %v: %v", repo.URL, repo.Branch, err)
@@ -235,6 +243,10 @@ func (jp *JobProcessor) pollManagerCommits(mgr *Manager) error {
 			}
 			jp.Logf(1, "got %v commit infos from %v/%v repo", len(commits1), repo.URL, repo.Branch)
 			for _, com := range commits1 {
+				infoHashes[com.Title] = append(infoHashes[com.Title], com.Hash)
+				if i != 0 {
+					continue
+				}
 				// GetCommitByTitle does not accept ReportEmail and does not return tags,
 				// so don't replace the existing commit.
 				if _, ok := commits[com.Title]; !ok {
@@ -246,14 +258,183 @@ func (jp *JobProcessor) pollManagerCommits(mgr *Manager) error {
 	results := make([]dashapi.Commit, 0, len(commits))
 	for _, com := range commits {
 		results = append(results, dashapi.Commit{
-			Hash:   com.Hash,
+			Hash:              com.Hash,
+			Title:             com.Title,
+			Author:            com.Author,
+			BugIDs:            com.Tags,
+			Date:              com.Date,
+			ConflictingHashes: conflictingHashes(com.Hash, infoHashes[com.Title]),
+		})
+	}
+	if err := mgr.dash.UploadCommits(results); err != nil {
+		return err
+	}
+	if err := jp.pollManagerBackports(mgr, resp.Backports); err != nil {
+		return err
+	}
+	if err := jp.pollManagerReleases(mgr, resp.Repos[0], resp.Releases); err != nil {
+		return err
+	}
+	return jp.pollManagerWatches(mgr, resp.Repos[0], resp.Watches)
+}
+
+// conflictingHashes returns the unique hashes that differ from the main repo hash.
+func conflictingHashes(hash string, hashes []string) []string {
+	if hash == "" {
+		return nil
+	}
+	var ret []string
+	seen := map[string]bool{hash: true}
+	for _, other := range hashes {
+		if !seen[other] {
+			seen[other] = true
+			ret = append(ret, other)
+		}
+	}
+	return ret
+}
+
+func (jp *JobProcessor) pollManagerBackports(mgr *Manager, polls []dashapi.BackportPoll) error {
+	var results []dashapi.BackportResult
+	for _, poll := range polls {
+		if len(poll.Commits) == 0 || brokenRepo(poll.Repo.URL) {
+			continue
+		}
+		backports, err := jp.getBackports(mgr, poll.Repo.URL, poll.Repo.Branch, poll.Commits)
+		if err != nil {
+			jp.Errorf("failed to poll backports in %v %v: %v", poll.Repo.URL, poll.Repo.Branch, err)
+			continue
+		}
+		result := makeBackportResult(poll, backports)
+		jp.Logf(1, "found %v backports, %v missing in %v/%v",
+			len(result.Found), len(result.Missing), poll.Repo.URL, poll.Repo.Branch)
+		results = append(results, result)
+	}
+	return mgr.dash.UploadBackports(results)
+}
+
+func (jp *JobProcessor) pollManagerReleases(mgr *Manager, main dashapi.Repo, commits []dashapi.Commit) error {
+	if len(commits) == 0 || brokenRepo(main.URL) {
+		return nil
+	}
+	repo, _, err := jp.checkoutMainRepo(mgr, main)
+	if err != nil {
+		return err
+	}
+	var results []dashapi.ReleaseResult
+	for _, com := range commits {
+		release, err := repo.FirstReleaseTag(com.Hash)
+		if err != nil {
+			jp.Errorf("failed to find the release of %v in %v %v: %v", com.Hash, main.URL, main.Branch, err)
+			continue
+		}
+		results = append(results, dashapi.ReleaseResult{
+			Title:   com.Title,
+			Hash:    com.Hash,
+			Release: release,
+		})
+	}
+	jp.Logf(1, "looked up the releases of %v commits in %v/%v", len(results), main.URL, main.Branch)
+	return mgr.dash.UploadReleases(results)
+}
+
+// Max number of commits per watched path reported in one poll.
+const watchMaxCommits = 20
+
+func (jp *JobProcessor) pollManagerWatches(mgr *Manager, main dashapi.Repo, watches []dashapi.WatchPoll) error {
+	if len(watches) == 0 || brokenRepo(main.URL) {
+		return nil
+	}
+	repo, head, err := jp.checkoutMainRepo(mgr, main)
+	if err != nil {
+		return err
+	}
+	var results []dashapi.WatchResult
+	for _, watch := range watches {
+		result := dashapi.WatchResult{
+			ID:         watch.ID,
+			LastCommit: head.Hash,
+		}
+		for _, path := range watch.Paths {
+			if watch.LastCommit == "" {
+				break
+			}
+			commits, err := repo.CommitsTouching(watch.LastCommit, head.Hash, path, watchMaxCommits)
+			if err != nil {
+				// Most likely the cursor commit is gone after a rebase, restart from HEAD.
+				jp.Errorf("failed to list changes of %v since %v in %v %v: %v",
+					path, watch.LastCommit, main.URL, main.Branch, err)
+				result.Changes = nil
+				break
+			}
+			if len(commits) == 0 {
+				continue
+			}
+			change := dashapi.WatchChange{Path: path}
+			for _, com := range commits {
+				change.Commits = append(change.Commits, dashapi.Commit{
+					Hash:   com.Hash,
+					Title:  com.Title,
+					Author: com.Author,
+					Date:   com.Date,
+				})
+			}
+			result.Changes = append(result.Changes, change)
+		}
+		results = append(results, result)
+	}
+	jp.Logf(1, "checked %v watches in %v/%v", len(results), main.URL, main.Branch)
+	return mgr.dash.UploadWatchResults(results)
+}
+
+// checkoutMainRepo checkouts the main repo of the namespace in the kernel dir of the manager OS.
+func (jp *JobProcessor) checkoutMainRepo(mgr *Manager, main dashapi.Repo) (vcs.Repo, *vcs.Commit, error) {
+	dir := filepath.Join(jp.baseDir, mgr.managercfg.TargetOS, "kernel")
+	repo, err := vcs.NewRepo(mgr.managercfg.TargetOS, mgr.managercfg.Type, dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kernel repo: %v", err)
+	}
+	head, err := repo.CheckoutBranch(main.URL, main.Branch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to checkout kernel repo %v/%v: %v", main.URL, main.Branch, err)
+	}
+	return repo, head, nil
+}
+
+func makeBackportResult(poll dashapi.BackportPoll, backports map[string]*vcs.Commit) dashapi.BackportResult {
+	result := dashapi.BackportResult{Repo: poll.Repo}
+	for _, com := range poll.Commits {
+		backport := backports[com.Title]
+		if backport == nil {
+			result.Missing = append(result.Missing, com.Title)
+			continue
+		}
+		result.Found = append(result.Found, dashapi.Commit{
+			Hash:   backport.Hash,
 			Title:  com.Title,
-			Author: com.Author,
-			BugIDs: com.Tags,
-			Date:   com.Date,
+			Author: backport.Author,
+			Date:   backport.Date,
 		})
 	}
-	return mgr.dash.UploadCommits(results)
+	return result
+}
+
+// commitPollRepos returns the repos in the order they need to be polled: the main repo first,
+// then the repos that fixes are likely to land in according to the dashboard, then the rest.
+// The order matters since the number of commits uploaded at once is limited.
+func commitPollRepos(resp *dashapi.CommitPollResp) []dashapi.Repo {
+	if len(resp.Repos) == 0 {
+		return nil
+	}
+	ret := []dashapi.Repo{resp.Repos[0]}
+	seen := map[dashapi.Repo]bool{resp.Repos[0]: true}
+	for _, repo := range append(append([]dashapi.Repo{}, resp.HintedRepos...), resp.Repos[1:]...) {
+		if !seen[repo] {
+			seen[repo] = true
+			ret = append(ret, repo)
+		}
+	}
+	return ret
 }
 
 func (jp *JobProcessor) pollRepo(mgr *Manager, URL, branch, reportEmail string) ([]*vcs.Commit, error) {
@@ -287,6 +468,23 @@ func (jp *JobProcessor) getCommitInfo(mgr *Manager, URL, branch string, commits
 	return results, nil
 }
 
+func (jp *JobProcessor) getBackports(mgr *Manager, URL, branch string,
+	commits []dashapi.Commit) (map[string]*vcs.Commit, error) {
+	dir := filepath.Join(jp.baseDir, mgr.managercfg.TargetOS, "kernel")
+	repo, err := vcs.NewRepo(mgr.managercfg.TargetOS, mgr.managercfg.Type, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kernel repo: %v", err)
+	}
+	if _, err = repo.CheckoutBranch(URL, branch); err != nil {
+		return nil, fmt.Errorf("failed to checkout kernel repo %v/%v: %v", URL, branch, err)
+	}
+	var upstream []*vcs.Commit
+	for _, com := range commits {
+		upstream = append(upstream, &vcs.Commit{Hash: com.Hash, Title: com.Title})
+	}
+	return repo.GetBackports(upstream)
+}
+
 func (jp *JobProcessor) pollJobs() {
 	poll := &dashapi.JobPollReq{
 		Managers: make(map[string]dashapi.ManagerJobs),
@@ -300,8 +498,12 @@ func (jp *JobProcessor) pollJobs() {
 			TestPatches: jobs.TestPatches,
 			BisectCause: jobs.BisectCause,
 			BisectFix:   jobs.BisectFix,
+			Minimize:    jobs.Minimize,
+
+			MinimizeConfig: jobs.MinimizeConfig,
 		}
-		if apiJobs.TestPatches || apiJobs.BisectCause || apiJobs.BisectFix {
+		if apiJobs.TestPatches || apiJobs.BisectCause || apiJobs.BisectFix || apiJobs.Minimize ||
+			apiJobs.MinimizeConfig {
 			poll.Managers[mgr.name] = apiJobs
 		}
 	}
@@ -400,6 +602,21 @@ func (jp *JobProcessor) process(job *Job) *dashapi.JobDoneReq {
 		resp.Build.KernelCommitTitle = req.KernelCommitTitle
 		resp.Build.KernelCommitDate = req.KernelCommitDate
 		resp.Build.KernelConfig = req.KernelConfig
+	case dashapi.JobMinimize:
+		mgrcfg.Name += "-minimize" + jp.instanceSuffix
+		resp.Build.KernelRepo = req.KernelRepo
+		resp.Build.KernelBranch = req.KernelBranch
+		resp.Build.KernelCommit = req.KernelCommit
+		resp.Build.KernelCommitTitle = req.KernelCommitTitle
+		resp.Build.KernelCommitDate = req.KernelCommitDate
+	case dashapi.JobMinimizeConfig:
+		mgrcfg.Name += "-config" + jp.instanceSuffix
+		resp.Build.KernelRepo = mgr.mgrcfg.Repo
+		resp.Build.KernelBranch = mgr.mgrcfg.Branch
+		resp.Build.KernelCommit = req.KernelCommit
+		resp.Build.KernelCommitTitle = req.KernelCommitTitle
+		resp.Build.KernelCommitDate = req.KernelCommitDate
+		resp.Build.KernelConfig = req.KernelConfig
 	default:
 		err := fmt.Errorf("bad job type %v", req.Type)
 		job.resp.Error = []byte(err.Error())
@@ -419,6 +636,7 @@ func (jp *JobProcessor) process(job *Job) *dashapi.JobDoneReq {
 		// or it's a boot time bug, in which case both are empty.
 		{"reproducer consistency", (len(req.ReproOpts) != 0 && len(req.ReproSyz) != 0) ||
 			(len(req.ReproOpts) == 0 && len(req.ReproSyz) == 0)},
+		{"syz reproducer", len(req.ReproSyz) != 0 || req.Type != dashapi.JobMinimize},
 	}
 	for _, req := range required {
 		if !req.ok {
@@ -433,12 +651,31 @@ func (jp *JobProcessor) process(job *Job) *dashapi.JobDoneReq {
 		return job.resp
 	}
 
+	if len(req.ReproSyz) != 0 {
+		migrated, err := migrateRepro(mgr.managercfg.Target, req.ReproSyz)
+		if err != nil {
+			job.resp.ReproParseError = err.Error()
+			job.resp.Error = []byte(fmt.Sprintf("failed to parse program: %v", err))
+			jp.Errorf("%s", job.resp.Error)
+			return job.resp
+		}
+		if migrated != nil {
+			log.Logf(0, "job %v: migrated the syz reproducer to the current descriptions", req.ID)
+			job.resp.ReproSyzMigrated = migrated
+			req.ReproSyz = migrated
+		}
+	}
+
 	var err error
 	switch req.Type {
 	case dashapi.JobTestPatch:
 		err = jp.testPatch(job, mgrcfg)
 	case dashapi.JobBisectCause, dashapi.JobBisectFix:
 		err = jp.bisect(job, mgrcfg)
+	case dashapi.JobMinimize:
+		err = jp.minimize(job, mgrcfg)
+	case dashapi.JobMinimizeConfig:
+		err = jp.minimizeConfig(job, mgrcfg)
 	}
 	if err != nil {
 		job.resp.Error = []byte(err.Error())
@@ -446,6 +683,45 @@ func (jp *JobProcessor) process(job *Job) *dashapi.JobDoneReq {
 	return job.resp
 }
 
+// migrateRepro checks that the stored syz reproducer can be parsed with the current descriptions.
+// If it can't, the reproducer is migrated: calls that no longer exist are replaced with
+// their generic variants (or dropped if there are none) and the program is deserialized
+// in non-strict mode, which drops the no longer matching arguments, and serialized back.
+// It returns nil if the reproducer does not need a migration.
+func migrateRepro(target *prog.Target, repro []byte) ([]byte, error) {
+	if _, err := target.Deserialize(repro, prog.Strict); err == nil {
+		return nil, nil
+	}
+	var lines [][]byte
+	for _, line := range bytes.Split(repro, []byte("\n")) {
+		call := reproCallRe.FindSubmatchIndex(line)
+		if call == nil {
+			lines = append(lines, line)
+			continue
+		}
+		name := string(line[call[2]:call[3]])
+		if target.SyscallMap[name] != nil {
+			lines = append(lines, line)
+			continue
+		}
+		if pos := strings.IndexByte(name, '$'); pos != -1 && target.SyscallMap[name[:pos]] != nil {
+			line = append(append(append([]byte{}, line[:call[2]]...), name[:pos]...), line[call[3]:]...)
+			lines = append(lines, line)
+		}
+	}
+	p, err := target.Deserialize(bytes.Join(lines, []byte("\n")), prog.NonStrict)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Calls) == 0 {
+		return nil, fmt.Errorf("no calls left after the migration")
+	}
+	return p.Serialize(), nil
+}
+
+// reproCallRe matches a call line of a serialized program, the group is the syscall name.
+var reproCallRe = regexp.MustCompile(`^\s*(?:r[0-9]+\s*=\s*)?([a-zA-Z0-9_$]+)\(`)
+
 func (jp *JobProcessor) bisect(job *Job, mgrcfg *mgrconfig.Config) error {
 	req, resp, mgr := job.req, job.resp, job.mgr
 
@@ -518,6 +794,8 @@ func (jp *JobProcessor) bisect(job *Job, mgrcfg *mgrconfig.Config) error {
 		Manager:        mgrcfg,
 		BuildSemaphore: buildSem,
 		TestSemaphore:  testSem,
+		BuildOnly:      req.BuildOnly,
+		TestRepeats:    req.BisectTestRepeats,
 	}
 
 	res, err := bisect.Run(cfg)
@@ -525,6 +803,17 @@ func (jp *JobProcessor) bisect(job *Job, mgrcfg *mgrconfig.Config) error {
 	if err != nil {
 		return err
 	}
+	for _, rev := range res.Revisions {
+		resp.Revisions = append(resp.Revisions, dashapi.BisectRevision{
+			Commit:  rev.Commit,
+			Runs:    rev.Runs,
+			Crashes: rev.Crashes,
+			Errors:  rev.Errors,
+			Skipped: rev.Skipped,
+		})
+	}
+	resp.GuiltyFile = res.GuiltyFile
+	resp.TouchesGuiltyFile = res.TouchesGuiltyFile
 	for _, com := range res.Commits {
 		resp.Commits = append(resp.Commits, dashapi.Commit{
 			Hash:       com.Hash,
@@ -575,8 +864,85 @@ func (jp *JobProcessor) bisect(job *Job, mgrcfg *mgrconfig.Config) error {
 	return nil
 }
 
-func (jp *JobProcessor) testPatch(job *Job, mgrcfg *mgrconfig.Config) error {
+// minimizeConfig minimizes the kernel config of the reproducer against the baseline config
+// on the original kernel commit and uploads the result as an asset.
+func (jp *JobProcessor) minimizeConfig(job *Job, mgrcfg *mgrconfig.Config) error {
 	req, resp, mgr := job.req, job.resp, job.mgr
+	if mgr.storage == nil {
+		return fmt.Errorf("asset storage is not configured")
+	}
+	if err := instance.OverrideVMCount(mgrcfg, bisect.MaxNumTests); err != nil {
+		return err
+	}
+	baseline, err := os.ReadFile(mgr.mgrcfg.KernelBaselineConfig)
+	if err != nil {
+		return fmt.Errorf("failed to read baseline config: %v", err)
+	}
+	trace := new(bytes.Buffer)
+	cfg := &bisect.Config{
+		Trace: &debugtracer.GenericTracer{
+			TraceWriter: io.MultiWriter(trace, log.VerboseWriter(3)),
+			OutDir:      osutil.Abs(filepath.Join("jobs", "debug", strings.Replace(req.ID, "|", "_", -1))),
+		},
+		// Config minimization does not need to build more than a few dozen kernels.
+		Timeout:         4 * time.Hour,
+		DefaultCompiler: mgr.mgrcfg.Compiler,
+		CompilerType:    mgr.mgrcfg.CompilerType,
+		BinDir:          jp.cfg.BisectBinDir,
+		Linker:          mgr.mgrcfg.Linker,
+		Ccache:          jp.cfg.Ccache,
+		Kernel: bisect.KernelConfig{
+			Repo:           mgr.mgrcfg.Repo,
+			Branch:         mgr.mgrcfg.Branch,
+			Commit:         req.KernelCommit,
+			CommitTitle:    req.KernelCommitTitle,
+			Cmdline:        mgr.mgrcfg.KernelCmdline,
+			Sysctl:         mgr.mgrcfg.KernelSysctl,
+			Config:         req.KernelConfig,
+			BaselineConfig: baseline,
+			Userspace:      mgr.mgrcfg.Userspace,
+		},
+		Syzkaller: bisect.SyzkallerConfig{
+			Repo:   jp.cfg.SyzkallerRepo,
+			Commit: req.SyzkallerCommit,
+		},
+		Repro: bisect.ReproConfig{
+			Opts: req.ReproOpts,
+			Syz:  req.ReproSyz,
+			C:    req.ReproC,
+		},
+		Manager:        mgrcfg,
+		BuildSemaphore: buildSem,
+		TestSemaphore:  testSem,
+		ConfigOnly:     true,
+	}
+	res, err := bisect.Run(cfg)
+	resp.Log = trace.Bytes()
+	if err != nil {
+		return err
+	}
+	if res.Report != nil {
+		resp.CrashTitle = res.Report.Title
+		resp.CrashAltTitles = res.Report.AltTitles
+		resp.CrashReport = res.Report.Report
+		resp.CrashLog = res.Report.Output
+	}
+	if bytes.Equal(res.Config, req.KernelConfig) {
+		jp.Logf(0, "job: the kernel config could not be minimized")
+		return nil
+	}
+	resp.Build.KernelConfig = res.Config
+	newAsset, err := mgr.storage.UploadCrashAsset(bytes.NewReader(res.Config),
+		fmt.Sprintf("config-%v", req.KernelCommit), dashapi.MinimizedConfig, nil)
+	if err != nil {
+		return fmt.Errorf("failed to upload the minimized config: %w", err)
+	}
+	resp.Assets = append(resp.Assets, newAsset)
+	return nil
+}
+
+func (jp *JobProcessor) testPatch(job *Job, mgrcfg *mgrconfig.Config) error {
+	req, resp := job.req, job.resp
 	env, err := instance.NewEnv(mgrcfg, buildSem, testSem)
 	if err != nil {
 		return err
@@ -619,6 +985,105 @@ func (jp *JobProcessor) testPatch(job *Job, mgrcfg *mgrconfig.Config) error {
 		}
 	}
 
+	if err := jp.buildKernel(job, env); err != nil {
+		return err
+	}
+	jp.Logf(0, "job: testing...")
+	results, err := env.Test(3, req.ReproSyz, req.ReproOpts, req.ReproC)
+	if err != nil {
+		return fmt.Errorf("%w\n\nsyzkaller build log:\n%s", err, syzBuildLog)
+	}
+	ret, err := aggregateTestResults(results)
+	if err != nil {
+		return fmt.Errorf("%w\n\nsyzkaller build log:\n%s", err, syzBuildLog)
+	}
+	rep := ret.report
+	if rep != nil {
+		resp.CrashTitle = rep.Title
+		resp.CrashAltTitles = rep.AltTitles
+		resp.CrashReport = rep.Report
+	}
+	resp.CrashLog = ret.rawOutput
+	resp.ReproAttempts = ret.attempts
+	resp.ReproSuccesses = ret.successes
+	return nil
+}
+
+// minimize reruns reproduction and minimization of the syz reproducer on the kernel commit of the original crash.
+// If the reproducer does not work any more, the job finishes without a reproducer and without an error.
+func (jp *JobProcessor) minimize(job *Job, mgrcfg *mgrconfig.Config) error {
+	req, resp := job.req, job.resp
+	env, err := instance.NewEnv(mgrcfg, buildSem, testSem)
+	if err != nil {
+		return err
+	}
+	jp.Logf(0, "building syzkaller on %v...", req.SyzkallerCommit)
+	if _, err := env.BuildSyzkaller(jp.cfg.SyzkallerRepo, req.SyzkallerCommit); err != nil {
+		return err
+	}
+	jp.Logf(0, "fetching kernel...")
+	repo, err := vcs.NewRepo(mgrcfg.TargetOS, mgrcfg.Type, mgrcfg.KernelSrc)
+	if err != nil {
+		return fmt.Errorf("failed to create kernel repo: %v", err)
+	}
+	if _, err := repo.CheckoutCommit(req.KernelRepo, req.KernelCommit); err != nil {
+		return fmt.Errorf("failed to checkout kernel repo %v on commit %v: %v",
+			req.KernelRepo, req.KernelCommit, err)
+	}
+	if err := build.Clean(mgrcfg.TargetOS, mgrcfg.TargetVMArch, mgrcfg.Type, mgrcfg.KernelSrc); err != nil {
+		return fmt.Errorf("kernel clean failed: %v", err)
+	}
+	if err := jp.buildKernel(job, env); err != nil {
+		return err
+	}
+	jp.Logf(0, "job: minimizing the reproducer...")
+	testSem.Wait()
+	defer testSem.Signal()
+	if err := mgrconfig.Complete(mgrcfg); err != nil {
+		return err
+	}
+	reporter, err := report.NewReporter(mgrcfg)
+	if err != nil {
+		return err
+	}
+	vmPool, err := vm.Create(mgrcfg, false)
+	if err != nil {
+		return fmt.Errorf("failed to create VM pool: %v", err)
+	}
+	var vmIndexes []int
+	for i := 0; i < vmPool.Count(); i++ {
+		vmIndexes = append(vmIndexes, i)
+	}
+	// The syz reproducer is a valid execution log, so repro treats it as a crash log.
+	res, _, err := repro.Run(req.ReproSyz, mgrcfg, nil, reporter, vmPool, vmIndexes)
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		jp.Logf(0, "job: the reproducer did not trigger the crash")
+		return nil
+	}
+	resp.CrashTitle = res.Report.Title
+	resp.CrashAltTitles = res.Report.AltTitles
+	resp.CrashReport = res.Report.Report
+	resp.CrashLog = res.Report.Output
+	resp.ReproOpts = res.Opts.Serialize()
+	resp.ReproSyz = res.Prog.Serialize()
+	if res.CRepro {
+		cprog, err := csource.Write(res.Prog, res.Opts)
+		if err != nil {
+			return fmt.Errorf("failed to write C source: %v", err)
+		}
+		if formatted, err := csource.Format(cprog); err == nil {
+			cprog = formatted
+		}
+		resp.ReproC = cprog
+	}
+	return nil
+}
+
+func (jp *JobProcessor) buildKernel(job *Job, env instance.Env) error {
+	req, resp, mgr := job.req, job.resp, job.mgr
 	// Disable CONFIG_DEBUG_INFO_BTF in the config.
 	// DEBUG_INFO_BTF requires a very new pahole binary, which we don't have on syzbot instances.
 	// Currently we don't enable DEBUG_INFO_BTF, but we have some old bugs with DEBUG_INFO_BTF enabled
@@ -650,28 +1115,15 @@ func (jp *JobProcessor) testPatch(job *Job, mgrcfg *mgrconfig.Config) error {
 			return fmt.Errorf("failed to read config file: %v", err)
 		}
 	}
-	jp.Logf(0, "job: testing...")
-	results, err := env.Test(3, req.ReproSyz, req.ReproOpts, req.ReproC)
-	if err != nil {
-		return fmt.Errorf("%w\n\nsyzkaller build log:\n%s", err, syzBuildLog)
-	}
-	ret, err := aggregateTestResults(results)
-	if err != nil {
-		return fmt.Errorf("%w\n\nsyzkaller build log:\n%s", err, syzBuildLog)
-	}
-	rep := ret.report
-	if rep != nil {
-		resp.CrashTitle = rep.Title
-		resp.CrashAltTitles = rep.AltTitles
-		resp.CrashReport = rep.Report
-	}
-	resp.CrashLog = ret.rawOutput
 	return nil
 }
 
 type patchTestResult struct {
 	report    *report.Report
 	rawOutput []byte
+	// The number of the runs that executed the reproducer and of the runs that crashed.
+	attempts  int
+	successes int
 }
 
 func aggregateTestResults(results []instance.EnvTestResult) (*patchTestResult, error) {
@@ -682,9 +1134,11 @@ func aggregateTestResults(results []instance.EnvTestResult) (*patchTestResult, e
 	// If all instances failed to boot, then we report one of these errors.
 	var anyErr, testErr error
 	var resReport, resSuccess *patchTestResult
+	var attempts, successes int
 	anyErr = fmt.Errorf("no env test runs")
 	for _, res := range results {
 		if res.Error == nil {
+			attempts++
 			resSuccess = &patchTestResult{rawOutput: res.RawOutput}
 			continue
 		}
@@ -699,15 +1153,19 @@ func aggregateTestResults(results []instance.EnvTestResult) (*patchTestResult, e
 				testErr = fmt.Errorf("%v\n\n%s", err.Title, err.Output)
 			}
 		case *instance.CrashError:
+			attempts++
+			successes++
 			if resReport == nil || (len(resReport.report.Report) == 0 && len(err.Report.Report) != 0) {
 				resReport = &patchTestResult{report: err.Report, rawOutput: res.RawOutput}
 			}
 		}
 	}
 	if resReport != nil {
+		resReport.attempts, resReport.successes = attempts, successes
 		return resReport, nil
 	}
 	if resSuccess != nil {
+		resSuccess.attempts = attempts
 		return resSuccess, nil
 	}
 	if testErr != nil {
@@ -6,10 +6,16 @@ package main
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/google/syzkaller/dashboard/dashapi"
 	"github.com/google/syzkaller/pkg/instance"
 	"github.com/google/syzkaller/pkg/report"
+	"github.com/google/syzkaller/pkg/vcs"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
 )
 
 func TestAggregateTestResults(t *testing.T) {
@@ -18,12 +24,14 @@ func TestAggregateTestResults(t *testing.T) {
 		title   string
 		err     error
 		rawOut  []byte
+		runs    [2]int // attempts and successes
 	}{
 		{
 			results: []instance.EnvTestResult{{}, {}, {RawOutput: []byte{1, 2, 3}}},
 			title:   "",
 			err:     nil,
 			rawOut:  []byte{1, 2, 3},
+			runs:    [2]int{3, 0},
 		},
 		{
 			results: []instance.EnvTestResult{
@@ -33,6 +41,7 @@ func TestAggregateTestResults(t *testing.T) {
 			},
 			title: "title1",
 			err:   nil,
+			runs:  [2]int{3, 3},
 		},
 		{
 			results: []instance.EnvTestResult{
@@ -42,6 +51,7 @@ func TestAggregateTestResults(t *testing.T) {
 			},
 			title: "title2",
 			err:   nil,
+			runs:  [2]int{3, 1},
 		},
 		{
 			results: []instance.EnvTestResult{
@@ -51,6 +61,7 @@ func TestAggregateTestResults(t *testing.T) {
 			},
 			title: "title2",
 			err:   nil,
+			runs:  [2]int{1, 1},
 		},
 		{
 			results: []instance.EnvTestResult{
@@ -60,6 +71,7 @@ func TestAggregateTestResults(t *testing.T) {
 			},
 			title: "",
 			err:   nil,
+			runs:  [2]int{1, 0},
 		},
 		{
 			results: []instance.EnvTestResult{
@@ -107,6 +119,7 @@ func TestAggregateTestResults(t *testing.T) {
 			title:  "title2",
 			err:    nil,
 			rawOut: []byte{2, 3, 4},
+			runs:   [2]int{3, 3},
 		},
 	}
 	for i, test := range tests {
@@ -128,5 +141,152 @@ func TestAggregateTestResults(t *testing.T) {
 		if fmt.Sprint(test.rawOut) != fmt.Sprint(gotOutput) {
 			t.Errorf("test #%v: got raw out: %q, want: %q", i, gotOutput, test.rawOut)
 		}
+		var gotRuns [2]int
+		if rep != nil {
+			gotRuns = [2]int{rep.attempts, rep.successes}
+		}
+		if gotRuns != test.runs {
+			t.Errorf("test #%v: got runs: %v, want: %v", i, gotRuns, test.runs)
+		}
+	}
+}
+
+func TestCommitPollRepos(t *testing.T) {
+	mainRepo := dashapi.Repo{URL: "git://main.git", Branch: "master"}
+	next := dashapi.Repo{URL: "git://next.git", Branch: "master"}
+	net := dashapi.Repo{URL: "git://net.git", Branch: "main"}
+	netNext := dashapi.Repo{URL: "git://net-next.git", Branch: "main"}
+	tests := []struct {
+		resp  *dashapi.CommitPollResp
+		repos []dashapi.Repo
+	}{
+		{
+			resp:  &dashapi.CommitPollResp{},
+			repos: nil,
+		},
+		{
+			resp: &dashapi.CommitPollResp{
+				Repos: []dashapi.Repo{mainRepo, next, net, netNext},
+			},
+			repos: []dashapi.Repo{mainRepo, next, net, netNext},
+		},
+		{
+			resp: &dashapi.CommitPollResp{
+				Repos:       []dashapi.Repo{mainRepo, next, net, netNext},
+				HintedRepos: []dashapi.Repo{netNext, net},
+			},
+			repos: []dashapi.Repo{mainRepo, netNext, net, next},
+		},
+		{
+			// The main repo stays the first one.
+			resp: &dashapi.CommitPollResp{
+				Repos:       []dashapi.Repo{mainRepo, next},
+				HintedRepos: []dashapi.Repo{next, mainRepo},
+			},
+			repos: []dashapi.Repo{mainRepo, next},
+		},
+	}
+	for i, test := range tests {
+		repos := commitPollRepos(test.resp)
+		if !reflect.DeepEqual(repos, test.repos) {
+			t.Errorf("test #%v: got %v, want %v", i, repos, test.repos)
+		}
+	}
+}
+
+func TestMakeBackportResult(t *testing.T) {
+	repo := dashapi.Repo{URL: "git://stable.git", Branch: "linux-6.1.y"}
+	date := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	poll := dashapi.BackportPoll{
+		Repo: repo,
+		Commits: []dashapi.Commit{
+			{Hash: "1111111111111111111111111111111111111111", Title: "foo: fix a"},
+			{Title: "foo: fix b"},
+		},
+	}
+	backports := map[string]*vcs.Commit{
+		"foo: fix a": {Hash: "aaaa", Title: "foo: fix a (backport)", Author: "a@b.com", Date: date},
+	}
+	want := dashapi.BackportResult{
+		Repo:    repo,
+		Found:   []dashapi.Commit{{Hash: "aaaa", Title: "foo: fix a", Author: "a@b.com", Date: date}},
+		Missing: []string{"foo: fix b"},
+	}
+	if got := makeBackportResult(poll, backports); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestConflictingHashes(t *testing.T) {
+	tests := []struct {
+		hash   string
+		hashes []string
+		want   []string
+	}{
+		{"aaaa", []string{"aaaa", "aaaa"}, nil},
+		// The fix was re-applied in a tree that still had the reverted original.
+		{"aaaa", []string{"aaaa", "bbbb", "cccc", "bbbb"}, []string{"bbbb", "cccc"}},
+		// The commit was not found in the main repo.
+		{"", []string{"bbbb"}, nil},
+	}
+	for i, test := range tests {
+		if got := conflictingHashes(test.hash, test.hashes); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test #%v: got %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestMigrateRepro(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		repro  string
+		result string
+		err    bool
+	}{
+		{
+			name:  "up-to-date",
+			repro: "r0 = test$res0()\ntest$res1(r0)\n",
+		},
+		{
+			name:   "excessive-args",
+			repro:  "test$int(0x1, 0x2, 0x3, 0x4, 0x5, 0x6)\n",
+			result: "test$int(0x1, 0x2, 0x3, 0x4, 0x5)\n",
+		},
+		{
+			name:   "renamed-variant",
+			repro:  "# https://syzkaller.appspot.com/bug?id=1\n#{\"repeat\":true}\ntest$int(0x1)\ntest$renamed(0x1, 0x2)\n",
+			result: "test$int(0x1, 0x0, 0x0, 0x0, 0x0)\ntest()\n",
+		},
+		{
+			name:   "removed-syscall",
+			repro:  "r0 = removed_syscall()\ntest$res1(r0)\n",
+			result: "test$res1(0xffff)\n",
+		},
+		{
+			name:  "nothing-left",
+			repro: "removed_syscall()\n",
+			err:   true,
+		},
+		{
+			name:  "garbage",
+			repro: "test$int(0x1\n",
+			err:   true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			result, err := migrateRepro(target, []byte(test.repro))
+			if test.err != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, test.err)
+			}
+			if string(result) != test.result {
+				t.Fatalf("got:\n%s\nwant:\n%s", result, test.result)
+			}
+		})
 	}
 }
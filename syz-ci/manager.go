@@ -632,6 +632,10 @@ func (mgr *Manager) createDashboardBuild(info *BuildInfo, imageDir, typ string)
 		KernelCommitTitle:   info.KernelCommitTitle,
 		KernelCommitDate:    info.KernelCommitDate,
 		KernelConfig:        kernelConfig,
+		VMConfig: &dashapi.VMConfig{
+			Type:   mgr.managercfg.Type,
+			Config: mgr.managercfg.VM,
+		},
 	}
 	return build, nil
 }
@@ -185,10 +185,14 @@ type ManagerJobs struct {
 	PollCommits bool `json:"poll_commits"` // poll info about fix commits
 	BisectCause bool `json:"bisect_cause"` // do cause bisection
 	BisectFix   bool `json:"bisect_fix"`   // do fix bisection
+	Minimize    bool `json:"minimize"`     // rerun reproducer minimization on user requests
+	// Minimize kernel configs of the reproducers on user requests.
+	MinimizeConfig bool `json:"minimize_config"`
 }
 
 func (m *ManagerJobs) AnyEnabled() bool {
-	return m.TestPatches || m.PollCommits || m.BisectCause || m.BisectFix
+	return m.TestPatches || m.PollCommits || m.BisectCause || m.BisectFix || m.Minimize ||
+		m.MinimizeConfig
 }
 
 func (m *ManagerJobs) Filter(filter *ManagerJobs) *ManagerJobs {
@@ -197,6 +201,9 @@ func (m *ManagerJobs) Filter(filter *ManagerJobs) *ManagerJobs {
 		PollCommits: m.PollCommits && filter.PollCommits,
 		BisectCause: m.BisectCause && filter.BisectCause,
 		BisectFix:   m.BisectFix && filter.BisectFix,
+		Minimize:    m.Minimize && filter.Minimize,
+
+		MinimizeConfig: m.MinimizeConfig && filter.MinimizeConfig,
 	}
 }
 
@@ -413,6 +420,11 @@ func loadManagerConfig(cfg *Config, mgr *ManagerConfig) error {
 	if (mgr.Jobs.BisectCause || mgr.Jobs.BisectFix) && cfg.BisectBinDir == "" {
 		return fmt.Errorf("manager %v: enabled bisection but no bisect_bin_dir", mgr.Name)
 	}
+	if mgr.Jobs.MinimizeConfig && (cfg.BisectBinDir == "" || mgr.KernelBaselineConfig == "" ||
+		cfg.AssetStorage.IsEmpty()) {
+		return fmt.Errorf("manager %v: minimize_config needs bisect_bin_dir, kernel_baseline_config"+
+			" and asset_storage", mgr.Name)
+	}
 	mgr.managercfg = managercfg
 	managercfg.Syzkaller = filepath.FromSlash("syzkaller/current")
 	if managercfg.HTTP == "" {
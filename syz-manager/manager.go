@@ -882,6 +882,7 @@ func (mgr *Manager) saveCrash(crash *Crash) bool {
 			Log:         crash.Output,
 			Report:      crash.Report.Report,
 			MachineInfo: crash.machineInfo,
+			Structured:  crash.Report.Structured(),
 		}
 		setGuiltyFiles(dc, crash.Report)
 		resp, err := mgr.dash.ReportCrash(dc)
@@ -1072,6 +1073,7 @@ func (mgr *Manager) saveRepro(res *ReproResult) {
 			ReproSyz:   progText,
 			ReproC:     cprogText,
 			Assets:     mgr.uploadReproAssets(repro),
+			Structured: report.Structured(),
 		}
 		setGuiltyFiles(dc, report)
 		if _, err := mgr.dash.ReportCrash(dc); err != nil {
@@ -1444,8 +1446,16 @@ func (mgr *Manager) dashboardReporter() {
 	webAddr := publicWebAddr(mgr.cfg.HTTP)
 	var lastFuzzingTime time.Duration
 	var lastCrashes, lastSuppressedCrashes, lastExecs uint64
+	descriptionsReported := false
 	for {
 		time.Sleep(time.Minute)
+		if !descriptionsReported {
+			if err := mgr.dash.UploadManagerDescriptions(mgr.descriptionsReq()); err != nil {
+				log.Logf(0, "failed to upload descriptions: %v", err)
+			} else {
+				descriptionsReported = true
+			}
+		}
 		mgr.mu.Lock()
 		if mgr.firstConnect.IsZero() {
 			mgr.mu.Unlock()
@@ -1469,7 +1479,8 @@ func (mgr *Manager) dashboardReporter() {
 		}
 		mgr.mu.Unlock()
 
-		if err := mgr.dash.UploadManagerStats(req); err != nil {
+		resp, err := mgr.dash.UploadManagerStatsWithFocus(req)
+		if err != nil {
 			log.Logf(0, "failed to upload dashboard stats: %v", err)
 			continue
 		}
@@ -1479,7 +1490,45 @@ func (mgr *Manager) dashboardReporter() {
 		lastSuppressedCrashes += req.SuppressedCrashes
 		lastExecs += req.Execs
 		mgr.mu.Unlock()
+		mgr.addFocusCandidates(resp.Focus)
+	}
+}
+
+// addFocusCandidates queues the reproducers of the bugs the dashboard asked to focus on.
+// The candidates are marked as minimized, so that the fuzzers smash them even if they
+// don't give new signal. Since the dashboard is polled every minute, the programs are
+// mutated over and over until the focus window is over.
+func (mgr *Manager) addFocusCandidates(focus []dashapi.FocusProgram) {
+	var candidates []rpctype.Candidate
+	for _, f := range focus {
+		if time.Now().After(f.Until) {
+			continue
+		}
+		p, err := mgr.target.Deserialize(f.Prog, prog.NonStrict)
+		if err != nil {
+			log.Logf(0, "failed to parse the focus program of %q: %v", f.Title, err)
+			continue
+		}
+		log.Logf(1, "focusing on %q until %v", f.Title, f.Until)
+		candidates = append(candidates, rpctype.Candidate{
+			Prog:      p.Serialize(),
+			Minimized: true,
+		})
+	}
+	if len(candidates) != 0 {
+		mgr.addNewCandidates(candidates)
+	}
+}
+
+func (mgr *Manager) descriptionsReq() *dashapi.ManagerDescriptionsReq {
+	req := &dashapi.ManagerDescriptionsReq{
+		Name:            mgr.cfg.Name,
+		SyzkallerCommit: prog.GitRevisionBase,
+	}
+	for _, call := range mgr.target.Syscalls {
+		req.Syscalls = append(req.Syscalls, call.Name)
 	}
+	return req
 }
 
 func publicWebAddr(addr string) string {
@@ -51,9 +51,11 @@ func main() {
 		messages := []dashapi.DiscussionMessage{}
 		for _, m := range thread.Messages {
 			messages = append(messages, dashapi.DiscussionMessage{
-				ID:       m.MessageID,
-				External: !emailInList(emails, m.Author),
-				Time:     m.Date,
+				ID:        m.MessageID,
+				External:  !emailInList(emails, m.Author),
+				Time:      m.Date,
+				AutoReply: m.AutoReply,
+				Author:    m.Author,
 			})
 		}
 		discType := dashapi.DiscussionReport